@@ -0,0 +1,256 @@
+package checkawscloudwatchlogsinsights
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/awsutil"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type insightsOpts struct {
+	Region              string   `short:"r" long:"region" value-name:"REGION" description:"AWS Region"`
+	LogGroupNames       []string `long:"log-group-name" value-name:"LOG-GROUP-NAME" description:"Log group name to query (may be repeated)" unquote:"false"`
+	Query               string   `short:"q" long:"query" value-name:"QUERY" description:"Logs Insights query to execute" unquote:"false"`
+	QueryDefinitionName string   `long:"query-definition-name" value-name:"NAME" description:"Name of the saved query to execute instead of --query" unquote:"false"`
+	Period              int64    `long:"period" default:"5" value-name:"MINUTES" description:"Query the logs of the last minutes"`
+	Field               string   `short:"f" long:"field" value-name:"FIELD" description:"Result field to compare with the thresholds. The number of result rows is compared if omitted"`
+	Warning             *float64 `short:"w" long:"warning" value-name:"WARNING" description:"Trigger a warning if the value is over"`
+	Critical            *float64 `short:"c" long:"critical" value-name:"CRITICAL" description:"Trigger a critical if the value is over"`
+	LessThan            bool     `long:"less-than" description:"Compare with thresholds as lower limits instead of upper limits"`
+	Timeout             int64    `long:"timeout" default:"60" value-name:"SECONDS" description:"Seconds to wait for the query to complete"`
+	MaxRetries          int      `short:"t" long:"max-retries" value-name:"MAX-RETRIES" description:"Maximum number of retries to call the AWS API"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "CloudWatch Logs Insights"
+	return ckr
+}
+
+type awsCloudwatchLogsInsightsPlugin struct {
+	Service cloudwatchlogsiface.CloudWatchLogsAPI
+	// interval is the interval to poll the results of the query.
+	interval time.Duration
+	*insightsOpts
+}
+
+func newCloudwatchLogsInsightsPlugin(opts *insightsOpts) (*awsCloudwatchLogsInsightsPlugin, error) {
+	if (opts.Query == "") == (opts.QueryDefinitionName == "") {
+		return nil, fmt.Errorf("either --query or --query-definition-name must be specified")
+	}
+	var err error
+	p := &awsCloudwatchLogsInsightsPlugin{insightsOpts: opts, interval: time.Second}
+	p.Service, err = createService(opts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func createAWSConfig(opts *insightsOpts) *aws.Config {
+	conf := aws.NewConfig()
+	if opts.Region != "" {
+		conf = conf.WithRegion(opts.Region)
+	}
+	if opts.MaxRetries > 0 {
+		conf = conf.WithMaxRetries(opts.MaxRetries)
+	}
+	return conf
+}
+
+func createService(opts *insightsOpts) (*cloudwatchlogs.CloudWatchLogs, error) {
+	sess, err := session.NewSession(aws.NewConfig().WithHTTPClient(&http.Client{Transport: debuglog.Transport(nil)}))
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatchlogs.New(sess, createAWSConfig(opts)), nil
+}
+
+// resolveQuery returns the query string and the log groups to execute.
+// The log groups of the saved query are used unless --log-group-name is specified.
+func (p *awsCloudwatchLogsInsightsPlugin) resolveQuery() (string, []string, error) {
+	if p.Query != "" {
+		if len(p.LogGroupNames) == 0 {
+			return "", nil, fmt.Errorf("--log-group-name is required with --query")
+		}
+		return p.Query, p.LogGroupNames, nil
+	}
+
+	input := &cloudwatchlogs.DescribeQueryDefinitionsInput{
+		QueryDefinitionNamePrefix: aws.String(p.QueryDefinitionName),
+	}
+	for {
+		output, err := p.Service.DescribeQueryDefinitions(input)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, d := range output.QueryDefinitions {
+			// the names are only filtered by the prefix
+			if aws.StringValue(d.Name) != p.QueryDefinitionName {
+				continue
+			}
+			groups := p.LogGroupNames
+			if len(groups) == 0 {
+				groups = aws.StringValueSlice(d.LogGroupNames)
+			}
+			if len(groups) == 0 {
+				return "", nil, fmt.Errorf("the saved query %s has no log groups, so --log-group-name is required", p.QueryDefinitionName)
+			}
+			return aws.StringValue(d.QueryString), groups, nil
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	return "", nil, fmt.Errorf("the saved query %s is not found", p.QueryDefinitionName)
+}
+
+// execute starts the query over the last --period minutes and waits for the results.
+// The query is stopped if it does not complete within --timeout seconds.
+func (p *awsCloudwatchLogsInsightsPlugin) execute(query string, groups []string, now time.Time) ([][]*cloudwatchlogs.ResultField, error) {
+	started, err := p.Service.StartQuery(&cloudwatchlogs.StartQueryInput{
+		LogGroupNames: aws.StringSlice(groups),
+		QueryString:   aws.String(query),
+		StartTime:     aws.Int64(now.Add(-time.Duration(p.Period) * time.Minute).Unix()),
+		EndTime:       aws.Int64(now.Unix()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(time.Duration(p.Timeout) * time.Second)
+	for {
+		output, err := p.Service.GetQueryResults(&cloudwatchlogs.GetQueryResultsInput{
+			QueryId: started.QueryId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch status := aws.StringValue(output.Status); status {
+		case cloudwatchlogs.QueryStatusComplete:
+			return output.Results, nil
+		case cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning:
+		default:
+			return nil, fmt.Errorf("the query is %s", status)
+		}
+		if time.Now().After(deadline) {
+			// the query keeps consuming the quota of concurrent queries unless it is stopped.
+			p.Service.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: started.QueryId})
+			return nil, fmt.Errorf("the query did not complete in %d seconds", p.Timeout)
+		}
+		time.Sleep(p.interval)
+	}
+}
+
+func (p *awsCloudwatchLogsInsightsPlugin) exceeds(value, threshold float64) bool {
+	if p.LessThan {
+		return value < threshold
+	}
+	return value > threshold
+}
+
+// value returns the value to compare with the thresholds.
+// It is the number of the rows, or the worst value of --field among the rows.
+func (p *awsCloudwatchLogsInsightsPlugin) value(results [][]*cloudwatchlogs.ResultField) (string, *float64, error) {
+	if p.Field == "" {
+		n := float64(len(results))
+		return "the number of rows", &n, nil
+	}
+	var worst *float64
+	for _, row := range results {
+		for _, f := range row {
+			if aws.StringValue(f.Field) != p.Field {
+				continue
+			}
+			v, err := strconv.ParseFloat(aws.StringValue(f.Value), 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s is not a number: %q", p.Field, aws.StringValue(f.Value))
+			}
+			if worst == nil || p.exceeds(v, *worst) {
+				worst = &v
+			}
+		}
+	}
+	return p.Field, worst, nil
+}
+
+func (p *awsCloudwatchLogsInsightsPlugin) check(results [][]*cloudwatchlogs.ResultField) *checkers.Checker {
+	name, value, err := p.value(results)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if value == nil {
+		if len(results) == 0 {
+			return checkers.Ok(fmt.Sprintf("no results in the last %d minutes", p.Period))
+		}
+		return checkers.Unknown(fmt.Sprintf("%s is not found in the results", p.Field))
+	}
+
+	op := ">"
+	if p.LessThan {
+		op = "<"
+	}
+	if p.Critical != nil && p.exceeds(*value, *p.Critical) {
+		return checkers.Critical(fmt.Sprintf("%s is %g %s %g", name, *value, op, *p.Critical))
+	}
+	if p.Warning != nil && p.exceeds(*value, *p.Warning) {
+		return checkers.Warning(fmt.Sprintf("%s is %g %s %g", name, *value, op, *p.Warning))
+	}
+	return checkers.Ok(fmt.Sprintf("%s is %g", name, *value))
+}
+
+func (p *awsCloudwatchLogsInsightsPlugin) run() *checkers.Checker {
+	query, groups, err := p.resolveQuery()
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	results, err := p.execute(query, groups, time.Now())
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	return p.check(results)
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &insightsOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	p, err := newCloudwatchLogsInsightsPlugin(opts)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	if opts.SelfTest {
+		return selftest.Run(func() error {
+			svc, err := createService(opts)
+			if err != nil {
+				return err
+			}
+			return awsutil.CheckConfig(&svc.Config)
+		})
+	}
+	return p.run()
+}
@@ -0,0 +1,232 @@
+package checkawscloudwatchlogsinsights
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAWSCloudWatchLogsClient struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	definitions map[string]*cloudwatchlogs.DescribeQueryDefinitionsOutput
+	statuses    []string
+	results     [][]*cloudwatchlogs.ResultField
+	started     *cloudwatchlogs.StartQueryInput
+	stopped     bool
+}
+
+func (c *mockAWSCloudWatchLogsClient) DescribeQueryDefinitions(input *cloudwatchlogs.DescribeQueryDefinitionsInput) (*cloudwatchlogs.DescribeQueryDefinitionsOutput, error) {
+	if out, ok := c.definitions[aws.StringValue(input.NextToken)]; ok {
+		return out, nil
+	}
+	return nil, errors.New("invalid NextToken")
+}
+
+func (c *mockAWSCloudWatchLogsClient) StartQuery(input *cloudwatchlogs.StartQueryInput) (*cloudwatchlogs.StartQueryOutput, error) {
+	c.started = input
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String("q1")}, nil
+}
+
+func (c *mockAWSCloudWatchLogsClient) GetQueryResults(input *cloudwatchlogs.GetQueryResultsInput) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	status := c.statuses[0]
+	if len(c.statuses) > 1 {
+		c.statuses = c.statuses[1:]
+	}
+	out := &cloudwatchlogs.GetQueryResultsOutput{Status: aws.String(status)}
+	if status == cloudwatchlogs.QueryStatusComplete {
+		out.Results = c.results
+	}
+	return out, nil
+}
+
+func (c *mockAWSCloudWatchLogsClient) StopQuery(input *cloudwatchlogs.StopQueryInput) (*cloudwatchlogs.StopQueryOutput, error) {
+	c.stopped = true
+	return &cloudwatchlogs.StopQueryOutput{Success: aws.Bool(true)}, nil
+}
+
+func row(kv ...string) []*cloudwatchlogs.ResultField {
+	var fields []*cloudwatchlogs.ResultField
+	for i := 0; i < len(kv); i += 2 {
+		fields = append(fields, &cloudwatchlogs.ResultField{Field: aws.String(kv[i]), Value: aws.String(kv[i+1])})
+	}
+	return fields
+}
+
+func Test_resolveQuery(t *testing.T) {
+	client := &mockAWSCloudWatchLogsClient{
+		definitions: map[string]*cloudwatchlogs.DescribeQueryDefinitionsOutput{
+			"": {
+				QueryDefinitions: []*cloudwatchlogs.QueryDefinition{
+					{Name: aws.String("errors-by-host"), QueryString: aws.String("stats count(*) by host"), LogGroupNames: aws.StringSlice([]string{"/app"})},
+				},
+				NextToken: aws.String("1"),
+			},
+			"1": {
+				QueryDefinitions: []*cloudwatchlogs.QueryDefinition{
+					{Name: aws.String("errors"), QueryString: aws.String("filter level = 'ERROR' | stats count(*) as errors"), LogGroupNames: aws.StringSlice([]string{"/app", "/worker"})},
+					{Name: aws.String("no-groups"), QueryString: aws.String("stats count(*)")},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		opts       insightsOpts
+		wantQuery  string
+		wantGroups []string
+		wantErr    bool
+	}{
+		{
+			name:       "inline query",
+			opts:       insightsOpts{Query: "stats count(*)", LogGroupNames: []string{"/app"}},
+			wantQuery:  "stats count(*)",
+			wantGroups: []string{"/app"},
+		},
+		{
+			name:    "inline query without log groups",
+			opts:    insightsOpts{Query: "stats count(*)"},
+			wantErr: true,
+		},
+		{
+			name:       "saved query",
+			opts:       insightsOpts{QueryDefinitionName: "errors"},
+			wantQuery:  "filter level = 'ERROR' | stats count(*) as errors",
+			wantGroups: []string{"/app", "/worker"},
+		},
+		{
+			name:       "saved query with log groups",
+			opts:       insightsOpts{QueryDefinitionName: "errors", LogGroupNames: []string{"/batch"}},
+			wantQuery:  "filter level = 'ERROR' | stats count(*) as errors",
+			wantGroups: []string{"/batch"},
+		},
+		{
+			name:    "saved query without log groups",
+			opts:    insightsOpts{QueryDefinitionName: "no-groups"},
+			wantErr: true,
+		},
+		{
+			name:    "saved query not found",
+			opts:    insightsOpts{QueryDefinitionName: "error"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			p := &awsCloudwatchLogsInsightsPlugin{Service: client, insightsOpts: &opts}
+			query, groups, err := p.resolveQuery()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantQuery, query)
+			assert.Equal(t, tt.wantGroups, groups)
+		})
+	}
+}
+
+func Test_execute(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC)
+	results := [][]*cloudwatchlogs.ResultField{row("errors", "3")}
+
+	t.Run("complete", func(t *testing.T) {
+		client := &mockAWSCloudWatchLogsClient{
+			statuses: []string{cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning, cloudwatchlogs.QueryStatusComplete},
+			results:  results,
+		}
+		p := &awsCloudwatchLogsInsightsPlugin{Service: client, insightsOpts: &insightsOpts{Period: 5, Timeout: 60}}
+		res, err := p.execute("stats count(*) as errors", []string{"/app"}, now)
+		assert.NoError(t, err)
+		assert.Equal(t, results, res)
+		assert.Equal(t, now.Add(-5*time.Minute).Unix(), aws.Int64Value(client.started.StartTime))
+		assert.Equal(t, now.Unix(), aws.Int64Value(client.started.EndTime))
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		client := &mockAWSCloudWatchLogsClient{statuses: []string{cloudwatchlogs.QueryStatusFailed}}
+		p := &awsCloudwatchLogsInsightsPlugin{Service: client, insightsOpts: &insightsOpts{Period: 5, Timeout: 60}}
+		_, err := p.execute("stats count(*) as errors", []string{"/app"}, now)
+		assert.EqualError(t, err, "the query is Failed")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client := &mockAWSCloudWatchLogsClient{statuses: []string{cloudwatchlogs.QueryStatusRunning}}
+		p := &awsCloudwatchLogsInsightsPlugin{Service: client, insightsOpts: &insightsOpts{Period: 5, Timeout: 0}}
+		_, err := p.execute("stats count(*) as errors", []string{"/app"}, now)
+		assert.EqualError(t, err, "the query did not complete in 0 seconds")
+		assert.True(t, client.stopped, "the query should be stopped")
+	})
+}
+
+func Test_check(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	results := [][]*cloudwatchlogs.ResultField{
+		row("host", "web1", "errors", "3"),
+		row("host", "web2", "errors", "12"),
+	}
+	tests := []struct {
+		name    string
+		opts    insightsOpts
+		results [][]*cloudwatchlogs.ResultField
+		want    checkers.Status
+		message string
+	}{
+		{
+			name:    "rows",
+			opts:    insightsOpts{Warning: f(1), Critical: f(5)},
+			results: results,
+			want:    checkers.WARNING,
+			message: "the number of rows is 2 > 1",
+		},
+		{
+			name:    "the maximum value of the field",
+			opts:    insightsOpts{Field: "errors", Warning: f(5), Critical: f(10)},
+			results: results,
+			want:    checkers.CRITICAL,
+			message: "errors is 12 > 10",
+		},
+		{
+			name:    "the minimum value of the field",
+			opts:    insightsOpts{Field: "errors", Warning: f(5), Critical: f(1), LessThan: true},
+			results: results,
+			want:    checkers.WARNING,
+			message: "errors is 3 < 5",
+		},
+		{
+			name:    "no results",
+			opts:    insightsOpts{Field: "errors", Period: 5, Warning: f(5)},
+			want:    checkers.OK,
+			message: "no results in the last 5 minutes",
+		},
+		{
+			name:    "field not found",
+			opts:    insightsOpts{Field: "count", Warning: f(5)},
+			results: results,
+			want:    checkers.UNKNOWN,
+			message: "count is not found in the results",
+		},
+		{
+			name:    "not a number",
+			opts:    insightsOpts{Field: "host", Warning: f(5)},
+			results: results,
+			want:    checkers.UNKNOWN,
+			message: `host is not a number: "web1"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			p := &awsCloudwatchLogsInsightsPlugin{insightsOpts: &opts}
+			ckr := p.check(tt.results)
+			assert.Equal(t, tt.want, ckr.Status)
+			assert.Equal(t, tt.message, ckr.Message)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/mackerelio/go-check-plugins/check-aws-cloudwatch-logs-insights/lib"
+
+func main() {
+	checkawscloudwatchlogsinsights.Do()
+}
@@ -1,49 +1,101 @@
 package checkawscloudwatchlogs
 
 import (
-	"bytes"
-	"crypto/md5"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"github.com/jessevdk/go-flags"
 
 	"github.com/mackerelio/checkers"
-	"github.com/mackerelio/golib/pluginutil"
-	"github.com/natefinch/atomic"
+	"github.com/mackerelio/go-check-plugins/internal/awsutil"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
 )
 
 type logOpts struct {
 	LogGroupName        string `long:"log-group-name" required:"true" value-name:"LOG-GROUP-NAME" description:"Log group name" unquote:"false"`
 	LogStreamNamePrefix string `long:"log-stream-name-prefix" value-name:"LOG-STREAM-NAME-PREFIX" description:"Log stream name prefix" unquote:"false"`
 
-	Pattern       string `short:"p" long:"pattern" required:"true" value-name:"PATTERN" description:"Pattern to search for. The value is recognized as the pattern syntax of CloudWatch Logs." unquote:"false"`
-	WarningOver   int    `short:"w" long:"warning-over" value-name:"WARNING" description:"Trigger a warning if matched lines is over a number"`
-	CriticalOver  int    `short:"c" long:"critical-over" value-name:"CRITICAL" description:"Trigger a critical if matched lines is over a number"`
-	StateDir      string `short:"s" long:"state-dir" value-name:"DIR" description:"Dir to keep state files under" unquote:"false"`
-	ReturnContent bool   `short:"r" long:"return" description:"Output matched lines"`
-	MaxRetries    int    `short:"t" long:"max-retries" value-name:"MAX-RETRIES" description:"Maximum number of retries to call the AWS API"`
+	Pattern       []string `short:"p" long:"pattern" required:"true" value-name:"PATTERN" description:"Pattern to search for. The value is recognized as the pattern syntax of CloudWatch Logs. It can be repeated with thresholds for each pattern like PATTERN:w=1:c=10" unquote:"false"`
+	WarningOver   int      `short:"w" long:"warning-over" value-name:"WARNING" description:"Trigger a warning if matched lines is over a number"`
+	CriticalOver  int      `short:"c" long:"critical-over" value-name:"CRITICAL" description:"Trigger a critical if matched lines is over a number"`
+	StateDir      string   `short:"s" long:"state-dir" value-name:"DIR" description:"Dir to keep state files under" unquote:"false"`
+	ReturnContent bool     `short:"r" long:"return" description:"Output matched lines"`
+	MaxRetries    int      `short:"t" long:"max-retries" value-name:"MAX-RETRIES" description:"Maximum number of retries to call the AWS API"`
+	Summarize     int      `long:"summarize" value-name:"N" description:"Output the top N signatures of matched messages with counts"`
+	Limit         int64    `long:"limit" value-name:"N" description:"Maximum number of events returned by a request to the AWS API (up to 10000)"`
+	FastFail      bool     `long:"fast-fail" description:"Stop searching for a pattern once the matched lines are over the critical threshold"`
+
+	CredentialSource string `long:"credential-source" choice:"env" choice:"profile" choice:"web-identity" choice:"ec2-role" description:"Use the credentials only from the source instead of the default credential chain"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// patternSetting is a pattern to search for with its thresholds.
+// Each pattern is searched for independently, so it has its own state file.
+type patternSetting struct {
+	Pattern      string
+	WarningOver  int
+	CriticalOver int
+	StateFile    string
+	// Truncated reports whether the search was stopped by --fast-fail, so that there may be more messages.
+	Truncated bool
+}
+
+var thresholdsRe = regexp.MustCompile(`^(.*?)((?::[wc]=-?[0-9]+)+)$`)
+
+// parsePatternSetting parses PATTERN[:w=N][:c=N].
+// Thresholds which are not attached to the pattern default to --warning-over and --critical-over.
+func parsePatternSetting(s string, warningOver, criticalOver int) *patternSetting {
+	ps := &patternSetting{Pattern: s, WarningOver: warningOver, CriticalOver: criticalOver}
+	m := thresholdsRe.FindStringSubmatch(s)
+	if m == nil {
+		return ps
+	}
+	ps.Pattern = m[1]
+	for _, t := range strings.Split(strings.TrimPrefix(m[2], ":"), ":") {
+		// the value always matches with thresholdsRe
+		n, _ := strconv.Atoi(t[2:])
+		switch t[0] {
+		case 'w':
+			ps.WarningOver = n
+		case 'c':
+			ps.CriticalOver = n
+		}
+	}
+	return ps
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "CloudWatch Logs"
-	ckr.Exit()
+	return ckr
 }
 
 type awsCloudwatchLogsPlugin struct {
-	Service   cloudwatchlogsiface.CloudWatchLogsAPI
-	StateFile string
+	Service  cloudwatchlogsiface.CloudWatchLogsAPI
+	Patterns []*patternSetting
 	*logOpts
 }
 
@@ -54,35 +106,30 @@ func newCloudwatchLogsPlugin(opts *logOpts, args []string) (*awsCloudwatchLogsPl
 	if err != nil {
 		return nil, err
 	}
-	if p.StateDir == "" {
-		workdir := pluginutil.PluginWorkDir()
-		p.StateDir = filepath.Join(workdir, "check-cloudwatch-logs")
+	p.StateDir = state.Dir(p.StateDir, "check-cloudwatch-logs")
+	for _, pattern := range opts.Pattern {
+		ps := parsePatternSetting(pattern, opts.WarningOver, opts.CriticalOver)
+		if len(opts.Pattern) == 1 {
+			ps.StateFile = getStateFile(p.StateDir, opts.LogGroupName, opts.LogStreamNamePrefix, args)
+		} else {
+			ps.StateFile = getStateFile(p.StateDir, opts.LogGroupName, opts.LogStreamNamePrefix, append([]string{pattern}, args...))
+		}
+		p.Patterns = append(p.Patterns, ps)
 	}
-	p.StateFile = getStateFile(p.StateDir, opts.LogGroupName, opts.LogStreamNamePrefix, args)
 	return p, nil
 }
 
 var stateRe = regexp.MustCompile(`[^-a-zA-Z0-9_.]`)
 
 func getStateFile(stateDir, logGroupName, logStreamNamePrefix string, args []string) string {
-	return filepath.Join(
+	return state.File(
 		stateDir,
-		fmt.Sprintf(
-			"%s-%x.json",
-			strings.TrimLeft(stateRe.ReplaceAllString(logGroupName+"_"+logStreamNamePrefix, "_"), "_"),
-			md5.Sum([]byte(
-				strings.Join(
-					[]string{
-						os.Getenv("AWS_PROFILE"),
-						os.Getenv("AWS_ACCESS_KEY_ID"),
-						os.Getenv("AWS_SECRET_ACCESS_KEY"),
-						os.Getenv("AWS_REGION"),
-						strings.Join(args, " "),
-					},
-					" ",
-				)),
-			),
-		),
+		strings.TrimLeft(stateRe.ReplaceAllString(logGroupName+"_"+logStreamNamePrefix, "_"), "_"),
+		os.Getenv("AWS_PROFILE"),
+		os.Getenv("AWS_ACCESS_KEY_ID"),
+		os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		os.Getenv("AWS_REGION"),
+		strings.Join(args, " "),
 	)
 }
 
@@ -94,12 +141,54 @@ func createAWSConfig(opts *logOpts) *aws.Config {
 	return conf
 }
 
+// sessionOptions returns the options to load the shared config, so that the profiles of AWS SSO,
+// assume role and credential_process in ~/.aws/config are resolved as the AWS CLI does.
+func sessionOptions(credentialSource string) session.Options {
+	o := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if credentialSource == "profile" {
+		// the profile given explicitly takes precedence over the credentials of the environment variables
+		o.Profile = os.Getenv("AWS_PROFILE")
+		if o.Profile == "" {
+			o.Profile = session.DefaultSharedConfigProfile
+		}
+	}
+	return o
+}
+
+// newCredentials returns the credentials of --credential-source, or nil for the default credential chain of the session.
+func newCredentials(sess *session.Session, credentialSource string) (*credentials.Credentials, error) {
+	switch credentialSource {
+	case "env":
+		return credentials.NewEnvCredentials(), nil
+	case "web-identity":
+		// the environment variables set by IAM roles for service accounts (IRSA) of EKS
+		roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		if roleARN == "" || tokenFile == "" {
+			return nil, errors.New("AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are required for --credential-source=web-identity")
+		}
+		return stscreds.NewWebIdentityCredentials(sess, roleARN, os.Getenv("AWS_ROLE_SESSION_NAME"), tokenFile), nil
+	case "ec2-role":
+		return ec2rolecreds.NewCredentials(sess), nil
+	}
+	return nil, nil
+}
+
 func createService(opts *logOpts) (*cloudwatchlogs.CloudWatchLogs, error) {
-	sess, err := session.NewSession()
+	o := sessionOptions(opts.CredentialSource)
+	o.Config.HTTPClient = &http.Client{Transport: debuglog.Transport(nil)}
+	sess, err := session.NewSessionWithOptions(o)
 	if err != nil {
 		return nil, err
 	}
-	return cloudwatchlogs.New(sess, createAWSConfig(opts)), nil
+	conf := createAWSConfig(opts)
+	creds, err := newCredentials(sess, opts.CredentialSource)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		conf = conf.WithCredentials(creds)
+	}
+	return cloudwatchlogs.New(sess, conf), nil
 }
 
 type logState struct {
@@ -107,14 +196,13 @@ type logState struct {
 	StartTime *int64
 }
 
-func (p *awsCloudwatchLogsPlugin) collect() ([]string, error) {
+func (p *awsCloudwatchLogsPlugin) collect(ps *patternSetting) ([]string, error) {
 	var nextToken *string
 	var startTime *int64
-	if s, err := p.loadState(); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	} else {
+	var s logState
+	if ok, err := state.Load(ps.StateFile, &s); err != nil {
+		return nil, err
+	} else if ok {
 		if s.StartTime != nil && *s.StartTime > time.Now().Add(-time.Hour).Unix()*1000 {
 			nextToken = s.NextToken
 			startTime = s.StartTime
@@ -129,11 +217,16 @@ func (p *awsCloudwatchLogsPlugin) collect() ([]string, error) {
 			StartTime:     startTime,
 			LogGroupName:  aws.String(p.LogGroupName),
 			NextToken:     nextToken,
-			FilterPattern: aws.String(p.Pattern),
+			FilterPattern: aws.String(ps.Pattern),
+			// the events of all streams are searched at once; AWS has ignored false since 2019
+			Interleaved: aws.Bool(true),
 		}
 		if p.LogStreamNamePrefix != "" {
 			input.LogStreamNamePrefix = aws.String(p.LogStreamNamePrefix)
 		}
+		if p.Limit > 0 {
+			input.Limit = aws.Int64(p.Limit)
+		}
 		output, err := p.Service.FilterLogEvents(input)
 		if err != nil {
 			return nil, err
@@ -148,64 +241,127 @@ func (p *awsCloudwatchLogsPlugin) collect() ([]string, error) {
 			nextToken = output.NextToken
 		}
 		if nextToken != nil {
-			if err := p.saveState(&logState{nextToken, startTime}); err != nil {
+			if err := state.Save(ps.StateFile, &logState{nextToken, startTime}); err != nil {
 				return nil, err
 			}
 		}
 		if output.NextToken == nil {
 			break
 		}
+		// the state is saved above, so that the next check resumes from the rest of the messages
+		if p.FastFail && len(messages) > ps.CriticalOver {
+			ps.Truncated = true
+			break
+		}
 		time.Sleep(150 * time.Millisecond)
 	}
 	return messages, nil
 }
 
-func (p *awsCloudwatchLogsPlugin) loadState() (*logState, error) {
-	f, err := os.Open(p.StateFile)
-	if err != nil {
-		return nil, err
+func (ps *patternSetting) check(messages []string) (checkers.Status, string) {
+	status := checkers.OK
+	msg := fmt.Sprint(len(messages))
+	if ps.Truncated {
+		msg += "+"
 	}
-	defer f.Close()
-	var s logState
-	err = json.NewDecoder(f).Decode(&s)
-	if err != nil {
-		return nil, err
+	if len(messages) > ps.CriticalOver {
+		status = checkers.CRITICAL
+		msg += " > " + fmt.Sprint(ps.CriticalOver)
+	} else if len(messages) > ps.WarningOver {
+		status = checkers.WARNING
+		msg += " > " + fmt.Sprint(ps.WarningOver)
 	}
-	return &s, nil
+	msg += " messages for pattern /" + ps.Pattern + "/"
+	return status, msg
 }
 
-func (p *awsCloudwatchLogsPlugin) saveState(s *logState) error {
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(s); err != nil {
-		return err
+// check evaluates the messages of each pattern independently, and reports the worst status.
+func (p *awsCloudwatchLogsPlugin) check(messages [][]string) *checkers.Checker {
+	status := checkers.OK
+	var msgs []string
+	var summary, content string
+	for i, ps := range p.Patterns {
+		st, msg := ps.check(messages[i])
+		if st > status {
+			status = st
+		}
+		msgs = append(msgs, msg)
+		if st != checkers.OK && p.Summarize > 0 {
+			summary += "/" + ps.Pattern + "/\n" + summarize(messages[i], p.Summarize)
+		}
+		if st != checkers.OK && p.ReturnContent {
+			content += strings.Join(messages[i], "")
+		}
+	}
+	msg := strings.Join(msgs, ", ")
+	if summary != "" {
+		msg += "\n" + summary
 	}
-	if err := os.MkdirAll(filepath.Dir(p.StateFile), 0755); err != nil {
-		return err
+	if content != "" {
+		msg += "\n" + content
 	}
-	return atomic.WriteFile(p.StateFile, &buf)
+	return checkers.NewChecker(status, msg)
 }
 
-func (p *awsCloudwatchLogsPlugin) check(messages []string) *checkers.Checker {
-	status := checkers.OK
-	msg := fmt.Sprint(len(messages))
-	if len(messages) > p.CriticalOver {
-		status = checkers.CRITICAL
-		msg += " > " + fmt.Sprint(p.CriticalOver)
-	} else if len(messages) > p.WarningOver {
-		status = checkers.WARNING
-		msg += " > " + fmt.Sprint(p.WarningOver)
+var (
+	timestampRe = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`)
+	uuidRe      = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	ipRe        = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+	hexRe       = regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]{8,}\b`)
+	numberRe    = regexp.MustCompile(`\d+`)
+)
+
+// signature normalizes the message to group the messages which differ only in timestamps, ids or numbers.
+func signature(message string) string {
+	sig := strings.TrimSpace(message)
+	sig = timestampRe.ReplaceAllString(sig, "<time>")
+	sig = uuidRe.ReplaceAllString(sig, "<uuid>")
+	sig = ipRe.ReplaceAllString(sig, "<ip>")
+	sig = hexRe.ReplaceAllStringFunc(sig, func(s string) string {
+		// words only with the letters a-f are not ids, and numbers are replaced later
+		if !strings.ContainsAny(s, "0123456789") || !strings.ContainsAny(s, "abcdefABCDEFx") {
+			return s
+		}
+		return "<hex>"
+	})
+	return numberRe.ReplaceAllString(sig, "<n>")
+}
+
+// summarize groups the messages by their signatures, and returns the top n signatures with counts.
+func summarize(messages []string, n int) string {
+	counts := make(map[string]int)
+	for _, m := range messages {
+		counts[signature(m)]++
 	}
-	msg += " messages for pattern /" + p.Pattern + "/"
-	if status != checkers.OK && p.ReturnContent {
-		msg += "\n" + strings.Join(messages, "")
+	sigs := make([]string, 0, len(counts))
+	for sig := range counts {
+		sigs = append(sigs, sig)
 	}
-	return checkers.NewChecker(status, msg)
+	sort.Slice(sigs, func(i, j int) bool {
+		if counts[sigs[i]] != counts[sigs[j]] {
+			return counts[sigs[i]] > counts[sigs[j]]
+		}
+		return sigs[i] < sigs[j]
+	})
+	var b strings.Builder
+	for i, sig := range sigs {
+		if i == n {
+			fmt.Fprintf(&b, "  ... and %d more signatures\n", len(sigs)-n)
+			break
+		}
+		fmt.Fprintf(&b, "  %d x %s\n", counts[sig], sig)
+	}
+	return b.String()
 }
 
 func (p *awsCloudwatchLogsPlugin) run() *checkers.Checker {
-	messages, err := p.collect()
-	if err != nil {
-		return checkers.Unknown(fmt.Sprint(err))
+	var messages [][]string
+	for _, ps := range p.Patterns {
+		m, err := p.collect(ps)
+		if err != nil {
+			return checkers.Unknown(fmt.Sprint(err))
+		}
+		messages = append(messages, m)
 	}
 	return p.check(messages)
 }
@@ -214,11 +370,24 @@ func run(args []string) *checkers.Checker {
 	opts := &logOpts{}
 	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.Limit < 0 || opts.Limit > 10000 {
+		return checkers.Unknown("--limit must be between 1 and 10000")
 	}
 	p, err := newCloudwatchLogsPlugin(opts, args)
 	if err != nil {
 		return checkers.Unknown(fmt.Sprint(err))
 	}
+	if opts.SelfTest {
+		return selftest.Run(func() error {
+			svc, err := createService(opts)
+			if err != nil {
+				return err
+			}
+			return awsutil.CheckConfig(&svc.Config)
+		})
+	}
 	return p.run()
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 )
@@ -90,13 +91,12 @@ func Test_cloudwatchLogsPlugin_collect(t *testing.T) {
 	file.Close()
 	defer os.Remove(file.Name())
 	p := &awsCloudwatchLogsPlugin{
-		Service:   createMockService(),
-		StateFile: file.Name(),
+		Service: createMockService(),
 		logOpts: &logOpts{
 			LogGroupName: "test-group",
 		},
 	}
-	messages, err := p.collect()
+	messages, err := p.collect(&patternSetting{StateFile: file.Name()})
 	assert.Equal(t, err, nil, "err should be nil")
 	assert.Equal(t, len(messages), 6)
 	cnt, _ := ioutil.ReadFile(file.Name())
@@ -105,6 +105,40 @@ func Test_cloudwatchLogsPlugin_collect(t *testing.T) {
 	assert.Equal(t, *s.NextToken, "2")
 }
 
+func Test_cloudwatchLogsPlugin_collectFastFail(t *testing.T) {
+	file, _ := ioutil.TempFile("", "check-cloudwatch-logs-test-collect")
+	os.Remove(file.Name())
+	file.Close()
+	defer os.Remove(file.Name())
+	p := &awsCloudwatchLogsPlugin{
+		Service: createMockService(),
+		logOpts: &logOpts{
+			LogGroupName: "test-group",
+			FastFail:     true,
+		},
+	}
+	ps := &patternSetting{StateFile: file.Name(), CriticalOver: 1}
+	messages, err := p.collect(ps)
+	assert.Equal(t, err, nil, "err should be nil")
+	assert.Equal(t, 2, len(messages))
+	assert.True(t, ps.Truncated)
+	cnt, _ := ioutil.ReadFile(file.Name())
+	var s logState
+	json.NewDecoder(bytes.NewReader(cnt)).Decode(&s)
+	assert.Equal(t, "1", *s.NextToken, "the next check should resume from the rest")
+
+	status, msg := ps.check(messages)
+	assert.Equal(t, checkers.CRITICAL, status)
+	assert.Equal(t, "2+ > 1 messages for pattern //", msg)
+
+	// the search is not stopped unless the messages are over the critical threshold
+	os.Remove(file.Name())
+	ps = &patternSetting{StateFile: file.Name(), CriticalOver: 10}
+	messages, _ = p.collect(ps)
+	assert.Equal(t, 6, len(messages))
+	assert.False(t, ps.Truncated)
+}
+
 func Test_cloudwatchLogsPlugin_check(t *testing.T) {
 	testCases := []struct {
 		CriticalOver, WarningOver int
@@ -158,19 +192,58 @@ func Test_cloudwatchLogsPlugin_check(t *testing.T) {
 	}
 	for _, testCase := range testCases {
 		p := &awsCloudwatchLogsPlugin{
+			Patterns: []*patternSetting{
+				{
+					CriticalOver: testCase.CriticalOver,
+					WarningOver:  testCase.WarningOver,
+					Pattern:      testCase.Pattern,
+				},
+			},
 			logOpts: &logOpts{
-				CriticalOver:  testCase.CriticalOver,
-				WarningOver:   testCase.WarningOver,
-				Pattern:       testCase.Pattern,
 				ReturnContent: testCase.ReturnContent,
 			},
 		}
-		res := p.check(testCase.Messages)
+		res := p.check([][]string{testCase.Messages})
 		assert.Equal(t, res.Status, testCase.Status)
 		assert.Equal(t, res.Message, testCase.Message)
 	}
 }
 
+func Test_cloudwatchLogsPlugin_checkPatterns(t *testing.T) {
+	p := &awsCloudwatchLogsPlugin{
+		Patterns: []*patternSetting{
+			parsePatternSetting("ERROR:w=1:c=10", 0, 0),
+			parsePatternSetting("FATAL:c=1", 0, 0),
+		},
+		logOpts: &logOpts{
+			ReturnContent: true,
+		},
+	}
+	res := p.check([][]string{{"ERROR a\n", "ERROR b\n"}, {"FATAL c\n"}})
+	assert.Equal(t, checkers.WARNING, res.Status)
+	assert.Equal(t, "2 > 1 messages for pattern /ERROR/, 1 > 0 messages for pattern /FATAL/\nERROR a\nERROR b\nFATAL c\n", res.Message)
+
+	res = p.check([][]string{{}, {"FATAL c\n", "FATAL d\n"}})
+	assert.Equal(t, checkers.CRITICAL, res.Status)
+	assert.Equal(t, "0 messages for pattern /ERROR/, 2 > 1 messages for pattern /FATAL/\nFATAL c\nFATAL d\n", res.Message)
+}
+
+func Test_parsePatternSetting(t *testing.T) {
+	tests := []struct {
+		value string
+		want  patternSetting
+	}{
+		{value: "ERROR", want: patternSetting{Pattern: "ERROR", WarningOver: 3, CriticalOver: 5}},
+		{value: "ERROR:w=1:c=10", want: patternSetting{Pattern: "ERROR", WarningOver: 1, CriticalOver: 10}},
+		{value: `"FATAL":c=1`, want: patternSetting{Pattern: `"FATAL"`, WarningOver: 3, CriticalOver: 1}},
+		{value: `"err:"`, want: patternSetting{Pattern: `"err:"`, WarningOver: 3, CriticalOver: 5}},
+		{value: `{ $.level = "w=1" }`, want: patternSetting{Pattern: `{ $.level = "w=1" }`, WarningOver: 3, CriticalOver: 5}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, &tt.want, parsePatternSetting(tt.value, 3, 5), tt.value)
+	}
+}
+
 func Test_cloudwatchLogsPlugin_options(t *testing.T) {
 	tests := []struct {
 		name string
@@ -188,7 +261,7 @@ func Test_cloudwatchLogsPlugin_options(t *testing.T) {
 			want: logOpts{
 				LogGroupName:        `"name"`,
 				LogStreamNamePrefix: `"prefix"`,
-				Pattern:             `"err:"`,
+				Pattern:             []string{`"err:"`},
 				StateDir:            `"dir"`,
 			},
 		},
@@ -228,3 +301,81 @@ func Test_createAWSConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_sessionOptions(t *testing.T) {
+	assert.Equal(t, "", sessionOptions("").Profile)
+
+	if v, ok := os.LookupEnv("AWS_PROFILE"); ok {
+		defer os.Setenv("AWS_PROFILE", v)
+	} else {
+		defer os.Unsetenv("AWS_PROFILE")
+	}
+	os.Unsetenv("AWS_PROFILE")
+	assert.Equal(t, "default", sessionOptions("profile").Profile)
+	os.Setenv("AWS_PROFILE", "sso-readonly")
+	assert.Equal(t, "sso-readonly", sessionOptions("profile").Profile)
+}
+
+func Test_newCredentials(t *testing.T) {
+	for _, k := range []string{"AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		if v, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, v)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Unsetenv(k)
+	}
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("us-east-1")))
+	creds, err := newCredentials(sess, "")
+	assert.Nil(t, err)
+	assert.Nil(t, creds)
+
+	_, err = newCredentials(sess, "web-identity")
+	assert.EqualError(t, err, "AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are required for --credential-source=web-identity")
+
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/check")
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	creds, err = newCredentials(sess, "web-identity")
+	assert.Nil(t, err)
+	assert.NotNil(t, creds)
+}
+
+func Test_signature(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"ERROR connection refused\n", "ERROR connection refused"},
+		{"2021-03-04T05:06:07.890Z ERROR user 123 not found", "<time> ERROR user <n> not found"},
+		{"[12:34:56] request 3f2a9c1e-0b4d-4e5f-8a6b-7c8d9e0f1a2b failed", "[<time>] request <uuid> failed"},
+		{"dial tcp 10.0.1.23:5432: timeout", "dial tcp <ip>:<n>: timeout"},
+		{"trace 5f3a9c0d12ab facade deadbeef 12345678", "trace <hex> facade deadbeef <n>"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, signature(tt.message), tt.message)
+	}
+}
+
+func Test_cloudwatchLogsPlugin_summarize(t *testing.T) {
+	p := &awsCloudwatchLogsPlugin{
+		Patterns: []*patternSetting{{Pattern: "ERROR", WarningOver: 1, CriticalOver: 10}},
+		logOpts:  &logOpts{Summarize: 2},
+	}
+	messages := []string{
+		"2021-03-04 05:06:07 ERROR user 1 not found\n",
+		"2021-03-04 05:06:08 ERROR timeout after 30s\n",
+		"2021-03-04 05:06:09 ERROR user 2 not found\n",
+		"2021-03-04 05:06:10 ERROR disk full\n",
+		"2021-03-04 05:06:11 ERROR user 3 not found\n",
+		"2021-03-04 05:06:12 ERROR timeout after 60s\n",
+	}
+	res := p.check([][]string{messages})
+	assert.Equal(t, checkers.WARNING, res.Status)
+	assert.Equal(t, `6 > 1 messages for pattern /ERROR/
+/ERROR/
+  3 x <time> ERROR user <n> not found
+  2 x <time> ERROR timeout after <n>s
+  ... and 1 more signatures
+`, res.Message)
+}
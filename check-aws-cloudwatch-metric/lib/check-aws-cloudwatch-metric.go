@@ -0,0 +1,200 @@
+package checkawscloudwatchmetric
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/awsutil"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type metricOpts struct {
+	Region      string   `short:"r" long:"region" value-name:"REGION" description:"AWS Region"`
+	Namespace   string   `short:"n" long:"namespace" required:"true" value-name:"NAMESPACE" description:"Namespace of the metric (e.g. AWS/EC2)"`
+	MetricName  string   `short:"m" long:"metric-name" required:"true" value-name:"METRIC-NAME" description:"Name of the metric"`
+	Dimensions  []string `short:"d" long:"dimension" value-name:"NAME=VALUE" description:"Dimension of the metric (may be repeated)"`
+	Statistic   string   `short:"s" long:"statistic" default:"Average" value-name:"STATISTIC" description:"Statistic of the metric (e.g. Average, Maximum, Sum or p99)"`
+	Period      int64    `long:"period" default:"60" value-name:"SECONDS" description:"Period of the metric in seconds"`
+	Lookback    int64    `long:"lookback" default:"600" value-name:"SECONDS" description:"Seconds to look back for the latest datapoint"`
+	Warning     *float64 `short:"w" long:"warning" value-name:"WARNING" description:"Trigger a warning if the value is over"`
+	Critical    *float64 `short:"c" long:"critical" value-name:"CRITICAL" description:"Trigger a critical if the value is over"`
+	LessThan    bool     `long:"less-than" description:"Compare with thresholds as lower limits instead of upper limits"`
+	MissingData string   `long:"missing-data" choice:"ok" choice:"critical" choice:"unknown" default:"unknown" description:"Status when there are no datapoints"`
+	MaxRetries  int      `short:"t" long:"max-retries" value-name:"MAX-RETRIES" description:"Maximum number of retries to call the AWS API"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "CloudWatch Metric"
+	return ckr
+}
+
+type awsCloudwatchMetricPlugin struct {
+	Service    cloudwatchiface.CloudWatchAPI
+	dimensions []*cloudwatch.Dimension
+	*metricOpts
+}
+
+func newCloudwatchMetricPlugin(opts *metricOpts) (*awsCloudwatchMetricPlugin, error) {
+	var err error
+	p := &awsCloudwatchMetricPlugin{metricOpts: opts}
+	p.dimensions, err = parseDimensions(opts.Dimensions)
+	if err != nil {
+		return nil, err
+	}
+	p.Service, err = createService(opts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseDimensions(dims []string) ([]*cloudwatch.Dimension, error) {
+	var dimensions []*cloudwatch.Dimension
+	for _, d := range dims {
+		kv := strings.SplitN(d, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid dimension %q: must be NAME=VALUE", d)
+		}
+		dimensions = append(dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(kv[0]),
+			Value: aws.String(kv[1]),
+		})
+	}
+	return dimensions, nil
+}
+
+func createAWSConfig(opts *metricOpts) *aws.Config {
+	conf := aws.NewConfig()
+	if opts.Region != "" {
+		conf = conf.WithRegion(opts.Region)
+	}
+	if opts.MaxRetries > 0 {
+		conf = conf.WithMaxRetries(opts.MaxRetries)
+	}
+	return conf
+}
+
+func createService(opts *metricOpts) (*cloudwatch.CloudWatch, error) {
+	sess, err := session.NewSession(aws.NewConfig().WithHTTPClient(&http.Client{Transport: debuglog.Transport(nil)}))
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatch.New(sess, createAWSConfig(opts)), nil
+}
+
+// fetchLatest returns the latest datapoint of the metric, or nil if there are no datapoints.
+func (p *awsCloudwatchMetricPlugin) fetchLatest(now time.Time) (*float64, error) {
+	output, err := p.Service.GetMetricData(&cloudwatch.GetMetricDataInput{
+		MetricDataQueries: []*cloudwatch.MetricDataQuery{
+			{
+				Id: aws.String("m1"),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String(p.Namespace),
+						MetricName: aws.String(p.MetricName),
+						Dimensions: p.dimensions,
+					},
+					Period: aws.Int64(p.Period),
+					Stat:   aws.String(p.Statistic),
+				},
+			},
+		},
+		StartTime: aws.Time(now.Add(-time.Duration(p.Lookback) * time.Second)),
+		EndTime:   aws.Time(now),
+		ScanBy:    aws.String(cloudwatch.ScanByTimestampDescending),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range output.MetricDataResults {
+		if len(r.Values) > 0 {
+			return r.Values[0], nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *awsCloudwatchMetricPlugin) exceeds(value, threshold float64) bool {
+	if p.LessThan {
+		return value < threshold
+	}
+	return value > threshold
+}
+
+func (p *awsCloudwatchMetricPlugin) check(value *float64) *checkers.Checker {
+	name := fmt.Sprintf("%s %s(%s)", p.Namespace, p.MetricName, p.Statistic)
+	if value == nil {
+		msg := fmt.Sprintf("no datapoints of %s in the last %d seconds", name, p.Lookback)
+		switch p.MissingData {
+		case "ok":
+			return checkers.Ok(msg)
+		case "critical":
+			return checkers.Critical(msg)
+		default:
+			return checkers.Unknown(msg)
+		}
+	}
+
+	op := ">"
+	if p.LessThan {
+		op = "<"
+	}
+	if p.Critical != nil && p.exceeds(*value, *p.Critical) {
+		return checkers.Critical(fmt.Sprintf("%s is %g %s %g", name, *value, op, *p.Critical))
+	}
+	if p.Warning != nil && p.exceeds(*value, *p.Warning) {
+		return checkers.Warning(fmt.Sprintf("%s is %g %s %g", name, *value, op, *p.Warning))
+	}
+	return checkers.Ok(fmt.Sprintf("%s is %g", name, *value))
+}
+
+func (p *awsCloudwatchMetricPlugin) run() *checkers.Checker {
+	value, err := p.fetchLatest(time.Now())
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	return p.check(value)
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &metricOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	p, err := newCloudwatchMetricPlugin(opts)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	if opts.SelfTest {
+		return selftest.Run(func() error {
+			svc, err := createService(opts)
+			if err != nil {
+				return err
+			}
+			return awsutil.CheckConfig(&svc.Config)
+		})
+	}
+	return p.run()
+}
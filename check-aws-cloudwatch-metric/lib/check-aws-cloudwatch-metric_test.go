@@ -0,0 +1,88 @@
+package checkawscloudwatchmetric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+type mockAWSCloudWatchClient struct {
+	cloudwatchiface.CloudWatchAPI
+	input  *cloudwatch.GetMetricDataInput
+	values []*float64
+}
+
+func (c *mockAWSCloudWatchClient) GetMetricData(input *cloudwatch.GetMetricDataInput) (*cloudwatch.GetMetricDataOutput, error) {
+	c.input = input
+	return &cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []*cloudwatch.MetricDataResult{
+			{
+				Id:         aws.String("m1"),
+				StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+				Values:     c.values,
+			},
+		},
+	}, nil
+}
+
+func TestParseDimensions(t *testing.T) {
+	dims, err := parseDimensions([]string{"InstanceId=i-0123456789", "Name=a=b"})
+	assert.Nil(t, err)
+	assert.Len(t, dims, 2)
+	assert.Equal(t, "InstanceId", *dims[0].Name)
+	assert.Equal(t, "i-0123456789", *dims[0].Value)
+	assert.Equal(t, "a=b", *dims[1].Value)
+
+	_, err = parseDimensions([]string{"InstanceId"})
+	assert.NotNil(t, err)
+}
+
+func TestFetchLatest(t *testing.T) {
+	mock := &mockAWSCloudWatchClient{values: []*float64{aws.Float64(85), aws.Float64(40)}}
+	p := &awsCloudwatchMetricPlugin{
+		Service:    mock,
+		dimensions: []*cloudwatch.Dimension{{Name: aws.String("InstanceId"), Value: aws.String("i-0123456789")}},
+		metricOpts: &metricOpts{Namespace: "AWS/EC2", MetricName: "CPUUtilization", Statistic: "Average", Period: 60, Lookback: 600},
+	}
+	now := time.Now()
+	v, err := p.fetchLatest(now)
+	assert.Nil(t, err)
+	assert.Equal(t, 85.0, *v)
+	assert.Equal(t, now.Add(-10*time.Minute), *mock.input.StartTime)
+	assert.Equal(t, cloudwatch.ScanByTimestampDescending, *mock.input.ScanBy)
+
+	mock.values = nil
+	v, err = p.fetchLatest(now)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		opts  metricOpts
+		value *float64
+		want  checkers.Status
+	}{
+		{opts: metricOpts{Warning: aws.Float64(70), Critical: aws.Float64(90)}, value: aws.Float64(50), want: checkers.OK},
+		{opts: metricOpts{Warning: aws.Float64(70), Critical: aws.Float64(90)}, value: aws.Float64(80), want: checkers.WARNING},
+		{opts: metricOpts{Warning: aws.Float64(70), Critical: aws.Float64(90)}, value: aws.Float64(95), want: checkers.CRITICAL},
+		{opts: metricOpts{Critical: aws.Float64(90)}, value: aws.Float64(80), want: checkers.OK},
+		{opts: metricOpts{Warning: aws.Float64(10), Critical: aws.Float64(5), LessThan: true}, value: aws.Float64(8), want: checkers.WARNING},
+		{opts: metricOpts{Warning: aws.Float64(10), Critical: aws.Float64(5), LessThan: true}, value: aws.Float64(3), want: checkers.CRITICAL},
+		{opts: metricOpts{MissingData: "ok"}, value: nil, want: checkers.OK},
+		{opts: metricOpts{MissingData: "critical"}, value: nil, want: checkers.CRITICAL},
+		{opts: metricOpts{MissingData: "unknown"}, value: nil, want: checkers.UNKNOWN},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		p := &awsCloudwatchMetricPlugin{metricOpts: &opts}
+		ckr := p.check(tt.value)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
@@ -3,57 +3,75 @@ package checkawssqsqueuesize
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/awsutil"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "SQSQueueSize"
-	ckr.Exit()
+	return ckr
 }
 
-var opts struct {
+type sqsOpts struct {
 	Region          string `short:"r" long:"region" description:"AWS Region"`
 	AccessKeyID     string `short:"i" long:"access-key-id" description:"AWS Access Key ID"`
 	SecretAccessKey string `short:"s" long:"secret-access-key" description:"AWS Secret Access Key"`
+	RoleArn         string `long:"role-arn" description:"ARN of the IAM role to assume"`
 	QueueName       string `short:"q" long:"queue" required:"true" description:"The name of the queue name"`
 	Warn            int    `short:"w" long:"warning" default:"10" description:"warning if the number of queues is over"`
 	Crit            int    `short:"c" long:"critical" default:"100" description:"critical if the number of queues is over"`
+	WarnAge         int64  `long:"warning-age" description:"warning if the age of the oldest message is over (seconds)"`
+	CritAge         int64  `long:"critical-age" description:"critical if the age of the oldest message is over (seconds)"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 const sqsAttributeOfQueueSize = "ApproximateNumberOfMessages"
 
-func createService(region, awsAccessKeyID, awsSecretAccessKey string) (*sqs.SQS, error) {
-	sess, err := session.NewSession()
-	if err != nil {
-		return nil, err
-	}
-
-	config := aws.NewConfig()
+func createSession(region, awsAccessKeyID, awsSecretAccessKey, roleArn string) (*session.Session, *aws.Config, error) {
+	config := aws.NewConfig().WithHTTPClient(&http.Client{Transport: debuglog.Transport(nil)})
 	if awsAccessKeyID != "" && awsSecretAccessKey != "" {
 		config = config.WithCredentials(credentials.NewStaticCredentials(awsAccessKeyID, awsSecretAccessKey, ""))
 	}
 	if region != "" {
 		config = config.WithRegion(region)
 	}
-	return sqs.New(sess, config), nil
-}
-
-func getSqsQueueSize(region, awsAccessKeyID, awsSecretAccessKey, queueName string) (int, error) {
-	sqsClient, err := createService(region, awsAccessKeyID, awsSecretAccessKey)
+	sess, err := session.NewSession(config)
 	if err != nil {
-		return -1, err
+		return nil, nil, err
+	}
+
+	// The role is assumed with the credentials above.
+	if roleArn != "" {
+		return sess, aws.NewConfig().WithCredentials(stscreds.NewCredentials(sess, roleArn)), nil
 	}
+	return sess, aws.NewConfig(), nil
+}
 
+func getSqsQueueSize(sqsClient *sqs.SQS, queueName string) (int, error) {
 	// Get queue url
 	q, err := sqsClient.GetQueueUrl(&sqs.GetQueueUrlInput{
 		QueueName: aws.String(queueName),
@@ -84,28 +102,100 @@ func getSqsQueueSize(region, awsAccessKeyID, awsSecretAccessKey, queueName strin
 	return size, nil
 }
 
+// getOldestMessageAge returns the age of the oldest message in seconds.
+// SQS doesn't provide the age as a queue attribute, so it is taken from CloudWatch.
+// It returns nil if there are no datapoints in the last 15 minutes.
+func getOldestMessageAge(cwClient *cloudwatch.CloudWatch, queueName string) (*float64, error) {
+	now := time.Now()
+	out, err := cwClient.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/SQS"),
+		MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String("QueueName"), Value: aws.String(queueName)},
+		},
+		StartTime:  aws.Time(now.Add(-15 * time.Minute)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticMaximum)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latestDatapoint(out.Datapoints), nil
+}
+
+func latestDatapoint(datapoints []*cloudwatch.Datapoint) *float64 {
+	var latest *cloudwatch.Datapoint
+	for _, dp := range datapoints {
+		if dp.Timestamp == nil || dp.Maximum == nil {
+			continue
+		}
+		if latest == nil || dp.Timestamp.After(*latest.Timestamp) {
+			latest = dp
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return latest.Maximum
+}
+
+func (opts *sqsOpts) checkSize(size int) (checkers.Status, string) {
+	if opts.Crit < size {
+		return checkers.CRITICAL, fmt.Sprintf("size %d > %d in %s", size, opts.Crit, opts.QueueName)
+	} else if opts.Warn < size {
+		return checkers.WARNING, fmt.Sprintf("size %d > %d in %s", size, opts.Warn, opts.QueueName)
+	}
+	return checkers.OK, fmt.Sprintf("size %d < warning %d, critical %d in %s", size, opts.Warn, opts.Crit, opts.QueueName)
+}
+
+func (opts *sqsOpts) checkAge(age *float64) (checkers.Status, string) {
+	if age == nil {
+		return checkers.OK, "age of the oldest message is unknown"
+	}
+	if opts.CritAge > 0 && *age > float64(opts.CritAge) {
+		return checkers.CRITICAL, fmt.Sprintf("age of the oldest message %.0fs > %ds", *age, opts.CritAge)
+	} else if opts.WarnAge > 0 && *age > float64(opts.WarnAge) {
+		return checkers.WARNING, fmt.Sprintf("age of the oldest message %.0fs > %ds", *age, opts.WarnAge)
+	}
+	return checkers.OK, fmt.Sprintf("age of the oldest message %.0fs", *age)
+}
+
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &sqsOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.SecretAccessKey, err = secret.Resolve(opts.SecretAccessKey); err != nil {
+		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
 	}
 
-	size, err := getSqsQueueSize(opts.Region, opts.AccessKeyID, opts.SecretAccessKey, opts.QueueName)
+	sess, config, err := createSession(opts.Region, opts.AccessKeyID, opts.SecretAccessKey, opts.RoleArn)
 	if err != nil {
 		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
 	}
+	if opts.SelfTest {
+		return selftest.Run(func() error { return awsutil.CheckConfig(sess.Config.Copy(config)) })
+	}
 
-	var chkSt checkers.Status
-	var msg string
-	if opts.Crit < size {
-		msg = fmt.Sprintf("size %d > %d in %s", size, opts.Crit, opts.QueueName)
-		chkSt = checkers.CRITICAL
-	} else if opts.Warn < size {
-		msg = fmt.Sprintf("size %d > %d in %s", size, opts.Warn, opts.QueueName)
-		chkSt = checkers.WARNING
-	} else {
-		msg = fmt.Sprintf("size %d < warning %d, critical %d in %s", size, opts.Warn, opts.Crit, opts.QueueName)
-		chkSt = checkers.OK
+	size, err := getSqsQueueSize(sqs.New(sess, config), opts.QueueName)
+	if err != nil {
+		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
+	}
+	chkSt, msg := opts.checkSize(size)
+
+	if opts.WarnAge > 0 || opts.CritAge > 0 {
+		age, err := getOldestMessageAge(cloudwatch.New(sess, config), opts.QueueName)
+		if err != nil {
+			return checkers.NewChecker(checkers.UNKNOWN, err.Error())
+		}
+		ageSt, ageMsg := opts.checkAge(age)
+		if ageSt > chkSt {
+			chkSt = ageSt
+		}
+		msg = strings.Join([]string{msg, ageMsg}, ", ")
 	}
 
 	return checkers.NewChecker(chkSt, msg)
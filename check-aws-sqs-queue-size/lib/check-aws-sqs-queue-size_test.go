@@ -0,0 +1,36 @@
+package checkawssqsqueuesize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestDatapoint(t *testing.T) {
+	now := time.Now()
+	assert.Nil(t, latestDatapoint(nil))
+
+	v := latestDatapoint([]*cloudwatch.Datapoint{
+		{Timestamp: aws.Time(now.Add(-2 * time.Minute)), Maximum: aws.Float64(300)},
+		{Timestamp: aws.Time(now.Add(-1 * time.Minute)), Maximum: aws.Float64(360)},
+		{Timestamp: aws.Time(now.Add(-3 * time.Minute)), Maximum: aws.Float64(240)},
+	})
+	assert.Equal(t, 360.0, *v)
+}
+
+func TestCheckAge(t *testing.T) {
+	opts := &sqsOpts{WarnAge: 300, CritAge: 600}
+
+	st, _ := opts.checkAge(nil)
+	assert.Equal(t, checkers.OK, st)
+	st, _ = opts.checkAge(aws.Float64(100))
+	assert.Equal(t, checkers.OK, st)
+	st, _ = opts.checkAge(aws.Float64(301))
+	assert.Equal(t, checkers.WARNING, st)
+	st, _ = opts.checkAge(aws.Float64(601))
+	assert.Equal(t, checkers.CRITICAL, st)
+}
@@ -6,52 +6,199 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type certOpts struct {
-	CertFile string `short:"f" long:"file" required:"true" description:"cert file name"`
-	Crit     int64  `short:"c" long:"critical" default:"14" description:"The critical threshold in days before expiry"`
-	Warn     int64  `short:"w" long:"warning" default:"30" description:"The threshold in days before expiry"`
+	CertFile string   `short:"f" long:"file" description:"cert file name"`
+	Dir      string   `short:"d" long:"dir" description:"check all certificates in PEM files under the directory (e.g. /etc/ssl/private)"`
+	Excludes []string `short:"x" long:"exclude" value-name:"REGEXP" description:"exclude files whose path matches the pattern in --dir mode (may be repeated)"`
+	Crit     int64    `short:"c" long:"critical" default:"14" description:"The critical threshold in days before expiry"`
+	Warn     int64    `short:"w" long:"warning" default:"30" description:"The threshold in days before expiry"`
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := checkCertExpiration()
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := checkCertExpiration(args)
 	ckr.Name = "CERT Expiry"
-	ckr.Exit()
+	return ckr
 }
 
-func checkCertExpiration() *checkers.Checker {
+func checkCertExpiration(args []string) *checkers.Checker {
 	opts := certOpts{}
 	psr := flags.NewParser(&opts, flags.Default)
-	_, err := psr.Parse()
+	_, err := psr.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	switch {
+	case opts.CertFile != "" && opts.Dir != "":
+		return checkers.Unknown("--file and --dir can't be specified at the same time")
+	case opts.CertFile == "" && opts.Dir == "":
+		return checkers.Unknown("either --file or --dir is required")
+	}
+	if opts.SelfTest {
+		if opts.Dir != "" {
+			return selftest.Run(selftest.Exists(opts.Dir))
+		}
+		return selftest.Run(selftest.Readable(opts.CertFile))
+	}
+	if opts.Dir != "" {
+		return checkDir(opts, time.Now().UTC())
+	}
+	return checkFile(opts, time.Now().UTC())
+}
+
+func daysRemaining(crt *x509.Certificate, now time.Time) int64 {
+	return int64(crt.NotAfter.Sub(now).Hours() / 24)
+}
+
+func (opts certOpts) status(days int64) checkers.Status {
+	if days < opts.Crit {
+		return checkers.CRITICAL
+	} else if days < opts.Warn {
+		return checkers.WARNING
 	}
+	return checkers.OK
+}
 
+func checkFile(opts certOpts, now time.Time) *checkers.Checker {
 	cfByte, err := ioutil.ReadFile(opts.CertFile)
 	if err != nil {
 		return checkers.Critical(err.Error())
 	}
-	cfBlock, _ := pem.Decode(cfByte)
-	cfCrt, err := x509.ParseCertificate(cfBlock.Bytes)
-
+	cfCrts, err := parsePEMCertificates(cfByte)
 	if err != nil {
 		return checkers.Critical(err.Error())
 	}
+	if len(cfCrts) == 0 {
+		return checkers.Critical(fmt.Sprintf("no certificate found in %s", opts.CertFile))
+	}
 
-	cfDaysRemaining := int64(cfCrt.NotAfter.Sub(time.Now().UTC()).Hours() / 24)
-	checkSt := checkers.OK
+	cfDaysRemaining := daysRemaining(cfCrts[0], now)
 	msg := fmt.Sprintf("%d days remaining", cfDaysRemaining)
+	return checkers.NewChecker(opts.status(cfDaysRemaining), msg)
+}
 
-	if cfDaysRemaining < opts.Crit {
+type dirCert struct {
+	path string
+	name string
+	days int64
+}
+
+// parsePEMCertificates returns the certificates in all CERTIFICATE blocks in data.
+// Other blocks such as private keys are ignored.
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var crts []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return crts, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crts = append(crts, crt)
+	}
+}
+
+func checkDir(opts certOpts, now time.Time) *checkers.Checker {
+	excludes := make([]*regexp.Regexp, 0, len(opts.Excludes))
+	for _, s := range opts.Excludes {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		excludes = append(excludes, re)
+	}
+
+	var (
+		certs  []dirCert
+		errMsg []string
+	)
+	err := filepath.Walk(opts.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == opts.Dir {
+				return err
+			}
+			errMsg = append(errMsg, err.Error())
+			return nil
+		}
+		for _, re := range excludes {
+			if re.MatchString(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			errMsg = append(errMsg, err.Error())
+			return nil
+		}
+		crts, err := parsePEMCertificates(data)
+		if err != nil {
+			errMsg = append(errMsg, fmt.Sprintf("%s: %s", path, err))
+			return nil
+		}
+		for _, crt := range crts {
+			certs = append(certs, dirCert{path: path, name: crt.Subject.CommonName, days: daysRemaining(crt, now)})
+		}
+		return nil
+	})
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	if len(certs) == 0 && len(errMsg) == 0 {
+		return checkers.Critical("no certificates found in " + opts.Dir)
+	}
+
+	sort.SliceStable(certs, func(i, j int) bool { return certs[i].days < certs[j].days })
+	checkSt := checkers.OK
+	var expiring []string
+	for _, c := range certs {
+		st := opts.status(c.days)
+		if st == checkers.OK {
+			continue
+		}
+		if st > checkSt {
+			checkSt = st
+		}
+		expiring = append(expiring, fmt.Sprintf("%s (%s) %d days remaining", c.path, c.name, c.days))
+	}
+	if len(errMsg) > 0 {
 		checkSt = checkers.CRITICAL
-	} else if cfDaysRemaining < opts.Warn {
-		checkSt = checkers.WARNING
 	}
-	return checkers.NewChecker(checkSt, msg)
+
+	msg := fmt.Sprintf("%d certificates checked", len(certs))
+	if len(certs) > 0 && len(expiring) == 0 {
+		msg += fmt.Sprintf(", %d days remaining at least", certs[0].days)
+	}
+	lines := append([]string{msg}, expiring...)
+	lines = append(lines, errMsg...)
+	return checkers.NewChecker(checkSt, strings.Join(lines, "\n"))
 }
@@ -0,0 +1,100 @@
+package checkcertfile
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func writeCert(t *testing.T, path, cn string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...,
+	)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-cert-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCert(t, filepath.Join(dir, "a.pem"), "a.example.com", now.Add(100*24*time.Hour))
+	writeCert(t, filepath.Join(dir, "sub", "b.pem"), "b.example.com", now.Add(20*24*time.Hour))
+	writeCert(t, filepath.Join(dir, "old", "c.pem"), "c.example.com", now.Add(-24*time.Hour))
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := certOpts{Dir: dir, Warn: 30, Crit: 14}
+	ckr := checkDir(opts, now)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+	assert.Contains(t, ckr.Message, "3 certificates checked")
+	assert.Contains(t, ckr.Message, "c.example.com")
+
+	opts.Excludes = []string{"/old$"}
+	ckr = checkDir(opts, now)
+	assert.Equal(t, checkers.WARNING, ckr.Status, ckr.Message)
+	assert.Contains(t, ckr.Message, "2 certificates checked")
+	assert.Contains(t, ckr.Message, "b.example.com")
+
+	opts.Excludes = []string{"/old$", `/sub/`}
+	ckr = checkDir(opts, now)
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+
+	opts.Dir = filepath.Join(dir, "none")
+	ckr = checkDir(opts, now)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+}
+
+func TestCheckFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-cert-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cert.pem")
+	writeCert(t, path, "example.com", now.Add(20*24*time.Hour))
+	ckr := checkFile(certOpts{CertFile: path, Warn: 30, Crit: 14}, now)
+	assert.Equal(t, checkers.WARNING, ckr.Status, ckr.Message)
+}
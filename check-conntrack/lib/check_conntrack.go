@@ -0,0 +1,116 @@
+package checkconntrack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type conntrackOpts struct {
+	Warning  float64 `short:"w" long:"warning" value-name:"PERCENT" default:"75" description:"warning if the usage of the connection tracking table is over"`
+	Critical float64 `short:"c" long:"critical" value-name:"PERCENT" default:"90" description:"critical if the usage of the connection tracking table is over"`
+	Perfdata bool    `long:"perfdata" description:"Append the usage and the number of the entries as performance data"`
+	selftest.SelfTestOpts
+}
+
+// procSysNet is replaced in tests.
+var procSysNet = "/proc/sys/net"
+
+// conntrackFiles are the pairs of the count and the max of the entries, of nf_conntrack
+// and of ip_conntrack of the kernels before 2.6.15.
+var conntrackFiles = [][2]string{
+	{"netfilter/nf_conntrack_count", "netfilter/nf_conntrack_max"},
+	{"ipv4/netfilter/ip_conntrack_count", "ipv4/netfilter/ip_conntrack_max"},
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Conntrack"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := conntrackOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Exists(procSysNet))
+	}
+
+	count, max, err := readConntrack()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(count, max)
+}
+
+// readConntrack returns the number of the entries in the connection tracking table and the max of them.
+func readConntrack() (count, max int64, err error) {
+	for _, files := range conntrackFiles {
+		count, err = readInt(filepath.Join(procSysNet, files[0]))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		max, err = readInt(filepath.Join(procSysNet, files[1]))
+		if err != nil {
+			return 0, 0, err
+		}
+		return count, max, nil
+	}
+	return 0, 0, fmt.Errorf("connection tracking is not enabled; nf_conntrack module is not loaded")
+}
+
+func readInt(file string) (int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+	return n, nil
+}
+
+func (opts *conntrackOpts) evaluate(count, max int64) *checkers.Checker {
+	if max <= 0 {
+		return checkers.Unknown(fmt.Sprintf("invalid nf_conntrack_max: %d", max))
+	}
+	usage := float64(count) / float64(max) * 100
+	checkSt := checkers.OK
+	msg := fmt.Sprintf("%d/%d entries (%.1f%%)", count, max, usage)
+	switch {
+	case usage > opts.Critical:
+		checkSt = checkers.CRITICAL
+		msg += fmt.Sprintf(" > %g%%", opts.Critical)
+	case usage > opts.Warning:
+		checkSt = checkers.WARNING
+		msg += fmt.Sprintf(" > %g%%", opts.Warning)
+	}
+	if opts.Perfdata {
+		msg += " | " + strings.Join([]string{
+			perfdata.FormatMinMax("usage", fmt.Sprintf("%.1f", usage), "%", perfdata.OptFloat(&opts.Warning), perfdata.OptFloat(&opts.Critical), "0", "100"),
+			perfdata.FormatMinMax("entries", strconv.FormatInt(count, 10), "", "", "", "0", strconv.FormatInt(max, 10)),
+		}, " ")
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
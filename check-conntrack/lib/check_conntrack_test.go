@@ -0,0 +1,82 @@
+package checkconntrack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		opts  conntrackOpts
+		count int64
+		max   int64
+		want  checkers.Status
+		msg   string
+	}{
+		{
+			opts:  conntrackOpts{Warning: 75, Critical: 90},
+			count: 12345, max: 262144,
+			want: checkers.OK,
+			msg:  "12345/262144 entries (4.7%)",
+		},
+		{
+			opts:  conntrackOpts{Warning: 75, Critical: 90},
+			count: 200000, max: 262144,
+			want: checkers.WARNING,
+			msg:  "200000/262144 entries (76.3%) > 75%",
+		},
+		{
+			opts:  conntrackOpts{Warning: 75, Critical: 90, Perfdata: true},
+			count: 262144, max: 262144,
+			want: checkers.CRITICAL,
+			msg:  "262144/262144 entries (100.0%) > 90% | usage=100.0%;75;90;0;100 entries=262144;;;0;262144",
+		},
+		{
+			opts:  conntrackOpts{Warning: 75, Critical: 90},
+			count: 0, max: 0,
+			want: checkers.UNKNOWN,
+			msg:  "invalid nf_conntrack_max: 0",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(tt.count, tt.max)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestReadConntrack(t *testing.T) {
+	dir := t.TempDir()
+	orig := procSysNet
+	procSysNet = dir
+	defer func() { procSysNet = orig }()
+
+	_, _, err := readConntrack()
+	assert.Equal(t, "connection tracking is not enabled; nf_conntrack module is not loaded", err.Error())
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ipv4/netfilter/ip_conntrack_count", "10\n")
+	write("ipv4/netfilter/ip_conntrack_max", "65536\n")
+	count, max, err := readConntrack()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), count)
+	assert.Equal(t, int64(65536), max)
+
+	write("netfilter/nf_conntrack_count", "12345\n")
+	write("netfilter/nf_conntrack_max", "262144\n")
+	ckr := run([]string{"-w", "1", "-c", "10"})
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Equal(t, "12345/262144 entries (4.7%) > 1%", ckr.Message)
+}
@@ -7,23 +7,33 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 	gpud "github.com/shirou/gopsutil/v3/disk"
 )
 
-var opts struct {
-	Warning       *string   `short:"w" long:"warning" value-name:"N, N%" description:"Exit with WARNING status if less than N units or N% of disk are free"`
-	Critical      *string   `short:"c" long:"critical" value-name:"N, N%" description:"Exit with CRITICAL status if less than N units or N% of disk are free"`
-	InodeWarning  *string   `short:"W" long:"iwarning" value-name:"N%" description:"Exit with WARNING status if less than PERCENT of inode space is free"`
-	InodeCritical *string   `short:"K" long:"icritical" value-name:"N%" description:"Exit with CRITICAL status if less than PERCENT of inode space is free"`
-	Path          *[]string `short:"p" long:"path" value-name:"PATH" description:"Mount point or block device as emitted by the mount(8) command (may be repeated)"`
-	Exclude       *[]string `short:"x" long:"exclude-device" value-name:"EXCLUDE PATH" description:"Ignore device (may be repeated; only works if -p unspecified)"`
-	All           bool      `short:"A" long:"all" description:"Explicitly select all paths."`
-	ExcludeType   *[]string `short:"X" long:"exclude-type" value-name:"TYPE" description:"Ignore all filesystems of indicated type (may be repeated)"`
-	IncludeType   *[]string `short:"N" long:"include-type" value-name:"TYPE" description:"Check only filesystems of indicated type (may be repeated)"`
-	Units         *string   `short:"u" long:"units" value-name:"STRING" description:"Choose bytes, kB, MB, GB, TB (default: MB)"`
+type diskOpts struct {
+	Warning       *string       `short:"w" long:"warning" value-name:"N, N%" description:"Exit with WARNING status if less than N units or N% of disk are free"`
+	Critical      *string       `short:"c" long:"critical" value-name:"N, N%" description:"Exit with CRITICAL status if less than N units or N% of disk are free"`
+	InodeWarning  *string       `short:"W" long:"iwarning" value-name:"N%" description:"Exit with WARNING status if less than PERCENT of inode space is free"`
+	InodeCritical *string       `short:"K" long:"icritical" value-name:"N%" description:"Exit with CRITICAL status if less than PERCENT of inode space is free"`
+	Path          *[]string     `short:"p" long:"path" value-name:"PATH" description:"Mount point or block device as emitted by the mount(8) command (may be repeated)"`
+	Exclude       *[]string     `short:"x" long:"exclude-device" value-name:"EXCLUDE PATH" description:"Ignore device (may be repeated; only works if -p unspecified)"`
+	All           bool          `short:"A" long:"all" description:"Explicitly select all paths."`
+	ExcludeType   *[]string     `short:"X" long:"exclude-type" value-name:"TYPE" description:"Ignore all filesystems of indicated type (may be repeated)"`
+	IncludeType   *[]string     `short:"N" long:"include-type" value-name:"TYPE" description:"Check only filesystems of indicated type (may be repeated)"`
+	Units         *string       `short:"u" long:"units" value-name:"STRING" description:"Choose bytes, kB, MB, GB, TB (default: MB)"`
+	WarningHours  *float64      `long:"warning-hours" value-name:"HOURS" description:"Exit with WARNING status if the disk is predicted to be full within HOURS"`
+	CriticalHours *float64      `long:"critical-hours" value-name:"HOURS" description:"Exit with CRITICAL status if the disk is predicted to be full within HOURS"`
+	PredictWindow float64       `long:"prediction-window" value-name:"HOURS" default:"24" description:"Predict by the growth rate of the usage in the last HOURS"`
+	StateDir      string        `long:"state-dir" value-name:"DIR" description:"Dir to keep the usage samples under for the prediction"`
+	DetectStale   bool          `long:"detect-stale-nfs" description:"Exit with CRITICAL status if any NFS or CIFS mount doesn't respond, instead of hanging"`
+	StaleTimeout  time.Duration `long:"stale-timeout" value-name:"DURATION" default:"5s" description:"Timeout to regard NFS and CIFS mounts as hung with --detect-stale-nfs"`
+	DetectErrors  bool          `long:"detect-fs-errors" description:"Exit with CRITICAL status if any filesystem has been remounted read-only or recorded new ext4 errors since the last run"`
+	selftest.SelfTestOpts
 }
 
 const (
@@ -104,15 +114,21 @@ func genMessage(disk *gpud.UsageStat, u unit) string {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Disk"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &diskOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
 	partitions, err := listPartitions()
@@ -154,19 +170,6 @@ func run(args []string) *checkers.Checker {
 		return checkers.Unknown(fmt.Sprintf("Failed to fetch partitions: %s", errors.New("No device found")))
 	}
 
-	var disks []*gpud.UsageStat
-
-	for _, partition := range partitions {
-		disk, err := gpud.Usage(partition.Mountpoint)
-		if err != nil {
-			return checkers.Unknown(fmt.Sprintf("Failed to fetch disk usage: %s", err))
-		}
-
-		if disk.Total != 0 {
-			disks = append(disks, disk)
-		}
-	}
-
 	u := unit{"MB", mb}
 	if opts.Units != nil {
 		us := strings.ToLower(*opts.Units)
@@ -183,6 +186,16 @@ func run(args []string) *checkers.Checker {
 		}
 	}
 
+	// the usages are not fetched, which may hang on a stale NFS mount
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	disks, stale, err := fetchUsages(partitions, opts.DetectStale, opts.StaleTimeout)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Failed to fetch disk usage: %s", err))
+	}
+
 	checkSt := checkers.OK
 	if opts.InodeCritical != nil {
 		for _, disk := range disks {
@@ -236,12 +249,45 @@ func run(args []string) *checkers.Checker {
 		}
 	}
 
+	var ttfs map[string]time.Duration
+	if opts.WarningHours != nil || opts.CriticalHours != nil {
+		ttfs, err = opts.predict(disks, time.Now())
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to predict disk usage: %s", err))
+		}
+		for _, ttf := range ttfs {
+			if opts.CriticalHours != nil && ttf.Hours() < *opts.CriticalHours {
+				checkSt = checkers.CRITICAL
+			} else if checkSt == checkers.OK && opts.WarningHours != nil && ttf.Hours() < *opts.WarningHours {
+				checkSt = checkers.WARNING
+			}
+		}
+	}
+
+	var problems []string
+	if opts.DetectErrors {
+		problems, err = opts.checkHealth(partitions)
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to check filesystem errors: %s", err))
+		}
+		if len(problems) > 0 {
+			checkSt = checkers.CRITICAL
+		}
+	}
+
 	sortDisks(disks)
 
-	var msgs []string
+	msgs := problems
+	for _, m := range stale {
+		checkSt = checkers.CRITICAL
+		msgs = append(msgs, fmt.Sprintf("Path: %v, Stale: %s", m.path, m.err))
+	}
 
 	for _, disk := range disks {
 		msg := genMessage(disk, u)
+		if ttf, ok := ttfs[disk.Path]; ok {
+			msg += fmt.Sprintf(", Time to full: %.1f hours", ttf.Hours())
+		}
 		msgs = append(msgs, msg)
 	}
 	msgss := strings.Join(msgs, ";\n")
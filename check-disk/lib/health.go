@@ -0,0 +1,114 @@
+package checkdisk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	gpud "github.com/shirou/gopsutil/v3/disk"
+)
+
+// fsHealth is the health of a mounted filesystem recorded at every run.
+type fsHealth struct {
+	Device    string `json:"device"`
+	ReadOnly  bool   `json:"read_only"`
+	Remounted bool   `json:"remounted"` // remounted read-only since it was found writable
+	Errors    int64  `json:"errors"`    // -1 if the filesystem doesn't count errors
+}
+
+// sysfsExt4 is replaced in tests.
+var sysfsExt4 = "/sys/fs/ext4"
+
+// checkHealth records the health of the partitions, and returns the problems found since the last run.
+func (opts *diskOpts) checkHealth(partitions []gpud.PartitionStat) ([]string, error) {
+	file := filepath.Join(state.Dir(opts.StateDir, "check-disk"), "health.json")
+	var prev map[string]fsHealth
+	if _, err := state.Load(file, &prev); err != nil {
+		return nil, err
+	}
+	cur := make(map[string]fsHealth)
+	for _, p := range partitions {
+		cur[p.Mountpoint] = fsHealth{
+			Device:   p.Device,
+			ReadOnly: isReadOnly(p.Opts),
+			Errors:   ext4Errors(p),
+		}
+	}
+	msgs := compareHealth(prev, cur)
+	// keep the partitions of other runs, which may be checked with other -p and -x
+	for path, h := range prev {
+		if _, ok := cur[path]; !ok {
+			cur[path] = h
+		}
+	}
+	if err := state.Save(file, cur); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func isReadOnly(mountOpts []string) bool {
+	for _, opt := range mountOpts {
+		if opt == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// ext4Errors returns errors_count of the ext4 filesystem in sysfs, which is the number of the errors recorded
+// in the superblock. The ext2 and ext3 filesystems are also counted if they are mounted by the ext4 driver.
+func ext4Errors(p gpud.PartitionStat) int64 {
+	switch p.Fstype {
+	case "ext2", "ext3", "ext4":
+	default:
+		return -1
+	}
+	// the directory is named after the kernel name of the device, such as dm-0 for /dev/mapper/vg-root.
+	dev, err := filepath.EvalSymlinks(p.Device)
+	if err != nil {
+		dev = p.Device
+	}
+	b, err := ioutil.ReadFile(filepath.Join(sysfsExt4, filepath.Base(dev), "errors_count"))
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// compareHealth returns the filesystems which have been remounted read-only or recorded new errors,
+// and marks the remounted ones in cur, so that they are reported until they get writable again.
+// The filesystems not found in the last run, or mounted from another device since then, are not compared.
+func compareHealth(prev, cur map[string]fsHealth) []string {
+	paths := make([]string, 0, len(cur))
+	for path := range cur {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var msgs []string
+	for _, path := range paths {
+		c := cur[path]
+		p, ok := prev[path]
+		if !ok || p.Device != c.Device {
+			continue
+		}
+		if c.ReadOnly && (!p.ReadOnly || p.Remounted) {
+			c.Remounted = true
+			cur[path] = c
+			msgs = append(msgs, fmt.Sprintf("Path: %v, Remounted read-only", path))
+		}
+		if p.Errors >= 0 && c.Errors > p.Errors {
+			msgs = append(msgs, fmt.Sprintf("Path: %v, Errors: %d new (%d in total)", path, c.Errors-p.Errors, c.Errors))
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,98 @@
+package checkdisk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gpud "github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareHealth(t *testing.T) {
+	prev := map[string]fsHealth{
+		"/":     {Device: "/dev/sda1", Errors: 0},
+		"/data": {Device: "/dev/sdb1", Errors: 2},
+		"/xfs":  {Device: "/dev/sdc1", Errors: -1},
+		"/usb":  {Device: "/dev/sdd1", Errors: 5},
+		"/ro":   {Device: "/dev/sde1", ReadOnly: true, Errors: -1},
+		"/rw":   {Device: "/dev/sdh1", ReadOnly: true, Remounted: true, Errors: -1},
+	}
+	cur := map[string]fsHealth{
+		"/":     {Device: "/dev/sda1", Errors: 0},
+		"/data": {Device: "/dev/sdb1", ReadOnly: true, Errors: 5},
+		"/xfs":  {Device: "/dev/sdc1", ReadOnly: true, Errors: -1},
+		"/usb":  {Device: "/dev/sdf1", Errors: 9},
+		"/ro":   {Device: "/dev/sde1", ReadOnly: true, Errors: -1},
+		"/new":  {Device: "/dev/sdg1", ReadOnly: true, Errors: 3},
+		"/rw":   {Device: "/dev/sdh1", Errors: -1},
+	}
+	assert.Equal(t, []string{
+		"Path: /data, Remounted read-only",
+		"Path: /data, Errors: 3 new (5 in total)",
+		"Path: /xfs, Remounted read-only",
+	}, compareHealth(prev, cur))
+	assert.True(t, cur["/data"].Remounted)
+	assert.False(t, cur["/ro"].Remounted, "the filesystem mounted read-only from the first should not be reported")
+	assert.False(t, cur["/rw"].Remounted, "the filesystem writable again should not be reported")
+	assert.Empty(t, compareHealth(nil, cur))
+}
+
+func TestCheckHealth(t *testing.T) {
+	dir := t.TempDir()
+	opts := &diskOpts{StateDir: dir}
+	sysfsExt4 = filepath.Join(dir, "ext4")
+	defer func() {
+		sysfsExt4 = "/sys/fs/ext4"
+	}()
+	if err := os.MkdirAll(filepath.Join(sysfsExt4, "sda1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setErrors := func(n string) {
+		if err := ioutil.WriteFile(filepath.Join(sysfsExt4, "sda1", "errors_count"), []byte(n+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	partitions := []gpud.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4", Opts: []string{"rw", "relatime"}},
+		{Device: "/dev/sdb1", Mountpoint: "/data", Fstype: "xfs", Opts: []string{"rw"}},
+	}
+	setErrors("1")
+	problems, err := opts.checkHealth(partitions)
+	assert.NoError(t, err)
+	assert.Empty(t, problems, "the first run should only record the health")
+
+	setErrors("1")
+	problems, err = opts.checkHealth(partitions)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	setErrors("2")
+	partitions[1].Opts = []string{"ro"}
+	problems, err = opts.checkHealth(partitions)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"Path: /, Errors: 1 new (2 in total)",
+		"Path: /data, Remounted read-only",
+	}, problems)
+
+	problems, err = opts.checkHealth(partitions)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Path: /data, Remounted read-only"}, problems, "the remount should be reported until it gets writable again")
+
+	partitions[1].Opts = []string{"rw"}
+	problems, err = opts.checkHealth(partitions)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// another run with other partitions doesn't erase the health of the others
+	problems, err = opts.checkHealth(partitions[1:])
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+	setErrors("3")
+	problems, err = opts.checkHealth(partitions[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Path: /, Errors: 1 new (3 in total)"}, problems)
+}
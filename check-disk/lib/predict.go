@@ -0,0 +1,87 @@
+package checkdisk
+
+import (
+	"math"
+	"path/filepath"
+	"time"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	gpud "github.com/shirou/gopsutil/v3/disk"
+)
+
+// predict records the usage of the disks and returns the estimated time until each disk is full.
+// The disks whose usage is not growing are not included.
+func (opts *diskOpts) predict(disks []*gpud.UsageStat, now time.Time) (map[string]time.Duration, error) {
+	file := filepath.Join(state.Dir(opts.StateDir, "check-disk"), "samples.json")
+	s := samples{}
+	if _, err := state.Load(file, &s); err != nil {
+		return nil, err
+	}
+	window := time.Duration(opts.PredictWindow * float64(time.Hour))
+	ttfs := make(map[string]time.Duration)
+	for _, disk := range disks {
+		s.add(disk.Path, now, disk.Used, window)
+		if ttf, ok := timeToFull(s[disk.Path], disk.Free); ok {
+			ttfs[disk.Path] = ttf
+		}
+	}
+	if err := state.Save(file, s); err != nil {
+		return nil, err
+	}
+	return ttfs, nil
+}
+
+// sample is the used bytes of a disk at a time.
+type sample struct {
+	Time int64  `json:"time"`
+	Used uint64 `json:"used"`
+}
+
+// samples are the usage samples of disks keyed by the path.
+type samples map[string][]sample
+
+// add appends the sample of the path, and drops the samples older than the window.
+func (s samples) add(path string, now time.Time, used uint64, window time.Duration) {
+	since := now.Add(-window).Unix()
+	kept := []sample{}
+	for _, v := range s[path] {
+		if v.Time >= since && v.Time < now.Unix() {
+			kept = append(kept, v)
+		}
+	}
+	s[path] = append(kept, sample{Time: now.Unix(), Used: used})
+}
+
+// timeToFull estimates the time until the disk with free bytes is full
+// by the growth rate of the samples with least squares.
+// It returns false if the usage is not growing or the samples are not enough.
+func timeToFull(ss []sample, free uint64) (time.Duration, bool) {
+	if len(ss) < 2 {
+		return 0, false
+	}
+	var sumT, sumU float64
+	for _, v := range ss {
+		sumT += float64(v.Time - ss[0].Time)
+		sumU += float64(v.Used)
+	}
+	n := float64(len(ss))
+	meanT, meanU := sumT/n, sumU/n
+	var cov, varT float64
+	for _, v := range ss {
+		dt := float64(v.Time-ss[0].Time) - meanT
+		cov += dt * (float64(v.Used) - meanU)
+		varT += dt * dt
+	}
+	if varT == 0 {
+		return 0, false
+	}
+	rate := cov / varT // bytes per second
+	if rate <= 0 {
+		return 0, false
+	}
+	secs := float64(free) / rate
+	if secs > math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
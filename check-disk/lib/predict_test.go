@@ -0,0 +1,70 @@
+package checkdisk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeToFull(t *testing.T) {
+	gb := uint64(1 << 30)
+	hourly := func(used ...uint64) []sample {
+		var ss []sample
+		for i, u := range used {
+			ss = append(ss, sample{Time: int64(i * 3600), Used: u})
+		}
+		return ss
+	}
+
+	tests := []struct {
+		name    string
+		samples []sample
+		free    uint64
+		want    time.Duration
+		ok      bool
+	}{
+		{name: "growing 1GB per hour", samples: hourly(10*gb, 11*gb, 12*gb), free: 5 * gb, want: 5 * time.Hour, ok: true},
+		{name: "not growing", samples: hourly(10*gb, 10*gb, 10*gb), free: 5 * gb},
+		{name: "shrinking", samples: hourly(12*gb, 11*gb, 10*gb), free: 5 * gb},
+		{name: "single sample", samples: hourly(10 * gb), free: 5 * gb},
+	}
+	for _, tt := range tests {
+		got, ok := timeToFull(tt.samples, tt.free)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		if tt.ok {
+			assert.InDelta(t, tt.want.Hours(), got.Hours(), 0.01, tt.name)
+		}
+	}
+}
+
+func TestSamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "state", "samples.json")
+
+	s := samples{}
+	found, err := state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Empty(t, s)
+
+	now := time.Unix(1600000000, 0)
+	s.add("/", now.Add(-3*time.Hour), 100, 2*time.Hour)
+	s.add("/", now.Add(-time.Hour), 200, 2*time.Hour)
+	s.add("/", now, 300, 2*time.Hour)
+	assert.Equal(t, []sample{{Time: now.Add(-time.Hour).Unix(), Used: 200}, {Time: now.Unix(), Used: 300}}, s["/"])
+
+	assert.Nil(t, state.Save(file, s))
+	loaded := samples{}
+	_, err = state.Load(file, &loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, s, loaded)
+}
@@ -0,0 +1,86 @@
+package checkdisk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gpud "github.com/shirou/gopsutil/v3/disk"
+)
+
+// networkFstypes are the types of the network filesystems, whose statfs blocks while the server doesn't respond.
+var networkFstypes = map[string]bool{
+	"nfs":   true,
+	"nfs4":  true,
+	"cifs":  true,
+	"smb3":  true,
+	"smbfs": true,
+}
+
+// usage is replaced in tests.
+var usage = gpud.Usage
+
+// staleMount is a network mount whose usage couldn't be fetched.
+type staleMount struct {
+	path string
+	err  error
+}
+
+// fetchUsages fetches the usage of the partitions. If detectStale is true, the network mounts are stat'ed
+// concurrently, and those which don't respond within the timeout or fail are returned as stale instead of an error.
+//
+// A statfs on a hung mount can't be canceled, so the goroutine stays blocked until the server responds.
+// It sends the result to the buffered channel and exits even if nobody receives it any longer,
+// and the plugin exits without waiting for it.
+func fetchUsages(partitions []gpud.PartitionStat, detectStale bool, timeout time.Duration) ([]*gpud.UsageStat, []staleMount, error) {
+	type result struct {
+		disk *gpud.UsageStat
+		err  error
+	}
+	chs := make([]chan result, len(partitions))
+	for i, p := range partitions {
+		if !detectStale || !networkFstypes[p.Fstype] {
+			continue
+		}
+		ch := make(chan result, 1)
+		chs[i] = ch
+		go func(path string) {
+			disk, err := usage(path)
+			ch <- result{disk, err}
+		}(p.Mountpoint)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var disks []*gpud.UsageStat
+	var stale []staleMount
+	for i, p := range partitions {
+		if chs[i] == nil {
+			disk, err := usage(p.Mountpoint)
+			if err != nil {
+				return nil, nil, err
+			}
+			if disk.Total != 0 {
+				disks = append(disks, disk)
+			}
+			continue
+		}
+		var r result
+		select {
+		case r = <-chs[i]:
+		case <-ctx.Done():
+			// the results which have arrived by the timeout are preferred to it
+			select {
+			case r = <-chs[i]:
+			default:
+				r.err = fmt.Errorf("no response in %s", timeout)
+			}
+		}
+		if r.err != nil {
+			stale = append(stale, staleMount{p.Mountpoint, r.err})
+		} else if r.disk.Total != 0 {
+			disks = append(disks, r.disk)
+		}
+	}
+	return disks, stale, nil
+}
@@ -0,0 +1,61 @@
+package checkdisk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	gpud "github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchUsages(t *testing.T) {
+	hung := make(chan struct{})
+	orig := usage
+	usage = func(path string) (*gpud.UsageStat, error) {
+		switch path {
+		case "/mnt/hung", "/mnt/hung2":
+			<-hung
+		case "/mnt/stale":
+			return nil, errors.New("stale NFS file handle")
+		case "/broken":
+			return nil, errors.New("permission denied")
+		}
+		return &gpud.UsageStat{Path: path, Total: 100}, nil
+	}
+	defer func() {
+		close(hung)
+		usage = orig
+	}()
+
+	partitions := []gpud.PartitionStat{
+		{Mountpoint: "/", Fstype: "xfs"},
+		{Mountpoint: "/mnt/hung", Fstype: "nfs4"},
+		{Mountpoint: "/mnt/hung2", Fstype: "cifs"},
+		{Mountpoint: "/mnt/stale", Fstype: "nfs"},
+		{Mountpoint: "/mnt/ok", Fstype: "nfs"},
+	}
+	start := time.Now()
+	disks, stale, err := fetchUsages(partitions, true, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second, "the hung mounts should be waited for concurrently")
+	if assert.Len(t, disks, 2) {
+		assert.Equal(t, "/", disks[0].Path)
+		assert.Equal(t, "/mnt/ok", disks[1].Path)
+	}
+	var msgs []string
+	for _, m := range stale {
+		msgs = append(msgs, m.path+": "+m.err.Error())
+	}
+	assert.Equal(t, []string{
+		"/mnt/hung: no response in 100ms",
+		"/mnt/hung2: no response in 100ms",
+		"/mnt/stale: stale NFS file handle",
+	}, msgs)
+
+	_, _, err = fetchUsages(append(partitions[3:], gpud.PartitionStat{Mountpoint: "/broken", Fstype: "ext4"}), true, time.Second)
+	assert.EqualError(t, err, "permission denied")
+
+	_, _, err = fetchUsages(partitions[3:], false, time.Second)
+	assert.EqualError(t, err, "stale NFS file handle", "the network mounts should be stat'ed as usual without --detect-stale-nfs")
+}
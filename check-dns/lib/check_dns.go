@@ -0,0 +1,424 @@
+package checkdns
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/miekg/dns"
+)
+
+type dnsOpts struct {
+	Host          string   `short:"H" long:"host" required:"true" description:"Name to query"`
+	QueryType     string   `short:"q" long:"querytype" default:"A" description:"Type of the records to query, such as A, AAAA, CNAME, MX, NS, PTR, SOA, SRV and TXT"`
+	Nameservers   []string `short:"s" long:"nameserver" value-name:"HOST[:PORT]" description:"Resolver to query (can be specified multiple times, default: the first nameserver in /etc/resolv.conf)"`
+	ResolversFile string   `long:"resolvers-file" value-name:"FILE" description:"Query the resolvers listed in the file (HOST[:PORT] per line) too"`
+	Expect        []string `short:"e" long:"expect" value-name:"VALUE" description:"critical unless the answers are exactly the values (can be specified multiple times)"`
+	Warning       *float64 `short:"w" long:"warning" value-name:"SECONDS" description:"warning if any resolver takes longer than"`
+	Critical      *float64 `short:"c" long:"critical" value-name:"SECONDS" description:"critical if any resolver takes longer than"`
+	Timeout       float64  `short:"t" long:"timeout" default:"5" description:"Seconds before a query times out"`
+	ExpectTTLMin  *int64   `long:"expect-ttl-min" value-name:"SECONDS" description:"critical if the TTL of any record is less than"`
+	ExpectTTLMax  *int64   `long:"expect-ttl-max" value-name:"SECONDS" description:"critical if the TTL of any record is more than"`
+	NoWildcard    bool     `long:"no-wildcard" description:"critical unless a random label under the name is NXDOMAIN"`
+
+	DNSSECValidate bool     `long:"dnssec-validate" description:"Validate the chain of trust of the answers from the trust anchor"`
+	TrustAnchor    string   `long:"trust-anchor" value-name:"FILE" description:"File of the DS or DNSKEY records of the trust anchor in the zone file format (default: the root KSKs)"`
+	WarningExpiry  float64  `long:"warning-rrsig-expiry" value-name:"DAYS" default:"7" description:"warning if any RRSIG in the chain of trust expires within the days"`
+	CriticalExpiry *float64 `long:"critical-rrsig-expiry" value-name:"DAYS" description:"critical if any RRSIG in the chain of trust expires within the days"`
+	netutil.AddressFamilyOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// resolvConf is replaced in tests.
+var resolvConf = "/etc/resolv.conf"
+
+// answer is the result of the query to a resolver.
+type answer struct {
+	Server string
+	Rcode  int
+	Values []string // the data of the records of the type, sorted
+	MinTTL uint32
+	MaxTTL uint32
+	RTT    time.Duration
+	Err    error
+}
+
+// outcome returns the answer in the form to compare with the other resolvers.
+func (a *answer) outcome() string {
+	if a.Rcode != dns.RcodeSuccess {
+		return dns.RcodeToString[a.Rcode]
+	}
+	if len(a.Values) == 0 {
+		return "no records"
+	}
+	return strings.Join(a.Values, ", ")
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "DNS"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := dnsOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(opts.QueryType)]
+	if !ok {
+		return checkers.Unknown(fmt.Sprintf("unsupported query type: %s", opts.QueryType))
+	}
+	servers, err := opts.resolvers()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var anchors []*dns.DS
+	if opts.DNSSECValidate {
+		anchors, err = loadAnchors(opts.TrustAnchor)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	if opts.SelfTest {
+		checks := make([]selftest.Check, 0, len(servers))
+		for _, s := range servers {
+			checks = append(checks, selftest.Resolve(s))
+		}
+		return selftest.Run(checks...)
+	}
+	opts.DebugOpts.Enable()
+
+	name := opts.Host
+	if qtype == dns.TypePTR && net.ParseIP(name) != nil {
+		name, _ = dns.ReverseAddr(name)
+	}
+	name = dns.Fqdn(name)
+	timeout := time.Duration(opts.Timeout * float64(time.Second))
+	answers := make([]*answer, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			answers[i] = opts.query(server, name, qtype, timeout)
+		}(i, s)
+	}
+	// probes are the answers for a random label, which must not exist unless there is a wildcard record
+	var probes []*answer
+	if opts.NoWildcard {
+		probe, err := randomLabel(name)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		probes = make([]*answer, len(servers))
+		for i, s := range servers {
+			wg.Add(1)
+			go func(i int, server string) {
+				defer wg.Done()
+				probes[i] = opts.query(server, probe, qtype, timeout)
+			}(i, s)
+		}
+	}
+	var sec *dnssecResult
+	if opts.DNSSECValidate {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exchange := func(m *dns.Msg) (*dns.Msg, error) {
+				return opts.exchange(servers[0], m, timeout)
+			}
+			sec = newValidator(exchange, anchors, time.Now()).validate(name, qtype)
+		}()
+	}
+	wg.Wait()
+	return opts.evaluate(name, qtype, answers, probes, sec, time.Now())
+}
+
+// randomLabel returns a name of a random label under the name, such as "nonexistent-0123456789abcdef.example.com.".
+func randomLabel(name string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "nonexistent-" + hex.EncodeToString(b) + "." + name, nil
+}
+
+// resolvers returns the addresses of the resolvers to query with the port.
+func (opts *dnsOpts) resolvers() ([]string, error) {
+	servers := opts.Nameservers
+	if opts.ResolversFile != "" {
+		s, err := readLines(opts.ResolversFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(s) == 0 {
+			return nil, fmt.Errorf("no resolvers in %s", opts.ResolversFile)
+		}
+		servers = append(servers, s...)
+	}
+	if len(servers) == 0 {
+		s, err := systemNameserver()
+		if err != nil {
+			return nil, err
+		}
+		servers = []string{s}
+	}
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = withPort(s)
+	}
+	return addrs, nil
+}
+
+// withPort returns HOST:PORT of the resolver, which is HOST, HOST:PORT, IPv6 or [IPv6]:PORT.
+func withPort(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(server, "["), "]"), "53")
+}
+
+// readLines reads a value per line. Empty lines and lines starting with # are ignored.
+func readLines(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scr := bufio.NewScanner(f)
+	for scr.Scan() {
+		line := strings.TrimSpace(scr.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scr.Err()
+}
+
+// systemNameserver returns the first nameserver in resolv.conf.
+func systemNameserver() (string, error) {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scr := bufio.NewScanner(f)
+	for scr.Scan() {
+		fields := strings.Fields(scr.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	if err := scr.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no nameserver in %s", resolvConf)
+}
+
+// exchange sends the message to the server, and retries over TCP if the response is truncated.
+// The server is resolved to the address of the family selected by --ipv4 or --ipv6.
+func (opts *dnsOpts) exchange(server string, m *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	q := m.Question[0]
+	end := debuglog.Trace("dns: %s %s @%s", q.Name, dns.TypeToString[q.Qtype], server)
+	c := &dns.Client{Net: opts.Network("udp"), Timeout: timeout}
+	r, _, err := c.Exchange(m, server)
+	if err == nil && r.Truncated {
+		c.Net = opts.Network("tcp")
+		r, _, err = c.Exchange(m, server)
+	}
+	end(err)
+	return r, err
+}
+
+func (opts *dnsOpts) query(server, name string, qtype uint16, timeout time.Duration) *answer {
+	a := &answer{Server: server}
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(1232, false)
+
+	start := time.Now()
+	r, err := opts.exchange(server, m, timeout)
+	a.RTT = time.Since(start)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	a.Rcode = r.Rcode
+	for _, rr := range r.Answer {
+		if h := rr.Header(); h.Rrtype == qtype {
+			a.Values = append(a.Values, rdata(rr))
+			if len(a.Values) == 1 || h.Ttl < a.MinTTL {
+				a.MinTTL = h.Ttl
+			}
+			if h.Ttl > a.MaxTTL {
+				a.MaxTTL = h.Ttl
+			}
+		}
+	}
+	sort.Strings(a.Values)
+	return a
+}
+
+// rdata returns the data of the record in the presentation format,
+// except that the strings of TXT records are concatenated without the quotes.
+func rdata(rr dns.RR) string {
+	if t, ok := rr.(*dns.TXT); ok {
+		return strings.Join(t.Txt, "")
+	}
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+func (opts *dnsOpts) evaluate(name string, qtype uint16, answers, probes []*answer, sec *dnssecResult, now time.Time) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// the servers keyed by the outcomes, which differ while changes are propagating
+	outcomes := make(map[string][]string)
+	var maxRTT time.Duration
+	for _, a := range answers {
+		if a.Err != nil {
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %s", a.Server, a.Err))
+			continue
+		}
+		outcomes[a.outcome()] = append(outcomes[a.outcome()], a.Server)
+		if a.RTT > maxRTT {
+			maxRTT = a.RTT
+		}
+		rtt := a.RTT.Seconds()
+		switch {
+		case opts.Critical != nil && rtt > *opts.Critical:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %.3f seconds > %g seconds", a.Server, rtt, *opts.Critical))
+		case opts.Warning != nil && rtt > *opts.Warning:
+			raise(checkers.WARNING, fmt.Sprintf("%s: %.3f seconds > %g seconds", a.Server, rtt, *opts.Warning))
+		}
+		if len(a.Values) == 0 {
+			continue
+		}
+		switch {
+		case opts.ExpectTTLMin != nil && int64(a.MinTTL) < *opts.ExpectTTLMin:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: TTL %d < %d", a.Server, a.MinTTL, *opts.ExpectTTLMin))
+		case opts.ExpectTTLMax != nil && int64(a.MaxTTL) > *opts.ExpectTTLMax:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: TTL %d > %d", a.Server, a.MaxTTL, *opts.ExpectTTLMax))
+		}
+	}
+	for _, p := range probes {
+		switch {
+		case p.Err != nil:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %s", p.Server, p.Err))
+		case p.Rcode != dns.RcodeNameError:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: a random label under %s is %s, not NXDOMAIN (wildcard?)", p.Server, name, p.outcome()))
+		}
+	}
+
+	record := fmt.Sprintf("%s %s", name, dns.TypeToString[qtype])
+	var agreed string
+	switch len(outcomes) {
+	case 0:
+	case 1:
+		a := answers[0]
+		for _, v := range answers {
+			if v.Err == nil {
+				a = v
+				break
+			}
+		}
+		agreed = a.outcome()
+		switch {
+		case a.Rcode != dns.RcodeSuccess || len(a.Values) == 0:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %s", record, a.outcome()))
+		case len(opts.Expect) > 0 && !sameValues(a.Values, opts.Expect):
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %s, expected %s", record, a.outcome(), strings.Join(opts.Expect, ", ")))
+		}
+	default:
+		keys := make([]string, 0, len(outcomes))
+		for k := range outcomes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		groups := make([]string, len(keys))
+		for i, k := range keys {
+			groups[i] = fmt.Sprintf("%s from %s", k, strings.Join(outcomes[k], ", "))
+		}
+		raise(checkers.CRITICAL, fmt.Sprintf("%s: answers differ (%s)", record, strings.Join(groups, "; ")))
+	}
+	if sec != nil {
+		switch days := sec.Expiration.Sub(now).Hours() / 24; {
+		case sec.Err != nil:
+			raise(checkers.CRITICAL, fmt.Sprintf("DNSSEC: %s", sec.Err))
+		case sec.Expiration.IsZero():
+			// the denial of existence isn't validated
+		case opts.CriticalExpiry != nil && days < *opts.CriticalExpiry:
+			raise(checkers.CRITICAL, fmt.Sprintf("DNSSEC: the RRSIG of %s expires in %.1f days (%s)", sec.Expiring, days, sec.Expiration.UTC().Format(time.RFC3339)))
+		case days < opts.WarningExpiry:
+			raise(checkers.WARNING, fmt.Sprintf("DNSSEC: the RRSIG of %s expires in %.1f days (%s)", sec.Expiring, days, sec.Expiration.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(msgs) > 0 {
+		return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+	}
+
+	var validated string
+	switch {
+	case sec == nil:
+	case sec.Expiration.IsZero():
+		validated = ", no RRset to validate with DNSSEC"
+	default:
+		validated = fmt.Sprintf(", DNSSEC validated until %s", sec.Expiration.UTC().Format(time.RFC3339))
+	}
+	if len(answers) == 1 {
+		return checkers.Ok(fmt.Sprintf("%s %s (%.3f seconds via %s%s)", record, agreed, maxRTT.Seconds(), answers[0].Server, validated))
+	}
+	return checkers.Ok(fmt.Sprintf("%s %s by %d resolvers (max %.3f seconds%s)", record, agreed, len(answers), maxRTT.Seconds(), validated))
+}
+
+// sameValues reports whether the answers are the expected values, ignoring the order.
+// The names are compared case-insensitively with or without the trailing dot.
+func sameValues(values, expect []string) bool {
+	if len(values) != len(expect) {
+		return false
+	}
+	want := make(map[string]int)
+	for _, v := range expect {
+		want[strings.TrimSuffix(strings.ToLower(v), ".")]++
+	}
+	for _, v := range values {
+		k := strings.TrimSuffix(strings.ToLower(v), ".")
+		if want[k] == 0 {
+			return false
+		}
+		want[k]--
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package checkdns
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer starts a DNS server on UDP of the loopback which answers from the zone.
+func startServer(t *testing.T, zone map[string][]string) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		records, ok := zone[q.Name]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, s := range records {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Error(err)
+			}
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		w.WriteMsg(m)
+	})}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestQuery(t *testing.T) {
+	server := startServer(t, map[string][]string{
+		"www.example.com.": {
+			"www.example.com. 300 IN A 192.0.2.2",
+			"www.example.com. 60 IN A 192.0.2.1",
+		},
+		"example.com.": {
+			`example.com. 300 IN TXT "v=spf1 " "-all"`,
+			"example.com. 300 IN MX 10 mail.example.com.",
+		},
+	})
+
+	opts := &dnsOpts{}
+	a := opts.query(server, "www.example.com.", dns.TypeA, time.Second)
+	assert.Nil(t, a.Err)
+	assert.Equal(t, dns.RcodeSuccess, a.Rcode)
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, a.Values)
+	assert.Equal(t, uint32(60), a.MinTTL)
+	assert.Equal(t, uint32(300), a.MaxTTL)
+
+	a = opts.query(server, "example.com.", dns.TypeTXT, time.Second)
+	assert.Equal(t, []string{"v=spf1 -all"}, a.Values)
+
+	a = opts.query(server, "example.com.", dns.TypeMX, time.Second)
+	assert.Equal(t, []string{"10 mail.example.com."}, a.Values)
+
+	a = opts.query(server, "example.com.", dns.TypeAAAA, time.Second)
+	assert.Equal(t, "no records", a.outcome())
+
+	a = opts.query(server, "nonexistent.example.com.", dns.TypeA, time.Second)
+	assert.Equal(t, "NXDOMAIN", a.outcome())
+
+	opts.IPv4 = true
+	a = opts.query(server, "www.example.com.", dns.TypeA, time.Second)
+	assert.Nil(t, a.Err)
+	opts.IPv4, opts.IPv6 = false, true
+	a = opts.query(server, "www.example.com.", dns.TypeA, time.Second)
+	assert.NotNil(t, a.Err, "the IPv4 server should not be queried with --ipv6")
+}
+
+func TestEvaluate(t *testing.T) {
+	two := 2.0
+	ttl := int64(300)
+	tests := []struct {
+		opts    dnsOpts
+		answers []*answer
+		probes  []*answer
+		want    checkers.Status
+		msg     string
+	}{
+		{
+			opts:    dnsOpts{},
+			answers: []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, RTT: 12 * time.Millisecond}},
+			want:    checkers.OK,
+			msg:     "www.example.com. A 192.0.2.1 (0.012 seconds via 192.0.2.53:53)",
+		},
+		{
+			opts: dnsOpts{Expect: []string{"192.0.2.1", "192.0.2.2"}},
+			answers: []*answer{
+				{Server: "192.0.2.53:53", Values: []string{"192.0.2.1", "192.0.2.2"}, RTT: 12 * time.Millisecond},
+				{Server: "198.51.100.53:53", Values: []string{"192.0.2.1", "192.0.2.2"}, RTT: 30 * time.Millisecond},
+			},
+			want: checkers.OK,
+			msg:  "www.example.com. A 192.0.2.1, 192.0.2.2 by 2 resolvers (max 0.030 seconds)",
+		},
+		{
+			opts:    dnsOpts{Expect: []string{"192.0.2.1"}},
+			answers: []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.9"}}},
+			want:    checkers.CRITICAL,
+			msg:     "www.example.com. A: 192.0.2.9, expected 192.0.2.1",
+		},
+		{
+			opts:    dnsOpts{},
+			answers: []*answer{{Server: "192.0.2.53:53", Rcode: dns.RcodeNameError}},
+			want:    checkers.CRITICAL,
+			msg:     "www.example.com. A: NXDOMAIN",
+		},
+		{
+			opts: dnsOpts{},
+			answers: []*answer{
+				{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}},
+				{Server: "198.51.100.53:53", Values: []string{"192.0.2.9"}},
+				{Server: "203.0.113.53:53", Values: []string{"192.0.2.1"}},
+			},
+			want: checkers.CRITICAL,
+			msg:  "www.example.com. A: answers differ (192.0.2.1 from 192.0.2.53:53, 203.0.113.53:53; 192.0.2.9 from 198.51.100.53:53)",
+		},
+		{
+			opts: dnsOpts{Warning: &two},
+			answers: []*answer{
+				{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, RTT: 2500 * time.Millisecond},
+				{Server: "198.51.100.53:53", Err: errors.New("i/o timeout")},
+			},
+			want: checkers.CRITICAL,
+			msg:  "192.0.2.53:53: 2.500 seconds > 2 seconds, 198.51.100.53:53: i/o timeout",
+		},
+		{
+			opts: dnsOpts{ExpectTTLMin: &ttl},
+			answers: []*answer{
+				{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, MinTTL: 300, MaxTTL: 300},
+				{Server: "198.51.100.53:53", Values: []string{"192.0.2.1"}, MinTTL: 60, MaxTTL: 60},
+			},
+			want: checkers.CRITICAL,
+			msg:  "198.51.100.53:53: TTL 60 < 300",
+		},
+		{
+			opts:    dnsOpts{ExpectTTLMax: &ttl},
+			answers: []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, MinTTL: 300, MaxTTL: 3600}},
+			want:    checkers.CRITICAL,
+			msg:     "192.0.2.53:53: TTL 3600 > 300",
+		},
+		{
+			opts:    dnsOpts{NoWildcard: true},
+			answers: []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, RTT: 12 * time.Millisecond}},
+			probes:  []*answer{{Server: "192.0.2.53:53", Rcode: dns.RcodeNameError}},
+			want:    checkers.OK,
+			msg:     "www.example.com. A 192.0.2.1 (0.012 seconds via 192.0.2.53:53)",
+		},
+		{
+			opts:    dnsOpts{NoWildcard: true},
+			answers: []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}}},
+			probes:  []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}}},
+			want:    checkers.CRITICAL,
+			msg:     "192.0.2.53:53: a random label under www.example.com. is 192.0.2.1, not NXDOMAIN (wildcard?)",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate("www.example.com.", dns.TypeA, tt.answers, tt.probes, nil, time.Now())
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestSameValues(t *testing.T) {
+	assert.True(t, sameValues([]string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.2", "192.0.2.1"}))
+	assert.True(t, sameValues([]string{"www.example.com."}, []string{"WWW.example.com"}))
+	assert.False(t, sameValues([]string{"192.0.2.1"}, []string{"192.0.2.1", "192.0.2.2"}))
+	assert.False(t, sameValues([]string{"192.0.2.1", "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.2"}))
+}
+
+func TestResolvers(t *testing.T) {
+	dir := t.TempDir()
+	resolvConf = filepath.Join(dir, "resolv.conf")
+	err := ioutil.WriteFile(resolvConf, []byte("# generated\nsearch example.com\nnameserver 192.0.2.53\nnameserver 2001:db8::53\n"), 0644)
+	assert.Nil(t, err)
+
+	servers, err := (&dnsOpts{}).resolvers()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.53:53"}, servers)
+
+	file := filepath.Join(dir, "resolvers")
+	err = ioutil.WriteFile(file, []byte("# public\n198.51.100.53:5353\n\n2001:db8::53\n"), 0644)
+	assert.Nil(t, err)
+	servers, err = (&dnsOpts{Nameservers: []string{"[2001:db8::1]"}, ResolversFile: file}).resolvers()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"[2001:db8::1]:53", "198.51.100.53:5353", "[2001:db8::53]:53"}, servers)
+}
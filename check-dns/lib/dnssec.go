@@ -0,0 +1,293 @@
+package checkdns
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rootAnchors are the DS records of the root KSKs published at https://data.iana.org/root-anchors/root-anchors.xml,
+// KSK-2017 and its successor KSK-2024.
+var rootAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// dnssecResult is the result of the validation, with the RRSIG which expires first in the chain of trust.
+// Expiration is zero if the answer has no RRset to validate, which is NODATA.
+type dnssecResult struct {
+	Err        error
+	Expiring   string // such as "example.com. DNSKEY"
+	Expiration time.Time
+}
+
+// validator validates the chain of trust from the trust anchor down to the answers by itself.
+// The queries have the CD bit so that a validating resolver returns the bogus records instead of SERVFAIL.
+type validator struct {
+	exchange   func(m *dns.Msg) (*dns.Msg, error)
+	anchorZone string
+	anchors    []*dns.DS
+	keys       map[string][]*dns.DNSKEY // the validated keys of the zones
+	now        time.Time
+	result     dnssecResult
+}
+
+// loadAnchors reads the DS or DNSKEY records in the file, or returns the root anchors if file is empty.
+// DNSKEY records are converted to DS records.
+func loadAnchors(file string) ([]*dns.DS, error) {
+	var rrs []dns.RR
+	if file == "" {
+		for _, s := range rootAnchors {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, rr)
+		}
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		zp := dns.NewZoneParser(f, ".", file)
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			rrs = append(rrs, rr)
+		}
+		if err := zp.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var anchors []*dns.DS
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.DS:
+			anchors = append(anchors, v)
+		case *dns.DNSKEY:
+			anchors = append(anchors, v.ToDS(dns.SHA256))
+		}
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no DS or DNSKEY records in %s", file)
+	}
+	for _, ds := range anchors[1:] {
+		if !strings.EqualFold(ds.Hdr.Name, anchors[0].Hdr.Name) {
+			return nil, fmt.Errorf("the trust anchors are of multiple zones: %s and %s", anchors[0].Hdr.Name, ds.Hdr.Name)
+		}
+	}
+	return anchors, nil
+}
+
+func newValidator(exchange func(m *dns.Msg) (*dns.Msg, error), anchors []*dns.DS, now time.Time) *validator {
+	return &validator{
+		exchange:   exchange,
+		anchorZone: dns.Fqdn(strings.ToLower(anchors[0].Hdr.Name)),
+		anchors:    anchors,
+		keys:       make(map[string][]*dns.DNSKEY),
+		now:        now,
+	}
+}
+
+// validate validates the records of the type of the name, and the CNAME records to them.
+// It doesn't validate the denial of existence, which is reported without the validation.
+func (v *validator) validate(name string, qtype uint16) *dnssecResult {
+	r, err := v.query(name, qtype)
+	if err != nil {
+		v.result.Err = err
+		return &v.result
+	}
+	rrsets, sigs := groupRRsets(r.Answer)
+	for _, key := range sortedKeys(rrsets) {
+		if err := v.validateRRset(key, rrsets[key], sigs[key]); err != nil {
+			v.result.Err = err
+			break
+		}
+	}
+	return &v.result
+}
+
+func (v *validator) query(name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(1232, true)
+	m.CheckingDisabled = true
+	r, err := v.exchange(m)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s %s: %s", name, dns.TypeToString[qtype], dns.RcodeToString[r.Rcode])
+	}
+	return r, nil
+}
+
+// rrsetKey is the owner and the type of a RRset, such as "example.com. A".
+type rrsetKey string
+
+func newRRsetKey(name string, rrtype uint16) rrsetKey {
+	return rrsetKey(strings.ToLower(name) + " " + dns.TypeToString[rrtype])
+}
+
+// groupRRsets groups the records into the RRsets and the RRSIG records covering them.
+func groupRRsets(rrs []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	rrsets := make(map[rrsetKey][]dns.RR)
+	sigs := make(map[rrsetKey][]*dns.RRSIG)
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			k := newRRsetKey(sig.Hdr.Name, sig.TypeCovered)
+			sigs[k] = append(sigs[k], sig)
+			continue
+		}
+		k := newRRsetKey(rr.Header().Name, rr.Header().Rrtype)
+		rrsets[k] = append(rrsets[k], rr)
+	}
+	return rrsets, sigs
+}
+
+func sortedKeys(rrsets map[rrsetKey][]dns.RR) []rrsetKey {
+	keys := make([]rrsetKey, 0, len(rrsets))
+	for k := range rrsets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// validateRRset validates the RRset with the keys of the zone which signed it.
+func (v *validator) validateRRset(key rrsetKey, rrset []dns.RR, sigs []*dns.RRSIG) error {
+	if len(sigs) == 0 {
+		return fmt.Errorf("%s is not signed", key)
+	}
+	signer := sigs[0].SignerName
+	if !dns.IsSubDomain(signer, rrset[0].Header().Name) {
+		return fmt.Errorf("%s is signed by %s out of its zone", key, signer)
+	}
+	keys, err := v.zoneKeys(dns.Fqdn(strings.ToLower(signer)))
+	if err != nil {
+		return err
+	}
+	return v.verify(key, rrset, sigs, keys)
+}
+
+// zoneKeys returns the keys of the zone, which are trusted by the DS records signed by the parent zone
+// or by the trust anchor.
+func (v *validator) zoneKeys(zone string) ([]*dns.DNSKEY, error) {
+	if keys, ok := v.keys[zone]; ok {
+		return keys, nil
+	}
+	if !dns.IsSubDomain(v.anchorZone, zone) {
+		return nil, fmt.Errorf("%s is not under the trust anchor %s", zone, v.anchorZone)
+	}
+
+	anchors := v.anchors
+	if zone != v.anchorZone {
+		r, err := v.query(zone, dns.TypeDS)
+		if err != nil {
+			return nil, err
+		}
+		rrsets, sigs := groupRRsets(r.Answer)
+		key := newRRsetKey(zone, dns.TypeDS)
+		if len(rrsets[key]) == 0 {
+			return nil, fmt.Errorf("no DS of %s in the parent zone, which is an insecure delegation", zone)
+		}
+		if len(sigs[key]) == 0 {
+			return nil, fmt.Errorf("%s is not signed", key)
+		}
+		parent := dns.Fqdn(strings.ToLower(sigs[key][0].SignerName))
+		if parent == zone || !dns.IsSubDomain(parent, zone) {
+			return nil, fmt.Errorf("%s is signed by %s, which is not the parent zone", key, parent)
+		}
+		parentKeys, err := v.zoneKeys(parent)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.verify(key, rrsets[key], sigs[key], parentKeys); err != nil {
+			return nil, err
+		}
+		anchors = nil
+		for _, rr := range rrsets[key] {
+			anchors = append(anchors, rr.(*dns.DS))
+		}
+	}
+
+	r, err := v.query(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	rrsets, sigs := groupRRsets(r.Answer)
+	key := newRRsetKey(zone, dns.TypeDNSKEY)
+	var keys, trusted []*dns.DNSKEY
+	for _, rr := range rrsets[key] {
+		k := rr.(*dns.DNSKEY)
+		if k.Flags&dns.ZONE == 0 {
+			continue
+		}
+		keys = append(keys, k)
+		for _, ds := range anchors {
+			if ds.KeyTag != k.KeyTag() || ds.Algorithm != k.Algorithm {
+				continue
+			}
+			if d := k.ToDS(ds.DigestType); d != nil && strings.EqualFold(d.Digest, ds.Digest) {
+				trusted = append(trusted, k)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY of %s", zone)
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("no DNSKEY of %s matches the DS", zone)
+	}
+	// the other keys are trusted only if the DNSKEY RRset is signed by the key in the DS
+	if err := v.verify(key, rrsets[key], sigs[key], trusted); err != nil {
+		return nil, err
+	}
+	v.keys[zone] = keys
+	return keys, nil
+}
+
+// verify verifies the RRset with any of the signatures made by the keys in their validity periods,
+// and keeps the expiration if it's the first in the chain.
+func (v *validator) verify(key rrsetKey, rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return fmt.Errorf("%s is not signed", key)
+	}
+	var expiration time.Time
+	var lastErr error
+	for _, sig := range sigs {
+		for _, k := range keys {
+			if sig.KeyTag != k.KeyTag() || sig.Algorithm != k.Algorithm {
+				continue
+			}
+			if err := sig.Verify(k, rrset); err != nil {
+				lastErr = fmt.Errorf("%s is bogus: %s", key, err)
+				continue
+			}
+			if !sig.ValidityPeriod(v.now) {
+				lastErr = fmt.Errorf("the RRSIG of %s by the key %d is valid only from %s to %s", key, sig.KeyTag,
+					dns.TimeToString(sig.Inception), dns.TimeToString(sig.Expiration))
+				continue
+			}
+			if exp := time.Unix(int64(sig.Expiration), 0); exp.After(expiration) {
+				expiration = exp
+			}
+		}
+	}
+	if expiration.IsZero() {
+		if lastErr != nil {
+			return lastErr
+		}
+		return fmt.Errorf("%s is not signed by the keys of %s", key, sigs[0].SignerName)
+	}
+	if v.result.Expiration.IsZero() || expiration.Before(v.result.Expiration) {
+		v.result.Expiring = string(key)
+		v.result.Expiration = expiration
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package checkdns
+
+import (
+	"crypto"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedZone is the key of a zone with which the test records are signed.
+type signedZone struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newSignedZone(t *testing.T, name string) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signedZone{key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns the RRset with the RRSIG which is valid from an hour ago until the expiration.
+func (z *signedZone) sign(t *testing.T, expiration time.Time, rrset ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := sig.Sign(z.priv, rrset); err != nil {
+		t.Fatal(err)
+	}
+	return append(rrset, sig)
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// newExchange returns the exchange which answers the query from the records keyed by "NAME TYPE".
+func newExchange(records map[string][]dns.RR) func(m *dns.Msg) (*dns.Msg, error) {
+	return func(m *dns.Msg) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetReply(m)
+		q := m.Question[0]
+		r.Answer = records[q.Name+" "+dns.TypeToString[q.Qtype]]
+		return r, nil
+	}
+}
+
+func TestValidate(t *testing.T) {
+	parent := newSignedZone(t, "com.")
+	child := newSignedZone(t, "example.com.")
+	anchors := []*dns.DS{parent.key.ToDS(dns.SHA256)}
+	now := time.Now()
+	month := now.Add(30 * 24 * time.Hour)
+	week := now.Add(7 * 24 * time.Hour)
+
+	a := mustRR(t, "www.example.com. 300 IN A 192.0.2.1")
+	records := map[string][]dns.RR{
+		"com. DNSKEY":             parent.sign(t, month, parent.key),
+		"example.com. DS":         parent.sign(t, week, child.key.ToDS(dns.SHA256)),
+		"example.com. DNSKEY":     child.sign(t, month, child.key),
+		"www.example.com. A":      child.sign(t, month, a),
+		"bogus.example.com. A":    append(child.sign(t, month, mustRR(t, "bogus.example.com. 300 IN A 192.0.2.1"))[1:], mustRR(t, "bogus.example.com. 300 IN A 192.0.2.9")),
+		"unsigned.example.com. A": {mustRR(t, "unsigned.example.com. 300 IN A 192.0.2.1")},
+	}
+
+	sec := newValidator(newExchange(records), anchors, now).validate("www.example.com.", dns.TypeA)
+	assert.Nil(t, sec.Err)
+	assert.Equal(t, "example.com. DS", sec.Expiring)
+	assert.Equal(t, week.Unix(), sec.Expiration.Unix())
+
+	sec = newValidator(newExchange(records), anchors, now).validate("bogus.example.com.", dns.TypeA)
+	if assert.Error(t, sec.Err) {
+		assert.Contains(t, sec.Err.Error(), "bogus.example.com. A is bogus")
+	}
+
+	sec = newValidator(newExchange(records), anchors, now).validate("unsigned.example.com.", dns.TypeA)
+	assert.EqualError(t, sec.Err, "unsigned.example.com. A is not signed")
+
+	sec = newValidator(newExchange(records), anchors, now).validate("www.example.com.", dns.TypeAAAA)
+	assert.Nil(t, sec.Err)
+	assert.True(t, sec.Expiration.IsZero(), "NODATA has no RRSIG to expire")
+
+	sec = newValidator(newExchange(records), anchors, week.Add(time.Hour)).validate("www.example.com.", dns.TypeA)
+	if assert.Error(t, sec.Err) {
+		assert.Contains(t, sec.Err.Error(), "the RRSIG of example.com. DS")
+	}
+
+	other := newSignedZone(t, "com.")
+	sec = newValidator(newExchange(records), []*dns.DS{other.key.ToDS(dns.SHA256)}, now).validate("www.example.com.", dns.TypeA)
+	assert.EqualError(t, sec.Err, "no DNSKEY of com. matches the DS")
+}
+
+func TestLoadAnchors(t *testing.T) {
+	anchors, err := loadAnchors("")
+	assert.Nil(t, err)
+	assert.Len(t, anchors, 2)
+	assert.Equal(t, ".", anchors[0].Hdr.Name)
+
+	zone := newSignedZone(t, "com.")
+	file := filepath.Join(t.TempDir(), "anchors")
+	if err := ioutil.WriteFile(file, []byte(zone.key.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	anchors, err = loadAnchors(file)
+	assert.Nil(t, err)
+	if assert.Len(t, anchors, 1) {
+		assert.Equal(t, zone.key.KeyTag(), anchors[0].KeyTag)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("example. 300 IN A 192.0.2.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadAnchors(file)
+	assert.EqualError(t, err, "no DS or DNSKEY records in "+file)
+}
+
+func TestEvaluateDNSSEC(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	one := 1.0
+	answers := []*answer{{Server: "192.0.2.53:53", Values: []string{"192.0.2.1"}, RTT: 12 * time.Millisecond}}
+	tests := []struct {
+		opts dnsOpts
+		sec  *dnssecResult
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: dnsOpts{WarningExpiry: 7},
+			sec:  &dnssecResult{Expiring: "example.com. DNSKEY", Expiration: now.Add(20 * 24 * time.Hour)},
+			want: checkers.OK,
+			msg:  "www.example.com. A 192.0.2.1 (0.012 seconds via 192.0.2.53:53, DNSSEC validated until 2026-11-05T00:00:00Z)",
+		},
+		{
+			opts: dnsOpts{WarningExpiry: 7, CriticalExpiry: &one},
+			sec:  &dnssecResult{Expiring: "example.com. DNSKEY", Expiration: now.Add(3 * 24 * time.Hour)},
+			want: checkers.WARNING,
+			msg:  "DNSSEC: the RRSIG of example.com. DNSKEY expires in 3.0 days (2026-10-19T00:00:00Z)",
+		},
+		{
+			opts: dnsOpts{WarningExpiry: 7, CriticalExpiry: &one},
+			sec:  &dnssecResult{Expiring: "example.com. DNSKEY", Expiration: now.Add(12 * time.Hour)},
+			want: checkers.CRITICAL,
+			msg:  "DNSSEC: the RRSIG of example.com. DNSKEY expires in 0.5 days (2026-10-16T12:00:00Z)",
+		},
+		{
+			opts: dnsOpts{WarningExpiry: 7},
+			sec:  &dnssecResult{Err: errors.New("www.example.com. A is not signed")},
+			want: checkers.CRITICAL,
+			msg:  "DNSSEC: www.example.com. A is not signed",
+		},
+		{
+			opts: dnsOpts{WarningExpiry: 7},
+			sec:  &dnssecResult{},
+			want: checkers.OK,
+			msg:  "www.example.com. A 192.0.2.1 (0.012 seconds via 192.0.2.53:53, no RRset to validate with DNSSEC)",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate("www.example.com.", dns.TypeA, answers, nil, tt.sec, now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
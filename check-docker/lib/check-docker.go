@@ -0,0 +1,243 @@
+package checkdocker
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type dockerOpts struct {
+	Host             string   `short:"H" long:"host" default:"unix:///var/run/docker.sock" description:"Docker Engine API endpoint" env:"DOCKER_HOST"`
+	TLSCert          string   `long:"tls-cert" value-name:"FILE" description:"TLS client certificate file"`
+	TLSKey           string   `long:"tls-key" value-name:"FILE" description:"TLS client key file"`
+	TLSCACert        string   `long:"tls-ca-cert" value-name:"FILE" description:"TLS CA certificate file"`
+	Timeout          int      `short:"t" long:"timeout" default:"10" description:"Seconds before the API request times out"`
+	Names            []string `short:"n" long:"name" description:"Name of the container to check (may be repeated)"`
+	Labels           []string `short:"l" long:"label" value-name:"KEY[=VALUE]" description:"Check containers which have the label (may be repeated; all labels must match)"`
+	WarningRestarts  int      `short:"w" long:"warning-restarts" default:"1" description:"warning if the restart count increased by this or more since the last run (0 disables)"`
+	CriticalRestarts int      `short:"c" long:"critical-restarts" default:"3" description:"critical if the restart count increased by this or more since the last run (0 disables)"`
+	StateDir         string   `short:"s" long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// dockerClient is the subset of *docker.Client used by the plugin.
+type dockerClient interface {
+	ListContainers(docker.ListContainersOptions) ([]docker.APIContainers, error)
+	InspectContainerWithOptions(docker.InspectContainerOptions) (*docker.Container, error)
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Docker"
+	return ckr
+}
+
+// selfTestChecks returns the checks that the endpoint and the TLS files are available.
+func (opts *dockerOpts) selfTestChecks() []selftest.Check {
+	var checks []selftest.Check
+	if path := strings.TrimPrefix(opts.Host, "unix://"); path != opts.Host {
+		checks = append(checks, selftest.Exists(path))
+	} else {
+		checks = append(checks, selftest.ResolveURL(opts.Host))
+	}
+	for _, f := range []string{opts.TLSCert, opts.TLSKey, opts.TLSCACert} {
+		if f != "" {
+			checks = append(checks, selftest.Readable(f))
+		}
+	}
+	return checks
+}
+
+func newClient(opts *dockerOpts) (*docker.Client, error) {
+	var (
+		client *docker.Client
+		err    error
+	)
+	if opts.TLSCert != "" || opts.TLSKey != "" || opts.TLSCACert != "" {
+		client, err = docker.NewTLSClient(opts.Host, opts.TLSCert, opts.TLSKey, opts.TLSCACert)
+	} else {
+		client, err = docker.NewClient(opts.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.SetTimeout(time.Duration(opts.Timeout) * time.Second)
+	// the transport dials the unix socket, so it's wrapped rather than replaced
+	opts.DebugOpts.Enable()
+	client.HTTPClient.Transport = debuglog.Transport(client.HTTPClient.Transport)
+	return client, nil
+}
+
+// fetchContainers returns the containers specified by --name and --label.
+// Names of containers which are not found are returned as missing.
+func fetchContainers(client dockerClient, opts *dockerOpts) ([]*docker.Container, []string, error) {
+	var (
+		containers []*docker.Container
+		missing    []string
+	)
+	seen := make(map[string]bool)
+	for _, name := range opts.Names {
+		c, err := client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: name})
+		if err != nil {
+			if _, ok := err.(*docker.NoSuchContainer); ok {
+				missing = append(missing, name)
+				continue
+			}
+			return nil, nil, err
+		}
+		if !seen[c.ID] {
+			seen[c.ID] = true
+			containers = append(containers, c)
+		}
+	}
+
+	if len(opts.Labels) > 0 {
+		list, err := client.ListContainers(docker.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"label": opts.Labels},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(list) == 0 {
+			missing = append(missing, "label "+strings.Join(opts.Labels, ","))
+		}
+		for _, l := range list {
+			if seen[l.ID] {
+				continue
+			}
+			c, err := client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: l.ID})
+			if err != nil {
+				// the container may be removed after it is listed
+				if _, ok := err.(*docker.NoSuchContainer); ok {
+					continue
+				}
+				return nil, nil, err
+			}
+			seen[c.ID] = true
+			containers = append(containers, c)
+		}
+	}
+	return containers, missing, nil
+}
+
+func getStateFile(stateDir string, args []string) string {
+	return state.File(stateDir, "restarts", os.Getenv("DOCKER_HOST"), strings.Join(args, " "))
+}
+
+// restartState is restart counts of the containers keyed by the container ID.
+type restartState map[string]int
+
+func containerName(c *docker.Container) string {
+	return strings.TrimPrefix(c.Name, "/")
+}
+
+// checkContainer returns the status and the message of the container.
+// prev is the restart count at the last run, or -1 if it is unknown.
+func checkContainer(c *docker.Container, prev int, opts *dockerOpts) (checkers.Status, string) {
+	name := containerName(c)
+	switch {
+	case c.State.Restarting:
+		return checkers.CRITICAL, fmt.Sprintf("%s is restarting (restart count %d)", name, c.RestartCount)
+	case !c.State.Running:
+		return checkers.CRITICAL, fmt.Sprintf("%s is %s (exit code %d)", name, c.State.Status, c.State.ExitCode)
+	case c.State.Health.Status == "unhealthy":
+		msg := fmt.Sprintf("%s is unhealthy (failing streak %d)", name, c.State.Health.FailingStreak)
+		if n := len(c.State.Health.Log); n > 0 {
+			msg += ": " + strings.TrimSpace(c.State.Health.Log[n-1].Output)
+		}
+		return checkers.CRITICAL, msg
+	}
+
+	st := c.State.Status
+	if h := c.State.Health.Status; h != "" {
+		st += " (" + h + ")"
+	}
+	if prev >= 0 && c.RestartCount > prev {
+		increase := c.RestartCount - prev
+		msg := fmt.Sprintf("%s is %s, restarted %d times since the last check", name, st, increase)
+		if opts.CriticalRestarts > 0 && increase >= opts.CriticalRestarts {
+			return checkers.CRITICAL, msg
+		}
+		if opts.WarningRestarts > 0 && increase >= opts.WarningRestarts {
+			return checkers.WARNING, msg
+		}
+	}
+	return checkers.OK, fmt.Sprintf("%s is %s", name, st)
+}
+
+func evaluate(containers []*docker.Container, missing []string, prev restartState, opts *dockerOpts) *checkers.Checker {
+	sort.Slice(containers, func(i, j int) bool { return containerName(containers[i]) < containerName(containers[j]) })
+
+	checkSt := checkers.OK
+	var msgs []string
+	for _, m := range missing {
+		checkSt = checkers.CRITICAL
+		msgs = append(msgs, fmt.Sprintf("%s is not found", m))
+	}
+	for _, c := range containers {
+		count, ok := prev[c.ID]
+		if !ok {
+			count = -1
+		}
+		st, msg := checkContainer(c, count, opts)
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &dockerOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if len(opts.Names) == 0 && len(opts.Labels) == 0 {
+		return checkers.Unknown("either --name or --label is required")
+	}
+
+	client, err := newClient(opts)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(opts.selfTestChecks()...)
+	}
+	containers, missing, err := fetchContainers(client, opts)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := getStateFile(state.Dir(opts.StateDir, "check-docker"), args)
+	prev := restartState{}
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cur := make(restartState, len(containers))
+	for _, c := range containers {
+		cur[c.ID] = c.RestartCount
+	}
+	if err := state.Save(stateFile, cur); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluate(containers, missing, prev, opts)
+}
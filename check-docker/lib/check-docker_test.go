@@ -0,0 +1,126 @@
+package checkdocker
+
+import (
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockClient struct {
+	containers map[string]*docker.Container
+	filters    map[string][]string
+}
+
+func (c *mockClient) ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	c.filters = opts.Filters
+	var list []docker.APIContainers
+	for _, ct := range c.containers {
+		if ct.Config != nil && ct.Config.Labels["app"] == "web" {
+			list = append(list, docker.APIContainers{ID: ct.ID, Names: []string{ct.Name}})
+		}
+	}
+	return list, nil
+}
+
+func (c *mockClient) InspectContainerWithOptions(opts docker.InspectContainerOptions) (*docker.Container, error) {
+	for _, ct := range c.containers {
+		if ct.ID == opts.ID || ct.Name == "/"+opts.ID {
+			return ct, nil
+		}
+	}
+	return nil, &docker.NoSuchContainer{ID: opts.ID}
+}
+
+func newContainer(id, name string, state docker.State, restarts int) *docker.Container {
+	return &docker.Container{ID: id, Name: "/" + name, State: state, RestartCount: restarts, Config: &docker.Config{Labels: map[string]string{}}}
+}
+
+var running = docker.State{Status: "running", Running: true}
+
+func TestFetchContainers(t *testing.T) {
+	web1 := newContainer("a1", "web1", running, 0)
+	web1.Config.Labels["app"] = "web"
+	web2 := newContainer("a2", "web2", running, 0)
+	web2.Config.Labels["app"] = "web"
+	client := &mockClient{containers: map[string]*docker.Container{
+		"a1": web1,
+		"a2": web2,
+		"b1": newContainer("b1", "db", running, 0),
+	}}
+
+	opts := &dockerOpts{Names: []string{"db", "web1", "cache"}, Labels: []string{"app=web"}}
+	containers, missing, err := fetchContainers(client, opts)
+	assert.Nil(t, err)
+	assert.Len(t, containers, 3)
+	assert.Equal(t, []string{"cache"}, missing)
+	assert.Equal(t, []string{"app=web"}, client.filters["label"])
+
+	opts = &dockerOpts{Labels: []string{"app=api"}}
+	client.containers = map[string]*docker.Container{}
+	_, missing, err = fetchContainers(client, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"label app=api"}, missing)
+}
+
+func TestEvaluate(t *testing.T) {
+	opts := &dockerOpts{WarningRestarts: 1, CriticalRestarts: 3}
+	healthy := running
+	healthy.Health = docker.Health{Status: "healthy"}
+	unhealthy := running
+	unhealthy.Health = docker.Health{Status: "unhealthy", FailingStreak: 3, Log: []docker.HealthCheck{{ExitCode: 1, Output: "connection refused\n"}}}
+	exited := docker.State{Status: "exited", ExitCode: 137}
+
+	tests := []struct {
+		name       string
+		containers []*docker.Container
+		missing    []string
+		prev       restartState
+		want       checkers.Status
+	}{
+		{
+			name:       "running",
+			containers: []*docker.Container{newContainer("a1", "web", healthy, 2), newContainer("b1", "db", running, 0)},
+			prev:       restartState{"a1": 2},
+			want:       checkers.OK,
+		},
+		{
+			name:       "first run",
+			containers: []*docker.Container{newContainer("a1", "web", running, 5)},
+			prev:       restartState{},
+			want:       checkers.OK,
+		},
+		{
+			name:       "restarted",
+			containers: []*docker.Container{newContainer("a1", "web", running, 3)},
+			prev:       restartState{"a1": 2},
+			want:       checkers.WARNING,
+		},
+		{
+			name:       "restart loop",
+			containers: []*docker.Container{newContainer("a1", "web", running, 5)},
+			prev:       restartState{"a1": 2},
+			want:       checkers.CRITICAL,
+		},
+		{
+			name:       "unhealthy",
+			containers: []*docker.Container{newContainer("a1", "web", unhealthy, 0)},
+			want:       checkers.CRITICAL,
+		},
+		{
+			name:       "exited",
+			containers: []*docker.Container{newContainer("a1", "web", exited, 0)},
+			want:       checkers.CRITICAL,
+		},
+		{
+			name:    "missing",
+			missing: []string{"web"},
+			want:    checkers.CRITICAL,
+		},
+	}
+	for _, tt := range tests {
+		ckr := evaluate(tt.containers, tt.missing, tt.prev, opts)
+		assert.Equal(t, tt.want, ckr.Status, tt.name+": "+ckr.Message)
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type healthStat struct {
@@ -16,26 +19,115 @@ type healthStat struct {
 	Status      string `json:"status"`
 }
 
-var opts struct {
-	Scheme string `short:"s" long:"scheme" default:"http" description:"Elasticsearch scheme"`
-	Host   string `short:"H" long:"host" default:"localhost" description:"Elasticsearch host"`
-	Port   int64  `short:"p" long:"port" default:"9200" description:"Elasticsearch port"`
+type esSetting struct {
+	Scheme  string `short:"s" long:"scheme" default:"http" description:"Elasticsearch scheme"`
+	Host    string `short:"H" long:"host" default:"localhost" description:"Elasticsearch host"`
+	Port    int64  `short:"p" long:"port" default:"9200" description:"Elasticsearch port"`
+	Timeout int    `short:"t" long:"timeout" default:"10" description:"Seconds before the request times out"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"health":    checkHealth,
+	"snapshot":  checkSnapshot,
+	"nodes":     checkNodes,
+	"lifecycle": checkLifecycle,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	// Checks the cluster health without a subcommand for backward compatibility.
+	if subCmd == "" {
+		subCmd = "health"
+	}
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-elasticsearch [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Elasticsearch"
+		return ckr
+	}
+	ckr := fn(argv)
 	ckr.Name = "Elasticsearch"
-	ckr.Exit()
+	if subCmd != "health" {
+		// the subcommands are in ASCII, and strings.Title is deprecated
+		ckr.Name += " " + strings.ToUpper(subCmd[:1]) + subCmd[1:]
+	}
+	return ckr
+}
+
+// statusError is returned by get if the API responds with other than 200 OK.
+type statusError struct {
+	path   string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.path, e.status)
 }
 
-func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+// client returns the HTTP client which times out after --timeout.
+func (s esSetting) client() *http.Client {
+	return &http.Client{Transport: debuglog.Transport(nil), Timeout: time.Duration(s.Timeout) * time.Second}
+}
+
+// get requests the API at path and decodes the JSON response into v.
+func (s esSetting) get(path string, v interface{}) error {
+	url := fmt.Sprintf("%s://%s:%d%s", s.Scheme, s.Host, s.Port, path)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "check-elasticsearch")
+
+	s.DebugOpts.Enable()
+	client := s.client()
+	resp, err := client.Do(req)
 	if err != nil {
-		os.Exit(1)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{path: path, code: resp.StatusCode, status: resp.Status}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func checkHealth(args []string) *checkers.Checker {
+	opts := esSetting{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "[health] [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
 	}
 
-	client := &http.Client{}
+	opts.DebugOpts.Enable()
+	client := opts.client()
 	url := fmt.Sprintf("%s://%s:%d/_cluster/health", opts.Scheme, opts.Host, opts.Port)
 
 	stTime := time.Now()
@@ -0,0 +1,181 @@
+package checkelasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type lifecycleOpts struct {
+	esSetting
+	WarningSkew     int64  `long:"warning-skew" value-name:"HOURS" default:"24" description:"warning if the nodes have run mixed versions for more than the hours"`
+	CriticalSkew    *int64 `long:"critical-skew" value-name:"HOURS" description:"critical if the nodes have run mixed versions for more than the hours"`
+	WarningLicense  int64  `long:"warning-license" value-name:"DAYS" default:"30" description:"warning if the license expires within the days"`
+	CriticalLicense int64  `long:"critical-license" value-name:"DAYS" default:"7" description:"critical if the license expires within the days"`
+	StateDir        string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+type nodeVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// licenseInfo is the license of the cluster, whose expiry is 0 if it never expires, such as basic licenses.
+type licenseInfo struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	ExpiryDateInMillis int64  `json:"expiry_date_in_millis"`
+}
+
+func (l *licenseInfo) expiry() time.Time {
+	return time.Unix(0, l.ExpiryDateInMillis*int64(time.Millisecond))
+}
+
+// lifecycleState is the time when the nodes were found running mixed versions first.
+type lifecycleState struct {
+	MixedSince int64 `json:"mixed_since"`
+}
+
+func checkLifecycle(args []string) *checkers.Checker {
+	opts := lifecycleOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "lifecycle [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
+	}
+
+	var resp struct {
+		Nodes map[string]nodeVersion `json:"nodes"`
+	}
+	err = opts.get("/_nodes?filter_path=nodes.*.name,nodes.*.version", &resp)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	license, err := opts.getLicense()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-elasticsearch"))
+	var prev *lifecycleState
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	now := time.Now()
+	versions := groupVersions(resp.Nodes)
+	next := trackMixed(versions, prev, now)
+	if err := state.Save(stateFile, next); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(versions, next, license, now)
+}
+
+// getLicense returns nil if the cluster has no license API, such as the OSS distribution and OpenSearch.
+func (opts *lifecycleOpts) getLicense() (*licenseInfo, error) {
+	var resp struct {
+		License *licenseInfo `json:"license"`
+	}
+	err := opts.get("/_license", &resp)
+	var se *statusError
+	if errors.As(err, &se) && (se.code == http.StatusNotFound || se.code == http.StatusBadRequest) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.License, nil
+}
+
+// groupVersions returns the names of the nodes keyed by their versions.
+func groupVersions(nodes map[string]nodeVersion) map[string][]string {
+	versions := make(map[string][]string)
+	for _, n := range nodes {
+		versions[n.Version] = append(versions[n.Version], n.Name)
+	}
+	for _, names := range versions {
+		sort.Strings(names)
+	}
+	return versions
+}
+
+// trackMixed returns the state to save, which keeps the time when the mixed versions were found first.
+func trackMixed(versions map[string][]string, prev *lifecycleState, now time.Time) *lifecycleState {
+	if len(versions) <= 1 {
+		return &lifecycleState{}
+	}
+	if prev != nil && prev.MixedSince > 0 {
+		return prev
+	}
+	return &lifecycleState{MixedSince: now.Unix()}
+}
+
+// evaluate checks how long the nodes have run mixed versions, which is expected only during rolling upgrades,
+// and the expiry of the license, after which the paid features stop working.
+func (opts *lifecycleOpts) evaluate(versions map[string][]string, state *lifecycleState, license *licenseInfo, now time.Time) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	var msgs []string
+	if len(versions) > 1 {
+		vs := make([]string, 0, len(versions))
+		for v := range versions {
+			vs = append(vs, v)
+		}
+		sort.Strings(vs)
+		var groups []string
+		for _, v := range vs {
+			groups = append(groups, fmt.Sprintf("%s on %s", v, strings.Join(versions[v], ", ")))
+		}
+		mixed := now.Sub(time.Unix(state.MixedSince, 0))
+		switch {
+		case opts.CriticalSkew != nil && mixed > time.Duration(*opts.CriticalSkew)*time.Hour:
+			raise(checkers.CRITICAL)
+		case mixed > time.Duration(opts.WarningSkew)*time.Hour:
+			raise(checkers.WARNING)
+		}
+		msgs = append(msgs, fmt.Sprintf("mixed versions for %.1f hours (%s)", mixed.Hours(), strings.Join(groups, "; ")))
+	} else {
+		for v := range versions {
+			msgs = append(msgs, fmt.Sprintf("all nodes run %s", v))
+		}
+	}
+
+	switch {
+	case license == nil:
+	case license.Status != "active":
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, fmt.Sprintf("%s license is %s", license.Type, license.Status))
+	case license.ExpiryDateInMillis == 0:
+		msgs = append(msgs, fmt.Sprintf("%s license never expires", license.Type))
+	default:
+		days := license.expiry().Sub(now).Hours() / 24
+		switch {
+		case days < float64(opts.CriticalLicense):
+			raise(checkers.CRITICAL)
+		case days < float64(opts.WarningLicense):
+			raise(checkers.WARNING)
+		}
+		msgs = append(msgs, fmt.Sprintf("%s license expires in %.1f days", license.Type, days))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func (opts *lifecycleOpts) stateFile(stateDir string) string {
+	return state.File(stateDir, "lifecycle", fmt.Sprintf("%s://%s:%d", opts.Scheme, opts.Host, opts.Port))
+}
@@ -0,0 +1,112 @@
+package checkelasticsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackMixed(t *testing.T) {
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	single := map[string][]string{"8.11.1": {"es-1", "es-2"}}
+	mixed := map[string][]string{"8.11.1": {"es-1"}, "8.12.0": {"es-2"}}
+
+	assert.Equal(t, &lifecycleState{}, trackMixed(single, &lifecycleState{MixedSince: 100}, now))
+	assert.Equal(t, &lifecycleState{MixedSince: now.Unix()}, trackMixed(mixed, nil, now))
+	assert.Equal(t, &lifecycleState{MixedSince: now.Unix()}, trackMixed(mixed, &lifecycleState{}, now))
+	assert.Equal(t, &lifecycleState{MixedSince: 100}, trackMixed(mixed, &lifecycleState{MixedSince: 100}, now))
+}
+
+func TestLifecycleEvaluate(t *testing.T) {
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	critical := int64(72)
+	opts := &lifecycleOpts{WarningSkew: 24, CriticalSkew: &critical, WarningLicense: 30, CriticalLicense: 7}
+	single := groupVersions(map[string]nodeVersion{"a": {"es-1", "8.11.1"}, "b": {"es-2", "8.11.1"}})
+	mixed := groupVersions(map[string]nodeVersion{"a": {"es-1", "8.11.1"}, "b": {"es-2", "8.12.0"}, "c": {"es-3", "8.12.0"}})
+	since := func(d time.Duration) *lifecycleState { return &lifecycleState{MixedSince: now.Add(-d).Unix()} }
+	license := func(status string, days int) *licenseInfo {
+		l := &licenseInfo{Type: "platinum", Status: status}
+		if days != 0 {
+			l.ExpiryDateInMillis = now.Add(time.Duration(days)*24*time.Hour).UnixNano() / int64(time.Millisecond)
+		}
+		return l
+	}
+
+	tests := []struct {
+		name     string
+		versions map[string][]string
+		state    *lifecycleState
+		license  *licenseInfo
+		want     checkers.Status
+		msg      string
+	}{
+		{
+			name:     "healthy",
+			versions: single,
+			state:    &lifecycleState{},
+			license:  license("active", 90),
+			want:     checkers.OK,
+			msg:      "all nodes run 8.11.1, platinum license expires in 90.0 days",
+		},
+		{
+			name:     "rolling upgrade",
+			versions: mixed,
+			state:    since(2 * time.Hour),
+			want:     checkers.OK,
+			msg:      "mixed versions for 2.0 hours (8.11.1 on es-1; 8.12.0 on es-2, es-3)",
+		},
+		{
+			name:     "stalled upgrade",
+			versions: mixed,
+			state:    since(30 * time.Hour),
+			want:     checkers.WARNING,
+		},
+		{
+			name:     "abandoned upgrade",
+			versions: mixed,
+			state:    since(100 * time.Hour),
+			want:     checkers.CRITICAL,
+		},
+		{
+			name:     "license expiring",
+			versions: single,
+			state:    &lifecycleState{},
+			license:  license("active", 20),
+			want:     checkers.WARNING,
+		},
+		{
+			name:     "license about to expire",
+			versions: single,
+			state:    &lifecycleState{},
+			license:  license("active", 3),
+			want:     checkers.CRITICAL,
+		},
+		{
+			name:     "license expired",
+			versions: single,
+			state:    &lifecycleState{},
+			license:  license("expired", -1),
+			want:     checkers.CRITICAL,
+			msg:      "all nodes run 8.11.1, platinum license is expired",
+		},
+		{
+			name:     "basic license",
+			versions: single,
+			state:    &lifecycleState{},
+			license:  &licenseInfo{Type: "basic", Status: "active"},
+			want:     checkers.OK,
+			msg:      "all nodes run 8.11.1, basic license never expires",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckr := opts.evaluate(tt.versions, tt.state, tt.license, now)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+			if tt.msg != "" {
+				assert.Equal(t, tt.msg, ckr.Message)
+			}
+		})
+	}
+}
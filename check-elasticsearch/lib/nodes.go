@@ -0,0 +1,145 @@
+package checkelasticsearch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type nodesOpts struct {
+	esSetting
+	WarningHeap   int64  `long:"warning-heap" value-name:"PERCENT" default:"85" description:"warning if the JVM heap usage of a node is over or equal"`
+	CriticalHeap  int64  `long:"critical-heap" value-name:"PERCENT" default:"95" description:"critical if the JVM heap usage of a node is over or equal"`
+	WarningTrips  int64  `long:"warning-trips" value-name:"N" default:"1" description:"warning if the circuit breakers of a node have tripped the times or more since the last check"`
+	CriticalTrips *int64 `long:"critical-trips" value-name:"N" description:"critical if the circuit breakers of a node have tripped the times or more since the last check"`
+	StateDir      string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+type nodeStat struct {
+	Name string `json:"name"`
+	JVM  struct {
+		Mem struct {
+			HeapUsedPercent int64 `json:"heap_used_percent"`
+		} `json:"mem"`
+	} `json:"jvm"`
+	Breakers map[string]struct {
+		Tripped int64 `json:"tripped"`
+	} `json:"breakers"`
+}
+
+// nodesState is the tripped counters of the circuit breakers keyed by the node id and the breaker name.
+type nodesState map[string]map[string]int64
+
+func checkNodes(args []string) *checkers.Checker {
+	opts := nodesOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "nodes [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
+	}
+
+	var resp struct {
+		Nodes map[string]nodeStat `json:"nodes"`
+	}
+	err = opts.get("/_nodes/stats/jvm,breaker", &resp)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-elasticsearch"))
+	var last nodesState
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cur := nodesState{}
+	for id, n := range resp.Nodes {
+		cur[id] = map[string]int64{}
+		for name, b := range n.Breakers {
+			cur[id][name] = b.Tripped
+		}
+	}
+	if err := state.Save(stateFile, cur); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(resp.Nodes, last)
+}
+
+// evaluate checks the heap usage and the circuit breaker trips of each node.
+// A node which has nearly run out of heap, or whose breakers are tripping,
+// rejects requests with 429 Too Many Requests.
+// The trips are not checked if last is nil.
+func (opts *nodesOpts) evaluate(nodes map[string]nodeStat, last nodesState) *checkers.Checker {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return nodes[ids[i]].Name < nodes[ids[j]].Name })
+
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+	var msgs []string
+	for _, id := range ids {
+		n := nodes[id]
+		heap := n.JVM.Mem.HeapUsedPercent
+		switch {
+		case heap >= opts.CriticalHeap:
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("%s heap %d%%", n.Name, heap))
+		case heap >= opts.WarningHeap:
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("%s heap %d%%", n.Name, heap))
+		}
+
+		prev, ok := last[id]
+		if !ok {
+			continue
+		}
+		var trips int64
+		var tripped []string
+		for name, b := range n.Breakers {
+			d := b.Tripped - prev[name]
+			if d < 0 {
+				// the node has been restarted since the last check
+				d = b.Tripped
+			}
+			if d > 0 {
+				trips += d
+				tripped = append(tripped, name)
+			}
+		}
+		if trips == 0 {
+			continue
+		}
+		sort.Strings(tripped)
+		switch {
+		case opts.CriticalTrips != nil && trips >= *opts.CriticalTrips:
+			raise(checkers.CRITICAL)
+		case trips >= opts.WarningTrips:
+			raise(checkers.WARNING)
+		default:
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("%s breakers tripped %d times (%s)", n.Name, trips, strings.Join(tripped, ", ")))
+	}
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("%d nodes are healthy", len(nodes)))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func (opts *nodesOpts) stateFile(stateDir string) string {
+	return state.File(stateDir, "nodes", fmt.Sprintf("%s://%s:%d", opts.Scheme, opts.Host, opts.Port))
+}
@@ -0,0 +1,107 @@
+package checkelasticsearch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodesEvaluate(t *testing.T) {
+	var resp struct {
+		Nodes map[string]nodeStat `json:"nodes"`
+	}
+	err := json.Unmarshal([]byte(`{
+		"nodes": {
+			"aaa": {"name": "es-1", "jvm": {"mem": {"heap_used_percent": 40}}, "breakers": {"request": {"tripped": 0}, "parent": {"tripped": 3}}},
+			"bbb": {"name": "es-2", "jvm": {"mem": {"heap_used_percent": 88}}, "breakers": {"request": {"tripped": 5}, "parent": {"tripped": 7}}},
+			"ccc": {"name": "es-3", "jvm": {"mem": {"heap_used_percent": 60}}, "breakers": {"request": {"tripped": 1}}}
+		}
+	}`), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	three := int64(3)
+
+	tests := []struct {
+		opts nodesOpts
+		last nodesState
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: nodesOpts{WarningHeap: 90, CriticalHeap: 95, WarningTrips: 1},
+			last: nil,
+			want: checkers.OK,
+			msg:  "3 nodes are healthy",
+		},
+		{
+			opts: nodesOpts{WarningHeap: 85, CriticalHeap: 95, WarningTrips: 1},
+			last: nil,
+			want: checkers.WARNING,
+			msg:  "es-2 heap 88%",
+		},
+		{
+			opts: nodesOpts{WarningHeap: 80, CriticalHeap: 85, WarningTrips: 1},
+			last: nodesState{"aaa": {"request": 0, "parent": 3}, "bbb": {"request": 5, "parent": 7}},
+			want: checkers.CRITICAL,
+			msg:  "es-2 heap 88%",
+		},
+		{
+			opts: nodesOpts{WarningHeap: 90, CriticalHeap: 95, WarningTrips: 1, CriticalTrips: &three},
+			last: nodesState{"aaa": {"request": 0, "parent": 1}, "bbb": {"request": 4, "parent": 7}},
+			want: checkers.WARNING,
+			msg:  "es-1 breakers tripped 2 times (parent), es-2 breakers tripped 1 times (request)",
+		},
+		{
+			opts: nodesOpts{WarningHeap: 90, CriticalHeap: 95, WarningTrips: 1, CriticalTrips: &three},
+			last: nodesState{"aaa": {"request": 0, "parent": 3}, "bbb": {"request": 2, "parent": 6}},
+			want: checkers.CRITICAL,
+			msg:  "es-2 breakers tripped 4 times (parent, request)",
+		},
+		{
+			// es-3 has been restarted
+			opts: nodesOpts{WarningHeap: 90, CriticalHeap: 95, WarningTrips: 1},
+			last: nodesState{"aaa": {"request": 0, "parent": 3}, "bbb": {"request": 5, "parent": 7}, "ccc": {"request": 10}},
+			want: checkers.WARNING,
+			msg:  "es-3 breakers tripped 1 times (request)",
+		},
+		{
+			opts: nodesOpts{WarningHeap: 90, CriticalHeap: 95, WarningTrips: 5},
+			last: nodesState{"aaa": {"request": 0, "parent": 1}},
+			want: checkers.OK,
+			msg:  "3 nodes are healthy",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(resp.Nodes, tt.last)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestNodesState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-elasticsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := nodesOpts{esSetting: esSetting{Scheme: "http", Host: "localhost", Port: 9200}}
+	f := opts.stateFile(filepath.Join(dir, "state"))
+	var s nodesState
+	_, err = state.Load(f, &s)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	want := nodesState{"aaa": {"parent": 3}}
+	assert.NoError(t, state.Save(f, want))
+	_, err = state.Load(f, &s)
+	assert.NoError(t, err)
+	assert.Equal(t, want, s)
+}
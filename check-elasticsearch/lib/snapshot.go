@@ -0,0 +1,97 @@
+package checkelasticsearch
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type snapshotOpts struct {
+	esSetting
+	Repository string `short:"r" long:"repository" required:"true" description:"Snapshot repository name"`
+	Warning    int64  `short:"w" long:"warning" default:"24" description:"warning if the last successful snapshot is older than (hours)"`
+	Critical   int64  `short:"c" long:"critical" default:"48" description:"critical if the last successful snapshot is older than (hours)"`
+}
+
+type snapshotInfo struct {
+	Snapshot          string `json:"snapshot"`
+	State             string `json:"state"`
+	StartTimeInMillis int64  `json:"start_time_in_millis"`
+	EndTimeInMillis   int64  `json:"end_time_in_millis"`
+	Shards            struct {
+		Total      int64 `json:"total"`
+		Failed     int64 `json:"failed"`
+		Successful int64 `json:"successful"`
+	} `json:"shards"`
+}
+
+func (s *snapshotInfo) endTime() time.Time {
+	return time.Unix(0, s.EndTimeInMillis*int64(time.Millisecond))
+}
+
+func (s *snapshotInfo) succeeded() bool {
+	return s.State == "SUCCESS" && s.Shards.Failed == 0
+}
+
+func checkSnapshot(args []string) *checkers.Checker {
+	opts := snapshotOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "snapshot [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
+	}
+
+	var resp struct {
+		Snapshots []snapshotInfo `json:"snapshots"`
+	}
+	err = opts.get(fmt.Sprintf("/_snapshot/%s/_all", url.PathEscape(opts.Repository)), &resp)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(resp.Snapshots, time.Now())
+}
+
+// evaluate checks the age of the last successful snapshot, which has no failed shards.
+// It also warns if the last finished snapshot has failed, even if it is within the thresholds.
+func (opts *snapshotOpts) evaluate(snapshots []snapshotInfo, now time.Time) *checkers.Checker {
+	var lastSuccess, lastFinished *snapshotInfo
+	for i, s := range snapshots {
+		if s.State == "IN_PROGRESS" {
+			continue
+		}
+		if lastFinished == nil || s.EndTimeInMillis > lastFinished.EndTimeInMillis {
+			lastFinished = &snapshots[i]
+		}
+		if s.succeeded() && (lastSuccess == nil || s.EndTimeInMillis > lastSuccess.EndTimeInMillis) {
+			lastSuccess = &snapshots[i]
+		}
+	}
+	if lastSuccess == nil {
+		return checkers.Critical(fmt.Sprintf("no successful snapshots in the repository %s", opts.Repository))
+	}
+
+	age := now.Sub(lastSuccess.endTime())
+	msg := fmt.Sprintf("last successful snapshot %s finished %.1f hours ago", lastSuccess.Snapshot, age.Hours())
+	checkSt := checkers.OK
+	if age > time.Duration(opts.Critical)*time.Hour {
+		checkSt = checkers.CRITICAL
+	} else if age > time.Duration(opts.Warning)*time.Hour {
+		checkSt = checkers.WARNING
+	}
+	if lastFinished != lastSuccess {
+		msg += fmt.Sprintf(", but the last snapshot %s is %s with %d/%d failed shards",
+			lastFinished.Snapshot, lastFinished.State, lastFinished.Shards.Failed, lastFinished.Shards.Total)
+		if checkSt == checkers.OK {
+			checkSt = checkers.WARNING
+		}
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
@@ -0,0 +1,67 @@
+package checkelasticsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotEvaluate(t *testing.T) {
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	opts := &snapshotOpts{Repository: "backup", Warning: 24, Critical: 48}
+	snapshot := func(name, state string, hoursAgo, failed int64) snapshotInfo {
+		s := snapshotInfo{Snapshot: name, State: state}
+		s.EndTimeInMillis = now.Add(-time.Duration(hoursAgo)*time.Hour).UnixNano() / int64(time.Millisecond)
+		s.Shards.Total = 5
+		s.Shards.Failed = failed
+		s.Shards.Successful = 5 - failed
+		return s
+	}
+
+	tests := []struct {
+		snapshots []snapshotInfo
+		want      checkers.Status
+		msg       string
+	}{
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "SUCCESS", 30, 0), snapshot("daily-2", "SUCCESS", 6, 0)},
+			want:      checkers.OK,
+			msg:       "last successful snapshot daily-2 finished 6.0 hours ago",
+		},
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "SUCCESS", 30, 0)},
+			want:      checkers.WARNING,
+		},
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "SUCCESS", 60, 0)},
+			want:      checkers.CRITICAL,
+		},
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "SUCCESS", 20, 0), snapshot("daily-2", "PARTIAL", 2, 2)},
+			want:      checkers.WARNING,
+			msg:       "last successful snapshot daily-1 finished 20.0 hours ago, but the last snapshot daily-2 is PARTIAL with 2/5 failed shards",
+		},
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "SUCCESS", 20, 0), snapshot("daily-2", "IN_PROGRESS", 0, 0)},
+			want:      checkers.OK,
+		},
+		{
+			snapshots: []snapshotInfo{snapshot("daily-1", "FAILED", 2, 5)},
+			want:      checkers.CRITICAL,
+			msg:       "no successful snapshots in the repository backup",
+		},
+		{
+			snapshots: nil,
+			want:      checkers.CRITICAL,
+		},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluate(tt.snapshots, now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		if tt.msg != "" {
+			assert.Equal(t, tt.msg, ckr.Message)
+		}
+	}
+}
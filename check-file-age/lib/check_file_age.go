@@ -3,17 +3,25 @@ package checkfileage
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "FileAge"
-	ckr.Exit()
+	return ckr
 }
 
 type monitor struct {
@@ -58,19 +66,37 @@ func newMonitor(warningAge, warningSize, criticalAge, criticalSize int64) *monit
 	}
 }
 
-var opts struct {
+type fileAgeOpts struct {
 	File          string `short:"f" long:"file" required:"true" description:"monitor file name"`
 	WarningAge    int64  `short:"w" long:"warning-age" default:"240" description:"warning if more old than"`
 	WarningSize   int64  `short:"W" long:"warning-size" description:"warning if file size less than"`
 	CriticalAge   int64  `short:"c" long:"critical-age" default:"600" description:"critical if more old than"`
 	CriticalSize  int64  `short:"C" long:"critical-size" default:"0" description:"critical if file size less than"`
 	IgnoreMissing bool   `short:"i" long:"ignore-missing" description:"skip alert if file doesn't exist"`
+	Recursive     bool   `short:"r" long:"recursive" description:"monitor the files under the directory recursively"`
+	Newest        bool   `long:"newest" description:"check the newest file with --recursive (default)"`
+	Oldest        bool   `long:"oldest" description:"check the oldest file with --recursive"`
+	MinCount      int    `long:"min-count" default:"1" description:"critical if fewer files than this exist with --recursive. With --newest, the thresholds are checked against the N-th newest file"`
+	Manifest      string `long:"manifest" value-name:"FILE" description:"critical unless the sha256 checksums of the monitored files match the manifest written by sha256sum"`
+	selftest.SelfTestOpts
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &fileAgeOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.Newest && opts.Oldest {
+		return checkers.Unknown("--newest and --oldest cannot be specified at the same time")
+	}
+	if opts.SelfTest {
+		// The file itself may not exist yet with --ignore-missing.
+		checks := []selftest.Check{selftest.Exists(filepath.Dir(opts.File))}
+		if opts.Manifest != "" {
+			checks = append(checks, selftest.Readable(opts.Manifest))
+		}
+		return selftest.Run(checks...)
 	}
 
 	stat, err := os.Stat(opts.File)
@@ -81,13 +107,31 @@ func run(args []string) *checkers.Checker {
 		return checkers.Unknown(err.Error())
 	}
 
+	file := opts.File
+	mtime := stat.ModTime()
+	size := stat.Size()
+	var suffix string
+	if opts.Recursive {
+		if !stat.IsDir() {
+			return checkers.Unknown(fmt.Sprintf("%s is not a directory", opts.File))
+		}
+		files, err := collectFiles(opts.File)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if len(files) == 0 || len(files) < opts.MinCount {
+			return checkers.Critical(fmt.Sprintf("%d files found under %s, fewer than %d.", len(files), opts.File, opts.MinCount))
+		}
+		f, nth := selectFile(files, opts.Oldest, opts.MinCount)
+		file, mtime, size = f.path, f.mtime, f.size
+		suffix = fmt.Sprintf(" (%s of %d files under %s)", nth, len(files), opts.File)
+	}
+
 	monitor := newMonitor(opts.WarningAge, opts.WarningSize, opts.CriticalAge, opts.CriticalSize)
 
 	result := checkers.OK
 
-	mtime := stat.ModTime()
 	age := time.Now().Unix() - mtime.Unix()
-	size := stat.Size()
 
 	if monitor.CheckWarning(age, size) {
 		result = checkers.WARNING
@@ -97,6 +141,56 @@ func run(args []string) *checkers.Checker {
 		result = checkers.CRITICAL
 	}
 
-	msg := fmt.Sprintf("%s is %d seconds old (%02d:%02d:%02d) and %d bytes.", opts.File, age, mtime.Hour(), mtime.Minute(), mtime.Second(), size)
+	msg := fmt.Sprintf("%s is %d seconds old (%02d:%02d:%02d) and %d bytes.%s", file, age, mtime.Hour(), mtime.Minute(), mtime.Second(), size, suffix)
+	if opts.Manifest != "" {
+		entries, err := parseManifest(opts.Manifest)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		st, manifestMsg, err := verifyManifest(entries, opts.File, opts.Recursive)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if st > result {
+			result = st
+		}
+		msg += " " + manifestMsg
+	}
 	return checkers.NewChecker(result, msg)
 }
+
+type fileInfo struct {
+	path  string
+	mtime time.Time
+	size  int64
+}
+
+// collectFiles returns the regular files under the directory recursively.
+func collectFiles(dir string) ([]fileInfo, error) {
+	var files []fileInfo
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, fileInfo{path: path, mtime: info.ModTime(), size: info.Size()})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// selectFile returns the oldest file, or the n-th newest file, and its description.
+// files must have n or more files.
+func selectFile(files []fileInfo, oldest bool, n int) (fileInfo, string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].mtime.After(files[j].mtime)
+	})
+	if oldest {
+		return files[len(files)-1], "oldest"
+	}
+	if n <= 1 {
+		return files[0], "newest"
+	}
+	return files[n-1], fmt.Sprintf("newest #%d", n)
+}
@@ -0,0 +1,173 @@
+package checkfileage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectFile(t *testing.T) {
+	now := time.Now()
+	files := []fileInfo{
+		{path: "b", mtime: now.Add(-2 * time.Hour)},
+		{path: "a", mtime: now.Add(-1 * time.Hour)},
+		{path: "d", mtime: now.Add(-4 * time.Hour)},
+		{path: "c", mtime: now.Add(-3 * time.Hour)},
+	}
+
+	f, nth := selectFile(files, false, 1)
+	assert.Equal(t, "a", f.path)
+	assert.Equal(t, "newest", nth)
+
+	f, nth = selectFile(files, false, 3)
+	assert.Equal(t, "c", f.path)
+	assert.Equal(t, "newest #3", nth)
+
+	f, nth = selectFile(files, true, 3)
+	assert.Equal(t, "d", f.path)
+	assert.Equal(t, "oldest", nth)
+}
+
+func TestRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-file-age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"daily/1.tar", "daily/2.tar", "daily/old/3.tar"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("backup"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want checkers.Status
+	}{
+		{args: []string{"-f", dir, "-r", "-w", "600", "-c", "1200"}, want: checkers.OK},
+		{args: []string{"-f", dir, "-r", "--min-count", "2", "-w", "600", "-c", "7200"}, want: checkers.WARNING},
+		{args: []string{"-f", dir, "-r", "--min-count", "3", "-w", "600", "-c", "3600"}, want: checkers.CRITICAL},
+		{args: []string{"-f", dir, "-r", "--min-count", "4", "-w", "86400", "-c", "86400"}, want: checkers.CRITICAL},
+		{args: []string{"-f", dir, "-r", "--oldest", "-w", "3600", "-c", "86400"}, want: checkers.WARNING},
+		{args: []string{"-f", dir, "-r", "--oldest", "--newest"}, want: checkers.UNKNOWN},
+		{args: []string{"-f", filepath.Join(dir, "daily/1.tar"), "-r"}, want: checkers.UNKNOWN},
+	}
+	for _, tt := range tests {
+		ckr := run(tt.args)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-file-age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"etc/app.conf", "etc/hosts.conf", "bin/app"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := filepath.Join(dir, "sha256sums.txt")
+	err = ioutil.WriteFile(manifest, []byte(
+		"# generated by sha256sum\n"+
+			"6d0d4ae6b4a2d1c6bb84bbe2b6e7a1cb4a0f8d1c3a1d26c76bd8a1c25e4a7a02  etc/hosts.conf\n"+
+			"a5f1e2d1b0b5f4a3c7c7dbd4ce8ba1cc2bb0a3a7b0a9e4b6c91e3b9e4fc0a0e1 *bin/app\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := parseManifest(manifest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []manifestEntry{
+		{path: filepath.Join(dir, "etc", "hosts.conf"), sum: "6d0d4ae6b4a2d1c6bb84bbe2b6e7a1cb4a0f8d1c3a1d26c76bd8a1c25e4a7a02"},
+		{path: filepath.Join(dir, "bin", "app"), sum: "a5f1e2d1b0b5f4a3c7c7dbd4ce8ba1cc2bb0a3a7b0a9e4b6c91e3b9e4fc0a0e1"},
+	}, entries)
+
+	sum := func(name string) string {
+		s, err := sha256File(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	err = ioutil.WriteFile(manifest, []byte(
+		sum("etc/app.conf")+"  etc/app.conf\n"+
+			sum("etc/app.conf")+"  etc/hosts.conf\n"+
+			sum("bin/app")+" *bin/app\n"+
+			sum("bin/app")+"  etc/removed.conf\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want checkers.Status
+		msg  string
+	}{
+		{
+			args: []string{"-f", filepath.Join(dir, "etc/app.conf"), "--manifest", manifest},
+			want: checkers.OK,
+			msg:  "The checksums of 1 files match the manifest.",
+		},
+		{
+			args: []string{"-f", filepath.Join(dir, "etc/hosts.conf"), "--manifest", manifest},
+			want: checkers.CRITICAL,
+			msg:  "1 of 1 files don't match the manifest (checksum mismatch: " + filepath.Join(dir, "etc", "hosts.conf") + ").",
+		},
+		{
+			args: []string{"-f", filepath.Join(dir, "etc"), "-r", "--manifest", manifest},
+			want: checkers.CRITICAL,
+			msg:  "2 of 3 files don't match the manifest (checksum mismatch: " + filepath.Join(dir, "etc", "hosts.conf") + "; missing: " + filepath.Join(dir, "etc", "removed.conf") + ").",
+		},
+		{
+			args: []string{"-f", filepath.Join(dir, "bin"), "-r", "--manifest", manifest},
+			want: checkers.OK,
+			msg:  "The checksums of 1 files match the manifest.",
+		},
+		{
+			args: []string{"-f", manifest, "--manifest", manifest},
+			want: checkers.UNKNOWN,
+			msg:  "no entries for " + manifest + " found in the manifest",
+		},
+		{
+			args: []string{"-f", filepath.Join(dir, "etc/app.conf"), "--manifest", filepath.Join(dir, "missing.txt")},
+			want: checkers.UNKNOWN,
+		},
+	}
+	for _, tt := range tests {
+		ckr := run(tt.args)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.True(t, strings.HasSuffix(ckr.Message, tt.msg), ckr.Message)
+	}
+
+	err = ioutil.WriteFile(manifest, []byte("0123  etc/app.conf\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parseManifest(manifest)
+	assert.EqualError(t, err, manifest+":1: invalid sha256 checksum")
+}
@@ -0,0 +1,105 @@
+package checkfileage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// manifestEntry is a line of a manifest in the format of sha256sum.
+type manifestEntry struct {
+	path string
+	sum  string
+}
+
+// parseManifest reads the manifest written by sha256sum, whose relative paths are resolved against the directory of it.
+func parseManifest(file string) ([]manifestEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// "SUM  PATH" in the text mode, or "SUM *PATH" in the binary mode
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid line", file, n)
+		}
+		sum := strings.ToLower(line[:i])
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid sha256 checksum", file, n)
+		}
+		path := strings.TrimPrefix(strings.TrimLeft(line[i:], " \t"), "*")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		entries = append(entries, manifestEntry{path: filepath.Clean(path), sum: sum})
+	}
+	return entries, s.Err()
+}
+
+// verifyManifest verifies the checksums of the entries of the monitored file, or the files under the directory with recursive.
+// The entries whose files are modified or missing are CRITICAL.
+func verifyManifest(entries []manifestEntry, target string, recursive bool) (checkers.Status, string, error) {
+	target = filepath.Clean(target)
+	var count int
+	var modified, missing []string
+	for _, e := range entries {
+		if e.path != target && !(recursive && strings.HasPrefix(e.path, target+string(filepath.Separator))) {
+			continue
+		}
+		count++
+		sum, err := sha256File(e.path)
+		if os.IsNotExist(err) {
+			missing = append(missing, e.path)
+			continue
+		}
+		if err != nil {
+			return checkers.UNKNOWN, "", err
+		}
+		if sum != e.sum {
+			modified = append(modified, e.path)
+		}
+	}
+	if count == 0 {
+		return checkers.UNKNOWN, "", fmt.Errorf("no entries for %s found in the manifest", target)
+	}
+	if len(modified) == 0 && len(missing) == 0 {
+		return checkers.OK, fmt.Sprintf("The checksums of %d files match the manifest.", count), nil
+	}
+	var msgs []string
+	if len(modified) > 0 {
+		msgs = append(msgs, fmt.Sprintf("checksum mismatch: %s", strings.Join(modified, ", ")))
+	}
+	if len(missing) > 0 {
+		msgs = append(msgs, fmt.Sprintf("missing: %s", strings.Join(missing, ", ")))
+	}
+	return checkers.CRITICAL, fmt.Sprintf("%d of %d files don't match the manifest (%s).", len(modified)+len(missing), count, strings.Join(msgs, "; ")), nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -11,20 +11,27 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "FileSize"
-	ckr.Exit()
+	return ckr
 }
 
-var opts struct {
+type fileSizeOpts struct {
 	Base  string `short:"b" long:"base" required:"true" description:"base directory"`
 	Warn  string `short:"w" long:"warning" default:"1K" description:"warning if the size is over"`
 	Crit  string `short:"c" long:"critical" default:"1K" description:"critical if the size is over"`
 	Depth int    `short:"d" long:"depth" default:"1" description:"max depth of the directory from base directory"`
+	selftest.SelfTestOpts
 }
 
 var sizeReg = regexp.MustCompile(`^(\d+\.?\d*)(k|K|m|M|g|G|t|T)?$`)
@@ -84,9 +91,10 @@ func listFiles(base string, depth int) ([]string, error) {
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &fileSizeOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
 	ws, err := sizeValue(opts.Warn)
@@ -98,6 +106,9 @@ func run(args []string) *checkers.Checker {
 	if err != nil {
 		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
 	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Exists(opts.Base))
+	}
 
 	var stat os.FileInfo
 	var size int64
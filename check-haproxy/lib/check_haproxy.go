@@ -0,0 +1,309 @@
+package checkhaproxy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type haproxyOpts struct {
+	Socket        string `short:"s" long:"socket" value-name:"PATH" description:"Path to the stats socket"`
+	URL           string `short:"u" long:"url" description:"URL of the stats page, such as http://localhost:8404/stats"`
+	User          string `long:"user" description:"Username for basic authentication of the stats page"`
+	Password      string `long:"password" description:"Password for basic authentication of the stats page" env:"HAPROXY_PASSWORD"`
+	Timeout       int    `short:"t" long:"timeout" default:"10" description:"Seconds before the request times out"`
+	Backend       string `short:"b" long:"backend" value-name:"REGEXP" description:"Check only backends whose name matches the pattern"`
+	WarningUp     int    `long:"warning-up" value-name:"N" description:"warning if the number of UP servers in a backend is less than"`
+	CriticalUp    int    `long:"critical-up" value-name:"N" default:"1" description:"critical if the number of UP servers in a backend is less than"`
+	IgnoreMaint   string `long:"ignore-maint" value-name:"REGEXP" description:"Don't alert the servers in MAINT whose BACKEND/SERVER name matches the pattern"`
+	WarningQueue  *int64 `long:"warning-queue" value-name:"N" description:"warning if the number of queued requests in a backend is over"`
+	CriticalQueue *int64 `long:"critical-queue" value-name:"N" description:"critical if the number of queued requests in a backend is over"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// stat is a row of the stats in CSV, which is a frontend, a backend or a server.
+type stat struct {
+	proxy  string // pxname
+	name   string // svname; FRONTEND, BACKEND or the name of the server
+	typ    string // 0: frontend, 1: backend, 2: server, 3: listener
+	status string
+	qcur   int64
+}
+
+// backendStat is the stats of a backend and its servers.
+type backendStat struct {
+	name    string
+	qcur    int64
+	servers []stat
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "HAProxy"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := haproxyOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if (opts.Socket == "") == (opts.URL == "") {
+		return checkers.Unknown("either --socket or --url is required")
+	}
+	var backendRe, maintRe *regexp.Regexp
+	if opts.Backend != "" {
+		if backendRe, err = regexp.Compile(opts.Backend); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	if opts.IgnoreMaint != "" {
+		if maintRe, err = regexp.Compile(opts.IgnoreMaint); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	if opts.SelfTest {
+		if opts.Socket != "" {
+			return selftest.Run(selftest.Exists(opts.Socket))
+		}
+		return selftest.Run(selftest.ResolveURL(opts.URL))
+	}
+	if opts.Password, err = opts.ResolvePassword(opts.Password); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	var r io.ReadCloser
+	if opts.Socket != "" {
+		r, err = opts.readSocket()
+	} else {
+		r, err = opts.readURL()
+	}
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	defer r.Close()
+	stats, err := parseStats(r)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	backends := groupBackends(stats, backendRe)
+	if len(backends) == 0 {
+		return checkers.Unknown("no backends found")
+	}
+	return opts.evaluate(backends, maintRe)
+}
+
+// readSocket sends "show stat" to the stats socket.
+func (opts *haproxyOpts) readSocket() (io.ReadCloser, error) {
+	end := debuglog.Trace("haproxy: show stat to %s", opts.Socket)
+	conn, err := net.DialTimeout("unix", opts.Socket, time.Duration(opts.Timeout)*time.Second)
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(time.Duration(opts.Timeout) * time.Second))
+	if _, err := io.WriteString(conn, "show stat\n"); err != nil {
+		end(err)
+		conn.Close()
+		return nil, err
+	}
+	end(nil)
+	return conn, nil
+}
+
+// readURL requests the stats in CSV, which is served at the stats URI followed by ";csv".
+func (opts *haproxyOpts) readURL() (io.ReadCloser, error) {
+	u := opts.URL
+	if !strings.HasSuffix(u, ";csv") {
+		u += ";csv"
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "check-haproxy")
+	if opts.User != "" {
+		req.SetBasicAuth(opts.User, opts.Password)
+	}
+	client := &http.Client{
+		Transport: debuglog.Transport(nil),
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed: http status code %d from %s", resp.StatusCode, u)
+	}
+	return resp.Body, nil
+}
+
+// parseStats parses the stats in CSV, which begins with a header line such as "# pxname,svname,qcur,...".
+func parseStats(r io.Reader) ([]stat, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the stats: %s", err)
+	}
+	if len(header) == 0 || !strings.HasPrefix(header[0], "# ") {
+		return nil, fmt.Errorf("unexpected stats header: %s", strings.Join(header, ","))
+	}
+	header[0] = strings.TrimPrefix(header[0], "# ")
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+	for _, h := range []string{"pxname", "svname", "qcur", "status", "type"} {
+		if _, ok := index[h]; !ok {
+			return nil, fmt.Errorf("no %s in the stats", h)
+		}
+	}
+
+	var stats []stat
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the stats: %s", err)
+		}
+		if len(rec) < len(header) {
+			continue
+		}
+		s := stat{
+			proxy:  rec[index["pxname"]],
+			name:   rec[index["svname"]],
+			typ:    rec[index["type"]],
+			status: rec[index["status"]],
+		}
+		// qcur is empty for frontends
+		s.qcur, _ = strconv.ParseInt(rec[index["qcur"]], 10, 64)
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// groupBackends groups the servers by the backends which have one or more servers.
+func groupBackends(stats []stat, re *regexp.Regexp) []*backendStat {
+	m := make(map[string]*backendStat)
+	var names []string
+	get := func(name string) *backendStat {
+		b, ok := m[name]
+		if !ok {
+			b = &backendStat{name: name}
+			m[name] = b
+			names = append(names, name)
+		}
+		return b
+	}
+	for _, s := range stats {
+		if re != nil && !re.MatchString(s.proxy) {
+			continue
+		}
+		switch s.typ {
+		case "1":
+			get(s.proxy).qcur = s.qcur
+		case "2":
+			b := get(s.proxy)
+			b.servers = append(b.servers, s)
+		}
+	}
+	sort.Strings(names)
+	var backends []*backendStat
+	for _, name := range names {
+		if len(m[name].servers) > 0 {
+			backends = append(backends, m[name])
+		}
+	}
+	return backends
+}
+
+// isUp returns true if the server accepts new requests.
+// A server without health checks is "no check", and a server going down is such as "UP 1/3".
+func isUp(status string) bool {
+	return strings.HasPrefix(status, "UP") || status == "no check"
+}
+
+// isMaint returns true if the server is in maintenance, such as "MAINT" or "MAINT (via backend/server)".
+func isMaint(status string) bool {
+	return strings.HasPrefix(status, "MAINT")
+}
+
+func (opts *haproxyOpts) evaluate(backends []*backendStat, maintRe *regexp.Regexp) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(st checkers.Status, msg string) {
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+	}
+
+	var servers, up int
+	for _, b := range backends {
+		n := 0
+		var maint []string
+		for _, s := range b.servers {
+			if isUp(s.status) {
+				n++
+			}
+			if isMaint(s.status) && (maintRe == nil || !maintRe.MatchString(b.name+"/"+s.name)) {
+				maint = append(maint, s.name)
+			}
+		}
+		servers += len(b.servers)
+		up += n
+
+		switch {
+		case n < opts.CriticalUp:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s has %d/%d UP servers", b.name, n, len(b.servers)))
+		case n < opts.WarningUp:
+			raise(checkers.WARNING, fmt.Sprintf("%s has %d/%d UP servers", b.name, n, len(b.servers)))
+		}
+		if len(maint) > 0 {
+			raise(checkers.WARNING, fmt.Sprintf("%s has servers in MAINT (%s)", b.name, strings.Join(maint, ", ")))
+		}
+		switch {
+		case opts.CriticalQueue != nil && b.qcur > *opts.CriticalQueue:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s has %d queued requests > %d", b.name, b.qcur, *opts.CriticalQueue))
+		case opts.WarningQueue != nil && b.qcur > *opts.WarningQueue:
+			raise(checkers.WARNING, fmt.Sprintf("%s has %d queued requests > %d", b.name, b.qcur, *opts.WarningQueue))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("%d backends are ok, %d/%d servers are UP", len(backends), up, servers))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,170 @@
+package checkhaproxy
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+const statsCSV = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,
+http-in,FRONTEND,,,10,20,3000,500,0,0,0,0,0,,,,,OPEN,,,,,,,,,1,2,0,,,,0,
+web,web1,0,0,3,5,,200,0,0,,0,,0,0,0,0,UP,1,1,0,0,0,100,0,,1,3,1,,200,,2,
+web,web2,0,0,2,4,,150,0,0,,0,,0,0,0,0,UP 1/3,1,1,0,0,0,100,0,,1,3,2,,150,,2,
+web,web3,0,0,0,0,,0,0,0,,0,,0,0,0,0,MAINT,1,1,0,0,0,100,0,,1,3,3,,0,,2,
+web,BACKEND,4,10,5,9,300,350,0,0,0,,,0,0,0,0,UP,2,2,0,,0,100,0,,1,3,0,,350,,1,
+api,api1,0,0,0,0,,10,0,0,,0,,0,0,0,0,DOWN,1,1,0,3,1,10,60,,1,4,1,,10,,2,
+api,api2,0,0,0,0,,10,0,0,,0,,0,0,0,0,no check,1,1,0,0,0,10,0,,1,4,2,,10,,2,
+api,BACKEND,0,0,0,0,300,20,0,0,0,,,0,0,0,0,UP,1,1,0,,0,10,0,,1,4,0,,20,,1,
+stats,BACKEND,0,0,0,0,300,0,0,0,0,,,0,0,0,0,UP,0,0,0,,0,100,0,,1,5,0,,0,,1,
+
+`
+
+func TestParseStats(t *testing.T) {
+	stats, err := parseStats(strings.NewReader(statsCSV))
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(stats))
+	assert.Equal(t, stat{proxy: "web", name: "web2", typ: "2", status: "UP 1/3"}, stats[2])
+	assert.Equal(t, stat{proxy: "web", name: "BACKEND", typ: "1", status: "UP", qcur: 4}, stats[4])
+
+	_, err = parseStats(strings.NewReader("Unknown command\n"))
+	assert.NotNil(t, err)
+}
+
+func TestGroupBackends(t *testing.T) {
+	stats, _ := parseStats(strings.NewReader(statsCSV))
+	backends := groupBackends(stats, nil)
+	if assert.Equal(t, 2, len(backends)) {
+		assert.Equal(t, "api", backends[0].name)
+		assert.Equal(t, 2, len(backends[0].servers))
+		assert.Equal(t, "web", backends[1].name)
+		assert.Equal(t, int64(4), backends[1].qcur)
+		assert.Equal(t, 3, len(backends[1].servers))
+	}
+
+	backends = groupBackends(stats, regexp.MustCompile("^we"))
+	assert.Equal(t, 1, len(backends))
+}
+
+func TestEvaluate(t *testing.T) {
+	stats, _ := parseStats(strings.NewReader(statsCSV))
+	backends := groupBackends(stats, nil)
+	two, three := int64(2), int64(3)
+
+	tests := []struct {
+		opts    haproxyOpts
+		maintRe *regexp.Regexp
+		want    checkers.Status
+		msg     string
+	}{
+		{
+			opts:    haproxyOpts{CriticalUp: 1},
+			maintRe: regexp.MustCompile("^web/web3$"),
+			want:    checkers.OK,
+			msg:     "2 backends are ok, 3/5 servers are UP",
+		},
+		{
+			opts: haproxyOpts{CriticalUp: 1},
+			want: checkers.WARNING,
+			msg:  "web has servers in MAINT (web3)",
+		},
+		{
+			opts:    haproxyOpts{CriticalUp: 1, WarningUp: 3},
+			maintRe: regexp.MustCompile("web3"),
+			want:    checkers.WARNING,
+			msg:     "api has 1/2 UP servers, web has 2/3 UP servers",
+		},
+		{
+			opts:    haproxyOpts{CriticalUp: 2},
+			maintRe: regexp.MustCompile("web3"),
+			want:    checkers.CRITICAL,
+			msg:     "api has 1/2 UP servers",
+		},
+		{
+			opts:    haproxyOpts{CriticalUp: 1, WarningQueue: &two, CriticalQueue: &three},
+			maintRe: regexp.MustCompile("web3"),
+			want:    checkers.CRITICAL,
+			msg:     "web has 4 queued requests > 3",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(backends, tt.maintRe)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestRunURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/stats;csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, statsCSV)
+	}))
+	defer ts.Close()
+
+	ckr := run([]string{"-u", ts.URL + "/stats", "--user", "admin", "--password", "secret", "--ignore-maint", "web3"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+
+	ckr = run([]string{"-u", ts.URL + "/stats;csv", "--user", "admin", "--password", "secret", "-b", "^api$", "--critical-up", "2"})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+
+	ckr = run([]string{"-u", ts.URL + "/stats", "--user", "admin", "-b", "^api$"})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+
+	ckr = run([]string{"-u", ts.URL + "/stats", "--user", "admin", "--password", "secret", "-b", "^none$"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+}
+
+func TestRunSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-haproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "stats.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			cmd, _ := bufio.NewReader(conn).ReadString('\n')
+			if cmd == "show stat\n" {
+				io.WriteString(conn, statsCSV)
+			} else {
+				io.WriteString(conn, "Unknown command.\n")
+			}
+			conn.Close()
+		}
+	}()
+
+	ckr := run([]string{"-s", sock})
+	assert.Equal(t, checkers.WARNING, ckr.Status, ckr.Message)
+	assert.Equal(t, "web has servers in MAINT (web3)", ckr.Message)
+
+	ckr = run([]string{"-s", sock, "-u", "http://localhost/stats"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+}
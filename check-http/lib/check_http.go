@@ -4,27 +4,40 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/textproto"
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
 )
 
 // XXX more options
 type checkHTTPOpts struct {
-	URL                string   `short:"u" long:"url" required:"true" description:"A URL to connect to"`
+	URL                string   `short:"u" long:"url" description:"A URL to connect to"`
 	Statuses           []string `short:"s" long:"status" description:"mapping of HTTP status"`
 	NoCheckCertificate bool     `long:"no-check-certificate" description:"Do not check certificate"`
 	SourceIP           string   `short:"i" long:"source-ip" description:"source IP address"`
@@ -42,13 +55,30 @@ type checkHTTPOpts struct {
 	CertFile           string   `long:"cert-file" description:"A Cert file to use for client authentication"`
 	KeyFile            string   `long:"key-file" description:"A Key file to use for client authentication"`
 	CaFile             string   `long:"ca-file" description:"A CA Cert file to use for client authentication"`
+	ExpectSHA256       string   `long:"expect-sha256" value-name:"HASH" description:"Check the SHA-256 hash of the content is HASH"`
+	Baseline           bool     `long:"baseline" description:"Check the SHA-256 hash of the content is the same as the first-seen one kept in the state dir"`
+	StateDir           string   `long:"state-dir" value-name:"DIR" description:"Dir to keep the baseline hashes under"`
+	RequireProtocol    string   `long:"require-protocol" choice:"h2" choice:"h3" description:"Check the negotiated protocol is HTTP/2 or later (h2), or HTTP/3 is advertised by Alt-Svc (h3)"`
+	Perfdata           bool     `long:"perfdata" description:"Append the timings of DNS lookup, connection, TLS handshake and the first byte as performance data"`
+	ExpectStatuses     []string `long:"expect-status" value-name:"CODE[,CODE...]" description:"OK only if the status is one of CODEs, otherwise CRITICAL"`
+	FailRegexp         string   `long:"fail-if-body-matches" value-name:"REGEX" description:"CRITICAL if the content matches REGEX"`
+	WarningTime        *float64 `long:"warning-time" value-name:"SECONDS" description:"WARNING if the response time is over SECONDS"`
+	CriticalTime       *float64 `long:"critical-time" value-name:"SECONDS" description:"CRITICAL if the response time is over SECONDS"`
+	Probes             int      `long:"probes" value-name:"N" default:"1" description:"Send N requests sequentially and check the response time by --probe-stat of them"`
+	ProbeStat          string   `long:"probe-stat" choice:"max" choice:"p95" default:"max" description:"Statistic of the response times of --probes to check"`
+	UnixSock           string   `long:"unix-sock" value-name:"PATH" description:"Connect to the unix socket instead of the host of the URL. PATH beginning with @ is an abstract socket"`
+	Path               string   `long:"path" value-name:"PATH" description:"Path to request with --unix-sock instead of --url"`
+	URLFile            string   `long:"url-file" value-name:"FILE" description:"Check the URLs listed in FILE, a URL per line or a sitemap, instead of --url"`
+	MaxFailures        int      `long:"max-failures" value-name:"N" default:"0" description:"CRITICAL if more than N URLs of --url-file fail, otherwise WARNING if any fails"`
+	Concurrency        int      `long:"concurrency" value-name:"N" default:"4" description:"Number of the URLs of --url-file to check at the same time"`
+	netutil.AddressFamilyOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := Run(os.Args[1:])
-	ckr.Name = "HTTP"
-	ckr.Exit()
+	Run(os.Args[1:]).Exit()
 }
 
 type statusRange struct {
@@ -146,6 +176,22 @@ func parseStatusRanges(opts *checkHTTPOpts) ([]statusRange, error) {
 		}
 		statuses = append(statuses, r)
 	}
+
+	// --expect-status is a shorthand of CODE=ok for each code and CRITICAL for the others
+	var expected int
+	for _, v := range opts.ExpectStatuses {
+		for _, c := range strings.Split(v, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(c))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid expected status: %s", v)
+			}
+			statuses = append(statuses, statusRange{min: code, max: code, checkSt: checkers.OK})
+			expected++
+		}
+	}
+	if expected > 0 {
+		statuses = append(statuses, statusRange{min: 0, max: 999, checkSt: checkers.CRITICAL})
+	}
 	return statuses, nil
 }
 
@@ -206,18 +252,52 @@ func parseProxy(opts *checkHTTPOpts) (*url.URL, error) {
 	return u, nil
 }
 
-// Run do external monitoring via HTTP
+// Run runs the plugin with args, which exclude the program name, and returns the result
 func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "HTTP"
+	return ckr
+}
+
+// run do external monitoring via HTTP
+func run(args []string) *checkers.Checker {
 	opts := checkHTTPOpts{}
 	_, err := flags.ParseArgs(&opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	opts.DebugOpts.Enable()
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return checkers.Unknown(err.Error())
 	}
 
 	statusRanges, err := parseStatusRanges(&opts)
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	if opts.ExpectSHA256 != "" && opts.Baseline {
+		return checkers.Unknown("--expect-sha256 and --baseline cannot be specified at the same time")
+	}
+	if opts.Probes < 1 {
+		return checkers.Unknown("--probes must be 1 or more")
+	}
+	targets := []string{opts.URL}
+	if opts.URLFile != "" {
+		if opts.URL != "" || opts.UnixSock != "" || opts.Path != "" {
+			return checkers.Unknown("--url-file cannot be specified with --url, --unix-sock or --path")
+		}
+		if opts.Concurrency < 1 {
+			return checkers.Unknown("--concurrency must be 1 or more")
+		}
+		if targets, err = readURLFile(opts.URLFile); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	} else if err := opts.validateUnixSock(); err != nil {
+		return checkers.Unknown(err.Error())
+	} else {
+		targets[0] = opts.URL
+	}
 
 	// Setup HTTPS client
 	tlsConfig := &tls.Config{
@@ -249,6 +329,8 @@ func Run(args []string) *checkers.Checker {
 	tr := &http.Transport{
 		TLSClientConfig: tlsConfig,
 		Proxy:           http.ProxyFromEnvironment,
+		// HTTP/2 is disabled by default with the custom TLSClientConfig
+		ForceAttemptHTTP2: opts.RequireProtocol != "",
 	}
 	// same as http.Transport's default dialer
 	dialer := &net.Dialer{
@@ -279,8 +361,20 @@ func Run(args []string) *checkers.Checker {
 		}
 		tr.DialContext = newReplacableDial(dialer, resolves)
 	}
+	if opts.IPv4 || opts.IPv6 {
+		if tr.DialContext == nil {
+			tr.DialContext = dialer.DialContext
+		}
+		tr.DialContext = opts.AddressFamilyOpts.DialContext(tr.DialContext)
+	}
+	if opts.UnixSock != "" {
+		tr.Proxy = nil
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", opts.UnixSock)
+		}
+	}
 	client := &http.Client{
-		Transport: tr,
+		Transport: debuglog.Transport(tr),
 		Timeout:   time.Second * time.Duration(opts.Timeout),
 	}
 	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -290,33 +384,67 @@ func Run(args []string) *checkers.Checker {
 		return nil
 	}
 
-	var req *http.Request
-	if opts.Body == "" {
-		req, err = http.NewRequest(opts.Method, opts.URL, nil)
-		if err != nil {
+	var password string
+	if auth := strings.SplitN(opts.BasicAuth, ":", 2); len(auth) == 2 {
+		if password, err = secret.Resolve(auth[1]); err != nil {
 			return checkers.Unknown(err.Error())
 		}
-	} else {
-		body := strings.NewReader(opts.Body)
-		req, err = http.NewRequest(opts.Method, opts.URL, body)
-		if err != nil {
+	}
+	var header http.Header
+	if len(opts.Headers) != 0 {
+		if header, err = parseHeader(&opts); err != nil {
 			return checkers.Unknown(err.Error())
 		}
 	}
-
-	if len(opts.BasicAuth) != 0 {
-		auth := strings.SplitN(opts.BasicAuth, ":", 2)
-		if len(auth) == 1 {
-			req.SetBasicAuth(auth[0], "")
-		} else {
-			req.SetBasicAuth(auth[0], auth[1])
+	reqs := make([]*http.Request, len(targets))
+	for i, u := range targets {
+		if reqs[i], err = opts.newRequest(u, password, header); err != nil {
+			return checkers.Unknown(err.Error())
 		}
 	}
-	if len(opts.Headers) != 0 {
-		header, err := parseHeader(&opts)
-		if err != nil {
-			return checkers.Unknown(err.Error())
+
+	if opts.SelfTest {
+		var checks []selftest.Check
+		switch {
+		case opts.UnixSock != "":
+			// an abstract socket has no file
+			if !strings.HasPrefix(opts.UnixSock, "@") {
+				checks = append(checks, selftest.Exists(opts.UnixSock))
+			}
+		case proxyURL != nil:
+			// the host of the URL is resolved by the proxy
+			checks = append(checks, selftest.ResolveURL(proxyURL.String()))
+		case len(opts.ConnectTos) == 0:
+			for _, u := range targets {
+				checks = append(checks, selftest.ResolveURL(u))
+			}
 		}
+		return selftest.Run(checks...)
+	}
+
+	if opts.URLFile != "" {
+		return opts.checkURLs(client, reqs, statusRanges)
+	}
+	return opts.check(client, reqs[0], statusRanges)
+}
+
+// newRequest returns the request to the URL with the body, the basic authentication and the headers.
+func (opts *checkHTTPOpts) newRequest(rawurl, password string, header http.Header) (*http.Request, error) {
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+	req, err := http.NewRequest(opts.Method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.BasicAuth) != 0 {
+		user := strings.SplitN(opts.BasicAuth, ":", 2)[0]
+		req.SetBasicAuth(user, password)
+	}
+	if header != nil {
+		header = header.Clone()
 
 		// Host header must be set via req.Host
 		if host := header.Get("Host"); len(host) != 0 {
@@ -326,18 +454,45 @@ func Run(args []string) *checkers.Checker {
 
 		req.Header = header
 	}
+	return req, nil
+}
 
+// check sends the request and checks the response.
+func (opts *checkHTTPOpts) check(client *http.Client, req *http.Request, statusRanges []statusRange) *checkers.Checker {
 	// set default User-Agent unless specified by `opts.Headers`
 	if _, ok := req.Header["User-Agent"]; !ok {
 		req.Header.Set("User-Agent", "check-http")
 	}
 
-	stTime := time.Now()
-	resp, err := client.Do(req)
-	if err != nil {
-		return checkers.Critical(err.Error())
+	var tm timings
+	if opts.Perfdata {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), tm.trace()))
+	}
+
+	// only the last response is checked except for the response time
+	var (
+		resp      *http.Response
+		latencies []time.Duration
+		err       error
+	)
+	for i := 0; i < opts.Probes; i++ {
+		r := req
+		if i > 0 {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if r, err = cloneRequest(req); err != nil {
+				return checkers.Unknown(err.Error())
+			}
+		}
+		stTime := time.Now()
+		tm = timings{start: stTime}
+		resp, err = client.Do(r)
+		if err != nil {
+			return checkers.Critical(err.Error())
+		}
+		latencies = append(latencies, time.Since(stTime))
 	}
-	elapsed := time.Since(stTime)
+	elapsed := aggregateLatency(latencies, opts.ProbeStat)
 	defer resp.Body.Close()
 
 	body, _ := ioutil.ReadAll(resp.Body)
@@ -382,6 +537,17 @@ func Run(args []string) *checkers.Checker {
 		}
 	}
 
+	if opts.FailRegexp != "" {
+		re, err := regexp.Compile(opts.FailRegexp)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if re.Match(body) {
+			fmt.Fprintf(respMsg, "'%s' found in the content\n", opts.FailRegexp)
+			checkSt = checkers.CRITICAL
+		}
+	}
+
 	if opts.RequireBytes != -1 && cLength != opts.RequireBytes {
 		fmt.Fprintf(respMsg, "Response was '%d' bytes instead of '%d'\n", cLength, opts.RequireBytes)
 		checkSt = checkers.CRITICAL
@@ -392,8 +558,273 @@ func Run(args []string) *checkers.Checker {
 		checkSt = checkers.CRITICAL
 	}
 
+	if msg := checkProtocol(opts.RequireProtocol, resp); msg != "" {
+		fmt.Fprintln(respMsg, msg)
+		checkSt = checkers.CRITICAL
+	}
+
+	if opts.ExpectSHA256 != "" || opts.Baseline {
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		expected := strings.ToLower(opts.ExpectSHA256)
+		if opts.Baseline {
+			// don't take an error page as the baseline
+			expected, err = loadBaseline(opts.baselineFile(), hash, checkSt == checkers.OK)
+			if err != nil {
+				return checkers.Unknown(err.Error())
+			}
+		}
+		if expected != "" && hash != expected {
+			fmt.Fprintf(respMsg, "Content SHA-256 hash was '%s' instead of '%s'\n", hash, expected)
+			checkSt = checkers.CRITICAL
+		}
+	}
+
+	switch {
+	case opts.CriticalTime != nil && elapsed.Seconds() > *opts.CriticalTime:
+		fmt.Fprintf(respMsg, "Response time was %f seconds, over %g\n", elapsed.Seconds(), *opts.CriticalTime)
+		checkSt = checkers.CRITICAL
+	case opts.WarningTime != nil && elapsed.Seconds() > *opts.WarningTime:
+		fmt.Fprintf(respMsg, "Response time was %f seconds, over %g\n", elapsed.Seconds(), *opts.WarningTime)
+		if checkSt == checkers.OK {
+			checkSt = checkers.WARNING
+		}
+	}
+
 	fmt.Fprintf(respMsg, "%s %s - %d bytes in %f second response time",
 		resp.Proto, resp.Status, cLength, elapsed.Seconds())
+	if opts.Probes > 1 {
+		fmt.Fprintf(respMsg, " (%s of %d probes)", opts.ProbeStat, opts.Probes)
+	}
+	if opts.Perfdata {
+		fmt.Fprintf(respMsg, " | %s", tm.perfdata(elapsed))
+	}
 
 	return checkers.NewChecker(checkSt, respMsg.String())
 }
+
+// readURLFile reads the URLs from a sitemap, or a URL per line ignoring empty lines and lines starting with #.
+func readURLFile(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("<")) {
+		var sitemap struct {
+			URLs []struct {
+				Loc string `xml:"loc"`
+			} `xml:"url"`
+		}
+		if err := xml.Unmarshal(b, &sitemap); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		for _, u := range sitemap.URLs {
+			if loc := strings.TrimSpace(u.Loc); loc != "" {
+				urls = append(urls, loc)
+			}
+		}
+	} else {
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, line)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("%s: no URLs", file)
+	}
+	return urls, nil
+}
+
+// checkURLs checks the requests with --concurrency at most at the same time,
+// and reports the failed URLs, which are not OK.
+func (opts *checkHTTPOpts) checkURLs(client *http.Client, reqs []*http.Request, statusRanges []statusRange) *checkers.Checker {
+	results := make([]*checkers.Checker, len(reqs))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req *http.Request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			o := *opts
+			// the baseline is kept for each URL
+			o.URL = req.URL.String()
+			results[i] = o.check(client, req, statusRanges)
+		}(i, req)
+	}
+	wg.Wait()
+	return summarizeURLs(reqs, results, opts.MaxFailures)
+}
+
+func summarizeURLs(reqs []*http.Request, results []*checkers.Checker, maxFailures int) *checkers.Checker {
+	var failed []string
+	for i, r := range results {
+		if r.Status == checkers.OK {
+			continue
+		}
+		msg := r.Message
+		if i := strings.LastIndex(msg, " | "); i >= 0 {
+			msg = msg[:i]
+		}
+		msg = strings.Join(strings.Split(strings.TrimSpace(msg), "\n"), ", ")
+		failed = append(failed, fmt.Sprintf("[%s] %s: %s", r.Status, reqs[i].URL, msg))
+	}
+	if len(failed) == 0 {
+		return checkers.Ok(fmt.Sprintf("%d URLs are OK", len(reqs)))
+	}
+	checkSt := checkers.WARNING
+	if len(failed) > maxFailures {
+		checkSt = checkers.CRITICAL
+	}
+	msg := fmt.Sprintf("%d of %d URLs failed\n%s", len(failed), len(reqs), strings.Join(failed, "\n"))
+	return checkers.NewChecker(checkSt, msg)
+}
+
+// validateUnixSock validates the options with --unix-sock, and sets the URL to request with --path.
+// The URL may be specified with --unix-sock to set the scheme and the Host header.
+func (opts *checkHTTPOpts) validateUnixSock() error {
+	if opts.UnixSock == "" {
+		if opts.URL == "" {
+			return fmt.Errorf("--url or --unix-sock is required")
+		}
+		if opts.Path != "" {
+			return fmt.Errorf("--path can be specified only with --unix-sock")
+		}
+		return nil
+	}
+	if len(opts.ConnectTos) > 0 || opts.Proxy != "" || opts.SourceIP != "" || opts.IPv4 || opts.IPv6 {
+		return fmt.Errorf("--unix-sock cannot be specified with --connect-to, --proxy, --source-ip, --ipv4 or --ipv6")
+	}
+	if opts.URL != "" {
+		if opts.Path != "" {
+			return fmt.Errorf("--url and --path cannot be specified at the same time")
+		}
+		return nil
+	}
+	path := opts.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	opts.URL = "http://localhost" + path
+	return nil
+}
+
+// cloneRequest returns a copy of req to send it again, which has the body rewound.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// aggregateLatency returns the max or the 95th percentile by the nearest-rank method of the latencies.
+func aggregateLatency(latencies []time.Duration, stat string) time.Duration {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if stat == "p95" {
+		rank := int(math.Ceil(0.95 * float64(len(sorted))))
+		return sorted[rank-1]
+	}
+	return sorted[len(sorted)-1]
+}
+
+// baselineState is the hash of the content taken as the baseline.
+type baselineState struct {
+	Hash string `json:"hash"`
+}
+
+func (opts *checkHTTPOpts) baselineFile() string {
+	return state.File(state.Dir(opts.StateDir, "check-http"), "baseline", opts.Method, opts.URL)
+}
+
+// loadBaseline returns the baseline hash kept in f.
+// If there is no baseline yet, hash is saved as the baseline when save is true.
+func loadBaseline(f, hash string, save bool) (string, error) {
+	var b baselineState
+	ok, err := state.Load(f, &b)
+	if err != nil || ok {
+		return b.Hash, err
+	}
+	if !save {
+		return "", nil
+	}
+	if err := state.Save(f, &baselineState{Hash: hash}); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// checkProtocol returns the reason why resp doesn't satisfy the required protocol, or "" if it does.
+// HTTP/3 can't be negotiated without QUIC, so it is verified by the Alt-Svc header instead.
+func checkProtocol(required string, resp *http.Response) string {
+	switch required {
+	case "h2":
+		if resp.ProtoMajor < 2 {
+			return fmt.Sprintf("Protocol was '%s' instead of 'HTTP/2' or later", resp.Proto)
+		}
+	case "h3":
+		if resp.ProtoMajor >= 3 {
+			return ""
+		}
+		for _, v := range resp.Header.Values("Alt-Svc") {
+			for _, alt := range strings.Split(v, ",") {
+				alt = strings.TrimSpace(alt)
+				if strings.HasPrefix(alt, "h3=") || strings.HasPrefix(alt, "h3-") {
+					return ""
+				}
+			}
+		}
+		return "HTTP/3 was not advertised by Alt-Svc"
+	}
+	return ""
+}
+
+// timings holds the time spent for each phase of the request.
+// If the request is redirected, they are of the last one.
+type timings struct {
+	start               time.Time
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	firstByte           time.Time
+}
+
+func (tm *timings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { tm.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { tm.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { tm.connStart = time.Now() },
+		ConnectDone:          func(string, string, error) { tm.connDone = time.Now() },
+		TLSHandshakeStart:    func() { tm.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tm.tlsDone = time.Now() },
+		GotFirstResponseByte: func() { tm.firstByte = time.Now() },
+	}
+}
+
+// perfdata returns the timings in the format of Nagios plugins.
+// The phases which didn't happen, such as TLS handshake of HTTP, are reported as 0.
+func (tm *timings) perfdata(total time.Duration) string {
+	sub := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return to.Sub(from).Seconds()
+	}
+	return fmt.Sprintf("dns=%fs connect=%fs tls=%fs ttfb=%fs time=%fs",
+		sub(tm.dnsStart, tm.dnsDone),
+		sub(tm.connStart, tm.connDone),
+		sub(tm.tlsStart, tm.tlsDone),
+		sub(tm.start, tm.firstByte),
+		total.Seconds())
+}
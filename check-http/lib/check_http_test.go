@@ -1,11 +1,19 @@
 package checkhttp
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/elazarl/goproxy"
 	"github.com/elazarl/goproxy/ext/auth"
@@ -137,6 +145,289 @@ func TestExpectedContent(t *testing.T) {
 	}
 }
 
+func TestContentHash(t *testing.T) {
+	content := "Hello, client\n"
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, content)
+	}))
+	defer ts.Close()
+
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+
+	ckr := Run([]string{"-u", ts.URL, "--expect-sha256", strings.ToUpper(hash)})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	ckr = Run([]string{"-u", ts.URL, "--expect-sha256", strings.Repeat("0", 64)})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+	ckr = Run([]string{"-u", ts.URL, "--expect-sha256", hash, "--baseline"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+
+	dir, err := ioutil.TempDir("", "check-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"-u", ts.URL, "--baseline", "--state-dir", dir}
+
+	// an error page isn't taken as the baseline
+	status = http.StatusInternalServerError
+	ckr = Run(args)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+
+	status = http.StatusOK
+	ckr = Run(args)
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	ckr = Run(args)
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+
+	content = "defaced\n"
+	ckr = Run(args)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+	assert.Contains(t, ckr.Message, fmt.Sprintf("instead of '%s'", hash))
+}
+
+func TestRequireProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/h3" {
+			w.Header().Set("Alt-Svc", `h3=":443"; ma=86400, h3-29=":443"`)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	})
+	h1 := httptest.NewServer(handler)
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	testCases := []struct {
+		args   []string
+		status checkers.Status
+	}{
+		{
+			args:   []string{"-u", h2.URL, "--no-check-certificate", "--require-protocol", "h2"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", h1.URL, "--require-protocol", "h2"},
+			status: checkers.CRITICAL,
+		},
+		{
+			args:   []string{"-u", h2.URL + "/h3", "--no-check-certificate", "--require-protocol", "h3"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", h2.URL, "--no-check-certificate", "--require-protocol", "h3"},
+			status: checkers.CRITICAL,
+		},
+	}
+	for i, tc := range testCases {
+		ckr := Run(tc.args)
+		assert.Equal(t, tc.status, ckr.Status, "#%d: %s", i, ckr.Message)
+	}
+}
+
+func TestPerfdata(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	ckr := Run([]string{"-u", ts.URL, "--no-check-certificate", "--perfdata"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	assert.Regexp(t, ` \| dns=[0-9.]+s connect=[0-9.]+s tls=[0-9.]+s ttfb=[0-9.]+s time=[0-9.]+s$`, ckr.Message)
+	assert.NotContains(t, ckr.Message, "tls=0.000000s")
+}
+
+func TestProbes(t *testing.T) {
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		// the 3rd request of each check is slow
+		if count%20 == 3 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "ping" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	testCases := []struct {
+		args   []string
+		status checkers.Status
+	}{
+		{
+			args:   []string{"-u", ts.URL, "-m", "POST", "-d", "ping", "--probes", "20", "--critical-time", "0.1"},
+			status: checkers.CRITICAL,
+		},
+		{
+			args:   []string{"-u", ts.URL, "-m", "POST", "-d", "ping", "--probes", "20", "--warning-time", "0.1"},
+			status: checkers.WARNING,
+		},
+		{
+			args:   []string{"-u", ts.URL, "-m", "POST", "-d", "ping", "--probes", "20", "--probe-stat", "p95", "--critical-time", "0.1"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", ts.URL, "--probes", "0"},
+			status: checkers.UNKNOWN,
+		},
+	}
+	for i, tc := range testCases {
+		count = 0
+		ckr := Run(tc.args)
+		assert.Equal(t, tc.status, ckr.Status, "#%d: %s", i, ckr.Message)
+	}
+	assert.Contains(t, Run([]string{"-u", ts.URL, "-d", "ping", "--probes", "3"}).Message, "(max of 3 probes)")
+}
+
+func newUnixServer(t *testing.T, sock string) *httptest.Server {
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "ok %s", r.Host)
+	}))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	return ts
+}
+
+func TestUnixSock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "app.sock")
+	ts := newUnixServer(t, sock)
+	defer ts.Close()
+
+	testCases := []struct {
+		args   []string
+		status checkers.Status
+	}{
+		{
+			args:   []string{"--unix-sock", sock, "--path", "/healthz", "-p", "^ok localhost$"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"--unix-sock", sock, "--path", "healthz"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"--unix-sock", sock, "-u", "http://app.internal/healthz", "-p", "^ok app.internal$"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"--unix-sock", sock},
+			status: checkers.WARNING,
+		},
+		{
+			args:   []string{"--unix-sock", filepath.Join(dir, "none.sock"), "--path", "/healthz"},
+			status: checkers.CRITICAL,
+		},
+		{
+			args:   []string{"--unix-sock", sock, "-u", "http://localhost/healthz", "--path", "/healthz"},
+			status: checkers.UNKNOWN,
+		},
+		{
+			args:   []string{"--unix-sock", sock, "--path", "/healthz", "--connect-to", "::127.0.0.1:"},
+			status: checkers.UNKNOWN,
+		},
+		{
+			args:   []string{"--path", "/healthz"},
+			status: checkers.UNKNOWN,
+		},
+	}
+	for i, tc := range testCases {
+		ckr := Run(tc.args)
+		assert.Equal(t, tc.status, ckr.Status, "#%d: %s", i, ckr.Message)
+	}
+}
+
+func TestAbstractUnixSock(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are supported only on Linux")
+	}
+	sock := fmt.Sprintf("@check-http-test-%d", os.Getpid())
+	ts := newUnixServer(t, sock)
+	defer ts.Close()
+
+	ckr := Run([]string{"--unix-sock", sock, "--path", "/healthz"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+}
+
+func TestAggregateLatency(t *testing.T) {
+	latencies := []time.Duration{3, 1, 20, 2, 5, 4, 6, 8, 7, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 100}
+	assert.Equal(t, time.Duration(100), aggregateLatency(latencies, "max"))
+	assert.Equal(t, time.Duration(20), aggregateLatency(latencies, "p95"))
+	assert.Equal(t, time.Duration(7), aggregateLatency([]time.Duration{7}, "p95"))
+}
+
+func TestNegativeAssertion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, "panic: runtime error: invalid memory address or nil pointer dereference")
+			return
+		}
+		fmt.Fprintln(w, "Hello, client")
+	}))
+	defer ts.Close()
+
+	testCases := []struct {
+		args   []string
+		status checkers.Status
+	}{
+		{
+			args:   []string{"-u", ts.URL + "/admin", "--expect-status", "401,403"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", ts.URL + "/admin", "--expect-status", "403", "--expect-status", "401"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", ts.URL, "--expect-status", "401,403"},
+			status: checkers.CRITICAL,
+		},
+		{
+			args:   []string{"-u", ts.URL, "--expect-status", "401,abc"},
+			status: checkers.UNKNOWN,
+		},
+		{
+			args:   []string{"-u", ts.URL + "/error", "--expect-status", "500", "--fail-if-body-matches", "panic:|Traceback"},
+			status: checkers.CRITICAL,
+		},
+		{
+			args:   []string{"-u", ts.URL, "--fail-if-body-matches", "panic:|Traceback"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-u", ts.URL, "--fail-if-body-matches", "???"},
+			status: checkers.UNKNOWN,
+		},
+	}
+	for i, tc := range testCases {
+		ckr := Run(tc.args)
+		assert.Equal(t, tc.status, ckr.Status, "#%d: %s", i, ckr.Message)
+	}
+}
+
 func TestMaxRedirects(t *testing.T) {
 	redirectedPath := "/redirected"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -286,6 +577,55 @@ func TestConnectTos(t *testing.T) {
 	}
 }
 
+func TestURLFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	list := filepath.Join(dir, "urls.txt")
+	err := ioutil.WriteFile(list, []byte("# key endpoints\n"+ts.URL+"/\n\n"+ts.URL+"/missing\n"+ts.URL+"/error\n"), 0644)
+	assert.NoError(t, err)
+	sitemap := filepath.Join(dir, "sitemap.xml")
+	err = ioutil.WriteFile(sitemap, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>`+ts.URL+`/</loc></url>
+  <url><loc>`+ts.URL+`/about</loc></url>
+</urlset>
+`), 0644)
+	assert.NoError(t, err)
+
+	urls, err := readURLFile(sitemap)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ts.URL + "/", ts.URL + "/about"}, urls)
+
+	ckr := Run([]string{"--url-file", sitemap, "-p", "ok"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	assert.Equal(t, "2 URLs are OK", ckr.Message)
+
+	ckr = Run([]string{"--url-file", list, "--concurrency", "2"})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+	assert.True(t, strings.HasPrefix(ckr.Message, "2 of 3 URLs failed\n[WARNING] "+ts.URL+"/missing: HTTP/1.1 404 Not Found - 0 bytes in "), ckr.Message)
+	assert.Contains(t, ckr.Message, "[CRITICAL] "+ts.URL+"/error: HTTP/1.1 500 Internal Server Error")
+
+	ckr = Run([]string{"--url-file", list, "--max-failures", "2", "--perfdata"})
+	assert.Equal(t, checkers.WARNING, ckr.Status, ckr.Message)
+	assert.NotContains(t, ckr.Message, " | ")
+
+	ckr = Run([]string{"--url-file", list, "-u", ts.URL})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+	ckr = Run([]string{"--url-file", filepath.Join(dir, "none.txt")})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+}
+
 func TestProxy(t *testing.T) {
 	// target server
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,244 @@
+package checkinterface
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type interfaceOpts struct {
+	Interfaces         []string `short:"i" long:"interface" value-name:"NAME" description:"Interface to check (can be specified multiple times, default: all physical interfaces)"`
+	Exclude            string   `short:"x" long:"exclude" value-name:"REGEXP" description:"Interfaces whose names match are not checked"`
+	WarningErrors      *float64 `long:"warning-errors" value-name:"PER_SEC" description:"warning if the receive and transmit errors per second since the last check are over"`
+	CriticalErrors     *float64 `long:"critical-errors" value-name:"PER_SEC" description:"critical if the receive and transmit errors per second since the last check are over"`
+	WarningDrops       *float64 `long:"warning-drops" value-name:"PER_SEC" description:"warning if the receive and transmit drops per second since the last check are over"`
+	CriticalDrops      *float64 `long:"critical-drops" value-name:"PER_SEC" description:"critical if the receive and transmit drops per second since the last check are over"`
+	WarningCollisions  *float64 `long:"warning-collisions" value-name:"PER_SEC" description:"warning if the collisions per second since the last check are over"`
+	CriticalCollisions *float64 `long:"critical-collisions" value-name:"PER_SEC" description:"critical if the collisions per second since the last check are over"`
+	Speed              int64    `long:"speed" value-name:"MBPS" description:"warning if the negotiated speed is less than"`
+	Duplex             string   `long:"duplex" choice:"full" choice:"half" description:"warning if the negotiated duplex is not"`
+	StateDir           string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	selftest.SelfTestOpts
+}
+
+// sysClassNet is replaced in tests.
+var sysClassNet = "/sys/class/net"
+
+// iffUp is IFF_UP of the flags of the interface, which is set if it is administratively up.
+const iffUp = 0x1
+
+// counters is the counters of an interface saved in the state file.
+type counters struct {
+	Time       int64  `json:"time"`
+	Errors     uint64 `json:"errors"`
+	Drops      uint64 `json:"drops"`
+	Collisions uint64 `json:"collisions"`
+}
+
+// netInterface is the state of an interface read from sysfs.
+type netInterface struct {
+	name      string
+	adminUp   bool
+	operstate string
+	speed     int64 // in Mb/s, or -1 if unknown
+	duplex    string
+	counters  counters
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Interface"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := interfaceOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Exists(sysClassNet))
+	}
+	var exclude *regexp.Regexp
+	if opts.Exclude != "" {
+		exclude, err = regexp.Compile(opts.Exclude)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	names := opts.Interfaces
+	if len(names) == 0 {
+		names, err = physicalInterfaces()
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	now := time.Now()
+	var ifs []*netInterface
+	for _, name := range names {
+		if exclude != nil && exclude.MatchString(name) {
+			continue
+		}
+		ifi, err := readInterface(name, now)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		ifs = append(ifs, ifi)
+	}
+	if len(ifs) == 0 {
+		return checkers.Unknown("no interfaces found")
+	}
+
+	// the checks with other arguments have their own state, so that they don't see the counters saved by each other
+	stateFile := state.File(state.Dir(opts.StateDir, "check-interface"), "counters", strings.Join(args, " "))
+	var last map[string]counters
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cur := make(map[string]counters, len(ifs))
+	for _, ifi := range ifs {
+		cur[ifi.name] = ifi.counters
+	}
+	if err := state.Save(stateFile, cur); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(ifs, last)
+}
+
+// physicalInterfaces returns the interfaces which have devices, excluding the virtual ones
+// such as lo, bridges and veth.
+func physicalInterfaces() ([]string, error) {
+	entries, err := ioutil.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(sysClassNet, e.Name(), "device")); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func readInterface(name string, now time.Time) (*netInterface, error) {
+	dir := filepath.Join(sysClassNet, name)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("interface %s is not found", name)
+		}
+		return nil, err
+	}
+	read := func(file string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+	readUint := func(file string) uint64 {
+		n, _ := strconv.ParseUint(read(file), 10, 64)
+		return n
+	}
+
+	flags, _ := strconv.ParseUint(strings.TrimPrefix(read("flags"), "0x"), 16, 64)
+	// reading speed fails with EINVAL while the link is down
+	speed, err := strconv.ParseInt(read("speed"), 10, 64)
+	if err != nil {
+		speed = -1
+	}
+	return &netInterface{
+		name:      name,
+		adminUp:   flags&iffUp != 0,
+		operstate: read("operstate"),
+		speed:     speed,
+		duplex:    read("duplex"),
+		counters: counters{
+			Time:       now.Unix(),
+			Errors:     readUint("statistics/rx_errors") + readUint("statistics/tx_errors"),
+			Drops:      readUint("statistics/rx_dropped") + readUint("statistics/tx_dropped"),
+			Collisions: readUint("statistics/collisions"),
+		},
+	}, nil
+}
+
+// evaluate checks the interfaces which are administratively up.
+// The rates are not checked on the first check, or if the counters have been reset.
+func (opts *interfaceOpts) evaluate(ifs []*netInterface, last map[string]counters) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs, summaries []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	for _, ifi := range ifs {
+		if !ifi.adminUp {
+			summaries = append(summaries, fmt.Sprintf("%s: administratively down", ifi.name))
+			continue
+		}
+		// operstate is unknown for the drivers which don't report it, such as tun
+		if ifi.operstate != "up" && ifi.operstate != "unknown" {
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: link %s", ifi.name, ifi.operstate))
+			continue
+		}
+
+		summary := fmt.Sprintf("%s: up", ifi.name)
+		if ifi.speed > 0 {
+			summary += fmt.Sprintf(" %dMb/s %s", ifi.speed, ifi.duplex)
+		}
+		summaries = append(summaries, summary)
+		if opts.Speed > 0 && ifi.speed > 0 && ifi.speed < opts.Speed {
+			raise(checkers.WARNING, fmt.Sprintf("%s: speed %dMb/s < %dMb/s", ifi.name, ifi.speed, opts.Speed))
+		}
+		if opts.Duplex != "" && ifi.duplex != "" && ifi.duplex != opts.Duplex {
+			raise(checkers.WARNING, fmt.Sprintf("%s: %s duplex", ifi.name, ifi.duplex))
+		}
+
+		prev, ok := last[ifi.name]
+		cur := ifi.counters
+		elapsed := cur.Time - prev.Time
+		if !ok || elapsed <= 0 || cur.Errors < prev.Errors || cur.Drops < prev.Drops || cur.Collisions < prev.Collisions {
+			continue
+		}
+		checkRate := func(name string, n uint64, warning, critical *float64) {
+			rate := float64(n) / float64(elapsed)
+			switch {
+			case critical != nil && rate > *critical:
+				raise(checkers.CRITICAL, fmt.Sprintf("%s: %.2f %s/s > %g", ifi.name, rate, name, *critical))
+			case warning != nil && rate > *warning:
+				raise(checkers.WARNING, fmt.Sprintf("%s: %.2f %s/s > %g", ifi.name, rate, name, *warning))
+			}
+		}
+		checkRate("errors", cur.Errors-prev.Errors, opts.WarningErrors, opts.CriticalErrors)
+		checkRate("drops", cur.Drops-prev.Drops, opts.WarningDrops, opts.CriticalDrops)
+		checkRate("collisions", cur.Collisions-prev.Collisions, opts.WarningCollisions, opts.CriticalCollisions)
+	}
+
+	if len(msgs) == 0 {
+		return checkers.NewChecker(checkSt, strings.Join(summaries, ", "))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,190 @@
+package checkinterface
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeInterface(t *testing.T, dir, name string, physical bool, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name, "statistics"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if physical {
+		if err := os.MkdirAll(filepath.Join(dir, name, "device"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name, file), []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadInterface(t *testing.T) {
+	dir := t.TempDir()
+	orig := sysClassNet
+	sysClassNet = dir
+	defer func() { sysClassNet = orig }()
+
+	writeInterface(t, dir, "eth0", true, map[string]string{
+		"flags":                 "0x1003",
+		"operstate":             "up",
+		"speed":                 "10000",
+		"duplex":                "full",
+		"statistics/rx_errors":  "3",
+		"statistics/tx_errors":  "1",
+		"statistics/rx_dropped": "120",
+		"statistics/tx_dropped": "0",
+		"statistics/collisions": "0",
+	})
+	writeInterface(t, dir, "eth1", true, map[string]string{
+		"flags":     "0x1002",
+		"operstate": "down",
+	})
+	writeInterface(t, dir, "lo", false, map[string]string{
+		"flags":     "0x9",
+		"operstate": "unknown",
+	})
+
+	names, err := physicalInterfaces()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"eth0", "eth1"}, names)
+
+	now := time.Unix(1600000000, 0)
+	ifi, err := readInterface("eth0", now)
+	assert.Nil(t, err)
+	assert.Equal(t, &netInterface{
+		name:      "eth0",
+		adminUp:   true,
+		operstate: "up",
+		speed:     10000,
+		duplex:    "full",
+		counters:  counters{Time: 1600000000, Errors: 4, Drops: 120},
+	}, ifi)
+
+	ifi, err = readInterface("eth1", now)
+	assert.Nil(t, err)
+	assert.Equal(t, false, ifi.adminUp)
+	assert.Equal(t, int64(-1), ifi.speed)
+
+	_, err = readInterface("eth2", now)
+	assert.Equal(t, "interface eth2 is not found", err.Error())
+}
+
+func TestEvaluate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	eth0 := &netInterface{name: "eth0", adminUp: true, operstate: "up", speed: 10000, duplex: "full",
+		counters: counters{Time: 1600000060, Errors: 4, Drops: 720, Collisions: 0}}
+	eth1 := &netInterface{name: "eth1", adminUp: true, operstate: "up", speed: 1000, duplex: "half",
+		counters: counters{Time: 1600000060}}
+	last := map[string]counters{
+		"eth0": {Time: 1600000000, Errors: 4, Drops: 120},
+		"eth1": {Time: 1600000000},
+	}
+
+	tests := []struct {
+		opts interfaceOpts
+		ifs  []*netInterface
+		last map[string]counters
+		want checkers.Status
+		msg  string
+	}{
+		{
+			ifs:  []*netInterface{eth0, eth1},
+			last: last,
+			want: checkers.OK,
+			msg:  "eth0: up 10000Mb/s full, eth1: up 1000Mb/s half",
+		},
+		{
+			opts: interfaceOpts{WarningErrors: f(0), WarningDrops: f(5), CriticalDrops: f(10)},
+			ifs:  []*netInterface{eth0},
+			last: last,
+			want: checkers.WARNING,
+			msg:  "eth0: 10.00 drops/s > 5",
+		},
+		{
+			opts: interfaceOpts{CriticalDrops: f(5)},
+			ifs:  []*netInterface{eth0},
+			last: nil,
+			want: checkers.OK,
+			msg:  "eth0: up 10000Mb/s full",
+		},
+		{
+			// the counters have been reset
+			opts: interfaceOpts{CriticalDrops: f(5)},
+			ifs:  []*netInterface{eth0},
+			last: map[string]counters{"eth0": {Time: 1600000000, Drops: 1000}},
+			want: checkers.OK,
+			msg:  "eth0: up 10000Mb/s full",
+		},
+		{
+			opts: interfaceOpts{Speed: 10000, Duplex: "full"},
+			ifs:  []*netInterface{eth0, eth1},
+			last: last,
+			want: checkers.WARNING,
+			msg:  "eth1: speed 1000Mb/s < 10000Mb/s, eth1: half duplex",
+		},
+		{
+			ifs: []*netInterface{
+				{name: "eth2", adminUp: true, operstate: "down", speed: -1},
+				{name: "eth3", adminUp: false, operstate: "down", speed: -1},
+				{name: "tun0", adminUp: true, operstate: "unknown", speed: -1},
+			},
+			want: checkers.CRITICAL,
+			msg:  "eth2: link down",
+		},
+		{
+			ifs: []*netInterface{
+				{name: "eth3", adminUp: false, operstate: "down", speed: -1},
+				{name: "tun0", adminUp: true, operstate: "unknown", speed: -1},
+			},
+			want: checkers.OK,
+			msg:  "eth3: administratively down, tun0: up",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(tt.ifs, tt.last)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	orig := sysClassNet
+	sysClassNet = filepath.Join(dir, "net")
+	defer func() { sysClassNet = orig }()
+
+	writeInterface(t, sysClassNet, "eth0", true, map[string]string{"flags": "0x1003", "operstate": "up", "speed": "1000", "duplex": "full"})
+	writeInterface(t, sysClassNet, "eth1", true, map[string]string{"flags": "0x1003", "operstate": "down"})
+
+	ckr := run([]string{"--state-dir", dir, "-x", "^eth1$"})
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "eth0: up 1000Mb/s full", ckr.Message)
+
+	args := []string{"--state-dir", dir, "-i", "eth1"}
+	ckr = run(args)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+
+	// the checks with other arguments keep their own counters
+	var last map[string]counters
+	found, err := state.Load(state.File(dir, "counters", strings.Join(args, " ")), &last)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, len(last))
+	assert.Contains(t, last, "eth1")
+
+	ckr = run([]string{"--state-dir", dir, "-i", "eth9"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	ckr = run([]string{"--state-dir", dir, "-x", "eth"})
+	assert.Equal(t, "no interfaces found", ckr.Message)
+}
@@ -0,0 +1,184 @@
+package checkipmi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type ipmiOpts struct {
+	Ipmitool      string `long:"ipmitool" value-name:"PATH" default:"ipmitool" description:"Path to ipmitool"`
+	Host          string `short:"H" long:"host" description:"Hostname or IP address of the remote BMC. The local BMC is checked if omitted"`
+	Interface     string `short:"I" long:"interface" default:"lanplus" description:"Interface of ipmitool to connect to the remote BMC"`
+	User          string `short:"U" long:"user" description:"User of the remote BMC"`
+	Password      string `short:"P" long:"password" description:"Password of the remote BMC" env:"IPMI_PASSWORD"`
+	Timeout       int    `short:"t" long:"timeout" default:"30" description:"Seconds before ipmitool times out"`
+	SensorExclude string `long:"sensor-exclude" value-name:"REGEXP" description:"Sensors whose names match are not checked"`
+	SEL           bool   `long:"sel" description:"Alert on the entries added to the System Event Log since the last check"`
+	SELCritical   string `long:"sel-critical" value-name:"REGEXP" description:"New SEL entries which match are critical, while the others are warning"`
+	SELExclude    string `long:"sel-exclude" value-name:"REGEXP" description:"New SEL entries which match are not alerted"`
+	StateDir      string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+
+	sensorExclude *regexp.Regexp
+	selCritical   *regexp.Regexp
+	selExclude    *regexp.Regexp
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "IPMI"
+	return ckr
+}
+
+func (opts *ipmiOpts) prepare() error {
+	var err error
+	for _, p := range []struct {
+		expr string
+		re   **regexp.Regexp
+	}{
+		{opts.SensorExclude, &opts.sensorExclude},
+		{opts.SELCritical, &opts.selCritical},
+		{opts.SELExclude, &opts.selExclude},
+	} {
+		if p.expr == "" {
+			continue
+		}
+		if *p.re, err = regexp.Compile(p.expr); err != nil {
+			return err
+		}
+	}
+	if opts.Password, err = opts.ResolvePassword(opts.Password); err != nil {
+		return err
+	}
+	return nil
+}
+
+func run(args []string) *checkers.Checker {
+	opts := ipmiOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if err := opts.prepare(); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Executable(opts.Ipmitool))
+	}
+	opts.DebugOpts.Enable()
+
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	out, err := opts.ipmitool("sdr", "elist")
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	sensors := parseSensors(out)
+	if len(sensors) == 0 {
+		return checkers.Unknown("no sensors found")
+	}
+	n := 0
+	for _, s := range sensors {
+		if opts.sensorExclude != nil && opts.sensorExclude.MatchString(s.name) {
+			continue
+		}
+		n++
+		if st, msg := s.evaluate(); st != checkers.OK {
+			raise(st, msg)
+		}
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, fmt.Sprintf("%d sensors are OK", n))
+	}
+
+	if opts.SEL {
+		out, err := opts.ipmitool("sel", "elist")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		stateFile := state.File(state.Dir(opts.StateDir, "check-ipmi"), "sel", opts.Host)
+		var last *selState
+		if _, err := state.Load(stateFile, &last); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		entries := parseSEL(out)
+		var next selState
+		if len(entries) > 0 {
+			next.Last = entries[len(entries)-1]
+		}
+		if err := state.Save(stateFile, &next); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if last != nil {
+			if st, msg := opts.evaluateSEL(newSELEntries(entries, last.Last)); st != checkers.OK {
+				raise(st, msg)
+			}
+		}
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func (opts *ipmiOpts) ipmitool(args ...string) ([]byte, error) {
+	var env []string
+	if opts.Host != "" {
+		conn := []string{"-I", opts.Interface, "-H", opts.Host}
+		if opts.User != "" {
+			conn = append(conn, "-U", opts.User)
+		}
+		if opts.Password != "" {
+			// -E reads the password from IPMI_PASSWORD, so that it isn't shown in the process list.
+			conn = append(conn, "-E")
+			env = append(os.Environ(), "IPMI_PASSWORD="+opts.Password)
+		}
+		args = append(conn, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	end := debuglog.Trace("exec: %s", debuglog.Command(opts.Ipmitool, args))
+	cmd := exec.CommandContext(ctx, opts.Ipmitool, args...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	end(err)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out", opts.Ipmitool)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
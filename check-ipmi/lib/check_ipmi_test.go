@@ -0,0 +1,132 @@
+package checkipmi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+const sdrOutput = `Inlet Temp       | 04h | ok  |  7.1 | 23 degrees C
+CPU1 Temp        | 0Eh | ok  |  3.1 | 45 degrees C
+CPU2 Temp        | 0Fh | cr  |  3.2 | 95 degrees C
+Fan1A            | 30h | ok  |  7.1 | 5880 RPM
+Fan2A            | 31h | lnc |  7.1 | 1200 RPM
+Fan3A            | 32h | ns  |  7.1 | Disabled
+PS1 Status       | 62h | ok  | 10.1 | Presence detected
+PS2 Status       | 63h | ok  | 10.2 | Presence detected, Failure detected, Power Supply AC lost
+PS Redundancy    | 77h | ok  |  7.1 | Redundancy Lost
+`
+
+func TestParseSensors(t *testing.T) {
+	sensors := parseSensors([]byte(sdrOutput))
+	assert.Equal(t, 9, len(sensors))
+	assert.Equal(t, sensor{name: "PS2 Status", status: "ok", reading: "Presence detected, Failure detected, Power Supply AC lost"}, sensors[7])
+
+	var results []checkers.Status
+	var msgs []string
+	for _, s := range sensors {
+		st, msg := s.evaluate()
+		results = append(results, st)
+		if st != checkers.OK {
+			msgs = append(msgs, msg)
+		}
+	}
+	assert.Equal(t, []checkers.Status{
+		checkers.OK, checkers.OK, checkers.CRITICAL, checkers.OK, checkers.WARNING,
+		checkers.OK, checkers.OK, checkers.CRITICAL, checkers.WARNING,
+	}, results)
+	assert.Equal(t, []string{
+		"CPU2 Temp: 95 degrees C (cr)",
+		"Fan2A: 1200 RPM (lnc)",
+		"PS2 Status: Presence detected, Failure detected, Power Supply AC lost",
+		"PS Redundancy: Redundancy Lost",
+	}, msgs)
+}
+
+func TestSEL(t *testing.T) {
+	out := []byte(`   1 | 06/15/2020 | 10:27:06 | Event Logging Disabled #0x72 | Log area reset/cleared | Asserted
+   2 | 06/15/2020 | 10:30:12 | Power Supply PS2 Status | Failure detected | Asserted
+   3 | 06/15/2020 | 10:30:13 | Power Supply PS Redundancy | Redundancy Lost | Asserted
+   4 | 06/15/2020 | 10:41:55 | Memory #0x02 | Correctable ECC | Asserted
+`)
+	entries := parseSEL(out)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, 0, len(parseSEL([]byte("SEL has no entries\n"))))
+
+	assert.Equal(t, entries[2:], newSELEntries(entries, entries[1]))
+	assert.Equal(t, 0, len(newSELEntries(entries, entries[3])))
+	// the SEL has been cleared
+	assert.Equal(t, entries, newSELEntries(entries, "5 | 06/14/2020 | 00:00:00 | Memory #0x02 | Correctable ECC | Asserted"))
+	assert.Equal(t, entries, newSELEntries(entries, ""))
+
+	assert.Equal(t, "Power Supply PS2 Status: Failure detected, Asserted", describeSELEntry(entries[1]))
+
+	opts := ipmiOpts{selCritical: regexp.MustCompile(`Failure detected`), selExclude: regexp.MustCompile(`Log area reset`)}
+	st, msg := opts.evaluateSEL(entries)
+	assert.Equal(t, checkers.CRITICAL, st)
+	assert.Equal(t, "3 new SEL entries: Power Supply PS2 Status: Failure detected, Asserted; Power Supply PS Redundancy: Redundancy Lost, Asserted; Memory #0x02: Correctable ECC, Asserted", msg)
+
+	st, _ = opts.evaluateSEL(entries[2:])
+	assert.Equal(t, checkers.WARNING, st)
+	st, _ = opts.evaluateSEL(entries[:1])
+	assert.Equal(t, checkers.OK, st)
+
+	var many []string
+	for i := 0; i < 7; i++ {
+		many = append(many, entries[3])
+	}
+	_, msg = opts.evaluateSEL(many)
+	assert.Regexp(t, `^7 new SEL entries, the last 5: Memory #0x02: Correctable ECC, Asserted; `, msg)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	sdr := filepath.Join(dir, "sdr.txt")
+	sel := filepath.Join(dir, "sel.txt")
+	ipmitool := filepath.Join(dir, "ipmitool")
+	script := `#!/bin/sh
+echo "$@ $IPMI_PASSWORD" >> ` + filepath.Join(dir, "args.txt") + `
+case "$*" in
+*"sdr elist") cat ` + sdr + ` ;;
+*"sel elist") cat ` + sel + ` ;;
+esac
+`
+	write := func(file, content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ipmitool, script)
+	write(sdr, "Inlet Temp       | 04h | ok  |  7.1 | 23 degrees C\nFan1A            | 30h | ok  |  7.1 | 5880 RPM\n")
+	write(sel, "   1 | 06/15/2020 | 10:27:06 | Event Logging Disabled #0x72 | Log area reset/cleared | Asserted\n")
+
+	args := []string{"--ipmitool", ipmitool, "--state-dir", dir, "--sel", "-H", "bmc01", "-U", "admin", "-P", "secret"}
+	ckr := run(args)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "2 sensors are OK", ckr.Message)
+
+	write(sel, "   1 | 06/15/2020 | 10:27:06 | Event Logging Disabled #0x72 | Log area reset/cleared | Asserted\n"+
+		"   2 | 06/15/2020 | 10:30:12 | Power Supply PS2 Status | Failure detected | Asserted\n")
+	ckr = run(args)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Equal(t, "2 sensors are OK, 1 new SEL entries: Power Supply PS2 Status: Failure detected, Asserted", ckr.Message)
+
+	// the entries are alerted only once
+	write(sdr, "Fan1A            | 30h | lcr |  7.1 | 0 RPM\n")
+	ckr = run(append(args, "--sensor-exclude", "^Inlet"))
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "Fan1A: 0 RPM (lcr)", ckr.Message)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "args.txt"))
+	assert.Nil(t, err)
+	assert.Regexp(t, `^-I lanplus -H bmc01 -U admin -E sdr elist secret\n`, string(b))
+
+	write(sdr, "")
+	ckr = run([]string{"--ipmitool", ipmitool})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "no sensors found", ckr.Message)
+}
@@ -0,0 +1,82 @@
+package checkipmi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// maxSELEntries is the number of the new SEL entries shown in the message.
+const maxSELEntries = 5
+
+// selState is saved to find the entries added since the last check.
+type selState struct {
+	Last string `json:"last"` // the last entry, or empty if the SEL had no entries
+}
+
+// parseSEL parses the output of ipmitool sel elist, such as
+//
+//	1 | 06/15/2020 | 10:27:06 | Power Supply PS2 Status | Failure detected | Asserted
+func parseSEL(out []byte) []string {
+	var entries []string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.Count(line, "|") >= 3 {
+			entries = append(entries, line)
+		}
+	}
+	return entries
+}
+
+// newSELEntries returns the entries after the last one. If the last one isn't found, all entries are new
+// since the SEL has been cleared.
+func newSELEntries(entries []string, last string) []string {
+	if last == "" {
+		return entries
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i] == last {
+			return entries[i+1:]
+		}
+	}
+	return entries
+}
+
+// describeSELEntry returns the sensor and the event of the entry without the record ID and the time.
+func describeSELEntry(entry string) string {
+	f := strings.Split(entry, "|")
+	for i := range f {
+		f[i] = strings.TrimSpace(f[i])
+	}
+	if len(f) < 5 {
+		return strings.Join(f[3:], " ")
+	}
+	return fmt.Sprintf("%s: %s", f[3], strings.Join(f[4:], ", "))
+}
+
+func (opts *ipmiOpts) evaluateSEL(entries []string) (checkers.Status, string) {
+	st := checkers.OK
+	var descs []string
+	for _, e := range entries {
+		if opts.selExclude != nil && opts.selExclude.MatchString(e) {
+			continue
+		}
+		if opts.selCritical != nil && opts.selCritical.MatchString(e) {
+			st = checkers.CRITICAL
+		} else if st < checkers.WARNING {
+			st = checkers.WARNING
+		}
+		descs = append(descs, describeSELEntry(e))
+	}
+	if len(descs) == 0 {
+		return checkers.OK, ""
+	}
+	if len(descs) > maxSELEntries {
+		return st, fmt.Sprintf("%d new SEL entries, the last %d: %s", len(descs), maxSELEntries, strings.Join(descs[len(descs)-maxSELEntries:], "; "))
+	}
+	return st, fmt.Sprintf("%d new SEL entries: %s", len(descs), strings.Join(descs, "; "))
+}
@@ -0,0 +1,77 @@
+package checkipmi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// sensor is a line of ipmitool sdr elist, such as
+//
+//	Inlet Temp       | 04h | ok  |  7.1 | 23 degrees C
+//	PS2 Status       | 63h | ok  | 10.2 | Presence detected, Failure detected
+type sensor struct {
+	name    string
+	status  string
+	reading string
+}
+
+// sensorStatuses are the statuses of the threshold sensors other than ok and ns (no reading).
+var sensorStatuses = map[string]checkers.Status{
+	"nc":  checkers.WARNING, // non-critical
+	"lnc": checkers.WARNING,
+	"unc": checkers.WARNING,
+	"cr":  checkers.CRITICAL, // critical
+	"lcr": checkers.CRITICAL,
+	"ucr": checkers.CRITICAL,
+	"nr":  checkers.CRITICAL, // non-recoverable
+	"lnr": checkers.CRITICAL,
+	"unr": checkers.CRITICAL,
+}
+
+// discreteFaults are the states of the discrete sensors, such as power supplies and drive slots,
+// which are faults. ipmitool shows them as ok since they have no thresholds.
+var discreteFaults = map[string]checkers.Status{
+	"Failure detected":        checkers.CRITICAL,
+	"Power Supply AC lost":    checkers.CRITICAL,
+	"AC lost or out-of-range": checkers.CRITICAL,
+	"Drive Fault":             checkers.CRITICAL,
+	"Predictive failure":      checkers.WARNING,
+	"Config Error":            checkers.WARNING,
+	"Redundancy Lost":         checkers.WARNING,
+	"Redundancy Degraded":     checkers.WARNING,
+}
+
+func parseSensors(out []byte) []sensor {
+	var sensors []sensor
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		f := strings.Split(s.Text(), "|")
+		if len(f) != 5 {
+			continue
+		}
+		sensors = append(sensors, sensor{
+			name:    strings.TrimSpace(f[0]),
+			status:  strings.TrimSpace(f[2]),
+			reading: strings.TrimSpace(f[4]),
+		})
+	}
+	return sensors
+}
+
+func (s sensor) evaluate() (checkers.Status, string) {
+	msg := fmt.Sprintf("%s: %s", s.name, s.reading)
+	if st, ok := sensorStatuses[s.status]; ok {
+		return st, fmt.Sprintf("%s (%s)", msg, s.status)
+	}
+	st := checkers.OK
+	for _, state := range strings.Split(s.reading, ",") {
+		if f, ok := discreteFaults[strings.TrimSpace(state)]; ok && f > st {
+			st = f
+		}
+	}
+	return st, msg
+}
@@ -5,34 +5,53 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type jmxJolokiaOpts struct {
-	HostName  string  `short:"H" long:"host" required:"true" description:"Host name or IP Address"`
-	Port      int     `short:"p" long:"port" default:"8778" description:"Port"`
-	Timeout   int     `short:"t" long:"timeout" default:"10" description:"Seconds before connection times out"`
-	MBean     string  `short:"m" long:"mbean" required:"true" description:"MBean"`
-	Attribute string  `short:"a" long:"attribute" required:"true" description:"Attribute"`
-	InnerPath string  `short:"i" long:"inner-path" description:"InnerPath"`
-	Key       string  `short:"k" long:"key" default:"value" description:"Key"`
-	Warning   float64 `short:"w" long:"warning" description:"Trigger a warning if over a number"`
-	Critical  float64 `short:"c" long:"critical" description:"Trigger a critical if over a number"`
+	HostName   string  `short:"H" long:"host" required:"true" description:"Host name or IP Address"`
+	Port       int     `short:"p" long:"port" default:"8778" description:"Port"`
+	Path       string  `long:"path" default:"/jolokia" description:"Path to the Jolokia agent"`
+	User       string  `long:"user" description:"Username for basic authentication"`
+	Password   string  `long:"password" description:"Password for basic authentication" env:"JOLOKIA_PASSWORD"`
+	Timeout    int     `short:"t" long:"timeout" default:"10" description:"Seconds before connection times out"`
+	MBean      string  `short:"m" long:"mbean" required:"true" description:"MBean"`
+	Attribute  string  `short:"a" long:"attribute" description:"Attribute"`
+	InnerPath  string  `short:"i" long:"inner-path" description:"InnerPath"`
+	Expression string  `short:"e" long:"expression" description:"Arithmetic expression of the attributes to check instead of --attribute"`
+	Key        string  `short:"k" long:"key" default:"value" description:"Key"`
+	Warning    float64 `short:"w" long:"warning" description:"Trigger a warning if over a number"`
+	Critical   float64 `short:"c" long:"critical" description:"Trigger a critical if over a number"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 type jmxJolokiaResponse struct {
 	Status int
-	Value  float64
+	Value  json.RawMessage
+	Error  string
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Jmx-Jolokia"
-	ckr.Exit()
+	return ckr
 }
 
 func parseArgs(args []string) (*jmxJolokiaOpts, error) {
@@ -41,55 +60,185 @@ func parseArgs(args []string) (*jmxJolokiaOpts, error) {
 	return opts, err
 }
 
+// escapePathElement escapes a path element of a Jolokia GET request.
+// An MBean name such as Catalina:type=Manager,context=/,host=localhost contains
+// slashes which must be escaped with "!" so that Jolokia doesn't split the path there.
+// ref. https://jolokia.org/reference/html/protocol.html#escape-rules
+func escapePathElement(s string) string {
+	s = strings.ReplaceAll(s, "!", "!!")
+	s = strings.ReplaceAll(s, `"`, `!"`)
+	s = strings.ReplaceAll(s, "/", "!/")
+	return urlPathReplacer.Replace(s)
+}
+
+// urlPathReplacer escapes characters which are not allowed in a URL path.
+// MBean names usually contain ':', '=' and ',' and they are left as is.
+var urlPathReplacer = strings.NewReplacer(
+	"%", "%25",
+	" ", "%20",
+	`"`, "%22",
+	"#", "%23",
+	"?", "%3F",
+)
+
 func createURL(opts *jmxJolokiaOpts) string {
-	if opts.InnerPath == "" {
-		return fmt.Sprintf("http://%s:%d/jolokia/read/%s/%s", opts.HostName, opts.Port, opts.MBean, opts.Attribute)
+	return readURL(opts, opts.Attribute, opts.InnerPath)
+}
+
+func readURL(opts *jmxJolokiaOpts, attribute, innerPath string) string {
+	path := "/" + strings.Trim(opts.Path, "/")
+	if path == "/" {
+		path = ""
+	}
+	u := fmt.Sprintf("http://%s:%d%s/read/%s/%s", opts.HostName, opts.Port, path, escapePathElement(opts.MBean), escapePathElement(attribute))
+	if innerPath == "" {
+		return u
+	}
+	// InnerPath is a slash separated path such as "used" or "Total/Count"
+	return u + "/" + innerPath
+}
+
+func parseValue(raw json.RawMessage) (float64, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	case nil:
+		return 0, fmt.Errorf("value is null")
+	case map[string]interface{}:
+		return 0, fmt.Errorf("value is not a number; specify --inner-path to select the number in %s", string(raw))
+	default:
+		return 0, fmt.Errorf("value is not a number: %s", string(raw))
 	}
-	return fmt.Sprintf("http://%s:%d/jolokia/read/%s/%s/%s", opts.HostName, opts.Port, opts.MBean, opts.Attribute, opts.InnerPath)
 }
 
 func run(args []string) *checkers.Checker {
 	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.HostName))
+	}
+	if opts.Password, err = opts.ResolvePassword(opts.Password); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	opts.DebugOpts.Enable()
+	client := &http.Client{
+		Transport: debuglog.Transport(nil),
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+	}
+	if opts.Expression != "" {
+		return checkExpression(client, opts)
+	}
+	if opts.Attribute == "" {
+		return checkers.Unknown("either --attribute or --expression is required")
 	}
 
-	client := &http.Client{Timeout: time.Duration(opts.Timeout) * time.Second}
-	req, err := http.NewRequest(http.MethodGet, createURL(opts), nil)
+	value, ckr := read(client, opts, opts.Attribute, opts.InnerPath)
+	if ckr != nil {
+		return ckr
+	}
+	label := opts.Attribute
+	if opts.InnerPath != "" {
+		label += "/" + opts.InnerPath
+	}
+	return evaluate(opts, opts.Attribute, label, value)
+}
+
+// read reads the number of the attribute at the inner path.
+// It returns the checker to report if it has failed.
+func read(client *http.Client, opts *jmxJolokiaOpts, attribute, innerPath string) (float64, *checkers.Checker) {
+	req, err := http.NewRequest(http.MethodGet, readURL(opts, attribute, innerPath), nil)
 	if err != nil {
-		return checkers.Unknown(err.Error())
+		return 0, checkers.Unknown(err.Error())
 	}
 	req.Header.Set("User-Agent", "check-jmx-jolokia")
+	if opts.User != "" {
+		req.SetBasicAuth(opts.User, opts.Password)
+	}
 
 	res, err := client.Do(req)
 	if err != nil {
-		return checkers.Critical(err.Error())
+		return 0, checkers.Critical(err.Error())
 	}
 
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return checkers.Unknown(fmt.Sprintf("failed: http status code %d", res.StatusCode))
+		return 0, checkers.Unknown(fmt.Sprintf("failed: http status code %d", res.StatusCode))
 	}
 
 	resJ := jmxJolokiaResponse{}
 	dec := json.NewDecoder(res.Body)
 	if err := dec.Decode(&resJ); err != nil {
-		return checkers.Critical(err.Error())
+		return 0, checkers.Critical(err.Error())
 	}
 
 	if resJ.Status != 200 {
-		return checkers.Unknown(fmt.Sprintf("failed: response status %d", resJ.Status))
+		if resJ.Error != "" {
+			return 0, checkers.Unknown(fmt.Sprintf("failed: response status %d: %s", resJ.Status, resJ.Error))
+		}
+		return 0, checkers.Unknown(fmt.Sprintf("failed: response status %d", resJ.Status))
+	}
+
+	value, err := parseValue(resJ.Value)
+	if err != nil {
+		return 0, checkers.Unknown(fmt.Sprintf("%s %s: %s", opts.MBean, attribute, err))
+	}
+	return value, nil
+}
+
+// checkExpression reads the attributes referred in the expression and checks the result.
+func checkExpression(client *http.Client, opts *jmxJolokiaOpts) *checkers.Checker {
+	expr, refs, err := parseExpression(opts.Expression)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	values := make(map[string]float64, len(refs))
+	for _, ref := range refs {
+		attribute, innerPath := ref, ""
+		if i := strings.Index(ref, "/"); i >= 0 {
+			attribute, innerPath = ref[:i], ref[i+1:]
+		}
+		v, ckr := read(client, opts, attribute, innerPath)
+		if ckr != nil {
+			return ckr
+		}
+		values[ref] = v
 	}
+	value, err := expr.eval(values)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("%s %s: %s", opts.MBean, opts.Expression, err))
+	}
+	// the performance data is separated by spaces
+	return evaluate(opts, opts.Expression, strings.Join(strings.Fields(opts.Expression), ""), value)
+}
 
+// evaluate checks the value of the attribute or the expression, and appends it as the performance data of the label.
+func evaluate(opts *jmxJolokiaOpts, name, label string, value float64) *checkers.Checker {
 	checkSt := checkers.OK
-	msg := fmt.Sprintf("%s %s value %f", opts.MBean, opts.Attribute, resJ.Value)
-	if resJ.Value > opts.Critical {
+	msg := fmt.Sprintf("%s %s value %f", opts.MBean, name, value)
+	if value > opts.Critical {
 		checkSt = checkers.CRITICAL
-		msg = fmt.Sprintf("%s %s value is over %f > %f", opts.MBean, opts.Attribute, resJ.Value, opts.Critical)
-	} else if resJ.Value > opts.Warning {
+		msg = fmt.Sprintf("%s %s value is over %f > %f", opts.MBean, name, value, opts.Critical)
+	} else if value > opts.Warning {
 		checkSt = checkers.WARNING
-		msg = fmt.Sprintf("%s %s value is over %f > %f", opts.MBean, opts.Attribute, resJ.Value, opts.Warning)
+		msg = fmt.Sprintf("%s %s value is over %f > %f", opts.MBean, name, value, opts.Warning)
 	}
+	msg += " | " + perfdata.Format(label, formatFloat(value), "", formatFloat(opts.Warning), formatFloat(opts.Critical))
 
 	return checkers.NewChecker(checkSt, msg)
 }
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
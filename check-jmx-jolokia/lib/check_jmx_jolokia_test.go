@@ -0,0 +1,150 @@
+package checkjmxjolokia
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateURL(t *testing.T) {
+	tests := []struct {
+		opts jmxJolokiaOpts
+		want string
+	}{
+		{
+			opts: jmxJolokiaOpts{HostName: "127.0.0.1", Port: 8778, Path: "/jolokia", MBean: "java.lang:type=Memory", Attribute: "HeapMemoryUsage", InnerPath: "used"},
+			want: "http://127.0.0.1:8778/jolokia/read/java.lang:type=Memory/HeapMemoryUsage/used",
+		},
+		{
+			opts: jmxJolokiaOpts{HostName: "127.0.0.1", Port: 8080, Path: "/jolokia-war/", MBean: "Catalina:type=Manager,context=/,host=localhost", Attribute: "activeSessions"},
+			want: "http://127.0.0.1:8080/jolokia-war/read/Catalina:type=Manager,context=!/,host=localhost/activeSessions",
+		},
+		{
+			opts: jmxJolokiaOpts{HostName: "127.0.0.1", Port: 8778, Path: "/", MBean: `Catalina:type=ThreadPool,name="http-nio-8080"`, Attribute: "currentThreadsBusy"},
+			want: "http://127.0.0.1:8778/read/Catalina:type=ThreadPool,name=!%22http-nio-8080!%22/currentThreadsBusy",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, createURL(&tt.opts))
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	v, err := parseValue(json.RawMessage(`12.5`))
+	assert.Nil(t, err)
+	assert.Equal(t, 12.5, v)
+
+	v, err = parseValue(json.RawMessage(`true`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, v)
+
+	_, err = parseValue(json.RawMessage(`{"used":100,"max":200}`))
+	assert.NotNil(t, err)
+
+	_, err = parseValue(json.RawMessage(`null`))
+	assert.NotNil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "monitor" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/jolokia/read/java.lang:type=Memory/HeapMemoryUsage/used":
+			w.Write([]byte(`{"status":200,"value":150}`))
+		case "/jolokia/read/java.lang:type=Memory/HeapMemoryUsage":
+			w.Write([]byte(`{"status":200,"value":{"used":150,"max":200}}`))
+		default:
+			w.Write([]byte(`{"status":404,"error":"javax.management.InstanceNotFoundException"}`))
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	base := []string{"-H", host, "-p", port, "--user", "monitor", "--password", "secret", "-m", "java.lang:type=Memory", "-a", "HeapMemoryUsage"}
+
+	tests := []struct {
+		args []string
+		want checkers.Status
+	}{
+		{args: append([]string{"-i", "used", "-w", "100", "-c", "200"}, base...), want: checkers.WARNING},
+		{args: append([]string{"-i", "used", "-w", "200", "-c", "300"}, base...), want: checkers.OK},
+		{args: append([]string{"-i", "used", "-w", "10", "-c", "100"}, base...), want: checkers.CRITICAL},
+		{args: append([]string{"-w", "100", "-c", "200"}, base...), want: checkers.UNKNOWN},
+		{args: append([]string{"-i", "unknown"}, base...), want: checkers.UNKNOWN},
+	}
+	for _, tt := range tests {
+		ckr := run(tt.args)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+
+	ckr := run(append([]string{"-i", "used", "-w", "200", "-c", "300"}, base...))
+	assert.Equal(t, "java.lang:type=Memory HeapMemoryUsage value 150.000000 | 'HeapMemoryUsage/used'=150;200;300", ckr.Message)
+}
+
+func TestRunExpression(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/jolokia/read/java.lang:type=Memory/HeapMemoryUsage/used":
+			w.Write([]byte(`{"status":200,"value":150}`))
+		case "/jolokia/read/java.lang:type=Memory/HeapMemoryUsage/max":
+			w.Write([]byte(`{"status":200,"value":200}`))
+		case "/jolokia/read/java.lang:type=Memory/NonHeapMemoryUsage/max":
+			w.Write([]byte(`{"status":200,"value":0}`))
+		default:
+			w.Write([]byte(`{"status":404,"error":"javax.management.InstanceNotFoundException"}`))
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	base := []string{"-H", host, "-p", port, "-m", "java.lang:type=Memory"}
+
+	tests := []struct {
+		args []string
+		want checkers.Status
+		msg  string
+	}{
+		{
+			args: append([]string{"-e", "HeapMemoryUsage/used / HeapMemoryUsage/max * 100", "-w", "70", "-c", "90"}, base...),
+			want: checkers.WARNING,
+			msg:  "java.lang:type=Memory HeapMemoryUsage/used / HeapMemoryUsage/max * 100 value is over 75.000000 > 70.000000 | 'HeapMemoryUsage/used/HeapMemoryUsage/max*100'=75;70;90",
+		},
+		{
+			args: append([]string{"-e", "HeapMemoryUsage/max - HeapMemoryUsage/used", "-w", "100", "-c", "200"}, base...),
+			want: checkers.OK,
+			msg:  "java.lang:type=Memory HeapMemoryUsage/max - HeapMemoryUsage/used value 50.000000 | 'HeapMemoryUsage/max-HeapMemoryUsage/used'=50;100;200",
+		},
+		{
+			args: append([]string{"-e", "HeapMemoryUsage/used / NonHeapMemoryUsage/max"}, base...),
+			want: checkers.UNKNOWN,
+			msg:  "java.lang:type=Memory HeapMemoryUsage/used / NonHeapMemoryUsage/max: division by zero",
+		},
+		{
+			args: append([]string{"-e", "HeapMemoryUsage/used / Unknown"}, base...),
+			want: checkers.UNKNOWN,
+			msg:  "failed: response status 404: javax.management.InstanceNotFoundException",
+		},
+		{
+			args: base,
+			want: checkers.UNKNOWN,
+			msg:  "either --attribute or --expression is required",
+		},
+	}
+	for _, tt := range tests {
+		ckr := run(tt.args)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
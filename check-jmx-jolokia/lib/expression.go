@@ -0,0 +1,208 @@
+package checkjmxjolokia
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// expression is an arithmetic expression of the attributes of an MBean,
+// such as "HeapMemoryUsage/used / HeapMemoryUsage/max * 100".
+//
+// An attribute is referred to by its name optionally followed by the inner path,
+// like --attribute and --inner-path. "/" directly followed by a name is a part
+// of the path, so the division must be separated with spaces.
+type expression interface {
+	eval(values map[string]float64) (float64, error)
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(map[string]float64) (float64, error) {
+	return float64(e), nil
+}
+
+// refExpr is a reference to the attribute with the inner path, such as "HeapMemoryUsage/used".
+type refExpr string
+
+func (e refExpr) eval(values map[string]float64) (float64, error) {
+	v, ok := values[string(e)]
+	if !ok {
+		return 0, fmt.Errorf("%s is not read", string(e))
+	}
+	return v, nil
+}
+
+type negExpr struct {
+	x expression
+}
+
+func (e negExpr) eval(values map[string]float64) (float64, error) {
+	x, err := e.x.eval(values)
+	return -x, err
+}
+
+type binaryExpr struct {
+	op   byte
+	l, r expression
+}
+
+func (e binaryExpr) eval(values map[string]float64) (float64, error) {
+	l, err := e.l.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.r.eval(values)
+	if err != nil {
+		return 0, err
+	}
+	switch e.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	default:
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+}
+
+// parseExpression parses s and returns the expression and the attribute references in it.
+func parseExpression(s string) (expression, []string, error) {
+	p := &exprParser{s: s, seen: make(map[string]bool)}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, nil, fmt.Errorf("unexpected %q at %d in the expression", p.s[p.pos], p.pos+1)
+	}
+	return e, p.refs, nil
+}
+
+type exprParser struct {
+	s    string
+	pos  int
+	refs []string
+	seen map[string]bool
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// next returns the next operator character without consuming it, or 0 at the end.
+func (p *exprParser) next() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *exprParser) parseSum() (expression, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.next()
+		if op != '+' && op != '-' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseProduct() (expression, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.next()
+		if op != '*' && op != '/' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+}
+
+func (p *exprParser) parseUnary() (expression, error) {
+	switch c := p.next(); {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of the expression")
+	case c == '-':
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{x: x}, nil
+	case c == '(':
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ')' {
+			return nil, fmt.Errorf("missing ')' at %d in the expression", p.pos+1)
+		}
+		p.pos++
+		return e, nil
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && (isDigit(p.s[p.pos]) || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in the expression", p.s[start:p.pos])
+		}
+		return numberExpr(v), nil
+	case isNameStart(c):
+		start := p.pos
+		for p.pos < len(p.s) {
+			c := p.s[p.pos]
+			if isNameStart(c) || isDigit(c) || c == '.' {
+				p.pos++
+			} else if c == '/' && p.pos+1 < len(p.s) && isNameStart(p.s[p.pos+1]) {
+				p.pos++
+			} else {
+				break
+			}
+		}
+		ref := p.s[start:p.pos]
+		if !p.seen[ref] {
+			p.seen[ref] = true
+			p.refs = append(p.refs, ref)
+		}
+		return refExpr(ref), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d in the expression", c, p.pos+1)
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,54 @@
+package checkjmxjolokia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpression(t *testing.T) {
+	values := map[string]float64{
+		"HeapMemoryUsage/used":      150,
+		"HeapMemoryUsage/max":       200,
+		"ThreadCount":               40,
+		"Usage/Total/Count":         3,
+		"CollectionUsage.Threshold": 10,
+	}
+	tests := []struct {
+		expr    string
+		refs    []string
+		want    float64
+		evalErr bool
+	}{
+		{"HeapMemoryUsage/used / HeapMemoryUsage/max * 100", []string{"HeapMemoryUsage/used", "HeapMemoryUsage/max"}, 75, false},
+		// the division without spaces is a part of the path
+		{"100 * HeapMemoryUsage/used/HeapMemoryUsage/max", []string{"HeapMemoryUsage/used/HeapMemoryUsage/max"}, 0, true},
+		{"HeapMemoryUsage/used / (HeapMemoryUsage/max - 200)", []string{"HeapMemoryUsage/used", "HeapMemoryUsage/max"}, 0, true},
+		{"ThreadCount - 2 * Usage/Total/Count", []string{"ThreadCount", "Usage/Total/Count"}, 34, false},
+		{"(ThreadCount - 2) * Usage/Total/Count", []string{"ThreadCount", "Usage/Total/Count"}, 114, false},
+		{"-ThreadCount + 100 / (4 - -1)", []string{"ThreadCount"}, -20, false},
+		{"ThreadCount + ThreadCount", []string{"ThreadCount"}, 80, false},
+		{"CollectionUsage.Threshold", []string{"CollectionUsage.Threshold"}, 10, false},
+	}
+	for _, tt := range tests {
+		e, refs, err := parseExpression(tt.expr)
+		if !assert.Nil(t, err, tt.expr) {
+			continue
+		}
+		assert.Equal(t, tt.refs, refs, tt.expr)
+		v, err := e.eval(values)
+		if tt.evalErr {
+			assert.NotNil(t, err, tt.expr)
+			continue
+		}
+		assert.Nil(t, err, tt.expr)
+		assert.Equal(t, tt.want, v, tt.expr)
+	}
+}
+
+func TestParseExpressionError(t *testing.T) {
+	for _, s := range []string{"", "ThreadCount +", "(ThreadCount", "ThreadCount)", "ThreadCount % 2", "1..2", "1.5e0"} {
+		_, _, err := parseExpression(s)
+		assert.NotNil(t, err, s)
+	}
+}
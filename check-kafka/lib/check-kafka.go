@@ -0,0 +1,207 @@
+package checkkafka
+
+import (
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/xdg/scram"
+)
+
+// kafkaSetting is common options to connect to the Kafka brokers.
+type kafkaSetting struct {
+	BootstrapServer  string `short:"b" long:"bootstrap-server" default:"localhost:9092" description:"Kafka servers to connect to, separated by commas"`
+	KafkaVersion     string `long:"kafka-version" default:"2.0.0" description:"Version of the Kafka brokers"`
+	SASLUsername     string `long:"sasl-username" description:"Username of the SASL authentication"`
+	SASLPassword     string `long:"sasl-password" env:"KAFKA_SASL_PASSWORD" description:"Password of the SASL authentication"`
+	SASLMechanism    string `long:"sasl-mechanism" choice:"PLAIN" choice:"SCRAM-SHA-256" choice:"SCRAM-SHA-512" default:"PLAIN" description:"SASL mechanism"`
+	SecurityProtocol string `long:"security-protocol" choice:"PLAINTEXT" choice:"SSL" choice:"SASL_PLAINTEXT" choice:"SASL_SSL" description:"Security protocol (default: SASL_SSL with --sasl-username, PLAINTEXT otherwise)"`
+	TLSCAFile        string `long:"tls-ca-file" value-name:"FILE" description:"The root certificate used for TLS certificate verification"`
+	Timeout          int    `short:"t" long:"timeout" default:"30" description:"Seconds before the requests time out"`
+
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"lag":        checkLag,
+	"partitions": checkPartitions,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-kafka [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Kafka"
+		return ckr
+	}
+	ckr := fn(argv)
+	ckr.Name = fmt.Sprintf("Kafka %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
+	return ckr
+}
+
+// securityProtocol returns --security-protocol, or the default for --sasl-username.
+func (s kafkaSetting) securityProtocol() string {
+	switch {
+	case s.SecurityProtocol != "":
+		return s.SecurityProtocol
+	case s.SASLUsername != "":
+		return "SASL_SSL"
+	default:
+		return "PLAINTEXT"
+	}
+}
+
+func (s kafkaSetting) brokers() []string {
+	var brokers []string
+	for _, server := range strings.Split(s.BootstrapServer, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			brokers = append(brokers, server)
+		}
+	}
+	return brokers
+}
+
+// config returns the configuration of the client. The SASL credentials are resolved here.
+func (s kafkaSetting) config() (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(s.KafkaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kafka-version: %s", err)
+	}
+	config := sarama.NewConfig()
+	config.ClientID = "check-kafka"
+	config.Version = version
+	timeout := time.Duration(s.Timeout) * time.Second
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	config.Admin.Timeout = timeout
+
+	protocol := s.securityProtocol()
+	if strings.HasSuffix(protocol, "SSL") {
+		tlsConfig := &tls.Config{}
+		if s.TLSCAFile != "" {
+			pem, err := ioutil.ReadFile(s.TLSCAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", s.TLSCAFile)
+			}
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	if strings.HasPrefix(protocol, "SASL_") {
+		if s.SASLUsername == "" {
+			return nil, fmt.Errorf("--sasl-username is required with --security-protocol=%s", protocol)
+		}
+		username, password := s.SASLUsername, s.SASLPassword
+		if err := secret.ResolveAll(&username, &password); err != nil {
+			return nil, err
+		}
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = username
+		config.Net.SASL.Password = password
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(s.SASLMechanism)
+		switch s.SASLMechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA256} }
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.HashGeneratorFcn(sha512.New)} }
+		}
+	}
+	return config, nil
+}
+
+// connect returns the client connected to one of the bootstrap servers, which must be closed by the caller.
+func (s kafkaSetting) connect() (sarama.Client, error) {
+	s.DebugOpts.Enable()
+	config, err := s.config()
+	if err != nil {
+		return nil, err
+	}
+	brokers := s.brokers()
+	end := debuglog.Trace("connect: %s (%s)", strings.Join(brokers, ","), s.securityProtocol())
+	client, err := sarama.NewClient(brokers, config)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// scramClient is the SCRAM conversation of the SASL authentication.
+type scramClient struct {
+	hash scram.HashGeneratorFcn
+	conv *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hash.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conv = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conv.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conv.Done()
+}
+
+// selfTest validates the options and that the bootstrap servers can be resolved.
+func (s kafkaSetting) selfTest() *checkers.Checker {
+	checks := []selftest.Check{func() error {
+		if _, err := sarama.ParseKafkaVersion(s.KafkaVersion); err != nil {
+			return fmt.Errorf("invalid --kafka-version: %s", err)
+		}
+		return nil
+	}}
+	for _, server := range s.brokers() {
+		checks = append(checks, selftest.Resolve(server))
+	}
+	if strings.HasPrefix(s.securityProtocol(), "SASL_") {
+		checks = append(checks, selftest.Required("--sasl-username", s.SASLUsername))
+	}
+	if s.TLSCAFile != "" {
+		checks = append(checks, selftest.Readable(s.TLSCAFile))
+	}
+	return selftest.Run(checks...)
+}
@@ -0,0 +1,229 @@
+package checkkafka
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockBroker returns the broker which is the controller and the coordinator of the group billing.
+func newMockBroker(t *testing.T, handlers map[string]sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	if _, ok := handlers["MetadataRequest"]; !ok {
+		handlers["MetadataRequest"] = sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("invoices", 0, broker.BrokerID()).
+			SetLeader("invoices", 1, broker.BrokerID()).
+			SetLeader("payments", 0, broker.BrokerID()).
+			SetLeader("refunds", 0, broker.BrokerID())
+	}
+	handlers["FindCoordinatorRequest"] = sarama.NewMockFindCoordinatorResponse(t).
+		SetCoordinator(sarama.CoordinatorGroup, "billing", broker)
+	broker.SetHandlerByMap(handlers)
+	return broker
+}
+
+func TestFetchLags(t *testing.T) {
+	broker := newMockBroker(t, map[string]sarama.MockResponse{
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("billing", "invoices", 0, 1200, "", sarama.ErrNoError).
+			SetOffset("billing", "invoices", 1, 800, "", sarama.ErrNoError).
+			SetOffset("billing", "payments", 0, -1, "", sarama.ErrNoError).
+			SetOffset("billing", "refunds", 0, 10, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("invoices", 0, sarama.OffsetNewest, 1500).
+			SetOffset("invoices", 1, sarama.OffsetNewest, 850).
+			SetOffset("payments", 0, sarama.OffsetNewest, 42).
+			SetOffset("refunds", 0, sarama.OffsetNewest, 10),
+	})
+	defer broker.Close()
+
+	opts := &lagOpts{kafkaSetting: kafkaSetting{BootstrapServer: broker.Addr(), KafkaVersion: "2.0.0", Timeout: 5}, Group: "billing"}
+	lags, err := opts.fetchLags(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []partitionLag{
+		{topic: "invoices", partition: 0, lag: 300},
+		{topic: "invoices", partition: 1, lag: 50},
+		{topic: "refunds", partition: 0, lag: 0},
+	}, lags)
+
+	lags, err = opts.fetchLags(regexp.MustCompile("^ref"))
+	assert.Nil(t, err)
+	assert.Equal(t, []partitionLag{{topic: "refunds", partition: 0, lag: 0}}, lags)
+}
+
+func TestFetchLagsError(t *testing.T) {
+	broker := newMockBroker(t, map[string]sarama.MockResponse{
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).SetError(sarama.ErrGroupAuthorizationFailed),
+	})
+	defer broker.Close()
+
+	opts := &lagOpts{kafkaSetting: kafkaSetting{BootstrapServer: broker.Addr(), KafkaVersion: "2.0.0", Timeout: 5}, Group: "billing"}
+	_, err := opts.fetchLags(nil)
+	assert.EqualError(t, err, "failed to list the offsets of consumer group billing: kafka server: The client is not authorized to access this group.")
+}
+
+var testLags = []partitionLag{
+	{topic: "invoices", partition: 0, lag: 300},
+	{topic: "invoices", partition: 1, lag: 50},
+	{topic: "refunds", partition: 0, lag: 0},
+}
+
+func TestEvaluateLag(t *testing.T) {
+	tests := []struct {
+		warning, critical                   int64
+		warningPartition, criticalPartition int64
+		want                                checkers.Status
+		msg                                 string
+	}{
+		{
+			want: checkers.OK,
+			msg:  "group billing: invoices lag 350, refunds lag 0 | invoices=350;; invoices_max_partition=300;; refunds=0;; refunds_max_partition=0;;",
+		},
+		{
+			warning: 300, critical: 1000,
+			want: checkers.WARNING,
+			msg:  "group billing: invoices lag 350 > 300, refunds lag 0 | invoices=350;300;1000 invoices_max_partition=300;; refunds=0;300;1000 refunds_max_partition=0;;",
+		},
+		{
+			warning: 100, critical: 300,
+			want: checkers.CRITICAL,
+			msg:  "group billing: invoices lag 350 > 300, refunds lag 0 | invoices=350;100;300 invoices_max_partition=300;; refunds=0;100;300 refunds_max_partition=0;;",
+		},
+		{
+			warning: 1000, warningPartition: 100, criticalPartition: 250,
+			want: checkers.CRITICAL,
+			msg:  "group billing: invoices lag 350, invoices partition 0 lag 300 > 250, refunds lag 0 | invoices=350;1000; invoices_max_partition=300;100;250 refunds=0;1000; refunds_max_partition=0;100;250",
+		},
+	}
+	for _, tt := range tests {
+		opts := &lagOpts{Group: "billing", Warning: tt.warning, Critical: tt.critical, WarningPartition: tt.warningPartition, CriticalPartition: tt.criticalPartition}
+		ckr := opts.evaluate(testLags)
+		assert.Equal(t, tt.want, ckr.Status)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+var testPartitions = []partitionState{
+	{topic: "orders", partition: 0, leader: 1, replicas: []int32{1, 2, 3}, isr: []int32{1, 2}},
+	{topic: "orders", partition: 3, leader: 2, replicas: []int32{2, 3, 1}, isr: []int32{2}},
+	{topic: "payments", partition: 1, leader: -1, replicas: []int32{3}},
+}
+
+func TestDescribePartitions(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	metadata := &sarama.MetadataResponse{Version: 5, ControllerID: broker.BrokerID()}
+	metadata.AddBroker(broker.Addr(), broker.BrokerID())
+	metadata.AddTopicPartition("payments", 1, -1, []int32{3}, nil, []int32{3}, sarama.ErrLeaderNotAvailable)
+	metadata.AddTopicPartition("orders", 3, 2, []int32{2, 3, 1}, []int32{2}, nil, sarama.ErrNoError)
+	metadata.AddTopicPartition("orders", 0, 1, []int32{1, 2, 3}, []int32{1, 2}, nil, sarama.ErrNoError)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockWrapper(metadata),
+	})
+
+	opts := &partitionsOpts{kafkaSetting: kafkaSetting{BootstrapServer: broker.Addr(), KafkaVersion: "2.0.0", Timeout: 5}}
+	partitions, err := opts.describePartitions(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, testPartitions, partitions)
+	assert.Equal(t, []int32{3, 1}, partitions[1].missing())
+
+	partitions, err = opts.describePartitions(regexp.MustCompile("^pay"))
+	assert.Nil(t, err)
+	assert.Equal(t, testPartitions[2:], partitions)
+}
+
+func TestEvaluatePartitions(t *testing.T) {
+	partitions := testPartitions
+	one := int64(1)
+	tests := []struct {
+		opts            partitionsOpts
+		underReplicated []partitionState
+		offline         []partitionState
+		want            checkers.Status
+		msg             string
+	}{
+		{
+			opts: partitionsOpts{},
+			want: checkers.OK,
+			msg:  "no under-replicated or offline partitions",
+		},
+		{
+			opts:            partitionsOpts{Critical: &one},
+			underReplicated: partitions[:1],
+			want:            checkers.WARNING,
+			msg:             "1 under-replicated partitions (orders-0 missing 3)",
+		},
+		{
+			opts:            partitionsOpts{Critical: &one},
+			underReplicated: partitions[:2],
+			want:            checkers.CRITICAL,
+			msg:             "2 under-replicated partitions (orders-0 missing 3, orders-3 missing 3,1)",
+		},
+		{
+			opts:            partitionsOpts{Warning: 5},
+			underReplicated: partitions[:2],
+			want:            checkers.OK,
+			msg:             "2 under-replicated partitions (orders-0 missing 3, orders-3 missing 3,1)",
+		},
+		{
+			opts:            partitionsOpts{Warning: 5},
+			underReplicated: partitions,
+			offline:         partitions[2:],
+			want:            checkers.CRITICAL,
+			msg:             "3 under-replicated partitions (orders-0 missing 3, orders-3 missing 3,1, payments-1 missing 3), 1 offline partitions (payments-1)",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(tt.underReplicated, tt.offline)
+		assert.Equal(t, tt.want, ckr.Status)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	os.Setenv("CHECK_KAFKA_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("CHECK_KAFKA_TEST_PASSWORD")
+
+	s := kafkaSetting{SASLUsername: "monitor", SASLPassword: "env://CHECK_KAFKA_TEST_PASSWORD", SASLMechanism: "SCRAM-SHA-512", KafkaVersion: "2.0.0", Timeout: 10}
+	config, err := s.config()
+	assert.Nil(t, err)
+	assert.True(t, config.Net.TLS.Enable)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, "monitor", config.Net.SASL.User)
+	assert.Equal(t, "secret", config.Net.SASL.Password)
+	assert.Equal(t, sarama.SASLMechanism("SCRAM-SHA-512"), config.Net.SASL.Mechanism)
+	assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.Equal(t, 10*time.Second, config.Net.ReadTimeout)
+	assert.Nil(t, config.Validate())
+
+	s = kafkaSetting{SASLUsername: "monitor", SASLPassword: "secret", SASLMechanism: "PLAIN", SecurityProtocol: "SASL_PLAINTEXT", KafkaVersion: "2.0.0", Timeout: 10}
+	config, err = s.config()
+	assert.Nil(t, err)
+	assert.False(t, config.Net.TLS.Enable)
+	assert.True(t, config.Net.SASL.Enable)
+
+	s = kafkaSetting{KafkaVersion: "2.0.0", Timeout: 10}
+	config, err = s.config()
+	assert.Nil(t, err)
+	assert.False(t, config.Net.TLS.Enable)
+	assert.False(t, config.Net.SASL.Enable)
+
+	s.SecurityProtocol = "SASL_SSL"
+	_, err = s.config()
+	assert.EqualError(t, err, "--sasl-username is required with --security-protocol=SASL_SSL")
+
+	s = kafkaSetting{SASLUsername: "monitor", SASLPassword: "env://CHECK_KAFKA_TEST_UNSET", SASLMechanism: "PLAIN", KafkaVersion: "2.0.0"}
+	_, err = s.config()
+	assert.EqualError(t, err, "failed to resolve the secret env://CHECK_KAFKA_TEST_UNSET: environment variable CHECK_KAFKA_TEST_UNSET is not set")
+
+	s = kafkaSetting{KafkaVersion: "2.x"}
+	_, err = s.config()
+	assert.EqualError(t, err, "invalid --kafka-version: invalid version `2.x`")
+}
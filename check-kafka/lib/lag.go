@@ -0,0 +1,191 @@
+package checkkafka
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+)
+
+type lagOpts struct {
+	kafkaSetting
+	Group    string `short:"g" long:"group" required:"true" description:"Consumer group to check"`
+	Topic    string `long:"topic" value-name:"REGEXP" description:"Check only topics whose name matches the pattern"`
+	Warning  int64  `short:"w" long:"warning" description:"warning if the total lag of a topic is over"`
+	Critical int64  `short:"c" long:"critical" description:"critical if the total lag of a topic is over"`
+
+	WarningPartition  int64 `long:"warning-partition" description:"warning if the lag of a partition is over"`
+	CriticalPartition int64 `long:"critical-partition" description:"critical if the lag of a partition is over"`
+}
+
+type partitionLag struct {
+	topic     string
+	partition int32
+	lag       int64
+}
+
+func checkLag(args []string) *checkers.Checker {
+	opts := lagOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "lag [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	var topicRe *regexp.Regexp
+	if opts.Topic != "" {
+		topicRe, err = regexp.Compile(opts.Topic)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	lags, err := opts.fetchLags(topicRe)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if len(lags) == 0 {
+		return checkers.Unknown(fmt.Sprintf("no committed offsets found for consumer group %s", opts.Group))
+	}
+	return opts.evaluate(lags)
+}
+
+// fetchLags returns the lags of the partitions of the topics matching topicRe, or all topics if it is nil,
+// which are the differences between the committed offsets of the group and the log end offsets.
+// Partitions without committed offsets are ignored.
+func (opts *lagOpts) fetchLags(topicRe *regexp.Regexp) ([]partitionLag, error) {
+	client, err := opts.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	end := debuglog.Trace("list the offsets of the consumer group %s", opts.Group)
+	offsets, err := admin.ListConsumerGroupOffsets(opts.Group, nil)
+	if err == nil && offsets.Err != sarama.ErrNoError {
+		err = offsets.Err
+	}
+	end(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the offsets of consumer group %s: %s", opts.Group, err)
+	}
+
+	var lags []partitionLag
+	for topic, blocks := range offsets.Blocks {
+		if topicRe != nil && !topicRe.MatchString(topic) {
+			continue
+		}
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("%s-%d: %s", topic, partition, block.Err)
+			}
+			if block.Offset < 0 {
+				continue
+			}
+			newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the log end offset of %s-%d: %s", topic, partition, err)
+			}
+			lag := newest - block.Offset
+			if lag < 0 {
+				// the log end offset was fetched before the offset was committed
+				lag = 0
+			}
+			lags = append(lags, partitionLag{topic: topic, partition: partition, lag: lag})
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].topic != lags[j].topic {
+			return lags[i].topic < lags[j].topic
+		}
+		return lags[i].partition < lags[j].partition
+	})
+	return lags, nil
+}
+
+// topicLag is the total lag of a topic and the partition with the max lag.
+type topicLag struct {
+	total int64
+	max   partitionLag
+}
+
+func (opts *lagOpts) evaluate(lags []partitionLag) *checkers.Checker {
+	topicLags := make(map[string]*topicLag)
+	for _, l := range lags {
+		t, ok := topicLags[l.topic]
+		if !ok {
+			t = &topicLag{max: l}
+			topicLags[l.topic] = t
+		}
+		t.total += l.lag
+		if l.lag > t.max.lag {
+			t.max = l
+		}
+	}
+	topics := make([]string, 0, len(topicLags))
+	for t := range topicLags {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+
+	checkSt := checkers.OK
+	raise := func(st checkers.Status) {
+		if st > checkSt {
+			checkSt = st
+		}
+	}
+	msgs := make([]string, 0, len(topics))
+	perfs := make([]string, 0, len(topics)*2)
+	for _, t := range topics {
+		tl := topicLags[t]
+		switch {
+		case opts.Critical > 0 && tl.total > opts.Critical:
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("%s lag %d > %d", t, tl.total, opts.Critical))
+		case opts.Warning > 0 && tl.total > opts.Warning:
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("%s lag %d > %d", t, tl.total, opts.Warning))
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s lag %d", t, tl.total))
+		}
+		max := tl.max
+		switch {
+		case opts.CriticalPartition > 0 && max.lag > opts.CriticalPartition:
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("%s partition %d lag %d > %d", t, max.partition, max.lag, opts.CriticalPartition))
+		case opts.WarningPartition > 0 && max.lag > opts.WarningPartition:
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("%s partition %d lag %d > %d", t, max.partition, max.lag, opts.WarningPartition))
+		}
+		perfs = append(perfs,
+			perfdata.Format(t, strconv.FormatInt(tl.total, 10), "", threshold(opts.Warning), threshold(opts.Critical)),
+			perfdata.Format(t+"_max_partition", strconv.FormatInt(max.lag, 10), "", threshold(opts.WarningPartition), threshold(opts.CriticalPartition)),
+		)
+	}
+	msg := fmt.Sprintf("group %s: %s | %s", opts.Group, strings.Join(msgs, ", "), strings.Join(perfs, " "))
+	return checkers.NewChecker(checkSt, msg)
+}
+
+// threshold formats the threshold for the performance data, which is not specified if it is 0.
+func threshold(v int64) string {
+	if v <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(v, 10)
+}
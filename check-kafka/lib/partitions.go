@@ -0,0 +1,172 @@
+package checkkafka
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+type partitionsOpts struct {
+	kafkaSetting
+	Topic    string `long:"topic" value-name:"REGEXP" description:"Check only topics whose name matches the pattern"`
+	Warning  int64  `short:"w" long:"warning" default:"0" description:"warning if the number of under-replicated partitions is over"`
+	Critical *int64 `short:"c" long:"critical" description:"critical if the number of under-replicated partitions is over"`
+}
+
+type partitionState struct {
+	topic     string
+	partition int32
+	leader    int32
+	replicas  []int32
+	isr       []int32
+}
+
+// missing returns the replicas which are not in sync.
+func (p partitionState) missing() []int32 {
+	var brokers []int32
+	for _, r := range p.replicas {
+		found := false
+		for _, i := range p.isr {
+			if r == i {
+				found = true
+				break
+			}
+		}
+		if !found {
+			brokers = append(brokers, r)
+		}
+	}
+	return brokers
+}
+
+func checkPartitions(args []string) *checkers.Checker {
+	opts := partitionsOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "partitions [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	var topicRe *regexp.Regexp
+	if opts.Topic != "" {
+		topicRe, err = regexp.Compile(opts.Topic)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	partitions, err := opts.describePartitions(topicRe)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var underReplicated, offline []partitionState
+	for _, p := range partitions {
+		if len(p.missing()) > 0 {
+			underReplicated = append(underReplicated, p)
+		}
+		if p.leader < 0 {
+			offline = append(offline, p)
+		}
+	}
+	return opts.evaluate(underReplicated, offline)
+}
+
+// describePartitions returns the partitions of the topics matching topicRe, or all topics if it is nil,
+// from the metadata of the controller.
+func (opts *partitionsOpts) describePartitions(topicRe *regexp.Regexp) ([]partitionState, error) {
+	client, err := opts.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	end := debuglog.Trace("describe the topics")
+	topics, err := admin.DescribeTopics(nil)
+	end(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the topics: %s", err)
+	}
+
+	var partitions []partitionState
+	for _, t := range topics {
+		if topicRe != nil && !topicRe.MatchString(t.Name) {
+			continue
+		}
+		if t.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("%s: %s", t.Name, t.Err)
+		}
+		for _, p := range t.Partitions {
+			partitions = append(partitions, partitionState{
+				topic:     t.Name,
+				partition: p.ID,
+				leader:    p.Leader,
+				replicas:  p.Replicas,
+				isr:       p.Isr,
+			})
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].topic != partitions[j].topic {
+			return partitions[i].topic < partitions[j].topic
+		}
+		return partitions[i].partition < partitions[j].partition
+	})
+	return partitions, nil
+}
+
+// joinIDs formats the IDs of the brokers.
+func joinIDs(ids []int32) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(int(id))
+	}
+	return strings.Join(s, ",")
+}
+
+// evaluate checks the under-replicated partitions with the thresholds.
+// Offline partitions, which have no leader, are always CRITICAL because they can't be read nor written.
+func (opts *partitionsOpts) evaluate(underReplicated, offline []partitionState) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	if n := int64(len(underReplicated)); n > 0 {
+		switch {
+		case opts.Critical != nil && n > *opts.Critical:
+			checkSt = checkers.CRITICAL
+		case n > opts.Warning:
+			checkSt = checkers.WARNING
+		}
+		names := make([]string, 0, len(underReplicated))
+		for _, p := range underReplicated {
+			names = append(names, fmt.Sprintf("%s-%d missing %s", p.topic, p.partition, joinIDs(p.missing())))
+		}
+		msgs = append(msgs, fmt.Sprintf("%d under-replicated partitions (%s)", n, strings.Join(names, ", ")))
+	}
+	if len(offline) > 0 {
+		checkSt = checkers.CRITICAL
+		names := make([]string, 0, len(offline))
+		for _, p := range offline {
+			names = append(names, fmt.Sprintf("%s-%d", p.topic, p.partition))
+		}
+		msgs = append(msgs, fmt.Sprintf("%d offline partitions (%s)", len(offline), strings.Join(names, ", ")))
+	}
+	if len(msgs) == 0 {
+		return checkers.Ok("no under-replicated or offline partitions")
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,162 @@
+package checkkubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeSetting is common options to connect to the API server.
+// When neither --kubeconfig nor $KUBECONFIG is given, ~/.kube/config is used,
+// or the service account of the pod when it runs in a cluster.
+type kubeSetting struct {
+	Kubeconfig string `long:"kubeconfig" value-name:"FILE" description:"Path to the kubeconfig file" env:"KUBECONFIG"`
+	Context    string `long:"context" description:"Name of the kubeconfig context to use"`
+	Timeout    int    `short:"t" long:"timeout" default:"30" description:"Seconds before the request times out"`
+
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// namespaceSetting is options to select namespaced resources.
+type namespaceSetting struct {
+	Namespace     string `short:"n" long:"namespace" description:"Namespace to check. The namespace of the context is used by default"`
+	AllNamespaces bool   `short:"A" long:"all-namespaces" description:"Check resources in all namespaces"`
+	Selector      string `short:"l" long:"selector" description:"Label selector to filter resources (e.g. app=web)"`
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"node":       checkNode,
+	"pod":        checkPod,
+	"deployment": checkDeployment,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-kubernetes [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Kubernetes"
+		return ckr
+	}
+	ckr := fn(argv)
+	ckr.Name = fmt.Sprintf("Kubernetes %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
+	return ckr
+}
+
+// clientConfig returns the config loaded from the kubeconfig files.
+// It falls back to the in-cluster config if no kubeconfig files are found.
+func (s kubeSetting) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if s.Kubeconfig != "" {
+		rules.Precedence = filepath.SplitList(s.Kubeconfig)
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: s.Context})
+}
+
+func (s kubeSetting) restConfig() (*rest.Config, error) {
+	config, err := s.clientConfig().ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = time.Duration(s.Timeout) * time.Second
+	config.WrapTransport = debuglog.Transport
+	return config, nil
+}
+
+// namespace returns the namespace to list the resources in.
+// It returns metav1.NamespaceAll for --all-namespaces.
+func (s kubeSetting) namespace(n namespaceSetting) (string, error) {
+	if n.AllNamespaces {
+		return metav1.NamespaceAll, nil
+	}
+	if n.Namespace != "" {
+		return n.Namespace, nil
+	}
+	ns, _, err := s.clientConfig().Namespace()
+	return ns, err
+}
+
+// withClient calls fn with the client of the API server.
+// ctx of fn is canceled when --timeout expires.
+func (s kubeSetting) withClient(fn func(ctx context.Context, client kubernetes.Interface) error) error {
+	s.DebugOpts.Enable()
+	config, err := s.restConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	return fn(ctx, client)
+}
+
+// selfTest validates that the kubeconfig files are found and the context can be loaded.
+func (s kubeSetting) selfTest() *checkers.Checker {
+	var checks []selftest.Check
+	for _, f := range filepath.SplitList(s.Kubeconfig) {
+		checks = append(checks, selftest.Readable(f))
+	}
+	checks = append(checks, func() error {
+		_, err := s.clientConfig().ClientConfig()
+		return err
+	})
+	return selftest.Run(checks...)
+}
+
+// fullName returns namespace/name of a namespaced resource.
+func fullName(m metav1.ObjectMeta) string {
+	if m.Namespace == "" {
+		return m.Name
+	}
+	return m.Namespace + "/" + m.Name
+}
+
+// summarize returns the worst status and the message which lists problems.
+// When there are no problems, okMsg is used as the message.
+func summarize(problems map[checkers.Status][]string, okMsg string) *checkers.Checker {
+	var msgs []string
+	msgs = append(msgs, problems[checkers.CRITICAL]...)
+	msgs = append(msgs, problems[checkers.WARNING]...)
+	switch {
+	case len(problems[checkers.CRITICAL]) > 0:
+		return checkers.Critical(strings.Join(msgs, ", "))
+	case len(problems[checkers.WARNING]) > 0:
+		return checkers.Warning(strings.Join(msgs, ", "))
+	}
+	return checkers.Ok(okMsg)
+}
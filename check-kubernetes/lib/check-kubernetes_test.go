@@ -0,0 +1,139 @@
+package checkkubernetes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+- name: stg
+  cluster:
+    server: https://stg.example.com:6443
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    namespace: web
+- name: stg
+  context:
+    cluster: stg
+current-context: prod
+`
+
+func TestKubeSetting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-kubernetes")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+
+	s := kubeSetting{Kubeconfig: kubeconfig, Timeout: 10}
+	config, err := s.restConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://prod.example.com:6443", config.Host)
+	assert.Equal(t, 10*time.Second, config.Timeout)
+
+	ns, err := s.namespace(namespaceSetting{})
+	assert.Nil(t, err)
+	assert.Equal(t, "web", ns)
+	ns, err = s.namespace(namespaceSetting{Namespace: "api"})
+	assert.Nil(t, err)
+	assert.Equal(t, "api", ns)
+	ns, err = s.namespace(namespaceSetting{AllNamespaces: true})
+	assert.Nil(t, err)
+	assert.Equal(t, metav1.NamespaceAll, ns)
+
+	s.Context = "stg"
+	config, err = s.restConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://stg.example.com:6443", config.Host)
+	ns, err = s.namespace(namespaceSetting{})
+	assert.Nil(t, err)
+	assert.Equal(t, metav1.NamespaceDefault, ns)
+
+	s.Context = "dev"
+	_, err = s.restConfig()
+	assert.NotNil(t, err)
+}
+
+func TestEvaluateNodes(t *testing.T) {
+	var nodes corev1.NodeList
+	err := json.Unmarshal([]byte(`{"items":[
+		{"metadata":{"name":"node1"},"status":{"conditions":[{"type":"MemoryPressure","status":"False"},{"type":"Ready","status":"True"}]}},
+		{"metadata":{"name":"node2"},"status":{"conditions":[{"type":"DiskPressure","status":"True"},{"type":"Ready","status":"True"}]}},
+		{"metadata":{"name":"node3"},"spec":{"unschedulable":true},"status":{"conditions":[{"type":"Ready","status":"Unknown"}]}}
+	]}`), &nodes)
+	assert.Nil(t, err)
+
+	ckr := evaluateNodes(&nodes, false)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "node3 is not ready, node2 has DiskPressure", ckr.Message)
+
+	ckr = evaluateNodes(&nodes, true)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+
+	nodes.Items = nodes.Items[:1]
+	ckr = evaluateNodes(&nodes, false)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "1 nodes are ready", ckr.Message)
+}
+
+func TestEvaluatePods(t *testing.T) {
+	var pods corev1.PodList
+	err := json.Unmarshal([]byte(`{"items":[
+		{"metadata":{"name":"web-1","namespace":"default","creationTimestamp":"2020-01-01T00:00:00Z"},"status":{"phase":"Running","containerStatuses":[{"name":"web","restartCount":0,"state":{"running":{}}}]}},
+		{"metadata":{"name":"web-2","namespace":"default","creationTimestamp":"2020-01-01T00:00:00Z"},"status":{"phase":"Pending"}},
+		{"metadata":{"name":"api-1","namespace":"default","creationTimestamp":"2020-01-01T00:00:00Z"},"status":{"phase":"Running","containerStatuses":[{"name":"api","restartCount":12,"state":{"waiting":{"reason":"CrashLoopBackOff"}}}]}}
+	]}`), &pods)
+	assert.Nil(t, err)
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ckr := evaluatePods(&pods, 5*time.Minute, created.Add(10*time.Minute))
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "default/api-1 (api) is CrashLoopBackOff (12 restarts), default/web-2 is pending for 10m0s", ckr.Message)
+
+	pods.Items = pods.Items[:2]
+	ckr = evaluatePods(&pods, 5*time.Minute, created.Add(10*time.Minute))
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+
+	ckr = evaluatePods(&pods, 5*time.Minute, created.Add(time.Minute))
+	assert.Equal(t, checkers.OK, ckr.Status)
+}
+
+func TestEvaluateDeployments(t *testing.T) {
+	var deployments appsv1.DeploymentList
+	err := json.Unmarshal([]byte(`{"items":[
+		{"metadata":{"name":"web","namespace":"default"},"spec":{"replicas":3},"status":{"availableReplicas":3}},
+		{"metadata":{"name":"api","namespace":"default"},"spec":{"replicas":3},"status":{"availableReplicas":2}},
+		{"metadata":{"name":"worker","namespace":"default"},"spec":{},"status":{}},
+		{"metadata":{"name":"batch","namespace":"default"},"spec":{"replicas":0},"status":{}}
+	]}`), &deployments)
+	assert.Nil(t, err)
+
+	ckr := evaluateDeployments(&deployments)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "default/worker has 0/1 available replicas, default/api has 2/3 available replicas", ckr.Message)
+
+	deployments.Items = deployments.Items[:2]
+	ckr = evaluateDeployments(&deployments)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+
+	deployments.Items = deployments.Items[:1]
+	ckr = evaluateDeployments(&deployments)
+	assert.Equal(t, checkers.OK, ckr.Status)
+}
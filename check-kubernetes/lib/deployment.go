@@ -0,0 +1,79 @@
+package checkkubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+type deploymentOpts struct {
+	kubeSetting
+	namespaceSetting
+	Name string `long:"name" description:"Check only the deployment"`
+}
+
+func checkDeployment(args []string) *checkers.Checker {
+	opts := deploymentOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "deployment [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	ns, err := opts.namespace(opts.namespaceSetting)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	listOpts := metav1.ListOptions{LabelSelector: opts.Selector}
+	if opts.Name != "" {
+		listOpts.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.Name).String()
+	}
+	var deployments *appsv1.DeploymentList
+	err = opts.withClient(func(ctx context.Context, client kubernetes.Interface) error {
+		var err error
+		deployments, err = client.AppsV1().Deployments(ns).List(ctx, listOpts)
+		return err
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluateDeployments(deployments)
+}
+
+// evaluateDeployments returns CRITICAL if no replicas of a deployment are available,
+// and WARNING if some replicas are unavailable.
+func evaluateDeployments(deployments *appsv1.DeploymentList) *checkers.Checker {
+	if len(deployments.Items) == 0 {
+		return checkers.Critical("no deployments found")
+	}
+	problems := make(map[checkers.Status][]string)
+	for _, d := range deployments.Items {
+		// spec.replicas defaults to 1
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		available := d.Status.AvailableReplicas
+		if available >= desired {
+			continue
+		}
+		msg := fmt.Sprintf("%s has %d/%d available replicas", fullName(d.ObjectMeta), available, desired)
+		if available == 0 {
+			problems[checkers.CRITICAL] = append(problems[checkers.CRITICAL], msg)
+		} else {
+			problems[checkers.WARNING] = append(problems[checkers.WARNING], msg)
+		}
+	}
+	return summarize(problems, fmt.Sprintf("%d deployments are available", len(deployments.Items)))
+}
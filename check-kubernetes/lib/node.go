@@ -0,0 +1,79 @@
+package checkkubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type nodeOpts struct {
+	kubeSetting
+	Selector            string `short:"l" long:"selector" description:"Label selector to filter nodes (e.g. node-role.kubernetes.io/worker=)"`
+	IgnoreUnschedulable bool   `long:"ignore-unschedulable" description:"Ignore cordoned nodes"`
+}
+
+// pressureConditions are node conditions which are healthy when the status is False.
+var pressureConditions = map[corev1.NodeConditionType]bool{
+	corev1.NodeMemoryPressure:     true,
+	corev1.NodeDiskPressure:       true,
+	corev1.NodePIDPressure:        true,
+	corev1.NodeNetworkUnavailable: true,
+}
+
+func checkNode(args []string) *checkers.Checker {
+	opts := nodeOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "node [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	var nodes *corev1.NodeList
+	err = opts.withClient(func(ctx context.Context, client kubernetes.Interface) error {
+		var err error
+		nodes, err = client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+		return err
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluateNodes(nodes, opts.IgnoreUnschedulable)
+}
+
+// evaluateNodes returns CRITICAL if a node is not ready, and WARNING if a node is under pressure.
+func evaluateNodes(nodes *corev1.NodeList, ignoreUnschedulable bool) *checkers.Checker {
+	if len(nodes.Items) == 0 {
+		return checkers.Critical("no nodes found")
+	}
+	problems := make(map[checkers.Status][]string)
+	checked := 0
+	for _, n := range nodes.Items {
+		if ignoreUnschedulable && n.Spec.Unschedulable {
+			continue
+		}
+		checked++
+		ready := false
+		for _, c := range n.Status.Conditions {
+			switch {
+			case c.Type == corev1.NodeReady:
+				ready = c.Status == corev1.ConditionTrue
+			case pressureConditions[c.Type] && c.Status == corev1.ConditionTrue:
+				problems[checkers.WARNING] = append(problems[checkers.WARNING], fmt.Sprintf("%s has %s", n.Name, c.Type))
+			}
+		}
+		if !ready {
+			problems[checkers.CRITICAL] = append(problems[checkers.CRITICAL], fmt.Sprintf("%s is not ready", n.Name))
+		}
+	}
+	return summarize(problems, fmt.Sprintf("%d nodes are ready", checked))
+}
@@ -0,0 +1,82 @@
+package checkkubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type podOpts struct {
+	kubeSetting
+	namespaceSetting
+	PendingSeconds int64 `long:"pending-seconds" default:"300" description:"warning if a pod is pending longer than the seconds"`
+}
+
+// failingReasons are reasons of waiting containers which don't recover by themselves.
+var failingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+func checkPod(args []string) *checkers.Checker {
+	opts := podOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "pod [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	ns, err := opts.namespace(opts.namespaceSetting)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var pods *corev1.PodList
+	err = opts.withClient(func(ctx context.Context, client kubernetes.Interface) error {
+		var err error
+		pods, err = client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+		return err
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluatePods(pods, time.Duration(opts.PendingSeconds)*time.Second, time.Now())
+}
+
+// evaluatePods returns CRITICAL if a container of a pod is failing to start,
+// and WARNING if a pod is pending too long.
+func evaluatePods(pods *corev1.PodList, pendingLimit time.Duration, now time.Time) *checkers.Checker {
+	problems := make(map[checkers.Status][]string)
+	for _, p := range pods.Items {
+		name := fullName(p.ObjectMeta)
+		failing := false
+		statuses := append(p.Status.InitContainerStatuses, p.Status.ContainerStatuses...)
+		for _, c := range statuses {
+			if w := c.State.Waiting; w != nil && failingReasons[w.Reason] {
+				failing = true
+				problems[checkers.CRITICAL] = append(problems[checkers.CRITICAL], fmt.Sprintf("%s (%s) is %s (%d restarts)", name, c.Name, w.Reason, c.RestartCount))
+			}
+		}
+		if failing {
+			continue
+		}
+		if p.Status.Phase == corev1.PodPending && now.Sub(p.CreationTimestamp.Time) > pendingLimit {
+			problems[checkers.WARNING] = append(problems[checkers.WARNING], fmt.Sprintf("%s is pending for %s", name, now.Sub(p.CreationTimestamp.Time).Truncate(time.Second)))
+		}
+	}
+	return summarize(problems, fmt.Sprintf("%d pods are not failing", len(pods.Items)))
+}
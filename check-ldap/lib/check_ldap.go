@@ -9,6 +9,9 @@ import (
 	"github.com/go-ldap/ldap/v3"
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type checkLDAPOpts struct {
@@ -20,40 +23,51 @@ type checkLDAPOpts struct {
 	Attribute string  `short:"a" long:"attr" default:"(objectclass=*)" description:"LDAP attribute to search"`
 	BindDN    string  `short:"D" long:"bind" description:"LDAP bind DN"`
 	Password  string  `short:"P" long:"password" description:"LDAP password"`
+
+	Replicas     []string `long:"replica" value-name:"HOST[:PORT]" description:"Check the replication consistency between the host and the server (may be repeated)"`
+	CSNTolerance uint64   `long:"csn-tolerance" value-name:"SECONDS" default:"60" description:"critical if the contextCSN of a server is behind the other servers over the seconds (OpenLDAP)"`
+	USNTolerance int64    `long:"usn-tolerance" value-name:"N" default:"1000" description:"critical if a server hasn't applied the changes of another server over the USNs (Active Directory)"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "LDAP"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
 	opts := checkLDAPOpts{}
 	_, err := flags.ParseArgs(&opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
+	}
+	if opts.Password, err = opts.ResolvePassword(opts.Password); err != nil {
+		return checkers.Unknown(err.Error())
 	}
 
-	lconn, err := ldap.Dial("tcp", net.JoinHostPort(opts.Host, opts.Port))
+	if len(opts.Replicas) > 0 {
+		return opts.checkReplication()
+	}
+
+	lconn, err := opts.connect(net.JoinHostPort(opts.Host, opts.Port))
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
 	defer lconn.Close()
 
-	// Bind() method does not allow empty password.
-	// https://godoc.org/gopkg.in/ldap.v3#Conn.Bind
-	if opts.Password != "" {
-		if err := lconn.Bind(opts.BindDN, opts.Password); err != nil {
-			return checkers.Unknown(err.Error())
-		}
-	} else {
-		if err := lconn.UnauthenticatedBind(opts.BindDN); err != nil {
-			return checkers.Unknown(err.Error())
-		}
-	}
-
 	req := ldap.NewSearchRequest(
 		opts.Base,
 		ldap.ScopeBaseObject,
@@ -66,7 +80,9 @@ func run(args []string) *checkers.Checker {
 
 	stTime := time.Now()
 
+	end := debuglog.Trace("ldap: search %s %s", opts.Base, opts.Attribute)
 	_, err = lconn.Search(req)
+	end(err)
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
@@ -74,12 +90,40 @@ func run(args []string) *checkers.Checker {
 	elapsed := time.Since(stTime)
 
 	msg := fmt.Sprintf("%.3f seconds response time", elapsed.Seconds())
+	return checkers.NewChecker(opts.responseTimeStatus(elapsed), msg)
+}
 
+func (opts *checkLDAPOpts) responseTimeStatus(elapsed time.Duration) checkers.Status {
 	if elapsed.Seconds() > opts.Critical {
-		return checkers.Critical(msg)
+		return checkers.CRITICAL
 	} else if elapsed.Seconds() > opts.Warning {
-		return checkers.Warning(msg)
+		return checkers.WARNING
+	} else {
+		return checkers.OK
+	}
+}
+
+// connect dials the server at addr and binds with the options.
+func (opts *checkLDAPOpts) connect(addr string) (*ldap.Conn, error) {
+	end := debuglog.Trace("ldap: dial %s", addr)
+	lconn, err := ldap.Dial("tcp", addr)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bind() method does not allow empty password.
+	// https://godoc.org/gopkg.in/ldap.v3#Conn.Bind
+	end = debuglog.Trace("ldap: bind %q", opts.BindDN)
+	if opts.Password != "" {
+		err = lconn.Bind(opts.BindDN, opts.Password)
 	} else {
-		return checkers.Ok(msg)
+		err = lconn.UnauthenticatedBind(opts.BindDN)
+	}
+	end(err)
+	if err != nil {
+		lconn.Close()
+		return nil, err
 	}
+	return lconn, nil
 }
@@ -0,0 +1,301 @@
+package checkldap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+// replica is the replication state read from a server.
+type replica struct {
+	addr    string
+	elapsed time.Duration
+
+	// OpenLDAP
+	csns map[string]time.Time // contextCSN keyed by the server id
+
+	// Active Directory
+	usn          int64            // highestCommittedUSN
+	invocationID string           // invocationId of the NTDS Settings object, in hex
+	cursors      map[string]int64 // up-to-dateness vector keyed by the invocation id
+}
+
+func (r *replica) isAD() bool {
+	return r.invocationID != ""
+}
+
+func (opts *checkLDAPOpts) checkReplication() *checkers.Checker {
+	addrs := []string{net.JoinHostPort(opts.Host, opts.Port)}
+	for _, s := range opts.Replicas {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, opts.Port)
+		}
+		addrs = append(addrs, s)
+	}
+
+	var replicas []*replica
+	var errs []string
+	for _, addr := range addrs {
+		r, err := opts.readReplica(addr)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("couldn't read %s: %s", addr, err))
+			continue
+		}
+		replicas = append(replicas, r)
+	}
+	return opts.evaluateReplication(replicas, errs)
+}
+
+func (opts *checkLDAPOpts) readReplica(addr string) (*replica, error) {
+	lconn, err := opts.connect(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer lconn.Close()
+
+	stTime := time.Now()
+	r := &replica{addr: addr}
+	rootDSE, err := searchBase(lconn, "", "highestCommittedUSN", "dsServiceName")
+	if err != nil {
+		return nil, err
+	}
+	if usn := rootDSE.GetAttributeValue("highestCommittedUSN"); usn != "" {
+		if _, err := fmt.Sscan(usn, &r.usn); err != nil {
+			return nil, fmt.Errorf("invalid highestCommittedUSN %q", usn)
+		}
+		settings, err := searchBase(lconn, rootDSE.GetAttributeValue("dsServiceName"), "invocationId")
+		if err != nil {
+			return nil, err
+		}
+		id := settings.GetRawAttributeValue("invocationId")
+		if len(id) == 0 {
+			return nil, fmt.Errorf("no invocationId")
+		}
+		r.invocationID = fmt.Sprintf("%x", id)
+		nc, err := searchBase(lconn, opts.Base, "replUpToDateVector")
+		if err != nil {
+			return nil, err
+		}
+		if r.cursors, err = parseUpToDateVector(nc.GetRawAttributeValue("replUpToDateVector")); err != nil {
+			return nil, err
+		}
+	} else {
+		nc, err := searchBase(lconn, opts.Base, "contextCSN")
+		if err != nil {
+			return nil, err
+		}
+		values := nc.GetAttributeValues("contextCSN")
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no contextCSN in %s", opts.Base)
+		}
+		r.csns = make(map[string]time.Time)
+		for _, v := range values {
+			sid, t, err := parseCSN(v)
+			if err != nil {
+				return nil, err
+			}
+			r.csns[sid] = t
+		}
+	}
+	r.elapsed = time.Since(stTime)
+	return r, nil
+}
+
+// searchBase reads the attributes of the entry at dn.
+func searchBase(lconn *ldap.Conn, dn string, attrs ...string) (*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		"(objectClass=*)",
+		attrs,
+		nil,
+	)
+	end := debuglog.Trace("ldap: search %s %v", dn, attrs)
+	res, err := lconn.Search(req)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, fmt.Errorf("no entry %q", dn)
+	}
+	return res.Entries[0], nil
+}
+
+// parseCSN parses the change sequence number of OpenLDAP,
+// such as "20240115093012.123456Z#000000#001#000000", into the server id and the time.
+func parseCSN(s string) (string, time.Time, error) {
+	a := strings.Split(s, "#")
+	if len(a) != 4 {
+		return "", time.Time{}, fmt.Errorf("invalid contextCSN %q", s)
+	}
+	t, err := time.Parse("20060102150405.999999Z", a[0])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid contextCSN %q: %s", s, err)
+	}
+	return a[2], t, nil
+}
+
+// parseUpToDateVector parses replUpToDateVector, the UPTODATE_VECTOR_V1_EXT or
+// UPTODATE_VECTOR_V2_EXT structure, into the USNs keyed by the invocation id.
+func parseUpToDateVector(b []byte) (map[string]int64, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("invalid replUpToDateVector")
+	}
+	var size int
+	switch v := binary.LittleEndian.Uint32(b[0:4]); v {
+	case 1:
+		size = 24 // uuidDsa, usnHighPropUpdate
+	case 2:
+		size = 32 // uuidDsa, usnHighPropUpdate, timeLastSyncSuccess
+	default:
+		return nil, fmt.Errorf("unsupported replUpToDateVector version %d", v)
+	}
+	n := int(binary.LittleEndian.Uint32(b[8:12]))
+	if len(b) < 16+n*size {
+		return nil, fmt.Errorf("invalid replUpToDateVector")
+	}
+	cursors := make(map[string]int64, n)
+	for i := 0; i < n; i++ {
+		c := b[16+i*size:]
+		cursors[fmt.Sprintf("%x", c[0:16])] = int64(binary.LittleEndian.Uint64(c[16:24]))
+	}
+	return cursors, nil
+}
+
+// evaluateReplication checks that the replicas have applied the changes of each other within the tolerance.
+// errs are the servers which couldn't be read.
+func (opts *checkLDAPOpts) evaluateReplication(replicas []*replica, errs []string) *checkers.Checker {
+	if len(replicas) < 2 {
+		return checkers.Critical(strings.Join(append(errs, "no servers to compare with"), ", "))
+	}
+
+	var checkSt checkers.Status
+	var msgs []string
+	var summary string
+	switch {
+	case allAD(replicas):
+		checkSt, msgs, summary = evaluateUSN(replicas, opts.USNTolerance)
+	case !anyAD(replicas):
+		checkSt, msgs, summary = evaluateCSN(replicas, time.Duration(opts.CSNTolerance)*time.Second)
+	default:
+		return checkers.Unknown("the servers are mixed of Active Directory and OpenLDAP")
+	}
+	if len(errs) > 0 && checkSt == checkers.OK {
+		checkSt = checkers.WARNING
+	}
+	msgs = append(errs, msgs...)
+
+	var maxElapsed time.Duration
+	for _, r := range replicas {
+		if r.elapsed > maxElapsed {
+			maxElapsed = r.elapsed
+		}
+	}
+	if st := opts.responseTimeStatus(maxElapsed); st > checkSt {
+		checkSt = st
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, summary)
+	}
+	msgs = append(msgs, fmt.Sprintf("%.3f seconds response time", maxElapsed.Seconds()))
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func allAD(replicas []*replica) bool {
+	for _, r := range replicas {
+		if !r.isAD() {
+			return false
+		}
+	}
+	return true
+}
+
+func anyAD(replicas []*replica) bool {
+	for _, r := range replicas {
+		if r.isAD() {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateCSN compares the contextCSN of each server id with the newest one among the servers.
+func evaluateCSN(replicas []*replica, tolerance time.Duration) (checkers.Status, []string, string) {
+	newest := make(map[string]time.Time)
+	for _, r := range replicas {
+		for sid, t := range r.csns {
+			if t.After(newest[sid]) {
+				newest[sid] = t
+			}
+		}
+	}
+	sids := make([]string, 0, len(newest))
+	for sid := range newest {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+
+	checkSt := checkers.OK
+	var msgs []string
+	var maxLag time.Duration
+	for _, r := range replicas {
+		for _, sid := range sids {
+			t, ok := r.csns[sid]
+			if !ok {
+				checkSt = checkers.CRITICAL
+				msgs = append(msgs, fmt.Sprintf("%s has no contextCSN of serverID %s", r.addr, sid))
+				continue
+			}
+			lag := newest[sid].Sub(t)
+			if lag > maxLag {
+				maxLag = lag
+			}
+			if lag > tolerance {
+				checkSt = checkers.CRITICAL
+				msgs = append(msgs, fmt.Sprintf("%s is %.0f seconds behind on serverID %s", r.addr, lag.Seconds(), sid))
+			}
+		}
+	}
+	return checkSt, msgs, fmt.Sprintf("%d servers are in sync (max %.0f seconds behind)", len(replicas), maxLag.Seconds())
+}
+
+// evaluateUSN compares highestCommittedUSN of each server with the USN
+// which the other servers have applied from it.
+// highestCommittedUSN is local to each domain controller, so it can't be compared between them directly.
+func evaluateUSN(replicas []*replica, tolerance int64) (checkers.Status, []string, string) {
+	checkSt := checkers.OK
+	var msgs []string
+	var maxLag int64
+	for _, src := range replicas {
+		for _, r := range replicas {
+			if r == src {
+				continue
+			}
+			usn, ok := r.cursors[src.invocationID]
+			if !ok {
+				checkSt = checkers.CRITICAL
+				msgs = append(msgs, fmt.Sprintf("%s has never replicated from %s", r.addr, src.addr))
+				continue
+			}
+			lag := src.usn - usn
+			if lag > maxLag {
+				maxLag = lag
+			}
+			if lag > tolerance {
+				checkSt = checkers.CRITICAL
+				msgs = append(msgs, fmt.Sprintf("%s is %d USNs behind %s", r.addr, lag, src.addr))
+			}
+		}
+	}
+	return checkSt, msgs, fmt.Sprintf("%d servers are in sync (max %d USNs behind)", len(replicas), maxLag)
+}
@@ -0,0 +1,145 @@
+package checkldap
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestParseCSN(t *testing.T) {
+	sid, tm, err := parseCSN("20240115093012.123456Z#000000#001#000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid != "001" {
+		t.Errorf("sid = %q, want 001", sid)
+	}
+	if want := time.Date(2024, 1, 15, 9, 30, 12, 123456000, time.UTC); !tm.Equal(want) {
+		t.Errorf("time = %s, want %s", tm, want)
+	}
+
+	for _, s := range []string{"", "20240115093012.123456Z", "2024-01-15#000000#001#000000"} {
+		if _, _, err := parseCSN(s); err == nil {
+			t.Errorf("parseCSN(%q) should fail", s)
+		}
+	}
+}
+
+func TestParseUpToDateVector(t *testing.T) {
+	id1 := make([]byte, 16)
+	id2 := make([]byte, 16)
+	for i := range id1 {
+		id1[i] = byte(i)
+		id2[i] = byte(0xf0 + i)
+	}
+	b := make([]byte, 16+2*32)
+	binary.LittleEndian.PutUint32(b[0:], 2)
+	binary.LittleEndian.PutUint32(b[8:], 2)
+	copy(b[16:], id1)
+	binary.LittleEndian.PutUint64(b[32:], 12345)
+	copy(b[48:], id2)
+	binary.LittleEndian.PutUint64(b[64:], 678)
+
+	cursors, err := parseUpToDateVector(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cursors) != 2 || cursors["000102030405060708090a0b0c0d0e0f"] != 12345 || cursors["f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff"] != 678 {
+		t.Errorf("parseUpToDateVector() = %v", cursors)
+	}
+
+	if _, err := parseUpToDateVector(b[:40]); err == nil {
+		t.Error("parseUpToDateVector() should fail with a truncated vector")
+	}
+	binary.LittleEndian.PutUint32(b[0:], 3)
+	if _, err := parseUpToDateVector(b); err == nil {
+		t.Error("parseUpToDateVector() should fail with an unknown version")
+	}
+}
+
+func TestEvaluateReplicationCSN(t *testing.T) {
+	opts := &checkLDAPOpts{Warning: 1, Critical: 2, CSNTolerance: 60}
+	base := time.Date(2024, 1, 15, 9, 30, 0, 0, time.UTC)
+	r := func(addr string, lag1, lag2 time.Duration) *replica {
+		csns := map[string]time.Time{"001": base.Add(-lag1)}
+		if lag2 >= 0 {
+			csns["002"] = base.Add(-lag2)
+		}
+		return &replica{addr: addr, csns: csns, elapsed: 10 * time.Millisecond}
+	}
+
+	tests := []struct {
+		replicas []*replica
+		errs     []string
+		want     checkers.Status
+		msg      string
+	}{
+		{
+			replicas: []*replica{r("ldap1:389", 0, 10*time.Second), r("ldap2:389", 5*time.Second, 0)},
+			want:     checkers.OK,
+			msg:      "2 servers are in sync (max 10 seconds behind), 0.010 seconds response time",
+		},
+		{
+			replicas: []*replica{r("ldap1:389", 0, 0), r("ldap2:389", 90*time.Second, 0)},
+			want:     checkers.CRITICAL,
+			msg:      "ldap2:389 is 90 seconds behind on serverID 001, 0.010 seconds response time",
+		},
+		{
+			replicas: []*replica{r("ldap1:389", 0, 0), r("ldap2:389", 0, -1)},
+			want:     checkers.CRITICAL,
+			msg:      "ldap2:389 has no contextCSN of serverID 002, 0.010 seconds response time",
+		},
+		{
+			replicas: []*replica{r("ldap1:389", 0, 0), r("ldap2:389", 0, 0)},
+			errs:     []string{"couldn't read ldap3:389: connection refused"},
+			want:     checkers.WARNING,
+			msg:      "couldn't read ldap3:389: connection refused, 0.010 seconds response time",
+		},
+		{
+			replicas: []*replica{r("ldap1:389", 0, 0)},
+			errs:     []string{"couldn't read ldap2:389: connection refused"},
+			want:     checkers.CRITICAL,
+			msg:      "couldn't read ldap2:389: connection refused, no servers to compare with",
+		},
+		{
+			replicas: []*replica{r("ldap1:389", 0, 0), {addr: "dc1:389", invocationID: "aa"}},
+			want:     checkers.UNKNOWN,
+			msg:      "the servers are mixed of Active Directory and OpenLDAP",
+		},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluateReplication(tt.replicas, tt.errs)
+		if ckr.Status != tt.want {
+			t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+		}
+		if ckr.Message != tt.msg {
+			t.Errorf("message = %q, want %q", ckr.Message, tt.msg)
+		}
+	}
+}
+
+func TestEvaluateReplicationUSN(t *testing.T) {
+	opts := &checkLDAPOpts{Warning: 1, Critical: 2, USNTolerance: 100}
+	dc1 := &replica{addr: "dc1:389", invocationID: "aa", usn: 5000, cursors: map[string]int64{"bb": 900}}
+	dc2 := &replica{addr: "dc2:389", invocationID: "bb", usn: 1000, cursors: map[string]int64{"aa": 4950}}
+
+	ckr := opts.evaluateReplication([]*replica{dc1, dc2}, nil)
+	if ckr.Status != checkers.OK {
+		t.Errorf("status = %s, want OK: %s", ckr.Status, ckr.Message)
+	}
+	if want := "2 servers are in sync (max 100 USNs behind), 0.000 seconds response time"; ckr.Message != want {
+		t.Errorf("message = %q, want %q", ckr.Message, want)
+	}
+
+	dc2.cursors["aa"] = 3000
+	dc3 := &replica{addr: "dc3:389", invocationID: "cc", usn: 10, cursors: map[string]int64{"aa": 5000, "bb": 1000}, elapsed: 1500 * time.Millisecond}
+	ckr = opts.evaluateReplication([]*replica{dc1, dc2, dc3}, nil)
+	if ckr.Status != checkers.CRITICAL {
+		t.Errorf("status = %s, want CRITICAL: %s", ckr.Status, ckr.Message)
+	}
+	if want := "dc2:389 is 2000 USNs behind dc1:389, dc1:389 has never replicated from dc3:389, dc2:389 has never replicated from dc3:389, 1.500 seconds response time"; ckr.Message != want {
+		t.Errorf("message = %q, want %q", ckr.Message, want)
+	}
+}
@@ -7,23 +7,30 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
-var opts struct {
-	WarningThreshold  string `short:"w" long:"warning" required:"true" value-name:"WL1,WL5,WL15" description:"Warning threshold for loadavg1,5,15"`
-	CriticalThreshold string `short:"c" long:"critical" required:"true" value-name:"CL1,CL5,CL15" description:"Critical threshold for loadavg1,5,15"`
-	PerCPU            bool   `short:"r" long:"percpu" description:"Divide the load averages by cpu count"`
+type loadOpts struct {
+	WarningThreshold  string        `short:"w" long:"warning" required:"true" value-name:"WL1,WL5,WL15" description:"Warning threshold for loadavg1,5,15"`
+	CriticalThreshold string        `short:"c" long:"critical" required:"true" value-name:"CL1,CL5,CL15" description:"Critical threshold for loadavg1,5,15"`
+	PerCPU            bool          `short:"r" long:"percpu" description:"Divide the load averages by cpu count"`
+	PSI               bool          `long:"psi" description:"Check the pressure stall information of cpu, memory and io instead. The thresholds are the percentages of avg10,avg60"`
+	PSIResources      []string      `long:"psi-resource" choice:"cpu" choice:"memory" choice:"io" description:"Resource to check the pressure stall information of (may be repeated, default: all)"`
+	CPU               bool          `long:"cpu" description:"Check the steal and iowait percentages of the cpu time and the runqueue of each core instead (Linux only). The thresholds are STEAL,IOWAIT,RUNQUEUE"`
+	CPUInterval       time.Duration `long:"cpu-interval" value-name:"DURATION" default:"3s" description:"Interval to sample the cpu time and the runqueues in with --cpu"`
+	selftest.SelfTestOpts
 }
 
-func parseThreshold(str string) ([3]float64, error) {
-	thresholds := [3]float64{0, 0, 0}
+func parseThreshold(str string, n int) ([]float64, error) {
+	thresholds := make([]float64, n)
 
 	thSt := strings.Split(str, ",")
-	if len(thSt) != 3 {
-		return thresholds, errors.New("Threshold must be comma-separated 3 numbers")
+	if len(thSt) != n {
+		return thresholds, fmt.Errorf("Threshold must be comma-separated %d numbers", n)
 	}
 
 	var err error
@@ -38,25 +45,44 @@ func parseThreshold(str string) ([3]float64, error) {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "LOAD"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &loadOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.PSI && (opts.PerCPU || opts.CPU) {
+		return checkers.Unknown("--psi can't be combined with --percpu or --cpu")
+	}
+	if opts.PSI {
+		return opts.runPSI()
+	}
+	if opts.CPU {
+		return opts.runCPU()
 	}
 
-	wload, err := parseThreshold(opts.WarningThreshold)
+	wload, err := parseThreshold(opts.WarningThreshold, 3)
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
-	cload, err := parseThreshold(opts.CriticalThreshold)
+	cload, err := parseThreshold(opts.CriticalThreshold, 3)
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
 
 	loadavgs, err := getloadavg()
 	if err != nil {
@@ -84,3 +110,199 @@ func run(args []string) *checkers.Checker {
 	msg := fmt.Sprintf("load average: %.2f, %.2f, %.2f", loadavgs[0], loadavgs[1], loadavgs[2])
 	return checkers.NewChecker(result, msg)
 }
+
+var psiResources = []string{"cpu", "memory", "io"}
+
+// runPSI checks avg10 and avg60 of the "some" line of the pressure stall information,
+// the percentage of the time in which some tasks are stalled on the resource.
+func (opts *loadOpts) runPSI() *checkers.Checker {
+	wpsi, err := parseThreshold(opts.WarningThreshold, 2)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cpsi, err := parseThreshold(opts.CriticalThreshold, 2)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	resources := opts.PSIResources
+	if len(resources) == 0 {
+		resources = psiResources
+	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	result := checkers.OK
+	var msgs []string
+	for _, r := range resources {
+		avgs, err := getPSI(r)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		for i := range avgs {
+			if avgs[i] > cpsi[i] {
+				result = checkers.CRITICAL
+			} else if avgs[i] > wpsi[i] && result == checkers.OK {
+				result = checkers.WARNING
+			}
+		}
+		msgs = append(msgs, fmt.Sprintf("%s %.2f%%, %.2f%%", r, avgs[0], avgs[1]))
+	}
+
+	msg := "pressure avg10, avg60: " + strings.Join(msgs, "; ")
+	return checkers.NewChecker(result, msg)
+}
+
+// parsePSI returns avg10 and avg60 of the "some" line in the content of /proc/pressure/*.
+func parsePSI(content string) ([]float64, error) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		avgs := make([]float64, 2)
+		found := 0
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			var i int
+			switch kv[0] {
+			case "avg10":
+				i = 0
+			case "avg60":
+				i = 1
+			default:
+				continue
+			}
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse pressure stall information: %s", err)
+			}
+			avgs[i] = v
+			found++
+		}
+		if found != 2 {
+			return nil, errors.New("Failed to parse pressure stall information: avg10 or avg60 not found")
+		}
+		return avgs, nil
+	}
+	return nil, errors.New("Failed to parse pressure stall information: \"some\" not found")
+}
+
+// cpuSample is the counters of the cpu time in /proc/stat and the runqueues in /proc/schedstat.
+type cpuSample struct {
+	total    uint64   // jiffies
+	iowait   uint64   // jiffies
+	steal    uint64   // jiffies
+	runDelay []uint64 // nanoseconds spent by the tasks waiting on the runqueue of each core
+}
+
+// runCPU checks the percentages of the cpu time stolen by the hypervisor and waiting for io,
+// and the average number of the tasks waiting on the runqueue of each core, in the interval.
+// Unlike the load average, they tell the cpu taken by the neighbors of VMs and the imbalance between the cores.
+func (opts *loadOpts) runCPU() *checkers.Checker {
+	wcpu, err := parseThreshold(opts.WarningThreshold, 3)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	ccpu, err := parseThreshold(opts.CriticalThreshold, 3)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	prev, err := getCPUSample()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	time.Sleep(opts.CPUInterval)
+	next, err := getCPUSample()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluateCPU(prev, next, opts.CPUInterval, wcpu, ccpu)
+}
+
+func evaluateCPU(prev, next *cpuSample, interval time.Duration, warning, critical []float64) *checkers.Checker {
+	var steal, iowait float64
+	if total := next.total - prev.total; total > 0 {
+		steal = float64(next.steal-prev.steal) * 100 / float64(total)
+		iowait = float64(next.iowait-prev.iowait) * 100 / float64(total)
+	}
+	// the run delay per time is the average number of the waiting tasks by Little's law.
+	var runqueue float64
+	maxCPU := -1
+	for i := range next.runDelay {
+		if i >= len(prev.runDelay) {
+			break
+		}
+		q := float64(next.runDelay[i]-prev.runDelay[i]) / float64(interval.Nanoseconds())
+		if maxCPU < 0 || q > runqueue {
+			runqueue, maxCPU = q, i
+		}
+	}
+
+	result := checkers.OK
+	for i, v := range []float64{steal, iowait, runqueue} {
+		if v > critical[i] {
+			result = checkers.CRITICAL
+		} else if v > warning[i] && result == checkers.OK {
+			result = checkers.WARNING
+		}
+	}
+	msg := fmt.Sprintf("cpu steal %.2f%%, iowait %.2f%%, max runqueue %.2f (cpu%d)", steal, iowait, runqueue, maxCPU)
+	return checkers.NewChecker(result, msg)
+}
+
+// parseProcStat returns the total, iowait and steal jiffies of the "cpu" line in the content of /proc/stat.
+func parseProcStat(content string) (total, iowait, steal uint64, _ error) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal, where guest and guest_nice are included in user and nice.
+		if len(fields) < 9 {
+			return 0, 0, 0, errors.New("Failed to parse /proc/stat: steal not found")
+		}
+		var values [8]uint64
+		for i := range values {
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("Failed to parse /proc/stat: %s", err)
+			}
+			values[i] = v
+			total += v
+		}
+		return total, values[4], values[7], nil
+	}
+	return 0, 0, 0, errors.New("Failed to parse /proc/stat: \"cpu\" not found")
+}
+
+// parseSchedstat returns run_delay of each core in the content of /proc/schedstat (version 15 or later).
+func parseSchedstat(content string) ([]uint64, error) {
+	var delays []uint64
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		// cpuN yld_count 0 sched_count sched_goidle ttwu_count ttwu_local rq_cpu_time run_delay pcount
+		if len(fields) < 10 {
+			return nil, errors.New("Failed to parse /proc/schedstat: run_delay not found")
+		}
+		v, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse /proc/schedstat: %s", err)
+		}
+		delays = append(delays, v)
+	}
+	if len(delays) == 0 {
+		return nil, errors.New("Failed to parse /proc/schedstat: no cpu found")
+	}
+	return delays, nil
+}
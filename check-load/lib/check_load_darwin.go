@@ -1,6 +1,7 @@
 package checkload
 
 import (
+	"errors"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -29,3 +30,11 @@ func getloadavg() (loadavgs [3]float64, err error) {
 	}
 	return loadavgs, nil
 }
+
+func getPSI(resource string) ([]float64, error) {
+	return nil, errors.New("Pressure stall information is only available on Linux")
+}
+
+func getCPUSample() (*cpuSample, error) {
+	return nil, errors.New("Steal time and runqueues are only available on Linux")
+}
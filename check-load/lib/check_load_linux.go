@@ -23,3 +23,32 @@ func getloadavg() (loadavgs [3]float64, _ error) {
 	}
 	return loadavgs, nil
 }
+
+func getPSI(resource string) ([]float64, error) {
+	contentbytes, err := ioutil.ReadFile("/proc/pressure/" + resource)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load /proc/pressure/%s: %s", resource, err)
+	}
+	return parsePSI(string(contentbytes))
+}
+
+func getCPUSample() (*cpuSample, error) {
+	stat, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load /proc/stat: %s", err)
+	}
+	var sample cpuSample
+	sample.total, sample.iowait, sample.steal, err = parseProcStat(string(stat))
+	if err != nil {
+		return nil, err
+	}
+	schedstat, err := ioutil.ReadFile("/proc/schedstat")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load /proc/schedstat: %s", err)
+	}
+	sample.runDelay, err = parseSchedstat(string(schedstat))
+	if err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
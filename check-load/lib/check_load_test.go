@@ -0,0 +1,93 @@
+package checkload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThreshold(t *testing.T) {
+	th, err := parseThreshold("1.5,2,3", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1.5, 2, 3}, th)
+
+	_, err = parseThreshold("1,2", 3)
+	assert.Error(t, err)
+	_, err = parseThreshold("1,a", 2)
+	assert.Error(t, err)
+}
+
+func TestParsePSI(t *testing.T) {
+	avgs, err := parsePSI(`some avg10=1.52 avg60=0.93 avg300=0.92 total=43664242
+full avg10=0.30 avg60=0.20 avg300=0.10 total=123
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1.52, 0.93}, avgs)
+
+	_, err = parsePSI("full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")
+	assert.Error(t, err)
+	_, err = parsePSI("some avg300=0.92 total=43664242\n")
+	assert.Error(t, err)
+}
+
+func TestParseProcStat(t *testing.T) {
+	total, iowait, steal, err := parseProcStat(`cpu  100 10 50 700 40 5 5 90 20 0
+cpu0 50 5 25 350 20 2 3 45 10 0
+intr 12345
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), total)
+	assert.Equal(t, uint64(40), iowait)
+	assert.Equal(t, uint64(90), steal)
+
+	_, _, _, err = parseProcStat("cpu  100 10 50 700 40 5 5\n")
+	assert.Error(t, err)
+	_, _, _, err = parseProcStat("intr 12345\n")
+	assert.Error(t, err)
+}
+
+func TestParseSchedstat(t *testing.T) {
+	delays, err := parseSchedstat(`version 15
+timestamp 4295241523
+cpu0 0 0 0 0 0 0 1234567890 987654321 4567
+domain0 00000003 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+cpu1 0 0 0 0 0 0 2234567890 123456789 5678
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{987654321, 123456789}, delays)
+
+	_, err = parseSchedstat("version 15\ntimestamp 4295241523\n")
+	assert.Error(t, err)
+}
+
+func TestEvaluateCPU(t *testing.T) {
+	prev := &cpuSample{total: 1000, iowait: 10, steal: 20, runDelay: []uint64{0, 1e9}}
+	next := &cpuSample{total: 2000, iowait: 60, steal: 170, runDelay: []uint64{1e9, 7e9}}
+	warning := []float64{10, 10, 1}
+	critical := []float64{20, 20, 2}
+
+	ckr := evaluateCPU(prev, next, 3*time.Second, warning, critical)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Equal(t, "cpu steal 15.00%, iowait 5.00%, max runqueue 2.00 (cpu1)", ckr.Message)
+
+	next.runDelay[1] = 8e9
+	ckr = evaluateCPU(prev, next, 3*time.Second, warning, critical)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+
+	ckr = evaluateCPU(prev, prev, 3*time.Second, warning, critical)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "cpu steal 0.00%, iowait 0.00%, max runqueue 0.00 (cpu0)", ckr.Message)
+}
+
+func TestRunPSIWithPerCPU(t *testing.T) {
+	for _, args := range [][]string{
+		{"--psi", "--percpu", "-w", "10,5", "-c", "20,10"},
+		{"--psi", "--cpu", "-w", "10,5", "-c", "20,10"},
+	} {
+		ckr := run(args)
+		assert.Equal(t, checkers.UNKNOWN, ckr.Status, args)
+		assert.Equal(t, "--psi can't be combined with --percpu or --cpu", ckr.Message)
+	}
+}
@@ -2,9 +2,7 @@ package checklog
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,15 +12,17 @@ import (
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
-	"github.com/mackerelio/golib/pluginutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	statefile "github.com/mackerelio/go-check-plugins/internal/state"
 	"github.com/mattn/go-encoding"
 	"github.com/mattn/go-zglob"
-	"github.com/natefinch/atomic"
 	enc "golang.org/x/text/encoding"
 )
 
@@ -31,7 +31,8 @@ var defaultSignal = os.Interrupt
 
 type logOpts struct {
 	LogFile             string   `short:"f" long:"file" value-name:"FILE" description:"Path to log file"`
-	Pattern             []string `short:"p" long:"pattern" required:"true" value-name:"PAT" description:"Pattern to search for. If specified multiple, they will be treated together with the AND operator"`
+	Pattern             []string `short:"p" long:"pattern" value-name:"PAT" description:"Pattern to search for. If specified multiple, they will be treated together with the AND operator"`
+	Preset              []string `long:"preset" value-name:"NAME" description:"Search for any of the curated patterns of NAME (oom-killer, segfault, oom-kubelet or mce), together with --pattern by the AND operator. If specified multiple, any of their patterns is searched for"`
 	SuppressPattern     bool     `long:"suppress-pattern" description:"Suppress pattern display"`
 	Exclude             []string `short:"E" long:"exclude" value-name:"PAT" description:"Pattern to exclude from matching. If specified multiple, they will be treated together with the AND operator"`
 	WarnOver            int64    `short:"w" long:"warning-over" description:"Trigger a warning if matched lines is over a number"`
@@ -47,12 +48,17 @@ type logOpts struct {
 	Encoding            string   `long:"encoding" description:"Encoding of log file"`
 	Missing             string   `long:"missing" default:"UNKNOWN" value-name:"(CRITICAL|WARNING|OK|UNKNOWN)" description:"Exit status when log files missing"`
 	CheckFirst          bool     `long:"check-first" description:"Check the log on the first run"`
+	RateWarn            *float64 `long:"rate-warning" value-name:"N" description:"Trigger a warning if matched lines per minute since the last run is over a number"`
+	RateCrit            *float64 `long:"rate-critical" value-name:"N" description:"Trigger a critical if matched lines per minute since the last run is over a number"`
+	SuppressDuplicates  int      `long:"suppress-duplicates" value-name:"N" description:"Hold the last alert level for N runs unless new distinct lines are matched"`
 	patternReg          []*regexp.Regexp
 	excludeReg          []*regexp.Regexp
 	fileListFromGlob    []string
 	fileListFromPattern []string
 	origArgs            []string
 	decoder             *enc.Decoder
+	lastRun             time.Time // the earliest last run of the files
+	selftest.SelfTestOpts
 
 	testHookNewBufferedReader func(r io.Reader) *bufio.Reader
 }
@@ -66,6 +72,10 @@ func (opts *logOpts) prepare() error {
 		return fmt.Errorf("search-in-directory option must be used with file-pattern option")
 	}
 
+	if len(opts.Pattern) == 0 && len(opts.Preset) == 0 {
+		return fmt.Errorf("pattern or preset must be specified")
+	}
+
 	var err error
 	var reg *regexp.Regexp
 	for _, ptn := range opts.Pattern {
@@ -74,11 +84,25 @@ func (opts *logOpts) prepare() error {
 		}
 		opts.patternReg = append(opts.patternReg, reg)
 	}
+	if len(opts.Preset) > 0 {
+		ptn, err := presetPattern(opts.Preset)
+		if err != nil {
+			return err
+		}
+		if reg, err = regCompileWithCase(ptn, opts.CaseInsensitive); err != nil {
+			return err
+		}
+		opts.patternReg = append(opts.patternReg, reg)
+	}
 
 	if len(opts.patternReg) > 1 && (opts.WarnLevel > 0 || opts.CritLevel > 0) {
 		return fmt.Errorf("When multiple patterns specified, --warning-level --critical-level can not be used")
 	}
 
+	if len(opts.Preset) > 0 && (opts.WarnLevel > 0 || opts.CritLevel > 0) {
+		return fmt.Errorf("--warning-level --critical-level can not be used with --preset")
+	}
+
 	for _, exclude := range opts.Exclude {
 		if reg, err = regCompileWithCase(exclude, opts.CaseInsensitive); err != nil {
 			return fmt.Errorf("exclude pattern is invalid")
@@ -103,6 +127,12 @@ func (opts *logOpts) prepare() error {
 	if !validateMissing(opts.Missing) {
 		return fmt.Errorf("missing option is invalid")
 	}
+	if opts.NoState && (opts.RateWarn != nil || opts.RateCrit != nil) {
+		return fmt.Errorf("--rate-warning and --rate-critical can not be used with --no-state")
+	}
+	if opts.NoState && opts.SuppressDuplicates > 0 {
+		return fmt.Errorf("--suppress-duplicates can not be used with --no-state")
+	}
 	return nil
 }
 
@@ -123,6 +153,14 @@ func Do() {
 	ckr.Exit()
 }
 
+// Run runs the plugin with args, which exclude the program name, and returns the result.
+// Unlike Do, it doesn't stop reading the logs on a signal.
+func Run(args []string) *checkers.Checker {
+	ckr := run(context.Background(), args)
+	ckr.Name = "LOG"
+	return ckr
+}
+
 func regCompileWithCase(ptn string, caseInsensitive bool) (*regexp.Regexp, error) {
 	if caseInsensitive {
 		ptn = "(?i)" + ptn
@@ -145,27 +183,36 @@ func parseArgs(args []string) (*logOpts, error) {
 	opts := &logOpts{}
 	_, err := flags.ParseArgs(opts, args)
 	opts.origArgs = origArgs
-	if opts.StateDir == "" {
-		workdir := pluginutil.PluginWorkDir()
-		opts.StateDir = filepath.Join(workdir, "check-log")
-	}
+	opts.StateDir = statefile.Dir(opts.StateDir, "check-log")
 	return opts, err
 }
 
 func run(ctx context.Context, args []string) *checkers.Checker {
 	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
 	err = opts.prepare()
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	if opts.SelfTest {
+		// log files may not exist yet, so only their directories are checked.
+		var checks []selftest.Check
+		if opts.LogFile != "" {
+			checks = append(checks, selftest.Exists(filepath.Dir(opts.LogFile)))
+		}
+		if opts.Directory != "" {
+			checks = append(checks, selftest.Exists(opts.Directory))
+		}
+		return selftest.Run(checks...)
+	}
 
 	warnNum := int64(0)
 	critNum := int64(0)
 	var missingFiles []string
+	var matchedLines []string
 	errorOverall := ""
 
 	if opts.LogFile != "" && len(opts.fileListFromGlob) == 0 {
@@ -187,6 +234,9 @@ func run(ctx context.Context, args []string) *checkers.Checker {
 		}
 		warnNum += w
 		critNum += c
+		if errLines != "" {
+			matchedLines = append(matchedLines, strings.Split(strings.TrimSuffix(errLines, "\n"), "\n")...)
+		}
 		if opts.ReturnContent && errLines != "" {
 			errorOverall += "[" + f + "]\n" + errLines
 		}
@@ -196,12 +246,24 @@ func run(ctx context.Context, args []string) *checkers.Checker {
 	for _, ptn := range opts.Pattern {
 		patterns = append(patterns, fmt.Sprintf("/%s/", ptn))
 	}
+	if len(opts.Preset) > 0 {
+		patterns = append(patterns, fmt.Sprintf("preset %s", strings.Join(opts.Preset, " or ")))
+	}
 	var msg string
 	if opts.SuppressPattern {
 		msg = fmt.Sprintf("%d warnings, %d criticals.", warnNum, critNum)
 	} else {
 		msg = fmt.Sprintf("%d warnings, %d criticals for pattern %s.", warnNum, critNum, strings.Join(patterns, " and "))
 	}
+	warnRate, critRate, hasRate := float64(0), float64(0), false
+	if opts.RateWarn != nil || opts.RateCrit != nil {
+		now := time.Now()
+		warnRate, hasRate = matchRate(warnNum, opts.lastRun, now)
+		critRate, _ = matchRate(critNum, opts.lastRun, now)
+		if hasRate {
+			msg += fmt.Sprintf(" (%.2f warnings/min, %.2f criticals/min)", warnRate, critRate)
+		}
+	}
 	if errorOverall != "" {
 		msg += "\n" + errorOverall
 	}
@@ -227,9 +289,96 @@ func run(ctx context.Context, args []string) *checkers.Checker {
 	if critNum > opts.CritOver {
 		checkSt = checkers.CRITICAL
 	}
+	if hasRate {
+		if opts.RateWarn != nil && warnRate > *opts.RateWarn && checkSt != checkers.CRITICAL {
+			checkSt = checkers.WARNING
+		}
+		if opts.RateCrit != nil && critRate > *opts.RateCrit {
+			checkSt = checkers.CRITICAL
+		}
+	}
+	if opts.SuppressDuplicates > 0 {
+		f := getDuplicatesStateFile(opts.StateDir, opts.origArgs)
+		var prev *duplicatesState
+		if _, err := statefile.Load(f, &prev); err != nil {
+			// start over rather than failing on the corrupted file
+			log.Printf("failed to load the duplicates state (will be ignored): %s", err)
+			prev = nil
+		}
+		st, next := opts.suppressDuplicates(checkSt, opts.signatures(matchedLines), prev)
+		if st != checkSt {
+			checkSt = st
+			msg += fmt.Sprintf("\nHolding %s as no new distinct lines are matched (%d more runs).", st, next.Remaining)
+		}
+		if err := statefile.Save(f, next); err != nil {
+			log.Printf("failed to save the duplicates state: %s\n", err.Error())
+		}
+	}
 	return checkers.NewChecker(checkSt, msg)
 }
 
+// signatures returns the sorted distinct signatures of the matched lines.
+// The signature of a line is the text matched by the patterns, so that
+// the lines differ only in timestamps or the like are regarded as the same.
+func (opts *logOpts) signatures(lines []string) []string {
+	seen := make(map[string]bool)
+	var sigs []string
+	for _, line := range lines {
+		var parts []string
+		for _, pReg := range opts.patternReg {
+			parts = append(parts, pReg.FindString(line))
+		}
+		sig := strings.Join(parts, "\t")
+		if !seen[sig] {
+			seen[sig] = true
+			sigs = append(sigs, sig)
+		}
+	}
+	sort.Strings(sigs)
+	return sigs
+}
+
+// suppressDuplicates holds the status at the last alert level for opts.SuppressDuplicates runs
+// unless the lines with new signatures are matched or the status gets worse.
+// It returns the status to report and the state to save for the next run.
+func (opts *logOpts) suppressDuplicates(st checkers.Status, sigs []string, prev *duplicatesState) (checkers.Status, *duplicatesState) {
+	if prev != nil && prev.Remaining > 0 && st <= prev.Status && containsAll(prev.Signatures, sigs) {
+		return prev.Status, &duplicatesState{
+			Status:     prev.Status,
+			Signatures: prev.Signatures,
+			Remaining:  prev.Remaining - 1,
+		}
+	}
+	if st == checkers.OK {
+		return st, &duplicatesState{}
+	}
+	return st, &duplicatesState{
+		Status:     st,
+		Signatures: sigs,
+		Remaining:  opts.SuppressDuplicates,
+	}
+}
+
+// containsAll reports whether the sorted set contains all of the sorted subset.
+func containsAll(set, subset []string) bool {
+	for _, s := range subset {
+		i := sort.SearchStrings(set, s)
+		if i == len(set) || set[i] != s {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRate returns the number of matched lines per minute since lastRun.
+// It returns false if there was no last run.
+func matchRate(n int64, lastRun, now time.Time) (float64, bool) {
+	if lastRun.IsZero() || !now.After(lastRun) {
+		return 0, false
+	}
+	return float64(n) / now.Sub(lastRun).Minutes(), true
+}
+
 func (opts *logOpts) searchLog(ctx context.Context, logFile string) (int64, int64, string, error) {
 	if ctx.Err() != nil {
 		return 0, 0, "", nil
@@ -251,6 +400,10 @@ func (opts *logOpts) searchLog(ctx context.Context, logFile string) (int64, int6
 			return 0, 0, "", err
 		}
 		inode = i
+
+		if t := getLastRun(stateFile); !t.IsZero() && (opts.lastRun.IsZero() || t.Before(opts.lastRun)) {
+			opts.lastRun = t
+		}
 	}
 
 	f, err := os.Open(logFile)
@@ -323,7 +476,7 @@ func (opts *logOpts) searchLog(ctx context.Context, logFile string) (int64, int6
 	}
 
 	if !opts.NoState {
-		err = saveState(stateFile, &state{SkipBytes: skipBytes, Inode: detectInode(stat)})
+		err = saveState(stateFile, &state{SkipBytes: skipBytes, Inode: detectInode(stat), LastRun: time.Now().Unix()})
 		if err != nil {
 			log.Printf("writeByteToSkip failed: %s\n", err.Error())
 		}
@@ -457,6 +610,7 @@ func parseFilePattern(directory, filePattern string, caseInsensitive bool) ([]st
 type state struct {
 	SkipBytes int64 `json:"skip_bytes"`
 	Inode     uint  `json:"inode"`
+	LastRun   int64 `json:"last_run,omitempty"`
 }
 
 func loadState(fname string) (*state, error) {
@@ -479,15 +633,10 @@ func loadState(fname string) (*state, error) {
 
 var stateRe = regexp.MustCompile(`^([a-zA-Z]):[/\\]`)
 
+// getStateFile returns the state file named after the path of the log file,
+// so that the files of the other logs are in the directories under stateDir.
 func getStateFile(stateDir, f string, args []string) string {
-	return filepath.Join(
-		stateDir,
-		fmt.Sprintf(
-			"%s-%x.json",
-			stateRe.ReplaceAllString(f, `$1`+string(filepath.Separator)),
-			md5.Sum([]byte(strings.Join(args, " "))),
-		),
-	)
+	return statefile.File(stateDir, stateRe.ReplaceAllString(f, `$1`+string(filepath.Separator)), args...)
 }
 
 var errValidStateFileNotFound = fmt.Errorf("state file not found, or corrupted")
@@ -545,12 +694,28 @@ func getInode(f string) (uint, error) {
 	return 0, nil
 }
 
-func saveState(f string, state *state) error {
-	b, _ := json.Marshal(state)
-	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
-		return err
+// getLastRun returns the time of the last run, or zero time if it is unknown.
+func getLastRun(f string) time.Time {
+	state, err := loadState(f)
+	if err != nil || state == nil || state.LastRun == 0 {
+		return time.Time{}
 	}
-	return atomic.WriteFile(f, bytes.NewReader(b))
+	return time.Unix(state.LastRun, 0)
+}
+
+func saveState(f string, state *state) error {
+	return statefile.Save(f, state)
+}
+
+// duplicatesState is the last alert to hold by --suppress-duplicates.
+type duplicatesState struct {
+	Status     checkers.Status `json:"status"`
+	Signatures []string        `json:"signatures"`
+	Remaining  int             `json:"remaining"`
+}
+
+func getDuplicatesStateFile(stateDir string, args []string) string {
+	return statefile.File(stateDir, "duplicates", strings.Join(args, " "))
 }
 
 var errFileNotFoundByInode = fmt.Errorf("old file not found")
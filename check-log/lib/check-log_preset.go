@@ -0,0 +1,61 @@
+package checklog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets are the patterns of the common failures found in kernel logs and syslog.
+// Any of the patterns of the presets matches, unlike --pattern.
+var presets = map[string][]string{
+	// the OOM killer of the kernel, including the memory cgroups
+	"oom-killer": {
+		`\binvoked oom-killer\b`,
+		`\bOut of memory: Kill(?:ed)? process\b`,
+		`\bMemory cgroup out of memory: Kill(?:ed)? process\b`,
+	},
+	// the processes killed by the kernel for invalid memory accesses or instructions
+	"segfault": {
+		`\bsegfault at [0-9a-f]+ ip [0-9a-f]+ sp [0-9a-f]+ error\b`,
+		`\bgeneral protection(?: fault)? ip:`,
+		`\btrap (?:divide error|invalid opcode|int3) ip:`,
+	},
+	// the OOMs and the memory pressure evictions observed by kubelet
+	"oom-kubelet": {
+		`\bSystem OOM encountered\b`,
+		`\bOOMKilled\b`,
+		`(?i)\beviction manager: attempting to reclaim\b.*\bmemory\b`,
+	},
+	// the hardware errors reported by the machine check architecture and EDAC
+	"mce": {
+		`\bmce: \[Hardware Error\]`,
+		`\bMachine check events logged\b`,
+		`\bEDAC \S+: \d+ (?:CE|UE)\b`,
+		`\bhardware memory corruption\b`,
+	},
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presetPattern returns a pattern which matches any of the patterns of the presets.
+func presetPattern(names []string) (string, error) {
+	var ptns []string
+	for _, name := range names {
+		p, ok := presets[name]
+		if !ok {
+			return "", fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+		}
+		for _, ptn := range p {
+			ptns = append(ptns, "(?:"+ptn+")")
+		}
+	}
+	return strings.Join(ptns, "|"), nil
+}
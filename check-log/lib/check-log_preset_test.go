@@ -0,0 +1,111 @@
+package checklog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		preset string
+		lines  []string
+		others []string
+	}{
+		{
+			preset: "oom-killer",
+			lines: []string{
+				"kernel: [12345.678901] mysqld invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0",
+				"kernel: Out of memory: Killed process 1234 (mysqld) total-vm:1234kB, anon-rss:1234kB, file-rss:0kB, shmem-rss:0kB",
+				"kernel: Out of memory: Kill process 1234 (java) score 900 or sacrifice child",
+				"kernel: Memory cgroup out of memory: Killed process 1234 (java) total-vm:1234kB",
+			},
+			others: []string{
+				"systemd[1]: Started Out of memory handler.",
+			},
+		},
+		{
+			preset: "segfault",
+			lines: []string{
+				"kernel: [ 1234.567890] nginx[1234]: segfault at 0 ip 00007f1234567890 sp 00007ffd12345678 error 4 in libc-2.31.so[7f1234500000+178000]",
+				"kernel: traps: php-fpm[1234] general protection fault ip:55d1234567 sp:7ffd1234567 error:0 in php-fpm[55d1200000+300000]",
+				"kernel: traps: node[1234] general protection ip:7f1234567890 sp:7ffd12345678 error:0",
+				"kernel: traps: app[1234] trap invalid opcode ip:55d1234567 sp:7ffd1234567 error:0 in app[55d1200000+1000]",
+			},
+			others: []string{
+				"myapp: handled segfault in the plugin",
+			},
+		},
+		{
+			preset: "oom-kubelet",
+			lines: []string{
+				"kubelet[1234]: W0101 00:00:00.000000    1234 manager.go:1234] System OOM encountered, victim process: java, pid: 1234",
+				`kubelet[1234]: I0101 00:00:00.000000    1234 kubelet.go:1234] "SyncLoop (PLEG): event for pod" pod="default/app" event={Type:ContainerDied Reason:OOMKilled}`,
+				`kubelet[1234]: I0101 00:00:00.000000    1234 eviction_manager.go:349] "Eviction manager: attempting to reclaim" resourceName="memory"`,
+			},
+			others: []string{
+				`kubelet[1234]: I0101 00:00:00.000000    1234 eviction_manager.go:349] "Eviction manager: attempting to reclaim" resourceName="ephemeral-storage"`,
+			},
+		},
+		{
+			preset: "mce",
+			lines: []string{
+				"kernel: mce: [Hardware Error]: CPU 0: Machine Check: 0 Bank 8: cc00008000010090",
+				"kernel: [Hardware Error]: Machine check events logged",
+				"kernel: EDAC MC0: 1 CE memory read error on CPU_SrcID#0_Ha#0_Chan#0_DIMM#0 (channel:0 slot:0 page:0x1234 offset:0x0 grain:32 syndrome:0x0)",
+				"kernel: Memory failure: 0x1234: Killing java:1234 due to hardware memory corruption",
+			},
+			others: []string{
+				"kernel: EDAC MC: Ver: 3.0.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		ptn, err := presetPattern([]string{tt.preset})
+		if !assert.NoError(t, err, tt.preset) {
+			continue
+		}
+		reg := regexp.MustCompile(ptn)
+		for _, line := range tt.lines {
+			assert.True(t, reg.MatchString(line), "%s should match %q", tt.preset, line)
+		}
+		for _, line := range tt.others {
+			assert.False(t, reg.MatchString(line), "%s should not match %q", tt.preset, line)
+		}
+	}
+
+	_, err := presetPattern([]string{"oom-killer", "panic"})
+	assert.EqualError(t, err, `unknown preset "panic" (available: mce, oom-killer, oom-kubelet, segfault)`)
+}
+
+func TestRunWithPreset(t *testing.T) {
+	dir := t.TempDir()
+	logf := filepath.Join(dir, "kern.log")
+	err := os.WriteFile(logf, []byte(
+		"kernel: Out of memory: Killed process 1234 (mysqld) total-vm:1234kB\n"+
+			"kernel: Out of memory: Killed process 2345 (java) total-vm:1234kB\n"+
+			"kernel: nginx[1234]: segfault at 0 ip 00007f1234567890 sp 00007ffd12345678 error 4 in libc-2.31.so\n"+
+			"kernel: eth0: link up\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ckr := run(context.Background(), []string{"-s", dir, "-f", logf, "--check-first", "--preset", "oom-killer", "--preset", "segfault"})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "3 warnings, 3 criticals for pattern preset oom-killer or segfault.", ckr.Message)
+
+	ckr = run(context.Background(), []string{"-s", dir, "-f", logf, "--no-state", "--preset", "oom-killer", "-p", "mysqld"})
+	assert.Equal(t, "1 warnings, 1 criticals for pattern /mysqld/ and preset oom-killer.", ckr.Message)
+
+	ckr = run(context.Background(), []string{"-s", dir, "-f", logf, "--no-state"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "pattern or preset must be specified", ckr.Message)
+
+	ckr = run(context.Background(), []string{"-s", dir, "-f", logf, "--no-state", "--preset", "oom-killer", "--warning-level", "10"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+}
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/mackerelio/checkers"
+	statefile "github.com/mackerelio/go-check-plugins/internal/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -968,6 +969,154 @@ func TestRunMultipleExcludePattern(t *testing.T) {
 	}
 }
 
+func TestMatchRate(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok := matchRate(10, time.Time{}, now)
+	assert.False(t, ok, "the rate should not be computed without the last run")
+
+	r, ok := matchRate(10, now.Add(-5*time.Minute), now)
+	assert.True(t, ok)
+	assert.Equal(t, 2.0, r, "10 lines in 5 minutes should be 2 lines per minute")
+
+	r, ok = matchRate(30, now.Add(-30*time.Second), now)
+	assert.True(t, ok)
+	assert.Equal(t, 60.0, r, "30 lines in 30 seconds should be 60 lines per minute")
+}
+
+func TestRunWithRate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-log-test")
+	if err != nil {
+		t.Errorf("something went wrong")
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	logf := filepath.Join(dir, "dummy")
+	fh, _ := os.Create(logf)
+	t.Cleanup(func() {
+		fh.Close()
+	})
+
+	params := []string{"-s", dir, "-f", logf, "-p", `FATAL`, "-w", "100", "-c", "100", "--rate-warning", "1", "--rate-critical", "5", "--suppress-pattern"}
+	opts, _ := parseArgs(params)
+	opts.prepare()
+	stateFile := getStateFile(opts.StateDir, logf, opts.origArgs)
+
+	t.Run("first run", func(t *testing.T) {
+		fh.WriteString("FATAL\nFATAL\n")
+		ckr := run(context.Background(), params)
+		assert.Equal(t, checkers.OK, ckr.Status, "the rate should not be checked on the first run")
+		assert.Equal(t, "0 warnings, 0 criticals.", ckr.Message)
+		assert.False(t, getLastRun(stateFile).IsZero(), "the last run should be saved")
+	})
+
+	lines := strings.Repeat("FATAL\n", 30)
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    checkers.Status
+	}{
+		{"slow-burn", time.Hour, checkers.OK},
+		{"burst", 10 * time.Minute, checkers.WARNING},
+		{"flood", 2 * time.Minute, checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := loadState(stateFile)
+			s.LastRun = time.Now().Add(-tt.elapsed).Unix()
+			saveState(stateFile, s)
+
+			fh.WriteString(lines)
+			ckr := run(context.Background(), params)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		})
+	}
+
+	t.Run("with no-state", func(t *testing.T) {
+		ckr := run(context.Background(), append(params, "--no-state"))
+		assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	})
+}
+
+func TestSuppressDuplicates(t *testing.T) {
+	opts := &logOpts{SuppressDuplicates: 2}
+	sigs := []string{"ERROR: disk full", "ERROR: timeout"}
+
+	st, next := opts.suppressDuplicates(checkers.CRITICAL, sigs, nil)
+	assert.Equal(t, checkers.CRITICAL, st, "the first alert should not be suppressed")
+	assert.Equal(t, &duplicatesState{Status: checkers.CRITICAL, Signatures: sigs, Remaining: 2}, next)
+
+	st, next = opts.suppressDuplicates(checkers.OK, nil, next)
+	assert.Equal(t, checkers.CRITICAL, st, "the alert should be held without new lines")
+	assert.Equal(t, 1, next.Remaining)
+
+	st, next = opts.suppressDuplicates(checkers.WARNING, []string{"ERROR: timeout"}, next)
+	assert.Equal(t, checkers.CRITICAL, st, "the alert should be held with the duplicate lines")
+	assert.Equal(t, 0, next.Remaining)
+
+	st, next = opts.suppressDuplicates(checkers.OK, nil, next)
+	assert.Equal(t, checkers.OK, st, "the alert should not be held over N runs")
+	assert.Equal(t, &duplicatesState{}, next)
+
+	_, next = opts.suppressDuplicates(checkers.WARNING, sigs[:1], nil)
+	st, next = opts.suppressDuplicates(checkers.WARNING, sigs, next)
+	assert.Equal(t, checkers.WARNING, st)
+	assert.Equal(t, sigs, next.Signatures, "new distinct lines should be alerted again")
+	assert.Equal(t, 2, next.Remaining)
+
+	st, _ = opts.suppressDuplicates(checkers.CRITICAL, sigs, next)
+	assert.Equal(t, checkers.CRITICAL, st, "the status getting worse should not be suppressed")
+}
+
+func TestRunWithSuppressDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-log-test")
+	if err != nil {
+		t.Errorf("something went wrong")
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	logf := filepath.Join(dir, "dummy")
+	fh, _ := os.Create(logf)
+	t.Cleanup(func() {
+		fh.Close()
+	})
+
+	params := []string{"-s", dir, "-f", logf, "-p", `ERROR: \w+`, "-c", "100", "--suppress-duplicates", "2", "--suppress-pattern"}
+
+	tests := []struct {
+		name  string
+		lines string
+		want  checkers.Status
+	}{
+		{"first run", "", checkers.OK},
+		{"alert", "10:00 ERROR: timeout\n", checkers.WARNING},
+		{"held", "", checkers.WARNING},
+		{"held again", "", checkers.WARNING},
+		{"expired", "", checkers.OK},
+		{"alert again", "10:02 ERROR: timeout\n", checkers.WARNING},
+		{"duplicate", "10:03 ERROR: timeout\n", checkers.WARNING},
+		{"new line", "10:04 ERROR: refused\n", checkers.WARNING},
+		{"held with new line", "", checkers.WARNING},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fh.WriteString(tt.lines)
+			ckr := run(context.Background(), params)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		})
+	}
+
+	var s duplicatesState
+	_, err = statefile.Load(getDuplicatesStateFile(dir, params), &s)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ERROR: refused"}, s.Signatures, "the signatures should be the matched text")
+	assert.Equal(t, 1, s.Remaining)
+}
+
 func TestParseFilePattern(t *testing.T) {
 	dir := t.TempDir()
 
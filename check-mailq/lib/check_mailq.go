@@ -10,13 +10,20 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Mailq"
-	ckr.Exit()
+	return ckr
 }
 
 type monitor struct {
@@ -47,26 +54,63 @@ func newMonitor(warning, critical int64) *monitor {
 	}
 }
 
-var opts struct {
-	Warning  int64  `short:"w" long:"warning" default:"100" description:"number of messages in queue to generate warning"`
-	Critical int64  `short:"c" long:"critical" default:"200" description:"number of messages in queue to generate critical alert ( w < c )"`
-	Mta      string `short:"M" long:"mta" default:"postfix" description:"target mta"`
+type mailqOpts struct {
+	Warning  int64    `short:"w" long:"warning" default:"100" description:"number of messages in queue to generate warning"`
+	Critical int64    `short:"c" long:"critical" default:"200" description:"number of messages in queue to generate critical alert ( w < c )"`
+	Mta      string   `short:"M" long:"mta" default:"postfix" description:"target mta"`
+	Domains  []string `short:"d" long:"domain" value-name:"DOMAIN" description:"count only the messages to the recipient domain, and check each domain with the thresholds (may be repeated)"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// output executes the command of the MTA and returns its output.
+func output(name string) ([]byte, error) {
+	end := debuglog.Trace("exec: %s", name)
+	out, err := exec.Command(name).Output()
+	end(err)
+	return out, err
+}
+
+// command returns the command of the MTA which the check executes.
+func (opts *mailqOpts) command() (string, error) {
+	switch opts.Mta {
+	case "postfix":
+		return "mailq", nil
+	case "qmail":
+		if len(opts.Domains) > 0 {
+			return "qmail-qread", nil
+		}
+		return "qmail-qstat", nil
+	}
+	return "", fmt.Errorf("%s: specified mta's check is not implemented.", opts.Mta)
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &mailqOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.SelfTest {
+		name, err := opts.command()
+		if err != nil {
+			return selftest.Run(func() error { return err })
+		}
+		return selftest.Run(selftest.Executable(name))
 	}
 
 	var queue int64
 	queueStr := "0"
 	monitor := newMonitor(opts.Warning, opts.Critical)
+	if len(opts.Domains) > 0 {
+		return opts.checkDomains(monitor)
+	}
 
 	result := checkers.OK
 
 	if opts.Mta == "postfix" {
-		out, err := exec.Command("mailq").Output()
+		out, err := output("mailq")
 
 		if err != nil {
 			return checkers.Unknown(err.Error())
@@ -81,7 +125,7 @@ func run(args []string) *checkers.Checker {
 			queue, err = strconv.ParseInt(queueStr, 10, 64)
 		}
 	} else if opts.Mta == "qmail" {
-		out, err := exec.Command("qmail-qstat").Output()
+		out, err := output("qmail-qstat")
 
 		if err != nil {
 			return checkers.Unknown(err.Error())
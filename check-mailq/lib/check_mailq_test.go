@@ -0,0 +1,17 @@
+package checkmailq
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestSelfTestUnknownMta(t *testing.T) {
+	ckr := run([]string{"--mta", "exim", "--self-test"})
+	if ckr.Status != checkers.UNKNOWN {
+		t.Errorf("status = %s, want UNKNOWN", ckr.Status)
+	}
+	if want := "self-test failed: exim: specified mta's check is not implemented."; ckr.Message != want {
+		t.Errorf("message = %q, want %q", ckr.Message, want)
+	}
+}
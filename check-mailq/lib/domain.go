@@ -0,0 +1,131 @@
+package checkmailq
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// checkDomains checks the number of queued messages to each of the domains.
+func (opts *mailqOpts) checkDomains(m *monitor) *checkers.Checker {
+	var counts map[string]int64
+	switch opts.Mta {
+	case "postfix":
+		out, err := output("mailq")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		counts = countPostfixDomains(string(out))
+	case "qmail":
+		out, err := output("qmail-qread")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		counts = countQmailDomains(string(out))
+	default:
+		return checkers.Unknown(fmt.Sprintf("%s: specified mta's check is not implemented.", opts.Mta))
+	}
+	return evaluateDomains(m, counts, opts.Domains)
+}
+
+func evaluateDomains(m *monitor, counts map[string]int64, domains []string) *checkers.Checker {
+	result := checkers.OK
+	msgs := make([]string, 0, len(domains))
+	for _, d := range domains {
+		queue := counts[strings.ToLower(d)]
+		if m.checkCritical(queue) {
+			result = checkers.CRITICAL
+		} else if m.checkWarning(queue) && result == checkers.OK {
+			result = checkers.WARNING
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %d", d, queue))
+	}
+	return checkers.NewChecker(result, strings.Join(msgs, ", "))
+}
+
+// countPostfixDomains counts the messages in the output of mailq by the recipient domains.
+// A message to several recipients in a domain is counted once.
+//
+//	-Queue ID-  --Size-- ----Arrival Time---- -Sender/Recipient-------
+//	3F1A52C0B3*    1234 Mon Jan 15 09:30:12  sender@example.com
+//	(connect to mx.example.org[192.0.2.1]:25: Connection refused)
+//	                                         user1@example.org
+//	                                         user2@example.org
+func countPostfixDomains(out string) map[string]int64 {
+	counts := make(map[string]int64)
+	var domains map[string]bool
+	flush := func() {
+		for d := range domains {
+			counts[d]++
+		}
+		domains = nil
+	}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case strings.HasPrefix(line, "-"):
+			// the header and the summary
+		case line[0] != ' ' && line[0] != '\t' && line[0] != '(':
+			// the queue id and the sender
+			flush()
+			domains = make(map[string]bool)
+		case domains != nil && line[0] != '(':
+			if d := recipientDomain(strings.TrimSpace(line)); d != "" {
+				domains[d] = true
+			}
+		}
+	}
+	flush()
+	return counts
+}
+
+// countQmailDomains counts the messages in the output of qmail-qread by the recipient domains.
+// The recipients which have already been delivered are ignored.
+//
+//	15 Jan 2024 09:30:12 GMT  #1234567  1234  <sender@example.com>
+//		remote	user1@example.org
+//		done	remote	user2@example.net
+func countQmailDomains(out string) map[string]int64 {
+	counts := make(map[string]int64)
+	var domains map[string]bool
+	flush := func() {
+		for d := range domains {
+			counts[d]++
+		}
+		domains = nil
+	}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			flush()
+			domains = make(map[string]bool)
+			continue
+		}
+		fields := strings.Fields(line)
+		if domains == nil || len(fields) < 2 || fields[0] == "done" {
+			continue
+		}
+		if d := recipientDomain(fields[len(fields)-1]); d != "" {
+			domains[d] = true
+		}
+	}
+	flush()
+	return counts
+}
+
+func recipientDomain(addr string) string {
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(addr[i+1:], ">"))
+}
@@ -0,0 +1,72 @@
+package checkmailq
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestCountPostfixDomains(t *testing.T) {
+	out := `-Queue ID-  --Size-- ----Arrival Time---- -Sender/Recipient-------
+3F1A52C0B3*    1234 Mon Jan 15 09:30:12  sender@example.com
+                                         user1@Example.org
+                                         user2@example.org
+
+4B2C63D1C4     5678 Mon Jan 15 09:31:00  sender@example.com
+(connect to mx.example.org[192.0.2.1]:25: Connection refused)
+                                         user3@example.org
+                                         user4@crm.example.net
+
+5C3D74E2D5!    910 Mon Jan 15 09:32:00  MAILER-DAEMON
+                                         user5@crm.example.net
+
+-- 8 Kbytes in 3 Requests.
+`
+	want := map[string]int64{"example.org": 2, "crm.example.net": 2}
+	if got := countPostfixDomains(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("countPostfixDomains() = %v, want %v", got, want)
+	}
+
+	if got := countPostfixDomains("Mail queue is empty\n"); len(got) != 0 {
+		t.Errorf("countPostfixDomains() = %v, want empty", got)
+	}
+}
+
+func TestCountQmailDomains(t *testing.T) {
+	out := "15 Jan 2024 09:30:12 GMT  #1234567  1234  <sender@example.com>\n" +
+		"\tremote\tuser1@example.org\n" +
+		"\tremote\tuser2@example.org\n" +
+		"\tdone\tremote\tuser3@crm.example.net\n" +
+		"15 Jan 2024 09:31:00 GMT  #1234568  5678  <sender@example.com>\n" +
+		"\tremote\tuser4@crm.example.net\n" +
+		"\tlocal\tuser5@example.org\n"
+	want := map[string]int64{"example.org": 2, "crm.example.net": 1}
+	if got := countQmailDomains(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("countQmailDomains() = %v, want %v", got, want)
+	}
+}
+
+func TestEvaluateDomains(t *testing.T) {
+	counts := map[string]int64{"example.org": 150, "crm.example.net": 20}
+	tests := []struct {
+		warning, critical int64
+		domains           []string
+		want              checkers.Status
+		msg               string
+	}{
+		{100, 200, []string{"crm.example.net"}, checkers.OK, "crm.example.net: 20"},
+		{10, 100, []string{"crm.example.net"}, checkers.WARNING, "crm.example.net: 20"},
+		{10, 100, []string{"CRM.example.net", "example.org", "example.com"}, checkers.CRITICAL, "CRM.example.net: 20, example.org: 150, example.com: 0"},
+		{0, 0, []string{"example.org"}, checkers.OK, "example.org: 150"},
+	}
+	for _, tt := range tests {
+		ckr := evaluateDomains(newMonitor(tt.warning, tt.critical), counts, tt.domains)
+		if ckr.Status != tt.want {
+			t.Errorf("status = %s, want %s", ckr.Status, tt.want)
+		}
+		if ckr.Message != tt.msg {
+			t.Errorf("message = %q, want %q", ckr.Message, tt.msg)
+		}
+	}
+}
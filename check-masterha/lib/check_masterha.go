@@ -9,15 +9,33 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // Do the plugin
 func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
 	var opts options
 	parser := flags.NewParser(&opts, flags.Default)
-	if _, err := parser.Parse(); err != nil {
-		os.Exit(1)
+	if _, err := parser.ParseArgs(args); err != nil {
+		return checkers.Unknown(err.Error())
 	}
+	var c interface{ check() *checkers.Checker }
+	switch parser.Active.Name {
+	case "status":
+		c = opts.Status
+	case "repl":
+		c = opts.Repl
+	case "ssh":
+		c = opts.SSH
+	}
+	checker := c.check()
+	checker.Name = "MasterHA"
+	return checker
 }
 
 type options struct {
@@ -37,6 +55,7 @@ type subcommand struct {
 	ConfigDir string `long:"confdir" default:"/usr/local/masterha/conf" description:"config directory"`
 	All       bool   `short:"a" long:"all" description:"use all config file for target"`
 	Executer  executer
+	selftest.SelfTestOpts
 }
 
 func (c subcommand) ConfigFiles() ([]string, error) {
@@ -85,6 +104,14 @@ func (c subcommand) executeAll() *checkers.Checker {
 		return checker
 	}
 
+	if c.SelfTest {
+		checks := []selftest.Check{selftest.Executable(c.MakeCommandName())}
+		for _, config := range configFiles {
+			checks = append(checks, selftest.Readable(config))
+		}
+		return selftest.Run(checks...)
+	}
+
 	for _, config := range configFiles {
 		checker = c.execute(config)
 		if checker.Status != checkers.OK {
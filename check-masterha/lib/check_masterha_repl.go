@@ -12,13 +12,9 @@ type replChecker struct {
 	SecondsBehindMaster int `long:"seconds_behind_master" description:"seconds_behind_master option for masterha_check_repl"`
 }
 
-func (c replChecker) Execute(args []string) error {
+func (c replChecker) check() *checkers.Checker {
 	c.Executer = &c
-
-	checker := c.executeAll()
-	checker.Name = "MasterHA"
-	checker.Exit()
-	return nil
+	return c.executeAll()
 }
 
 func (c replChecker) MakeCommandName() string {
@@ -10,13 +10,9 @@ type sshChecker struct {
 	subcommand
 }
 
-func (c sshChecker) Execute(args []string) error {
+func (c sshChecker) check() *checkers.Checker {
 	c.Executer = &c
-
-	checker := c.executeAll()
-	checker.Name = "MasterHA"
-	checker.Exit()
-	return nil
+	return c.executeAll()
 }
 
 func (c sshChecker) MakeCommandName() string {
@@ -10,13 +10,9 @@ type statusChecker struct {
 	subcommand
 }
 
-func (c statusChecker) Execute(args []string) error {
+func (c statusChecker) check() *checkers.Checker {
 	c.Executer = &c
-
-	checker := c.executeAll()
-	checker.Name = "MasterHA"
-	checker.Exit()
-	return nil
+	return c.executeAll()
 }
 
 func (c statusChecker) MakeCommandName() string {
@@ -7,37 +7,67 @@ import (
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
-var opts struct {
+type memcachedOpts struct {
 	Host    string `short:"H" long:"host" default:"localhost" description:"Hostname"`
 	Port    string `short:"p" long:"port" default:"11211" description:"Port"`
 	Timeout uint64 `short:"t" long:"timeout" default:"3" description:"Dial Timeout in sec"`
-	Key     string `short:"k" long:"key" required:"true" description:"Cache key used within set and get test"`
+	Key     string `short:"k" long:"key" description:"Cache key used within set and get test"`
+	Mode    string `long:"mode" default:"getset" choice:"getset" choice:"evictions" description:"getset tests setting and getting the key, evictions checks the evictions of slab classes"`
+
+	SlabClasses        []int   `long:"slab-class" value-name:"N" description:"Slab class to check the evictions of (may be repeated, default: all classes)"`
+	WarningEvictedAge  *uint64 `long:"warning-evicted-age" value-name:"SECONDS" description:"warning if a slab class has evicted an item accessed within the seconds since the last check"`
+	CriticalEvictedAge *uint64 `long:"critical-evicted-age" value-name:"SECONDS" description:"critical if a slab class has evicted an item accessed within the seconds since the last check"`
+	StateDir           string  `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Memcached"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &memcachedOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
+	}
+	if opts.Mode == "evictions" {
+		return opts.checkEvictions()
+	}
+	if opts.Key == "" {
+		return checkers.Unknown("--key is required with --mode=getset")
 	}
 
 	mc := memcache.New(opts.Host + ":" + opts.Port)
 	mc.Timeout = time.Duration(opts.Timeout) * time.Second
 
+	end := debuglog.Trace("memcached: set %s", opts.Key)
 	err = mc.Set(&memcache.Item{Key: opts.Key, Value: []byte("Check key"), Expiration: 240})
+	end(err)
 	if err != nil {
 		return checkers.Critical("couldn't set a key: " + err.Error())
 	}
 
+	end = debuglog.Trace("memcached: get %s", opts.Key)
 	item, err := mc.Get(opts.Key)
+	end(err)
 	if err != nil {
 		return checkers.Critical("couldn't get a key: " + err.Error())
 	}
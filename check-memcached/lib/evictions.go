@@ -0,0 +1,201 @@
+package checkmemcached
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+// slabStat is the statistics of a slab class from `stats items` and `stats slabs`.
+type slabStat struct {
+	ChunkSize   uint64 // bytes
+	Evicted     uint64 // the number of items evicted since the server started
+	EvictedTime uint64 // seconds since the last access of the last evicted item
+	Age         uint64 // seconds since the last access of the oldest item
+}
+
+// evictionsState is the eviction counters of the slab classes at the last check.
+type evictionsState struct {
+	Evicted map[int]uint64 `json:"evicted"`
+}
+
+func (opts *memcachedOpts) checkEvictions() *checkers.Checker {
+	if opts.WarningEvictedAge == nil && opts.CriticalEvictedAge == nil {
+		return checkers.Unknown("either --warning-evicted-age or --critical-evicted-age is required with --mode=evictions")
+	}
+
+	addr := net.JoinHostPort(opts.Host, opts.Port)
+	end := debuglog.Trace("memcached: dial %s", addr)
+	conn, err := net.DialTimeout("tcp", addr, time.Duration(opts.Timeout)*time.Second)
+	end(err)
+	if err != nil {
+		return checkers.Critical("couldn't connect: " + err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(opts.Timeout) * time.Second))
+	r := bufio.NewReader(conn)
+
+	items, err := getStats(conn, r, "items")
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	slabs, err := getStats(conn, r, "slabs")
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	stats := parseSlabStats(items, slabs)
+
+	stateFile := evictionsStateFile(state.Dir(opts.StateDir, "check-memcached"), addr)
+	var last *evictionsState
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cur := &evictionsState{Evicted: make(map[int]uint64)}
+	for class, s := range stats {
+		cur.Evicted[class] = s.Evicted
+	}
+	if err := state.Save(stateFile, cur); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if last == nil {
+		return checkers.Ok("no previous check to compare the evictions with")
+	}
+	return evaluateEvictions(stats, last, opts.SlabClasses, opts.WarningEvictedAge, opts.CriticalEvictedAge)
+}
+
+// getStats sends `stats <name>` and returns the STAT lines until END.
+func getStats(w io.Writer, r *bufio.Reader, name string) (m map[string]string, err error) {
+	end := debuglog.Trace("memcached: stats %s", name)
+	defer func() { end(err) }()
+	if _, err := fmt.Fprintf(w, "stats %s\r\n", name); err != nil {
+		return nil, err
+	}
+	m = make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read stats %s: %s", name, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "END" {
+			return m, nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("unexpected response to stats %s: %s", name, line)
+		}
+		m[fields[1]] = fields[2]
+	}
+}
+
+// parseSlabStats builds the statistics of each slab class from the stats of
+// `stats items`, such as "items:5:evicted", and `stats slabs`, such as "5:chunk_size".
+func parseSlabStats(items, slabs map[string]string) map[int]*slabStat {
+	stats := make(map[int]*slabStat)
+	get := func(class int) *slabStat {
+		s, ok := stats[class]
+		if !ok {
+			s = &slabStat{}
+			stats[class] = s
+		}
+		return s
+	}
+	for k, v := range items {
+		a := strings.Split(k, ":")
+		if len(a) != 3 || a[0] != "items" {
+			continue
+		}
+		class, err := strconv.Atoi(a[1])
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch a[2] {
+		case "evicted":
+			get(class).Evicted = n
+		case "evicted_time":
+			get(class).EvictedTime = n
+		case "age":
+			get(class).Age = n
+		}
+	}
+	for k, v := range slabs {
+		a := strings.Split(k, ":")
+		if len(a) != 2 || a[1] != "chunk_size" {
+			continue
+		}
+		class, err := strconv.Atoi(a[0])
+		if err != nil {
+			continue
+		}
+		// only the classes which have items are interesting
+		if s, ok := stats[class]; ok {
+			s.ChunkSize, _ = strconv.ParseUint(v, 10, 64)
+		}
+	}
+	return stats
+}
+
+// evaluateEvictions checks the slab classes which have evicted items since the last check.
+// The eviction of an item accessed recently means the class is short of memory for hot items.
+// If classes is empty, all slab classes are checked.
+func evaluateEvictions(stats map[int]*slabStat, last *evictionsState, classes []int, warning, critical *uint64) *checkers.Checker {
+	targets := classes
+	if len(targets) == 0 {
+		for class := range stats {
+			targets = append(targets, class)
+		}
+		sort.Ints(targets)
+	}
+
+	checkSt := checkers.OK
+	var msgs []string
+	for _, class := range targets {
+		s, ok := stats[class]
+		if !ok {
+			continue
+		}
+		evicted := s.Evicted
+		if prev, ok := last.Evicted[class]; ok && prev <= s.Evicted {
+			evicted -= prev
+		}
+		// Otherwise the server has been restarted, or the class has been created since the last check.
+		if evicted == 0 {
+			continue
+		}
+		st := checkers.OK
+		if critical != nil && s.EvictedTime < *critical {
+			st = checkers.CRITICAL
+		} else if warning != nil && s.EvictedTime < *warning {
+			st = checkers.WARNING
+		}
+		if st == checkers.OK {
+			continue
+		}
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, fmt.Sprintf("class %d (chunk %d bytes) evicted %d items, the last one accessed %d seconds ago (oldest item %d seconds)",
+			class, s.ChunkSize, evicted, s.EvictedTime, s.Age))
+	}
+	if len(msgs) == 0 {
+		return checkers.Ok("no recently accessed items were evicted")
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+func evictionsStateFile(stateDir, addr string) string {
+	return state.File(stateDir, "evictions", addr)
+}
@@ -0,0 +1,131 @@
+package checkmemcached
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestGetStats(t *testing.T) {
+	resp := "STAT items:1:evicted 3\r\nSTAT items:1:evicted_time 12\r\nEND\r\n"
+	var w bytes.Buffer
+	m, err := getStats(&w, bufio.NewReader(strings.NewReader(resp)), "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "stats items\r\n" {
+		t.Errorf("sent %q", w.String())
+	}
+	if m["items:1:evicted"] != "3" || m["items:1:evicted_time"] != "12" {
+		t.Errorf("getStats() = %v", m)
+	}
+
+	_, err = getStats(&w, bufio.NewReader(strings.NewReader("ERROR\r\n")), "items")
+	if err == nil {
+		t.Error("getStats() should fail on an unexpected response")
+	}
+}
+
+func TestParseSlabStats(t *testing.T) {
+	items := map[string]string{
+		"items:1:evicted":      "10",
+		"items:1:evicted_time": "5",
+		"items:1:age":          "3600",
+		"items:5:evicted":      "0",
+		"items:5:number":       "100",
+	}
+	slabs := map[string]string{
+		"1:chunk_size":    "96",
+		"5:chunk_size":    "240",
+		"7:chunk_size":    "384",
+		"active_slabs":    "2",
+		"total_malloced":  "2097152",
+		"1:used_chunks":   "10",
+		"5:total_chunks":  "4369",
+		"items:5:evicted": "1",
+	}
+	stats := parseSlabStats(items, slabs)
+	if len(stats) != 2 {
+		t.Fatalf("parseSlabStats() = %v", stats)
+	}
+	if s := stats[1]; *s != (slabStat{ChunkSize: 96, Evicted: 10, EvictedTime: 5, Age: 3600}) {
+		t.Errorf("class 1 = %+v", s)
+	}
+	if s := stats[5]; *s != (slabStat{ChunkSize: 240}) {
+		t.Errorf("class 5 = %+v", s)
+	}
+}
+
+func TestEvaluateEvictions(t *testing.T) {
+	u := func(n uint64) *uint64 { return &n }
+	stats := map[int]*slabStat{
+		1: {ChunkSize: 96, Evicted: 10, EvictedTime: 5, Age: 3600},
+		5: {ChunkSize: 240, Evicted: 7, EvictedTime: 100, Age: 7200},
+		7: {ChunkSize: 384, Evicted: 2, EvictedTime: 1, Age: 60},
+	}
+	last := &evictionsState{Evicted: map[int]uint64{1: 4, 5: 3, 7: 2}}
+
+	tests := []struct {
+		name     string
+		classes  []int
+		warning  *uint64
+		critical *uint64
+		status   checkers.Status
+		msg      string
+	}{
+		{
+			name:    "no young evictions",
+			warning: u(5),
+			status:  checkers.OK,
+			msg:     "no recently accessed items were evicted",
+		},
+		{
+			name:     "all classes",
+			warning:  u(300),
+			critical: u(10),
+			status:   checkers.CRITICAL,
+			msg:      "class 1 (chunk 96 bytes) evicted 6 items, the last one accessed 5 seconds ago (oldest item 3600 seconds), class 5 (chunk 240 bytes) evicted 4 items, the last one accessed 100 seconds ago (oldest item 7200 seconds)",
+		},
+		{
+			name:     "specific class",
+			classes:  []int{5},
+			warning:  u(300),
+			critical: u(10),
+			status:   checkers.WARNING,
+			msg:      "class 5 (chunk 240 bytes) evicted 4 items, the last one accessed 100 seconds ago (oldest item 7200 seconds)",
+		},
+		{
+			name:     "class without new evictions",
+			classes:  []int{7, 9},
+			critical: u(10),
+			status:   checkers.OK,
+			msg:      "no recently accessed items were evicted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckr := evaluateEvictions(stats, last, tt.classes, tt.warning, tt.critical)
+			if ckr.Status != tt.status {
+				t.Errorf("status = %s, want %s", ckr.Status, tt.status)
+			}
+			if ckr.Message != tt.msg {
+				t.Errorf("message = %q, want %q", ckr.Message, tt.msg)
+			}
+		})
+	}
+}
+
+func TestEvaluateEvictionsRestarted(t *testing.T) {
+	c := uint64(10)
+	stats := map[int]*slabStat{
+		1: {ChunkSize: 96, Evicted: 2, EvictedTime: 5},
+	}
+	last := &evictionsState{Evicted: map[int]uint64{1: 100}}
+	ckr := evaluateEvictions(stats, last, nil, nil, &c)
+	if ckr.Status != checkers.CRITICAL {
+		t.Errorf("status = %s, want CRITICAL: %s", ckr.Status, ckr.Message)
+	}
+}
@@ -0,0 +1,344 @@
+package checkmemory
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type memoryOpts struct {
+	Warning  float64 `short:"w" long:"warning" value-name:"PERCENT" default:"90" description:"warning if the memory usage is over"`
+	Critical float64 `short:"c" long:"critical" value-name:"PERCENT" default:"95" description:"critical if the memory usage is over"`
+	Cgroup   string  `long:"cgroup" value-name:"PATH" description:"Check the memory usage of the cgroup against its limit, such as /sys/fs/cgroup/system.slice/app.service"`
+	Perfdata bool    `long:"perfdata" description:"Append the usage and the used bytes as performance data"`
+
+	WarningHugePages  *float64 `long:"warning-hugepages" value-name:"PERCENT" description:"warning if the usage of HugePages is over"`
+	CriticalHugePages *float64 `long:"critical-hugepages" value-name:"PERCENT" description:"critical if the usage of HugePages is over"`
+	WarningSlab       *float64 `long:"warning-sunreclaim-growth" value-name:"MIB_PER_HOUR" description:"warning if the unreclaimable slab (SUnreclaim) has grown faster than this since the last check"`
+	CriticalSlab      *float64 `long:"critical-sunreclaim-growth" value-name:"MIB_PER_HOUR" description:"critical if the unreclaimable slab (SUnreclaim) has grown faster than this since the last check"`
+	StateDir          string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	selftest.SelfTestOpts
+}
+
+// procMeminfo and cgroupRoot are replaced in tests.
+var (
+	procMeminfo = "/proc/meminfo"
+	cgroupRoot  = "/sys/fs/cgroup"
+)
+
+// usage is the used memory and the limit of it in bytes.
+type usage struct {
+	Name  string
+	Used  int64
+	Limit int64
+	// NoLimit is true if the cgroup has no limit, whose limit is the total memory of the host instead.
+	NoLimit bool
+}
+
+// kernelMemory is the memory of the kernel checked in addition to the usage.
+type kernelMemory struct {
+	HugePagesTotal int64
+	HugePagesUsed  int64 // including the reserved pages which are not faulted yet
+	// SlabGrowth is the growth of SUnreclaim in bytes per hour since the last check, or nil at the first check.
+	SlabGrowth *float64
+	SUnreclaim int64
+}
+
+// slabState is SUnreclaim at the last check.
+type slabState struct {
+	SUnreclaim int64 `json:"sunreclaim"`
+	Time       int64 `json:"time"`
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Memory"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := memoryOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	dir := opts.cgroupDir()
+	if opts.SelfTest {
+		checks := []selftest.Check{selftest.Readable(procMeminfo)}
+		if dir != "" {
+			checks = append(checks, selftest.Exists(dir))
+		}
+		return selftest.Run(checks...)
+	}
+
+	info, err := readMeminfo()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	u, err := hostUsage(info)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if dir != "" {
+		u, err = cgroupUsage(dir, u.Limit)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	k, err := opts.kernelMemory(info, time.Now())
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(u, k)
+}
+
+// kernelMemory returns HugePages and the growth of SUnreclaim, keeping SUnreclaim in the state file
+// only if its thresholds are specified.
+func (opts *memoryOpts) kernelMemory(info map[string]int64, now time.Time) (*kernelMemory, error) {
+	k := &kernelMemory{
+		HugePagesTotal: info["HugePages_Total"],
+		HugePagesUsed:  info["HugePages_Total"] - info["HugePages_Free"] + info["HugePages_Rsvd"],
+		SUnreclaim:     info["SUnreclaim"],
+	}
+	if opts.WarningSlab == nil && opts.CriticalSlab == nil {
+		return k, nil
+	}
+	if _, ok := info["SUnreclaim"]; !ok {
+		return nil, fmt.Errorf("no SUnreclaim in %s", procMeminfo)
+	}
+	stateFile := state.File(state.Dir(opts.StateDir, "check-memory"), "sunreclaim")
+	var last slabState
+	ok, err := state.Load(stateFile, &last)
+	if err != nil {
+		return nil, err
+	}
+	if err := state.Save(stateFile, &slabState{SUnreclaim: k.SUnreclaim, Time: now.Unix()}); err != nil {
+		return nil, err
+	}
+	// SUnreclaim is usually less than at the last check after a reboot, which is a negative growth.
+	if elapsed := now.Sub(time.Unix(last.Time, 0)).Hours(); ok && elapsed > 0 {
+		growth := float64(k.SUnreclaim-last.SUnreclaim) / elapsed
+		k.SlabGrowth = &growth
+	}
+	return k, nil
+}
+
+// cgroupDir returns the directory of --cgroup, which may be relative to the root of cgroupfs.
+func (opts *memoryOpts) cgroupDir() string {
+	if opts.Cgroup == "" || filepath.IsAbs(opts.Cgroup) {
+		return opts.Cgroup
+	}
+	return filepath.Join(cgroupRoot, opts.Cgroup)
+}
+
+// readMeminfo returns the values of /proc/meminfo in bytes, or in pages for the fields of HugePages.
+func readMeminfo() (map[string]int64, error) {
+	f, err := os.Open(procMeminfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := make(map[string]int64)
+	scr := bufio.NewScanner(f)
+	for scr.Scan() {
+		fields := strings.Fields(scr.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", procMeminfo, err)
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			v *= 1024
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	return info, scr.Err()
+}
+
+// hostUsage returns the memory used by the host excluding the memory available without swapping.
+// MemAvailable is estimated from the free memory and the caches on the kernels before 3.14.
+func hostUsage(info map[string]int64) (*usage, error) {
+	total, ok := info["MemTotal"]
+	if !ok || total <= 0 {
+		return nil, fmt.Errorf("no MemTotal in %s", procMeminfo)
+	}
+	available, ok := info["MemAvailable"]
+	if !ok {
+		available = info["MemFree"] + info["Buffers"] + info["Cached"]
+	}
+	return &usage{Name: "memory", Used: total - available, Limit: total}, nil
+}
+
+// cgroupUsage returns the working set of the cgroup, which is the usage excluding the inactive page cache
+// as the kubelet counts, against the limit of the cgroup v2 or v1.
+func cgroupUsage(dir string, hostTotal int64) (*usage, error) {
+	currentFile, maxFile, inactiveKey := "memory.current", "memory.max", "inactive_file"
+	if _, err := os.Stat(filepath.Join(dir, currentFile)); os.IsNotExist(err) {
+		currentFile, maxFile, inactiveKey = "memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"
+		if _, err := os.Stat(filepath.Join(dir, currentFile)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is not a cgroup with the memory controller", dir)
+		}
+	}
+	current, err := readCgroupValue(filepath.Join(dir, currentFile))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := readCgroupValue(filepath.Join(dir, maxFile))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := readCgroupStat(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &usage{Name: filepath.Base(dir), Used: current, Limit: limit}
+	if inactive := stat[inactiveKey]; inactive < u.Used {
+		u.Used -= inactive
+	}
+	// the limit is "max" on v2, or nearly the max of int64 on v1, if it's not set
+	if limit < 0 || limit >= hostTotal {
+		u.Limit = hostTotal
+		u.NoLimit = true
+	}
+	return u, nil
+}
+
+// readCgroupValue reads the number in the file, which is -1 for "max".
+func readCgroupValue(file string) (int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s", file, err)
+	}
+	return n, nil
+}
+
+func readCgroupStat(file string) (map[string]int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	stat := make(map[string]int64)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", file, err)
+		}
+		stat[fields[0]] = n
+	}
+	return stat, nil
+}
+
+var sizeUnits = []struct {
+	size   int64
+	suffix string
+}{
+	{1 << 40, "TiB"},
+	{1 << 30, "GiB"},
+	{1 << 20, "MiB"},
+	{1 << 10, "KiB"},
+}
+
+func formatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n >= u.size {
+			return strconv.FormatFloat(float64(n)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+func (opts *memoryOpts) evaluate(u *usage, k *kernelMemory) *checkers.Checker {
+	pct := float64(u.Used) / float64(u.Limit) * 100
+	checkSt := checkers.OK
+	var msg string
+	if u.NoLimit {
+		msg = fmt.Sprintf("%s uses %.1f%% of the host memory as it has no limit (%s/%s)", u.Name, pct, formatSize(u.Used), formatSize(u.Limit))
+	} else {
+		msg = fmt.Sprintf("%s usage %.1f%% (%s/%s)", u.Name, pct, formatSize(u.Used), formatSize(u.Limit))
+	}
+	switch {
+	case pct > opts.Critical:
+		checkSt = checkers.CRITICAL
+		msg += fmt.Sprintf(" > %g%%", opts.Critical)
+	case pct > opts.Warning:
+		checkSt = checkers.WARNING
+		msg += fmt.Sprintf(" > %g%%", opts.Warning)
+	}
+	perfs := []string{
+		perfdata.FormatMinMax("usage", fmt.Sprintf("%.1f", pct), "%", perfdata.OptFloat(&opts.Warning), perfdata.OptFloat(&opts.Critical), "0", "100"),
+		perfdata.FormatMinMax("used", strconv.FormatInt(u.Used, 10), "B", "", "", "0", strconv.FormatInt(u.Limit, 10)),
+	}
+
+	if (opts.WarningHugePages != nil || opts.CriticalHugePages != nil) && k.HugePagesTotal > 0 {
+		hpct := float64(k.HugePagesUsed) / float64(k.HugePagesTotal) * 100
+		msg += fmt.Sprintf(", HugePages usage %.1f%% (%d/%d pages)", hpct, k.HugePagesUsed, k.HugePagesTotal)
+		switch {
+		case opts.CriticalHugePages != nil && hpct > *opts.CriticalHugePages:
+			checkSt = checkers.CRITICAL
+			msg += fmt.Sprintf(" > %g%%", *opts.CriticalHugePages)
+		case opts.WarningHugePages != nil && hpct > *opts.WarningHugePages:
+			if checkSt < checkers.WARNING {
+				checkSt = checkers.WARNING
+			}
+			msg += fmt.Sprintf(" > %g%%", *opts.WarningHugePages)
+		}
+		perfs = append(perfs, perfdata.FormatMinMax("hugepages", fmt.Sprintf("%.1f", hpct), "%", perfdata.OptFloat(opts.WarningHugePages), perfdata.OptFloat(opts.CriticalHugePages), "0", "100"))
+	}
+
+	if opts.WarningSlab != nil || opts.CriticalSlab != nil {
+		if k.SlabGrowth == nil {
+			msg += fmt.Sprintf(", SUnreclaim %s (no previous check to compare with)", formatSize(k.SUnreclaim))
+		} else {
+			mib := *k.SlabGrowth / (1 << 20)
+			msg += fmt.Sprintf(", SUnreclaim %s (%+.1fMiB/hour)", formatSize(k.SUnreclaim), mib)
+			switch {
+			case opts.CriticalSlab != nil && mib > *opts.CriticalSlab:
+				checkSt = checkers.CRITICAL
+				msg += fmt.Sprintf(" > %gMiB/hour", *opts.CriticalSlab)
+			case opts.WarningSlab != nil && mib > *opts.WarningSlab:
+				if checkSt < checkers.WARNING {
+					checkSt = checkers.WARNING
+				}
+				msg += fmt.Sprintf(" > %gMiB/hour", *opts.WarningSlab)
+			}
+		}
+		perfs = append(perfs, perfdata.FormatMinMax("sunreclaim", strconv.FormatInt(k.SUnreclaim, 10), "B", "", "", "0", ""))
+	}
+
+	if opts.Perfdata {
+		msg += " | " + strings.Join(perfs, " ")
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
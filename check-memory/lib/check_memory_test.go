@@ -0,0 +1,215 @@
+package checkmemory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+const meminfo = `MemTotal:       16310880 kB
+MemFree:         1205376 kB
+MemAvailable:    9787448 kB
+Buffers:          412300 kB
+Cached:          7821520 kB
+SwapCached:            0 kB
+Slab:             901232 kB
+SReclaimable:     689580 kB
+SUnreclaim:       211652 kB
+HugePages_Total:       0
+HugePages_Free:        0
+Hugepagesize:       2048 kB
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHostUsage(t *testing.T) {
+	dir := t.TempDir()
+	procMeminfo = filepath.Join(dir, "meminfo")
+	writeFiles(t, dir, map[string]string{"meminfo": meminfo})
+
+	info, err := readMeminfo()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(211652*1024), info["SUnreclaim"])
+	assert.Equal(t, int64(0), info["HugePages_Total"])
+
+	u, err := hostUsage(info)
+	assert.Nil(t, err)
+	assert.Equal(t, &usage{Name: "memory", Used: (16310880 - 9787448) * 1024, Limit: 16310880 * 1024}, u)
+
+	// kernels before 3.14
+	delete(info, "MemAvailable")
+	u, err = hostUsage(info)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(16310880-1205376-412300-7821520)*1024, u.Used)
+}
+
+func TestCgroupUsage(t *testing.T) {
+	const hostTotal = 16 << 30
+	v2 := filepath.Join(t.TempDir(), "app.service")
+	os.Mkdir(v2, 0755)
+	writeFiles(t, v2, map[string]string{
+		"memory.current": "1932735283\n",
+		"memory.max":     "2147483648\n",
+		"memory.stat":    "anon 1288490188\nfile 644245095\nactive_file 214748365\ninactive_file 429496730\n",
+	})
+	u, err := cgroupUsage(v2, hostTotal)
+	assert.Nil(t, err)
+	assert.Equal(t, &usage{Name: "app.service", Used: 1932735283 - 429496730, Limit: 2147483648}, u)
+
+	writeFiles(t, v2, map[string]string{"memory.max": "max\n"})
+	u, err = cgroupUsage(v2, hostTotal)
+	assert.Nil(t, err)
+	assert.Equal(t, &usage{Name: "app.service", Used: 1932735283 - 429496730, Limit: hostTotal, NoLimit: true}, u)
+
+	v1 := filepath.Join(t.TempDir(), "docker")
+	os.Mkdir(v1, 0755)
+	writeFiles(t, v1, map[string]string{
+		"memory.usage_in_bytes": "1073741824\n",
+		"memory.limit_in_bytes": "9223372036854771712\n",
+		"memory.stat":           "cache 536870912\nrss 536870912\ntotal_inactive_file 268435456\n",
+	})
+	u, err = cgroupUsage(v1, hostTotal)
+	assert.Nil(t, err)
+	assert.Equal(t, &usage{Name: "docker", Used: 805306368, Limit: hostTotal, NoLimit: true}, u)
+
+	dir := t.TempDir()
+	_, err = cgroupUsage(dir, hostTotal)
+	assert.EqualError(t, err, dir+" is not a cgroup with the memory controller")
+}
+
+func TestCgroupDir(t *testing.T) {
+	assert.Equal(t, "", (&memoryOpts{}).cgroupDir())
+	assert.Equal(t, "/sys/fs/cgroup/system.slice/app.service", (&memoryOpts{Cgroup: "/sys/fs/cgroup/system.slice/app.service"}).cgroupDir())
+	assert.Equal(t, "/sys/fs/cgroup/system.slice/app.service", (&memoryOpts{Cgroup: "system.slice/app.service"}).cgroupDir())
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		opts memoryOpts
+		u    usage
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95},
+			u:    usage{Name: "memory", Used: 6 << 30, Limit: 16 << 30},
+			want: checkers.OK,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB)",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95},
+			u:    usage{Name: "app.service", Used: 1900 << 20, Limit: 2 << 30},
+			want: checkers.WARNING,
+			msg:  "app.service usage 92.8% (1.9GiB/2.0GiB) > 90%",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, Perfdata: true},
+			u:    usage{Name: "app.service", Used: 1000 << 20, Limit: 1 << 30},
+			want: checkers.CRITICAL,
+			msg:  "app.service usage 97.7% (1000.0MiB/1.0GiB) > 95% | usage=97.7%;90;95;0;100 used=1048576000B;;;0;1073741824",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95},
+			u:    usage{Name: "app.service", Used: 2 << 30, Limit: 16 << 30, NoLimit: true},
+			want: checkers.OK,
+			msg:  "app.service uses 12.5% of the host memory as it has no limit (2.0GiB/16.0GiB)",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(&tt.u, &kernelMemory{})
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestKernelMemory(t *testing.T) {
+	w := 10.0
+	opts := memoryOpts{WarningSlab: &w, StateDir: t.TempDir()}
+	info := map[string]int64{"HugePages_Total": 1000, "HugePages_Free": 300, "HugePages_Rsvd": 100, "SUnreclaim": 200 << 20}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	k, err := opts.kernelMemory(info, now)
+	assert.Nil(t, err)
+	assert.Equal(t, &kernelMemory{HugePagesTotal: 1000, HugePagesUsed: 800, SUnreclaim: 200 << 20}, k)
+
+	info["SUnreclaim"] = 230 << 20
+	k, err = opts.kernelMemory(info, now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	if assert.NotNil(t, k.SlabGrowth) {
+		assert.Equal(t, float64(15<<20), *k.SlabGrowth)
+	}
+
+	delete(info, "SUnreclaim")
+	_, err = opts.kernelMemory(info, now.Add(3*time.Hour))
+	assert.EqualError(t, err, "no SUnreclaim in "+procMeminfo)
+}
+
+func TestEvaluateKernelMemory(t *testing.T) {
+	w, c := 80.0, 90.0
+	ws, cs := 10.0, 50.0
+	growth := func(mib float64) *float64 {
+		v := mib * (1 << 20)
+		return &v
+	}
+	u := usage{Name: "memory", Used: 6 << 30, Limit: 16 << 30}
+	tests := []struct {
+		opts memoryOpts
+		k    kernelMemory
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningHugePages: &w, CriticalHugePages: &c},
+			k:    kernelMemory{HugePagesTotal: 1000, HugePagesUsed: 850},
+			want: checkers.WARNING,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB), HugePages usage 85.0% (850/1000 pages) > 80%",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningHugePages: &w, CriticalHugePages: &c, Perfdata: true},
+			k:    kernelMemory{HugePagesTotal: 1000, HugePagesUsed: 950},
+			want: checkers.CRITICAL,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB), HugePages usage 95.0% (950/1000 pages) > 90% | usage=37.5%;90;95;0;100 used=6442450944B;;;0;17179869184 hugepages=95.0%;80;90;0;100",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningHugePages: &w},
+			k:    kernelMemory{},
+			want: checkers.OK,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB)",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningSlab: &ws, CriticalSlab: &cs},
+			k:    kernelMemory{SUnreclaim: 200 << 20},
+			want: checkers.OK,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB), SUnreclaim 200.0MiB (no previous check to compare with)",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningSlab: &ws, CriticalSlab: &cs},
+			k:    kernelMemory{SUnreclaim: 200 << 20, SlabGrowth: growth(-20)},
+			want: checkers.OK,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB), SUnreclaim 200.0MiB (-20.0MiB/hour)",
+		},
+		{
+			opts: memoryOpts{Warning: 90, Critical: 95, WarningSlab: &ws, CriticalSlab: &cs, Perfdata: true},
+			k:    kernelMemory{SUnreclaim: 2 << 30, SlabGrowth: growth(64)},
+			want: checkers.CRITICAL,
+			msg:  "memory usage 37.5% (6.0GiB/16.0GiB), SUnreclaim 2.0GiB (+64.0MiB/hour) > 50MiB/hour | usage=37.5%;90;95;0;100 used=6442450944B;;;0;17179869184 sunreclaim=2147483648B;;;0",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(&u, &tt.k)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
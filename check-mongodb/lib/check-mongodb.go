@@ -0,0 +1,214 @@
+package checkmongodb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongodbSetting struct {
+	URI          string `long:"uri" default:"mongodb://localhost:27017" description:"Connection string. mongodb+srv:// is also supported"`
+	User         string `short:"u" long:"user" description:"Username"`
+	Password     string `short:"P" long:"password" description:"Password" env:"MONGODB_PASSWORD"`
+	AuthDatabase string `long:"auth-database" description:"Database to authenticate against"`
+	AuthMech     string `long:"auth-mechanism" description:"Authentication mechanism such as SCRAM-SHA-256"`
+	TLS          bool   `long:"tls" description:"Enables TLS connection"`
+	TLSCAFile    string `long:"tls-ca-file" description:"The root certificate used for TLS certificate verification"`
+	TLSCertFile  string `long:"tls-cert-file" description:"A PEM file of the client certificate and key"`
+	TLSInsecure  bool   `long:"tls-skip-verify" description:"Disable TLS certificate verification"`
+	Timeout      int    `short:"t" long:"timeout" default:"10" description:"Seconds before the query times out"`
+
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"ping":        checkPing,
+	"replset":     checkReplSet,
+	"connections": checkConnections,
+	"oplog":       checkOplog,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-mongodb [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "MongoDB"
+		return ckr
+	}
+	ckr := fn(argv)
+	ckr.Name = fmt.Sprintf("MongoDB %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
+	return ckr
+}
+
+// hosts returns the hosts in the URI without the credentials, and whether they are SRV records.
+func (s mongodbSetting) hosts() ([]string, bool) {
+	srv := strings.HasPrefix(s.URI, "mongodb+srv://")
+	hosts := strings.TrimPrefix(strings.TrimPrefix(s.URI, "mongodb+srv://"), "mongodb://")
+	if i := strings.IndexAny(hosts, "/?"); i >= 0 {
+		hosts = hosts[:i]
+	}
+	if i := strings.LastIndex(hosts, "@"); i >= 0 {
+		hosts = hosts[i+1:]
+	}
+	return strings.Split(hosts, ","), srv
+}
+
+// selfTest validates that the hosts in the URI can be resolved.
+func (s mongodbSetting) selfTest() *checkers.Checker {
+	var checks []selftest.Check
+	for _, f := range []string{s.TLSCAFile, s.TLSCertFile} {
+		if f != "" {
+			checks = append(checks, selftest.Readable(f))
+		}
+	}
+	hosts, srv := s.hosts()
+	for _, host := range hosts {
+		if srv {
+			host := host
+			checks = append(checks, func() error {
+				_, _, err := net.LookupSRV("mongodb", "tcp", host)
+				return err
+			})
+			continue
+		}
+		checks = append(checks, selftest.Resolve(host))
+	}
+	return selftest.Run(checks...)
+}
+
+// uri returns the URI with the TLS options as its parameters.
+func (s mongodbSetting) uri() string {
+	q := url.Values{}
+	if s.TLS {
+		q.Set("tls", "true")
+	}
+	if s.TLSCAFile != "" {
+		q.Set("tlsCAFile", s.TLSCAFile)
+	}
+	if s.TLSCertFile != "" {
+		q.Set("tlsCertificateKeyFile", s.TLSCertFile)
+	}
+	if s.TLSInsecure {
+		q.Set("tlsAllowInvalidCertificates", "true")
+	}
+	if len(q) == 0 {
+		return s.URI
+	}
+	// the hosts of the URI can't be parsed by net/url, such as "db1,db2:27018"
+	rest := s.URI
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	sep := "/?"
+	if strings.Contains(rest, "?") {
+		sep = "&"
+	} else if strings.Contains(rest, "/") {
+		sep = "?"
+	}
+	return s.URI + sep + q.Encode()
+}
+
+// authDatabase returns the database to authenticate against, which defaults to the database of the URI.
+// It's empty if neither is specified, and the driver authenticates against admin, or $external for MONGODB-X509.
+func (s mongodbSetting) authDatabase() string {
+	if s.AuthDatabase != "" {
+		return s.AuthDatabase
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s.URI, "mongodb+srv://"), "mongodb://")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		db := rest[i+1:]
+		if j := strings.Index(db, "?"); j >= 0 {
+			db = db[:j]
+		}
+		return db
+	}
+	return ""
+}
+
+// clientOptions returns the options of the client, with the credential when --user is given.
+func (s mongodbSetting) clientOptions() (*options.ClientOptions, error) {
+	timeout := time.Duration(s.Timeout) * time.Second
+	opts := options.Client().
+		ApplyURI(s.uri()).
+		SetAppName("check-mongodb").
+		SetConnectTimeout(timeout).
+		SetServerSelectionTimeout(timeout)
+	if s.User != "" {
+		password, err := s.ResolvePassword(s.Password)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetAuth(options.Credential{
+			AuthMechanism: s.AuthMech,
+			AuthSource:    s.authDatabase(),
+			Username:      s.User,
+			Password:      password,
+			PasswordSet:   password != "",
+		})
+	}
+	return opts, opts.Validate()
+}
+
+// withClient connects to the server and calls fn with the client, which is disconnected after fn returns.
+// ctx of fn is canceled when --timeout expires.
+func (s mongodbSetting) withClient(fn func(ctx context.Context, client *mongo.Client) error) error {
+	s.DebugOpts.Enable()
+	opts, err := s.clientOptions()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.Timeout)*time.Second)
+	defer cancel()
+	hosts, _ := s.hosts()
+	end := debuglog.Trace("connect: %s", strings.Join(hosts, ","))
+	client, err := mongo.Connect(ctx, opts)
+	end(err)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	return fn(ctx, client)
+}
+
+// runCommand runs the command against the database and decodes the result into v.
+func runCommand(ctx context.Context, db *mongo.Database, cmd bson.D, v interface{}) error {
+	end := debuglog.Trace("command: %s on %s", cmd[0].Key, db.Name())
+	err := db.RunCommand(ctx, cmd).Decode(v)
+	end(err)
+	return err
+}
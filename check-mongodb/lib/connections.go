@@ -0,0 +1,64 @@
+package checkmongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type connectionsOpts struct {
+	mongodbSetting
+	Warning  float64 `short:"w" long:"warning" default:"80" description:"warning if the percentage of used connections is over"`
+	Critical float64 `short:"c" long:"critical" default:"90" description:"critical if the percentage of used connections is over"`
+}
+
+// connectionsStatus is the connections document of serverStatus.
+type connectionsStatus struct {
+	Current   int64 `bson:"current"`
+	Available int64 `bson:"available"`
+}
+
+func checkConnections(args []string) *checkers.Checker {
+	opts := connectionsOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "connections [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	var st struct {
+		Connections connectionsStatus `bson:"connections"`
+	}
+	err = opts.withClient(func(ctx context.Context, client *mongo.Client) error {
+		return runCommand(ctx, client.Database("admin"), bson.D{{Key: "serverStatus", Value: 1}}, &st)
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st.Connections)
+}
+
+func (opts *connectionsOpts) evaluate(st connectionsStatus) *checkers.Checker {
+	total := st.Current + st.Available
+	if total == 0 {
+		return checkers.Unknown("couldn't get the number of connections")
+	}
+	usage := float64(st.Current) / float64(total) * 100
+
+	checkSt := checkers.OK
+	if usage > opts.Critical {
+		checkSt = checkers.CRITICAL
+	} else if usage > opts.Warning {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("%d of %d connections used (%.1f%%)", st.Current, total, usage))
+}
@@ -0,0 +1,130 @@
+package checkmongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type oplogOpts struct {
+	mongodbSetting
+	Warning  float64 `short:"w" long:"warning" default:"24" description:"warning if the oplog window is less than (hours)"`
+	Critical float64 `short:"c" long:"critical" default:"12" description:"critical if the oplog window is less than (hours)"`
+}
+
+type oplogStatus struct {
+	Primary bool
+	First   int64 // seconds since the epoch
+	Last    int64
+	Size    int64
+	MaxSize int64
+}
+
+func checkOplog(args []string) *checkers.Checker {
+	opts := oplogOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "oplog [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	var st oplogStatus
+	err = opts.withClient(func(ctx context.Context, client *mongo.Client) error {
+		var err error
+		st, err = getOplogStatus(ctx, client)
+		return err
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st)
+}
+
+// namespaceNotFound is the error code of collStats for the collection which doesn't exist.
+const namespaceNotFound = 26
+
+// getOplogStatus returns the role of the server, the timestamps of the first and the last entry
+// and the size of the oplog. The timestamps are 0 if the oplog is empty or not found.
+func getOplogStatus(ctx context.Context, client *mongo.Client) (oplogStatus, error) {
+	var st oplogStatus
+	var master struct {
+		IsMaster bool `bson:"ismaster"`
+	}
+	if err := runCommand(ctx, client.Database("admin"), bson.D{{Key: "isMaster", Value: 1}}, &master); err != nil {
+		return st, err
+	}
+	st.Primary = master.IsMaster
+
+	local := client.Database("local")
+	var stats struct {
+		Size    int64 `bson:"size"`
+		MaxSize int64 `bson:"maxSize"`
+	}
+	if err := runCommand(ctx, local, bson.D{{Key: "collStats", Value: "oplog.rs"}}, &stats); err != nil {
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == namespaceNotFound {
+			return st, nil
+		}
+		return st, err
+	}
+	st.Size, st.MaxSize = stats.Size, stats.MaxSize
+
+	oplog := local.Collection("oplog.rs")
+	ts := func(order int) (int64, error) {
+		var entry struct {
+			TS primitive.Timestamp `bson:"ts"`
+		}
+		opts := options.FindOne().SetSort(bson.D{{Key: "$natural", Value: order}}).SetProjection(bson.D{{Key: "ts", Value: 1}})
+		end := debuglog.Trace("find: local.oplog.rs sorted by $natural %d", order)
+		err := oplog.FindOne(ctx, bson.D{}, opts).Decode(&entry)
+		end(err)
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return int64(entry.TS.T), err
+	}
+	var err error
+	if st.First, err = ts(1); err != nil {
+		return st, err
+	}
+	if st.Last, err = ts(-1); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// evaluate checks the time window between the first and the last entry of the oplog.
+// If the oplog has not been filled up yet, the window is still growing and is not alerted.
+func (opts *oplogOpts) evaluate(st oplogStatus) *checkers.Checker {
+	if st.First == 0 || st.Last == 0 {
+		return checkers.Unknown("the oplog is empty or not found; is the server a member of a replica set?")
+	}
+	window := float64(st.Last-st.First) / 3600
+	role := "secondary"
+	if st.Primary {
+		role = "primary"
+	}
+	msg := fmt.Sprintf("oplog window of the %s is %.1f hours", role, window)
+	if st.MaxSize > 0 && st.Size < st.MaxSize*9/10 {
+		return checkers.Ok(fmt.Sprintf("%s, the oplog is not full yet (%d of %d MB)", msg, st.Size>>20, st.MaxSize>>20))
+	}
+
+	checkSt := checkers.OK
+	if window < opts.Critical {
+		checkSt = checkers.CRITICAL
+	} else if window < opts.Warning {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
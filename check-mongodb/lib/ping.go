@@ -0,0 +1,54 @@
+package checkmongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type pingOpts struct {
+	mongodbSetting
+	Warning  float64 `short:"w" long:"warning" description:"warning if the ping latency is over (ms)"`
+	Critical float64 `short:"c" long:"critical" description:"critical if the ping latency is over (ms)"`
+}
+
+func checkPing(args []string) *checkers.Checker {
+	opts := pingOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "ping [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	// The latency includes the connection and the authentication.
+	var elapsed float64
+	start := time.Now()
+	err = opts.withClient(func(ctx context.Context, client *mongo.Client) error {
+		end := debuglog.Trace("ping")
+		err := client.Ping(ctx, nil)
+		end(err)
+		elapsed = float64(time.Since(start)) / float64(time.Millisecond)
+		return err
+	})
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+
+	checkSt := checkers.OK
+	if opts.Critical > 0 && elapsed > opts.Critical {
+		checkSt = checkers.CRITICAL
+	} else if opts.Warning > 0 && elapsed > opts.Warning {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("%.0f ms response time", elapsed))
+}
@@ -0,0 +1,104 @@
+package checkmongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type replSetOpts struct {
+	mongodbSetting
+	Warning  int64 `short:"w" long:"warning" default:"30" description:"warning if the replication lag of a secondary is over (seconds)"`
+	Critical int64 `short:"c" long:"critical" default:"60" description:"critical if the replication lag of a secondary is over (seconds)"`
+}
+
+// replSetStatus is the result of replSetGetStatus.
+type replSetStatus struct {
+	Set     string          `bson:"set"`
+	Members []replSetMember `bson:"members"`
+}
+
+type replSetMember struct {
+	Name   string    `bson:"name"`
+	State  string    `bson:"stateStr"`
+	Health float64   `bson:"health"`
+	Optime time.Time `bson:"optimeDate"`
+}
+
+func checkReplSet(args []string) *checkers.Checker {
+	opts := replSetOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "replset [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	var st replSetStatus
+	err = opts.withClient(func(ctx context.Context, client *mongo.Client) error {
+		return runCommand(ctx, client.Database("admin"), bson.D{{Key: "replSetGetStatus", Value: 1}}, &st)
+	})
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("replSetGetStatus failed: %s", err))
+	}
+	return opts.evaluate(&st)
+}
+
+func (opts *replSetOpts) evaluate(st *replSetStatus) *checkers.Checker {
+	var primary *replSetMember
+	for i, m := range st.Members {
+		if m.State == "PRIMARY" {
+			primary = &st.Members[i]
+		}
+	}
+	if primary == nil {
+		return checkers.Critical(fmt.Sprintf("replica set %s has no primary", st.Set))
+	}
+
+	checkSt := checkers.OK
+	var msgs []string
+	var maxLag int64
+	for _, m := range st.Members {
+		if m.Health != 1 {
+			checkSt = checkers.CRITICAL
+			msgs = append(msgs, fmt.Sprintf("%s is unhealthy (%s)", m.Name, m.State))
+			continue
+		}
+		switch m.State {
+		case "PRIMARY", "ARBITER":
+			continue
+		case "SECONDARY":
+		default:
+			checkSt = checkers.CRITICAL
+			msgs = append(msgs, fmt.Sprintf("%s is %s", m.Name, m.State))
+			continue
+		}
+		lag := int64(primary.Optime.Sub(m.Optime) / time.Second)
+		if lag > maxLag {
+			maxLag = lag
+		}
+		if lag > opts.Critical {
+			checkSt = checkers.CRITICAL
+			msgs = append(msgs, fmt.Sprintf("%s is %d seconds behind the primary", m.Name, lag))
+		} else if lag > opts.Warning {
+			if checkSt == checkers.OK {
+				checkSt = checkers.WARNING
+			}
+			msgs = append(msgs, fmt.Sprintf("%s is %d seconds behind the primary", m.Name, lag))
+		}
+	}
+	if len(msgs) > 0 {
+		return checkers.NewChecker(checkSt, fmt.Sprintf("replica set %s: %s", st.Set, strings.Join(msgs, ", ")))
+	}
+	return checkers.Ok(fmt.Sprintf("replica set %s: primary is %s, max replication lag %d seconds", st.Set, primary.Name, maxLag))
+}
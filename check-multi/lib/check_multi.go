@@ -0,0 +1,200 @@
+package checkmulti
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"gopkg.in/yaml.v2"
+)
+
+type multiOpts struct {
+	Config  string `short:"c" long:"config" value-name:"FILE" required:"true" description:"YAML file of the checks to run"`
+	Timeout int    `short:"t" long:"timeout" default:"30" description:"Seconds before all the checks time out"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+type config struct {
+	Checks []subCheck `yaml:"checks"`
+}
+
+// subCheck is a check in the config, which runs the plugin with the args.
+type subCheck struct {
+	Name   string   `yaml:"name"`
+	Plugin string   `yaml:"plugin"`
+	Args   []string `yaml:"args"`
+}
+
+type subResult struct {
+	status checkers.Status
+	output string
+}
+
+// secretFlags are the options of the plugins whose values are masked in debug logs.
+var secretFlags = []string{"-P", "--password", "--authpassword", "--passphrase", "--secret-access-key", "--community", "--auth-password", "--priv-password"}
+
+// runners run the plugins in-process. They are set by mackerel-check, which has all the plugins.
+var runners map[string]func([]string) *checkers.Checker
+
+// SetRunners sets the functions to run the plugins by their names, such as Run of check-http for "http".
+func SetRunners(r map[string]func([]string) *checkers.Checker) {
+	runners = r
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Multi"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := multiOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+
+	checks, err := loadConfig(opts.Config)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if runners == nil {
+		return checkers.Unknown("the plugins are not available; run check-multi as mackerel-check multi or through the check-multi symbolic link to it")
+	}
+	funcs := make([]func([]string) *checkers.Checker, len(checks))
+	for i, c := range checks {
+		fn, ok := runners[c.Plugin]
+		if !ok {
+			return checkers.Unknown(fmt.Sprintf("%s: unknown plugin %q", opts.Config, c.Plugin))
+		}
+		funcs[i] = fn
+	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	results := make([]subResult, len(checks))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runSubCheck(ctx, checks[i], funcs[i])
+		}(i)
+	}
+	wg.Wait()
+	return evaluate(checks, results)
+}
+
+func loadConfig(file string) ([]subCheck, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var conf config
+	if err := yaml.UnmarshalStrict(b, &conf); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if len(conf.Checks) == 0 {
+		return nil, fmt.Errorf("%s: no checks", file)
+	}
+	names := make(map[string]bool)
+	for i := range conf.Checks {
+		c := &conf.Checks[i]
+		c.Plugin = strings.TrimPrefix(c.Plugin, "check-")
+		if c.Plugin == "" {
+			return nil, fmt.Errorf("%s: plugin of the check #%d is not specified", file, i+1)
+		}
+		if c.Plugin == "multi" {
+			return nil, fmt.Errorf("%s: check-multi can't run itself", file)
+		}
+		if c.Name == "" {
+			c.Name = c.Plugin
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("%s: duplicate check name %q; set name to distinguish them", file, c.Name)
+		}
+		names[c.Name] = true
+	}
+	return conf.Checks, nil
+}
+
+// runSubCheck runs the plugin in a goroutine, and returns UNKNOWN without waiting for it
+// if ctx is done first, because a running plugin can't be stopped.
+func runSubCheck(ctx context.Context, c subCheck, run func([]string) *checkers.Checker) subResult {
+	end := debuglog.Trace("run: %s", debuglog.Command("check-"+c.Plugin, c.Args, secretFlags...))
+	done := make(chan subResult, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				done <- subResult{checkers.UNKNOWN, fmt.Sprintf("panic: %v", err)}
+			}
+		}()
+		ckr := run(c.Args)
+		status := ckr.Status
+		// as mackerel-agent reads other than 0, 1 and 2 from the exit status
+		if status < checkers.OK || status > checkers.UNKNOWN {
+			status = checkers.UNKNOWN
+		}
+		done <- subResult{status, firstLine(ckr.String())}
+	}()
+	select {
+	case r := <-done:
+		end(nil)
+		return r
+	case <-ctx.Done():
+		end(ctx.Err())
+		return subResult{checkers.UNKNOWN, "timed out"}
+	}
+}
+
+// firstLine returns the first line of the output without the performance data,
+// which would be mixed up with those of the other checks.
+func firstLine(out string) string {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(out), "\n", 2)[0])
+	if i := strings.LastIndex(line, " | "); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+	return line
+}
+
+// evaluate returns the worst status of the checks with the numbers of the checks in each status,
+// followed by the result of each check in a line.
+func evaluate(checks []subCheck, results []subResult) *checkers.Checker {
+	checkSt := checkers.OK
+	counts := make(map[checkers.Status]int)
+	lines := make([]string, len(checks))
+	for i, r := range results {
+		if r.status > checkSt {
+			checkSt = r.status
+		}
+		counts[r.status]++
+		lines[i] = fmt.Sprintf("[%s] %s: %s", r.status, checks[i].Name, r.output)
+	}
+
+	var summary []string
+	for _, st := range []checkers.Status{checkers.OK, checkers.WARNING, checkers.CRITICAL, checkers.UNKNOWN} {
+		if counts[st] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[st], st))
+		}
+	}
+	msg := fmt.Sprintf("%s of %d checks\n%s", strings.Join(summary, ", "), len(checks), strings.Join(lines, "\n"))
+	return checkers.NewChecker(checkSt, msg)
+}
@@ -0,0 +1,122 @@
+package checkmulti
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, dir, conf string) string {
+	t.Helper()
+	file := filepath.Join(dir, "checks.yaml")
+	if err := ioutil.WriteFile(file, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	checks, err := loadConfig(writeConfig(t, dir, `
+checks:
+  - plugin: http
+    args: ["-u", "https://example.com"]
+  - name: db1
+    plugin: check-mysql
+    args:
+      - connection
+      - --host=db1
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []subCheck{
+		{Name: "http", Plugin: "http", Args: []string{"-u", "https://example.com"}},
+		{Name: "db1", Plugin: "mysql", Args: []string{"connection", "--host=db1"}},
+	}, checks)
+
+	_, err = loadConfig(writeConfig(t, dir, "checks:\n  - plugin: http\n  - plugin: http\n"))
+	assert.EqualError(t, err, filepath.Join(dir, "checks.yaml")+`: duplicate check name "http"; set name to distinguish them`)
+	_, err = loadConfig(writeConfig(t, dir, "checks:\n  - name: web\n"))
+	assert.EqualError(t, err, filepath.Join(dir, "checks.yaml")+": plugin of the check #1 is not specified")
+	_, err = loadConfig(writeConfig(t, dir, "checks:\n  - plugin: multi\n"))
+	assert.Error(t, err)
+	_, err = loadConfig(writeConfig(t, dir, "checks: []\n"))
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	orig := runners
+	defer func() { runners = orig }()
+	SetRunners(map[string]func([]string) *checkers.Checker{
+		"ok": func(args []string) *checkers.Checker {
+			ckr := checkers.Ok("fine | time=0.1s")
+			ckr.Name = "OK"
+			return ckr
+		},
+		"warn": func(args []string) *checkers.Checker {
+			ckr := checkers.Warning(strings.Join(args, " "))
+			ckr.Name = "Warn"
+			return ckr
+		},
+		"usage": func(args []string) *checkers.Checker {
+			ckr := checkers.Unknown("unknown flag `x'")
+			ckr.Name = "Usage"
+			return ckr
+		},
+		"slow": func(args []string) *checkers.Checker {
+			time.Sleep(5 * time.Second)
+			return checkers.Ok("done")
+		},
+		"panic": func(args []string) *checkers.Checker {
+			panic("broken")
+		},
+	})
+
+	dir := t.TempDir()
+	conf := writeConfig(t, dir, `
+checks:
+  - plugin: ok
+  - plugin: warn
+    args: [slow, disk]
+  - plugin: usage
+`)
+	ckr := run([]string{"--config", conf})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "1 OK, 1 WARNING, 1 UNKNOWN of 3 checks\n"+
+		"[OK] ok: OK OK: fine\n"+
+		"[WARNING] warn: Warn WARNING: slow disk\n"+
+		"[UNKNOWN] usage: Usage UNKNOWN: unknown flag `x'", ckr.Message)
+
+	conf = writeConfig(t, dir, `
+checks:
+  - plugin: ok
+  - plugin: slow
+  - plugin: panic
+`)
+	ckr = run([]string{"--config", conf, "--timeout", "1"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Contains(t, ckr.Message, "1 OK, 2 UNKNOWN of 3 checks\n")
+	assert.Contains(t, ckr.Message, "[UNKNOWN] slow: timed out\n")
+	assert.Contains(t, ckr.Message, "[UNKNOWN] panic: panic: broken")
+
+	ckr = run([]string{"--config", conf, "--self-test"})
+	assert.Equal(t, checkers.OK, ckr.Status)
+
+	conf = writeConfig(t, dir, "checks:\n  - plugin: none\n")
+	ckr = run([]string{"--config", conf, "--self-test"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, conf+`: unknown plugin "none"`, ckr.Message)
+
+	runners = nil
+	ckr = run([]string{"--config", conf})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+}
+
+func TestFirstLine(t *testing.T) {
+	assert.Equal(t, "HTTP OK: 200", firstLine("HTTP OK: 200 | time=0.1s;1;2\nlong output\n"))
+	assert.Equal(t, "", firstLine("\n"))
+}
@@ -10,18 +10,40 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type mysqlSetting struct {
-	Host   string `short:"H" long:"host" default:"localhost" description:"Hostname"`
-	Port   string `short:"p" long:"port" default:"3306" description:"Port"`
-	Socket string `short:"S" long:"socket" default:"" description:"Path to unix socket"`
-	User   string `short:"u" long:"user" default:"root" description:"Username"`
-	Pass   string `short:"P" long:"password" default:"" description:"Password" env:"MYSQL_PASSWORD"`
+	Hosts  []string `short:"H" long:"host" default:"localhost" description:"Hostname"`
+	Port   string   `short:"p" long:"port" default:"3306" description:"Port"`
+	Socket string   `short:"S" long:"socket" default:"" description:"Path to unix socket"`
+	User   string   `short:"u" long:"user" default:"root" description:"Username"`
+	Pass   string   `short:"P" long:"password" default:"" description:"Password" env:"MYSQL_PASSWORD"`
 
 	EnableTLS     bool   `long:"tls" description:"Enables TLS connection"`
 	TLSRootCert   string `long:"tls-root-cert" default:"" description:"The root certificate used for TLS certificate verification"`
 	TLSSkipVerify bool   `long:"tls-skip-verify" description:"Disable TLS certificate verification"`
+
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+
+	// noSocketProbe disables the detection of the unix socket for localhost.
+	noSocketProbe bool
+}
+
+const (
+	defaultPort   = "3306"
+	xProtocolPort = "33060"
+)
+
+// socketCandidates are the paths of the unix socket probed in order
+// when --socket is not specified and the server is localhost:3306.
+var socketCandidates = []string{
+	"/var/run/mysqld/mysqld.sock",
+	"/tmp/mysql.sock",
 }
 
 type mysqlVersion struct {
@@ -35,6 +57,11 @@ var commands = map[string](func([]string) *checkers.Checker){
 	"connection":  checkConnection,
 	"uptime":      checkUptime,
 	"readonly":    checkReadOnly,
+	"topology":    checkTopology,
+	"ssl-expiry":  checkSSLExpiry,
+	"sync":        checkSync,
+	"events":      checkEvents,
+	"datasize":    checkDataSize,
 }
 
 func separateSub(argv []string) (string, []string) {
@@ -46,7 +73,12 @@ func separateSub(argv []string) (string, []string) {
 
 // Do the plugin
 func Do() {
-	subCmd, argv := separateSub(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
 	fn, ok := commands[subCmd]
 	if !ok {
 		fmt.Println(`Usage:
@@ -56,23 +88,61 @@ SubCommands:`)
 		for k := range commands {
 			fmt.Printf("  %s\n", k)
 		}
-		os.Exit(1)
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "MySQL"
+		return ckr
 	}
 	ckr := fn(argv)
 	ckr.Name = fmt.Sprintf("MySQL %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
-	ckr.Exit()
+	return ckr
 }
 
-func newDB(m mysqlSetting) (*sql.DB, error) {
-	proto := "tcp"
-	target := fmt.Sprintf("%s:%s", m.Host, m.Port)
+// host returns the host to connect to. --host may be repeated only by the replication subcommand,
+// and the others connect to the last one.
+func (m mysqlSetting) host() string {
+	if len(m.Hosts) == 0 {
+		return ""
+	}
+	return m.Hosts[len(m.Hosts)-1]
+}
+
+// transport returns the network and the address to connect to.
+func (m mysqlSetting) transport() (string, string) {
 	if m.Socket != "" {
-		proto = "unix"
-		target = m.Socket
+		return "unix", m.Socket
+	}
+	if m.host() == "localhost" && m.Port == defaultPort && !m.noSocketProbe {
+		for _, path := range socketCandidates {
+			if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+				return "unix", path
+			}
+		}
 	}
+	return "tcp", fmt.Sprintf("%s:%s", m.host(), m.Port)
+}
+
+// via returns the description of the transport to show in messages.
+func (m mysqlSetting) via() string {
+	proto, target := m.transport()
+	if proto == "unix" {
+		return fmt.Sprintf("via unix socket %s", target)
+	}
+	return fmt.Sprintf("via TCP %s", target)
+}
+
+func newDB(m mysqlSetting) (*sql.DB, error) {
+	m.DebugOpts.Enable()
+	if m.Socket == "" && m.Port == xProtocolPort {
+		return nil, fmt.Errorf("port %s is the MySQL X Protocol port, use the port of the classic protocol (usually %s)", xProtocolPort, defaultPort)
+	}
+	pass, err := m.ResolvePassword(m.Pass)
+	if err != nil {
+		return nil, err
+	}
+	proto, target := m.transport()
 	cfg := &mysql.Config{
 		User:                 m.User,
-		Passwd:               m.Pass,
+		Passwd:               pass,
 		Net:                  proto,
 		Addr:                 target,
 		AllowNativePasswords: true,
@@ -93,12 +163,33 @@ func newDB(m mysqlSetting) (*sql.DB, error) {
 		cfg.TLSConfig = "custom"
 	}
 
+	debuglog.Printf("mysql: connect to %s(%s) as %s", proto, target, m.User)
 	return sql.Open("mysql", cfg.FormatDSN())
 }
 
+// selfTest validates the connection settings without connecting to the server.
+func (m mysqlSetting) selfTest() *checkers.Checker {
+	checks := []selftest.Check{selftest.Resolve(m.host())}
+	if proto, target := m.transport(); proto == "unix" {
+		checks[0] = selftest.Exists(target)
+	}
+	if m.EnableTLS && m.TLSRootCert != "" {
+		checks = append(checks, selftest.Readable(m.TLSRootCert))
+	}
+	return selftest.Run(checks...)
+}
+
+// queryRow executes the query which returns one row, and scans it into dest.
+func queryRow(db *sql.DB, query string, dest ...interface{}) error {
+	end := debuglog.Trace("sql: %s", query)
+	err := db.QueryRow(query).Scan(dest...)
+	end(err)
+	return err
+}
+
 func getMySQLVersion(db *sql.DB) (*mysqlVersion, error) {
 	var rawVersion string
-	err := db.QueryRow("SELECT VERSION()").Scan(&rawVersion)
+	err := queryRow(db, "SELECT VERSION()", &rawVersion)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to query SELECT VERSION(): %s", err)
 	}
@@ -0,0 +1,54 @@
+package checkmysql
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "mysqld.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix domain socket is not available:", err)
+	}
+	defer l.Close()
+
+	orig := socketCandidates
+	defer func() { socketCandidates = orig }()
+	socketCandidates = []string{filepath.Join(dir, "missing.sock"), sock}
+
+	tests := []struct {
+		setting mysqlSetting
+		proto   string
+		target  string
+	}{
+		{mysqlSetting{Hosts: []string{"localhost"}, Port: "3306"}, "unix", sock},
+		{mysqlSetting{Hosts: []string{"localhost"}, Port: "3306", Socket: "/run/my.sock"}, "unix", "/run/my.sock"},
+		{mysqlSetting{Hosts: []string{"localhost"}, Port: "3307"}, "tcp", "localhost:3307"},
+		{mysqlSetting{Hosts: []string{"127.0.0.1"}, Port: "3306"}, "tcp", "127.0.0.1:3306"},
+		{mysqlSetting{Hosts: []string{"localhost"}, Port: "3306", noSocketProbe: true}, "tcp", "localhost:3306"},
+	}
+	for _, tt := range tests {
+		proto, target := tt.setting.transport()
+		assert.Equal(t, tt.proto, proto)
+		assert.Equal(t, tt.target, target)
+	}
+
+	assert.Equal(t, "via unix socket "+sock, mysqlSetting{Hosts: []string{"localhost"}, Port: "3306"}.via())
+	assert.Equal(t, "via TCP db1:3306", mysqlSetting{Hosts: []string{"db1"}, Port: "3306"}.via())
+}
+
+func TestNewDBXProtocolPort(t *testing.T) {
+	_, err := newDB(mysqlSetting{Hosts: []string{"localhost"}, Port: "33060"})
+	assert.Error(t, err)
+}
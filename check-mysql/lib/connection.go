@@ -2,7 +2,6 @@ package checkmysql
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
@@ -20,7 +19,10 @@ func checkConnection(args []string) *checkers.Checker {
 	psr.Usage = "connection [OPTIONS]"
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
 	}
 	db, err := newDB(opts.mysqlSetting)
 	if err != nil {
@@ -32,7 +34,7 @@ func checkConnection(args []string) *checkers.Checker {
 		variableName     string
 		threadsConnected int64
 	)
-	err = db.QueryRow("SHOW GLOBAL STATUS LIKE 'Threads_Connected'").Scan(&variableName, &threadsConnected)
+	err = queryRow(db, "SHOW GLOBAL STATUS LIKE 'Threads_Connected'", &variableName, &threadsConnected)
 	if err != nil {
 		return checkers.Unknown(fmt.Sprintf("Couldn't get 'Threads_Connected' status: %s", err))
 	}
@@ -43,6 +45,8 @@ func checkConnection(args []string) *checkers.Checker {
 		checkSt = checkers.CRITICAL
 	} else if threadsConnected > opts.Warn {
 		checkSt = checkers.WARNING
+	} else {
+		msg += fmt.Sprintf(" (%s)", opts.via())
 	}
 	return checkers.NewChecker(checkSt, msg)
 }
@@ -0,0 +1,181 @@
+package checkmysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+)
+
+type dataSizeOpts struct {
+	mysqlSetting
+	Schemas []string `short:"s" long:"schema" value-name:"NAME" description:"Schema to check (may be repeated, default: all schemas except the system ones)"`
+	Warn    string   `short:"w" long:"warning" value-name:"SIZE" description:"warning if the size of a schema is over (e.g. 200GB)"`
+	Crit    string   `short:"c" long:"critical" value-name:"SIZE" description:"critical if the size of a schema is over (e.g. 250GB)"`
+}
+
+// schemaSize is the total size of the data and the indexes of the tables in a schema.
+type schemaSize struct {
+	schema string
+	size   int64
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses the size with a unit of B, KB, MB, GB or TB in powers of 1024.
+// The size without a unit is in bytes.
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: must be a number with a unit of B, KB, MB, GB or TB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+func formatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n >= u.size && u.size > 1 {
+			return strconv.FormatFloat(float64(n)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+func checkDataSize(args []string) *checkers.Checker {
+	opts := dataSizeOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "datasize [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var warn, crit *int64
+	for _, t := range []struct {
+		opt  string
+		dest **int64
+	}{{opts.Warn, &warn}, {opts.Crit, &crit}} {
+		if t.opt == "" {
+			continue
+		}
+		n, err := parseSize(t.opt)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		*t.dest = &n
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
+	db, err := newDB(opts.mysqlSetting)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
+	}
+	defer db.Close()
+
+	sizes, err := getSchemaSizes(db, opts.Schemas)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(sizes, warn, crit)
+}
+
+// getSchemaSizes returns the sizes of the schemas in the order of the names,
+// or of all schemas except the system ones if no name is given.
+func getSchemaSizes(db *sql.DB, schemas []string) ([]schemaSize, error) {
+	// the schemas without tables are not in information_schema.TABLES.
+	query := "SELECT s.SCHEMA_NAME, COALESCE(SUM(t.DATA_LENGTH + t.INDEX_LENGTH), 0) " +
+		"FROM information_schema.SCHEMATA s LEFT JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = s.SCHEMA_NAME "
+	var args []interface{}
+	if len(schemas) > 0 {
+		query += "WHERE s.SCHEMA_NAME IN (?" + strings.Repeat(", ?", len(schemas)-1) + ") "
+		for _, s := range schemas {
+			args = append(args, s)
+		}
+	} else {
+		query += "WHERE s.SCHEMA_NAME NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys') "
+	}
+	query += "GROUP BY s.SCHEMA_NAME ORDER BY s.SCHEMA_NAME"
+
+	end := debuglog.Trace("sql: %s", query)
+	rows, err := db.Query(query, args...)
+	end(err)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't execute query: %s", err)
+	}
+	defer rows.Close()
+	found := make(map[string]int64)
+	var sizes []schemaSize
+	for rows.Next() {
+		var s schemaSize
+		if err := rows.Scan(&s.schema, &s.size); err != nil {
+			return nil, fmt.Errorf("Couldn't scan row: %s", err)
+		}
+		found[s.schema] = s.size
+		sizes = append(sizes, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return sizes, nil
+	}
+	sizes = sizes[:0]
+	for _, name := range schemas {
+		size, ok := found[name]
+		if !ok {
+			return nil, fmt.Errorf("schema %s is not found", name)
+		}
+		sizes = append(sizes, schemaSize{name, size})
+	}
+	return sizes, nil
+}
+
+// evaluate compares the size of each schema with the thresholds, and appends the sizes as performance data.
+func (opts *dataSizeOpts) evaluate(sizes []schemaSize, warn, crit *int64) *checkers.Checker {
+	if len(sizes) == 0 {
+		return checkers.Unknown("no schemas")
+	}
+	checkSt := checkers.OK
+	var msgs, perfs []string
+	for _, s := range sizes {
+		st := checkers.OK
+		if crit != nil && s.size > *crit {
+			st = checkers.CRITICAL
+		} else if warn != nil && s.size > *warn {
+			st = checkers.WARNING
+		}
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, fmt.Sprintf("%s %s", s.schema, formatSize(s.size)))
+		perfs = append(perfs, perfdata.FormatMinMax(s.schema, strconv.FormatInt(s.size, 10), "B", perfdata.OptInt(warn), perfdata.OptInt(crit), "0", ""))
+	}
+	msg := strings.Join(msgs, ", ")
+	if checkSt == checkers.OK {
+		msg += fmt.Sprintf(" (%s)", opts.via())
+	}
+	return checkers.NewChecker(checkSt, msg+" | "+strings.Join(perfs, " "))
+}
@@ -0,0 +1,60 @@
+package checkmysql
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"200GB", 200 << 30},
+		{"1.5 tb", 3 << 39},
+		{"512KB", 512 << 10},
+		{"100", 100},
+		{"100B", 100},
+	}
+	for _, tt := range tests {
+		n, err := parseSize(tt.s)
+		assert.Nil(t, err, tt.s)
+		assert.Equal(t, tt.want, n, tt.s)
+	}
+	for _, s := range []string{"", "GB", "-1GB", "10PB"} {
+		_, err := parseSize(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "210.5GB", formatSize(210<<30+512<<20))
+	assert.Equal(t, "1.0KB", formatSize(1024))
+	assert.Equal(t, "0B", formatSize(0))
+}
+
+func TestDataSizeEvaluate(t *testing.T) {
+	opts := dataSizeOpts{mysqlSetting: mysqlSetting{Hosts: []string{"db1"}, Port: "3306", noSocketProbe: true}}
+	warn, crit := int64(200<<30), int64(250<<30)
+	sizes := []schemaSize{{"app_db", 100 << 30}, {"logs", 10 << 20}}
+
+	ckr := opts.evaluate(sizes, &warn, &crit)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "app_db 100.0GB, logs 10.0MB (via TCP db1:3306) | app_db=107374182400B;214748364800;268435456000;0 logs=10485760B;214748364800;268435456000;0", ckr.Message)
+
+	sizes[0].size = 210 << 30
+	assert.Equal(t, checkers.WARNING, opts.evaluate(sizes, &warn, &crit).Status)
+	sizes[1].size = 300 << 30
+	assert.Equal(t, checkers.CRITICAL, opts.evaluate(sizes, &warn, &crit).Status)
+
+	ckr = opts.evaluate(sizes, nil, nil)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Contains(t, ckr.Message, "logs=322122547200B;;;0")
+
+	ckr = opts.evaluate([]schemaSize{{"it's db", 1024}}, nil, nil)
+	assert.Contains(t, ckr.Message, "| 'it''s db'=1024B;;;0")
+
+	assert.Equal(t, checkers.UNKNOWN, opts.evaluate(nil, nil, nil).Status)
+}
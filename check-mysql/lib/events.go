@@ -0,0 +1,165 @@
+package checkmysql
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+type eventsOpts struct {
+	mysqlSetting
+	Disabled     string   `long:"disabled" choice:"warning" choice:"critical" default:"warning" description:"Status when any event is disabled unexpectedly"`
+	IgnoreEvents []string `long:"ignore-event" value-name:"SCHEMA.NAME" description:"Don't alert when the events are disabled (may be repeated, wildcards are allowed, e.g. archive.*)"`
+}
+
+// eventInfo is a scheduled event in information_schema.EVENTS.
+type eventInfo struct {
+	schema  string
+	name    string
+	status  string
+	expired bool
+}
+
+func (e eventInfo) String() string {
+	return e.schema + "." + e.name
+}
+
+// eventsStatus is the state of the event scheduler.
+type eventsStatus struct {
+	scheduler string
+	// running is whether the thread of the event scheduler is in the process list.
+	running bool
+	events  []eventInfo
+}
+
+// queryEvents lists the events. A one-time event which has been executed and an event past its ENDS
+// remain DISABLED if they are created with ON COMPLETION PRESERVE, which are marked as expired.
+const queryEvents = "SELECT EVENT_SCHEMA, EVENT_NAME, STATUS, " +
+	"(EVENT_TYPE = 'ONE TIME' AND EXECUTE_AT <= NOW()) OR (ENDS IS NOT NULL AND ENDS <= NOW()) " +
+	"FROM information_schema.EVENTS ORDER BY EVENT_SCHEMA, EVENT_NAME"
+
+func checkEvents(args []string) *checkers.Checker {
+	opts := eventsOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "events [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	for _, pattern := range opts.IgnoreEvents {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return checkers.Unknown(fmt.Sprintf("invalid --ignore-event %q: %s", pattern, err))
+		}
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
+	db, err := newDB(opts.mysqlSetting)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
+	}
+	defer db.Close()
+
+	st, err := getEventsStatus(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st)
+}
+
+func getEventsStatus(db *sql.DB) (*eventsStatus, error) {
+	var st eventsStatus
+	var name string
+	if err := queryRow(db, "SHOW GLOBAL VARIABLES LIKE 'event_scheduler'", &name, &st.scheduler); err != nil {
+		return nil, fmt.Errorf("Couldn't get 'event_scheduler' variable: %s", err)
+	}
+	var threads int
+	if err := queryRow(db, "SELECT COUNT(*) FROM information_schema.PROCESSLIST WHERE USER = 'event_scheduler'", &threads); err != nil {
+		return nil, fmt.Errorf("Couldn't get the thread of the event scheduler: %s", err)
+	}
+	st.running = threads > 0
+
+	end := debuglog.Trace("sql: %s", queryEvents)
+	rows, err := db.Query(queryEvents)
+	end(err)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't execute query: %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e eventInfo
+		var expired sql.NullBool
+		if err := rows.Scan(&e.schema, &e.name, &e.status, &expired); err != nil {
+			return nil, fmt.Errorf("Couldn't scan row: %s", err)
+		}
+		e.expired = expired.Bool
+		st.events = append(st.events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (opts *eventsOpts) ignored(e eventInfo) bool {
+	for _, pattern := range opts.IgnoreEvents {
+		if ok, _ := path.Match(pattern, e.String()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate checks that the event scheduler is running if any event is enabled,
+// and that no event is disabled except the expired ones, the ones disabled on replicas and the ignored ones.
+func (opts *eventsOpts) evaluate(st *eventsStatus) *checkers.Checker {
+	var enabled, expired int
+	var disabled []string
+	for _, e := range st.events {
+		switch {
+		case e.status == "ENABLED":
+			enabled++
+		case e.expired:
+			expired++
+		// the events replicated from the source are SLAVESIDE_DISABLED (REPLICA_SIDE_DISABLED in MySQL 8.0.22 or later).
+		case strings.HasSuffix(e.status, "SIDE_DISABLED"), opts.ignored(e):
+		default:
+			disabled = append(disabled, e.String())
+		}
+	}
+
+	checkSt := checkers.OK
+	var msgs []string
+	switch {
+	case st.scheduler != "ON" && enabled > 0:
+		checkSt = checkers.CRITICAL
+		msgs = append(msgs, fmt.Sprintf("event_scheduler is %s with %d enabled events", st.scheduler, enabled))
+	case st.scheduler == "ON" && !st.running:
+		checkSt = checkers.CRITICAL
+		msgs = append(msgs, "event_scheduler is ON but its thread is not running")
+	default:
+		msgs = append(msgs, fmt.Sprintf("event_scheduler is %s with %d enabled events", st.scheduler, enabled))
+	}
+	if expired > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d expired events", expired))
+	}
+	if len(disabled) > 0 {
+		msgs = append(msgs, fmt.Sprintf("disabled events: %s", strings.Join(disabled, ", ")))
+		if checkSt == checkers.OK {
+			checkSt = checkers.WARNING
+			if opts.Disabled == "critical" {
+				checkSt = checkers.CRITICAL
+			}
+		}
+	}
+	msg := strings.Join(msgs, ", ")
+	if checkSt == checkers.OK {
+		msg += fmt.Sprintf(" (%s)", opts.via())
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
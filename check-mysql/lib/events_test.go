@@ -0,0 +1,76 @@
+package checkmysql
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsEvaluate(t *testing.T) {
+	setting := mysqlSetting{Hosts: []string{"db1"}, Port: "3306", noSocketProbe: true}
+	events := []eventInfo{
+		{schema: "app", name: "purge_sessions", status: "ENABLED"},
+		{schema: "app", name: "migrate_once", status: "DISABLED", expired: true},
+		{schema: "app", name: "rotate_logs", status: "SLAVESIDE_DISABLED"},
+		{schema: "archive", name: "compact", status: "DISABLED"},
+	}
+	tests := []struct {
+		name string
+		opts eventsOpts
+		st   eventsStatus
+		want checkers.Status
+		msg  string
+	}{
+		{
+			name: "healthy",
+			opts: eventsOpts{mysqlSetting: setting, IgnoreEvents: []string{"archive.*"}},
+			st:   eventsStatus{scheduler: "ON", running: true, events: events},
+			want: checkers.OK,
+			msg:  "event_scheduler is ON with 1 enabled events, 1 expired events (via TCP db1:3306)",
+		},
+		{
+			name: "disabled event",
+			opts: eventsOpts{mysqlSetting: setting, Disabled: "warning"},
+			st:   eventsStatus{scheduler: "ON", running: true, events: events},
+			want: checkers.WARNING,
+			msg:  "event_scheduler is ON with 1 enabled events, 1 expired events, disabled events: archive.compact",
+		},
+		{
+			name: "disabled event as critical",
+			opts: eventsOpts{mysqlSetting: setting, Disabled: "critical"},
+			st:   eventsStatus{scheduler: "ON", running: true, events: events},
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "scheduler off",
+			opts: eventsOpts{mysqlSetting: setting, IgnoreEvents: []string{"archive.compact"}},
+			st:   eventsStatus{scheduler: "OFF", events: events},
+			want: checkers.CRITICAL,
+			msg:  "event_scheduler is OFF with 1 enabled events, 1 expired events",
+		},
+		{
+			name: "scheduler off without enabled events",
+			opts: eventsOpts{mysqlSetting: setting},
+			st:   eventsStatus{scheduler: "DISABLED"},
+			want: checkers.OK,
+			msg:  "event_scheduler is DISABLED with 0 enabled events (via TCP db1:3306)",
+		},
+		{
+			name: "scheduler thread died",
+			opts: eventsOpts{mysqlSetting: setting, IgnoreEvents: []string{"archive.*"}},
+			st:   eventsStatus{scheduler: "ON", events: events},
+			want: checkers.CRITICAL,
+			msg:  "event_scheduler is ON but its thread is not running, 1 expired events",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckr := tt.opts.evaluate(&tt.st)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+			if tt.msg != "" {
+				assert.Equal(t, tt.msg, ckr.Message)
+			}
+		})
+	}
+}
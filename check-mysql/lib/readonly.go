@@ -2,7 +2,6 @@ package checkmysql
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
@@ -18,14 +17,16 @@ func checkReadOnly(args []string) *checkers.Checker {
 	psr.Usage = "readonly [OPTIONS] [ON|OFF]"
 	args, err := psr.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 	if len(args) != 1 {
-		fmt.Println("wrong number of arguments")
-		os.Exit(1)
+		return checkers.Unknown("wrong number of arguments")
 	}
 	argStatus := args[0]
 
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
 	db, err := newDB(opts.mysqlSetting)
 	if err != nil {
 		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
@@ -36,7 +37,7 @@ func checkReadOnly(args []string) *checkers.Checker {
 		variableName   string
 		readOnlyStatus string
 	)
-	err = db.QueryRow("SHOW GLOBAL VARIABLES LIKE 'read_only'").Scan(&variableName, &readOnlyStatus)
+	err = queryRow(db, "SHOW GLOBAL VARIABLES LIKE 'read_only'", &variableName, &readOnlyStatus)
 	if err != nil {
 		return checkers.Unknown(fmt.Sprintf("Couldn't get 'read_only' variable status: %s", err))
 	}
@@ -46,5 +47,5 @@ func checkReadOnly(args []string) *checkers.Checker {
 		return checkers.Critical(msg)
 	}
 
-	return checkers.Ok(fmt.Sprintf("read_only is the expected value (%s)", argStatus))
+	return checkers.Ok(fmt.Sprintf("read_only is the expected value (%s, %s)", argStatus, opts.via()))
 }
@@ -1,31 +1,55 @@
 package checkmysql
 
 import (
+	"bufio"
 	"database/sql"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/jmoiron/sqlx"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type replicationOpts struct {
 	mysqlSetting
-	Crit int64 `short:"c" long:"critical" default:"250" description:"critical if the seconds behind master is over"`
-	Warn int64 `short:"w" long:"warning" default:"200" description:"warning if the seconds behind master is over"`
+	Crit           int64  `short:"c" long:"critical" default:"250" description:"critical if the seconds behind master is over"`
+	Warn           int64  `short:"w" long:"warning" default:"200" description:"warning if the seconds behind master is over"`
+	IgnoreErrno    string `long:"ignore-errno" value-name:"ERRNO" description:"Don't alert when the replication has been stopped only by the errors (comma separated, e.g. 1062,1032)"`
+	HeartbeatTable string `long:"heartbeat-table" value-name:"DB.TABLE" description:"Compute the lag from the pt-heartbeat table instead of the seconds behind master"`
+	HeartbeatUTC   bool   `long:"heartbeat-utc" description:"The timestamps in the heartbeat table are in UTC (pt-heartbeat --utc)"`
+	HostsFile      string `long:"hosts-file" value-name:"FILE" description:"Check the replicas listed in the file (HOST[:PORT] per line) concurrently"`
 }
 
 type status interface {
 	ioRunning() string
 	sqlRunning() string
 	secondsBehind() sql.NullInt64
+	sourceHost() string
+	sourcePort() int
+	sourceUUID() string
+	sourceServerID() int64
+	lastIOError() (int, string)
+	lastSQLError() (int, string)
 }
 
 type replicationStatus struct {
 	ReplicaIORunning    string        `db:"Replica_IO_Running"`
 	ReplicaSQLRunning   string        `db:"Replica_SQL_Running"`
 	SecondsBehindSource sql.NullInt64 `db:"Seconds_Behind_Source"`
+	SourceHost          string        `db:"Source_Host"`
+	SourcePort          int           `db:"Source_Port"`
+	SourceUUID          string        `db:"Source_UUID"`
+	SourceServerID      int64         `db:"Source_Server_Id"`
+	LastIOErrno         int           `db:"Last_IO_Errno"`
+	LastIOError         string        `db:"Last_IO_Error"`
+	LastSQLErrno        int           `db:"Last_SQL_Errno"`
+	LastSQLError        string        `db:"Last_SQL_Error"`
 }
 
 func (r *replicationStatus) ioRunning() string {
@@ -40,10 +64,42 @@ func (r *replicationStatus) secondsBehind() sql.NullInt64 {
 	return r.SecondsBehindSource
 }
 
+func (r *replicationStatus) sourceHost() string {
+	return r.SourceHost
+}
+
+func (r *replicationStatus) sourcePort() int {
+	return r.SourcePort
+}
+
+func (r *replicationStatus) sourceUUID() string {
+	return r.SourceUUID
+}
+
+func (r *replicationStatus) sourceServerID() int64 {
+	return r.SourceServerID
+}
+
+func (r *replicationStatus) lastIOError() (int, string) {
+	return r.LastIOErrno, r.LastIOError
+}
+
+func (r *replicationStatus) lastSQLError() (int, string) {
+	return r.LastSQLErrno, r.LastSQLError
+}
+
 type slaveStatus struct {
 	SlaveIORunning      string        `db:"Slave_IO_Running"`
 	SlaveSQLRunning     string        `db:"Slave_SQL_Running"`
 	SecondsBehindMaster sql.NullInt64 `db:"Seconds_Behind_Master"`
+	MasterHost          string        `db:"Master_Host"`
+	MasterPort          int           `db:"Master_Port"`
+	MasterUUID          string        `db:"Master_UUID"`
+	MasterServerID      int64         `db:"Master_Server_Id"`
+	LastIOErrno         int           `db:"Last_IO_Errno"`
+	LastIOError         string        `db:"Last_IO_Error"`
+	LastSQLErrno        int           `db:"Last_SQL_Errno"`
+	LastSQLError        string        `db:"Last_SQL_Error"`
 }
 
 func (r *slaveStatus) ioRunning() string {
@@ -58,30 +114,41 @@ func (r *slaveStatus) secondsBehind() sql.NullInt64 {
 	return r.SecondsBehindMaster
 }
 
-func checkReplication(args []string) *checkers.Checker {
-	opts := replicationOpts{}
-	psr := flags.NewParser(&opts, flags.Default)
-	psr.Usage = "replication [OPTIONS]"
-	_, err := psr.ParseArgs(args)
-	if err != nil {
-		os.Exit(1)
-	}
-	db, err := newDB(opts.mysqlSetting)
-	if err != nil {
-		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
-	}
-	defer db.Close()
+func (r *slaveStatus) sourceHost() string {
+	return r.MasterHost
+}
+
+func (r *slaveStatus) sourcePort() int {
+	return r.MasterPort
+}
 
+func (r *slaveStatus) sourceUUID() string {
+	return r.MasterUUID
+}
+
+func (r *slaveStatus) sourceServerID() int64 {
+	return r.MasterServerID
+}
+
+func (r *slaveStatus) lastIOError() (int, string) {
+	return r.LastIOErrno, r.LastIOError
+}
+
+func (r *slaveStatus) lastSQLError() (int, string) {
+	return r.LastSQLErrno, r.LastSQLError
+}
+
+// getReplicaStatus returns the replication status of db, or nil if db is not a replica.
+func getReplicaStatus(db *sql.DB) (status, error) {
 	mySQLVersion, err := getMySQLVersion(db)
 	if err != nil {
-		return checkers.Unknown(fmt.Sprintf("Couldn't get MySQL Version: %s", err))
+		return nil, fmt.Errorf("Couldn't get MySQL Version: %s", err)
 	}
 
 	// MySQL > 8.0.22 supports `SHOW REPLICA STATUS`
 	replicaSupport := !(mySQLVersion.major < 8 || (mySQLVersion.major == 8 && mySQLVersion.minor == 0 && mySQLVersion.patch < 22))
 
 	sqlxDb := sqlx.NewDb(db, "mysql")
-	defer sqlxDb.Close()
 
 	var queryShowStatus string
 	if replicaSupport {
@@ -91,14 +158,16 @@ func checkReplication(args []string) *checkers.Checker {
 	}
 
 	// Ignore columns which does not exist in structs.
+	end := debuglog.Trace("sql: %s", queryShowStatus)
 	rows, err := sqlxDb.Unsafe().Queryx(queryShowStatus)
+	end(err)
 	if err != nil {
-		return checkers.Unknown(fmt.Sprintf("Couldn't execute query: %s", err))
+		return nil, fmt.Errorf("Couldn't execute query: %s", err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return checkers.Ok("MySQL is not a replica")
+		return nil, nil
 	}
 
 	var status status
@@ -109,12 +178,172 @@ func checkReplication(args []string) *checkers.Checker {
 	}
 	err = rows.StructScan(status)
 	if err != nil {
-		return checkers.Unknown(fmt.Sprintf("Couldn't scan row: %s", err))
+		return nil, fmt.Errorf("Couldn't scan row: %s", err)
 	}
+	return status, nil
+}
 
-	if !(status.ioRunning() == "Yes" && status.sqlRunning() == "Yes") {
+func parseErrnoList(s string) (map[int]bool, error) {
+	errnos := make(map[int]bool)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid errno: %s", v)
+		}
+		errnos[n] = true
+	}
+	return errnos, nil
+}
+
+// checkStopped returns the result for the replication which has been stopped.
+// It is OK only when the replication has been stopped by the errors to be ignored.
+func checkStopped(st status, ignore map[int]bool) *checkers.Checker {
+	var msgs []string
+	ignored := true
+	for _, e := range []struct {
+		thread string
+		fn     func() (int, string)
+	}{{"IO", st.lastIOError}, {"SQL", st.lastSQLError}} {
+		errno, errmsg := e.fn()
+		if errno == 0 {
+			continue
+		}
+		if !ignore[errno] {
+			ignored = false
+		}
+		msgs = append(msgs, fmt.Sprintf("%s thread error %d: %s", e.thread, errno, errmsg))
+	}
+	if len(msgs) == 0 {
 		return checkers.Critical("MySQL replication has been stopped")
 	}
+	msg := "MySQL replication has been stopped by " + strings.Join(msgs, ", ")
+	if ignored {
+		return checkers.Ok(msg + " (ignored)")
+	}
+	return checkers.Critical(msg)
+}
+
+// quoteTable quotes the table name which may be qualified by the database name.
+func quoteTable(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid table name: %s", name)
+	}
+	for i, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("invalid table name: %s", name)
+		}
+		parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// heartbeatQuery returns the query to compute the lag in microseconds from the heartbeat of the source server.
+// pt-heartbeat writes the timestamps in the local time unless --utc is specified.
+func heartbeatQuery(table string, utc bool) (string, error) {
+	t, err := quoteTable(table)
+	if err != nil {
+		return "", err
+	}
+	now := "NOW(6)"
+	if utc {
+		now = "UTC_TIMESTAMP(6)"
+	}
+	return fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, ts, %s) FROM %s WHERE server_id = ?", now, t), nil
+}
+
+// getHeartbeatLag returns the seconds since the last heartbeat of the source server written by pt-heartbeat.
+func getHeartbeatLag(db *sql.DB, table string, utc bool, serverID int64) (float64, error) {
+	query, err := heartbeatQuery(table, utc)
+	if err != nil {
+		return 0, err
+	}
+	var lag sql.NullInt64
+	end := debuglog.Trace("sql: %s", query)
+	err = db.QueryRow(query, serverID).Scan(&lag)
+	end(err)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("No heartbeat of the server_id %d in %s", serverID, table)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Couldn't execute query: %s", err)
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("Invalid heartbeat timestamp of the server_id %d in %s", serverID, table)
+	}
+	return float64(lag.Int64) / 1e6, nil
+}
+
+func checkReplication(args []string) *checkers.Checker {
+	opts := replicationOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "replication [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var hosts []string
+	if !psr.FindOptionByLongName("host").IsSetDefault() {
+		hosts = append(hosts, opts.Hosts...)
+	}
+	ignore, err := parseErrnoList(opts.IgnoreErrno)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.HostsFile != "" {
+		h, err := readHostsFile(opts.HostsFile)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		hosts = append(hosts, h...)
+	}
+	if len(hosts) > 1 || opts.HostsFile != "" {
+		if opts.SelfTest {
+			checks := make([]selftest.Check, 0, len(hosts))
+			for _, addr := range hosts {
+				checks = append(checks, selftest.Resolve(addr))
+			}
+			return selftest.Run(checks...)
+		}
+		return opts.checkHosts(hosts, ignore)
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
+	return opts.check(ignore)
+}
+
+// check checks the replication of the server of the setting.
+func (opts *replicationOpts) check(ignore map[int]bool) *checkers.Checker {
+	db, err := newDB(opts.mysqlSetting)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
+	}
+	defer db.Close()
+
+	status, err := getReplicaStatus(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if status == nil {
+		return checkers.Ok(fmt.Sprintf("MySQL is not a replica (%s)", opts.via()))
+	}
+
+	if !(status.ioRunning() == "Yes" && status.sqlRunning() == "Yes") {
+		return checkStopped(status, ignore)
+	}
+
+	if opts.HeartbeatTable != "" {
+		lag, err := getHeartbeatLag(db, opts.HeartbeatTable, opts.HeartbeatUTC, status.sourceServerID())
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		return opts.checkHeartbeatLag(lag)
+	}
 
 	checkSt := checkers.OK
 	secondsBehind := status.secondsBehind()
@@ -127,6 +356,102 @@ func checkReplication(args []string) *checkers.Checker {
 		checkSt = checkers.CRITICAL
 	} else if secondsBehind.Int64 > opts.Warn {
 		checkSt = checkers.WARNING
+	} else {
+		msg += fmt.Sprintf(" (%s)", opts.via())
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
+
+// readHostsFile reads HOST[:PORT] per line. Empty lines and lines starting with # are ignored.
+func readHostsFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var hosts []string
+	scr := bufio.NewScanner(f)
+	for scr.Scan() {
+		line := strings.TrimSpace(scr.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := scr.Err(); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts in %s", file)
+	}
+	return hosts, nil
+}
+
+// checkHosts checks the replication of the hosts concurrently, and reports the worst status
+// with the result of each host in a line.
+func (opts *replicationOpts) checkHosts(hosts []string, ignore map[int]bool) *checkers.Checker {
+	results := make([]*checkers.Checker, len(hosts))
+	var wg sync.WaitGroup
+	for i, addr := range hosts {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			o := *opts
+			host, port, err := parseNodeAddr(addr, opts.Port)
+			if err != nil {
+				results[i] = checkers.Unknown(err.Error())
+				return
+			}
+			o.Hosts = []string{host}
+			o.Port = strconv.Itoa(port)
+			o.Socket = ""
+			o.noSocketProbe = true
+			results[i] = o.check(ignore)
+		}(i, addr)
+	}
+	wg.Wait()
+	return summarizeHosts(hosts, results)
+}
+
+// hostsSeverity ranks the statuses of the hosts, where CRITICAL is the worst
+// because the replicas failing to check are less urgent than the lagging ones.
+var hostsSeverity = map[checkers.Status]int{
+	checkers.OK:       0,
+	checkers.WARNING:  1,
+	checkers.UNKNOWN:  2,
+	checkers.CRITICAL: 3,
+}
+
+func summarizeHosts(hosts []string, results []*checkers.Checker) *checkers.Checker {
+	checkSt := checkers.OK
+	counts := make(map[checkers.Status]int)
+	lines := make([]string, len(hosts))
+	for i, r := range results {
+		if hostsSeverity[r.Status] > hostsSeverity[checkSt] {
+			checkSt = r.Status
+		}
+		counts[r.Status]++
+		lines[i] = fmt.Sprintf("[%s] %s: %s", r.Status, hosts[i], r.Message)
+	}
+	var summary []string
+	for _, st := range []checkers.Status{checkers.OK, checkers.WARNING, checkers.CRITICAL, checkers.UNKNOWN} {
+		if counts[st] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[st], st))
+		}
+	}
+	msg := fmt.Sprintf("%s of %d hosts\n%s", strings.Join(summary, ", "), len(hosts), strings.Join(lines, "\n"))
+	return checkers.NewChecker(checkSt, msg)
+}
+
+func (opts *replicationOpts) checkHeartbeatLag(lag float64) *checkers.Checker {
+	checkSt := checkers.OK
+	msg := fmt.Sprintf("MySQL replication behind master %.3f seconds by heartbeat", lag)
+	if lag > float64(opts.Crit) {
+		checkSt = checkers.CRITICAL
+	} else if lag > float64(opts.Warn) {
+		checkSt = checkers.WARNING
+	} else {
+		msg += fmt.Sprintf(" (%s)", opts.via())
 	}
 	return checkers.NewChecker(checkSt, msg)
 }
@@ -0,0 +1,137 @@
+package checkmysql
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrnoList(t *testing.T) {
+	errnos, err := parseErrnoList("1062, 1032")
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]bool{1062: true, 1032: true}, errnos)
+
+	errnos, err = parseErrnoList("")
+	assert.Nil(t, err)
+	assert.Len(t, errnos, 0)
+
+	_, err = parseErrnoList("1062,duplicate")
+	assert.NotNil(t, err)
+}
+
+func TestCheckStopped(t *testing.T) {
+	ignore := map[int]bool{1062: true, 1032: true}
+	tests := []struct {
+		name   string
+		status status
+		want   checkers.Status
+	}{
+		{
+			name:   "stopped without errors",
+			status: &replicationStatus{ReplicaIORunning: "Yes", ReplicaSQLRunning: "No"},
+			want:   checkers.CRITICAL,
+		},
+		{
+			name:   "ignored SQL error",
+			status: &replicationStatus{ReplicaIORunning: "Yes", ReplicaSQLRunning: "No", LastSQLErrno: 1062, LastSQLError: "Duplicate entry"},
+			want:   checkers.OK,
+		},
+		{
+			name:   "other SQL error",
+			status: &slaveStatus{SlaveIORunning: "Yes", SlaveSQLRunning: "No", LastSQLErrno: 1146, LastSQLError: "Table doesn't exist"},
+			want:   checkers.CRITICAL,
+		},
+		{
+			name:   "ignored SQL error with IO error",
+			status: &slaveStatus{SlaveIORunning: "No", SlaveSQLRunning: "No", LastIOErrno: 2003, LastSQLErrno: 1032},
+			want:   checkers.CRITICAL,
+		},
+	}
+	for _, tt := range tests {
+		ckr := checkStopped(tt.status, ignore)
+		assert.Equal(t, tt.want, ckr.Status, tt.name+": "+ckr.Message)
+	}
+}
+
+func TestHeartbeatQuery(t *testing.T) {
+	q, err := heartbeatQuery("percona.heartbeat", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT TIMESTAMPDIFF(MICROSECOND, ts, NOW(6)) FROM `percona`.`heartbeat` WHERE server_id = ?", q)
+
+	q, err = heartbeatQuery("heart`beat", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT TIMESTAMPDIFF(MICROSECOND, ts, UTC_TIMESTAMP(6)) FROM `heart``beat` WHERE server_id = ?", q)
+
+	for _, table := range []string{"", "percona.", "a.b.c"} {
+		_, err = heartbeatQuery(table, false)
+		assert.NotNil(t, err, table)
+	}
+}
+
+func TestCheckHeartbeatLag(t *testing.T) {
+	opts := replicationOpts{Warn: 5, Crit: 10}
+	tests := []struct {
+		lag  float64
+		want checkers.Status
+	}{
+		{0.25, checkers.OK},
+		{5.5, checkers.WARNING},
+		{10.001, checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := opts.checkHeartbeatLag(tt.lag)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
+
+func TestReadHostsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	err := ioutil.WriteFile(file, []byte("# replicas\ndb1\n\n  db2:3307  \n"), 0644)
+	assert.Nil(t, err)
+	hosts, err := readHostsFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db1", "db2:3307"}, hosts)
+
+	err = ioutil.WriteFile(file, []byte("# none\n"), 0644)
+	assert.Nil(t, err)
+	_, err = readHostsFile(file)
+	assert.NotNil(t, err)
+}
+
+func TestSummarizeHosts(t *testing.T) {
+	ckr := summarizeHosts([]string{"db1", "db2:3307", "db3"}, []*checkers.Checker{
+		checkers.Ok("MySQL replication behind master 0 seconds (via TCP db1:3306)"),
+		checkers.Critical("MySQL replication behind master 300 seconds"),
+		checkers.Warning("MySQL replication behind master 210 seconds"),
+	})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "1 OK, 1 WARNING, 1 CRITICAL of 3 hosts\n"+
+		"[OK] db1: MySQL replication behind master 0 seconds (via TCP db1:3306)\n"+
+		"[CRITICAL] db2:3307: MySQL replication behind master 300 seconds\n"+
+		"[WARNING] db3: MySQL replication behind master 210 seconds", ckr.Message)
+
+	ckr = summarizeHosts([]string{"db1", "db2"}, []*checkers.Checker{
+		checkers.Unknown("Couldn't open DB: dial tcp: connection refused"),
+		checkers.Critical("MySQL replication behind master 300 seconds"),
+	})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+
+	ckr = summarizeHosts([]string{"db1", "db2"}, []*checkers.Checker{
+		checkers.Warning("MySQL replication behind master 210 seconds"),
+		checkers.Unknown("Couldn't open DB: dial tcp: connection refused"),
+	})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+}
+
+func TestReplicationHosts(t *testing.T) {
+	// all of the repeated --host are checked, not only the last one
+	ckr := checkReplication([]string{"-H", "host.invalid", "--host=127.0.0.1:3307", "--self-test"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Contains(t, ckr.Message, "host.invalid")
+
+	ckr = checkReplication([]string{"-H", "127.0.0.1", "--host=127.0.0.2:3307", "--self-test"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+}
@@ -0,0 +1,69 @@
+package checkmysql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type sslExpiryOpts struct {
+	mysqlSetting
+	Crit int64 `short:"c" long:"critical" default:"14" description:"critical if the server certificate expires within the days"`
+	Warn int64 `short:"w" long:"warning" default:"30" description:"warning if the server certificate expires within the days"`
+}
+
+// sslNotAfterLayout is the layout of Ssl_server_not_after, which is formatted by OpenSSL.
+const sslNotAfterLayout = "Jan _2 15:04:05 2006 MST"
+
+func checkSSLExpiry(args []string) *checkers.Checker {
+	opts := sslExpiryOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "ssl-expiry [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
+	db, err := newDB(opts.mysqlSetting)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
+	}
+	defer db.Close()
+
+	var (
+		variableName string
+		notAfter     string
+	)
+	err = queryRow(db, "SHOW GLOBAL STATUS LIKE 'Ssl_server_not_after'", &variableName, &notAfter)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't get 'Ssl_server_not_after' status: %s", err))
+	}
+	if notAfter == "" {
+		return checkers.Unknown("SSL is not enabled on the server")
+	}
+	expiry, err := time.Parse(sslNotAfterLayout, notAfter)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Failed to parse Ssl_server_not_after: %s", err))
+	}
+	return opts.evaluate(expiry, time.Now())
+}
+
+func (opts *sslExpiryOpts) evaluate(expiry, now time.Time) *checkers.Checker {
+	dur := expiry.Sub(now)
+	days := int64(dur.Hours() / 24)
+
+	checkSt := checkers.OK
+	if dur < time.Duration(opts.Crit)*24*time.Hour {
+		checkSt = checkers.CRITICAL
+	} else if dur < time.Duration(opts.Warn)*24*time.Hour {
+		checkSt = checkers.WARNING
+	}
+	if dur < 0 {
+		return checkers.NewChecker(checkSt, fmt.Sprintf("server certificate expired %d days ago (%s)", -days, expiry))
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("server certificate expires in %d days (%s)", days, expiry))
+}
@@ -0,0 +1,40 @@
+package checkmysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSLNotAfterLayout(t *testing.T) {
+	expiry, err := time.Parse(sslNotAfterLayout, "Apr  9 02:06:56 2030 GMT")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2030, 4, 9, 2, 6, 56, 0, time.UTC), expiry.UTC())
+
+	expiry, err = time.Parse(sslNotAfterLayout, "Dec 19 12:00:00 2029 GMT")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2029, 12, 19, 12, 0, 0, 0, time.UTC), expiry.UTC())
+}
+
+func TestSSLExpiryEvaluate(t *testing.T) {
+	opts := &sslExpiryOpts{Crit: 14, Warn: 30}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expiry time.Time
+		status checkers.Status
+		days   string
+	}{
+		{now.AddDate(0, 0, 60), checkers.OK, "expires in 60 days"},
+		{now.AddDate(0, 0, 20), checkers.WARNING, "expires in 20 days"},
+		{now.AddDate(0, 0, 3), checkers.CRITICAL, "expires in 3 days"},
+		{now.AddDate(0, 0, -2), checkers.CRITICAL, "expired 2 days ago"},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluate(tt.expiry, now)
+		assert.Equal(t, tt.status, ckr.Status)
+		assert.Contains(t, ckr.Message, tt.days)
+	}
+}
@@ -0,0 +1,182 @@
+package checkmysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type syncOpts struct {
+	mysqlSetting
+	SemiSyncOff     string  `long:"semi-sync-off" choice:"warning" choice:"critical" default:"critical" description:"Status when semi-sync replication is enabled but has fallen back to asynchronous"`
+	WarnFallbacks   int64   `long:"warning-fallbacks" default:"1" value-name:"N" description:"warning if semi-sync has fallen back to asynchronous the times or more since the last check"`
+	CritFallbacks   *int64  `long:"critical-fallbacks" value-name:"N" description:"critical if semi-sync has fallen back to asynchronous the times or more since the last check"`
+	WarnFlowControl float64 `long:"warning-flow-control" default:"0.1" value-name:"RATIO" description:"warning if Galera replication has been paused by flow control over the ratio of time since the last check"`
+	CritFlowControl float64 `long:"critical-flow-control" default:"0.5" value-name:"RATIO" description:"critical if Galera replication has been paused by flow control over the ratio of time since the last check"`
+	StateDir        string  `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+// syncState is the counters at the last check.
+type syncState struct {
+	Time               int64 `json:"time"`
+	SemiSyncNoTimes    int64 `json:"semi_sync_no_times"`
+	FlowControlPausedN int64 `json:"flow_control_paused_ns"`
+}
+
+func checkSync(args []string) *checkers.Checker {
+	opts := syncOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "sync [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
+	}
+	db, err := newDB(opts.mysqlSetting)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Couldn't open DB: %s", err))
+	}
+	defer db.Close()
+
+	vars, err := getSyncStatus(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-mysql"))
+	var prev *syncState
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	ckr, next := opts.evaluate(vars, prev, time.Now())
+	if err := state.Save(stateFile, next); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return ckr
+}
+
+// getSyncStatus returns the variables of semi-sync replication and the status variables of Galera flow control.
+func getSyncStatus(db *sql.DB) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, query := range []string{
+		"SHOW GLOBAL VARIABLES WHERE Variable_name LIKE 'rpl\\_semi\\_sync\\_%\\_enabled'",
+		"SHOW GLOBAL STATUS WHERE Variable_name LIKE 'Rpl\\_semi\\_sync\\_%' OR Variable_name LIKE 'wsrep\\_flow\\_control\\_%'",
+	} {
+		end := debuglog.Trace("sql: %s", query)
+		rows, err := db.Query(query)
+		end(err)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't execute query: %s", err)
+		}
+		for rows.Next() {
+			var name, value string
+			if err := rows.Scan(&name, &value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("Couldn't scan row: %s", err)
+			}
+			// MySQL 8.0.26 or later names the variables with "source" instead of "master".
+			vars[strings.Replace(strings.ToLower(name), "_source_", "_master_", 1)] = value
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+func (opts *syncOpts) stateFile(stateDir string) string {
+	key := opts.Socket
+	if key == "" {
+		key = strings.Join([]string{opts.host(), opts.Port}, ":")
+	}
+	return state.File(stateDir, "sync", key)
+}
+
+func parseCounter(vars map[string]string, name string) int64 {
+	n, _ := strconv.ParseInt(vars[name], 10, 64)
+	return n
+}
+
+// evaluate checks semi-sync replication on the source and Galera flow control,
+// which are checked only when they are enabled.
+// The counters are compared with prev, the state at the last check, and the state to save is returned.
+func (opts *syncOpts) evaluate(vars map[string]string, prev *syncState, now time.Time) (*checkers.Checker, *syncState) {
+	next := &syncState{
+		Time:               now.Unix(),
+		SemiSyncNoTimes:    parseCounter(vars, "rpl_semi_sync_master_no_times"),
+		FlowControlPausedN: parseCounter(vars, "wsrep_flow_control_paused_ns"),
+	}
+	// the counters are reset by restarts or FLUSH STATUS.
+	if prev != nil && (next.SemiSyncNoTimes < prev.SemiSyncNoTimes || next.FlowControlPausedN < prev.FlowControlPausedN || next.Time <= prev.Time) {
+		prev = nil
+	}
+
+	checkSt := checkers.OK
+	raise := func(st checkers.Status) {
+		if st > checkSt {
+			checkSt = st
+		}
+	}
+	var msgs []string
+
+	if status, ok := vars["rpl_semi_sync_master_status"]; ok && vars["rpl_semi_sync_master_enabled"] == "ON" {
+		if status == "ON" {
+			msgs = append(msgs, fmt.Sprintf("semi-sync is ON with %s replicas", vars["rpl_semi_sync_master_clients"]))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("semi-sync is %s (asynchronous) with %s replicas", status, vars["rpl_semi_sync_master_clients"]))
+			if opts.SemiSyncOff == "warning" {
+				raise(checkers.WARNING)
+			} else {
+				raise(checkers.CRITICAL)
+			}
+		}
+		if prev != nil {
+			fallbacks := next.SemiSyncNoTimes - prev.SemiSyncNoTimes
+			if fallbacks > 0 {
+				msgs = append(msgs, fmt.Sprintf("fell back to asynchronous %d times since the last check", fallbacks))
+			}
+			if opts.CritFallbacks != nil && fallbacks >= *opts.CritFallbacks {
+				raise(checkers.CRITICAL)
+			} else if opts.WarnFallbacks > 0 && fallbacks >= opts.WarnFallbacks {
+				raise(checkers.WARNING)
+			}
+		}
+	}
+
+	if v, ok := vars["wsrep_flow_control_paused"]; ok {
+		// wsrep_flow_control_paused is the ratio since the last FLUSH STATUS,
+		// so the ratio since the last check is computed from the paused time if possible.
+		paused, _ := strconv.ParseFloat(v, 64)
+		since := "FLUSH STATUS"
+		if _, ok := vars["wsrep_flow_control_paused_ns"]; ok && prev != nil {
+			paused = float64(next.FlowControlPausedN-prev.FlowControlPausedN) / float64(time.Duration(next.Time-prev.Time)*time.Second)
+			since = "the last check"
+		}
+		msgs = append(msgs, fmt.Sprintf("flow control paused %.1f%% of the time since %s", paused*100, since))
+		if paused > opts.CritFlowControl {
+			raise(checkers.CRITICAL)
+		} else if paused > opts.WarnFlowControl {
+			raise(checkers.WARNING)
+		}
+	}
+
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("neither semi-sync replication on the source nor Galera is enabled (%s)", opts.via())), next
+	}
+	msg := strings.Join(msgs, ", ")
+	if checkSt == checkers.OK {
+		msg += fmt.Sprintf(" (%s)", opts.via())
+	}
+	return checkers.NewChecker(checkSt, msg), next
+}
@@ -0,0 +1,135 @@
+package checkmysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncEvaluate(t *testing.T) {
+	i := func(v int64) *int64 { return &v }
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	setting := mysqlSetting{Hosts: []string{"db1"}, Port: "3306", noSocketProbe: true}
+	opts := syncOpts{mysqlSetting: setting, SemiSyncOff: "critical", WarnFallbacks: 1, CritFallbacks: i(3), WarnFlowControl: 0.1, CritFlowControl: 0.5}
+	semiSync := func(status, noTimes string) map[string]string {
+		return map[string]string{
+			"rpl_semi_sync_master_enabled":  "ON",
+			"rpl_semi_sync_master_status":   status,
+			"rpl_semi_sync_master_clients":  "2",
+			"rpl_semi_sync_master_no_times": noTimes,
+		}
+	}
+	galera := func(paused, pausedNs string) map[string]string {
+		return map[string]string{
+			"wsrep_flow_control_paused":    paused,
+			"wsrep_flow_control_paused_ns": pausedNs,
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts syncOpts
+		vars map[string]string
+		prev *syncState
+		want checkers.Status
+	}{
+		{
+			name: "not enabled",
+			opts: opts,
+			vars: map[string]string{"rpl_semi_sync_master_enabled": "OFF", "rpl_semi_sync_master_status": "OFF"},
+			want: checkers.OK,
+		},
+		{
+			name: "semi-sync",
+			opts: opts,
+			vars: semiSync("ON", "0"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix()},
+			want: checkers.OK,
+		},
+		{
+			name: "semi-sync is off",
+			opts: opts,
+			vars: semiSync("OFF", "1"),
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "semi-sync is off with warning",
+			opts: syncOpts{mysqlSetting: setting, SemiSyncOff: "warning"},
+			vars: semiSync("OFF", "1"),
+			want: checkers.WARNING,
+		},
+		{
+			name: "semi-sync has fallen back",
+			opts: opts,
+			vars: semiSync("ON", "5"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix(), SemiSyncNoTimes: 4},
+			want: checkers.WARNING,
+		},
+		{
+			name: "semi-sync has fallen back many times",
+			opts: opts,
+			vars: semiSync("ON", "7"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix(), SemiSyncNoTimes: 4},
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "counters are reset",
+			opts: opts,
+			vars: semiSync("ON", "1"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix(), SemiSyncNoTimes: 4},
+			want: checkers.OK,
+		},
+		{
+			name: "flow control since FLUSH STATUS",
+			opts: opts,
+			vars: galera("0.2", "0"),
+			want: checkers.WARNING,
+		},
+		{
+			name: "flow control since the last check",
+			opts: opts,
+			vars: galera("0.2", "40000000000"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix(), FlowControlPausedN: 10000000000},
+			want: checkers.WARNING,
+		},
+		{
+			name: "heavy flow control since the last check",
+			opts: opts,
+			vars: galera("0.01", "50000000000"),
+			prev: &syncState{Time: now.Add(-time.Minute).Unix(), FlowControlPausedN: 10000000000},
+			want: checkers.CRITICAL,
+		},
+	}
+	for _, tt := range tests {
+		ckr, next := tt.opts.evaluate(tt.vars, tt.prev, now)
+		assert.Equal(t, tt.want, ckr.Status, "%s: %s", tt.name, ckr.Message)
+		assert.Equal(t, now.Unix(), next.Time, tt.name)
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := syncOpts{mysqlSetting: mysqlSetting{Hosts: []string{"localhost"}, Port: "3306"}}
+	file := opts.stateFile(filepath.Join(dir, "state"))
+
+	var s *syncState
+	_, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	assert.Nil(t, state.Save(file, &syncState{Time: 100, SemiSyncNoTimes: 3}))
+	_, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.Equal(t, &syncState{Time: 100, SemiSyncNoTimes: 3}, s)
+}
@@ -0,0 +1,165 @@
+package checkmysql
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type topologyOpts struct {
+	mysqlSetting
+	Nodes []string `short:"n" long:"node" required:"true" value-name:"HOST[:PORT]" description:"MySQL server belonging to the replication topology (may be repeated)"`
+}
+
+type topologyNode struct {
+	addr     string
+	host     string
+	port     int
+	uuid     string
+	readOnly bool
+	replica  status
+	err      error
+}
+
+func (n *topologyNode) isWritable() bool {
+	return n.err == nil && !n.readOnly
+}
+
+// replicatesFrom reports whether n is a replica of primary.
+// The UUID of the source is compared first because the address of the source
+// seen from a replica is not always the same as the address given by the option.
+func (n *topologyNode) replicatesFrom(primary *topologyNode) bool {
+	if n.replica == nil {
+		return false
+	}
+	if uuid := n.replica.sourceUUID(); uuid != "" && primary.uuid != "" {
+		return uuid == primary.uuid
+	}
+	return n.replica.sourceHost() == primary.host && n.replica.sourcePort() == primary.port
+}
+
+func parseNodeAddr(addr, defaultPort string) (string, int, error) {
+	host, port := addr, defaultPort
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %q", addr)
+	}
+	return host, n, nil
+}
+
+func fetchTopologyNode(setting mysqlSetting, addr string) *topologyNode {
+	node := &topologyNode{addr: addr}
+	node.host, node.port, node.err = parseNodeAddr(addr, setting.Port)
+	if node.err != nil {
+		return node
+	}
+	setting.Hosts = []string{node.host}
+	setting.Port = strconv.Itoa(node.port)
+	setting.Socket = ""
+	setting.noSocketProbe = true
+
+	db, err := newDB(setting)
+	if err != nil {
+		node.err = err
+		return node
+	}
+	defer db.Close()
+
+	var readOnly int
+	err = queryRow(db, "SELECT @@global.read_only, @@global.server_uuid", &readOnly, &node.uuid)
+	if err != nil {
+		node.err = err
+		return node
+	}
+	node.readOnly = readOnly != 0
+
+	node.replica, node.err = getReplicaStatus(db)
+	return node
+}
+
+func evaluateTopology(nodes []*topologyNode) (checkers.Status, string) {
+	var (
+		writables   []*topologyNode
+		unreachable []string
+	)
+	for _, n := range nodes {
+		if n.err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%s)", n.addr, n.err))
+			continue
+		}
+		if n.isWritable() {
+			writables = append(writables, n)
+		}
+	}
+
+	if len(writables) > 1 {
+		addrs := make([]string, 0, len(writables))
+		for _, n := range writables {
+			addrs = append(addrs, n.addr)
+		}
+		return checkers.CRITICAL, fmt.Sprintf("split-brain: %d writable servers found: %s", len(writables), strings.Join(addrs, ", "))
+	}
+	if len(writables) == 0 {
+		msg := "no writable primary found"
+		if len(unreachable) > 0 {
+			msg += "; unreachable: " + strings.Join(unreachable, ", ")
+		}
+		return checkers.CRITICAL, msg
+	}
+
+	primary := writables[0]
+	var misconfigured []string
+	replicas := 0
+	for _, n := range nodes {
+		if n.err != nil || n == primary {
+			continue
+		}
+		if n.replica == nil {
+			misconfigured = append(misconfigured, fmt.Sprintf("%s is not a replica", n.addr))
+			continue
+		}
+		if !n.replicatesFrom(primary) {
+			misconfigured = append(misconfigured, fmt.Sprintf("%s replicates from %s:%d", n.addr, n.replica.sourceHost(), n.replica.sourcePort()))
+			continue
+		}
+		replicas++
+	}
+	if len(misconfigured) > 0 {
+		return checkers.CRITICAL, fmt.Sprintf("primary is %s, but %s", primary.addr, strings.Join(misconfigured, ", "))
+	}
+	if len(unreachable) > 0 {
+		return checkers.WARNING, fmt.Sprintf("primary is %s with %d replicas; unreachable: %s", primary.addr, replicas, strings.Join(unreachable, ", "))
+	}
+	return checkers.OK, fmt.Sprintf("primary is %s with %d replicas", primary.addr, replicas)
+}
+
+func checkTopology(args []string) *checkers.Checker {
+	opts := topologyOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "topology [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		checks := make([]selftest.Check, 0, len(opts.Nodes))
+		for _, addr := range opts.Nodes {
+			checks = append(checks, selftest.Resolve(addr))
+		}
+		return selftest.Run(checks...)
+	}
+
+	nodes := make([]*topologyNode, 0, len(opts.Nodes))
+	for _, addr := range opts.Nodes {
+		nodes = append(nodes, fetchTopologyNode(opts.mysqlSetting, addr))
+	}
+	return checkers.NewChecker(evaluateTopology(nodes))
+}
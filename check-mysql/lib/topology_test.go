@@ -0,0 +1,74 @@
+package checkmysql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNodeAddr(t *testing.T) {
+	host, port, err := parseNodeAddr("db1", "3306")
+	assert.Nil(t, err)
+	assert.Equal(t, "db1", host)
+	assert.Equal(t, 3306, port)
+
+	host, port, err = parseNodeAddr("[::1]:13306", "3306")
+	assert.Nil(t, err)
+	assert.Equal(t, "::1", host)
+	assert.Equal(t, 13306, port)
+
+	_, _, err = parseNodeAddr("db1:mysql", "3306")
+	assert.NotNil(t, err)
+}
+
+func TestEvaluateTopology(t *testing.T) {
+	primary := func() *topologyNode {
+		return &topologyNode{addr: "db1:3306", host: "db1", port: 3306, uuid: "uuid-1"}
+	}
+	replicaOf := func(addr, uuid, host string, port int) *topologyNode {
+		return &topologyNode{addr: addr, readOnly: true, replica: &replicationStatus{SourceHost: host, SourcePort: port, SourceUUID: uuid}}
+	}
+
+	tests := []struct {
+		name  string
+		nodes []*topologyNode
+		want  checkers.Status
+	}{
+		{
+			name:  "healthy",
+			nodes: []*topologyNode{primary(), replicaOf("db2:3306", "uuid-1", "10.0.0.1", 3306), replicaOf("db3:3306", "", "db1", 3306)},
+			want:  checkers.OK,
+		},
+		{
+			name:  "split-brain",
+			nodes: []*topologyNode{primary(), {addr: "db2:3306", uuid: "uuid-2"}},
+			want:  checkers.CRITICAL,
+		},
+		{
+			name:  "no primary",
+			nodes: []*topologyNode{replicaOf("db2:3306", "uuid-1", "db1", 3306), {addr: "db1:3306", err: errors.New("connection refused")}},
+			want:  checkers.CRITICAL,
+		},
+		{
+			name:  "replica of another server",
+			nodes: []*topologyNode{primary(), replicaOf("db2:3306", "uuid-9", "db9", 3306)},
+			want:  checkers.CRITICAL,
+		},
+		{
+			name:  "read-only server is not a replica",
+			nodes: []*topologyNode{primary(), {addr: "db2:3306", readOnly: true}},
+			want:  checkers.CRITICAL,
+		},
+		{
+			name:  "unreachable replica",
+			nodes: []*topologyNode{primary(), replicaOf("db2:3306", "uuid-1", "db1", 3306), {addr: "db3:3306", err: errors.New("connection refused")}},
+			want:  checkers.WARNING,
+		},
+	}
+	for _, tt := range tests {
+		st, msg := evaluateTopology(tt.nodes)
+		assert.Equal(t, tt.want, st, tt.name+": "+msg)
+	}
+}
@@ -2,7 +2,6 @@ package checkmysql
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
@@ -28,7 +27,10 @@ func checkUptime(args []string) *checkers.Checker {
 	psr.Usage = "uptime [OPTIONS]"
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return opts.mysqlSetting.selfTest()
 	}
 	db, err := newDB(opts.mysqlSetting)
 	if err != nil {
@@ -40,7 +42,7 @@ func checkUptime(args []string) *checkers.Checker {
 		variableName string
 		upTime       int64
 	)
-	err = db.QueryRow("SHOW GLOBAL STATUS LIKE 'Uptime'").Scan(&variableName, &upTime)
+	err = queryRow(db, "SHOW GLOBAL STATUS LIKE 'Uptime'", &variableName, &upTime)
 	if err != nil {
 		return checkers.Unknown(fmt.Sprintf("Couldn't get 'Uptime' status: %s", err))
 	}
@@ -51,6 +53,8 @@ func checkUptime(args []string) *checkers.Checker {
 		checkSt = checkers.CRITICAL
 	} else if opts.Warn > 0 && upTime < opts.Warn {
 		checkSt = checkers.WARNING
+	} else {
+		msg += fmt.Sprintf(" (%s)", opts.via())
 	}
 	return checkers.NewChecker(checkSt, msg)
 }
@@ -44,6 +44,12 @@ docker cp "test-$plugin:/var/lib/mysql/ca.pem" "$cacert"
 $plugin connection --port $port --password=$password \
 	--tls --tls-root-cert="$cacert" --tls-skip-verify
 status=$?
+if [ $status -eq 0 ]
+then
+	$plugin ssl-expiry --port $port --password=$password \
+		--tls --tls-root-cert="$cacert" --tls-skip-verify
+	status=$?
+fi
 docker stop "test-$plugin"
 docker rm "test-$plugin"
 rm "$cacert"
@@ -84,4 +84,15 @@ if ! $plugin replication --host=127.0.0.1 --port=$replica_port --user=$user --pa
 	exit 1
 fi
 
+if ! $plugin topology --node=127.0.0.1:$primary_port --node=127.0.0.1:$replica_port --user=$user --password=$password; then
+	echo 'FAIL: topology should be OK'
+	exit 1
+fi
+
+if $plugin topology --node=127.0.0.1:$replica_port --user=$user --password=$password; then
+	# the replica is read-only
+	echo 'FAIL: topology without primary should not be OK'
+	exit 1
+fi
+
 echo OK
@@ -15,14 +15,55 @@ import (
 	"github.com/beevik/ntp"
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
-var opts struct {
+type ntpOffsetOpts struct {
 	Crit         float64 `short:"c" long:"critical" default:"100" description:"Critical threshold of ntp offset(ms)"`
 	Warn         float64 `short:"w" long:"warning" default:"50" description:"Warning threshold of ntp offset(ms)"`
 	NTPServers   string  `short:"s" long:"ntp-servers" default:"" description:"Use specified NTP Servers(plural servers can be set separated by ,). When set plural servers, use first response. If not set, use local command just like ntpd/chronyd."`
 	NTPTimeout   int     `short:"t" long:"ntp-timeout" default:"15" description:"Timeout of NTP Server Querying(in seconds)."`
+	Daemon       string  `long:"daemon" choice:"ntpd" choice:"chronyd" description:"Query the NTP daemon with ntpq or chronyc without detecting it from the processes."`
 	CheckStratum bool    `short:"S" long:"check-stratum" description:"Check stratum and fail if the machine is not synchronized."`
+	Verbose      bool    `short:"v" long:"verbose" description:"Show the details of the result such as jitter, stratum, refid and reach."`
+	Refclock     bool    `long:"refclock" description:"Check the reference clocks of the stratum-1 server and fail if they are unreachable or not selected."`
+	PPS          bool    `long:"pps" description:"Check that a PPS reference clock is locked (implies --refclock)."`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// ntpResult is the result parsed from the output of the NTP daemon or the response of NTP servers.
+// Fields which can't be got from the source are left empty.
+type ntpResult struct {
+	// Daemon is the NTP daemon ("ntpd" or "chronyd") or the NTP server which responded.
+	Daemon string
+	// Offset is the offset of the local clock in milliseconds.
+	Offset float64
+	// Jitter is sys_jitter of ntpd, or RMS offset of chronyd, in milliseconds.
+	Jitter  *float64
+	Stratum *int64
+	RefID   string
+	// Reach is the reachability register of the system peer in octal.
+	// It is only got with --verbose.
+	Reach string
+}
+
+func (r *ntpResult) details() string {
+	s := fmt.Sprintf("daemon=%s offset=%fms", r.Daemon, r.Offset)
+	if r.Jitter != nil {
+		s += fmt.Sprintf(" jitter=%fms", *r.Jitter)
+	}
+	if r.Stratum != nil {
+		s += fmt.Sprintf(" stratum=%d", *r.Stratum)
+	}
+	if r.RefID != "" {
+		s += fmt.Sprintf(" refid=%s", r.RefID)
+	}
+	if r.Reach != "" {
+		s += fmt.Sprintf(" reach=%s", r.Reach)
+	}
+	return s
 }
 
 var ntpTimeout int
@@ -33,22 +74,40 @@ func init() {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "NTP"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &ntpOffsetOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
+	opts.DebugOpts.Enable()
 	ntpTimeout = opts.NTPTimeout
+	checkRefclock := opts.Refclock || opts.PPS
+	if checkRefclock && opts.NTPServers != "" {
+		return checkers.Unknown("--refclock and --pps can't be used with --ntp-servers")
+	}
+	if opts.SelfTest {
+		return selfTest(opts.NTPServers, opts.Daemon)
+	}
 
-	offset, err := getNTPOffset(opts.NTPServers, opts.CheckStratum)
+	res, err := getNTPOffset(opts.NTPServers, opts.Daemon, opts.CheckStratum, opts.Verbose)
 	if err != nil {
+		if opts.Verbose && res != nil {
+			return checkers.Unknown(err.Error() + "\n" + res.details())
+		}
 		return checkers.Unknown(err.Error())
 	}
+	offset := res.Offset
 
 	var chkSt checkers.Status
 	var msg string
@@ -62,11 +121,29 @@ func run(args []string) *checkers.Checker {
 		msg = fmt.Sprintf("ntp offset is %f(actual) < %f(warning threshold), %f(critial threshold)", math.Abs(offset), opts.Warn, opts.Crit)
 		chkSt = checkers.OK
 	}
+	if checkRefclock {
+		clocks, err := getRefclocks(res.Daemon)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		st, msgs := evaluateRefclocks(clocks, opts.PPS)
+		if st > chkSt {
+			chkSt = st
+		}
+		if len(msgs) > 0 {
+			msg += ", " + strings.Join(msgs, ", ")
+		}
+	}
+	if opts.Verbose {
+		msg += "\n" + res.details()
+	}
 
 	return checkers.NewChecker(chkSt, msg)
 }
 
-func withCmd(cmd *exec.Cmd, fn func(io.Reader) error) error {
+func withCmd(cmd *exec.Cmd, fn func(io.Reader) error) (err error) {
+	end := debuglog.Trace("exec: %s", debuglog.Command(cmd.Args[0], cmd.Args[1:]))
+	defer func() { end(err) }()
 	out, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -88,11 +165,61 @@ const (
 	cmdChronyc = "chronyc"
 )
 
+var daemonCommands = map[string]string{
+	ntpNTPD:    cmdNTPq,
+	ntpChronyd: cmdChronyc,
+}
+
 func hasCommand(cmd string) bool {
 	_, err := exec.LookPath(cmd)
 	return err == nil
 }
 
+// sysRoot is the root dir of the files read to detect containers; it is replaced in tests.
+var sysRoot = "/"
+
+var errIsolatedContainer = fmt.Errorf("running in a container without the host PID namespace, where the ntp daemon of the host can't be detected; specify --daemon with access to the daemon, or --ntp-servers")
+
+// inContainer reports whether the plugin runs in a container such as Docker, Podman and Kubernetes.
+func inContainer() bool {
+	if os.Getenv("container") != "" {
+		return true
+	}
+	for _, f := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := os.Stat(filepath.Join(sysRoot, f)); err == nil {
+			return true
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(sysRoot, "proc/1/cgroup"))
+	if err != nil {
+		return false
+	}
+	for _, s := range []string{"docker", "kubepods", "containerd", "libpod", "lxc"} {
+		if strings.Contains(string(b), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isolatedContainer reports whether the plugin runs in a container which doesn't share the PID namespace with the host.
+// ps doesn't show the ntp daemon of the host there, so that the detection reports the daemon in the container
+// or nothing, which is misleading. PID 1 is the init of the host if the namespace is shared.
+func isolatedContainer() bool {
+	if !inContainer() {
+		return false
+	}
+	comm, err := os.ReadFile(filepath.Join(sysRoot, "proc/1/comm"))
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(string(comm)) {
+	case "systemd", "init":
+		return false
+	}
+	return true
+}
+
 func detectNTPDname() (ntpdName string, err error) {
 	err = withCmd(exec.Command("ps", "-eo", "comm"), func(out io.Reader) error {
 		scr := bufio.NewScanner(out)
@@ -115,39 +242,85 @@ func detectNTPDname() (ntpdName string, err error) {
 	return ntpdName, err
 }
 
-func getNTPOffset(ntpServers string, checkStratum bool) (float64, error) {
+// selfTest validates that the NTP servers can be resolved, or a supported ntp daemon is running.
+func selfTest(ntpServers, daemon string) *checkers.Checker {
+	if ntpServers == "" && daemon != "" {
+		return selftest.Run(selftest.Executable(daemonCommands[daemon]))
+	}
+	if ntpServers == "" {
+		return selftest.Run(func() error {
+			if isolatedContainer() {
+				return errIsolatedContainer
+			}
+			_, err := detectNTPDname()
+			return err
+		})
+	}
+	var checks []selftest.Check
+	for _, ntpServer := range strings.Split(ntpServers, ",") {
+		checks = append(checks, selftest.Resolve(strings.Trim(ntpServer, " ")))
+	}
+	return selftest.Run(checks...)
+}
+
+func getNTPOffset(ntpServers, daemon string, checkStratum, withReach bool) (*ntpResult, error) {
 	if ntpServers != "" {
 		return getNTPOffsetFromNTPServers(ntpServers)
 	}
 
-	ntpdName, err := detectNTPDname()
-	if err != nil {
-		return 0.0, err
+	ntpdName := daemon
+	if ntpdName == "" {
+		if isolatedContainer() {
+			return nil, errIsolatedContainer
+		}
+		var err error
+		ntpdName, err = detectNTPDname()
+		if err != nil {
+			return nil, err
+		}
 	}
 	switch ntpdName {
 	case ntpNTPD:
-		return getNTPOffsetFromNTPD(checkStratum)
+		return getNTPOffsetFromNTPD(checkStratum, withReach)
 	case ntpChronyd:
-		return getNTPOffsetFromChrony(checkStratum)
+		return getNTPOffsetFromChrony(checkStratum, withReach)
 	}
-	return 0.0, fmt.Errorf("unsupported ntp daemon %q", ntpdName)
+	return nil, fmt.Errorf("unsupported ntp daemon %q", ntpdName)
+}
+
+// formatRefID formats the reference ID in the NTP packet as ntpq does.
+// It is the ASCII code of the reference clock for stratum 0 and 1, and the IPv4 address (or the hash of the IPv6 address) for others.
+func formatRefID(refID uint32, stratum uint8) string {
+	b := []byte{byte(refID >> 24), byte(refID >> 16), byte(refID >> 8), byte(refID)}
+	if stratum <= 1 {
+		return "." + strings.TrimRight(string(b), "\x00") + "."
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", b[0], b[1], b[2], b[3])
 }
 
 // getNTPOffsetFromNTPServers ask time to ntp servers and return NTP Offset.
 // Use first response, ignore others
 //
 // FIXME need fluent cancel mechanism
-func getNTPOffsetFromNTPServers(ntpServers string) (offset float64, err error) {
-	resultChan := make(chan float64)
+func getNTPOffsetFromNTPServers(ntpServers string) (*ntpResult, error) {
+	resultChan := make(chan *ntpResult)
 	for _, ntpServer := range strings.Split(ntpServers, ",") {
 		go func(ntpServer string) error {
 			ntpServer = strings.Trim(ntpServer, " ")
 			options := ntp.QueryOptions{Timeout: time.Duration(ntpTimeout) * time.Second}
+			end := debuglog.Trace("ntp: query %s", ntpServer)
 			response, err := ntp.QueryWithOptions(ntpServer, options)
+			end(err)
 			if err != nil {
 				return err
 			}
-			resultChan <- float64(response.ClockOffset / time.Millisecond)
+			stratum := int64(response.Stratum)
+			resultChan <- &ntpResult{
+				Daemon:  ntpServer,
+				Offset:  float64(response.ClockOffset / time.Millisecond),
+				Stratum: &stratum,
+				RefID:   formatRefID(response.ReferenceID, response.Stratum),
+			}
 			return nil
 		}(ntpServer)
 	}
@@ -155,100 +328,169 @@ func getNTPOffsetFromNTPServers(ntpServers string) (offset float64, err error) {
 	select {
 	case <-time.After(time.Duration(ntpTimeout) * time.Second):
 		// return error only when all NTPServers are failed
-		return 0.0, fmt.Errorf("NTP offset cannot get from %q", ntpServers)
-	case offset = <-resultChan:
-		return offset, nil
+		return nil, fmt.Errorf("NTP offset cannot get from %q", ntpServers)
+	case res := <-resultChan:
+		return res, nil
 	}
 }
 
-func getNTPOffsetFromNTPD(checkStratum bool) (offset float64, err error) {
-	err = withCmd(exec.Command(cmdNTPq, "-c", "rv 0 stratum,offset"), func(out io.Reader) error {
-		offset, err = parseNTPOffsetFromNTPD(out, checkStratum)
+func getNTPOffsetFromNTPD(checkStratum, withReach bool) (res *ntpResult, err error) {
+	err = withCmd(exec.Command(cmdNTPq, "-c", "rv 0"), func(out io.Reader) error {
+		res, err = parseNTPOffsetFromNTPD(out, checkStratum)
 		return err
 	})
-	return offset, err
+	// reach is only for the details, so the error is ignored
+	if res != nil && withReach {
+		withCmd(exec.Command(cmdNTPq, "-pn"), func(out io.Reader) error {
+			res.Reach = parseReach(out, "*", 7)
+			return nil
+		})
+	}
+	return res, err
 }
 
-func parseNTPOffsetFromNTPD(out io.Reader, checkStratum bool) (float64, error) {
+// parseNTPOffsetFromNTPD parses the output of `ntpq -c "rv 0"`.
+// The result is returned with the error when the machine is not synchronized.
+func parseNTPOffsetFromNTPD(out io.Reader, checkStratum bool) (*ntpResult, error) {
 	scr := bufio.NewScanner(out)
 	const stratumPrefix = "stratum="
 	const offsetPrefix = "offset="
+	const refIDPrefix = "refid="
+	// ntpd before 4.2.4 calls it jitter
+	jitterPrefixes := []string{"sys_jitter=", "jitter="}
+	res := &ntpResult{Daemon: ntpNTPD}
 	var offset *float64
 	for scr.Scan() {
 		line := scr.Text()
 		for _, column := range strings.Split(line, ",") {
-			column = strings.TrimPrefix(column, " ")
-			if checkStratum && strings.HasPrefix(column, stratumPrefix) {
+			column = strings.TrimSpace(column)
+			switch {
+			case res.Stratum == nil && strings.HasPrefix(column, stratumPrefix):
 				stratum, err := strconv.ParseInt(strings.TrimPrefix(column, stratumPrefix), 10, 64)
 				if err != nil {
-					return 0.0, err
-				}
-				// stratum == 16 means that the machine is unsynchronized.
-				// ref. https://support.ntp.org/bin/view/Support/TroubleshootingNTP
-				if stratum == 16 {
-					return 0.0, fmt.Errorf("not synchronized to stratum")
+					return nil, err
 				}
-			}
-			if offset == nil && strings.HasPrefix(column, offsetPrefix) {
+				res.Stratum = &stratum
+			case offset == nil && strings.HasPrefix(column, offsetPrefix):
 				offsetMillis, err := strconv.ParseFloat(strings.TrimPrefix(column, offsetPrefix), 64)
 				if err != nil {
-					return 0.0, err
+					return nil, err
 				}
 				offset = &offsetMillis
+			case res.RefID == "" && strings.HasPrefix(column, refIDPrefix):
+				res.RefID = strings.TrimPrefix(column, refIDPrefix)
+			case res.Jitter == nil:
+				for _, p := range jitterPrefixes {
+					if strings.HasPrefix(column, p) {
+						if jitter, err := strconv.ParseFloat(strings.TrimPrefix(column, p), 64); err == nil {
+							res.Jitter = &jitter
+						}
+					}
+				}
 			}
 		}
 	}
 	if offset == nil {
-		return 0.0, fmt.Errorf("failed to get ntp offset")
+		return nil, fmt.Errorf("failed to get ntp offset")
 	}
-	return *offset, nil
+	res.Offset = *offset
+	// stratum == 16 means that the machine is unsynchronized.
+	// ref. https://support.ntp.org/bin/view/Support/TroubleshootingNTP
+	if checkStratum && res.Stratum != nil && *res.Stratum == 16 {
+		return res, fmt.Errorf("not synchronized to stratum")
+	}
+	return res, nil
 }
 
-func getNTPOffsetFromChrony(checkStratum bool) (offset float64, err error) {
+func getNTPOffsetFromChrony(checkStratum, withReach bool) (res *ntpResult, err error) {
 	err = withCmd(exec.Command(cmdChronyc, "tracking"), func(out io.Reader) error {
-		offset, err = parseNTPOffsetFromChrony(out, checkStratum)
+		res, err = parseNTPOffsetFromChrony(out, checkStratum)
 		return err
 	})
-	return offset, err
+	// reach is only for the details, so the error is ignored
+	if res != nil && withReach {
+		withCmd(exec.Command(cmdChronyc, "-n", "sources"), func(out io.Reader) error {
+			res.Reach = parseReach(out, "^*", 4)
+			return nil
+		})
+	}
+	return res, err
 }
 
-func parseNTPOffsetFromChrony(out io.Reader, checkStratum bool) (float64, error) {
+// parseNTPOffsetFromChrony parses the output of `chronyc tracking`.
+// The result is returned with the error when the machine is not synchronized.
+func parseNTPOffsetFromChrony(out io.Reader, checkStratum bool) (*ntpResult, error) {
 	scr := bufio.NewScanner(out)
 	const stratumPrefix = "Stratum"
 	const offsetPrefix = "Last offset"
+	const rmsOffsetPrefix = "RMS offset"
+	const refIDPrefix = "Reference ID"
+	res := &ntpResult{Daemon: ntpChronyd}
 	var offset *float64
 	for scr.Scan() {
 		line := scr.Text()
-		if checkStratum && strings.HasPrefix(line, stratumPrefix) {
+		switch {
+		case res.Stratum == nil && strings.HasPrefix(line, stratumPrefix):
 			flds := strings.Fields(line)
 			if len(flds) != 3 {
-				return 0.0, fmt.Errorf("failed to get ntp stratum")
+				return nil, fmt.Errorf("failed to get ntp stratum")
 			}
 			stratum, err := strconv.ParseInt(flds[2], 10, 64)
 			if err != nil {
-				return 0.0, err
+				return nil, err
 			}
-			// stratum == 0 means that the machine is unsynchronized.
-			// Actually this can be the best case, but that would be rare...
-			if stratum == 0 {
-				return 0.0, fmt.Errorf("not synchronized to stratum")
-			}
-		}
-		if offset == nil && strings.HasPrefix(line, offsetPrefix) {
+			res.Stratum = &stratum
+		case offset == nil && strings.HasPrefix(line, offsetPrefix):
 			flds := strings.Fields(line)
 			if len(flds) != 5 {
-				return 0.0, fmt.Errorf("failed to get ntp offset")
+				return nil, fmt.Errorf("failed to get ntp offset")
 			}
 			offsetSeconds, err := strconv.ParseFloat(flds[3], 64)
 			if err != nil {
-				return 0.0, err
+				return nil, err
 			}
 			offsetMillis := offsetSeconds * 1000
 			offset = &offsetMillis
+		case res.Jitter == nil && strings.HasPrefix(line, rmsOffsetPrefix):
+			flds := strings.Fields(line)
+			if len(flds) == 5 {
+				if rmsSeconds, err := strconv.ParseFloat(flds[3], 64); err == nil {
+					rmsMillis := rmsSeconds * 1000
+					res.Jitter = &rmsMillis
+				}
+			}
+		case res.RefID == "" && strings.HasPrefix(line, refIDPrefix):
+			if i := strings.Index(line, ":"); i >= 0 {
+				res.RefID = strings.TrimSpace(line[i+1:])
+			}
 		}
 	}
 	if offset == nil {
-		return 0.0, fmt.Errorf("failed to get ntp offset")
+		return nil, fmt.Errorf("failed to get ntp offset")
+	}
+	res.Offset = *offset
+	// stratum == 0 means that the machine is unsynchronized.
+	// Actually this can be the best case, but that would be rare...
+	if checkStratum && res.Stratum != nil && *res.Stratum == 0 {
+		return res, fmt.Errorf("not synchronized to stratum")
+	}
+	return res, nil
+}
+
+// parseReach returns the reach column of the system peer in the output of `ntpq -pn` or `chronyc -n sources`.
+// The line of the system peer starts with the prefix, and the reach is the idx-th field.
+func parseReach(out io.Reader, prefix string, idx int) string {
+	scr := bufio.NewScanner(out)
+	for scr.Scan() {
+		line := scr.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		// ntpq may not put a space between the tally code and the address
+		flds := strings.Fields(prefix + " " + strings.TrimPrefix(line, prefix))
+		if len(flds) > idx {
+			return flds[idx]
+		}
 	}
-	return *offset, nil
+	return ""
 }
@@ -1,6 +1,8 @@
 package checkntpoffset
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -74,7 +76,7 @@ Leap status     : Not synchronised
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			offset, err := parseNTPOffsetFromChrony(strings.NewReader(tc.input), tc.checkStratum)
+			res, err := parseNTPOffsetFromChrony(strings.NewReader(tc.input), tc.checkStratum)
 			if tc.expectError != "" {
 				if err == nil {
 					t.Error("error should not be nil")
@@ -86,8 +88,8 @@ Leap status     : Not synchronised
 				if err != nil {
 					t.Fatalf("error should be nil but got: %v", err)
 				}
-				if offset != tc.expect {
-					t.Errorf("invalid offset: %f (expected: %f)", offset, tc.expect)
+				if res.Offset != tc.expect {
+					t.Errorf("invalid offset: %f (expected: %f)", res.Offset, tc.expect)
 				}
 			}
 		})
@@ -148,7 +150,7 @@ stratum=16, offset=0.000
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			offset, err := parseNTPOffsetFromNTPD(strings.NewReader(tc.input), tc.checkStratum)
+			res, err := parseNTPOffsetFromNTPD(strings.NewReader(tc.input), tc.checkStratum)
 			if tc.expectError != "" {
 				if err == nil {
 					t.Error("error should not be nil")
@@ -160,10 +162,123 @@ stratum=16, offset=0.000
 				if err != nil {
 					t.Fatalf("error should be nil but got: %v", err)
 				}
-				if offset != tc.expect {
-					t.Errorf("invalid offset: %f (expected: %f)", offset, tc.expect)
+				if res.Offset != tc.expect {
+					t.Errorf("invalid offset: %f (expected: %f)", res.Offset, tc.expect)
 				}
 			}
 		})
 	}
 }
+
+func TestParseNTPDetails(t *testing.T) {
+	chrony := `Reference ID    : A0104BF2 (sv01.azsx.net)
+Stratum         : 3
+Ref time (UTC)  : Thu May  4 11:51:30 2017
+System time     : 0.000033190 seconds slow of NTP time
+Last offset     : +0.000003614 seconds
+RMS offset      : 0.000017540 seconds
+Leap status     : Normal
+`
+	res, err := parseNTPOffsetFromChrony(strings.NewReader(chrony), true)
+	if err != nil {
+		t.Fatalf("error should be nil but got: %v", err)
+	}
+	res.Reach = parseReach(strings.NewReader(`MS Name/IP address         Stratum Poll Reach LastRx Last sample
+===============================================================================
+^- 192.0.2.1                     2   6   377    34   +120us[ +120us] +/-   15ms
+^* 192.0.2.2                     2   6   377    33    +12us[  +15us] +/-   20ms
+`), "^*", 4)
+	expect := "daemon=chronyd offset=0.003614ms jitter=0.017540ms stratum=3 refid=A0104BF2 (sv01.azsx.net) reach=377"
+	if d := res.details(); d != expect {
+		t.Errorf("unexpected details: %s (expected: %s)", d, expect)
+	}
+
+	ntpd := `associd=0 status=0615 leap_none, sync_ntp, 1 event, clock_sync,
+version="ntpd 4.2.8p15@1.3728-o", processor="x86_64", system="Linux",
+leap=00, stratum=2, precision=-24, rootdelay=1.282, rootdisp=21.469,
+refid=192.0.2.2,
+reftime=e3a5b2a1.2f5c8f6a  Thu, Jan  7 2021  1:02:03.185,
+clock=e3a5b2f0.1b3c4d5e  Thu, Jan  7 2021  1:03:28.106, peer=12345, tc=6,
+mintc=3, offset=-0.158, frequency=-12.345, sys_jitter=0.213,
+clk_jitter=0.101, clk_wander=0.004
+`
+	res, err = parseNTPOffsetFromNTPD(strings.NewReader(ntpd), true)
+	if err != nil {
+		t.Fatalf("error should be nil but got: %v", err)
+	}
+	res.Reach = parseReach(strings.NewReader(`     remote           refid      st t when poll reach   delay   offset  jitter
+==============================================================================
++192.0.2.1       .GPS.            1 u   34   64  377    1.203   -0.120   0.101
+*192.0.2.2       .PPS.            1 u   33   64  177    1.282   -0.158   0.213
+`), "*", 7)
+	expect = "daemon=ntpd offset=-0.158000ms jitter=0.213000ms stratum=2 refid=192.0.2.2 reach=177"
+	if d := res.details(); d != expect {
+		t.Errorf("unexpected details: %s (expected: %s)", d, expect)
+	}
+}
+
+func TestFormatRefID(t *testing.T) {
+	if s := formatRefID(0x47505300, 1); s != ".GPS." {
+		t.Errorf("unexpected refid: %s", s)
+	}
+	if s := formatRefID(0xC0000202, 2); s != "192.0.2.2" {
+		t.Errorf("unexpected refid: %s", s)
+	}
+}
+
+func TestIsolatedContainer(t *testing.T) {
+	orig := sysRoot
+	defer func() { sysRoot = orig }()
+	if v, ok := os.LookupEnv("container"); ok {
+		os.Unsetenv("container")
+		defer os.Setenv("container", v)
+	}
+
+	write := func(root, name, content string) {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected bool
+	}{
+		{
+			name:     "host",
+			files:    map[string]string{"proc/1/cgroup": "0::/init.scope\n", "proc/1/comm": "systemd\n"},
+			expected: false,
+		},
+		{
+			name:     "docker",
+			files:    map[string]string{".dockerenv": "", "proc/1/cgroup": "0::/\n", "proc/1/comm": "sh\n"},
+			expected: true,
+		},
+		{
+			name:     "kubernetes with cgroup v1",
+			files:    map[string]string{"proc/1/cgroup": "12:cpu,cpuacct:/kubepods/besteffort/pod1234/abcd\n", "proc/1/comm": "pause\n"},
+			expected: true,
+		},
+		{
+			name:     "docker with --pid=host",
+			files:    map[string]string{".dockerenv": "", "proc/1/cgroup": "0::/init.scope\n", "proc/1/comm": "systemd\n"},
+			expected: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sysRoot = t.TempDir()
+			for name, content := range tc.files {
+				write(sysRoot, name, content)
+			}
+			if got := isolatedContainer(); got != tc.expected {
+				t.Errorf("isolatedContainer() = %t (expected: %t)", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package checkntpoffset
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// refclock is a reference clock, such as GPS and PPS, of a stratum-1 server,
+// parsed from `ntpq -pn` or `chronyc -n sources`.
+type refclock struct {
+	Name string
+	// Reach is the reachability register; the lowest bit is the last poll.
+	Reach int64
+	// Selected reports whether the clock is the system peer (or the PPS peer of ntpd).
+	Selected bool
+	// Used reports whether the clock is selected or combined with the system peer.
+	Used bool
+	PPS  bool
+}
+
+func getRefclocks(daemon string) (clocks []refclock, err error) {
+	switch daemon {
+	case ntpNTPD:
+		err = withCmd(exec.Command(cmdNTPq, "-pn"), func(out io.Reader) error {
+			clocks, err = parseRefclocksFromNTPD(out)
+			return err
+		})
+	case ntpChronyd:
+		err = withCmd(exec.Command(cmdChronyc, "-n", "sources"), func(out io.Reader) error {
+			clocks, err = parseRefclocksFromChrony(out)
+			return err
+		})
+	default:
+		err = fmt.Errorf("reference clocks can't be got from %s", daemon)
+	}
+	return clocks, err
+}
+
+// parseRefclocksFromNTPD parses the output of `ntpq -pn`.
+// The reference clocks are the peers of the type "l" (local), whose address is 127.127.t.u,
+// or the name such as SHM(0) in NTPsec. The first character of the line is the tally code.
+func parseRefclocksFromNTPD(out io.Reader) ([]refclock, error) {
+	scr := bufio.NewScanner(out)
+	var clocks []refclock
+	for scr.Scan() {
+		line := scr.Text()
+		if len(line) < 2 {
+			continue
+		}
+		// remote refid st t when poll reach delay offset jitter
+		flds := strings.Fields(line[1:])
+		if len(flds) < 7 || flds[3] != "l" {
+			continue
+		}
+		reach, err := strconv.ParseInt(flds[6], 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse reach of %s: %s", flds[0], err)
+		}
+		tally := line[0]
+		clocks = append(clocks, refclock{
+			Name:     fmt.Sprintf("%s(%s)", flds[0], flds[1]),
+			Reach:    reach,
+			Selected: tally == '*' || tally == 'o',
+			Used:     tally == '*' || tally == 'o' || tally == '+',
+			// the type 22 is the PPS driver
+			PPS: strings.Contains(flds[1], "PPS") || strings.HasPrefix(flds[0], "127.127.22.") || tally == 'o',
+		})
+	}
+	return clocks, scr.Err()
+}
+
+// parseRefclocksFromChrony parses the output of `chronyc -n sources`.
+// The reference clocks are the sources of the mode "#", followed by the state.
+func parseRefclocksFromChrony(out io.Reader) ([]refclock, error) {
+	scr := bufio.NewScanner(out)
+	var clocks []refclock
+	for scr.Scan() {
+		line := scr.Text()
+		if len(line) < 2 || line[0] != '#' {
+			continue
+		}
+		// name stratum poll reach lastrx last-sample
+		flds := strings.Fields(line[2:])
+		if len(flds) < 4 {
+			continue
+		}
+		reach, err := strconv.ParseInt(flds[3], 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse reach of %s: %s", flds[0], err)
+		}
+		state := line[1]
+		clocks = append(clocks, refclock{
+			Name:     flds[0],
+			Reach:    reach,
+			Selected: state == '*',
+			Used:     state == '*' || state == '+',
+			PPS:      strings.Contains(strings.ToUpper(flds[0]), "PPS"),
+		})
+	}
+	return clocks, scr.Err()
+}
+
+// evaluateRefclocks checks that the reference clocks are reachable and one of them is selected,
+// since the server keeps serving the time free-running when its GPS antenna is dead.
+func evaluateRefclocks(clocks []refclock, requirePPS bool) (checkers.Status, []string) {
+	if len(clocks) == 0 {
+		return checkers.CRITICAL, []string{"no reference clocks are configured"}
+	}
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(st checkers.Status, msg string) {
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+	}
+	var selected, ppsConfigured, ppsLocked bool
+	for _, c := range clocks {
+		switch {
+		case c.Reach == 0:
+			raise(checkers.CRITICAL, fmt.Sprintf("refclock %s is unreachable (reach=0)", c.Name))
+		case c.Reach&1 == 0:
+			raise(checkers.WARNING, fmt.Sprintf("refclock %s missed the last poll (reach=%o)", c.Name, c.Reach))
+		}
+		if c.Selected {
+			selected = true
+		}
+		if c.PPS {
+			ppsConfigured = true
+			if c.Used && c.Reach != 0 {
+				ppsLocked = true
+			}
+		}
+	}
+	if !selected {
+		raise(checkers.CRITICAL, "no refclock is selected as the system peer")
+	}
+	if requirePPS {
+		switch {
+		case !ppsConfigured:
+			raise(checkers.CRITICAL, "no PPS refclock is configured")
+		case !ppsLocked:
+			raise(checkers.CRITICAL, "PPS is not locked")
+		}
+	}
+	return checkSt, msgs
+}
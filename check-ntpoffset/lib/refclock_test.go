@@ -0,0 +1,119 @@
+package checkntpoffset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestParseRefclocksFromNTPD(t *testing.T) {
+	input := `     remote           refid      st t when poll reach   delay   offset  jitter
+==============================================================================
+o127.127.22.0    .PPS.            0 l    3   16  377    0.000   -0.002   0.001
+*127.127.20.0    .GPS.            0 l    5   16  376    0.000    0.003   0.004
++SHM(1)          .SHM.            0 l    9   16    0    0.000    0.000   0.000
+-192.0.2.1       .GPS.            1 u   33   64  377    1.234    0.012   0.020
+`
+	clocks, err := parseRefclocksFromNTPD(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []refclock{
+		{Name: "127.127.22.0(.PPS.)", Reach: 0377, Selected: true, Used: true, PPS: true},
+		{Name: "127.127.20.0(.GPS.)", Reach: 0376, Selected: true, Used: true},
+		{Name: "SHM(1)(.SHM.)", Reach: 0, Used: true},
+	}
+	if !reflect.DeepEqual(clocks, expect) {
+		t.Errorf("got %+v, expect %+v", clocks, expect)
+	}
+}
+
+func TestParseRefclocksFromChrony(t *testing.T) {
+	input := `MS Name/IP address         Stratum Poll Reach LastRx Last sample
+===============================================================================
+#* GPS                           0   4   377    12   +123ns[ +234ns] +/-  100ns
+#? PPS0                          0   4     0   10y     +0ns[   +0ns] +/-    0ns
+^- 192.0.2.1                     1   6   377    33    +12us[  +12us] +/-  500us
+`
+	clocks, err := parseRefclocksFromChrony(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []refclock{
+		{Name: "GPS", Reach: 0377, Selected: true, Used: true},
+		{Name: "PPS0", Reach: 0, PPS: true},
+	}
+	if !reflect.DeepEqual(clocks, expect) {
+		t.Errorf("got %+v, expect %+v", clocks, expect)
+	}
+}
+
+func TestEvaluateRefclocks(t *testing.T) {
+	testCases := []struct {
+		name       string
+		clocks     []refclock
+		requirePPS bool
+		expect     checkers.Status
+		msgs       []string
+	}{
+		{
+			name: "locked",
+			clocks: []refclock{
+				{Name: "GPS", Reach: 0377, Selected: true, Used: true},
+				{Name: "PPS", Reach: 0377, Used: true, PPS: true},
+			},
+			requirePPS: true,
+			expect:     checkers.OK,
+		},
+		{
+			name:   "no refclocks",
+			expect: checkers.CRITICAL,
+			msgs:   []string{"no reference clocks are configured"},
+		},
+		{
+			name: "missed the last poll",
+			clocks: []refclock{
+				{Name: "GPS", Reach: 0376, Selected: true, Used: true},
+			},
+			expect: checkers.WARNING,
+			msgs:   []string{"refclock GPS missed the last poll (reach=376)"},
+		},
+		{
+			name: "dead antenna",
+			clocks: []refclock{
+				{Name: "GPS", Reach: 0},
+				{Name: "PPS", Reach: 0, PPS: true},
+			},
+			requirePPS: true,
+			expect:     checkers.CRITICAL,
+			msgs: []string{
+				"refclock GPS is unreachable (reach=0)",
+				"refclock PPS is unreachable (reach=0)",
+				"no refclock is selected as the system peer",
+				"PPS is not locked",
+			},
+		},
+		{
+			name: "no PPS",
+			clocks: []refclock{
+				{Name: "GPS", Reach: 0377, Selected: true, Used: true},
+			},
+			requirePPS: true,
+			expect:     checkers.CRITICAL,
+			msgs:       []string{"no PPS refclock is configured"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st, msgs := evaluateRefclocks(tc.clocks, tc.requirePPS)
+			if st != tc.expect {
+				t.Errorf("status: got %s, expect %s", st, tc.expect)
+			}
+			if !reflect.DeepEqual(msgs, tc.msgs) {
+				t.Errorf("messages: got %q, expect %q", msgs, tc.msgs)
+			}
+		})
+	}
+}
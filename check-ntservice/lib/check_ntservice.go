@@ -7,19 +7,24 @@ import (
 
 	flags "github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
-var opts struct {
+type ntServiceOpts struct {
 	ServiceName    string `long:"service-name" short:"s" description:"service name"`
 	ExcludeService string `long:"exclude-service" short:"x" description:"service name to exclude from matching. This option takes precedence over --service-name"`
 	ListService    bool   `long:"list-service" short:"l" description:"list service"`
+	AutoStart      bool   `long:"auto-start" description:"critical if the start type of the service is not automatic"`
+	Dependencies   bool   `long:"dependencies" description:"critical if any of the services the service depends on, directly or indirectly, is not running"`
+	selftest.SelfTestOpts
 }
 
 // Win32Service is struct for Win32_Service.
 type Win32Service struct {
-	Caption string
-	Name    string
-	State   string
+	Caption   string
+	Name      string
+	State     string
+	StartMode string
 }
 
 // Do the plugin
@@ -30,28 +35,32 @@ func Do() {
 }
 
 var getServiceStateFunc = getServiceState
+var getDependenciesFunc = getDependencies
 
 func run(args []string) *checkers.Checker {
+	var opts ntServiceOpts
 	var parser = flags.NewParser(&opts, flags.Default)
 	_, err := parser.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Required("--service-name", opts.ServiceName))
 	}
 
 	ss, err := getServiceStateFunc()
 	if opts.ListService {
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			return checkers.Unknown(err.Error())
 		}
 		for _, s := range ss {
 			fmt.Printf("%s: %s\n", s.Name, s.Caption)
 		}
-		os.Exit(0)
+		return checkers.Ok(fmt.Sprintf("%d services", len(ss)))
 	}
 	if opts.ServiceName == "" {
 		parser.WriteHelp(os.Stderr)
-		os.Exit(1)
+		return checkers.Unknown("--service-name is required")
 	}
 
 	if err != nil {
@@ -67,13 +76,65 @@ func run(args []string) *checkers.Checker {
 		if !strings.Contains(s.Name, opts.ServiceName) {
 			continue
 		}
-		if s.State == "Running" {
+		var problems []string
+		if s.State != "Running" {
+			problems = append(problems, s.State)
+		}
+		if opts.AutoStart && s.StartMode != "Auto" {
+			problems = append(problems, fmt.Sprintf("start type is %s", s.StartMode))
+		}
+		if opts.Dependencies {
+			chain, err := brokenDependency(s.Name)
+			if err != nil {
+				return checkers.Unknown(err.Error())
+			}
+			if len(chain) > 0 {
+				names := make([]string, len(chain))
+				for i, d := range chain {
+					names[i] = d.Name
+				}
+				problems = append(problems, fmt.Sprintf("dependency %s is %s", strings.Join(names, " -> "), chain[len(chain)-1].State))
+			}
+		}
+		if len(problems) == 0 {
 			continue
 		}
 		checkSt = checkers.CRITICAL
-		msg = fmt.Sprintf("%s: %s - %s", s.Name, s.Caption, s.State)
+		msg = fmt.Sprintf("%s: %s - %s", s.Name, s.Caption, strings.Join(problems, ", "))
 		break
 	}
 
 	return checkers.NewChecker(checkSt, msg)
 }
+
+// brokenDependency returns the chain of the dependencies from the service to the first one which is not running,
+// or nil if all of them are running. The dependencies are walked in the declared order, depth first.
+func brokenDependency(name string) ([]Win32Service, error) {
+	visited := map[string]bool{strings.ToLower(name): true}
+	var walk func(name string) ([]Win32Service, error)
+	walk = func(name string) ([]Win32Service, error) {
+		deps, err := getDependenciesFunc(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deps {
+			// service names are case-insensitive
+			if visited[strings.ToLower(d.Name)] {
+				continue
+			}
+			visited[strings.ToLower(d.Name)] = true
+			if d.State != "Running" {
+				return []Win32Service{d}, nil
+			}
+			chain, err := walk(d.Name)
+			if err != nil {
+				return nil, err
+			}
+			if chain != nil {
+				return append([]Win32Service{d}, chain...), nil
+			}
+		}
+		return nil, nil
+	}
+	return walk(name)
+}
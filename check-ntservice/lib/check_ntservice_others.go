@@ -9,3 +9,7 @@ import (
 func getServiceState() ([]Win32Service, error) {
 	return nil, syscall.ENOSYS
 }
+
+func getDependencies(name string) ([]Win32Service, error) {
+	return nil, syscall.ENOSYS
+}
@@ -1,6 +1,7 @@
 package checkntservice
 
 import (
+	"errors"
 	"os/exec"
 	"runtime"
 	"syscall"
@@ -23,21 +24,64 @@ func startFaxService() error {
 func mockServiceState() {
 	getServiceStateFunc = func() ([]Win32Service, error) {
 		runningService := Win32Service{
-			Caption: "running-service-caption",
-			Name:    "running-service-name",
-			State:   "Running",
+			Caption:   "running-service-caption",
+			Name:      "running-service-name",
+			State:     "Running",
+			StartMode: "Auto",
 		}
 		stoppedService := Win32Service{
-			Caption: "stopped-service-caption",
-			Name:    "stopped-service-name",
-			State:   "Stopped",
+			Caption:   "stopped-service-caption",
+			Name:      "stopped-service-name",
+			State:     "Stopped",
+			StartMode: "Manual",
+		}
+		dependentService := Win32Service{
+			Caption:   "dependent-service-caption",
+			Name:      "dependent-service-name",
+			State:     "Running",
+			StartMode: "Manual",
+		}
+		unqueryableService := Win32Service{
+			Caption:   "unqueryable-service-caption",
+			Name:      "unqueryable-service-name",
+			State:     "Running",
+			StartMode: "Auto",
 		}
 		ss := []Win32Service{
 			runningService,
 			stoppedService,
+			dependentService,
+			unqueryableService,
 		}
 		return ss, nil
 	}
+	getDependenciesFunc = func(name string) ([]Win32Service, error) {
+		deps := map[string][]Win32Service{
+			"running-service-name": {
+				{Name: "RpcSs", State: "Running"},
+				{Name: "Tcpip", State: "Running"},
+			},
+			"stopped-service-name": {
+				{Name: "Missing", State: "Not Installed"},
+			},
+			"dependent-service-name": {
+				{Name: "running-service-name", State: "Running"},
+				{Name: "LanmanWorkstation", State: "Running"},
+			},
+			"RpcSs": {
+				{Name: "rpcss", State: "Running"},
+			},
+			"LanmanWorkstation": {
+				{Name: "RpcSs", State: "Running"},
+				{Name: "MRxSmb20", State: "Stopped"},
+				{Name: "NSI", State: "Stopped"},
+			},
+		}
+		if name == "unqueryable-service-name" {
+			return nil, errors.New("failed to query the dependencies of unqueryable-service-name")
+		}
+		return deps[name], nil
+	}
 }
 
 func TestNtService(t *testing.T) {
@@ -91,6 +135,30 @@ func TestRun(t *testing.T) {
 			expectStatus:  checkers.OK,
 			expectMessage: "",
 		},
+		{
+			casename:      "check about running service with auto-start and dependencies options",
+			cmdline:       []string{"-s", "running-service", "--auto-start", "--dependencies"},
+			expectStatus:  checkers.OK,
+			expectMessage: "",
+		},
+		{
+			casename:      "check about stopped service with auto-start and dependencies options",
+			cmdline:       []string{"-s", "stopped-service", "--auto-start", "--dependencies"},
+			expectStatus:  checkers.CRITICAL,
+			expectMessage: "stopped-service-name: stopped-service-caption - Stopped, start type is Manual, dependency Missing is Not Installed",
+		},
+		{
+			casename:      "check about service with stopped dependency",
+			cmdline:       []string{"-s", "dependent-service", "--dependencies"},
+			expectStatus:  checkers.CRITICAL,
+			expectMessage: "dependent-service-name: dependent-service-caption - dependency LanmanWorkstation -> MRxSmb20 is Stopped",
+		},
+		{
+			casename:      "check about service whose dependencies can't be queried",
+			cmdline:       []string{"-s", "unqueryable-service", "--dependencies"},
+			expectStatus:  checkers.UNKNOWN,
+			expectMessage: "failed to query the dependencies of unqueryable-service-name",
+		},
 		{
 			casename:      "check about stopped service",
 			cmdline:       []string{"-s", "stopped-service"},
@@ -106,8 +174,10 @@ func TestRun(t *testing.T) {
 	}
 
 	originalFunc := getServiceStateFunc
+	originalDependenciesFunc := getDependenciesFunc
 	defer func() {
 		getServiceStateFunc = originalFunc
+		getDependenciesFunc = originalDependenciesFunc
 	}()
 	mockServiceState()
 
@@ -3,7 +3,12 @@
 package checkntservice
 
 import (
+	"strings"
+
 	"github.com/StackExchange/wmi"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
 )
 
 func getServiceState() ([]Win32Service, error) {
@@ -14,3 +19,85 @@ func getServiceState() ([]Win32Service, error) {
 	}
 	return records, nil
 }
+
+// serviceStates are the names of the states in the same way as Win32_Service.
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "Stopped",
+	svc.StartPending:    "Start Pending",
+	svc.StopPending:     "Stop Pending",
+	svc.Running:         "Running",
+	svc.ContinuePending: "Continue Pending",
+	svc.PausePending:    "Pause Pending",
+	svc.Paused:          "Paused",
+}
+
+// getDependencies returns the services and the drivers which the service depends on directly.
+// They are queried to the service control manager because Win32_Service has neither the dependencies nor the drivers.
+func getDependencies(name string) ([]Win32Service, error) {
+	// mgr.Connect requires the administrator privilege to open the manager with all access.
+	h, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseServiceHandle(h)
+
+	s, err := openService(h, name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []Win32Service
+	for _, dep := range config.Dependencies {
+		// the load order groups are prefixed with "+"
+		if strings.HasPrefix(dep, "+") {
+			continue
+		}
+		d, err := queryService(h, dep)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, nil
+}
+
+func openService(h windows.Handle, name string) (*mgr.Service, error) {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := windows.OpenService(h, p, windows.SERVICE_QUERY_CONFIG|windows.SERVICE_QUERY_STATUS)
+	if err != nil {
+		return nil, err
+	}
+	return &mgr.Service{Name: name, Handle: sh}, nil
+}
+
+func queryService(h windows.Handle, name string) (Win32Service, error) {
+	s, err := openService(h, name)
+	if err == windows.ERROR_SERVICE_DOES_NOT_EXIST {
+		return Win32Service{Name: name, State: "Not Installed"}, nil
+	}
+	if err != nil {
+		return Win32Service{}, err
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return Win32Service{}, err
+	}
+	status, err := s.Query()
+	if err != nil {
+		return Win32Service{}, err
+	}
+	state, ok := serviceStates[status.State]
+	if !ok {
+		state = "Unknown"
+	}
+	return Win32Service{Caption: config.DisplayName, Name: name, State: state}, nil
+}
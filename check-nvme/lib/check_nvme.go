@@ -0,0 +1,258 @@
+package checknvme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type nvmeOpts struct {
+	Devices             []string `short:"d" long:"device" value-name:"DEVICE" description:"NVMe device to check, such as /dev/nvme0n1 (can be specified multiple times, default: all devices listed by nvme list)"`
+	Nvme                string   `long:"nvme" value-name:"PATH" default:"nvme" description:"Path to nvme of nvme-cli"`
+	Timeout             int      `short:"t" long:"timeout" default:"10" description:"Seconds before nvme times out"`
+	WarningSpare        *float64 `long:"warning-spare" value-name:"PERCENT" description:"warning if the available spare capacity is less than"`
+	CriticalSpare       *float64 `long:"critical-spare" value-name:"PERCENT" description:"critical if the available spare capacity is less than"`
+	WarningTemperature  *float64 `long:"warning-temperature" value-name:"CELSIUS" description:"warning if the composite temperature is over"`
+	CriticalTemperature *float64 `long:"critical-temperature" value-name:"CELSIUS" description:"critical if the composite temperature is over"`
+	WarningMediaErrors  int64    `long:"warning-media-errors" value-name:"N" default:"0" description:"warning if the number of media and data integrity errors is over"`
+	CriticalMediaErrors *int64   `long:"critical-media-errors" value-name:"N" description:"critical if the number of media and data integrity errors is over"`
+	Perfdata            bool     `long:"perfdata" description:"Append the temperature, the available spare, the percentage used and the media errors of each device as performance data"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// smartLog is the part of the SMART / Health Information log page which is checked.
+type smartLog struct {
+	CriticalWarning int64
+	Temperature     float64 // in Celsius
+	AvailSpare      int64   // in percent
+	SpareThresh     int64   // in percent
+	PercentUsed     int64
+	MediaErrors     int64
+}
+
+// criticalWarnings are the bits of the critical warning field in the order of the bits.
+var criticalWarnings = []string{
+	"available spare below threshold",
+	"temperature over threshold",
+	"reliability degraded",
+	"read-only",
+	"volatile memory backup failed",
+	"persistent memory region read-only",
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "NVMe"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := nvmeOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Executable(opts.Nvme))
+	}
+	opts.DebugOpts.Enable()
+
+	devices := opts.Devices
+	if len(devices) == 0 {
+		out, err := opts.nvme("list", "-o", "json")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		devices, err = parseDevices(out)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if len(devices) == 0 {
+			return checkers.Unknown("no NVMe devices found")
+		}
+	}
+
+	logs := make(map[string]*smartLog, len(devices))
+	for _, dev := range devices {
+		out, err := opts.nvme("smart-log", dev, "-o", "json")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		l, err := parseSmartLog(out)
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("%s: %s", dev, err))
+		}
+		logs[dev] = l
+	}
+	return opts.evaluate(devices, logs)
+}
+
+func (opts *nvmeOpts) nvme(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	end := debuglog.Trace("exec: %s", debuglog.Command(opts.Nvme, args))
+	cmd := exec.CommandContext(ctx, opts.Nvme, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	end(err)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out", opts.Nvme)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseDevices parses the output of nvme list -o json, which is empty if there are no devices.
+func parseDevices(out []byte) ([]string, error) {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var list struct {
+		Devices []struct {
+			DevicePath string `json:"DevicePath"`
+		} `json:"Devices"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of nvme list: %s", err)
+	}
+	var devices []string
+	for _, d := range list.Devices {
+		if d.DevicePath != "" {
+			devices = append(devices, d.DevicePath)
+		}
+	}
+	return devices, nil
+}
+
+// parseSmartLog parses the output of nvme smart-log -o json.
+// The temperature is reported in Kelvin by nvme-cli.
+func parseSmartLog(out []byte) (*smartLog, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of nvme smart-log: %s", err)
+	}
+
+	l := &smartLog{}
+	var kelvin int64
+	for name, v := range map[string]*int64{
+		"critical_warning": &l.CriticalWarning,
+		"temperature":      &kelvin,
+		"avail_spare":      &l.AvailSpare,
+		"spare_thresh":     &l.SpareThresh,
+		"percent_used":     &l.PercentUsed,
+		"media_errors":     &l.MediaErrors,
+	} {
+		raw, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("no %s in the output of nvme smart-log", name)
+		}
+		// the 128-bit counters such as media_errors may be printed as floats by nvme-cli 2.x
+		var f float64
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", name, err)
+		}
+		*v = int64(f)
+	}
+	l.Temperature = float64(kelvin - 273)
+	return l, nil
+}
+
+// describeCriticalWarning returns the names of the bits set in the critical warning field.
+func describeCriticalWarning(w int64) string {
+	var names []string
+	for i, name := range criticalWarnings {
+		if w&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ", ")
+}
+
+func (opts *nvmeOpts) evaluate(devices []string, logs map[string]*smartLog) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs, summaries, perfs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	for _, dev := range devices {
+		l := logs[dev]
+		name := filepath.Base(dev)
+		if l.CriticalWarning != 0 {
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: critical warning 0x%02x (%s)", name, l.CriticalWarning, describeCriticalWarning(l.CriticalWarning)))
+		}
+
+		spare := float64(l.AvailSpare)
+		switch {
+		case opts.CriticalSpare != nil && spare < *opts.CriticalSpare:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: available spare %d%% < %g%%", name, l.AvailSpare, *opts.CriticalSpare))
+		case opts.WarningSpare != nil && spare < *opts.WarningSpare:
+			raise(checkers.WARNING, fmt.Sprintf("%s: available spare %d%% < %g%%", name, l.AvailSpare, *opts.WarningSpare))
+		}
+
+		switch {
+		case opts.CriticalTemperature != nil && l.Temperature > *opts.CriticalTemperature:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: temperature %g°C > %g°C", name, l.Temperature, *opts.CriticalTemperature))
+		case opts.WarningTemperature != nil && l.Temperature > *opts.WarningTemperature:
+			raise(checkers.WARNING, fmt.Sprintf("%s: temperature %g°C > %g°C", name, l.Temperature, *opts.WarningTemperature))
+		}
+
+		switch {
+		case opts.CriticalMediaErrors != nil && l.MediaErrors > *opts.CriticalMediaErrors:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s: %d media errors > %d", name, l.MediaErrors, *opts.CriticalMediaErrors))
+		case l.MediaErrors > opts.WarningMediaErrors:
+			raise(checkers.WARNING, fmt.Sprintf("%s: %d media errors > %d", name, l.MediaErrors, opts.WarningMediaErrors))
+		}
+
+		summaries = append(summaries, fmt.Sprintf("%s: %g°C, available spare %d%%, %d%% used, %d media errors",
+			name, l.Temperature, l.AvailSpare, l.PercentUsed, l.MediaErrors))
+		perfs = append(perfs,
+			perfdata.Format(name+"_temperature", strconv.FormatFloat(l.Temperature, 'g', -1, 64), "", perfdata.OptFloat(opts.WarningTemperature), perfdata.OptFloat(opts.CriticalTemperature)),
+			perfdata.Format(name+"_avail_spare", strconv.FormatInt(l.AvailSpare, 10), "%", perfdata.OptFloat(opts.WarningSpare), perfdata.OptFloat(opts.CriticalSpare)),
+			perfdata.Format(name+"_percent_used", strconv.FormatInt(l.PercentUsed, 10), "%", "", ""),
+			perfdata.Format(name+"_media_errors", strconv.FormatInt(l.MediaErrors, 10), "c", strconv.FormatInt(opts.WarningMediaErrors, 10), perfdata.OptInt(opts.CriticalMediaErrors)),
+		)
+	}
+
+	result := strings.Join(msgs, ", ")
+	if len(msgs) == 0 {
+		result = strings.Join(summaries, ", ")
+	}
+	if opts.Perfdata {
+		result += " | " + strings.Join(perfs, " ")
+	}
+	return checkers.NewChecker(checkSt, result)
+}
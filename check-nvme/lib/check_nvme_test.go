@@ -0,0 +1,166 @@
+package checknvme
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+// nvme list -o json of nvme-cli 1.x
+const listOutput = `{
+  "Devices" : [
+    {
+      "NameSpace" : 1,
+      "DevicePath" : "/dev/nvme0n1",
+      "Firmware" : "2B2QEXM7",
+      "Index" : 0,
+      "ModelNumber" : "Samsung SSD 970 EVO Plus 1TB",
+      "SerialNumber" : "S4EWNX0N000000",
+      "UsedBytes" : 412458123264,
+      "MaximumLBA" : 1953525168,
+      "PhysicalSize" : 1000204886016,
+      "SectorSize" : 512
+    },
+    {
+      "NameSpace" : 1,
+      "DevicePath" : "/dev/nvme1n1",
+      "Firmware" : "11300DR0",
+      "Index" : 1,
+      "ModelNumber" : "INTEL SSDPEKNW010T8",
+      "SerialNumber" : "BTNH000000001P0B",
+      "UsedBytes" : 1024209543168,
+      "MaximumLBA" : 2000409264,
+      "PhysicalSize" : 1024209543168,
+      "SectorSize" : 512
+    }
+  ]
+}`
+
+// nvme smart-log -o json of nvme-cli 1.x
+const smartLogV1 = `{
+  "critical_warning" : 0,
+  "temperature" : 311,
+  "avail_spare" : 100,
+  "spare_thresh" : 10,
+  "percent_used" : 3,
+  "data_units_read" : 31416742,
+  "data_units_written" : 45123873,
+  "host_read_commands" : 412345678,
+  "host_write_commands" : 812345678,
+  "controller_busy_time" : 1234,
+  "power_cycles" : 321,
+  "power_on_hours" : 12345,
+  "unsafe_shutdowns" : 45,
+  "media_errors" : 0,
+  "num_err_log_entries" : 789,
+  "warning_temp_time" : 0,
+  "critical_comp_time" : 0,
+  "temperature_sensor_1" : 311,
+  "temperature_sensor_2" : 317,
+  "thm_temp1_trans_count" : 0,
+  "thm_temp2_trans_count" : 0,
+  "thm_temp1_total_time" : 0,
+  "thm_temp2_total_time" : 0
+}`
+
+// nvme smart-log -o json of nvme-cli 2.x
+const smartLogV2 = `{
+  "critical_warning":4,
+  "temperature":356,
+  "avail_spare":8,
+  "spare_thresh":10,
+  "percent_used":104,
+  "endurance_grp_critical_warning_summary":0,
+  "data_units_read":31416742,
+  "data_units_written":45123873,
+  "host_read_commands":412345678,
+  "host_write_commands":812345678,
+  "controller_busy_time":1234,
+  "power_cycles":321,
+  "power_on_hours":12345,
+  "unsafe_shutdowns":45,
+  "media_errors":12.0,
+  "num_err_log_entries":789,
+  "warning_temp_time":3,
+  "critical_comp_time":0
+}`
+
+func TestParseDevices(t *testing.T) {
+	devices, err := parseDevices([]byte(listOutput))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/dev/nvme0n1", "/dev/nvme1n1"}, devices)
+
+	// nvme list prints nothing if there are no devices
+	devices, err = parseDevices([]byte("\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(devices))
+
+	_, err = parseDevices([]byte("Failed to scan topology"))
+	assert.NotNil(t, err)
+}
+
+func TestParseSmartLog(t *testing.T) {
+	l, err := parseSmartLog([]byte(smartLogV1))
+	assert.Nil(t, err)
+	assert.Equal(t, &smartLog{CriticalWarning: 0, Temperature: 38, AvailSpare: 100, SpareThresh: 10, PercentUsed: 3, MediaErrors: 0}, l)
+
+	l, err = parseSmartLog([]byte(smartLogV2))
+	assert.Nil(t, err)
+	assert.Equal(t, &smartLog{CriticalWarning: 4, Temperature: 83, AvailSpare: 8, SpareThresh: 10, PercentUsed: 104, MediaErrors: 12}, l)
+
+	_, err = parseSmartLog([]byte(`{"critical_warning": 0}`))
+	assert.NotNil(t, err)
+	_, err = parseSmartLog([]byte(`{"critical_warning": "0", "temperature": 311, "avail_spare": 100, "spare_thresh": 10, "percent_used": 3, "media_errors": 0}`))
+	assert.NotNil(t, err)
+}
+
+func TestDescribeCriticalWarning(t *testing.T) {
+	assert.Equal(t, "available spare below threshold, reliability degraded, read-only", describeCriticalWarning(0x0d))
+	assert.Equal(t, "unknown", describeCriticalWarning(0x80))
+}
+
+func TestEvaluate(t *testing.T) {
+	healthy := &smartLog{Temperature: 38, AvailSpare: 100, SpareThresh: 10, PercentUsed: 3}
+	failing := &smartLog{CriticalWarning: 4, Temperature: 83, AvailSpare: 8, SpareThresh: 10, PercentUsed: 104, MediaErrors: 12}
+	i := func(v int64) *int64 { return &v }
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		opts nvmeOpts
+		logs map[string]*smartLog
+		want checkers.Status
+		msg  string
+	}{
+		{
+			logs: map[string]*smartLog{"/dev/nvme0n1": healthy, "/dev/nvme1n1": healthy},
+			want: checkers.OK,
+			msg:  "nvme0n1: 38°C, available spare 100%, 3% used, 0 media errors, nvme1n1: 38°C, available spare 100%, 3% used, 0 media errors",
+		},
+		{
+			opts: nvmeOpts{WarningSpare: f(20), CriticalSpare: f(10), WarningTemperature: f(70), CriticalTemperature: f(80), CriticalMediaErrors: i(10)},
+			logs: map[string]*smartLog{"/dev/nvme0n1": healthy, "/dev/nvme1n1": failing},
+			want: checkers.CRITICAL,
+			msg:  "nvme1n1: critical warning 0x04 (reliability degraded), nvme1n1: available spare 8% < 10%, nvme1n1: temperature 83°C > 80°C, nvme1n1: 12 media errors > 10",
+		},
+		{
+			opts: nvmeOpts{WarningSpare: f(10), WarningTemperature: f(80)},
+			logs: map[string]*smartLog{"/dev/nvme0n1": healthy, "/dev/nvme1n1": {Temperature: 83, AvailSpare: 8, SpareThresh: 5, MediaErrors: 1}},
+			want: checkers.WARNING,
+			msg:  "nvme1n1: available spare 8% < 10%, nvme1n1: temperature 83°C > 80°C, nvme1n1: 1 media errors > 0",
+		},
+		{
+			opts: nvmeOpts{WarningMediaErrors: 100, WarningTemperature: f(70), Perfdata: true},
+			logs: map[string]*smartLog{"/dev/nvme0n1": healthy, "/dev/nvme1n1": {Temperature: 45, AvailSpare: 90, SpareThresh: 10, PercentUsed: 20, MediaErrors: 12}},
+			want: checkers.OK,
+			msg: "nvme0n1: 38°C, available spare 100%, 3% used, 0 media errors, nvme1n1: 45°C, available spare 90%, 20% used, 12 media errors" +
+				" | nvme0n1_temperature=38;70; nvme0n1_avail_spare=100%;; nvme0n1_percent_used=3%;; nvme0n1_media_errors=0c;100;" +
+				" nvme1n1_temperature=45;70; nvme1n1_avail_spare=90%;; nvme1n1_percent_used=20%;; nvme1n1_media_errors=12c;100;",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate([]string{"/dev/nvme0n1", "/dev/nvme1n1"}, tt.logs)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
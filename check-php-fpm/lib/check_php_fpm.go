@@ -0,0 +1,215 @@
+package checkphpfpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type phpFPMOpts struct {
+	URL                  string `short:"u" long:"url" description:"URL of the status page, such as http://localhost/status"`
+	Socket               string `short:"s" long:"socket" value-name:"PATH|HOST:PORT" description:"Unix socket or address of php-fpm to request the status page with FastCGI"`
+	StatusPath           string `long:"status-path" value-name:"PATH" default:"/status" description:"pm.status_path of the pool, used with --socket"`
+	Timeout              int    `short:"t" long:"timeout" default:"10" description:"Seconds before the request times out"`
+	WarningListenQueue   int64  `long:"warning-listen-queue" value-name:"N" default:"0" description:"warning if the number of requests in the listen queue is over"`
+	CriticalListenQueue  *int64 `long:"critical-listen-queue" value-name:"N" description:"critical if the number of requests in the listen queue is over"`
+	WarningSlowRequests  int64  `long:"warning-slow-requests" value-name:"N" default:"0" description:"warning if the number of slow requests since the last check is over"`
+	CriticalSlowRequests *int64 `long:"critical-slow-requests" value-name:"N" description:"critical if the number of slow requests since the last check is over"`
+	CriticalMaxChildren  bool   `long:"critical-max-children" description:"critical instead of warning if max_children has been reached since the last check"`
+	StateDir             string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// fpmStatus is the status of a pool in JSON, which is requested with "?json".
+type fpmStatus struct {
+	Pool               string `json:"pool"`
+	StartTime          int64  `json:"start time"`
+	ListenQueue        int64  `json:"listen queue"`
+	IdleProcesses      int64  `json:"idle processes"`
+	ActiveProcesses    int64  `json:"active processes"`
+	TotalProcesses     int64  `json:"total processes"`
+	MaxChildrenReached int64  `json:"max children reached"`
+	SlowRequests       int64  `json:"slow requests"`
+}
+
+// counterState is the counters at the last check.
+type counterState struct {
+	StartTime          int64 `json:"start_time"`
+	MaxChildrenReached int64 `json:"max_children_reached"`
+	SlowRequests       int64 `json:"slow_requests"`
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "PHP-FPM"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := phpFPMOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if (opts.Socket == "") == (opts.URL == "") {
+		return checkers.Unknown("either --socket or --url is required")
+	}
+	if opts.SelfTest {
+		if opts.Socket != "" && !isTCP(opts.Socket) {
+			return selftest.Run(selftest.Exists(opts.Socket))
+		} else if opts.Socket != "" {
+			return selftest.Run(selftest.Resolve(opts.Socket))
+		}
+		return selftest.Run(selftest.ResolveURL(opts.URL))
+	}
+
+	var body string
+	if opts.Socket != "" {
+		body, err = opts.readSocket()
+	} else {
+		body, err = opts.readURL()
+	}
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	var st fpmStatus
+	if err := json.Unmarshal([]byte(body), &st); err != nil {
+		return checkers.Unknown(fmt.Sprintf("failed to parse the status: %s", err))
+	}
+
+	key := opts.URL
+	if opts.Socket != "" {
+		key = opts.Socket + opts.StatusPath
+	}
+	stateFile := state.File(state.Dir(opts.StateDir, "check-php-fpm"), "counters", key)
+	var last *counterState
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	err = state.Save(stateFile, &counterState{
+		StartTime:          st.StartTime,
+		MaxChildrenReached: st.MaxChildrenReached,
+		SlowRequests:       st.SlowRequests,
+	})
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(&st, last)
+}
+
+// isTCP returns true if the socket is HOST:PORT rather than the path of a unix socket.
+func isTCP(socket string) bool {
+	return !strings.Contains(socket, "/")
+}
+
+// readSocket requests the status page to php-fpm with FastCGI as a web server does.
+func (opts *phpFPMOpts) readSocket() (string, error) {
+	network := "unix"
+	if isTCP(opts.Socket) {
+		network = "tcp"
+	}
+	timeout := time.Duration(opts.Timeout) * time.Second
+	end := debuglog.Trace("fastcgi: GET %s?json from %s %s", opts.StatusPath, network, opts.Socket)
+	conn, err := net.DialTimeout(network, opts.Socket, timeout)
+	if err != nil {
+		end(err)
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	body, err := fcgiGet(conn, opts.StatusPath, "json")
+	end(err)
+	return body, err
+}
+
+func (opts *phpFPMOpts) readURL() (string, error) {
+	u := opts.URL
+	if strings.Contains(u, "?") {
+		u += "&json"
+	} else {
+		u += "?json"
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "check-php-fpm")
+	client := &http.Client{
+		Transport: debuglog.Transport(nil),
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed: http status code %d from %s", resp.StatusCode, u)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// evaluate checks the listen queue, and the slow requests and the times max_children was reached since the last check.
+// The counters are not checked on the first check or if php-fpm has been restarted.
+func (opts *phpFPMOpts) evaluate(st *fpmStatus, last *counterState) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	switch {
+	case opts.CriticalListenQueue != nil && st.ListenQueue > *opts.CriticalListenQueue:
+		raise(checkers.CRITICAL, fmt.Sprintf("%d requests in the listen queue > %d", st.ListenQueue, *opts.CriticalListenQueue))
+	case st.ListenQueue > opts.WarningListenQueue:
+		raise(checkers.WARNING, fmt.Sprintf("%d requests in the listen queue > %d", st.ListenQueue, opts.WarningListenQueue))
+	}
+
+	if last != nil && last.StartTime == st.StartTime {
+		if n := st.MaxChildrenReached - last.MaxChildrenReached; n > 0 {
+			s := checkers.WARNING
+			if opts.CriticalMaxChildren {
+				s = checkers.CRITICAL
+			}
+			raise(s, fmt.Sprintf("max_children reached %d times (%d/%d active processes)", n, st.ActiveProcesses, st.TotalProcesses))
+		}
+		n := st.SlowRequests - last.SlowRequests
+		switch {
+		case opts.CriticalSlowRequests != nil && n > *opts.CriticalSlowRequests:
+			raise(checkers.CRITICAL, fmt.Sprintf("%d slow requests > %d", n, *opts.CriticalSlowRequests))
+		case n > opts.WarningSlowRequests:
+			raise(checkers.WARNING, fmt.Sprintf("%d slow requests > %d", n, opts.WarningSlowRequests))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("pool %s: %d/%d active processes, %d idle", st.Pool, st.ActiveProcesses, st.TotalProcesses, st.IdleProcesses))
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("pool %s: %s", st.Pool, strings.Join(msgs, ", ")))
+}
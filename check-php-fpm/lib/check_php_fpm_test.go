@@ -0,0 +1,144 @@
+package checkphpfpm
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+const statusJSON = `{"pool":"www","process manager":"dynamic","start time":1700000000,"start since":3600,"accepted conn":12345,"listen queue":0,"max listen queue":3,"listen queue len":511,"idle processes":3,"active processes":2,"total processes":5,"max active processes":5,"max children reached":1,"slow requests":4}`
+
+func TestEvaluate(t *testing.T) {
+	st := fpmStatus{Pool: "www", StartTime: 1700000000, ListenQueue: 0, IdleProcesses: 3, ActiveProcesses: 2, TotalProcesses: 5, MaxChildrenReached: 1, SlowRequests: 4}
+	queued := st
+	queued.ListenQueue = 8
+	five := int64(5)
+
+	tests := []struct {
+		opts phpFPMOpts
+		st   fpmStatus
+		last *counterState
+		want checkers.Status
+		msg  string
+	}{
+		{
+			st:   st,
+			want: checkers.OK,
+			msg:  "pool www: 2/5 active processes, 3 idle",
+		},
+		{
+			st:   st,
+			last: &counterState{StartTime: 1700000000, MaxChildrenReached: 1, SlowRequests: 4},
+			want: checkers.OK,
+			msg:  "pool www: 2/5 active processes, 3 idle",
+		},
+		{
+			st:   queued,
+			want: checkers.WARNING,
+			msg:  "pool www: 8 requests in the listen queue > 0",
+		},
+		{
+			opts: phpFPMOpts{CriticalListenQueue: &five},
+			st:   queued,
+			want: checkers.CRITICAL,
+			msg:  "pool www: 8 requests in the listen queue > 5",
+		},
+		{
+			opts: phpFPMOpts{WarningSlowRequests: 1},
+			st:   st,
+			last: &counterState{StartTime: 1700000000, MaxChildrenReached: 0, SlowRequests: 2},
+			want: checkers.WARNING,
+			msg:  "pool www: max_children reached 1 times (2/5 active processes), 2 slow requests > 1",
+		},
+		{
+			opts: phpFPMOpts{CriticalMaxChildren: true, CriticalSlowRequests: &five},
+			st:   st,
+			last: &counterState{StartTime: 1700000000, MaxChildrenReached: 0, SlowRequests: 4},
+			want: checkers.CRITICAL,
+			msg:  "pool www: max_children reached 1 times (2/5 active processes)",
+		},
+		{
+			// restarted
+			st:   st,
+			last: &counterState{StartTime: 1690000000, MaxChildrenReached: 0, SlowRequests: 0},
+			want: checkers.OK,
+			msg:  "pool www: 2/5 active processes, 3 idle",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(&tt.st, tt.last)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/status" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := r.URL.Query()["json"]; !ok {
+		io.WriteString(w, "pool: www\n")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, statusJSON)
+}
+
+func TestRunSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-php-fpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "php-fpm.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go fcgi.Serve(l, http.HandlerFunc(statusHandler))
+
+	stateDir := filepath.Join(dir, "state")
+	ckr := run([]string{"-s", sock, "--state-dir", stateDir})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	assert.Equal(t, "pool www: 2/5 active processes, 3 idle", ckr.Message)
+
+	files, _ := ioutil.ReadDir(stateDir)
+	assert.Equal(t, 1, len(files))
+
+	ckr = run([]string{"-s", sock, "--status-path", "/unknown", "--state-dir", stateDir})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+	assert.True(t, strings.HasPrefix(ckr.Message, "failed: status 404"), ckr.Message)
+}
+
+func TestRunURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(statusHandler))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "check-php-fpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ckr := run([]string{"-u", ts.URL + "/status", "--state-dir", dir})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+
+	ckr = run([]string{"-u", ts.URL + "/unknown", "--state-dir", dir})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+
+	ckr = run([]string{"-u", ts.URL + "/status", "-s", "/var/run/php-fpm.sock"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, ckr.Message)
+}
@@ -0,0 +1,143 @@
+package checkphpfpm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// The minimal FastCGI client to request the status page of php-fpm as a web server does.
+// See https://fastcgi-archives.github.io/FastCGI_Specification.html
+
+const (
+	fcgiVersion = 1
+
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+
+	fcgiResponder = 1
+
+	fcgiRequestID = 1
+)
+
+type fcgiHeader struct {
+	Version       uint8
+	Type          uint8
+	RequestID     uint16
+	ContentLength uint16
+	PaddingLength uint8
+	Reserved      uint8
+}
+
+func writeRecord(w io.Writer, typ uint8, content []byte) error {
+	h := fcgiHeader{
+		Version:       fcgiVersion,
+		Type:          typ,
+		RequestID:     fcgiRequestID,
+		ContentLength: uint16(len(content)),
+	}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+// encodeParams encodes the name-value pairs, whose lengths are in 1 byte if less than 128 or in 4 bytes otherwise.
+func encodeParams(params map[string]string) []byte {
+	var buf bytes.Buffer
+	writeLen := func(n int) {
+		if n < 128 {
+			buf.WriteByte(byte(n))
+			return
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n)|1<<31)
+		buf.Write(b[:])
+	}
+	for k, v := range params {
+		writeLen(len(k))
+		writeLen(len(v))
+		buf.WriteString(k)
+		buf.WriteString(v)
+	}
+	return buf.Bytes()
+}
+
+// fcgiGet requests the script with the query as a GET request over rw and returns the body of the response.
+func fcgiGet(rw io.ReadWriter, script, query string) (string, error) {
+	var req bytes.Buffer
+	// role and flags; the connection is closed after the request.
+	writeRecord(&req, fcgiBeginRequest, []byte{0, fcgiResponder, 0, 0, 0, 0, 0, 0})
+	writeRecord(&req, fcgiParams, encodeParams(map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"REQUEST_METHOD":    "GET",
+		"SCRIPT_NAME":       script,
+		"SCRIPT_FILENAME":   script,
+		"REQUEST_URI":       script + "?" + query,
+		"QUERY_STRING":      query,
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+	}))
+	writeRecord(&req, fcgiParams, nil)
+	writeRecord(&req, fcgiStdin, nil)
+	if _, err := rw.Write(req.Bytes()); err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	for {
+		var h fcgiHeader
+		if err := binary.Read(rw, binary.BigEndian, &h); err != nil {
+			if err == io.EOF {
+				return "", fmt.Errorf("the connection was closed before the end of the response")
+			}
+			return "", err
+		}
+		content := make([]byte, int(h.ContentLength)+int(h.PaddingLength))
+		if _, err := io.ReadFull(rw, content); err != nil {
+			return "", err
+		}
+		content = content[:h.ContentLength]
+		switch h.Type {
+		case fcgiStdout:
+			stdout.Write(content)
+		case fcgiStderr:
+			stderr.Write(content)
+		case fcgiEndRequest:
+			return parseCGIResponse(&stdout, strings.TrimSpace(stderr.String()))
+		}
+	}
+}
+
+// parseCGIResponse returns the body of the CGI response, which has the status in the Status header.
+func parseCGIResponse(r io.Reader, stderr string) (string, error) {
+	tp := textproto.NewReader(bufio.NewReader(r))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read the response: %s", err)
+	}
+	if s := header.Get("Status"); s != "" {
+		code, _ := strconv.Atoi(strings.Fields(s)[0])
+		if code != 200 {
+			if stderr != "" {
+				return "", fmt.Errorf("failed: status %s: %s", s, stderr)
+			}
+			return "", fmt.Errorf("failed: status %s", s)
+		}
+	}
+	body, err := ioutil.ReadAll(tp.R)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -1,64 +1,130 @@
 package checkping
 
 import (
+	"fmt"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	flags "github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 	ping "github.com/tatsushid/go-fastping"
 )
 
-var opts struct {
-	Host     string `long:"host" short:"H" description:"check target IP Address"`
-	Count    int    `long:"count" short:"n" default:"1" description:"sending (and receiving) count ping packets"`
-	WaitTime int    `long:"wait-time" short:"w" default:"1000" description:"wait time, Max RTT(ms)"`
+type pingOpts struct {
+	Hosts             []string `long:"host" short:"H" description:"check target IP Address (can be specified multiple times)"`
+	Count             int      `long:"count" short:"n" default:"1" description:"sending (and receiving) count ping packets"`
+	WaitTime          int      `long:"wait-time" short:"w" default:"1000" description:"wait time, Max RTT(ms)"`
+	WarningReachable  *float64 `long:"warning-reachable" value-name:"PERCENT" description:"warning if the percentage of reachable hosts is less than"`
+	CriticalReachable float64  `long:"critical-reachable" value-name:"PERCENT" default:"100" description:"critical if the percentage of reachable hosts is less than"`
+	netutil.AddressFamilyOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 func run(args []string) *checkers.Checker {
+	var opts pingOpts
 	var parser = flags.NewParser(&opts, flags.Default)
 	_, err := parser.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
-	if opts.Host == "" {
+	if len(opts.Hosts) == 0 {
 		parser.WriteHelp(os.Stderr)
-		os.Exit(1)
+		return checkers.Unknown("--host is required")
 	}
+	opts.DebugOpts.Enable()
 
-	p := ping.NewPinger()
-	netProto := "ip4:icmp"
-	if isIPv6(opts.Host) {
-		netProto = "ip6:ipv6-icmp"
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		var checks []selftest.Check
+		for _, h := range opts.Hosts {
+			checks = append(checks, selftest.Resolve(h))
+		}
+		return selftest.Run(checks...)
 	}
 
-	ra, err := net.ResolveIPAddr(netProto, opts.Host)
-	if err != nil {
-		os.Exit(1)
+	p := ping.NewPinger()
+	addrs := make([]string, len(opts.Hosts))
+	for i, h := range opts.Hosts {
+		netProto := "ip4:icmp"
+		if opts.IPv6 || (!opts.IPv4 && isIPv6(h)) {
+			netProto = "ip6:ipv6-icmp"
+		}
+
+		ra, err := net.ResolveIPAddr(netProto, h)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		debuglog.Printf("ping: %s is %s", h, ra)
+		p.AddIPAddr(ra)
+		addrs[i] = ra.String()
 	}
-	p.AddIPAddr(ra)
 
-	status := checkers.CRITICAL
+	reached := make(map[string]bool)
 	p.MaxRTT = time.Millisecond * time.Duration(opts.WaitTime)
-	p.OnRecv = func(_ *net.IPAddr, _ time.Duration) {
-		status = checkers.OK
+	p.OnRecv = func(addr *net.IPAddr, rtt time.Duration) {
+		debuglog.Printf("ping: reply from %s in %s", addr, rtt)
+		reached[addr.String()] = true
 	}
 
 	for i := 0; i < opts.Count; i++ {
+		end := debuglog.Trace("ping: round %d of %d", i+1, opts.Count)
 		err := p.Run()
+		end(err)
 		if err != nil {
+			status := checkers.CRITICAL
+			if len(reached) > 0 {
+				status = checkers.OK
+			}
 			return checkers.NewChecker(status, err.Error())
 		}
 	}
 
-	return checkers.NewChecker(status, "")
+	var unreachable []string
+	for i, h := range opts.Hosts {
+		if !reached[addrs[i]] {
+			unreachable = append(unreachable, h)
+		}
+	}
+	return evaluate(len(opts.Hosts), unreachable, opts.WarningReachable, opts.CriticalReachable)
+}
+
+// evaluate checks the percentage of reachable hosts.
+// The message is empty for a single host to keep the output of the single target mode.
+func evaluate(total int, unreachable []string, warning *float64, critical float64) *checkers.Checker {
+	reachable := total - len(unreachable)
+	ratio := float64(reachable) / float64(total) * 100
+
+	status := checkers.OK
+	if ratio < critical {
+		status = checkers.CRITICAL
+	} else if warning != nil && ratio < *warning {
+		status = checkers.WARNING
+	}
+
+	if total == 1 {
+		return checkers.NewChecker(status, "")
+	}
+	msg := fmt.Sprintf("%d/%d hosts reachable (%.1f%%)", reachable, total, ratio)
+	if len(unreachable) > 0 {
+		msg += ", unreachable: " + strings.Join(unreachable, ", ")
+	}
+	return checkers.NewChecker(status, msg)
 }
 
+// isIPv6 reports whether host resolves to an IPv6 address.
+// It returns false if host can't be resolved, which is reported by the resolution for ICMP.
 func isIPv6(host string) bool {
 	addr, err := net.ResolveIPAddr("ip", host)
 	if err != nil {
-		os.Exit(1)
+		return false
 	}
 	if ip4 := addr.IP.To4(); len(ip4) != net.IPv4len {
 		return true
@@ -68,7 +134,12 @@ func isIPv6(host string) bool {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Ping"
-	ckr.Exit()
+	return ckr
 }
@@ -3,6 +3,7 @@ package checkping
 import (
 	"testing"
 
+	"github.com/mackerelio/checkers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +42,65 @@ func TestIsIPv6(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluate(t *testing.T) {
+	warning := 80.0
+	testCases := []struct {
+		casename    string
+		total       int
+		unreachable []string
+		warning     *float64
+		critical    float64
+		status      checkers.Status
+		message     string
+	}{
+		{
+			casename: "single host reachable",
+			total:    1,
+			critical: 100,
+			status:   checkers.OK,
+		},
+		{
+			casename:    "single host unreachable",
+			total:       1,
+			unreachable: []string{"192.0.2.1"},
+			critical:    100,
+			status:      checkers.CRITICAL,
+		},
+		{
+			casename: "all hosts reachable",
+			total:    4,
+			warning:  &warning,
+			critical: 50,
+			status:   checkers.OK,
+			message:  "4/4 hosts reachable (100.0%)",
+		},
+		{
+			casename:    "some hosts unreachable",
+			total:       4,
+			unreachable: []string{"192.0.2.4"},
+			warning:     &warning,
+			critical:    50,
+			status:      checkers.WARNING,
+			message:     "3/4 hosts reachable (75.0%), unreachable: 192.0.2.4",
+		},
+		{
+			casename:    "too many hosts unreachable",
+			total:       4,
+			unreachable: []string{"192.0.2.3", "192.0.2.4", "192.0.2.5"},
+			warning:     &warning,
+			critical:    50,
+			status:      checkers.CRITICAL,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.casename, func(t *testing.T) {
+			ckr := evaluate(tc.total, tc.unreachable, tc.warning, tc.critical)
+			assert.Equal(t, tc.status, ckr.Status, ckr.Message)
+			if tc.message != "" {
+				assert.Equal(t, tc.message, ckr.Message)
+			}
+		})
+	}
+}
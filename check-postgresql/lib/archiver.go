@@ -0,0 +1,179 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type archiverOpts struct {
+	postgresqlSetting
+	WarnAge         *int64   `long:"warning-age" value-name:"SECONDS" description:"warning if the last WAL file was archived more than the seconds ago"`
+	CritAge         *int64   `long:"critical-age" value-name:"SECONDS" description:"critical if the last WAL file was archived more than the seconds ago"`
+	WarnCheckpoints *float64 `long:"warning-checkpoints-req" value-name:"PERCENT" description:"warning if the percentage of requested checkpoints is over"`
+	CritCheckpoints *float64 `long:"critical-checkpoints-req" value-name:"PERCENT" description:"critical if the percentage of requested checkpoints is over"`
+	StateDir        string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+type archiverStat struct {
+	archivedCount    int64
+	failedCount      int64
+	lastArchivedWAL  string
+	lastArchivedTime sql.NullTime
+	lastFailedWAL    string
+	lastFailedTime   sql.NullTime
+}
+
+type checkpointStat struct {
+	timed     int64
+	requested int64
+}
+
+// archiverState is failed_count of pg_stat_archiver at the last run.
+type archiverState struct {
+	FailedCount int64 `json:"failed_count"`
+}
+
+func checkArchiver(args []string) *checkers.Checker {
+	opts := archiverOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "archiver [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	var archiveMode string
+	if err := queryRow(db, "SELECT current_setting('archive_mode')", &archiveMode); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if archiveMode == "off" {
+		return checkers.Unknown("archive_mode is off")
+	}
+
+	st, err := getArchiverStat(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	var cp *checkpointStat
+	if opts.WarnCheckpoints != nil || opts.CritCheckpoints != nil {
+		cp, err = getCheckpointStat(db)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-postgresql"))
+	var prev archiverState
+	found, err := state.Load(stateFile, &prev)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if err := state.Save(stateFile, &archiverState{FailedCount: st.failedCount}); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	prevFailed := int64(-1)
+	if found {
+		prevFailed = prev.FailedCount
+	}
+	return opts.evaluate(st, prevFailed, cp, time.Now())
+}
+
+func getArchiverStat(db *sql.DB) (*archiverStat, error) {
+	var st archiverStat
+	err := queryRow(db, `SELECT archived_count, failed_count,
+		COALESCE(last_archived_wal, ''), last_archived_time,
+		COALESCE(last_failed_wal, ''), last_failed_time
+		FROM pg_stat_archiver`,
+		&st.archivedCount, &st.failedCount,
+		&st.lastArchivedWAL, &st.lastArchivedTime,
+		&st.lastFailedWAL, &st.lastFailedTime)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// getCheckpointStat returns the number of checkpoints, which has moved
+// from pg_stat_bgwriter to pg_stat_checkpointer in PostgreSQL 17.
+func getCheckpointStat(db *sql.DB) (*checkpointStat, error) {
+	var version int
+	if err := queryRow(db, "SELECT current_setting('server_version_num')::int", &version); err != nil {
+		return nil, err
+	}
+	query := "SELECT checkpoints_timed, checkpoints_req FROM pg_stat_bgwriter"
+	if version >= 170000 {
+		query = "SELECT num_timed, num_requested FROM pg_stat_checkpointer"
+	}
+	var cp checkpointStat
+	if err := queryRow(db, query, &cp.timed, &cp.requested); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (opts *archiverOpts) stateFile(stateDir string) string {
+	return state.File(stateDir, "archiver", strings.Join([]string{opts.Host, opts.Port}, ":"))
+}
+
+// evaluate returns CRITICAL if archive_command has failed since the last run and
+// no WAL file has been archived after the failure, or WARNING if it has recovered.
+// prevFailed is failed_count at the last run, or -1 if it is unknown.
+func (opts *archiverOpts) evaluate(st *archiverStat, prevFailed int64, cp *checkpointStat, now time.Time) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	var msgs []string
+	if st.lastArchivedTime.Valid {
+		age := now.Sub(st.lastArchivedTime.Time)
+		msgs = append(msgs, fmt.Sprintf("last WAL %s archived %d seconds ago", st.lastArchivedWAL, int64(age.Seconds())))
+		if opts.CritAge != nil && age > time.Duration(*opts.CritAge)*time.Second {
+			raise(checkers.CRITICAL)
+		} else if opts.WarnAge != nil && age > time.Duration(*opts.WarnAge)*time.Second {
+			raise(checkers.WARNING)
+		}
+	} else {
+		msgs = append(msgs, "no WAL files archived yet")
+	}
+
+	// failed_count decreases when the statistics are reset.
+	if prevFailed >= 0 && st.failedCount > prevFailed {
+		msg := fmt.Sprintf("archiving failed %d times since the last check (last failed WAL %s)", st.failedCount-prevFailed, st.lastFailedWAL)
+		if st.lastArchivedTime.Valid && st.lastArchivedTime.Time.After(st.lastFailedTime.Time) {
+			raise(checkers.WARNING)
+			msg += " but has recovered"
+		} else {
+			raise(checkers.CRITICAL)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if cp != nil && cp.timed+cp.requested > 0 {
+		ratio := float64(cp.requested) / float64(cp.timed+cp.requested) * 100
+		msgs = append(msgs, fmt.Sprintf("%.1f%% of checkpoints requested", ratio))
+		if opts.CritCheckpoints != nil && ratio > *opts.CritCheckpoints {
+			raise(checkers.CRITICAL)
+		} else if opts.WarnCheckpoints != nil && ratio > *opts.WarnCheckpoints {
+			raise(checkers.WARNING)
+		}
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,109 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiverEvaluate(t *testing.T) {
+	i := func(v int64) *int64 { return &v }
+	f := func(v float64) *float64 { return &v }
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-d), Valid: true} }
+
+	tests := []struct {
+		name       string
+		opts       archiverOpts
+		stat       archiverStat
+		prevFailed int64
+		cp         *checkpointStat
+		want       checkers.Status
+	}{
+		{
+			name: "archived recently",
+			opts: archiverOpts{WarnAge: i(600), CritAge: i(3600)},
+			stat: archiverStat{archivedCount: 10, lastArchivedWAL: "000000010000000000000010", lastArchivedTime: at(time.Minute)},
+			want: checkers.OK,
+		},
+		{
+			name: "archived long ago",
+			opts: archiverOpts{WarnAge: i(600), CritAge: i(3600)},
+			stat: archiverStat{archivedCount: 10, lastArchivedTime: at(20 * time.Minute)},
+			want: checkers.WARNING,
+		},
+		{
+			name: "archived too long ago",
+			opts: archiverOpts{WarnAge: i(600), CritAge: i(3600)},
+			stat: archiverStat{archivedCount: 10, lastArchivedTime: at(2 * time.Hour)},
+			want: checkers.CRITICAL,
+		},
+		{
+			name:       "first run with failures",
+			stat:       archiverStat{failedCount: 3, lastFailedTime: at(time.Minute)},
+			prevFailed: -1,
+			want:       checkers.OK,
+		},
+		{
+			name:       "still failing",
+			stat:       archiverStat{archivedCount: 10, failedCount: 5, lastArchivedTime: at(time.Hour), lastFailedTime: at(time.Minute)},
+			prevFailed: 3,
+			want:       checkers.CRITICAL,
+		},
+		{
+			name:       "recovered from failures",
+			stat:       archiverStat{archivedCount: 11, failedCount: 5, lastArchivedTime: at(time.Minute), lastFailedTime: at(time.Hour)},
+			prevFailed: 3,
+			want:       checkers.WARNING,
+		},
+		{
+			name:       "statistics reset",
+			stat:       archiverStat{archivedCount: 1, failedCount: 0, lastArchivedTime: at(time.Minute)},
+			prevFailed: 3,
+			want:       checkers.OK,
+		},
+		{
+			name: "too many requested checkpoints",
+			opts: archiverOpts{WarnCheckpoints: f(10), CritCheckpoints: f(50)},
+			stat: archiverStat{archivedCount: 1, lastArchivedTime: at(time.Minute)},
+			cp:   &checkpointStat{timed: 70, requested: 30},
+			want: checkers.WARNING,
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(&tt.stat, tt.prevFailed, tt.cp, now)
+		assert.Equal(t, tt.want, ckr.Status, "%s: %s", tt.name, ckr.Message)
+	}
+}
+
+func TestArchiverState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := archiverOpts{postgresqlSetting: postgresqlSetting{Host: "localhost", Port: "5432"}}
+	file := opts.stateFile(filepath.Join(dir, "state"))
+
+	var s archiverState
+	found, err := state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, state.Save(file, &archiverState{FailedCount: 7}))
+	found, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(7), s.FailedCount)
+
+	other := archiverOpts{postgresqlSetting: postgresqlSetting{Host: "localhost", Port: "5433"}}
+	assert.NotEqual(t, file, other.stateFile(filepath.Join(dir, "state")), "the servers should not share the state")
+}
@@ -1,6 +1,7 @@
 package checkpostgresql
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"strings"
@@ -8,10 +9,19 @@ import (
 	// PostgreSQL Driver
 	_ "github.com/lib/pq"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 var commands = map[string](func([]string) *checkers.Checker){
-	"connection": checkConnection,
+	"connection":  checkConnection,
+	"connections": checkConnections,
+	"query":       checkQuery,
+	"archiver":    checkArchiver,
+	"slots":       checkSlots,
+	"vacuum":      checkVacuum,
+	"pgbouncer":   checkPgbouncer,
 }
 
 type postgresqlSetting struct {
@@ -23,6 +33,10 @@ type postgresqlSetting struct {
 	SSLmode     string `short:"s" long:"sslmode" default:"disable" description:"SSLmode"`
 	SSLRootCert string `long:"sslrootcert" description:"The root certificate used for SSL certificate verification."`
 	Timeout     int    `short:"t" long:"timeout" default:"5" description:"Maximum wait for connection, in seconds."`
+
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 func (p postgresqlSetting) getDriverAndDataSourceName() (string, string) {
@@ -37,6 +51,34 @@ func (p postgresqlSetting) getDriverAndDataSourceName() (string, string) {
 	return "postgres", dataSourceName
 }
 
+func (p postgresqlSetting) open() (*sql.DB, error) {
+	p.DebugOpts.Enable()
+	password, err := p.ResolvePassword(p.Password)
+	if err != nil {
+		return nil, err
+	}
+	p.Password = password
+	debuglog.Printf("postgresql: connect to %s:%s as %s", p.Host, p.Port, p.User)
+	return sql.Open(p.getDriverAndDataSourceName())
+}
+
+// selfTest validates the connection settings without connecting to the server.
+func (m postgresqlSetting) selfTest() *checkers.Checker {
+	checks := []selftest.Check{selftest.Resolve(m.Host)}
+	if m.SSLRootCert != "" {
+		checks = append(checks, selftest.Readable(m.SSLRootCert))
+	}
+	return selftest.Run(checks...)
+}
+
+// queryRow executes the query which returns one row, and scans it into dest.
+func queryRow(db *sql.DB, query string, dest ...interface{}) error {
+	end := debuglog.Trace("sql: %s", query)
+	err := db.QueryRow(query).Scan(dest...)
+	end(err)
+	return err
+}
+
 func separateSub(argv []string) (string, []string) {
 	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
 		return "", argv
@@ -46,7 +88,12 @@ func separateSub(argv []string) (string, []string) {
 
 // Do the plugin
 func Do() {
-	subCmd, argv := separateSub(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
 	fn, ok := commands[subCmd]
 	if !ok {
 		fmt.Println(`Usage:
@@ -56,9 +103,11 @@ SubCommands:`)
 		for k := range commands {
 			fmt.Printf("  %s\n", k)
 		}
-		os.Exit(1)
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "PostgreSQL"
+		return ckr
 	}
 	ckr := fn(argv)
 	ckr.Name = fmt.Sprintf("PostgreSQL %s", strings.Title(subCmd))
-	ckr.Exit()
+	return ckr
 }
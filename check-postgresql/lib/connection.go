@@ -1,9 +1,7 @@
 package checkpostgresql
 
 import (
-	"database/sql"
 	"fmt"
-	"os"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
@@ -21,17 +19,20 @@ func checkConnection(args []string) *checkers.Checker {
 	psr.Usage = "connection [OPTIONS]"
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
-	db, err := sql.Open(opts.getDriverAndDataSourceName())
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
 	defer db.Close()
 
 	statActivityCount := 0
-	err = db.QueryRow("SELECT COUNT(*) AS cnt FROM pg_stat_activity").Scan(&statActivityCount)
+	err = queryRow(db, "SELECT COUNT(*) AS cnt FROM pg_stat_activity", &statActivityCount)
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
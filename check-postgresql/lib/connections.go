@@ -0,0 +1,52 @@
+package checkpostgresql
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type connectionsOpts struct {
+	postgresqlSetting
+	Warn float64 `short:"w" long:"warning" default:"80" description:"warning if the percentage of connections to max_connections is over"`
+	Crit float64 `short:"c" long:"critical" default:"90" description:"critical if the percentage of connections to max_connections is over"`
+}
+
+func checkConnections(args []string) *checkers.Checker {
+	opts := connectionsOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "connections [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	var numBackends, maxConnections int64
+	err = queryRow(db, "SELECT SUM(numbackends), current_setting('max_connections')::int FROM pg_stat_database", &numBackends, &maxConnections)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if maxConnections == 0 {
+		return checkers.Unknown("max_connections is 0")
+	}
+
+	usage := float64(numBackends) / float64(maxConnections) * 100
+	checkSt := checkers.OK
+	msg := fmt.Sprintf("%d of %d connections used (%.1f%%)", numBackends, maxConnections, usage)
+	if usage > opts.Crit {
+		checkSt = checkers.CRITICAL
+	} else if usage > opts.Warn {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
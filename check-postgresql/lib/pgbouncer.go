@@ -0,0 +1,209 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+type pgbouncerOpts struct {
+	postgresqlSetting
+	WarnWaiting    *int64   `long:"warning-waiting" value-name:"N" description:"warning if the clients waiting for a server connection in any pool are over"`
+	CritWaiting    *int64   `long:"critical-waiting" value-name:"N" description:"critical if the clients waiting for a server connection in any pool are over"`
+	WarnSaturation *float64 `long:"warning-saturation" value-name:"PERCENT" description:"warning if the active server connections of any pool are over the percentage of its pool_size"`
+	CritSaturation *float64 `long:"critical-saturation" value-name:"PERCENT" description:"critical if the active server connections of any pool are over the percentage of its pool_size"`
+	WarnAvgQuery   *float64 `long:"warning-avg-query" value-name:"MILLISECONDS" description:"warning if the average query time of any database is over"`
+	CritAvgQuery   *float64 `long:"critical-avg-query" value-name:"MILLISECONDS" description:"critical if the average query time of any database is over"`
+}
+
+// pgbouncerPool is a pool of a pair of a database and a user in SHOW POOLS.
+type pgbouncerPool struct {
+	database  string
+	user      string
+	clWaiting int64
+	svActive  int64
+	poolSize  int64 // pool_size of the database in SHOW DATABASES
+}
+
+// pgbouncerStat is the average query time of a database in SHOW STATS.
+type pgbouncerStat struct {
+	database string
+	avgQuery float64 // milliseconds
+}
+
+// adminDatabase is the name of the admin console of PgBouncer.
+const adminDatabase = "pgbouncer"
+
+func checkPgbouncer(args []string) *checkers.Checker {
+	opts := pgbouncerOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "pgbouncer [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.Database == "" {
+		opts.Database = adminDatabase
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	pools, stats, err := getPgbouncerStats(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(pools, stats)
+}
+
+// showRows executes a SHOW command of the admin console, and returns the rows as maps of the columns,
+// since the columns differ between the versions of PgBouncer.
+func showRows(db *sql.DB, query string) ([]map[string]string, error) {
+	end := debuglog.Trace("sql: %s", query)
+	rows, err := db.Query(query)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(cols))
+		for i, c := range cols {
+			row[c] = values[i].String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func parseInt(row map[string]string, name string) int64 {
+	n, _ := strconv.ParseInt(row[name], 10, 64)
+	return n
+}
+
+func getPgbouncerStats(db *sql.DB) ([]pgbouncerPool, []pgbouncerStat, error) {
+	databases, err := showRows(db, "SHOW DATABASES")
+	if err != nil {
+		return nil, nil, err
+	}
+	poolSizes := make(map[string]int64)
+	for _, d := range databases {
+		poolSizes[d["name"]] = parseInt(d, "pool_size")
+	}
+
+	rows, err := showRows(db, "SHOW POOLS")
+	if err != nil {
+		return nil, nil, err
+	}
+	var pools []pgbouncerPool
+	for _, r := range rows {
+		if r["database"] == adminDatabase {
+			continue
+		}
+		pools = append(pools, pgbouncerPool{
+			database:  r["database"],
+			user:      r["user"],
+			clWaiting: parseInt(r, "cl_waiting"),
+			svActive:  parseInt(r, "sv_active"),
+			poolSize:  poolSizes[r["database"]],
+		})
+	}
+
+	rows, err = showRows(db, "SHOW STATS")
+	if err != nil {
+		return nil, nil, err
+	}
+	var stats []pgbouncerStat
+	for _, r := range rows {
+		if r["database"] == adminDatabase {
+			continue
+		}
+		// PgBouncer 1.7 or earlier names avg_query_time avg_query.
+		v, ok := r["avg_query_time"]
+		if !ok {
+			v = r["avg_query"]
+		}
+		us, _ := strconv.ParseFloat(v, 64)
+		stats = append(stats, pgbouncerStat{database: r["database"], avgQuery: us / 1000})
+	}
+	return pools, stats, nil
+}
+
+// evaluate checks the waiting clients and the saturation of each pool, and the average query time of each database.
+func (opts *pgbouncerOpts) evaluate(pools []pgbouncerPool, stats []pgbouncerStat) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	var msgs []string
+	var waiting int64
+	var maxSaturation float64
+	for _, p := range pools {
+		waiting += p.clWaiting
+		name := p.database + "/" + p.user
+		if opts.CritWaiting != nil && p.clWaiting > *opts.CritWaiting {
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("pool %s has %d waiting clients", name, p.clWaiting))
+		} else if opts.WarnWaiting != nil && p.clWaiting > *opts.WarnWaiting {
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("pool %s has %d waiting clients", name, p.clWaiting))
+		}
+
+		if p.poolSize <= 0 {
+			continue
+		}
+		saturation := float64(p.svActive) * 100 / float64(p.poolSize)
+		if saturation > maxSaturation {
+			maxSaturation = saturation
+		}
+		if opts.CritSaturation != nil && saturation > *opts.CritSaturation {
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("pool %s is %.1f%% saturated (%d/%d)", name, saturation, p.svActive, p.poolSize))
+		} else if opts.WarnSaturation != nil && saturation > *opts.WarnSaturation {
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("pool %s is %.1f%% saturated (%d/%d)", name, saturation, p.svActive, p.poolSize))
+		}
+	}
+
+	for _, s := range stats {
+		if opts.CritAvgQuery != nil && s.avgQuery > *opts.CritAvgQuery {
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("database %s takes %.1fms per query on average", s.database, s.avgQuery))
+		} else if opts.WarnAvgQuery != nil && s.avgQuery > *opts.WarnAvgQuery {
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("database %s takes %.1fms per query on average", s.database, s.avgQuery))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("%d pools, %d waiting clients, max saturation %.1f%%", len(pools), waiting, maxSaturation))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
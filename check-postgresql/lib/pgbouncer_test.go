@@ -0,0 +1,45 @@
+package checkpostgresql
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPgbouncerEvaluate(t *testing.T) {
+	i := func(v int64) *int64 { return &v }
+	f := func(v float64) *float64 { return &v }
+	opts := pgbouncerOpts{
+		WarnWaiting: i(0), CritWaiting: i(10),
+		WarnSaturation: f(80), CritSaturation: f(95),
+		WarnAvgQuery: f(100), CritAvgQuery: f(500),
+	}
+	pools := []pgbouncerPool{
+		{database: "app", user: "web", svActive: 10, poolSize: 20},
+		{database: "app", user: "batch", svActive: 2, poolSize: 20},
+	}
+	stats := []pgbouncerStat{{database: "app", avgQuery: 12.5}}
+
+	ckr := opts.evaluate(pools, stats)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "2 pools, 0 waiting clients, max saturation 50.0%", ckr.Message)
+
+	pools[0].clWaiting = 3
+	pools[0].svActive = 17
+	ckr = opts.evaluate(pools, stats)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Equal(t, "pool app/web has 3 waiting clients, pool app/web is 85.0% saturated (17/20)", ckr.Message)
+
+	pools[0].clWaiting = 11
+	ckr = opts.evaluate(pools, stats)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+
+	ckr = opts.evaluate(nil, []pgbouncerStat{{database: "app", avgQuery: 600}})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "database app takes 600.0ms per query on average", ckr.Message)
+
+	// a pool of the database without pool_size, such as with auth_query
+	ckr = (&pgbouncerOpts{}).evaluate([]pgbouncerPool{{database: "app", user: "web", svActive: 5}}, nil)
+	assert.Equal(t, checkers.OK, ckr.Status)
+}
@@ -0,0 +1,66 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type queryOpts struct {
+	postgresqlSetting
+	Query    string   `short:"q" long:"query" required:"true" description:"SQL which returns a single numeric value"`
+	Warn     *float64 `short:"w" long:"warning" description:"warning if the value is over"`
+	Crit     *float64 `short:"c" long:"critical" description:"critical if the value is over"`
+	LessThan bool     `long:"less-than" description:"Alert if the value is less than the thresholds instead"`
+}
+
+func checkQuery(args []string) *checkers.Checker {
+	opts := queryOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "query [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	var value sql.NullFloat64
+	err = queryRow(db, opts.Query, &value)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if !value.Valid {
+		return checkers.Unknown("the query returned NULL")
+	}
+	return opts.evaluate(value.Float64)
+}
+
+func (opts *queryOpts) exceeds(value float64, threshold *float64) bool {
+	if threshold == nil {
+		return false
+	}
+	if opts.LessThan {
+		return value < *threshold
+	}
+	return value > *threshold
+}
+
+func (opts *queryOpts) evaluate(value float64) *checkers.Checker {
+	checkSt := checkers.OK
+	if opts.exceeds(value, opts.Crit) {
+		checkSt = checkers.CRITICAL
+	} else if opts.exceeds(value, opts.Warn) {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("value %g", value))
+}
@@ -0,0 +1,30 @@
+package checkpostgresql
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryEvaluate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		opts  queryOpts
+		value float64
+		want  checkers.Status
+	}{
+		{opts: queryOpts{}, value: 100, want: checkers.OK},
+		{opts: queryOpts{Warn: f(10), Crit: f(20)}, value: 5, want: checkers.OK},
+		{opts: queryOpts{Warn: f(10), Crit: f(20)}, value: 15, want: checkers.WARNING},
+		{opts: queryOpts{Warn: f(10), Crit: f(20)}, value: 25, want: checkers.CRITICAL},
+		{opts: queryOpts{Crit: f(20)}, value: 15, want: checkers.OK},
+		{opts: queryOpts{Warn: f(10), Crit: f(5), LessThan: true}, value: 12, want: checkers.OK},
+		{opts: queryOpts{Warn: f(10), Crit: f(5), LessThan: true}, value: 7, want: checkers.WARNING},
+		{opts: queryOpts{Warn: f(10), Crit: f(5), LessThan: true}, value: 0, want: checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(tt.value)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
@@ -0,0 +1,178 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type slotsOpts struct {
+	postgresqlSetting
+	WarnLag      *int64 `long:"warning-lag" value-name:"BYTES" description:"warning if restart_lsn of any slot lags behind the current WAL position by more than the bytes"`
+	CritLag      *int64 `long:"critical-lag" value-name:"BYTES" description:"critical if restart_lsn of any slot lags behind the current WAL position by more than the bytes"`
+	WarnInactive *int64 `long:"warning-inactive" value-name:"MINUTES" description:"warning if any slot has been inactive for more than the minutes"`
+	CritInactive *int64 `long:"critical-inactive" value-name:"MINUTES" description:"critical if any slot has been inactive for more than the minutes"`
+	StateDir     string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+type slotStat struct {
+	name          string
+	slotType      string
+	active        bool
+	lag           sql.NullInt64 // bytes, NULL if restart_lsn is NULL
+	inactiveSince sql.NullTime
+}
+
+// slotsState is the time when each slot was found inactive,
+// which is tracked by the plugin on PostgreSQL 16 or earlier.
+type slotsState struct {
+	InactiveSince map[string]int64 `json:"inactive_since"`
+}
+
+func checkSlots(args []string) *checkers.Checker {
+	opts := slotsOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "slots [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	slots, err := getSlotStats(db)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-postgresql"))
+	var prev *slotsState
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	now := time.Now()
+	if err := state.Save(stateFile, trackInactive(slots, prev, now)); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(slots, now)
+}
+
+// getSlotStats returns the replication slots.
+// inactive_since of pg_replication_slots is available on PostgreSQL 17 or later.
+func getSlotStats(db *sql.DB) ([]*slotStat, error) {
+	var version int
+	if err := queryRow(db, "SELECT current_setting('server_version_num')::int", &version); err != nil {
+		return nil, err
+	}
+	inactiveSince := "NULL::timestamptz"
+	if version >= 170000 {
+		inactiveSince = "inactive_since"
+	}
+	query := fmt.Sprintf(`SELECT slot_name, slot_type, active,
+		pg_wal_lsn_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn() ELSE pg_current_wal_lsn() END, restart_lsn)::bigint,
+		%s
+		FROM pg_replication_slots ORDER BY slot_name`, inactiveSince)
+	end := debuglog.Trace("sql: %s", query)
+	rows, err := db.Query(query)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []*slotStat
+	for rows.Next() {
+		var s slotStat
+		if err := rows.Scan(&s.name, &s.slotType, &s.active, &s.lag, &s.inactiveSince); err != nil {
+			return nil, err
+		}
+		slots = append(slots, &s)
+	}
+	return slots, rows.Err()
+}
+
+func (opts *slotsOpts) stateFile(stateDir string) string {
+	return state.File(stateDir, "slots", strings.Join([]string{opts.Host, opts.Port}, ":"))
+}
+
+// trackInactive fills inactiveSince of the inactive slots which the server doesn't provide,
+// with the time when they were found inactive first, and returns the state to save.
+func trackInactive(slots []*slotStat, prev *slotsState, now time.Time) *slotsState {
+	next := &slotsState{InactiveSince: make(map[string]int64)}
+	for _, s := range slots {
+		if s.active || s.inactiveSince.Valid {
+			continue
+		}
+		since := now.Unix()
+		if prev != nil {
+			if t, ok := prev.InactiveSince[s.name]; ok {
+				since = t
+			}
+		}
+		next.InactiveSince[s.name] = since
+		s.inactiveSince = sql.NullTime{Time: time.Unix(since, 0), Valid: true}
+	}
+	return next
+}
+
+// evaluate checks the lag of restart_lsn and the inactive duration of each slot.
+func (opts *slotsOpts) evaluate(slots []*slotStat, now time.Time) *checkers.Checker {
+	if len(slots) == 0 {
+		return checkers.Ok("no replication slots")
+	}
+
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	var msgs []string
+	var maxLag int64
+	for _, s := range slots {
+		var problems []string
+		if s.lag.Valid {
+			if s.lag.Int64 > maxLag {
+				maxLag = s.lag.Int64
+			}
+			if opts.CritLag != nil && s.lag.Int64 > *opts.CritLag {
+				raise(checkers.CRITICAL)
+				problems = append(problems, fmt.Sprintf("lags %d bytes", s.lag.Int64))
+			} else if opts.WarnLag != nil && s.lag.Int64 > *opts.WarnLag {
+				raise(checkers.WARNING)
+				problems = append(problems, fmt.Sprintf("lags %d bytes", s.lag.Int64))
+			}
+		}
+		if !s.active && s.inactiveSince.Valid {
+			inactive := now.Sub(s.inactiveSince.Time)
+			if opts.CritInactive != nil && inactive > time.Duration(*opts.CritInactive)*time.Minute {
+				raise(checkers.CRITICAL)
+				problems = append(problems, fmt.Sprintf("inactive for %d minutes", int64(inactive.Minutes())))
+			} else if opts.WarnInactive != nil && inactive > time.Duration(*opts.WarnInactive)*time.Minute {
+				raise(checkers.WARNING)
+				problems = append(problems, fmt.Sprintf("inactive for %d minutes", int64(inactive.Minutes())))
+			}
+		}
+		if len(problems) > 0 {
+			msgs = append(msgs, fmt.Sprintf("%s slot %s %s", s.slotType, s.name, strings.Join(problems, " and ")))
+		}
+	}
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("%d replication slots, max lag %d bytes", len(slots), maxLag))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
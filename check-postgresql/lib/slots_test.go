@@ -0,0 +1,136 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotsEvaluate(t *testing.T) {
+	i := func(v int64) *int64 { return &v }
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	lag := func(v int64) sql.NullInt64 { return sql.NullInt64{Int64: v, Valid: true} }
+	since := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-d), Valid: true} }
+	opts := slotsOpts{WarnLag: i(1 << 20), CritLag: i(1 << 30), WarnInactive: i(10), CritInactive: i(60)}
+
+	tests := []struct {
+		name  string
+		opts  slotsOpts
+		slots []*slotStat
+		want  checkers.Status
+	}{
+		{
+			name: "no slots",
+			opts: opts,
+			want: checkers.OK,
+		},
+		{
+			name: "active slots",
+			opts: opts,
+			slots: []*slotStat{
+				{name: "standby1", slotType: "physical", active: true, lag: lag(1024)},
+				{name: "sub1", slotType: "logical", active: true, lag: lag(4096)},
+			},
+			want: checkers.OK,
+		},
+		{
+			name: "lagging slot",
+			opts: opts,
+			slots: []*slotStat{
+				{name: "sub1", slotType: "logical", active: true, lag: lag(2 << 20)},
+			},
+			want: checkers.WARNING,
+		},
+		{
+			name: "forgotten slot",
+			opts: opts,
+			slots: []*slotStat{
+				{name: "standby1", slotType: "physical", active: true, lag: lag(1024)},
+				{name: "old", slotType: "logical", lag: lag(2 << 30), inactiveSince: since(24 * time.Hour)},
+			},
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "inactive for a while",
+			opts: opts,
+			slots: []*slotStat{
+				{name: "sub1", slotType: "logical", lag: lag(1024), inactiveSince: since(15 * time.Minute)},
+			},
+			want: checkers.WARNING,
+		},
+		{
+			name: "without thresholds",
+			slots: []*slotStat{
+				{name: "old", slotType: "logical", lag: lag(2 << 30), inactiveSince: since(24 * time.Hour)},
+			},
+			want: checkers.OK,
+		},
+		{
+			name: "slot without restart_lsn",
+			opts: opts,
+			slots: []*slotStat{
+				{name: "new", slotType: "physical"},
+			},
+			want: checkers.OK,
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(tt.slots, now)
+		assert.Equal(t, tt.want, ckr.Status, "%s: %s", tt.name, ckr.Message)
+	}
+}
+
+func TestTrackInactive(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	served := sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+	slots := []*slotStat{
+		{name: "active", active: true},
+		{name: "known", active: false},
+		{name: "new", active: false},
+		{name: "served", active: false, inactiveSince: served},
+	}
+	prev := &slotsState{InactiveSince: map[string]int64{
+		"known":  now.Add(-30 * time.Minute).Unix(),
+		"active": now.Add(-30 * time.Minute).Unix(),
+	}}
+
+	next := trackInactive(slots, prev, now)
+	assert.Equal(t, map[string]int64{
+		"known": now.Add(-30 * time.Minute).Unix(),
+		"new":   now.Unix(),
+	}, next.InactiveSince)
+	assert.False(t, slots[0].inactiveSince.Valid)
+	assert.Equal(t, now.Add(-30*time.Minute).Unix(), slots[1].inactiveSince.Time.Unix())
+	assert.Equal(t, now.Unix(), slots[2].inactiveSince.Time.Unix())
+	assert.Equal(t, served, slots[3].inactiveSince, "inactive_since of the server should be used")
+}
+
+func TestSlotsState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := slotsOpts{postgresqlSetting: postgresqlSetting{Host: "localhost", Port: "5432"}}
+	file := opts.stateFile(filepath.Join(dir, "state"))
+
+	var s *slotsState
+	_, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	assert.Nil(t, state.Save(file, &slotsState{InactiveSince: map[string]int64{"old": 100}}))
+	_, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	if assert.NotNil(t, s) {
+		assert.Equal(t, int64(100), s.InactiveSince["old"])
+	}
+}
@@ -0,0 +1,191 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+type vacuumOpts struct {
+	postgresqlSetting
+	WarnWraparound float64  `long:"warning-wraparound" value-name:"PERCENT" default:"80" description:"warning if age(datfrozenxid) of any database is over the percentage of autovacuum_freeze_max_age"`
+	CritWraparound float64  `long:"critical-wraparound" value-name:"PERCENT" default:"100" description:"critical if age(datfrozenxid) of any database is over the percentage of autovacuum_freeze_max_age"`
+	Tables         []string `long:"table" value-name:"[SCHEMA.]NAME" description:"Table in --database to check the last autovacuum of (may be repeated)"`
+	WarnVacuumAge  *int64   `long:"warning-vacuum-age" value-name:"HOURS" description:"warning if any of the tables hasn't been autovacuumed for more than the hours"`
+	CritVacuumAge  *int64   `long:"critical-vacuum-age" value-name:"HOURS" description:"critical if any of the tables hasn't been autovacuumed for more than the hours"`
+}
+
+type vacuumStat struct {
+	autovacuum   string
+	freezeMaxAge int64
+	databases    []databaseAge
+	tables       []tableVacuum
+}
+
+// databaseAge is the age of the oldest unfrozen transaction ID in a database.
+type databaseAge struct {
+	name string
+	age  int64
+}
+
+// tableVacuum is the time when a table was vacuumed last by autovacuum,
+// which is NULL if it has never been autovacuumed since the statistics were reset.
+// The vacuums by hand are not counted, because they don't tell whether autovacuum keeps up with the table.
+type tableVacuum struct {
+	name           string
+	lastAutovacuum sql.NullTime
+	inProgress     bool // a vacuum of the table is running, as shown in pg_stat_progress_vacuum
+}
+
+func checkVacuum(args []string) *checkers.Checker {
+	opts := vacuumOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "vacuum [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.postgresqlSetting.selfTest()
+	}
+	db, err := opts.open()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer db.Close()
+
+	st, err := getVacuumStat(db, opts.Tables)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st, time.Now())
+}
+
+func getVacuumStat(db *sql.DB, tables []string) (*vacuumStat, error) {
+	var st vacuumStat
+	if err := queryRow(db, "SELECT current_setting('autovacuum'), current_setting('autovacuum_freeze_max_age')::bigint", &st.autovacuum, &st.freezeMaxAge); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT datname, age(datfrozenxid) FROM pg_database ORDER BY datname"
+	end := debuglog.Trace("sql: %s", query)
+	rows, err := db.Query(query)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d databaseAge
+		if err := rows.Scan(&d.name, &d.age); err != nil {
+			return nil, err
+		}
+		st.databases = append(st.databases, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// pg_stat_progress_vacuum is available on PostgreSQL 9.6 or later
+	query = `SELECT s.last_autovacuum, EXISTS (SELECT 1 FROM pg_stat_progress_vacuum p WHERE p.relid = s.relid)
+FROM pg_stat_user_tables s WHERE s.schemaname = $1 AND s.relname = $2`
+	for _, name := range tables {
+		schema, rel := "public", name
+		if i := strings.Index(name, "."); i >= 0 {
+			schema, rel = name[:i], name[i+1:]
+		}
+		t := tableVacuum{name: schema + "." + rel}
+		end := debuglog.Trace("sql: %s [%s %s]", query, schema, rel)
+		err := db.QueryRow(query, schema, rel).Scan(&t.lastAutovacuum, &t.inProgress)
+		end(err)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("table %s is not found in the database", t.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		st.tables = append(st.tables, t)
+	}
+	return &st, nil
+}
+
+// evaluate checks the transaction ID age of each database against autovacuum_freeze_max_age,
+// at which autovacuum forces vacuums to prevent the wraparound, and the time since the last autovacuum of each table.
+func (opts *vacuumOpts) evaluate(st *vacuumStat, now time.Time) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	var msgs []string
+	if st.autovacuum != "on" {
+		raise(checkers.WARNING)
+		msgs = append(msgs, fmt.Sprintf("autovacuum is %s", st.autovacuum))
+	}
+
+	var oldest databaseAge
+	for _, d := range st.databases {
+		if d.age > oldest.age {
+			oldest = d
+		}
+		pct := float64(d.age) * 100 / float64(st.freezeMaxAge)
+		var s checkers.Status
+		switch {
+		case pct > opts.CritWraparound:
+			s = checkers.CRITICAL
+		case pct > opts.WarnWraparound:
+			s = checkers.WARNING
+		default:
+			continue
+		}
+		raise(s)
+		msgs = append(msgs, fmt.Sprintf("database %s is at %.1f%% of autovacuum_freeze_max_age (age %d)", d.name, pct, d.age))
+	}
+
+	for _, t := range st.tables {
+		var age time.Duration
+		if t.lastAutovacuum.Valid {
+			age = now.Sub(t.lastAutovacuum.Time)
+		}
+		over := func(hours *int64) bool {
+			return hours != nil && (!t.lastAutovacuum.Valid || age > time.Duration(*hours)*time.Hour)
+		}
+		var s checkers.Status
+		switch {
+		case over(opts.CritVacuumAge):
+			s = checkers.CRITICAL
+		case over(opts.WarnVacuumAge):
+			s = checkers.WARNING
+		default:
+			continue
+		}
+		raise(s)
+		var msg string
+		if t.lastAutovacuum.Valid {
+			msg = fmt.Sprintf("table %s hasn't been autovacuumed for %d hours", t.name, int64(age.Hours()))
+		} else {
+			msg = fmt.Sprintf("table %s has never been autovacuumed", t.name)
+		}
+		if t.inProgress {
+			msg += " (a vacuum is in progress)"
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) == 0 {
+		msg := fmt.Sprintf("max age(datfrozenxid) %d (%.1f%% of autovacuum_freeze_max_age)", oldest.age, float64(oldest.age)*100/float64(st.freezeMaxAge))
+		if len(st.tables) > 0 {
+			msg += fmt.Sprintf(", %d tables checked", len(st.tables))
+		}
+		return checkers.Ok(msg)
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,77 @@
+package checkpostgresql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVacuumEvaluate(t *testing.T) {
+	i := func(v int64) *int64 { return &v }
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	vacuumed := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(-d), Valid: true} }
+	opts := vacuumOpts{WarnWraparound: 80, CritWraparound: 100, WarnVacuumAge: i(24), CritVacuumAge: i(72)}
+	databases := []databaseAge{{"app", 60000000}, {"postgres", 1000}}
+	tables := []tableVacuum{{"public.orders", vacuumed(2 * time.Hour), false}}
+
+	tests := []struct {
+		name string
+		st   vacuumStat
+		want checkers.Status
+		msg  string
+	}{
+		{
+			name: "healthy",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: databases, tables: tables},
+			want: checkers.OK,
+			msg:  "max age(datfrozenxid) 60000000 (30.0% of autovacuum_freeze_max_age), 1 tables checked",
+		},
+		{
+			name: "approaching wraparound",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: []databaseAge{{"app", 170000000}}},
+			want: checkers.WARNING,
+			msg:  "database app is at 85.0% of autovacuum_freeze_max_age (age 170000000)",
+		},
+		{
+			name: "forced vacuums don't catch up",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: []databaseAge{{"app", 250000000}}},
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "autovacuum off",
+			st:   vacuumStat{autovacuum: "off", freezeMaxAge: 200000000, databases: databases},
+			want: checkers.WARNING,
+			msg:  "autovacuum is off",
+		},
+		{
+			name: "table not autovacuumed",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: databases, tables: []tableVacuum{{"public.orders", vacuumed(30 * time.Hour), false}}},
+			want: checkers.WARNING,
+			msg:  "table public.orders hasn't been autovacuumed for 30 hours",
+		},
+		{
+			name: "table being vacuumed",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: databases, tables: []tableVacuum{{"public.orders", vacuumed(80 * time.Hour), true}}},
+			want: checkers.CRITICAL,
+			msg:  "table public.orders hasn't been autovacuumed for 80 hours (a vacuum is in progress)",
+		},
+		{
+			name: "table never autovacuumed",
+			st:   vacuumStat{autovacuum: "on", freezeMaxAge: 200000000, databases: databases, tables: []tableVacuum{{"public.sessions", sql.NullTime{}, false}}},
+			want: checkers.CRITICAL,
+			msg:  "table public.sessions has never been autovacuumed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckr := opts.evaluate(&tt.st, now)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+			if tt.msg != "" {
+				assert.Equal(t, tt.msg, ckr.Message)
+			}
+		})
+	}
+}
@@ -28,4 +28,7 @@ docker run -d \
 trap 'docker stop test-$plugin; docker rm test-$plugin; exit' EXIT
 sleep 10
 
+$plugin connections --port $port --user=$user --password=$password || exit
+$plugin query --port $port --user=$user --password=$password --query='SELECT 1' --critical=0 --less-than || exit
+
 exec $plugin connection --port $port --user=$user --password=$password
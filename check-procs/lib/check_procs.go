@@ -1,40 +1,53 @@
 package checkprocs
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 // https://github.com/sensu-plugins/sensu-plugins-process-checks
-var opts struct {
-	WarningOver   *int64   `short:"w" long:"warning-over" value-name:"N" description:"Trigger a warning if over a number"`
-	WarnOver      *int64   `long:"warn-over" value-name:"N" description:"(DEPRECATED) Trigger a warning if over a number"`
-	CritOver      *int64   `short:"c" long:"critical-over" value-name:"N" description:"Trigger a critical if over a number"`
-	WarningUnder  int64    `short:"W" long:"warning-under" value-name:"N" default:"1" description:"Trigger a warning if under a number"`
-	WarnUnder     int64    `long:"warn-under" value-name:"N" default:"1" description:"(DEPRECATED) Trigger a warning if under a number"`
-	CritUnder     int64    `short:"C" long:"critical-under" value-name:"N" default:"1" description:"Trigger a critial if under a number"`
-	MatchSelf     bool     `short:"m" long:"match-self" description:"Match itself"`
-	MatchParent   bool     `short:"M" long:"match-parent" description:"Match parent"`
-	CmdPatterns   []string `short:"p" long:"pattern" value-name:"PATTERN" description:"Match a command against these patterns"`
-	CmdExcludePat string   `short:"x" long:"exclude-pattern" value-name:"PATTERN" description:"Don't match against a pattern to prevent false positives"`
-	Ppid          string   `long:"ppid" value-name:"PPID" description:"Check against a specific PPID"`
-	FilePid       string   `short:"f" long:"file-pid" value-name:"PID" description:"Check against a specific PID"`
-	Vsz           int64    `short:"z" long:"virtual-memory-size" value-name:"VSZ" description:"Trigger on a Virtual Memory size is bigger than this"`
-	Rss           int64    `short:"r" long:"resident-set-size" value-name:"RSS" description:"Trigger on a Resident Set size is bigger than this"`
-	Pcpu          float64  `short:"P" long:"proportional-set-size" value-name:"PCPU" description:"Trigger on a Proportional Set Size is bigger than this"`
-	Thcount       int64    `short:"T" long:"thread-count" value-name:"THCOUNT" description:"Trigger on a Thread Count is bigger than this"`
-	State         string   `short:"s" long:"state" value-name:"STATE" description:"Trigger on a specific state, example: Z for zombie"`
-	User          string   `short:"u" long:"user" value-name:"USER" description:"Trigger on a specific user"`
-	Usernot       string   `short:"U" long:"user-not" value-name:"USER" description:"Trigger if not owned a specific user"`
-	EsecOver      int64    `short:"e" long:"esec-over" value-name:"SECONDS" description:"Match processes that older that this, in SECONDS"`
-	EsecUnder     int64    `short:"E" long:"esec-under" value-name:"SECONDS" description:"Match process that are younger than this, in SECONDS"`
-	CPUOver       int64    `short:"i" long:"cpu-over" value-name:"SECONDS" description:"Match processes cpu time that is older than this, in SECONDS"`
-	CPUUnder      int64    `short:"I" long:"cpu-under" value-name:"SECONDS" description:"Match processes cpu time that is younger than this, in SECONDS"`
+type procsOpts struct {
+	WarningOver   *int64        `short:"w" long:"warning-over" value-name:"N" description:"Trigger a warning if over a number"`
+	WarnOver      *int64        `long:"warn-over" value-name:"N" description:"(DEPRECATED) Trigger a warning if over a number"`
+	CritOver      *int64        `short:"c" long:"critical-over" value-name:"N" description:"Trigger a critical if over a number"`
+	WarningUnder  int64         `short:"W" long:"warning-under" value-name:"N" default:"1" description:"Trigger a warning if under a number"`
+	WarnUnder     int64         `long:"warn-under" value-name:"N" default:"1" description:"(DEPRECATED) Trigger a warning if under a number"`
+	CritUnder     int64         `short:"C" long:"critical-under" value-name:"N" default:"1" description:"Trigger a critial if under a number"`
+	MatchSelf     bool          `short:"m" long:"match-self" description:"Match itself"`
+	MatchParent   bool          `short:"M" long:"match-parent" description:"Match parent"`
+	CmdPatterns   []string      `short:"p" long:"pattern" value-name:"PATTERN" description:"Match a command against these patterns"`
+	CmdExcludePat string        `short:"x" long:"exclude-pattern" value-name:"PATTERN" description:"Don't match against a pattern to prevent false positives"`
+	Ppid          string        `long:"ppid" value-name:"PPID" description:"Check against a specific PPID"`
+	FilePid       string        `short:"f" long:"file-pid" value-name:"PID" description:"Check against a specific PID"`
+	Vsz           int64         `short:"z" long:"virtual-memory-size" value-name:"VSZ" description:"Trigger on a Virtual Memory size is bigger than this"`
+	Rss           int64         `short:"r" long:"resident-set-size" value-name:"RSS" description:"Trigger on a Resident Set size is bigger than this"`
+	Pcpu          float64       `short:"P" long:"proportional-set-size" value-name:"PCPU" description:"Trigger on a Proportional Set Size is bigger than this"`
+	Thcount       int64         `short:"T" long:"thread-count" value-name:"THCOUNT" description:"Trigger on a Thread Count is bigger than this"`
+	State         string        `short:"s" long:"state" value-name:"STATE" description:"Trigger on a specific state, example: Z for zombie"`
+	User          string        `short:"u" long:"user" value-name:"USER" description:"Trigger on a specific user"`
+	Usernot       string        `short:"U" long:"user-not" value-name:"USER" description:"Trigger if not owned a specific user"`
+	EsecOver      int64         `short:"e" long:"esec-over" value-name:"SECONDS" description:"Match processes that older that this, in SECONDS"`
+	EsecUnder     int64         `short:"E" long:"esec-under" value-name:"SECONDS" description:"Match process that are younger than this, in SECONDS"`
+	CPUOver       int64         `short:"i" long:"cpu-over" value-name:"SECONDS" description:"Match processes cpu time that is older than this, in SECONDS"`
+	CPUUnder      int64         `short:"I" long:"cpu-under" value-name:"SECONDS" description:"Match processes cpu time that is younger than this, in SECONDS"`
+	FDWarning     *int64        `long:"fd-warning" value-name:"N" description:"Trigger a warning if any matched process has more open file descriptors than N (Linux only)"`
+	FDCritical    *int64        `long:"fd-critical" value-name:"N" description:"Trigger a critical if any matched process has more open file descriptors than N (Linux only)"`
+	ThWarning     *int64        `long:"thread-warning" value-name:"N" description:"Trigger a warning if any matched process has more threads than N"`
+	ThCritical    *int64        `long:"thread-critical" value-name:"N" description:"Trigger a critical if any matched process has more threads than N"`
+	ForbidPats    []string      `long:"forbid-pattern" value-name:"PATTERN" description:"Trigger a critical if any process matching these patterns is running"`
+	Grace         time.Duration `long:"grace" value-name:"DURATION" description:"Ignore the processes matching --forbid-pattern running for less than DURATION (e.g. 5m)"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 type procState struct {
@@ -53,16 +66,23 @@ type procState struct {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Procs"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &procsOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
+	opts.DebugOpts.Enable()
 
 	// for backward compatibility
 	if opts.WarnUnder != 1 && opts.WarningUnder == 1 {
@@ -72,10 +92,6 @@ func run(args []string) *checkers.Checker {
 		opts.WarningOver = opts.WarnOver
 	}
 
-	procs, err := getProcs()
-	if err != nil {
-		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
-	}
 	var cmdPatRegexp []*regexp.Regexp
 	for _, ptn := range opts.CmdPatterns {
 		r, err := regexp.Compile(ptn)
@@ -84,7 +100,16 @@ func run(args []string) *checkers.Checker {
 		}
 		cmdPatRegexp = append(cmdPatRegexp, r)
 	}
-	if len(cmdPatRegexp) == 0 {
+	var forbidPatRegexp []*regexp.Regexp
+	for _, ptn := range opts.ForbidPats {
+		r, err := regexp.Compile(ptn)
+		if err != nil {
+			return checkers.NewChecker(checkers.UNKNOWN, err.Error())
+		}
+		forbidPatRegexp = append(forbidPatRegexp, r)
+	}
+	// only the forbidden processes are checked unless --pattern is specified
+	if len(cmdPatRegexp) == 0 && len(forbidPatRegexp) == 0 {
 		cmdPatRegexp = append(cmdPatRegexp, regexp.MustCompile(".*"))
 	}
 	cmdExcludePatRegexp := regexp.MustCompile(".*")
@@ -95,27 +120,50 @@ func run(args []string) *checkers.Checker {
 		}
 		cmdExcludePatRegexp = r
 	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	procs, err := getProcs()
+	if err != nil {
+		return checkers.NewChecker(checkers.UNKNOWN, err.Error())
+	}
 	result := checkers.OK
 	var msg string
 
 	var resultrocStates []procState
 	for _, reg := range cmdPatRegexp {
 		for _, proc := range procs {
-			if matchProc(proc, reg, cmdExcludePatRegexp) {
+			if opts.matchProc(proc, reg, cmdExcludePatRegexp) {
 				resultrocStates = append(resultrocStates, proc)
 			}
 		}
 		count := int64(len(resultrocStates))
-		result = mergeStatus(count, result)
-		msg += fmt.Sprintf("\n%s", gatherMsg(count, reg.String()))
+		result = opts.mergeStatus(count, result)
+		msg += fmt.Sprintf("\n%s", opts.gatherMsg(count, reg.String()))
+
+		st, resMsg, err := opts.checkResources(resultrocStates)
+		if err != nil {
+			return checkers.NewChecker(checkers.UNKNOWN, err.Error())
+		}
+		if st > result {
+			result = st
+		}
+		msg += resMsg
 
 		resultrocStates = []procState{}
 	}
+
+	st, forbidMsg := opts.checkForbidden(procs, forbidPatRegexp, cmdExcludePatRegexp)
+	if st > result {
+		result = st
+	}
+	msg += forbidMsg
 	return checkers.NewChecker(result, msg)
 }
 
-func matchProc(proc procState, cmdPatRegexp *regexp.Regexp, cmdExcludePatRegexp *regexp.Regexp) bool {
-	return (len(opts.CmdPatterns) == 0 || cmdPatRegexp.MatchString(proc.cmd)) &&
+func (opts *procsOpts) matchProc(proc procState, cmdPatRegexp *regexp.Regexp, cmdExcludePatRegexp *regexp.Regexp) bool {
+	return cmdPatRegexp.MatchString(proc.cmd) &&
 		(opts.CmdExcludePat == "" || !cmdExcludePatRegexp.MatchString(proc.cmd)) &&
 		(opts.MatchSelf || proc.pid != strconv.Itoa(os.Getpid())) &&
 		(opts.MatchParent || proc.pid != strconv.Itoa(os.Getppid())) &&
@@ -134,7 +182,7 @@ func matchProc(proc procState, cmdPatRegexp *regexp.Regexp, cmdExcludePatRegexp
 		(opts.CPUOver == 0 || proc.csec > opts.CPUOver)
 }
 
-func gatherMsg(count int64, pattern string) string {
+func (opts *procsOpts) gatherMsg(count int64, pattern string) string {
 	msg := fmt.Sprintf("Found %d matching processes", count)
 	if len(opts.CmdPatterns) != 0 {
 		msg += fmt.Sprintf("; cmd /%s/", pattern)
@@ -181,7 +229,104 @@ func gatherMsg(count int64, pattern string) string {
 	return msg
 }
 
-func mergeStatus(count int64, current checkers.Status) checkers.Status {
+// errProcessGone is returned by countFDs if the process has exited since it was listed.
+var errProcessGone = errors.New("process has gone")
+
+// countFDsFunc is replaced in tests.
+var countFDsFunc = countFDs
+
+// checkResources checks the number of open file descriptors and threads of each process,
+// and returns the worst status and the maximum numbers.
+func (opts *procsOpts) checkResources(procs []procState) (checkers.Status, string, error) {
+	result := checkers.OK
+	var msg string
+	raise := func(n int64, warning, critical *int64) {
+		if critical != nil && n > *critical {
+			result = checkers.CRITICAL
+		} else if warning != nil && n > *warning && result == checkers.OK {
+			result = checkers.WARNING
+		}
+	}
+
+	if opts.FDWarning != nil || opts.FDCritical != nil {
+		var max int64 = -1
+		var maxPid string
+		var denied int
+		for _, proc := range procs {
+			n, err := countFDsFunc(proc.pid)
+			switch {
+			case err == errProcessGone:
+				continue
+			case errors.Is(err, os.ErrPermission):
+				denied++
+				continue
+			case err != nil:
+				return checkers.UNKNOWN, "", err
+			}
+			raise(n, opts.FDWarning, opts.FDCritical)
+			if n > max {
+				max, maxPid = n, proc.pid
+			}
+		}
+		if max >= 0 {
+			msg += fmt.Sprintf("; max fds %d (pid %s)", max, maxPid)
+		}
+		if denied > 0 {
+			msg += fmt.Sprintf("; fds of %d processes not readable (permission denied)", denied)
+			// the thresholds are not checked at all
+			if max < 0 && result == checkers.OK {
+				result = checkers.WARNING
+			}
+		}
+	}
+
+	if opts.ThWarning != nil || opts.ThCritical != nil {
+		var max int64 = -1
+		var maxPid string
+		for _, proc := range procs {
+			raise(proc.thcount, opts.ThWarning, opts.ThCritical)
+			if proc.thcount > max {
+				max, maxPid = proc.thcount, proc.pid
+			}
+		}
+		if max >= 0 {
+			msg += fmt.Sprintf("; max threads %d (pid %s)", max, maxPid)
+		}
+	}
+	return result, msg, nil
+}
+
+// checkForbidden returns CRITICAL if any process matching the forbidden patterns has been running for opts.Grace or more,
+// so that the short-lived invocations of them are ignored.
+func (opts *procsOpts) checkForbidden(procs []procState, patterns []*regexp.Regexp, cmdExcludePatRegexp *regexp.Regexp) (checkers.Status, string) {
+	result := checkers.OK
+	var msg string
+	for _, reg := range patterns {
+		var pids []string
+		var young int
+		for _, proc := range procs {
+			if !opts.matchProc(proc, reg, cmdExcludePatRegexp) {
+				continue
+			}
+			if time.Duration(proc.esec)*time.Second < opts.Grace {
+				young++
+				continue
+			}
+			pids = append(pids, proc.pid)
+		}
+		msg += fmt.Sprintf("\nFound %d forbidden processes; cmd /%s/", len(pids), reg)
+		if len(pids) > 0 {
+			result = checkers.CRITICAL
+			msg += fmt.Sprintf("; pid %s", strings.Join(pids, ", "))
+		}
+		if young > 0 {
+			msg += fmt.Sprintf("; %d younger than %s ignored", young, opts.Grace)
+		}
+	}
+	return result, msg
+}
+
+func (opts *procsOpts) mergeStatus(count int64, current checkers.Status) checkers.Status {
 	result := checkers.OK
 	if opts.CritUnder != 0 && count < opts.CritUnder ||
 		opts.CritOver != nil && count > *opts.CritOver {
@@ -0,0 +1,31 @@
+package checkprocs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// countFDs returns the number of open file descriptors of the process.
+// It needs the same user as the process or root.
+// errProcessGone is returned if the process has exited since it was listed.
+func countFDs(pid string) (int64, error) {
+	d, err := os.Open(fmt.Sprintf("/proc/%s/fd", pid))
+	if err != nil {
+		return 0, fdError(err)
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return 0, fdError(err)
+	}
+	return int64(len(names)), nil
+}
+
+func fdError(err error) error {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH) {
+		return errProcessGone
+	}
+	return fmt.Errorf("failed to count file descriptors: %w", err)
+}
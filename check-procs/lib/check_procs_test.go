@@ -1,9 +1,14 @@
 package checkprocs
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
 	"runtime"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/mackerelio/checkers"
 	"github.com/stretchr/testify/assert"
@@ -54,27 +59,121 @@ func TestMergeStatus(t *testing.T) {
 	var WarningUnder int64 = 40
 	var CritUnder int64 = 10
 
-	opts.CritOver = &CritOver
-	opts.WarningOver = &WarningOver
-	opts.WarningUnder = WarningUnder
-	opts.CritUnder = CritUnder
-
-	assert.Equal(t, checkers.OK, mergeStatus(80, checkers.OK))
-	assert.Equal(t, checkers.WARNING, mergeStatus(81, checkers.OK))
-	assert.Equal(t, checkers.WARNING, mergeStatus(100, checkers.OK))
-	assert.Equal(t, checkers.CRITICAL, mergeStatus(101, checkers.OK))
-	assert.Equal(t, checkers.OK, mergeStatus(40, checkers.OK))
-	assert.Equal(t, checkers.WARNING, mergeStatus(39, checkers.OK))
-	assert.Equal(t, checkers.WARNING, mergeStatus(10, checkers.OK))
-	assert.Equal(t, checkers.CRITICAL, mergeStatus(9, checkers.OK))
+	opts := &procsOpts{
+		CritOver:     &CritOver,
+		WarningOver:  &WarningOver,
+		WarningUnder: WarningUnder,
+		CritUnder:    CritUnder,
+	}
+
+	assert.Equal(t, checkers.OK, opts.mergeStatus(80, checkers.OK))
+	assert.Equal(t, checkers.WARNING, opts.mergeStatus(81, checkers.OK))
+	assert.Equal(t, checkers.WARNING, opts.mergeStatus(100, checkers.OK))
+	assert.Equal(t, checkers.CRITICAL, opts.mergeStatus(101, checkers.OK))
+	assert.Equal(t, checkers.OK, opts.mergeStatus(40, checkers.OK))
+	assert.Equal(t, checkers.WARNING, opts.mergeStatus(39, checkers.OK))
+	assert.Equal(t, checkers.WARNING, opts.mergeStatus(10, checkers.OK))
+	assert.Equal(t, checkers.CRITICAL, opts.mergeStatus(9, checkers.OK))
 }
 
 func TestGatherMsg(t *testing.T) {
 	var count int64 = 1
-	opts.CmdPatterns = []string{"foo", "bar"}
+	opts := &procsOpts{CmdPatterns: []string{"foo", "bar"}}
 
 	for _, pattern := range opts.CmdPatterns {
 		expected := fmt.Sprintf("Found %d matching processes; cmd /%s/", count, pattern)
-		assert.Equal(t, expected, gatherMsg(count, pattern))
+		assert.Equal(t, expected, opts.gatherMsg(count, pattern))
 	}
 }
+
+func TestCheckResources(t *testing.T) {
+	var ThCritical int64 = 100
+	var ThWarning int64 = 50
+	opts := &procsOpts{ThCritical: &ThCritical, ThWarning: &ThWarning}
+
+	procs := []procState{{pid: "10", thcount: 20}, {pid: "11", thcount: 60}}
+	st, msg, err := opts.checkResources(procs)
+	assert.Nil(t, err)
+	assert.Equal(t, checkers.WARNING, st)
+	assert.Equal(t, "; max threads 60 (pid 11)", msg)
+
+	procs = append(procs, procState{pid: "12", thcount: 101})
+	st, _, _ = opts.checkResources(procs)
+	assert.Equal(t, checkers.CRITICAL, st)
+
+	st, msg, _ = opts.checkResources(nil)
+	assert.Equal(t, checkers.OK, st)
+	assert.Equal(t, "", msg)
+}
+
+func TestCheckResourcesFDErrors(t *testing.T) {
+	var FDWarning int64 = 100
+	opts := &procsOpts{FDWarning: &FDWarning}
+	defer func() {
+		countFDsFunc = countFDs
+	}()
+	countFDsFunc = func(pid string) (int64, error) {
+		switch pid {
+		case "10":
+			return 0, errProcessGone
+		case "11":
+			return 0, fmt.Errorf("failed to count file descriptors: %w", os.ErrPermission)
+		case "12":
+			return 0, errors.New("failed to count file descriptors: input/output error")
+		}
+		return 120, nil
+	}
+
+	st, msg, err := opts.checkResources([]procState{{pid: "10"}, {pid: "11"}, {pid: "13"}})
+	assert.Nil(t, err)
+	assert.Equal(t, checkers.WARNING, st)
+	assert.Equal(t, "; max fds 120 (pid 13); fds of 1 processes not readable (permission denied)", msg)
+
+	st, msg, err = opts.checkResources([]procState{{pid: "10"}})
+	assert.Nil(t, err)
+	assert.Equal(t, checkers.OK, st, "the processes which have exited should be skipped")
+	assert.Equal(t, "", msg)
+
+	FDWarning = 200
+	st, msg, err = opts.checkResources([]procState{{pid: "11"}, {pid: "11"}})
+	assert.Nil(t, err)
+	assert.Equal(t, checkers.WARNING, st, "the thresholds are not checked at all")
+	assert.Equal(t, "; fds of 2 processes not readable (permission denied)", msg)
+
+	_, _, err = opts.checkResources([]procState{{pid: "12"}})
+	assert.NotNil(t, err)
+}
+
+func TestCheckForbidden(t *testing.T) {
+	opts := &procsOpts{Grace: 5 * time.Minute}
+
+	procs := []procState{
+		{pid: "10", cmd: "/usr/bin/dlv attach 1", esec: 600},
+		{pid: "11", cmd: "/usr/bin/dlv version", esec: 10},
+		{pid: "12", cmd: "/usr/sbin/nginx", esec: 6000},
+	}
+	exclude := regexp.MustCompile(".*")
+	st, msg := opts.checkForbidden(procs, []*regexp.Regexp{regexp.MustCompile("dlv"), regexp.MustCompile("xmrig")}, exclude)
+	assert.Equal(t, checkers.CRITICAL, st)
+	assert.Equal(t, "\nFound 1 forbidden processes; cmd /dlv/; pid 10; 1 younger than 5m0s ignored\nFound 0 forbidden processes; cmd /xmrig/", msg)
+
+	st, msg = opts.checkForbidden(procs[1:], []*regexp.Regexp{regexp.MustCompile("dlv")}, exclude)
+	assert.Equal(t, checkers.OK, st)
+	assert.Equal(t, "\nFound 0 forbidden processes; cmd /dlv/; 1 younger than 5m0s ignored", msg)
+
+	st, msg = opts.checkForbidden(procs, nil, exclude)
+	assert.Equal(t, checkers.OK, st)
+	assert.Equal(t, "", msg)
+}
+
+func TestCountFDs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptors can be counted only on Linux")
+	}
+	n, err := countFDs(strconv.Itoa(os.Getpid()))
+	assert.Nil(t, err)
+	assert.True(t, n >= 3, "stdin, stdout and stderr should be open")
+
+	_, err = countFDs("999999999")
+	assert.Equal(t, errProcessGone, err)
+}
@@ -9,6 +9,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
 )
 
 var threadsUnknown = runtime.GOOS == "darwin"
@@ -19,7 +21,10 @@ func getProcs() (proc []procState, err error) {
 	if threadsUnknown {
 		psformat = "user,ppid,pid,vsz,rss,pcpu,state,etime,time,command"
 	}
-	output, err := exec.Command("ps", "axwwo", psformat).Output()
+	args := []string{"axwwo", psformat}
+	end := debuglog.Trace("exec: %s", debuglog.Command("ps", args))
+	output, err := exec.Command("ps", args...).Output()
+	end(err)
 	if err != nil {
 		return nil, err
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/StackExchange/wmi"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
 )
 
 // Win32PerfFormattedDataPerfProcProcess is struct for Win32_PerfFormattedData_PerfProc_Process.
@@ -19,7 +20,10 @@ type Win32PerfFormattedDataPerfProcProcess struct {
 
 func getProcs() (proc []procState, err error) {
 	var records []Win32PerfFormattedDataPerfProcProcess
-	err = wmi.Query("SELECT * FROM Win32_PerfFormattedData_PerfProc_Process WHERE Name != '_Total'", &records)
+	query := "SELECT * FROM Win32_PerfFormattedData_PerfProc_Process WHERE Name != '_Total'"
+	end := debuglog.Trace("wmi: %s", query)
+	err = wmi.Query(query, &records)
+	end(err)
 	if err != nil {
 		return nil, err
 	}
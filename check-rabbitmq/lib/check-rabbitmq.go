@@ -0,0 +1,112 @@
+package checkrabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type rabbitmqSetting struct {
+	Scheme   string `long:"scheme" default:"http" description:"Scheme of the management API"`
+	Host     string `short:"H" long:"host" default:"localhost" description:"Hostname"`
+	Port     string `short:"p" long:"port" default:"15672" description:"Port of the management API"`
+	User     string `short:"u" long:"user" default:"guest" description:"Username"`
+	Password string `short:"P" long:"password" default:"guest" description:"Password" env:"RABBITMQ_PASSWORD"`
+	Timeout  int    `short:"t" long:"timeout" default:"10" description:"Seconds before connection times out"`
+
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"queue": checkQueue,
+	"node":  checkNode,
+	"links": checkLinks,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-rabbitmq [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "RabbitMQ"
+		return ckr
+	}
+	ckr := fn(argv)
+	ckr.Name = fmt.Sprintf("RabbitMQ %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
+	return ckr
+}
+
+// selfTest validates that the host of the management API can be resolved.
+func (s rabbitmqSetting) selfTest() *checkers.Checker {
+	return selftest.Run(selftest.Resolve(s.Host))
+}
+
+// statusError is returned by get when the management API responds with an unexpected status.
+type statusError struct {
+	code int
+	url  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed: http status code %d from %s", e.code, e.url)
+}
+
+// get requests path to the management API and decodes the response into v.
+func (s rabbitmqSetting) get(path string, v interface{}) error {
+	s.DebugOpts.Enable()
+	password, err := s.ResolvePassword(s.Password)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: debuglog.Transport(nil),
+		Timeout:   time.Duration(s.Timeout) * time.Second,
+	}
+	url := fmt.Sprintf("%s://%s:%s/api/%s", s.Scheme, s.Host, s.Port, path)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "check-rabbitmq")
+	req.SetBasicAuth(s.User, password)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode, url: url}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,131 @@
+package checkrabbitmq
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, []string) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "guest" || pass != "guest" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/queues", "/api/queues/%2F":
+			w.Write([]byte(`[
+				{"name":"jobs","vhost":"/","messages":120,"messages_unacknowledged":5,"consumers":2},
+				{"name":"mails","vhost":"/","messages":3,"messages_unacknowledged":80,"consumers":0}
+			]`))
+		case "/api/nodes":
+			w.Write([]byte(`[
+				{"name":"rabbit@a","running":true,"mem_alarm":false,"disk_free_alarm":false,"partitions":[]},
+				{"name":"rabbit@b","running":true,"mem_alarm":true,"disk_free_alarm":false,"partitions":["rabbit@c"]}
+			]`))
+		case "/api/shovels":
+			w.Write([]byte(`[
+				{"name":"orders-to-dc2","vhost":"/","type":"dynamic","state":"running"},
+				{"name":"audit-to-dc2","vhost":"/","type":"dynamic","state":"terminated","reason":"needed a restart"}
+			]`))
+		case "/api/shovels/staging":
+			w.Write([]byte(`[
+				{"name":"orders-to-dc2","vhost":"staging","type":"dynamic","state":"starting"}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	u, _ := url.Parse(ts.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	return ts, []string{"-H", host, "-p", port}
+}
+
+func TestCheckQueue(t *testing.T) {
+	ts, base := newTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		args []string
+		want checkers.Status
+	}{
+		{args: []string{}, want: checkers.OK},
+		{args: []string{"-w", "100", "-c", "200"}, want: checkers.WARNING},
+		{args: []string{"-w", "10", "-c", "100"}, want: checkers.CRITICAL},
+		{args: []string{"-q", "^mails$", "-w", "10", "-c", "100"}, want: checkers.OK},
+		{args: []string{"-q", "^mails$", "--warning-unacked", "50"}, want: checkers.WARNING},
+		{args: []string{"-q", "^jobs$", "--min-consumers", "1"}, want: checkers.OK},
+		{args: []string{"--vhost", "/", "--min-consumers", "1"}, want: checkers.CRITICAL},
+		{args: []string{"-q", "^none$"}, want: checkers.UNKNOWN},
+		{args: []string{"--vhost", "staging"}, want: checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := checkQueue(append(tt.args, base...))
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
+
+func TestCheckNode(t *testing.T) {
+	ts, base := newTestServer(t)
+	defer ts.Close()
+
+	ckr := checkNode(base)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "rabbit@b has memory alarm\nrabbit@b is partitioned from rabbit@c", ckr.Message)
+
+	ckr = checkNode(append([]string{"-n", "rabbit@a"}, base...))
+	assert.Equal(t, checkers.OK, ckr.Status)
+
+	ckr = checkNode(append([]string{"-n", "rabbit@z"}, base...))
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+}
+
+func TestEvaluateNodes(t *testing.T) {
+	ckr := evaluateNodes([]nodeStat{{Name: "rabbit@a", Running: false}})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "rabbit@a is not running", ckr.Message)
+}
+
+func TestCheckLinks(t *testing.T) {
+	ts, base := newTestServer(t)
+	defer ts.Close()
+
+	ckr := checkLinks(base)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "shovel //audit-to-dc2 is terminated: needed a restart", ckr.Message)
+
+	ckr = checkLinks(append([]string{"-n", "^orders"}, base...))
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "1 shovels and 0 federation links are running", ckr.Message)
+
+	ckr = checkLinks(append([]string{"--vhost", "staging"}, base...))
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+
+	ckr = checkLinks(append([]string{"-n", "^none$"}, base...))
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+
+	ckr = checkLinks(append([]string{"--vhost", "production"}, base...))
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "neither rabbitmq_shovel_management nor rabbitmq_federation_management plugin is enabled", ckr.Message)
+}
+
+func TestEvaluateLinks(t *testing.T) {
+	links := []federationLinkStat{
+		{Upstream: "dc1", Vhost: "/", Type: "exchange", Exchange: "events", Status: "running"},
+		{Upstream: "dc2", Vhost: "/", Type: "queue", Queue: "jobs", Status: "error", Error: "econnrefused"},
+		{Upstream: "dc3", Vhost: "/", Type: "exchange", Exchange: "events", Status: "starting"},
+	}
+	ckr := evaluateLinks(nil, links)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "federation //dc2 queue jobs is error: econnrefused\nfederation //dc3 exchange events is starting", ckr.Message)
+
+	ckr = evaluateLinks(nil, links[:1])
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "0 shovels and 1 federation links are running", ckr.Message)
+}
@@ -0,0 +1,154 @@
+package checkrabbitmq
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type linksOpts struct {
+	rabbitmqSetting
+	Vhost string `long:"vhost" description:"Check links only in the vhost"`
+	Name  string `short:"n" long:"name" default:"." value-name:"REGEXP" description:"Check shovels and federation upstreams whose name matches the pattern"`
+}
+
+type shovelStat struct {
+	Name   string `json:"name"`
+	Vhost  string `json:"vhost"`
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+}
+
+type federationLinkStat struct {
+	Upstream string `json:"upstream"`
+	Vhost    string `json:"vhost"`
+	Type     string `json:"type"`
+	Exchange string `json:"exchange"`
+	Queue    string `json:"queue"`
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+}
+
+func checkLinks(args []string) *checkers.Checker {
+	opts := linksOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "links [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	re, err := regexp.Compile(opts.Name)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	vhost := ""
+	if opts.Vhost != "" {
+		vhost = "/" + url.PathEscape(opts.Vhost)
+	}
+	// The APIs are not found unless the management plugins of shovel and federation are enabled.
+	var shovels []shovelStat
+	shovelEnabled, err := opts.getIfEnabled("shovels"+vhost, &shovels)
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	var links []federationLinkStat
+	federationEnabled, err := opts.getIfEnabled("federation-links"+vhost, &links)
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	if !shovelEnabled && !federationEnabled {
+		return checkers.Unknown("neither rabbitmq_shovel_management nor rabbitmq_federation_management plugin is enabled")
+	}
+
+	var matchedShovels []shovelStat
+	for _, s := range shovels {
+		if re.MatchString(s.Name) {
+			matchedShovels = append(matchedShovels, s)
+		}
+	}
+	var matchedLinks []federationLinkStat
+	for _, l := range links {
+		if re.MatchString(l.Upstream) {
+			matchedLinks = append(matchedLinks, l)
+		}
+	}
+	if len(matchedShovels) == 0 && len(matchedLinks) == 0 {
+		return checkers.Unknown(fmt.Sprintf("no shovels or federation links matched /%s/", opts.Name))
+	}
+	return evaluateLinks(matchedShovels, matchedLinks)
+}
+
+// getIfEnabled is get, but returns false without an error if the API is not found.
+func (s rabbitmqSetting) getIfEnabled(path string, v interface{}) (bool, error) {
+	err := s.get(path, v)
+	if e, ok := err.(*statusError); ok && e.code == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// evaluateLinks checks that all shovels and federation links are running.
+// The links which are starting are WARNING because they may be retrying to connect.
+func evaluateLinks(shovels []shovelStat, links []federationLinkStat) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(st checkers.Status, msg string) {
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+	}
+	status := func(state string) checkers.Status {
+		switch state {
+		case "running":
+			return checkers.OK
+		case "starting":
+			return checkers.WARNING
+		default:
+			return checkers.CRITICAL
+		}
+	}
+
+	for _, s := range shovels {
+		st := status(s.State)
+		if st == checkers.OK {
+			continue
+		}
+		msg := fmt.Sprintf("shovel %s/%s is %s", s.Vhost, s.Name, s.State)
+		if s.Reason != "" {
+			msg += ": " + s.Reason
+		}
+		raise(st, msg)
+	}
+	for _, l := range links {
+		st := status(l.Status)
+		if st == checkers.OK {
+			continue
+		}
+		target := l.Exchange
+		if l.Type == "queue" {
+			target = l.Queue
+		}
+		msg := fmt.Sprintf("federation %s/%s %s %s is %s", l.Vhost, l.Upstream, l.Type, target, l.Status)
+		if l.Error != "" {
+			msg += ": " + l.Error
+		}
+		raise(st, msg)
+	}
+
+	if checkSt == checkers.OK {
+		return checkers.Ok(fmt.Sprintf("%d shovels and %d federation links are running", len(shovels), len(links)))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, "\n"))
+}
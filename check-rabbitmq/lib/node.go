@@ -0,0 +1,77 @@
+package checkrabbitmq
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type nodeOpts struct {
+	rabbitmqSetting
+	Node string `short:"n" long:"node" description:"Check only the node (e.g. rabbit@hostname). By default all nodes in the cluster are checked"`
+}
+
+type nodeStat struct {
+	Name          string   `json:"name"`
+	Running       bool     `json:"running"`
+	MemAlarm      bool     `json:"mem_alarm"`
+	DiskFreeAlarm bool     `json:"disk_free_alarm"`
+	Partitions    []string `json:"partitions"`
+}
+
+func checkNode(args []string) *checkers.Checker {
+	opts := nodeOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "node [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	var nodes []nodeStat
+	if err := opts.get("nodes", &nodes); err != nil {
+		return checkers.Critical(err.Error())
+	}
+	if opts.Node != "" {
+		var found []nodeStat
+		for _, n := range nodes {
+			if n.Name == opts.Node {
+				found = append(found, n)
+			}
+		}
+		if len(found) == 0 {
+			return checkers.Unknown(fmt.Sprintf("node %s is not found", opts.Node))
+		}
+		nodes = found
+	}
+	return evaluateNodes(nodes)
+}
+
+func evaluateNodes(nodes []nodeStat) *checkers.Checker {
+	var msgs []string
+	for _, n := range nodes {
+		if !n.Running {
+			msgs = append(msgs, fmt.Sprintf("%s is not running", n.Name))
+			continue
+		}
+		if n.MemAlarm {
+			msgs = append(msgs, fmt.Sprintf("%s has memory alarm", n.Name))
+		}
+		if n.DiskFreeAlarm {
+			msgs = append(msgs, fmt.Sprintf("%s has disk free alarm", n.Name))
+		}
+		if len(n.Partitions) > 0 {
+			msgs = append(msgs, fmt.Sprintf("%s is partitioned from %s", n.Name, strings.Join(n.Partitions, ", ")))
+		}
+	}
+	if len(msgs) > 0 {
+		return checkers.Critical(strings.Join(msgs, "\n"))
+	}
+	return checkers.Ok(fmt.Sprintf("%d nodes are running", len(nodes)))
+}
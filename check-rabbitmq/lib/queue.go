@@ -0,0 +1,104 @@
+package checkrabbitmq
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+type queueOpts struct {
+	rabbitmqSetting
+	Vhost        string `long:"vhost" description:"Check queues only in the vhost"`
+	Queue        string `short:"q" long:"queue" default:"." value-name:"REGEXP" description:"Check queues whose name matches the pattern"`
+	WarnMessages int64  `short:"w" long:"warning" description:"warning if the number of messages in a queue is over"`
+	CritMessages int64  `short:"c" long:"critical" description:"critical if the number of messages in a queue is over"`
+	WarnUnacked  int64  `long:"warning-unacked" description:"warning if the number of unacknowledged messages in a queue is over"`
+	CritUnacked  int64  `long:"critical-unacked" description:"critical if the number of unacknowledged messages in a queue is over"`
+	MinConsumers int    `long:"min-consumers" description:"critical if the number of consumers of a queue is less than"`
+}
+
+type queueStat struct {
+	Name                   string `json:"name"`
+	Vhost                  string `json:"vhost"`
+	Messages               int64  `json:"messages"`
+	MessagesUnacknowledged int64  `json:"messages_unacknowledged"`
+	Consumers              int    `json:"consumers"`
+}
+
+func checkQueue(args []string) *checkers.Checker {
+	opts := queueOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "queue [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	re, err := regexp.Compile(opts.Queue)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	path := "queues"
+	if opts.Vhost != "" {
+		path += "/" + url.PathEscape(opts.Vhost)
+	}
+	var queues []queueStat
+	if err := opts.get(path, &queues); err != nil {
+		return checkers.Critical(err.Error())
+	}
+
+	var matched []queueStat
+	for _, q := range queues {
+		if re.MatchString(q.Name) {
+			matched = append(matched, q)
+		}
+	}
+	if len(matched) == 0 {
+		return checkers.Unknown(fmt.Sprintf("no queues matched /%s/", opts.Queue))
+	}
+	return opts.evaluate(matched)
+}
+
+func (opts *queueOpts) evaluate(queues []queueStat) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(st checkers.Status, msg string) {
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+	}
+
+	for _, q := range queues {
+		name := q.Vhost + "/" + q.Name
+		switch {
+		case opts.CritMessages > 0 && q.Messages > opts.CritMessages:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s has %d messages > %d", name, q.Messages, opts.CritMessages))
+		case opts.WarnMessages > 0 && q.Messages > opts.WarnMessages:
+			raise(checkers.WARNING, fmt.Sprintf("%s has %d messages > %d", name, q.Messages, opts.WarnMessages))
+		}
+		switch {
+		case opts.CritUnacked > 0 && q.MessagesUnacknowledged > opts.CritUnacked:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s has %d unacked messages > %d", name, q.MessagesUnacknowledged, opts.CritUnacked))
+		case opts.WarnUnacked > 0 && q.MessagesUnacknowledged > opts.WarnUnacked:
+			raise(checkers.WARNING, fmt.Sprintf("%s has %d unacked messages > %d", name, q.MessagesUnacknowledged, opts.WarnUnacked))
+		}
+		if q.Consumers < opts.MinConsumers {
+			raise(checkers.CRITICAL, fmt.Sprintf("%s has %d consumers < %d", name, q.Consumers, opts.MinConsumers))
+		}
+	}
+
+	if checkSt == checkers.OK {
+		return checkers.Ok(fmt.Sprintf("%d queues are ok", len(queues)))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, "\n"))
+}
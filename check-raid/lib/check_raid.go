@@ -0,0 +1,127 @@
+package checkraid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type raidOpts struct {
+	Mdstat    string `long:"mdstat" value-name:"PATH" default:"/proc/mdstat" description:"Path to mdstat of the md driver. The software RAID arrays are not checked if it doesn't exist"`
+	Storcli   string `long:"storcli" value-name:"PATH" description:"Path to storcli or perccli to check the hardware RAID controllers"`
+	IgnoreBBU bool   `long:"ignore-bbu" description:"Don't check the battery backup units and the CacheVault modules of the hardware RAID controllers"`
+	Timeout   int    `short:"t" long:"timeout" default:"30" description:"Seconds before storcli times out"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "RAID"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := raidOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if isMegaCli(opts.Storcli) {
+		return checkers.Unknown(fmt.Sprintf("unsupported controller: %s is MegaCli, which has no JSON output. Use storcli or perccli instead", opts.Storcli))
+	}
+	if opts.SelfTest {
+		var checks []selftest.Check
+		if opts.Storcli != "" {
+			checks = append(checks, selftest.Executable(opts.Storcli))
+		}
+		return selftest.Run(checks...)
+	}
+	opts.DebugOpts.Enable()
+
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+
+	f, err := os.Open(opts.Mdstat)
+	if err != nil && !os.IsNotExist(err) {
+		return checkers.Unknown(err.Error())
+	}
+	if err == nil {
+		arrays, err := parseMdstat(f)
+		f.Close()
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		for _, a := range arrays {
+			raise(a.evaluate())
+		}
+	}
+
+	if opts.Storcli != "" {
+		out, err := opts.storcli("/call", "show", "all", "J")
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		results, err := evaluateStorcli(out, !opts.IgnoreBBU)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		for _, r := range results {
+			raise(r.status, r.msg)
+		}
+	}
+
+	if len(msgs) == 0 {
+		return checkers.Unknown("no RAID arrays found")
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
+
+// isMegaCli reports whether the path is MegaCli, such as /opt/MegaRAID/MegaCli/MegaCli64, given to --storcli by mistake.
+func isMegaCli(path string) bool {
+	return strings.HasPrefix(strings.ToLower(filepath.Base(path)), "megacli")
+}
+
+func (opts *raidOpts) storcli(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	end := debuglog.Trace("exec: %s", debuglog.Command(opts.Storcli, args))
+	cmd := exec.CommandContext(ctx, opts.Storcli, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	end(err)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out", opts.Storcli)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
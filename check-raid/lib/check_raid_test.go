@@ -0,0 +1,194 @@
+package checkraid
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+const mdstat = `Personalities : [raid1] [raid6] [raid5] [raid4] [raid0]
+md3 : active raid0 sdf1[1] sde1[0]
+      2093056 blocks super 1.2 512k chunks
+
+md2 : active raid5 sdd1[3] sdc1[1] sdb1[0]
+      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+      [=>...................]  recovery =  8.3% (87424/1046528) finish=1.2min speed=12489K/sec
+
+md1 : active (auto-read-only) raid1 sdh1[1] sdg1[0]
+      1048512 blocks super 1.2 [2/2] [UU]
+      	resync=PENDING
+
+md0 : active raid1 sdb2[1](F) sda2[0]
+      1048512 blocks super 1.2 [2/1] [U_]
+      bitmap: 1/1 pages [4KB], 65536KB chunk
+
+md127 : inactive sdi[0](S)
+      1048576 blocks super 1.2
+
+unused devices: <none>
+`
+
+func TestParseMdstat(t *testing.T) {
+	arrays, err := parseMdstat(strings.NewReader(mdstat))
+	assert.Nil(t, err)
+	assert.Equal(t, []*mdArray{
+		{name: "md3", state: "active", level: "raid0"},
+		{name: "md2", state: "active", level: "raid5", total: 3, active: 2, status: "UU_", sync: "recovery", progress: "8.3%"},
+		{name: "md1", state: "active", level: "raid1", total: 2, active: 2, status: "UU", sync: "resync", progress: "PENDING"},
+		{name: "md0", state: "active", level: "raid1", failed: []string{"sdb2"}, total: 2, active: 1, status: "U_"},
+		{name: "md127", state: "inactive"},
+	}, arrays)
+}
+
+func TestEvaluateMdArray(t *testing.T) {
+	tests := []struct {
+		array mdArray
+		want  checkers.Status
+		msg   string
+	}{
+		{
+			array: mdArray{name: "md0", state: "active", level: "raid1", total: 2, active: 2, status: "UU"},
+			want:  checkers.OK,
+			msg:   "md0: raid1 [UU]",
+		},
+		{
+			array: mdArray{name: "md0", state: "active", level: "raid1", total: 2, active: 2, status: "UU", sync: "check", progress: "45.0%"},
+			want:  checkers.OK,
+			msg:   "md0: raid1 [UU], check 45.0%",
+		},
+		{
+			array: mdArray{name: "md3", state: "active", level: "raid0"},
+			want:  checkers.OK,
+			msg:   "md3: raid0",
+		},
+		{
+			array: mdArray{name: "md1", state: "active", level: "raid1", total: 2, active: 2, status: "UU", sync: "resync", progress: "PENDING"},
+			want:  checkers.WARNING,
+			msg:   "md1: raid1 [UU], resync PENDING",
+		},
+		{
+			array: mdArray{name: "md2", state: "active", level: "raid5", total: 3, active: 2, status: "UU_", sync: "recovery", progress: "8.3%"},
+			want:  checkers.WARNING,
+			msg:   "md2: degraded [UU_], recovery 8.3%",
+		},
+		{
+			array: mdArray{name: "md2", state: "active", level: "raid5", total: 3, active: 2, status: "UU_"},
+			want:  checkers.CRITICAL,
+			msg:   "md2: degraded [UU_]",
+		},
+		{
+			array: mdArray{name: "md0", state: "active", level: "raid1", failed: []string{"sdb2"}, total: 2, active: 1, status: "U_"},
+			want:  checkers.CRITICAL,
+			msg:   "md0: sdb2 failed [U_]",
+		},
+		{
+			array: mdArray{name: "md127", state: "inactive"},
+			want:  checkers.CRITICAL,
+			msg:   "md127: inactive",
+		},
+	}
+	for _, tt := range tests {
+		s, msg := tt.array.evaluate()
+		assert.Equal(t, tt.want, s, msg)
+		assert.Equal(t, tt.msg, msg)
+	}
+}
+
+// storcli /call show all J, trimmed to the fields used
+const storcliOutputJSON = `{
+"Controllers":[
+{
+	"Command Status" : {
+		"CLI Version" : "007.1017.0000.0000 May 10, 2019",
+		"Operating system" : "Linux 5.4.0-42-generic",
+		"Controller" : 0,
+		"Status" : "Success",
+		"Description" : "None"
+	},
+	"Response Data" : {
+		"Basics" : {"Controller" : 0, "Model" : "AVAGO MegaRAID SAS 9361-8i"},
+		"VD LIST" : [
+			{"DG/VD" : "0/0", "TYPE" : "RAID1", "State" : "Optl", "Access" : "RW", "Consist" : "Yes", "Cache" : "RWBD", "Cac" : "-", "sCC" : "ON", "Size" : "930.390 GB", "Name" : "os"},
+			{"DG/VD" : "1/1", "TYPE" : "RAID6", "State" : "Dgrd", "Access" : "RW", "Consist" : "No", "Cache" : "RWBD", "Cac" : "-", "sCC" : "ON", "Size" : "7.276 TB", "Name" : "data"}
+		],
+		"PD LIST" : [
+			{"EID:Slt" : "252:0", "DID" : 4, "State" : "Onln", "DG" : 0, "Size" : "931.0 GB", "Intf" : "SATA", "Med" : "HDD", "SED" : "N", "PI" : "N", "SeSz" : "512B", "Model" : "ST1000NM0033-9ZM", "Sp" : "U", "Type" : "-"},
+			{"EID:Slt" : "252:1", "DID" : 5, "State" : "Onln", "DG" : 0, "Size" : "931.0 GB", "Intf" : "SATA", "Med" : "HDD", "SED" : "N", "PI" : "N", "SeSz" : "512B", "Model" : "ST1000NM0033-9ZM", "Sp" : "U", "Type" : "-"},
+			{"EID:Slt" : "252:2", "DID" : 6, "State" : "Rbld", "DG" : 1, "Size" : "1.818 TB", "Intf" : "SATA", "Med" : "HDD", "SED" : "N", "PI" : "N", "SeSz" : "512B", "Model" : "ST2000NM0055-1V4", "Sp" : "U", "Type" : "-"},
+			{"EID:Slt" : "252:3", "DID" : 7, "State" : "UBad", "DG" : "-", "Size" : "1.818 TB", "Intf" : "SATA", "Med" : "HDD", "SED" : "N", "PI" : "N", "SeSz" : "512B", "Model" : "ST2000NM0055-1V4", "Sp" : "U", "Type" : "-"}
+		],
+		"Cachevault_Info" : [
+			{"Model" : "CVPM02", "State" : "Optimal", "Temp" : "28C", "Mode" : "-", "MfgDate" : "2018/03/08"}
+		]
+	}
+},
+{
+	"Command Status" : {
+		"Controller" : 1,
+		"Status" : "Success",
+		"Description" : "None"
+	},
+	"Response Data" : {
+		"VD LIST" : [
+			{"DG/VD" : "0/0", "TYPE" : "RAID10", "State" : "Optl"}
+		],
+		"BBU_Info" : [
+			{"Model" : "iBBU08", "State" : "Dischargd (Need Attention)", "RetentionTime" : "48 hours +", "Temp" : "33C", "Mode" : "4", "MfgDate" : "2015/09/17", "Next Learn" : "2020/10/01  06:00:00"}
+		]
+	}
+}
+]
+}`
+
+func TestEvaluateStorcli(t *testing.T) {
+	results, err := evaluateStorcli([]byte(storcliOutputJSON), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []controllerResult{
+		{checkers.OK, "c0 VD 0/0 RAID1: Optl"},
+		{checkers.CRITICAL, "c0 VD 1/1 RAID6: Dgrd"},
+		{checkers.WARNING, "c0 PD 252:2 ST2000NM0055-1V4: Rbld"},
+		{checkers.CRITICAL, "c0 PD 252:3 ST2000NM0055-1V4: UBad"},
+		{checkers.OK, "c0 BBU CVPM02: Optimal"},
+		{checkers.OK, "c1 VD 0/0 RAID10: Optl"},
+		{checkers.WARNING, "c1 BBU iBBU08: Dischargd (Need Attention)"},
+	}, results)
+
+	results, err = evaluateStorcli([]byte(storcliOutputJSON), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(results))
+
+	_, err = evaluateStorcli([]byte(`{"Controllers":[{"Command Status":{"Controller":0,"Status":"Failure","Description":"Controller 0 not found"}}]}`), true)
+	assert.Equal(t, "storcli failed on c0: Controller 0 not found", err.Error())
+	_, err = evaluateStorcli([]byte(`{"Controllers":[]}`), true)
+	assert.NotNil(t, err)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mdstat")
+	if err := os.WriteFile(file, []byte(mdstat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ckr := run([]string{"--mdstat", file})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Equal(t, "md3: raid0, md2: degraded [UU_], recovery 8.3%, md1: raid1 [UU], resync PENDING, md0: sdb2 failed [U_], md127: inactive", ckr.Message)
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("Personalities : \nunused devices: <none>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ckr = run([]string{"--mdstat", empty})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+
+	ckr = run([]string{"--mdstat", filepath.Join(dir, "missing")})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "no RAID arrays found", ckr.Message)
+
+	ckr = run([]string{"--mdstat", file, "--storcli", "/opt/MegaRAID/MegaCli/MegaCli64"})
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "unsupported controller: /opt/MegaRAID/MegaCli/MegaCli64 is MegaCli, which has no JSON output. Use storcli or perccli instead", ckr.Message)
+}
@@ -0,0 +1,104 @@
+package checkraid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// mdArray is a software RAID array of the md driver in /proc/mdstat.
+type mdArray struct {
+	name     string
+	state    string // active or inactive
+	level    string
+	failed   []string
+	total    int // the number of the devices of the array, which is 0 for the levels without redundancy
+	active   int
+	status   string // such as UU_
+	sync     string // resync, recovery, reshape, check or repair in progress
+	progress string
+}
+
+var (
+	mdArrayRe  = regexp.MustCompile(`^(md\S+) : (\S+)(?: \([^)]*\))?(.*)$`)
+	mdMemberRe = regexp.MustCompile(`^(\S+)\[\d+\]((?:\([A-Z]\))*)$`)
+	mdStatusRe = regexp.MustCompile(`\[(\d+)/(\d+)\] \[([U_]+)\]`)
+	mdSyncRe   = regexp.MustCompile(`\b(resync|recovery|reshape|check|repair)\s*=\s*(\S+)`)
+)
+
+// parseMdstat parses /proc/mdstat.
+func parseMdstat(r io.Reader) ([]*mdArray, error) {
+	var arrays []*mdArray
+	var cur *mdArray
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if m := mdArrayRe.FindStringSubmatch(line); m != nil {
+			cur = &mdArray{name: m[1], state: m[2]}
+			arrays = append(arrays, cur)
+			for _, f := range strings.Fields(m[3]) {
+				mm := mdMemberRe.FindStringSubmatch(f)
+				if mm == nil {
+					if cur.level == "" {
+						cur.level = f
+					}
+					continue
+				}
+				if strings.Contains(mm[2], "(F)") {
+					cur.failed = append(cur.failed, mm[1])
+				}
+			}
+			continue
+		}
+		if cur == nil || !strings.HasPrefix(line, " ") {
+			cur = nil
+			continue
+		}
+		if m := mdStatusRe.FindStringSubmatch(line); m != nil {
+			cur.total, _ = strconv.Atoi(m[1])
+			cur.active, _ = strconv.Atoi(m[2])
+			cur.status = m[3]
+		}
+		if m := mdSyncRe.FindStringSubmatch(line); m != nil {
+			cur.sync = m[1]
+			cur.progress = m[2]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mdstat: %s", err)
+	}
+	return arrays, nil
+}
+
+// evaluate returns the status of the array. The arrays being rebuilt are WARNING even if they are degraded,
+// and those which are degraded without being rebuilt or have failed devices are CRITICAL.
+// The periodic checks of the consistency are not alerted.
+func (a *mdArray) evaluate() (checkers.Status, string) {
+	if a.state != "active" {
+		return checkers.CRITICAL, fmt.Sprintf("%s: %s", a.name, a.state)
+	}
+	var sync string
+	if a.sync != "" {
+		sync = fmt.Sprintf(", %s %s", a.sync, a.progress)
+	}
+	rebuilding := a.sync == "resync" || a.sync == "recovery" || a.sync == "reshape"
+	switch {
+	case len(a.failed) > 0:
+		return checkers.CRITICAL, fmt.Sprintf("%s: %s failed [%s]%s", a.name, strings.Join(a.failed, ", "), a.status, sync)
+	case a.active < a.total && !rebuilding:
+		return checkers.CRITICAL, fmt.Sprintf("%s: degraded [%s]", a.name, a.status)
+	case a.active < a.total:
+		return checkers.WARNING, fmt.Sprintf("%s: degraded [%s]%s", a.name, a.status, sync)
+	case rebuilding:
+		return checkers.WARNING, fmt.Sprintf("%s: %s [%s]%s", a.name, a.level, a.status, sync)
+	}
+	if a.status == "" {
+		return checkers.OK, fmt.Sprintf("%s: %s%s", a.name, a.level, sync)
+	}
+	return checkers.OK, fmt.Sprintf("%s: %s [%s]%s", a.name, a.level, a.status, sync)
+}
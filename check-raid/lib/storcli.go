@@ -0,0 +1,122 @@
+package checkraid
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mackerelio/checkers"
+)
+
+// storcliOutput is the part of the output of storcli /call show all J which is checked.
+// perccli, the storcli for Dell PERC, prints the same output.
+type storcliOutput struct {
+	Controllers []struct {
+		CommandStatus struct {
+			Controller  json.Number `json:"Controller"`
+			Status      string      `json:"Status"`
+			Description string      `json:"Description"`
+		} `json:"Command Status"`
+		ResponseData struct {
+			VDList []struct {
+				DGVD  string `json:"DG/VD"`
+				Type  string `json:"TYPE"`
+				State string `json:"State"`
+			} `json:"VD LIST"`
+			PDList []struct {
+				EIDSlt string `json:"EID:Slt"`
+				State  string `json:"State"`
+				Model  string `json:"Model"`
+			} `json:"PD LIST"`
+			BBUInfo []struct {
+				Model string `json:"Model"`
+				State string `json:"State"`
+			} `json:"BBU_Info"`
+			CachevaultInfo []struct {
+				Model string `json:"Model"`
+				State string `json:"State"`
+			} `json:"Cachevault_Info"`
+		} `json:"Response Data"`
+	} `json:"Controllers"`
+}
+
+// The states of the virtual drives and the physical drives abbreviated by storcli.
+var (
+	vdStates = map[string]checkers.Status{
+		"Optl": checkers.OK,       // optimal
+		"Rec":  checkers.WARNING,  // recovery
+		"Pdgd": checkers.CRITICAL, // partially degraded
+		"Dgrd": checkers.CRITICAL, // degraded
+		"OfLn": checkers.CRITICAL, // offline
+	}
+	pdStates = map[string]checkers.Status{
+		"Onln":   checkers.OK, // online
+		"UGood":  checkers.OK, // unconfigured good
+		"GHS":    checkers.OK, // global hot spare
+		"DHS":    checkers.OK, // dedicated hot spare
+		"JBOD":   checkers.OK,
+		"Rbld":   checkers.WARNING,  // rebuilding
+		"Cpybck": checkers.WARNING,  // copyback
+		"UBad":   checkers.CRITICAL, // unconfigured bad
+		"Offln":  checkers.CRITICAL, // offline
+		"Failed": checkers.CRITICAL,
+		"Msng":   checkers.CRITICAL, // missing
+	}
+)
+
+// controllerResult is the results of a controller.
+type controllerResult struct {
+	status checkers.Status
+	msg    string
+}
+
+// evaluateStorcli checks the virtual drives, the physical drives and the battery backup units of the controllers.
+// The unknown states are WARNING.
+func evaluateStorcli(out []byte, checkBBU bool) ([]controllerResult, error) {
+	var o storcliOutput
+	if err := json.Unmarshal(out, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of storcli: %s", err)
+	}
+	if len(o.Controllers) == 0 {
+		return nil, fmt.Errorf("no controllers in the output of storcli")
+	}
+
+	var results []controllerResult
+	add := func(s checkers.Status, format string, args ...interface{}) {
+		results = append(results, controllerResult{s, fmt.Sprintf(format, args...)})
+	}
+	for _, c := range o.Controllers {
+		id := "c" + c.CommandStatus.Controller.String()
+		if c.CommandStatus.Status != "Success" {
+			return nil, fmt.Errorf("storcli failed on %s: %s", id, c.CommandStatus.Description)
+		}
+		d := c.ResponseData
+		for _, vd := range d.VDList {
+			s, ok := vdStates[vd.State]
+			if !ok {
+				s = checkers.WARNING
+			}
+			add(s, "%s VD %s %s: %s", id, vd.DGVD, vd.Type, vd.State)
+		}
+		for _, pd := range d.PDList {
+			s, ok := pdStates[pd.State]
+			if !ok {
+				s = checkers.WARNING
+			}
+			// the healthy drives are not shown, since there are too many of them.
+			if s != checkers.OK {
+				add(s, "%s PD %s %s: %s", id, pd.EIDSlt, pd.Model, pd.State)
+			}
+		}
+		if !checkBBU {
+			continue
+		}
+		for _, b := range append(d.BBUInfo, d.CachevaultInfo...) {
+			s := checkers.OK
+			if b.State != "Optimal" {
+				s = checkers.WARNING
+			}
+			add(s, "%s BBU %s: %s", id, b.Model, b.State)
+		}
+	}
+	return results, nil
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type redisSetting struct {
@@ -20,11 +23,18 @@ type redisSetting struct {
 	Port     string `short:"p" long:"port" default:"6379" description:"Port"`
 	Password string `short:"P" long:"password" default:"" description:"Password"`
 	Timeout  uint64 `short:"t" long:"timeout" default:"5" description:"Dial Timeout in sec"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 var commands = map[string](func([]string) *checkers.Checker){
 	"reachable":   checkReachable,
 	"replication": checkReplication,
+	"persistence": checkPersistence,
+	"slowlog":     checkSlowlog,
+	"sentinel":    checkSentinel,
+	"keyspace":    checkKeyspace,
 	"slave":       checkSlave, // deprecated command
 }
 
@@ -37,7 +47,12 @@ func separateSub(argv []string) (string, []string) {
 
 // Do the plugin
 func Do() {
-	subCmd, argv := separateSub(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
 	fn, ok := commands[subCmd]
 	if !ok {
 		fmt.Println(`Usage:
@@ -47,38 +62,64 @@ SubCommands:`)
 		for k := range commands {
 			fmt.Printf("  %s\n", k)
 		}
-		os.Exit(1)
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Redis"
+		return ckr
 	}
 	ckr := fn(argv)
 	ckr.Name = fmt.Sprintf("Redis %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
-	ckr.Exit()
+	return ckr
+}
+
+// selfTest validates that the host can be resolved or the socket exists.
+func (m redisSetting) selfTest() *checkers.Checker {
+	if m.Socket != "" {
+		return selftest.Run(selftest.Exists(m.Socket))
+	}
+	return selftest.Run(selftest.Resolve(m.Host))
+}
+
+// password returns the password of --password-file, --password or REDIS_PASSWORD in this order,
+// resolved by secret.Resolve if it is a reference such as env://NAME.
+func (m redisSetting) password() (string, error) {
+	password := m.Password
+	if password == "" {
+		password = os.Getenv("REDIS_PASSWORD")
+	}
+	return m.ResolvePassword(password)
 }
 
 func connectRedis(m redisSetting) (redis.Conn, error) {
+	password, err := m.password()
+	if err != nil {
+		return nil, err
+	}
+	return dialRedis(m, password)
+}
+
+// dialRedis connects to Redis and authenticates with the password unless it is empty.
+func dialRedis(m redisSetting, password string) (redis.Conn, error) {
 	network := "tcp"
 	address := net.JoinHostPort(m.Host, m.Port)
 	if m.Socket != "" {
 		network = "unix"
 		address = m.Socket
 	}
+	m.DebugOpts.Enable()
+	end := debuglog.Trace("redis: dial %s %s", network, address)
 	c, err := redis.Dial(network, address, redis.DialConnectTimeout(time.Duration(m.Timeout)*time.Second))
+	end(err)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't connect: %s", err)
 	}
-
-	password := ""
-
-	if os.Getenv("REDIS_PASSWORD") != "" {
-		password = os.Getenv("REDIS_PASSWORD")
-	}
-
-	if m.Password != "" {
-		password = m.Password
+	if debuglog.Enabled() {
+		c = debugConn{c}
 	}
 
 	if password != "" {
 		_, err := c.Do("AUTH", password)
 		if err != nil {
+			c.Close()
 			return nil, fmt.Errorf("couldn't authenticate: %v", err)
 		}
 	}
@@ -86,6 +127,26 @@ func connectRedis(m redisSetting) (redis.Conn, error) {
 	return c, nil
 }
 
+// debugConn prints the commands with --debug. The arguments of AUTH are redacted.
+type debugConn struct {
+	redis.Conn
+}
+
+func (c debugConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	s := cmd
+	if strings.EqualFold(cmd, "AUTH") {
+		s += " xxxxx"
+	} else {
+		for _, a := range args {
+			s += fmt.Sprintf(" %v", a)
+		}
+	}
+	end := debuglog.Trace("redis: %s", s)
+	reply, err := c.Conn.Do(cmd, args...)
+	end(err)
+	return reply, err
+}
+
 func getRedisInfo(c redis.Conn) (*map[string]string, error) {
 	info := make(map[string]string)
 
@@ -133,8 +194,11 @@ func checkReachable(args []string) *checkers.Checker {
 	psr.Usage = "reachable [OPTIONS]"
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
 	}
 
 	c, info, err := connectRedisGetInfo(opts)
@@ -163,8 +227,11 @@ func checkReplication(args []string) *checkers.Checker {
 	psr.Usage = "replication [OPTIONS]"
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
 	}
 
 	c, info, err := connectRedisGetInfo(opts.redisSetting)
@@ -207,8 +274,11 @@ func checkSlave(args []string) *checkers.Checker {
 DEPRECATED: For backward compatibility. Use 'replication' command.`
 	_, err := psr.ParseArgs(args)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
 	}
 
 	c, info, err := connectRedisGetInfo(opts)
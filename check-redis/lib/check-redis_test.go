@@ -0,0 +1,66 @@
+package checkredis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassword(t *testing.T) {
+	for k, v := range map[string]string{"REDIS_PASSWORD": "from-env", "CHECK_REDIS_TEST_PASSWORD": "referenced"} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting redisSetting
+		want    string
+	}{
+		{setting: redisSetting{}, want: "from-env"},
+		{setting: redisSetting{Password: "plain"}, want: "plain"},
+		{setting: redisSetting{Password: "env://CHECK_REDIS_TEST_PASSWORD"}, want: "referenced"},
+		{setting: redisSetting{Password: "file://" + file}, want: "from-file"},
+		{setting: redisSetting{Password: "plain", PasswordFileOpts: secret.PasswordFileOpts{PasswordFile: file}}, want: "from-file"},
+	}
+	for _, tt := range tests {
+		password, err := tt.setting.password()
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, password)
+	}
+
+	_, err := redisSetting{Password: "env://CHECK_REDIS_TEST_UNSET"}.password()
+	assert.EqualError(t, err, "failed to resolve the secret env://CHECK_REDIS_TEST_UNSET: environment variable CHECK_REDIS_TEST_UNSET is not set")
+}
+
+func TestSentinelPassword(t *testing.T) {
+	for k, v := range map[string]string{"REDIS_PASSWORD": "from-env", "CHECK_REDIS_TEST_PASSWORD": "referenced"} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts sentinelOpts
+		want string
+	}{
+		// the password of Redis is not used for Sentinel
+		{opts: sentinelOpts{}, want: ""},
+		{opts: sentinelOpts{Password: "env://CHECK_REDIS_TEST_PASSWORD"}, want: "referenced"},
+		{opts: sentinelOpts{Password: "plain", PasswordFile: file}, want: "from-file"},
+	}
+	for _, tt := range tests {
+		password, err := tt.opts.password()
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, password)
+	}
+}
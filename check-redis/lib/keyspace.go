@@ -0,0 +1,144 @@
+package checkredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type keyspaceOpts struct {
+	redisSetting
+	WarnHitRatio *float64 `long:"warning-hit-ratio" value-name:"PERCENT" description:"warning if the keyspace hit ratio since the last check is under"`
+	CritHitRatio *float64 `long:"critical-hit-ratio" value-name:"PERCENT" description:"critical if the keyspace hit ratio since the last check is under"`
+	MinLookups   int64    `long:"min-lookups" value-name:"N" default:"100" description:"don't check the hit ratio if the lookups since the last check are fewer"`
+	WarnEvicted  *float64 `long:"warning-evicted" value-name:"N" description:"warning if the keys evicted per minute since the last check are over"`
+	CritEvicted  *float64 `long:"critical-evicted" value-name:"N" description:"critical if the keys evicted per minute since the last check are over"`
+	WarnExpired  *float64 `long:"warning-expired" value-name:"N" description:"warning if the keys expired per minute since the last check are over"`
+	CritExpired  *float64 `long:"critical-expired" value-name:"N" description:"critical if the keys expired per minute since the last check are over"`
+	StateDir     string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+// keyspaceState is the counters of INFO stats at the last check.
+type keyspaceState struct {
+	Time           int64  `json:"time"`
+	RunID          string `json:"run_id"`
+	KeyspaceHits   int64  `json:"keyspace_hits"`
+	KeyspaceMisses int64  `json:"keyspace_misses"`
+	EvictedKeys    int64  `json:"evicted_keys"`
+	ExpiredKeys    int64  `json:"expired_keys"`
+}
+
+func checkKeyspace(args []string) *checkers.Checker {
+	opts := keyspaceOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "keyspace [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	c, info, err := connectRedisGetInfo(opts.redisSetting)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer c.Close()
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-redis"))
+	var prev *keyspaceState
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	next := newKeyspaceState(*info, time.Now())
+	if err := state.Save(stateFile, next); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(prev, next)
+}
+
+func newKeyspaceState(info map[string]string, now time.Time) *keyspaceState {
+	counter := func(name string) int64 {
+		n, _ := strconv.ParseInt(info[name], 10, 64)
+		return n
+	}
+	return &keyspaceState{
+		Time:           now.Unix(),
+		RunID:          info["run_id"],
+		KeyspaceHits:   counter("keyspace_hits"),
+		KeyspaceMisses: counter("keyspace_misses"),
+		EvictedKeys:    counter("evicted_keys"),
+		ExpiredKeys:    counter("expired_keys"),
+	}
+}
+
+func (opts *keyspaceOpts) stateFile(stateDir string) string {
+	key := opts.Socket
+	if key == "" {
+		key = strings.Join([]string{opts.Host, opts.Port}, ":")
+	}
+	return state.File(stateDir, "keyspace", key)
+}
+
+// evaluate computes the hit ratio and the rates of evicted and expired keys from the increase of the counters
+// since the last check, which are reset when Redis is restarted or CONFIG RESETSTAT is executed.
+func (opts *keyspaceOpts) evaluate(prev, next *keyspaceState) *checkers.Checker {
+	if prev != nil && (prev.RunID != next.RunID || next.Time <= prev.Time ||
+		next.KeyspaceHits < prev.KeyspaceHits || next.KeyspaceMisses < prev.KeyspaceMisses ||
+		next.EvictedKeys < prev.EvictedKeys || next.ExpiredKeys < prev.ExpiredKeys) {
+		prev = nil
+	}
+	if prev == nil {
+		return checkers.Ok("counters are recorded (first check)")
+	}
+
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+	var msgs []string
+
+	hits := next.KeyspaceHits - prev.KeyspaceHits
+	lookups := hits + next.KeyspaceMisses - prev.KeyspaceMisses
+	if lookups > 0 {
+		ratio := float64(hits) * 100 / float64(lookups)
+		msgs = append(msgs, fmt.Sprintf("hit ratio %.1f%% of %d lookups", ratio, lookups))
+		if lookups >= opts.MinLookups {
+			if opts.CritHitRatio != nil && ratio < *opts.CritHitRatio {
+				raise(checkers.CRITICAL)
+			} else if opts.WarnHitRatio != nil && ratio < *opts.WarnHitRatio {
+				raise(checkers.WARNING)
+			}
+		}
+	} else {
+		msgs = append(msgs, "no lookups")
+	}
+
+	minutes := float64(next.Time-prev.Time) / 60
+	for _, r := range []struct {
+		name       string
+		increase   int64
+		warn, crit *float64
+	}{
+		{"evicted", next.EvictedKeys - prev.EvictedKeys, opts.WarnEvicted, opts.CritEvicted},
+		{"expired", next.ExpiredKeys - prev.ExpiredKeys, opts.WarnExpired, opts.CritExpired},
+	} {
+		rate := float64(r.increase) / minutes
+		msgs = append(msgs, fmt.Sprintf("%s %.1f keys/min", r.name, rate))
+		if r.crit != nil && rate > *r.crit {
+			raise(checkers.CRITICAL)
+		} else if r.warn != nil && rate > *r.warn {
+			raise(checkers.WARNING)
+		}
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", ")+" since the last check")
+}
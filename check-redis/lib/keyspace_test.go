@@ -0,0 +1,97 @@
+package checkredis
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyspaceEvaluate(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	opts := &keyspaceOpts{WarnHitRatio: f(90), CritHitRatio: f(75), MinLookups: 100, WarnEvicted: f(10), CritEvicted: f(100)}
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := newKeyspaceState(map[string]string{
+		"run_id":          "abc",
+		"keyspace_hits":   "10000",
+		"keyspace_misses": "500",
+		"evicted_keys":    "0",
+		"expired_keys":    "100",
+	}, now.Add(-5*time.Minute))
+	next := func(hits, misses, evicted, expired int64) *keyspaceState {
+		return &keyspaceState{Time: now.Unix(), RunID: "abc", KeyspaceHits: hits, KeyspaceMisses: misses, EvictedKeys: evicted, ExpiredKeys: expired}
+	}
+
+	tests := []struct {
+		name string
+		prev *keyspaceState
+		next *keyspaceState
+		want checkers.Status
+		msg  string
+	}{
+		{
+			name: "first check",
+			next: next(10000, 500, 0, 100),
+			want: checkers.OK,
+			msg:  "counters are recorded (first check)",
+		},
+		{
+			name: "healthy",
+			prev: prev,
+			next: next(10950, 550, 0, 150),
+			want: checkers.OK,
+			msg:  "hit ratio 95.0% of 1000 lookups, evicted 0.0 keys/min, expired 10.0 keys/min since the last check",
+		},
+		{
+			name: "hit ratio dropped",
+			prev: prev,
+			next: next(10850, 650, 0, 100),
+			want: checkers.WARNING,
+		},
+		{
+			name: "too few lookups",
+			prev: prev,
+			next: next(10001, 510, 0, 100),
+			want: checkers.OK,
+		},
+		{
+			name: "evicting",
+			prev: prev,
+			next: next(10950, 550, 1000, 100),
+			want: checkers.CRITICAL,
+		},
+		{
+			name: "restarted",
+			prev: prev,
+			next: &keyspaceState{Time: now.Unix(), RunID: "def"},
+			want: checkers.OK,
+			msg:  "counters are recorded (first check)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ckr := opts.evaluate(tt.prev, tt.next)
+			assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+			if tt.msg != "" {
+				assert.Equal(t, tt.msg, ckr.Message)
+			}
+		})
+	}
+}
+
+func TestKeyspaceState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "check-redis", "keyspace.json")
+	var s *keyspaceState
+	_, err := state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	want := &keyspaceState{Time: 1893499200, RunID: "abc", KeyspaceHits: 10, KeyspaceMisses: 2, EvictedKeys: 1, ExpiredKeys: 3}
+	assert.Nil(t, state.Save(file, want))
+	_, err = state.Load(file, &s)
+	assert.Nil(t, err)
+	assert.Equal(t, want, s)
+}
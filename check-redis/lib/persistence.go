@@ -0,0 +1,157 @@
+package checkredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type persistenceOpts struct {
+	redisSetting
+	Warning            int64  `short:"w" long:"warning" default:"60" description:"warning if the last successful RDB save is older than (minutes)"`
+	Critical           int64  `short:"c" long:"critical" default:"120" description:"critical if the last successful RDB save is older than (minutes)"`
+	AOFRewriteWarning  int64  `long:"aof-rewrite-warning" value-name:"MINUTES" description:"warning if the AOF has not been rewritten successfully for the minutes"`
+	AOFRewriteCritical int64  `long:"aof-rewrite-critical" value-name:"MINUTES" description:"critical if the AOF has not been rewritten successfully for the minutes"`
+	StateDir           string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+// aofRewriteState is when the AOF was seen rewritten last.
+// INFO doesn't have the time of the last AOF rewrite, so it is when the marker has changed.
+type aofRewriteState struct {
+	RunID  string `json:"run_id"`
+	Marker string `json:"marker"`
+	Time   int64  `json:"time"`
+}
+
+func checkPersistence(args []string) *checkers.Checker {
+	opts := persistenceOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "persistence [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	c, info, err := connectRedisGetInfo(opts.redisSetting)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer c.Close()
+
+	now := time.Now()
+	var lastRewrite time.Time
+	if (*info)["aof_enabled"] == "1" && (opts.AOFRewriteWarning > 0 || opts.AOFRewriteCritical > 0) {
+		stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-redis"))
+		var prev *aofRewriteState
+		if _, err := state.Load(stateFile, &prev); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		next := nextAOFRewriteState(prev, *info, now)
+		if err := state.Save(stateFile, next); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		lastRewrite = time.Unix(next.Time, 0)
+	}
+	return opts.evaluate(*info, snapshotEnabled(c), lastRewrite, now)
+}
+
+// snapshotEnabled reports whether RDB snapshots are configured with the save directive.
+// It returns true if CONFIG GET fails, since some managed services don't allow CONFIG.
+func snapshotEnabled(c redis.Conn) bool {
+	reply, err := redis.Strings(c.Do("CONFIG", "GET", "save"))
+	if err != nil || len(reply) < 2 {
+		return true
+	}
+	return reply[1] != ""
+}
+
+func (opts *persistenceOpts) stateFile(stateDir string) string {
+	key := opts.Socket
+	if key == "" {
+		key = strings.Join([]string{opts.Host, opts.Port}, ":")
+	}
+	return state.File(stateDir, "persistence", key)
+}
+
+// nextAOFRewriteState returns the state updated by info. The marker is aof_rewrites, which is since Redis 7.0,
+// and aof_base_size, which changes at every rewrite. The time of the first check or after Redis is restarted is
+// the time of the check, so the age of the rewrite is counted from it.
+func nextAOFRewriteState(prev *aofRewriteState, info map[string]string, now time.Time) *aofRewriteState {
+	next := &aofRewriteState{RunID: info["run_id"], Marker: info["aof_rewrites"] + "/" + info["aof_base_size"], Time: now.Unix()}
+	if prev == nil || prev.RunID != next.RunID {
+		return next
+	}
+	// aof_rewrites is counted at the start of a rewrite, which may fail.
+	if info["aof_rewrite_in_progress"] == "1" || info["aof_last_bgrewrite_status"] != "ok" {
+		return prev
+	}
+	if prev.Marker == next.Marker {
+		next.Time = prev.Time
+	}
+	return next
+}
+
+// evaluate checks info of the persistence section. The age of the last RDB save isn't checked if snapshotEnabled is
+// false, and the age of the last AOF rewrite is checked if lastRewrite isn't zero.
+func (opts *persistenceOpts) evaluate(info map[string]string, snapshotEnabled bool, lastRewrite, now time.Time) *checkers.Checker {
+	if status := info["rdb_last_bgsave_status"]; status != "ok" {
+		return checkers.Critical(fmt.Sprintf("rdb_last_bgsave_status: %s", status))
+	}
+	if info["aof_enabled"] == "1" {
+		for _, key := range []string{"aof_last_bgrewrite_status", "aof_last_write_status"} {
+			if status, ok := info[key]; ok && status != "ok" {
+				return checkers.Critical(fmt.Sprintf("%s: %s", key, status))
+			}
+		}
+	}
+
+	checkSt := checkers.OK
+	msgs := []string{}
+	if snapshotEnabled {
+		lastSave, err := strconv.ParseInt(info["rdb_last_save_time"], 10, 64)
+		if err != nil {
+			return checkers.Unknown("couldn't get rdb_last_save_time")
+		}
+		changes, err := strconv.ParseInt(info["rdb_changes_since_last_save"], 10, 64)
+		if err != nil {
+			return checkers.Unknown("couldn't get rdb_changes_since_last_save")
+		}
+		age := now.Sub(time.Unix(lastSave, 0))
+		msgs = append(msgs, fmt.Sprintf("last RDB save %d minutes ago with %d changes since then", int64(age.Minutes()), changes))
+		// Redis doesn't save a snapshot if nothing has been changed.
+		if changes > 0 {
+			if age > time.Duration(opts.Critical)*time.Minute {
+				checkSt = checkers.CRITICAL
+			} else if age > time.Duration(opts.Warning)*time.Minute {
+				checkSt = checkers.WARNING
+			}
+		}
+	} else {
+		msgs = append(msgs, "RDB snapshots disabled")
+	}
+
+	if info["aof_enabled"] == "1" {
+		if lastRewrite.IsZero() {
+			msgs = append(msgs, "AOF enabled")
+		} else {
+			age := now.Sub(lastRewrite)
+			msgs = append(msgs, fmt.Sprintf("AOF enabled, no AOF rewrite for %d minutes", int64(age.Minutes())))
+			if opts.AOFRewriteCritical > 0 && age > time.Duration(opts.AOFRewriteCritical)*time.Minute {
+				checkSt = checkers.CRITICAL
+			} else if opts.AOFRewriteWarning > 0 && age > time.Duration(opts.AOFRewriteWarning)*time.Minute && checkSt == checkers.OK {
+				checkSt = checkers.WARNING
+			}
+		}
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
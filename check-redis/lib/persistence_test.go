@@ -0,0 +1,137 @@
+package checkredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistenceEvaluate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	opts := &persistenceOpts{Warning: 60, Critical: 120}
+	info := func(kv ...string) map[string]string {
+		m := map[string]string{
+			"rdb_last_bgsave_status":      "ok",
+			"rdb_last_save_time":          "1599999700",
+			"rdb_changes_since_last_save": "10",
+			"aof_enabled":                 "0",
+		}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = kv[i+1]
+		}
+		return m
+	}
+
+	tests := []struct {
+		info map[string]string
+		want checkers.Status
+		msg  string
+	}{
+		{info: info(), want: checkers.OK, msg: "last RDB save 5 minutes ago with 10 changes since then"},
+		{info: info("rdb_last_save_time", "1599995000"), want: checkers.WARNING},
+		{info: info("rdb_last_save_time", "1599990000"), want: checkers.CRITICAL},
+		{info: info("rdb_last_save_time", "1599990000", "rdb_changes_since_last_save", "0"), want: checkers.OK},
+		{info: info("rdb_last_bgsave_status", "err"), want: checkers.CRITICAL, msg: "rdb_last_bgsave_status: err"},
+		{info: info("aof_enabled", "1", "aof_last_bgrewrite_status", "ok", "aof_last_write_status", "err"), want: checkers.CRITICAL, msg: "aof_last_write_status: err"},
+		{info: info("aof_enabled", "1", "aof_last_bgrewrite_status", "ok", "aof_last_write_status", "ok"), want: checkers.OK, msg: "last RDB save 5 minutes ago with 10 changes since then, AOF enabled"},
+		{info: info("rdb_last_save_time", ""), want: checkers.UNKNOWN},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluate(tt.info, true, time.Time{}, now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		if tt.msg != "" {
+			assert.Equal(t, tt.msg, ckr.Message)
+		}
+	}
+}
+
+func TestPersistenceEvaluateWithoutSnapshot(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	opts := &persistenceOpts{Warning: 60, Critical: 120}
+	info := map[string]string{
+		"rdb_last_bgsave_status":      "ok",
+		"rdb_last_save_time":          "1599990000",
+		"rdb_changes_since_last_save": "10",
+		"aof_enabled":                 "1",
+		"aof_last_bgrewrite_status":   "ok",
+		"aof_last_write_status":       "ok",
+	}
+	ckr := opts.evaluate(info, false, time.Time{}, now)
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+	assert.Equal(t, "RDB snapshots disabled, AOF enabled", ckr.Message)
+
+	info["rdb_last_bgsave_status"] = "err"
+	ckr = opts.evaluate(info, false, time.Time{}, now)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+}
+
+func TestPersistenceEvaluateAOFRewrite(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	opts := &persistenceOpts{Warning: 60, Critical: 120, AOFRewriteWarning: 60, AOFRewriteCritical: 1440}
+	info := map[string]string{
+		"rdb_last_bgsave_status":      "ok",
+		"rdb_last_save_time":          "1599999700",
+		"rdb_changes_since_last_save": "10",
+		"aof_enabled":                 "1",
+		"aof_last_bgrewrite_status":   "ok",
+		"aof_last_write_status":       "ok",
+	}
+
+	tests := []struct {
+		lastRewrite time.Time
+		want        checkers.Status
+		msg         string
+	}{
+		{lastRewrite: now.Add(-30 * time.Minute), want: checkers.OK, msg: "last RDB save 5 minutes ago with 10 changes since then, AOF enabled, no AOF rewrite for 30 minutes"},
+		{lastRewrite: now.Add(-2 * time.Hour), want: checkers.WARNING},
+		{lastRewrite: now.Add(-25 * time.Hour), want: checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluate(info, true, tt.lastRewrite, now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		if tt.msg != "" {
+			assert.Equal(t, tt.msg, ckr.Message)
+		}
+	}
+}
+
+func TestNextAOFRewriteState(t *testing.T) {
+	t0 := time.Unix(1600000000, 0)
+	t1 := t0.Add(time.Hour)
+	info := func(kv ...string) map[string]string {
+		m := map[string]string{
+			"run_id":                    "a",
+			"aof_rewrites":              "3",
+			"aof_base_size":             "1000",
+			"aof_rewrite_in_progress":   "0",
+			"aof_last_bgrewrite_status": "ok",
+		}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = kv[i+1]
+		}
+		return m
+	}
+	prev := &aofRewriteState{RunID: "a", Marker: "3/1000", Time: t0.Unix()}
+
+	tests := []struct {
+		name string
+		prev *aofRewriteState
+		info map[string]string
+		want *aofRewriteState
+	}{
+		{"first check", nil, info(), &aofRewriteState{RunID: "a", Marker: "3/1000", Time: t1.Unix()}},
+		{"not rewritten", prev, info(), prev},
+		{"rewritten", prev, info("aof_rewrites", "4", "aof_base_size", "1200"), &aofRewriteState{RunID: "a", Marker: "4/1200", Time: t1.Unix()}},
+		{"rewritten before Redis 7.0", &aofRewriteState{RunID: "a", Marker: "/1000", Time: t0.Unix()}, info("aof_rewrites", "", "aof_base_size", "1200"), &aofRewriteState{RunID: "a", Marker: "/1200", Time: t1.Unix()}},
+		{"in progress", prev, info("aof_rewrites", "4", "aof_rewrite_in_progress", "1"), prev},
+		{"failed", prev, info("aof_rewrites", "4", "aof_last_bgrewrite_status", "err"), prev},
+		{"restarted", prev, info("run_id", "b"), &aofRewriteState{RunID: "b", Marker: "3/1000", Time: t1.Unix()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextAOFRewriteState(tt.prev, tt.info, t1))
+		})
+	}
+}
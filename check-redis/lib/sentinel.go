@@ -0,0 +1,191 @@
+package checkredis
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+// sentinelOpts doesn't embed redisSetting because the default port of Sentinel differs.
+type sentinelOpts struct {
+	Host            string   `short:"H" long:"host" default:"localhost" description:"Sentinel hostname"`
+	Socket          string   `short:"s" long:"socket" default:"" description:"Sentinel socket"`
+	Port            string   `short:"p" long:"port" default:"26379" description:"Sentinel port"`
+	Password        string   `short:"P" long:"sentinel-password" default:"" description:"Sentinel password" env:"REDIS_SENTINEL_PASSWORD"`
+	PasswordFile    string   `long:"sentinel-password-file" value-name:"FILE" description:"Read the Sentinel password from FILE instead of --sentinel-password"`
+	Timeout         uint64   `short:"t" long:"timeout" default:"5" description:"Dial Timeout in sec"`
+	MasterName      string   `short:"m" long:"master-name" required:"true" description:"Name of the master monitored by Sentinel"`
+	ExpectedMasters []string `short:"e" long:"expected-master" value-name:"HOST[:PORT]" description:"Warning if the master is not one of the hosts (may be repeated)"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// redisSetting returns the setting to connect to Sentinel. The password is not included,
+// because Sentinel doesn't share the password of Redis.
+func (opts *sentinelOpts) redisSetting() redisSetting {
+	return redisSetting{
+		Host:    opts.Host,
+		Socket:  opts.Socket,
+		Port:    opts.Port,
+		Timeout: opts.Timeout,
+
+		DebugOpts: opts.DebugOpts,
+	}
+}
+
+// password returns the password of --sentinel-password-file, --sentinel-password or REDIS_SENTINEL_PASSWORD in this order,
+// resolved by secret.Resolve. It doesn't fall back to REDIS_PASSWORD, which is the password of Redis.
+func (opts *sentinelOpts) password() (string, error) {
+	o := secret.PasswordFileOpts{PasswordFile: opts.PasswordFile}
+	return o.ResolvePassword(opts.Password)
+}
+
+// sentinelStatus is what Sentinel knows about the master.
+type sentinelStatus struct {
+	addr      []string // IP and port of the master
+	flags     []string
+	numOthers string // the number of the other Sentinels
+	quorum    string
+	quorumErr error // the reason why the quorum is not reachable, or nil
+}
+
+func checkSentinel(args []string) *checkers.Checker {
+	opts := sentinelOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "sentinel [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.redisSetting().selfTest()
+	}
+
+	password, err := opts.password()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	c, err := dialRedis(opts.redisSetting(), password)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer c.Close()
+
+	st, err := getSentinelStatus(c, opts.MasterName)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st)
+}
+
+func getSentinelStatus(c redis.Conn, name string) (*sentinelStatus, error) {
+	var st sentinelStatus
+	addr, err := redis.Strings(c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", name))
+	if err == redis.ErrNil || (err == nil && len(addr) != 2) {
+		return nil, fmt.Errorf("master %s is not monitored by Sentinel", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute SENTINEL GET-MASTER-ADDR-BY-NAME: %s", err)
+	}
+	st.addr = addr
+
+	master, err := redis.StringMap(c.Do("SENTINEL", "MASTER", name))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute SENTINEL MASTER: %s", err)
+	}
+	st.flags = strings.Split(master["flags"], ",")
+	st.numOthers = master["num-other-sentinels"]
+	st.quorum = master["quorum"]
+
+	// CKQUORUM replies an error such as "NOQUORUM 1 usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master"
+	_, err = redis.String(c.Do("SENTINEL", "CKQUORUM", name))
+	if _, ok := err.(redis.Error); ok {
+		st.quorumErr = err
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't execute SENTINEL CKQUORUM: %s", err)
+	}
+	return &st, nil
+}
+
+func (st *sentinelStatus) hasFlag(flag string) bool {
+	for _, f := range st.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupHost is replaced in tests.
+var lookupHost = net.LookupHost
+
+// isExpectedMaster reports whether the master at ip:port is one of HOST[:PORT] in expected.
+// The hosts are resolved because Sentinel reports the master by the IP address.
+func isExpectedMaster(expected []string, ip, port string) bool {
+	for _, e := range expected {
+		host, p, err := net.SplitHostPort(e)
+		if err != nil {
+			host, p = e, ""
+		}
+		if p != "" && p != port {
+			continue
+		}
+		if host == ip {
+			return true
+		}
+		addrs, err := lookupHost(host)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluate returns CRITICAL if the master is down or the quorum is not reachable,
+// and WARNING if a failover is in progress or the master is not expected.
+func (opts *sentinelOpts) evaluate(st *sentinelStatus) *checkers.Checker {
+	master := net.JoinHostPort(st.addr[0], st.addr[1])
+	msgs := []string{fmt.Sprintf("master %s is %s", opts.MasterName, master)}
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+
+	if st.hasFlag("o_down") {
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, "objectively down")
+	} else if st.hasFlag("s_down") {
+		raise(checkers.WARNING)
+		msgs = append(msgs, "subjectively down")
+	}
+	if st.hasFlag("failover_in_progress") {
+		raise(checkers.WARNING)
+		msgs = append(msgs, "failover in progress")
+	}
+	if st.quorumErr != nil {
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, st.quorumErr.Error())
+	} else {
+		msgs = append(msgs, fmt.Sprintf("quorum %s is reachable with %s other Sentinels", st.quorum, st.numOthers))
+	}
+	if len(opts.ExpectedMasters) > 0 && !isExpectedMaster(opts.ExpectedMasters, st.addr[0], st.addr[1]) {
+		raise(checkers.WARNING)
+		msgs = append(msgs, fmt.Sprintf("not one of the expected masters %s", strings.Join(opts.ExpectedMasters, ", ")))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", "))
+}
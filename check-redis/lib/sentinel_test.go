@@ -0,0 +1,57 @@
+package checkredis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsExpectedMaster(t *testing.T) {
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		if host == "redis1.example.com" {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	expected := []string{"redis1.example.com", "10.0.0.2:6380"}
+	assert.True(t, isExpectedMaster(expected, "10.0.0.1", "6379"), "the host should be resolved")
+	assert.True(t, isExpectedMaster(expected, "10.0.0.2", "6380"))
+	assert.False(t, isExpectedMaster(expected, "10.0.0.2", "6379"), "the port should be compared if specified")
+	assert.False(t, isExpectedMaster(expected, "10.0.0.3", "6379"))
+}
+
+func TestSentinelEvaluate(t *testing.T) {
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) { return nil, errors.New("no such host") }
+
+	status := func(flags ...string) *sentinelStatus {
+		return &sentinelStatus{addr: []string{"10.0.0.1", "6379"}, flags: append([]string{"master"}, flags...), numOthers: "2", quorum: "2"}
+	}
+	noQuorum := status()
+	noQuorum.quorumErr = redis.Error("NOQUORUM 1 usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master")
+
+	tests := []struct {
+		name     string
+		expected []string
+		status   *sentinelStatus
+		want     checkers.Status
+	}{
+		{"healthy", nil, status(), checkers.OK},
+		{"expected master", []string{"10.0.0.2", "10.0.0.1:6379"}, status(), checkers.OK},
+		{"unexpected master", []string{"10.0.0.2"}, status(), checkers.WARNING},
+		{"failover in progress", nil, status("failover_in_progress"), checkers.WARNING},
+		{"subjectively down", nil, status("s_down"), checkers.WARNING},
+		{"objectively down", nil, status("s_down", "o_down", "failover_in_progress"), checkers.CRITICAL},
+		{"no quorum", nil, noQuorum, checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		opts := sentinelOpts{MasterName: "mymaster", ExpectedMasters: tt.expected}
+		ckr := opts.evaluate(tt.status)
+		assert.Equal(t, tt.want, ckr.Status, "%s: %s", tt.name, ckr.Message)
+	}
+}
@@ -0,0 +1,149 @@
+package checkredis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type slowlogOpts struct {
+	redisSetting
+	Threshold int64  `short:"T" long:"threshold" default:"10000" value-name:"MICROSECONDS" description:"count slow commands which took the microseconds or more"`
+	Warning   int64  `short:"w" long:"warning" default:"1" description:"warning if the number of slow commands since the last check is over or equal"`
+	Critical  *int64 `short:"c" long:"critical" description:"critical if the number of slow commands since the last check is over or equal"`
+	Entries   int    `long:"entries" default:"128" description:"the number of the recent slowlog entries to read"`
+	StateDir  string `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+}
+
+// slowlogState is the newest slowlog entry at the last run.
+type slowlogState struct {
+	RunID  string `json:"run_id"`
+	LastID int64  `json:"last_id"` // -1 if the slowlog was empty
+}
+
+type slowlogEntry struct {
+	id       int64
+	duration int64 // microseconds
+	command  string
+}
+
+func checkSlowlog(args []string) *checkers.Checker {
+	opts := slowlogOpts{}
+	psr := flags.NewParser(&opts, flags.Default)
+	psr.Usage = "slowlog [OPTIONS]"
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+
+	c, info, err := connectRedisGetInfo(opts.redisSetting)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	defer c.Close()
+
+	length, err := redis.Int64(c.Do("SLOWLOG", "LEN"))
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("couldn't execute SLOWLOG LEN: %s", err))
+	}
+	entries, err := getSlowlog(c, opts.Entries)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := opts.stateFile(state.Dir(opts.StateDir, "check-redis"))
+	var prev *slowlogState
+	if _, err := state.Load(stateFile, &prev); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	next := &slowlogState{RunID: (*info)["run_id"], LastID: -1}
+	if len(entries) > 0 {
+		next.LastID = entries[0].id
+	}
+	if err := state.Save(stateFile, next); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(entries, prev, next.RunID, length)
+}
+
+// getSlowlog returns the recent slowlog entries, the newest first.
+func getSlowlog(c redis.Conn, n int) ([]slowlogEntry, error) {
+	reply, err := redis.Values(c.Do("SLOWLOG", "GET", n))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute SLOWLOG GET: %s", err)
+	}
+	entries := make([]slowlogEntry, 0, len(reply))
+	for _, r := range reply {
+		// id, timestamp, duration, arguments and, since Redis 4.0, client address and name
+		v, err := redis.Values(r, nil)
+		if err != nil || len(v) < 4 {
+			return nil, fmt.Errorf("unexpected slowlog entry: %v", r)
+		}
+		var e slowlogEntry
+		if e.id, err = redis.Int64(v[0], nil); err != nil {
+			return nil, fmt.Errorf("unexpected slowlog id: %s", err)
+		}
+		if e.duration, err = redis.Int64(v[2], nil); err != nil {
+			return nil, fmt.Errorf("unexpected slowlog duration: %s", err)
+		}
+		if args, err := redis.Strings(v[3], nil); err == nil && len(args) > 0 {
+			e.command = strings.ToUpper(args[0])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (opts *slowlogOpts) stateFile(stateDir string) string {
+	key := opts.Socket
+	if key == "" {
+		key = strings.Join([]string{opts.Host, opts.Port}, ":")
+	}
+	return state.File(stateDir, "slowlog", key)
+}
+
+func (opts *slowlogOpts) evaluate(entries []slowlogEntry, prev *slowlogState, runID string, length int64) *checkers.Checker {
+	if prev == nil {
+		return checkers.Ok(fmt.Sprintf("slowlog length: %d (first check)", length))
+	}
+	lastID := prev.LastID
+	// The slowlog ids start from 0 again when Redis is restarted, which changes run_id.
+	if prev.RunID != runID {
+		lastID = -1
+	}
+
+	var count int64
+	var slowest *slowlogEntry
+	for i, e := range entries {
+		if e.id <= lastID {
+			break
+		}
+		if e.duration < opts.Threshold {
+			continue
+		}
+		count++
+		if slowest == nil || e.duration > slowest.duration {
+			slowest = &entries[i]
+		}
+	}
+
+	msg := fmt.Sprintf("%d slow commands over %d microseconds since the last check, slowlog length: %d", count, opts.Threshold, length)
+	if slowest != nil {
+		msg += fmt.Sprintf(", slowest: %s took %d microseconds", slowest.command, slowest.duration)
+	}
+	checkSt := checkers.OK
+	if opts.Critical != nil && count >= *opts.Critical {
+		checkSt = checkers.CRITICAL
+	} else if count >= opts.Warning {
+		checkSt = checkers.WARNING
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
@@ -0,0 +1,74 @@
+package checkredis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowlogEvaluate(t *testing.T) {
+	last := func(id int64) *slowlogState { return &slowlogState{RunID: "abc", LastID: id} }
+	crit := int64(3)
+	opts := &slowlogOpts{Threshold: 10000, Warning: 1, Critical: &crit}
+	entries := []slowlogEntry{
+		{id: 12, duration: 25000, command: "KEYS"},
+		{id: 11, duration: 500, command: "GET"},
+		{id: 10, duration: 12000, command: "HGETALL"},
+		{id: 9, duration: 80000, command: "SMEMBERS"},
+		{id: 8, duration: 15000, command: "ZRANGE"},
+	}
+
+	tests := []struct {
+		entries []slowlogEntry
+		prev    *slowlogState
+		runID   string
+		want    checkers.Status
+		msg     string
+	}{
+		{entries: entries, prev: nil, runID: "abc", want: checkers.OK, msg: "slowlog length: 5 (first check)"},
+		{entries: entries, prev: last(12), runID: "abc", want: checkers.OK},
+		{entries: entries, prev: last(11), runID: "abc", want: checkers.WARNING, msg: "1 slow commands over 10000 microseconds since the last check, slowlog length: 5, slowest: KEYS took 25000 microseconds"},
+		{entries: entries, prev: last(10), runID: "abc", want: checkers.WARNING},
+		{entries: entries, prev: last(7), runID: "abc", want: checkers.CRITICAL, msg: "4 slow commands over 10000 microseconds since the last check, slowlog length: 5, slowest: SMEMBERS took 80000 microseconds"},
+		{entries: entries, prev: last(-1), runID: "abc", want: checkers.CRITICAL},
+		// restarted
+		{entries: entries, prev: last(100), runID: "def", want: checkers.CRITICAL, msg: "4 slow commands over 10000 microseconds since the last check, slowlog length: 5, slowest: SMEMBERS took 80000 microseconds"},
+		// restarted, and the ids have grown past the last id
+		{entries: entries, prev: last(10), runID: "def", want: checkers.CRITICAL},
+		{entries: nil, prev: last(-1), runID: "abc", want: checkers.OK},
+	}
+	for _, tt := range tests {
+		ckr := opts.evaluate(tt.entries, tt.prev, tt.runID, 5)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		if tt.msg != "" {
+			assert.Equal(t, tt.msg, ckr.Message)
+		}
+	}
+}
+
+func TestSlowlogState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &slowlogOpts{redisSetting: redisSetting{Host: "localhost", Port: "6379"}}
+	f := opts.stateFile(filepath.Join(dir, "state"))
+
+	var prev *slowlogState
+	_, err = state.Load(f, &prev)
+	assert.Nil(t, err)
+	assert.Nil(t, prev)
+
+	want := &slowlogState{RunID: "abc", LastID: 42}
+	assert.Nil(t, state.Save(f, want))
+	_, err = state.Load(f, &prev)
+	assert.Nil(t, err)
+	assert.Equal(t, want, prev)
+}
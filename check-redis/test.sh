@@ -24,4 +24,6 @@ docker run --name "test-$plugin" -p "$port:6379" -d "$image" --requirepass "$pas
 trap 'docker stop test-$plugin; docker rm test-$plugin; exit' EXIT
 sleep 10
 
+$plugin persistence --port $port --password $password || exit
+
 exec $plugin reachable --port $port --password $password
@@ -0,0 +1,214 @@
+package checks3object
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/awsutil"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type objectOpts struct {
+	Region       string `short:"r" long:"region" value-name:"REGION" description:"AWS Region"`
+	Bucket       string `short:"b" long:"bucket" required:"true" value-name:"BUCKET" description:"Bucket name"`
+	Key          string `short:"k" long:"key" value-name:"KEY" description:"Key of the object to check"`
+	Prefix       string `short:"p" long:"prefix" value-name:"PREFIX" description:"Check the newest object whose key starts with the prefix"`
+	WarningAge   int64  `long:"warning-age" value-name:"HOURS" description:"Trigger a warning if the object is older than the hours"`
+	CriticalAge  int64  `long:"critical-age" value-name:"HOURS" description:"Trigger a critical if the object is older than the hours"`
+	WarningSize  int64  `long:"warning-size" value-name:"BYTES" description:"Trigger a warning if the object is smaller than the bytes"`
+	CriticalSize int64  `long:"critical-size" value-name:"BYTES" description:"Trigger a critical if the object is smaller than the bytes"`
+	MaxRetries   int    `short:"t" long:"max-retries" value-name:"MAX-RETRIES" description:"Maximum number of retries to call the AWS API"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "S3 Object"
+	return ckr
+}
+
+type s3ObjectPlugin struct {
+	Service s3iface.S3API
+	*objectOpts
+}
+
+type objectInfo struct {
+	key          string
+	size         int64
+	lastModified time.Time
+}
+
+func newS3ObjectPlugin(opts *objectOpts) (*s3ObjectPlugin, error) {
+	if (opts.Key == "") == (opts.Prefix == "") {
+		return nil, fmt.Errorf("either --key or --prefix must be specified")
+	}
+	var err error
+	p := &s3ObjectPlugin{objectOpts: opts}
+	p.Service, err = createService(opts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func createAWSConfig(opts *objectOpts) *aws.Config {
+	conf := aws.NewConfig()
+	if opts.Region != "" {
+		conf = conf.WithRegion(opts.Region)
+	}
+	if opts.MaxRetries > 0 {
+		conf = conf.WithMaxRetries(opts.MaxRetries)
+	}
+	return conf
+}
+
+func createService(opts *objectOpts) (*s3.S3, error) {
+	sess, err := session.NewSession(aws.NewConfig().WithHTTPClient(&http.Client{Transport: debuglog.Transport(nil)}))
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess, createAWSConfig(opts)), nil
+}
+
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "NotFound", s3.ErrCodeNoSuchKey:
+			return true
+		}
+	}
+	return false
+}
+
+// fetchObject returns the object specified by --key, or the newest object under --prefix.
+// It returns nil if the object is not found.
+func (p *s3ObjectPlugin) fetchObject() (*objectInfo, error) {
+	if p.Key != "" {
+		output, err := p.Service.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(p.Bucket),
+			Key:    aws.String(p.Key),
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return &objectInfo{
+			key:          p.Key,
+			size:         aws.Int64Value(output.ContentLength),
+			lastModified: aws.TimeValue(output.LastModified),
+		}, nil
+	}
+
+	var newest *objectInfo
+	err := p.Service.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(p.Bucket),
+		Prefix: aws.String(p.Prefix),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range output.Contents {
+			// Skip "directory" placeholders created by the console.
+			if strings.HasSuffix(aws.StringValue(o.Key), "/") {
+				continue
+			}
+			lastModified := aws.TimeValue(o.LastModified)
+			if newest == nil || lastModified.After(newest.lastModified) {
+				newest = &objectInfo{
+					key:          aws.StringValue(o.Key),
+					size:         aws.Int64Value(o.Size),
+					lastModified: lastModified,
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newest, nil
+}
+
+func (p *s3ObjectPlugin) check(obj *objectInfo, now time.Time) *checkers.Checker {
+	if obj == nil {
+		if p.Key != "" {
+			return checkers.Critical(fmt.Sprintf("s3://%s/%s is not found", p.Bucket, p.Key))
+		}
+		return checkers.Critical(fmt.Sprintf("no objects found under s3://%s/%s", p.Bucket, p.Prefix))
+	}
+
+	age := now.Sub(obj.lastModified)
+	status := checkers.OK
+	var msgs []string
+	if p.CriticalAge > 0 && age > time.Duration(p.CriticalAge)*time.Hour {
+		status = checkers.CRITICAL
+		msgs = append(msgs, fmt.Sprintf("older than %d hours", p.CriticalAge))
+	} else if p.WarningAge > 0 && age > time.Duration(p.WarningAge)*time.Hour {
+		status = checkers.WARNING
+		msgs = append(msgs, fmt.Sprintf("older than %d hours", p.WarningAge))
+	}
+	if p.CriticalSize > 0 && obj.size < p.CriticalSize {
+		status = checkers.CRITICAL
+		msgs = append(msgs, fmt.Sprintf("smaller than %d bytes", p.CriticalSize))
+	} else if p.WarningSize > 0 && obj.size < p.WarningSize {
+		if status == checkers.OK {
+			status = checkers.WARNING
+		}
+		msgs = append(msgs, fmt.Sprintf("smaller than %d bytes", p.WarningSize))
+	}
+
+	msg := fmt.Sprintf("s3://%s/%s was modified at %s (%d bytes)", p.Bucket, obj.key, obj.lastModified.Format(time.RFC3339), obj.size)
+	if len(msgs) > 0 {
+		msg += ": " + strings.Join(msgs, ", ")
+	}
+	return checkers.NewChecker(status, msg)
+}
+
+func (p *s3ObjectPlugin) run() *checkers.Checker {
+	obj, err := p.fetchObject()
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	return p.check(obj, time.Now())
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &objectOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	p, err := newS3ObjectPlugin(opts)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprint(err))
+	}
+	if opts.SelfTest {
+		return selftest.Run(func() error {
+			svc, err := createService(opts)
+			if err != nil {
+				return err
+			}
+			return awsutil.CheckConfig(&svc.Config)
+		})
+	}
+	return p.run()
+}
@@ -0,0 +1,102 @@
+package checks3object
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+var baseTime = time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+
+type mockS3Client struct {
+	s3iface.S3API
+	objects map[string]*s3.Object
+	pages   [][]*s3.Object
+}
+
+func (c *mockS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	o, ok := c.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{ContentLength: o.Size, LastModified: o.LastModified}, nil
+}
+
+func (c *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	for i, page := range c.pages {
+		if !fn(&s3.ListObjectsV2Output{Contents: page}, i == len(c.pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func newObject(key string, size int64, lastModified time.Time) *s3.Object {
+	return &s3.Object{Key: aws.String(key), Size: aws.Int64(size), LastModified: aws.Time(lastModified)}
+}
+
+func TestFetchObject(t *testing.T) {
+	mock := &mockS3Client{
+		objects: map[string]*s3.Object{
+			"backup/latest.tar.gz": newObject("backup/latest.tar.gz", 1024, baseTime),
+		},
+		pages: [][]*s3.Object{
+			{
+				newObject("backup/", 0, baseTime),
+				newObject("backup/20200101.tar.gz", 2048, baseTime.Add(-24*time.Hour)),
+			},
+			{
+				newObject("backup/20200102.tar.gz", 4096, baseTime),
+				newObject("backup/20191231.tar.gz", 1024, baseTime.Add(-48*time.Hour)),
+			},
+		},
+	}
+
+	p := &s3ObjectPlugin{Service: mock, objectOpts: &objectOpts{Bucket: "bucket", Key: "backup/latest.tar.gz"}}
+	obj, err := p.fetchObject()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1024), obj.size)
+
+	p.Key = "backup/missing.tar.gz"
+	obj, err = p.fetchObject()
+	assert.Nil(t, err)
+	assert.Nil(t, obj)
+
+	p.Key = ""
+	p.Prefix = "backup/"
+	obj, err = p.fetchObject()
+	assert.Nil(t, err)
+	assert.Equal(t, "backup/20200102.tar.gz", obj.key)
+	assert.Equal(t, int64(4096), obj.size)
+}
+
+func TestCheck(t *testing.T) {
+	obj := &objectInfo{key: "backup/20200102.tar.gz", size: 4096, lastModified: baseTime}
+	opts := &objectOpts{Bucket: "bucket", Prefix: "backup/", WarningAge: 24, CriticalAge: 48, WarningSize: 2048, CriticalSize: 1024}
+	p := &s3ObjectPlugin{objectOpts: opts}
+
+	tests := []struct {
+		obj  *objectInfo
+		now  time.Time
+		want checkers.Status
+	}{
+		{obj: obj, now: baseTime.Add(time.Hour), want: checkers.OK},
+		{obj: obj, now: baseTime.Add(25 * time.Hour), want: checkers.WARNING},
+		{obj: obj, now: baseTime.Add(49 * time.Hour), want: checkers.CRITICAL},
+		{obj: &objectInfo{key: obj.key, size: 1500, lastModified: baseTime}, now: baseTime, want: checkers.WARNING},
+		{obj: &objectInfo{key: obj.key, size: 100, lastModified: baseTime}, now: baseTime, want: checkers.CRITICAL},
+		{obj: &objectInfo{key: obj.key, size: 1500, lastModified: baseTime}, now: baseTime.Add(49 * time.Hour), want: checkers.CRITICAL},
+		{obj: nil, now: baseTime, want: checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := p.check(tt.obj, tt.now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+}
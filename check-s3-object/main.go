@@ -0,0 +1,7 @@
+package main
+
+import "github.com/mackerelio/go-check-plugins/check-s3-object/lib"
+
+func main() {
+	checks3object.Do()
+}
@@ -0,0 +1,50 @@
+package checkserverstatus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+type apacheOpts struct {
+	statusSetting
+}
+
+func checkApache(args []string) *checkers.Checker {
+	opts := apacheOpts{}
+	return check(&opts, &opts.statusSetting, "apache [OPTIONS]", args, "http://localhost/server-status?auto", parseApacheStatus)
+}
+
+// parseApacheStatus parses the machine readable page of mod_status, which is requested with "?auto".
+// The active connections are ConnsTotal of the event MPM, or BusyWorkers of the other MPMs.
+// The saturation is computed from BusyWorkers and the length of the scoreboard, which has a slot for each worker
+// up to MaxRequestWorkers.
+func parseApacheStatus(body string) (*serverStatus, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	busy, err := strconv.ParseInt(values["BusyWorkers"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("no BusyWorkers in the status; is the URL followed by ?auto?")
+	}
+	st := &serverStatus{busy: busy, active: busy}
+	if v, err := strconv.ParseInt(values["ConnsTotal"], 10, 64); err == nil {
+		st.active = v
+	}
+	// Total Accesses is shown only with ExtendedStatus On, which is the default since Apache 2.3.6.
+	if v, err := strconv.ParseInt(values["Total Accesses"], 10, 64); err == nil {
+		st.requests = v
+	}
+	if sb := values["Scoreboard"]; sb != "" {
+		st.capacity = int64(len(sb))
+	} else if idle, err := strconv.ParseInt(values["IdleWorkers"], 10, 64); err == nil {
+		st.capacity = busy + idle
+	}
+	return st, nil
+}
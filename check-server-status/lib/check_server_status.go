@@ -0,0 +1,216 @@
+package checkserverstatus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type statusSetting struct {
+	URL                 string   `short:"u" long:"url" description:"URL of the status page"`
+	Timeout             int      `short:"t" long:"timeout" default:"10" description:"Seconds before the request times out"`
+	WarningConnections  *int64   `long:"warning-connections" value-name:"N" description:"warning if the number of active connections is over"`
+	CriticalConnections *int64   `long:"critical-connections" value-name:"N" description:"critical if the number of active connections is over"`
+	WarningRate         *float64 `long:"warning-rate" value-name:"RPS" description:"warning if the requests per second since the last check is over"`
+	CriticalRate        *float64 `long:"critical-rate" value-name:"RPS" description:"critical if the requests per second since the last check is over"`
+	WarningSaturation   *float64 `long:"warning-saturation" value-name:"PERCENT" description:"warning if the percentage of busy workers is over"`
+	CriticalSaturation  *float64 `long:"critical-saturation" value-name:"PERCENT" description:"critical if the percentage of busy workers is over"`
+	Perfdata            bool     `long:"perfdata" description:"Append the active connections, the request rate and the saturation as performance data"`
+	StateDir            string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// serverStatus is the status of a web server read from the status page.
+type serverStatus struct {
+	active   int64 // active connections
+	requests int64 // total requests since the server started
+	busy     int64 // busy workers or connections
+	capacity int64 // the maximum of busy workers or connections, 0 if unknown
+}
+
+// requestsState is the total requests at the last check.
+type requestsState struct {
+	Time     int64 `json:"time"`
+	Requests int64 `json:"requests"`
+}
+
+var commands = map[string](func([]string) *checkers.Checker){
+	"nginx":  checkNginx,
+	"apache": checkApache,
+}
+
+func separateSub(argv []string) (string, []string) {
+	if len(argv) == 0 || strings.HasPrefix(argv[0], "-") {
+		return "", argv
+	}
+	return argv[0], argv[1:]
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
+	fn, ok := commands[subCmd]
+	if !ok {
+		fmt.Println(`Usage:
+  check-server-status [subcommand] [OPTIONS]
+
+SubCommands:`)
+		for k := range commands {
+			fmt.Printf("  %s\n", k)
+		}
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Server Status"
+		return ckr
+	}
+	ckr := fn(argv)
+	ckr.Name = fmt.Sprintf("Server Status %s", strings.ToUpper(string(subCmd[0]))+subCmd[1:])
+	return ckr
+}
+
+// check parses args into the options of the subcommand which embeds opts, reads the status page with parse and
+// evaluates it. The URL defaults to defaultURL.
+func check(subOpts interface{}, opts *statusSetting, usage string, args []string, defaultURL string, parse func(string) (*serverStatus, error)) *checkers.Checker {
+	psr := flags.NewParser(subOpts, flags.Default)
+	psr.Usage = usage
+	_, err := psr.ParseArgs(args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.URL == "" {
+		opts.URL = defaultURL
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.ResolveURL(opts.URL))
+	}
+
+	body, err := opts.get()
+	if err != nil {
+		return checkers.Critical(err.Error())
+	}
+	st, err := parse(body)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := state.File(state.Dir(opts.StateDir, "check-server-status"), "requests", opts.URL)
+	var last *requestsState
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	now := time.Now()
+	if err := state.Save(stateFile, &requestsState{Time: now.Unix(), Requests: st.requests}); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(st, last, now)
+}
+
+func (opts *statusSetting) get() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, opts.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "check-server-status")
+	opts.DebugOpts.Enable()
+	client := &http.Client{
+		Transport: debuglog.Transport(nil),
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed: http status code %d from %s", resp.StatusCode, opts.URL)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// requestRate returns the requests per second since the last check.
+// It returns false on the first check or if the server has been restarted.
+func requestRate(st *serverStatus, last *requestsState, now time.Time) (float64, bool) {
+	if last == nil || st.requests < last.Requests || now.Unix() <= last.Time {
+		return 0, false
+	}
+	return float64(st.requests-last.Requests) / float64(now.Unix()-last.Time), true
+}
+
+func (opts *statusSetting) evaluate(st *serverStatus, last *requestsState, now time.Time) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+	var msgs, perfs []string
+
+	msg := fmt.Sprintf("%d active connections", st.active)
+	switch {
+	case opts.CriticalConnections != nil && st.active > *opts.CriticalConnections:
+		raise(checkers.CRITICAL)
+		msg += fmt.Sprintf(" > %d", *opts.CriticalConnections)
+	case opts.WarningConnections != nil && st.active > *opts.WarningConnections:
+		raise(checkers.WARNING)
+		msg += fmt.Sprintf(" > %d", *opts.WarningConnections)
+	}
+	msgs = append(msgs, msg)
+	perfs = append(perfs, perfdata.Format("active", strconv.FormatInt(st.active, 10), "", perfdata.OptInt(opts.WarningConnections), perfdata.OptInt(opts.CriticalConnections)))
+
+	if rate, ok := requestRate(st, last, now); ok {
+		msg := fmt.Sprintf("%.1f requests/s", rate)
+		switch {
+		case opts.CriticalRate != nil && rate > *opts.CriticalRate:
+			raise(checkers.CRITICAL)
+			msg += fmt.Sprintf(" > %g", *opts.CriticalRate)
+		case opts.WarningRate != nil && rate > *opts.WarningRate:
+			raise(checkers.WARNING)
+			msg += fmt.Sprintf(" > %g", *opts.WarningRate)
+		}
+		msgs = append(msgs, msg)
+		perfs = append(perfs, perfdata.Format("rate", fmt.Sprintf("%.2f", rate), "", perfdata.OptFloat(opts.WarningRate), perfdata.OptFloat(opts.CriticalRate)))
+	}
+
+	if st.capacity > 0 {
+		saturation := float64(st.busy) / float64(st.capacity) * 100
+		msg := fmt.Sprintf("%d/%d busy (%.1f%%)", st.busy, st.capacity, saturation)
+		switch {
+		case opts.CriticalSaturation != nil && saturation > *opts.CriticalSaturation:
+			raise(checkers.CRITICAL)
+			msg += fmt.Sprintf(" > %g%%", *opts.CriticalSaturation)
+		case opts.WarningSaturation != nil && saturation > *opts.WarningSaturation:
+			raise(checkers.WARNING)
+			msg += fmt.Sprintf(" > %g%%", *opts.WarningSaturation)
+		}
+		msgs = append(msgs, msg)
+		perfs = append(perfs, perfdata.Format("saturation", fmt.Sprintf("%.1f", saturation), "%", perfdata.OptFloat(opts.WarningSaturation), perfdata.OptFloat(opts.CriticalSaturation)))
+	} else if opts.WarningSaturation != nil || opts.CriticalSaturation != nil {
+		return checkers.Unknown("the saturation is unknown; specify --max-connections for nginx")
+	}
+
+	result := strings.Join(msgs, ", ")
+	if opts.Perfdata {
+		result += " | " + strings.Join(perfs, " ")
+	}
+	return checkers.NewChecker(checkSt, result)
+}
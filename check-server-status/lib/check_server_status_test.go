@@ -0,0 +1,142 @@
+package checkserverstatus
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const nginxStatus = `Active connections: 291
+server accepts handled requests
+ 16630948 16630948 31070465
+Reading: 6 Writing: 179 Waiting: 106
+`
+
+var apacheStatus = `localhost
+ServerVersion: Apache/2.4.57 (Unix)
+ServerMPM: event
+Total Accesses: 123456
+Total kBytes: 98765
+Uptime: 86400
+BusyWorkers: 30
+IdleWorkers: 70
+ConnsTotal: 45
+Scoreboard: ` + "W__RR__K" + strings.Repeat("_", 92) + strings.Repeat(".", 500) + `
+`
+
+func TestParseNginxStatus(t *testing.T) {
+	st, err := parseNginxStatus(nginxStatus, 1024)
+	assert.Nil(t, err)
+	assert.Equal(t, &serverStatus{active: 291, requests: 31070465, busy: 291, capacity: 1024}, st)
+
+	_, err = parseNginxStatus("<html>Not Found</html>", 0)
+	assert.NotNil(t, err)
+}
+
+func TestParseApacheStatus(t *testing.T) {
+	st, err := parseApacheStatus(apacheStatus)
+	assert.Nil(t, err)
+	assert.Equal(t, &serverStatus{active: 45, requests: 123456, busy: 30, capacity: 600}, st)
+
+	st, err = parseApacheStatus("BusyWorkers: 3\nIdleWorkers: 5\n")
+	assert.Nil(t, err)
+	assert.Equal(t, &serverStatus{active: 3, busy: 3, capacity: 8}, st)
+
+	_, err = parseApacheStatus("<html>Apache Status</html>")
+	assert.NotNil(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Unix(1700000060, 0)
+	last := &requestsState{Time: 1700000000, Requests: 1000}
+	i := func(v int64) *int64 { return &v }
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		opts statusSetting
+		st   serverStatus
+		last *requestsState
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: statusSetting{},
+			st:   serverStatus{active: 10, requests: 1600},
+			want: checkers.OK,
+			msg:  "10 active connections",
+		},
+		{
+			opts: statusSetting{WarningRate: f(5), CriticalRate: f(20), Perfdata: true},
+			st:   serverStatus{active: 10, requests: 1600},
+			last: last,
+			want: checkers.WARNING,
+			msg:  "10 active connections, 10.0 requests/s > 5 | active=10;; rate=10.00;5;20",
+		},
+		{
+			// restarted
+			opts: statusSetting{WarningRate: f(5), CriticalRate: f(20)},
+			st:   serverStatus{active: 10, requests: 100},
+			last: last,
+			want: checkers.OK,
+			msg:  "10 active connections",
+		},
+		{
+			opts: statusSetting{WarningConnections: i(100), CriticalConnections: i(200), WarningSaturation: f(70), CriticalSaturation: f(90), Perfdata: true},
+			st:   serverStatus{active: 250, busy: 80, capacity: 100},
+			want: checkers.CRITICAL,
+			msg:  "250 active connections > 200, 80/100 busy (80.0%) > 70% | active=250;100;200 saturation=80.0%;70;90",
+		},
+		{
+			opts: statusSetting{CriticalSaturation: f(90)},
+			st:   serverStatus{active: 250, busy: 250},
+			want: checkers.UNKNOWN,
+			msg:  "the saturation is unknown; specify --max-connections for nginx",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(&tt.st, tt.last, now)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
+
+func TestCheckNginx(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nginx_status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, nginxStatus)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "check-server-status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"-u", ts.URL + "/nginx_status", "--state-dir", dir, "--max-connections", "1024", "--warning-saturation", "20", "--critical-saturation", "50"}
+	ckr := checkNginx(args)
+	assert.Equal(t, checkers.WARNING, ckr.Status, ckr.Message)
+	assert.Equal(t, "291 active connections, 291/1024 busy (28.4%) > 20%", ckr.Message)
+
+	// the state has been saved
+	var last requestsState
+	found, err := state.Load(state.File(dir, "requests", ts.URL+"/nginx_status"), &last)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(31070465), last.Requests)
+
+	ckr = checkNginx([]string{"-u", ts.URL + "/unknown", "--state-dir", dir})
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, ckr.Message)
+}
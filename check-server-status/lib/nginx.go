@@ -0,0 +1,43 @@
+package checkserverstatus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/mackerelio/checkers"
+)
+
+type nginxOpts struct {
+	statusSetting
+	MaxConnections int64 `long:"max-connections" value-name:"N" description:"worker_processes * worker_connections, to compute the saturation"`
+}
+
+func checkNginx(args []string) *checkers.Checker {
+	opts := nginxOpts{}
+	return check(&opts, &opts.statusSetting, "nginx [OPTIONS]", args, "http://localhost/nginx_status", func(body string) (*serverStatus, error) {
+		return parseNginxStatus(body, opts.MaxConnections)
+	})
+}
+
+var nginxStatusRe = regexp.MustCompile(`Active connections:\s*(\d+)\s+server accepts handled requests\s+(\d+)\s+(\d+)\s+(\d+)`)
+
+// parseNginxStatus parses the page of ngx_http_stub_status_module.
+// The saturation is computed from the active connections and maxConnections, which includes idle keep-alive connections
+// as worker_connections does.
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func parseNginxStatus(body string, maxConnections int64) (*serverStatus, error) {
+	m := nginxStatusRe.FindStringSubmatch(body)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected stub_status: %q", body)
+	}
+	st := &serverStatus{capacity: maxConnections}
+	st.active, _ = strconv.ParseInt(m[1], 10, 64)
+	st.requests, _ = strconv.ParseInt(m[4], 10, 64)
+	st.busy = st.active
+	return st, nil
+}
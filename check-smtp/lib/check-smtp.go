@@ -10,6 +10,10 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type options struct {
@@ -24,37 +28,73 @@ type options struct {
 	Warning  float64 `short:"w" long:"warning" description:"Warning threshold (sec)"`
 	Critical float64 `short:"c" long:"critical" description:"Critical threshold (sec)"`
 	Timeout  int     `short:"t" long:"timeout" default:"10" description:"Timeout (sec)"`
+
+	PolicyDomain   string   `long:"policy-domain" value-name:"DOMAIN" description:"Check the SPF, DMARC and DKIM records of DOMAIN instead of connecting to the server"`
+	DMARCMinPolicy string   `long:"dmarc-min-policy" value-name:"POLICY" default:"quarantine" choice:"none" choice:"quarantine" choice:"reject" description:"warning if the DMARC policy of --policy-domain is weaker"`
+	DKIMSelectors  []string `long:"dkim-selector" value-name:"SELECTOR" description:"DKIM selector of --policy-domain to check the key record of (may be repeated)"`
+	netutil.AddressFamilyOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "SMTP"
-	ckr.Exit()
+	return ckr
 }
 
-func makeConn(host, port string, timeout int, isSMTPS bool, tlsConfig *tls.Config) (net.Conn, error) {
+func makeConn(network, host, port string, timeout int, isSMTPS bool, tlsConfig *tls.Config) (conn net.Conn, err error) {
+	end := debuglog.Trace("smtp: dial %s %s (smtps: %t)", network, net.JoinHostPort(host, port), isSMTPS)
+	defer func() { end(err) }()
 	d := net.Dialer{Timeout: time.Duration(timeout) * time.Second}
 	if isSMTPS {
-		return tls.DialWithDialer(&d, "tcp", fmt.Sprintf("%s:%s", host, port), tlsConfig)
+		return tls.DialWithDialer(&d, network, net.JoinHostPort(host, port), tlsConfig)
 	}
-	return d.Dial("tcp", fmt.Sprintf("%s:%s", host, port))
+	return d.Dial(network, net.JoinHostPort(host, port))
 }
 
 func run(args []string) *checkers.Checker {
 	var opts options
 	_, err := flags.ParseArgs(&opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+
+	if opts.PolicyDomain != "" {
+		if opts.SelfTest {
+			return selftest.Run()
+		}
+		return checkPolicy(opts.PolicyDomain, opts.DMARCMinPolicy, opts.DKIMSelectors)
 	}
 
 	if opts.Warning == 0 && opts.Critical == 0 {
 		return checkers.Unknown("require threshold option (warning or critical)")
 	}
 
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
 	if opts.Auth != "" && opts.Auth != "PLAIN" {
 		return checkers.Unknown("invalid SMTP AUTH Authentication Mechanisms (only PLAIN supported)")
 	}
+	if opts.SelfTest {
+		checks := []selftest.Check{selftest.Resolve(opts.Host)}
+		if opts.Auth != "" {
+			checks = append(checks, selftest.Required("--authuser", opts.User), selftest.Required("--authpassword", opts.Password))
+		}
+		return selftest.Run(checks...)
+	}
+	if opts.Password, err = secret.Resolve(opts.Password); err != nil {
+		return checkers.Unknown(err.Error())
+	}
 
 	fqdn := opts.FQDN
 	if fqdn == "" {
@@ -70,7 +110,7 @@ func run(args []string) *checkers.Checker {
 		ServerName:         opts.Host,
 	}
 
-	conn, err := makeConn(opts.Host, opts.Port, opts.Timeout, opts.SMTPS, tlsConfig)
+	conn, err := makeConn(opts.Network("tcp"), opts.Host, opts.Port, opts.Timeout, opts.SMTPS, tlsConfig)
 	if err != nil {
 		return checkers.Critical(err.Error())
 	}
@@ -83,24 +123,36 @@ func run(args []string) *checkers.Checker {
 	}
 	defer c.Quit()
 
-	if err := c.Hello(fqdn); err != nil {
+	end := debuglog.Trace("smtp: HELO %s", fqdn)
+	err = c.Hello(fqdn)
+	end(err)
+	if err != nil {
 		return checkers.Critical(err.Error())
 	}
 
 	if opts.StartTLS {
-		if err := c.StartTLS(tlsConfig); err != nil {
+		end := debuglog.Trace("smtp: STARTTLS")
+		err := c.StartTLS(tlsConfig)
+		end(err)
+		if err != nil {
 			return checkers.Critical(err.Error())
 		}
 	}
 
 	if opts.Auth == "PLAIN" {
 		auth := smtp.PlainAuth("", opts.User, opts.Password, opts.Host)
-		if err := c.Auth(auth); err != nil {
+		end := debuglog.Trace("smtp: AUTH PLAIN as %s", opts.User)
+		err := c.Auth(auth)
+		end(err)
+		if err != nil {
 			return checkers.Critical(err.Error())
 		}
 	}
 
-	if err := c.Mail(""); err != nil {
+	end = debuglog.Trace("smtp: MAIL FROM:<>")
+	err = c.Mail("")
+	end(err)
+	if err != nil {
 		c.Reset()
 		return checkers.Critical(err.Error())
 	}
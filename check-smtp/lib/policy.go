@@ -0,0 +1,216 @@
+package checksmtp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+// lookupTXT is replaced in tests.
+var lookupTXT = net.LookupTXT
+
+// dmarcPolicies are the DMARC policies from the weakest.
+var dmarcPolicies = []string{"none", "quarantine", "reject"}
+
+// spfMaxLookups is the maximum number of the mechanisms and the modifiers which cause DNS lookups (RFC 7208 4.6.4).
+const spfMaxLookups = 10
+
+// checkPolicy checks the DNS records of the sender policies of the domain, which are SPF, DMARC and DKIM.
+// The records which are missing or invalid are CRITICAL, and the DMARC policy weaker than minDMARC is WARNING.
+func checkPolicy(domain, minDMARC string, selectors []string) *checkers.Checker {
+	checkSt := checkers.OK
+	raise := func(s checkers.Status) {
+		if s > checkSt {
+			checkSt = s
+		}
+	}
+	var msgs []string
+
+	if spf, err := lookupRecord(domain, "v=spf1"); err != nil {
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, fmt.Sprintf("SPF %s", err))
+	} else if err := validateSPF(spf); err != nil {
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, fmt.Sprintf("SPF is invalid: %s", err))
+	} else if strings.HasSuffix(spf, " all") || strings.HasSuffix(spf, " +all") {
+		raise(checkers.WARNING)
+		msgs = append(msgs, "SPF allows all hosts")
+	} else {
+		msgs = append(msgs, "SPF is valid")
+	}
+
+	if dmarc, err := lookupRecord("_dmarc."+domain, "v=DMARC1"); err != nil {
+		raise(checkers.CRITICAL)
+		msgs = append(msgs, fmt.Sprintf("DMARC %s", err))
+	} else {
+		p, err := parseDMARCPolicy(dmarc)
+		switch {
+		case err != nil:
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("DMARC is invalid: %s", err))
+		case policyRank(p) < policyRank(minDMARC):
+			raise(checkers.WARNING)
+			msgs = append(msgs, fmt.Sprintf("DMARC policy is %s, weaker than %s", p, minDMARC))
+		default:
+			msgs = append(msgs, fmt.Sprintf("DMARC policy is %s", p))
+		}
+	}
+
+	for _, sel := range selectors {
+		name := sel + "._domainkey." + domain
+		dkim, err := lookupRecord(name, "")
+		if err == nil {
+			err = validateDKIM(dkim)
+		}
+		if err != nil {
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("DKIM selector %s %s", sel, err))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("DKIM selector %s is valid", sel))
+		}
+	}
+	return checkers.NewChecker(checkSt, fmt.Sprintf("%s: %s", domain, strings.Join(msgs, ", ")))
+}
+
+// lookupRecord returns the only TXT record of name whose version tag is prefix case-insensitively,
+// or the only TXT record if prefix is empty.
+func lookupRecord(name, prefix string) (string, error) {
+	end := debuglog.Trace("dns: TXT %s", name)
+	txts, err := lookupTXT(name)
+	end(err)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		txts, err = nil, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't be looked up: %s", err)
+	}
+	var records []string
+	for _, txt := range txts {
+		txt = strings.TrimSpace(txt)
+		version := txt
+		if i := strings.IndexAny(txt, " ;"); i >= 0 {
+			version = txt[:i]
+		}
+		if prefix == "" || strings.EqualFold(version, prefix) {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", fmt.Errorf("record is not found at %s", name)
+	case 1:
+		return records[0], nil
+	}
+	return "", fmt.Errorf("records are found %d times at %s", len(records), name)
+}
+
+// validateSPF validates the syntax of the terms of the SPF record (RFC 7208), and the number of the DNS lookups
+// caused by the record itself. The records included by it are not followed.
+func validateSPF(record string) error {
+	terms := strings.Fields(record)[1:]
+	var lookups int
+	for _, term := range terms {
+		if i := strings.Index(term, "="); i > 0 && !strings.ContainsAny(term[:i], ":/") {
+			switch strings.ToLower(term[:i]) {
+			case "redirect":
+				lookups++
+			case "exp":
+			default:
+				// unknown modifiers are ignored
+			}
+			if term[i+1:] == "" {
+				return fmt.Errorf("modifier %q has no value", term)
+			}
+			continue
+		}
+		mech := strings.TrimLeft(term, "+-~?")
+		if len(term)-len(mech) > 1 {
+			return fmt.Errorf("mechanism %q has multiple qualifiers", term)
+		}
+		name, value := mech, ""
+		if i := strings.IndexAny(mech, ":/"); i >= 0 {
+			name, value = mech[:i], mech[i:]
+		}
+		name = strings.ToLower(name)
+		switch name {
+		case "all":
+			if value != "" {
+				return fmt.Errorf("mechanism %q has a value", term)
+			}
+		case "include", "exists":
+			if len(value) < 2 || value[0] != ':' {
+				return fmt.Errorf("mechanism %q has no domain", term)
+			}
+			lookups++
+		case "a", "mx", "ptr":
+			lookups++
+		case "ip4", "ip6":
+			if len(value) < 2 || value[0] != ':' {
+				return fmt.Errorf("mechanism %q has no address", term)
+			}
+			addr := value[1:]
+			ip := net.ParseIP(addr)
+			if strings.Contains(addr, "/") {
+				var err error
+				ip, _, err = net.ParseCIDR(addr)
+				if err != nil {
+					return fmt.Errorf("mechanism %q has an invalid network", term)
+				}
+			}
+			if ip == nil || (name == "ip4") != (ip.To4() != nil) {
+				return fmt.Errorf("mechanism %q has an invalid address", term)
+			}
+		default:
+			return fmt.Errorf("unknown mechanism %q", term)
+		}
+	}
+	if lookups > spfMaxLookups {
+		return fmt.Errorf("%d DNS lookups are over the limit of %d", lookups, spfMaxLookups)
+	}
+	return nil
+}
+
+// parseDMARCPolicy returns the value of the p tag of the DMARC record (RFC 7489).
+func parseDMARCPolicy(record string) (string, error) {
+	for _, tag := range strings.Split(record, ";") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "p" {
+			continue
+		}
+		p := strings.ToLower(strings.TrimSpace(kv[1]))
+		if policyRank(p) < 0 {
+			return "", fmt.Errorf("unknown policy %q", p)
+		}
+		return p, nil
+	}
+	return "", errors.New("no policy (p=)")
+}
+
+func policyRank(p string) int {
+	for i, v := range dmarcPolicies {
+		if p == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateDKIM validates that the DKIM key record (RFC 6376) has a public key, which is empty if it is revoked.
+func validateDKIM(record string) error {
+	for _, tag := range strings.Split(record, ";") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) != "p" {
+			continue
+		}
+		if strings.TrimSpace(kv[1]) == "" {
+			return errors.New("is revoked")
+		}
+		return nil
+	}
+	return errors.New("has no public key (p=)")
+}
@@ -0,0 +1,136 @@
+package checksmtp
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+func stubTXT(t *testing.T, records map[string][]string) {
+	t.Helper()
+	orig := lookupTXT
+	lookupTXT = func(name string) ([]string, error) {
+		txts, ok := records[name]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return txts, nil
+	}
+	t.Cleanup(func() { lookupTXT = orig })
+}
+
+func TestCheckPolicy(t *testing.T) {
+	valid := map[string][]string{
+		"example.com":                    {"google-site-verification=xxx", "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 include:_spf.example.net mx -all"},
+		"_dmarc.example.com":             {"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"},
+		"s1._domainkey.example.com":      {"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"},
+		"revoked._domainkey.example.com": {"v=DKIM1; p="},
+	}
+	cases := []struct {
+		name      string
+		records   map[string][]string
+		minDMARC  string
+		selectors []string
+		status    checkers.Status
+		message   string
+	}{
+		{
+			name:      "valid",
+			records:   valid,
+			minDMARC:  "quarantine",
+			selectors: []string{"s1"},
+			status:    checkers.OK,
+			message:   "example.com: SPF is valid, DMARC policy is reject, DKIM selector s1 is valid",
+		},
+		{
+			name:      "revoked and missing DKIM",
+			records:   valid,
+			minDMARC:  "quarantine",
+			selectors: []string{"revoked", "s2"},
+			status:    checkers.CRITICAL,
+			message:   "DKIM selector revoked is revoked, DKIM selector s2 record is not found at s2._domainkey.example.com",
+		},
+		{
+			name: "weak DMARC and all",
+			records: map[string][]string{
+				"example.com":        {"v=spf1 +all"},
+				"_dmarc.example.com": {"v=DMARC1; p=none"},
+			},
+			minDMARC: "quarantine",
+			status:   checkers.WARNING,
+			message:  "example.com: SPF allows all hosts, DMARC policy is none, weaker than quarantine",
+		},
+		{
+			name: "DMARC none allowed",
+			records: map[string][]string{
+				"example.com":        {"v=spf1 -all"},
+				"_dmarc.example.com": {"v=DMARC1; p=none"},
+			},
+			minDMARC: "none",
+			status:   checkers.OK,
+			message:  "example.com: SPF is valid, DMARC policy is none",
+		},
+		{
+			name:     "missing",
+			records:  map[string][]string{},
+			minDMARC: "quarantine",
+			status:   checkers.CRITICAL,
+			message:  "example.com: SPF record is not found at example.com, DMARC record is not found at _dmarc.example.com",
+		},
+		{
+			name: "multiple SPF and no DMARC policy",
+			records: map[string][]string{
+				"example.com":        {"v=spf1 mx -all", "v=spf1 a -all"},
+				"_dmarc.example.com": {"v=DMARC1; rua=mailto:dmarc@example.com"},
+			},
+			minDMARC: "quarantine",
+			status:   checkers.CRITICAL,
+			message:  "example.com: SPF records are found 2 times at example.com, DMARC is invalid: no policy (p=)",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubTXT(t, tc.records)
+			ckr := checkPolicy("example.com", tc.minDMARC, tc.selectors)
+			if ckr.Status != tc.status {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tc.status, ckr.Message)
+			}
+			if !strings.Contains(ckr.Message, tc.message) {
+				t.Errorf("message = %q, want to contain %q", ckr.Message, tc.message)
+			}
+		})
+	}
+}
+
+func TestValidateSPF(t *testing.T) {
+	cases := []struct {
+		record string
+		err    string
+	}{
+		{"v=spf1 -all", ""},
+		{"v=spf1 a mx a:mail.example.com/24 ptr ~all", ""},
+		{"v=spf1 ip4:192.0.2.1 ip6:2001:db8::1 exists:%{i}.example.com ?all", ""},
+		{"v=spf1 redirect=_spf.example.com", ""},
+		{"v=spf1 foo=bar -all", ""},
+		{"v=spf1 ip4:2001:db8::1 -all", `mechanism "ip4:2001:db8::1" has an invalid address`},
+		{"v=spf1 ip4:192.0.2.0/33 -all", `mechanism "ip4:192.0.2.0/33" has an invalid network`},
+		{"v=spf1 include -all", `mechanism "include" has no domain`},
+		{"v=spf1 +-all", `mechanism "+-all" has multiple qualifiers`},
+		{"v=spf1 mx:example.com all:x", `mechanism "all:x" has a value`},
+		{"v=spf1 inclde:example.com -all", `unknown mechanism "inclde:example.com"`},
+		{"v=spf1 redirect=", `modifier "redirect=" has no value`},
+		{"v=spf1 " + strings.Repeat("include:example.com ", 11) + "-all", "11 DNS lookups are over the limit of 10"},
+	}
+	for _, tc := range cases {
+		err := validateSPF(tc.record)
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.err {
+			t.Errorf("validateSPF(%q) = %q, want %q", tc.record, got, tc.err)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package checksnmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type snmpOpts struct {
+	Host         string   `short:"H" long:"host" required:"true" description:"Hostname of the SNMP agent"`
+	Port         int      `short:"p" long:"port" default:"161" description:"Port of the SNMP agent"`
+	Version      string   `short:"v" long:"snmp-version" choice:"2c" choice:"3" default:"2c" description:"SNMP version"`
+	Community    string   `short:"C" long:"community" default:"public" description:"Community string (v2c)" env:"SNMP_COMMUNITY"`
+	User         string   `short:"u" long:"user" description:"Security name (v3)"`
+	SecLevel     string   `short:"l" long:"sec-level" choice:"noAuthNoPriv" choice:"authNoPriv" choice:"authPriv" default:"authPriv" description:"Security level (v3)"`
+	AuthProtocol string   `short:"a" long:"auth-protocol" default:"SHA" description:"Authentication protocol such as MD5, SHA or SHA-256 (v3)"`
+	AuthPassword string   `short:"A" long:"auth-password" description:"Authentication passphrase (v3)" env:"SNMP_AUTH_PASSWORD"`
+	PrivProtocol string   `short:"x" long:"priv-protocol" default:"AES" description:"Privacy protocol such as DES or AES (v3)"`
+	PrivPassword string   `short:"X" long:"priv-password" description:"Privacy passphrase (v3)" env:"SNMP_PRIV_PASSWORD"`
+	Timeout      int      `short:"t" long:"timeout" default:"5" description:"Seconds before a request times out"`
+	Retries      int      `long:"retries" default:"1" description:"Number of retries"`
+	OIDs         []string `short:"o" long:"oid" required:"true" description:"OID to fetch (may be repeated)"`
+	Labels       []string `long:"label" description:"Label of the OID in the message (may be repeated in the order of --oid)"`
+	Warning      []string `short:"w" long:"warning" description:"warning if the value is over (may be repeated in the order of --oid)"`
+	Critical     []string `short:"c" long:"critical" description:"critical if the value is over (may be repeated in the order of --oid)"`
+	LessThan     bool     `long:"less-than" description:"Compare with thresholds as lower limits instead of upper limits"`
+	Strings      []string `short:"s" long:"string" description:"critical if the value is not equal to the string (may be repeated in the order of --oid)"`
+	Delta        bool     `long:"delta" description:"Check the rate per second of counters instead of the values"`
+	StateDir     string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under (with --delta)"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// oidCheck is the setting for each OID.
+// The thresholds and the expected string are nil when they are not specified.
+type oidCheck struct {
+	oid      string
+	label    string
+	warning  *float64
+	critical *float64
+	expected *string
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "SNMP"
+	return ckr
+}
+
+// perOID returns the i-th value of the option which is given once for all OIDs, or once for each OID.
+// An empty value means that the option is not specified for the OID.
+func perOID(name string, values []string, i, n int) (*string, error) {
+	var v *string
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		v = &values[0]
+	case n:
+		v = &values[i]
+	default:
+		return nil, fmt.Errorf("--%s must be specified once or as many times as --oid", name)
+	}
+	if *v == "" {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func parseThreshold(name string, values []string, i, n int) (*float64, error) {
+	s, err := perOID(name, values, i, n)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	v, err := strconv.ParseFloat(*s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %s", name, *s)
+	}
+	return &v, nil
+}
+
+func (opts *snmpOpts) oidChecks() ([]oidCheck, error) {
+	n := len(opts.OIDs)
+	if len(opts.Labels) > 0 && len(opts.Labels) != n {
+		return nil, fmt.Errorf("--label must be specified as many times as --oid")
+	}
+	checks := make([]oidCheck, n)
+	for i, oid := range opts.OIDs {
+		c := oidCheck{oid: oid, label: oid}
+		if len(opts.Labels) > 0 {
+			c.label = opts.Labels[i]
+		}
+		var err error
+		if c.warning, err = parseThreshold("warning", opts.Warning, i, n); err != nil {
+			return nil, err
+		}
+		if c.critical, err = parseThreshold("critical", opts.Critical, i, n); err != nil {
+			return nil, err
+		}
+		if c.expected, err = perOID("string", opts.Strings, i, n); err != nil {
+			return nil, err
+		}
+		checks[i] = c
+	}
+	return checks, nil
+}
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// protocolName normalizes the name of the protocol, so that SHA-256 and sha256 are the same.
+func protocolName(s string) string {
+	return strings.ToUpper(strings.Replace(s, "-", "", -1))
+}
+
+func (opts *snmpOpts) authProtocol() (gosnmp.SnmpV3AuthProtocol, error) {
+	p, ok := authProtocols[protocolName(opts.AuthProtocol)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported --auth-protocol: %s", opts.AuthProtocol)
+	}
+	return p, nil
+}
+
+func (opts *snmpOpts) privProtocol() (gosnmp.SnmpV3PrivProtocol, error) {
+	p, ok := privProtocols[protocolName(opts.PrivProtocol)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported --priv-protocol: %s", opts.PrivProtocol)
+	}
+	return p, nil
+}
+
+func (opts *snmpOpts) address() string {
+	return net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+}
+
+// client returns the SNMP client with the settings of the options.
+func (opts *snmpOpts) client() (*gosnmp.GoSNMP, error) {
+	client := &gosnmp.GoSNMP{
+		Target:    opts.Host,
+		Port:      uint16(opts.Port),
+		Community: opts.Community,
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+		Retries:   opts.Retries,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	if opts.Version != "3" {
+		return client, nil
+	}
+	params := &gosnmp.UsmSecurityParameters{
+		UserName:               opts.User,
+		AuthenticationProtocol: gosnmp.NoAuth,
+		PrivacyProtocol:        gosnmp.NoPriv,
+	}
+	client.Version = gosnmp.Version3
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.SecurityParameters = params
+	client.MsgFlags = gosnmp.NoAuthNoPriv
+	if opts.SecLevel == "noAuthNoPriv" {
+		return client, nil
+	}
+	var err error
+	if params.AuthenticationProtocol, err = opts.authProtocol(); err != nil {
+		return nil, err
+	}
+	params.AuthenticationPassphrase = opts.AuthPassword
+	client.MsgFlags = gosnmp.AuthNoPriv
+	if opts.SecLevel == "authNoPriv" {
+		return client, nil
+	}
+	if params.PrivacyProtocol, err = opts.privProtocol(); err != nil {
+		return nil, err
+	}
+	params.PrivacyPassphrase = opts.PrivPassword
+	client.MsgFlags = gosnmp.AuthPriv
+	return client, nil
+}
+
+// selfTest validates that the host can be resolved,
+// and the protocols and the passphrases required by the security level are given.
+func (opts *snmpOpts) selfTest() *checkers.Checker {
+	checks := []selftest.Check{selftest.Resolve(opts.Host)}
+	if opts.Version == "3" {
+		if opts.SecLevel != "noAuthNoPriv" {
+			checks = append(checks, func() error {
+				_, err := opts.authProtocol()
+				return err
+			}, selftest.Required("--auth-password", opts.AuthPassword))
+		}
+		if opts.SecLevel == "authPriv" {
+			checks = append(checks, func() error {
+				_, err := opts.privProtocol()
+				return err
+			}, selftest.Required("--priv-password", opts.PrivPassword))
+		}
+	}
+	return selftest.Run(checks...)
+}
+
+// get fetches the values of the OIDs in the order of opts.OIDs.
+func (opts *snmpOpts) get() ([]snmpValue, error) {
+	client, err := opts.client()
+	if err != nil {
+		return nil, err
+	}
+	end := debuglog.Trace("snmp get: %s %s", opts.address(), strings.Join(opts.OIDs, " "))
+	if err := client.Connect(); err != nil {
+		end(err)
+		return nil, fmt.Errorf("%s: %s", opts.address(), err)
+	}
+	defer client.Conn.Close()
+	packet, err := client.Get(opts.OIDs)
+	end(err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", opts.address(), err)
+	}
+	if packet.Error != gosnmp.NoError {
+		return nil, fmt.Errorf("%s: %s", opts.address(), packet.Error)
+	}
+	if len(packet.Variables) != len(opts.OIDs) {
+		return nil, fmt.Errorf("got %d values for %d OIDs", len(packet.Variables), len(opts.OIDs))
+	}
+	values := make([]snmpValue, len(packet.Variables))
+	for i, pdu := range packet.Variables {
+		values[i] = pduValue(pdu)
+	}
+	return values, nil
+}
+
+// snmpValue is a value of a varbind. err is set when the agent has no value for the OID.
+type snmpValue struct {
+	value string
+	err   error
+}
+
+var noValueErrors = map[gosnmp.Asn1BER]error{
+	gosnmp.NoSuchObject:   errors.New("No Such Object available on this agent at this OID"),
+	gosnmp.NoSuchInstance: errors.New("No Such Instance currently exists at this OID"),
+	gosnmp.EndOfMibView:   errors.New("No more variables left in this MIB View"),
+}
+
+// pduValue returns the value of the varbind as a string.
+// The numbers are formatted in decimal, and the strings are as they are.
+func pduValue(pdu gosnmp.SnmpPDU) snmpValue {
+	if err, ok := noValueErrors[pdu.Type]; ok {
+		return snmpValue{err: err}
+	}
+	switch pdu.Type {
+	case gosnmp.OctetString:
+		b, _ := pdu.Value.([]byte)
+		return snmpValue{value: string(b)}
+	case gosnmp.ObjectIdentifier, gosnmp.IPAddress:
+		s, _ := pdu.Value.(string)
+		return snmpValue{value: s}
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble:
+		return snmpValue{value: fmt.Sprint(pdu.Value)}
+	case gosnmp.Null:
+		return snmpValue{}
+	}
+	return snmpValue{value: gosnmp.ToBigInt(pdu.Value).String()}
+}
+
+func (c *oidCheck) exceeds(v, threshold float64, lessThan bool) bool {
+	if lessThan {
+		return v < threshold
+	}
+	return v > threshold
+}
+
+// check compares the value with the setting of the OID.
+// It returns the status, the message and the perfdata of the OID.
+func (c *oidCheck) check(value string, lessThan bool) (checkers.Status, string, string) {
+	if c.expected != nil {
+		if value != *c.expected {
+			return checkers.CRITICAL, fmt.Sprintf("%s=%q (expected %q)", c.label, value, *c.expected), ""
+		}
+		return checkers.OK, fmt.Sprintf("%s=%q", c.label, value), ""
+	}
+	if c.warning == nil && c.critical == nil {
+		return checkers.OK, fmt.Sprintf("%s=%s", c.label, value), c.perfdata(value)
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return checkers.UNKNOWN, fmt.Sprintf("%s=%q is not a number", c.label, value), ""
+	}
+	op := ">"
+	if lessThan {
+		op = "<"
+	}
+	if c.critical != nil && c.exceeds(v, *c.critical, lessThan) {
+		return checkers.CRITICAL, fmt.Sprintf("%s=%s %s %g", c.label, value, op, *c.critical), c.perfdata(value)
+	}
+	if c.warning != nil && c.exceeds(v, *c.warning, lessThan) {
+		return checkers.WARNING, fmt.Sprintf("%s=%s %s %g", c.label, value, op, *c.warning), c.perfdata(value)
+	}
+	return checkers.OK, fmt.Sprintf("%s=%s", c.label, value), c.perfdata(value)
+}
+
+// perfdata returns the performance data of the numeric value in the format of Nagios plugins.
+func (c *oidCheck) perfdata(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return ""
+	}
+	return perfdata.Format(c.label, value, "", perfdata.OptFloat(c.warning), perfdata.OptFloat(c.critical))
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &snmpOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	opts.DebugOpts.Enable()
+	if opts.Version == "3" && opts.User == "" {
+		return checkers.Unknown("--user is required for SNMP v3")
+	}
+	checks, err := opts.oidChecks()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return opts.selfTest()
+	}
+	if err := secret.ResolveAll(&opts.Community, &opts.AuthPassword, &opts.PrivPassword); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	values, err := opts.get()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	var rates []*float64
+	if opts.Delta {
+		rates, err = opts.computeRates(args, checks, values, time.Now())
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	return evaluate(checks, values, rates, opts.LessThan)
+}
+
+// evaluate checks all values and returns the worst status.
+// rates is nil unless --delta is specified, and a rate is nil when it can't be computed yet.
+func evaluate(checks []oidCheck, values []snmpValue, rates []*float64, lessThan bool) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs, perfs []string
+	for i := range checks {
+		c := &checks[i]
+		if values[i].err != nil {
+			checkSt = checkers.UNKNOWN
+			msgs = append(msgs, fmt.Sprintf("%s: %s", c.label, values[i].err))
+			continue
+		}
+		value := values[i].value
+		if rates != nil {
+			if rates[i] == nil {
+				msgs = append(msgs, fmt.Sprintf("%s: no previous value to compute the rate", c.label))
+				continue
+			}
+			value = strconv.FormatFloat(*rates[i], 'f', 2, 64)
+		}
+		st, msg, perf := c.check(value, lessThan)
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+		if perf != "" {
+			perfs = append(perfs, perf)
+		}
+	}
+
+	msg := strings.Join(msgs, ", ")
+	if len(perfs) > 0 {
+		msg += " | " + strings.Join(perfs, " ")
+	}
+	return checkers.NewChecker(checkSt, msg)
+}
@@ -0,0 +1,139 @@
+package checksnmp
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPduValue(t *testing.T) {
+	tests := []struct {
+		pdu  gosnmp.SnmpPDU
+		want string
+	}{
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("router01")}, want: "router01"},
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 1}, want: "1"},
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(123456789012)}, want: "123456789012"},
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.TimeTicks, Value: uint32(4294967295)}, want: "4294967295"},
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.8072.3.2.10"}, want: ".1.3.6.1.4.1.8072.3.2.10"},
+		{pdu: gosnmp.SnmpPDU{Type: gosnmp.IPAddress, Value: "192.0.2.1"}, want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		v := pduValue(tt.pdu)
+		assert.Nil(t, v.err)
+		assert.Equal(t, tt.want, v.value)
+	}
+
+	v := pduValue(gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject})
+	assert.EqualError(t, v.err, "No Such Object available on this agent at this OID")
+}
+
+func TestClient(t *testing.T) {
+	opts := &snmpOpts{Host: "192.0.2.1", Port: 161, Version: "3", User: "monitor", SecLevel: "authPriv", AuthProtocol: "sha-256", AuthPassword: "authpass", PrivProtocol: "AES", PrivPassword: "privpass", Timeout: 5, Retries: 1}
+	client, err := opts.client()
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.Version3, client.Version)
+	assert.Equal(t, gosnmp.AuthPriv, client.MsgFlags)
+	params := client.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	assert.Equal(t, "monitor", params.UserName)
+	assert.Equal(t, gosnmp.SHA256, params.AuthenticationProtocol)
+	assert.Equal(t, gosnmp.AES, params.PrivacyProtocol)
+	assert.Equal(t, "privpass", params.PrivacyPassphrase)
+
+	opts.SecLevel = "authNoPriv"
+	opts.PrivProtocol = "3DES"
+	client, err = opts.client()
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.AuthNoPriv, client.MsgFlags)
+
+	opts.SecLevel = "authPriv"
+	_, err = opts.client()
+	assert.EqualError(t, err, "unsupported --priv-protocol: 3DES")
+
+	opts = &snmpOpts{Host: "2001:db8::1", Port: 1161, Version: "2c", Community: "public", Timeout: 5, Retries: 1}
+	client, err = opts.client()
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.Version2c, client.Version)
+	assert.Equal(t, "public", client.Community)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+	assert.Equal(t, "[2001:db8::1]:1161", opts.address())
+}
+
+func TestOIDChecks(t *testing.T) {
+	opts := &snmpOpts{
+		OIDs:     []string{".1.3.6.1.4.1.2021.10.1.5.1", ".1.3.6.1.4.1.2021.10.1.5.2"},
+		Labels:   []string{"load1", "load5"},
+		Warning:  []string{"300"},
+		Critical: []string{"500", "400"},
+	}
+	checks, err := opts.oidChecks()
+	assert.Nil(t, err)
+	assert.Equal(t, "load5", checks[1].label)
+	assert.Equal(t, 300.0, *checks[1].warning)
+	assert.Equal(t, 400.0, *checks[1].critical)
+	assert.Nil(t, checks[1].expected)
+
+	opts.Critical = []string{"500", "400", "300"}
+	_, err = opts.oidChecks()
+	assert.NotNil(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	opts := &snmpOpts{
+		OIDs:     []string{".1.3.6.1.2.1.2.2.1.8.1", ".1.3.6.1.4.1.2021.10.1.5.1"},
+		Labels:   []string{"ifOperStatus.1", "load1"},
+		Warning:  []string{"", "300"},
+		Critical: []string{"", "500"},
+		Strings:  []string{"1", ""},
+	}
+	checks, err := opts.oidChecks()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		values []snmpValue
+		want   checkers.Status
+	}{
+		{values: []snmpValue{{value: "1"}, {value: "120"}}, want: checkers.OK},
+		{values: []snmpValue{{value: "1"}, {value: "350"}}, want: checkers.WARNING},
+		{values: []snmpValue{{value: "2"}, {value: "120"}}, want: checkers.CRITICAL},
+		{values: []snmpValue{{value: "1"}, {value: "abc"}}, want: checkers.UNKNOWN},
+	}
+	for _, tt := range tests {
+		ckr := evaluate(checks, tt.values, nil, false)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+
+	ckr := evaluate(checks, []snmpValue{{value: "1"}, {value: "350"}}, nil, false)
+	assert.Equal(t, `ifOperStatus.1="1", load1=350 > 300 | load1=350;300;500`, ckr.Message)
+}
+
+func TestComputeRates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check-snmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &snmpOpts{Host: "router01", StateDir: dir}
+	args := []string{"-H", "router01", "-o", ".1.3.6.1.2.1.31.1.1.1.6.1", "--delta"}
+	checks := []oidCheck{{oid: ".1.3.6.1.2.1.31.1.1.1.6.1", label: "ifHCInOctets.1"}}
+	now := time.Unix(1600000000, 0)
+
+	rates, err := opts.computeRates(args, checks, []snmpValue{{value: "1000"}}, now)
+	assert.Nil(t, err)
+	assert.Nil(t, rates[0])
+
+	rates, err = opts.computeRates(args, checks, []snmpValue{{value: "7000"}}, now.Add(60*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, *rates[0])
+
+	// counter reset
+	rates, err = opts.computeRates(args, checks, []snmpValue{{value: "10"}}, now.Add(120*time.Second))
+	assert.Nil(t, err)
+	assert.Nil(t, rates[0])
+}
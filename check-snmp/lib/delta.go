@@ -0,0 +1,58 @@
+package checksnmp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+// counterState is the value of a counter at the last run.
+type counterState struct {
+	Value     uint64 `json:"value"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+var stateRe = regexp.MustCompile(`[^-a-zA-Z0-9_.]`)
+
+func getStateFile(stateDir, host string, args []string) string {
+	return state.File(stateDir, stateRe.ReplaceAllString(host, "_"), strings.Join(args, " "))
+}
+
+// computeRates returns the rates per second of the counters since the last run.
+// The rate is nil at the first run, or when the counter seems to be reset.
+func (opts *snmpOpts) computeRates(args []string, checks []oidCheck, values []snmpValue, now time.Time) ([]*float64, error) {
+	file := getStateFile(state.Dir(opts.StateDir, "check-snmp"), opts.Host, args)
+	prev := map[string]counterState{}
+	if _, err := state.Load(file, &prev); err != nil {
+		return nil, err
+	}
+
+	rates := make([]*float64, len(checks))
+	next := make(map[string]counterState, len(checks))
+	for i, c := range checks {
+		if values[i].err != nil {
+			continue
+		}
+		v, err := strconv.ParseUint(values[i].value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%q is not a counter", c.label, values[i].value)
+		}
+		cur := counterState{Value: v, Timestamp: now.Unix()}
+		next[c.oid] = cur
+
+		p, ok := prev[c.oid]
+		if !ok || cur.Timestamp <= p.Timestamp || cur.Value < p.Value {
+			continue
+		}
+		rate := float64(cur.Value-p.Value) / float64(cur.Timestamp-p.Timestamp)
+		rates[i] = &rate
+	}
+	if err := state.Save(file, next); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
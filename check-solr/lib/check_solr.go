@@ -7,12 +7,16 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type solrOpts struct {
 	Host string `short:"H" long:"host" default:"localhost" description:"Hostname"`
 	Port string `short:"p" long:"port" default:"8983" description:"Port"`
 	Core string `short:"c" long:"core" required:"true" description:"Core"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 func (s solrOpts) createBaseURL() string {
@@ -32,7 +36,12 @@ func separateSub(argv []string) (string, []string) {
 
 // Do the plugin
 func Do() {
-	subCmd, argv := separateSub(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	subCmd, argv := separateSub(args)
 	fn, ok := commands[subCmd]
 	if !ok {
 		fmt.Println(`Usage:
@@ -42,7 +51,9 @@ SubCommands:`)
 		for k := range commands {
 			fmt.Printf("  %s\n", k)
 		}
-		os.Exit(1)
+		ckr := checkers.Unknown(fmt.Sprintf("unknown subcommand: %q", subCmd))
+		ckr.Name = "Solr"
+		return ckr
 	}
 
 	opts := solrOpts{}
@@ -50,10 +61,15 @@ SubCommands:`)
 	psr.Usage = fmt.Sprintf("%s [OPTIONS]", subCmd)
 	_, err := psr.ParseArgs(argv)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
-	ckr := fn(opts)
+	var ckr *checkers.Checker
+	if opts.SelfTest {
+		ckr = selftest.Run(selftest.Resolve(opts.Host))
+	} else {
+		ckr = fn(opts)
+	}
 	ckr.Name = fmt.Sprintf("Solr %s", strings.Title(subCmd))
-	ckr.Exit()
+	return ckr
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
 )
 
 func checkPing(opts solrOpts) *checkers.Checker {
@@ -17,7 +18,9 @@ func checkPing(opts solrOpts) *checkers.Checker {
 	}
 	req.Header.Set("User-Agent", "check-solr")
 
-	resp, err := http.DefaultClient.Do(req)
+	opts.DebugOpts.Enable()
+	client := &http.Client{Transport: debuglog.Transport(nil)}
+	resp, err := client.Do(req)
 	if err != nil {
 		return checkers.Unknown("couldn't get access to " + uri)
 	}
@@ -1,6 +1,7 @@
 package checkssh
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -8,11 +9,16 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/secret"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -26,13 +32,24 @@ type sshOpts struct {
 	Password     string  `short:"p" long:"password" description:"Login password" env:"LOGIN_PASSWORD"`
 	IdentityFile string  `short:"i" long:"identity" description:"Identity file (ssh private key)"`
 	PassPhrase   string  `long:"passphrase" description:"Identity passphrase" env:"CHECK_SSH_IDENTITY_PASSPHRASE"`
+	Banner       string  `long:"banner" value-name:"REGEXP" description:"Regexp which the protocol banner of the server (e.g. SSH-2.0-OpenSSH_8.9) must match"`
+	Fingerprint  string  `long:"fingerprint" description:"Expected host key fingerprint (SHA256:... or MD5 hex as shown by ssh-keygen -l)"`
+	NoAuth       bool    `long:"no-auth" description:"Check only the connection, the banner and the host key without authentication"`
+	secret.PasswordFileOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	opts, err := parseArgs(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 	if opts.Critical > opts.Timeout {
 		// force timeout
@@ -40,7 +57,7 @@ func Do() {
 	}
 	ckr := opts.run()
 	ckr.Name = "SSH"
-	ckr.Exit()
+	return ckr
 }
 
 func parseArgs(args []string) (*sshOpts, error) {
@@ -87,11 +104,22 @@ func readPrivateKey(file, passphrase string) ([]byte, error) {
 
 func (opts *sshOpts) makeClientConfig() (*ssh.ClientConfig, error) {
 	authenticities := make([]ssh.AuthMethod, 0, 1)
-	if opts.Password != "" {
-		authenticities = append(authenticities, ssh.Password(opts.Password))
+	if opts.NoAuth {
+		return &ssh.ClientConfig{User: opts.User, Auth: authenticities, HostKeyCallback: opts.verifyHostKey}, nil
+	}
+	password, err := opts.ResolvePassword(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	passPhrase, err := secret.Resolve(opts.PassPhrase)
+	if err != nil {
+		return nil, err
+	}
+	if password != "" {
+		authenticities = append(authenticities, ssh.Password(password))
 	}
 	if opts.IdentityFile != "" {
-		data, err := readPrivateKey(opts.IdentityFile, opts.PassPhrase)
+		data, err := readPrivateKey(opts.IdentityFile, passPhrase)
 		if err != nil {
 			return nil, err
 		}
@@ -104,25 +132,113 @@ func (opts *sshOpts) makeClientConfig() (*ssh.ClientConfig, error) {
 		authenticities = append(authenticities, ssh.PublicKeys(signer))
 	}
 
-	config := &ssh.ClientConfig{User: opts.User, Auth: authenticities, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	config := &ssh.ClientConfig{User: opts.User, Auth: authenticities, HostKeyCallback: opts.verifyHostKey}
 	return config, nil
 }
 
-func (opts *sshOpts) dial(config *ssh.ClientConfig) (*ssh.Client, error) {
+func (opts *sshOpts) verifyHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if opts.Fingerprint == "" {
+		return ssh.InsecureIgnoreHostKey()(hostname, remote, key)
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	if opts.Fingerprint == fingerprint {
+		return nil
+	}
+	if strings.EqualFold(strings.TrimPrefix(opts.Fingerprint, "MD5:"), ssh.FingerprintLegacyMD5(key)) {
+		return nil
+	}
+	return fmt.Errorf("host key fingerprint mismatch: expected %s, got %s", opts.Fingerprint, fingerprint)
+}
+
+// bannerConn records the protocol banner sent by the server.
+// The server may send other lines before the banner, so they are skipped.
+type bannerConn struct {
+	net.Conn
+	buf    []byte
+	banner string
+}
+
+func (c *bannerConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.banner != "" {
+		return n, err
+	}
+	c.buf = append(c.buf, b[:n]...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(c.buf[:i]), "\r")
+		c.buf = c.buf[i+1:]
+		if strings.HasPrefix(line, "SSH-") {
+			c.banner = line
+			c.buf = nil
+			break
+		}
+	}
+	return n, err
+}
+
+// dial connects to the server and returns the client and the protocol banner.
+// With --no-auth, the client is nil unless the server accepts the "none" authentication.
+func (opts *sshOpts) dial(config *ssh.ClientConfig) (*ssh.Client, string, error) {
 	addr := opts.Hostname + ":" + strconv.Itoa(opts.Port)
 	timeout := opts.Timeout * float64(time.Second)
+	end := debuglog.Trace("ssh: dial %s", addr)
 	conn, err := net.DialTimeout("tcp", addr, time.Duration(timeout))
+	end(err)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	bc := &bannerConn{Conn: conn}
+
+	// The host key is verified at the end of the key exchange, before the authentication.
+	hostKeyAccepted := false
+	callback := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		debuglog.Printf("ssh: banner %q, host key %s %s", bc.banner, key.Type(), ssh.FingerprintSHA256(key))
+		if err := callback(hostname, remote, key); err != nil {
+			return err
+		}
+		hostKeyAccepted = true
+		return nil
 	}
-	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+
+	end = debuglog.Trace("ssh: handshake as %s", config.User)
+	c, chans, reqs, err := ssh.NewClientConn(bc, addr, config)
+	end(err)
 	if err != nil {
-		return nil, err
+		conn.Close()
+		if opts.NoAuth && hostKeyAccepted {
+			if isAuthError(err) {
+				return nil, bc.banner, nil
+			}
+			return nil, bc.banner, &noAuthError{err}
+		}
+		return nil, bc.banner, err
 	}
-	return ssh.NewClient(c, chans, reqs), nil
+	return ssh.NewClient(c, chans, reqs), bc.banner, nil
+}
+
+// noAuthError is the error after the host key was accepted with --no-auth,
+// other than the rejection of the "none" authentication.
+type noAuthError struct {
+	err error
+}
+
+func (e *noAuthError) Error() string {
+	return e.err.Error()
+}
+
+// isAuthError reports whether err is the failure of the authentication,
+// which x/crypto/ssh doesn't return as a typed error.
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "ssh: unable to authenticate")
 }
 
 func (opts *sshOpts) run() *checkers.Checker {
+	opts.DebugOpts.Enable()
 	// prevent changing output of some commands
 	os.Setenv("LANG", "C")
 	os.Setenv("LC_ALL", "C")
@@ -131,9 +247,30 @@ func (opts *sshOpts) run() *checkers.Checker {
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	var bannerRe *regexp.Regexp
+	if opts.Banner != "" {
+		bannerRe, err = regexp.Compile(opts.Banner)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	if opts.SelfTest {
+		checks := []selftest.Check{selftest.Resolve(opts.Hostname)}
+		if !opts.NoAuth && opts.Password == "" && opts.PasswordFile == "" && opts.IdentityFile == "" {
+			checks = append(checks, func() error {
+				return errors.New("either --password or --identity is required unless --no-auth")
+			})
+		}
+		return selftest.Run(checks...)
+	}
 
 	start := time.Now()
-	client, err := opts.dial(config)
+	client, banner, err := opts.dial(config)
+	var nae *noAuthError
+	if errors.As(err, &nae) {
+		return checkers.Unknown(err.Error())
+	}
 	if err != nil {
 		if addrerr, ok := err.(*net.AddrError); ok {
 			if addrerr.Timeout() {
@@ -145,13 +282,21 @@ func (opts *sshOpts) run() *checkers.Checker {
 		}
 		return checkers.Critical(err.Error())
 	}
-	session, err := client.NewSession()
-	if err != nil {
-		return checkers.Critical(err.Error())
+	if client != nil {
+		defer client.Close()
 	}
-	err = session.Close()
-	if err != nil {
-		return checkers.Unknown(err.Error())
+	if bannerRe != nil && !bannerRe.MatchString(banner) {
+		return checkers.Critical(fmt.Sprintf("banner %q does not match /%s/", banner, opts.Banner))
+	}
+	if !opts.NoAuth {
+		session, err := client.NewSession()
+		if err != nil {
+			return checkers.Critical(err.Error())
+		}
+		err = session.Close()
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
 	}
 	elapsed := time.Now().Sub(start)
 	return opts.checkTimeout(elapsed)
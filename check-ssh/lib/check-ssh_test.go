@@ -0,0 +1,31 @@
+package checkssh
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBannerConn(t *testing.T) {
+	server, client := net.Pipe()
+	go func() {
+		server.Write([]byte("Welcome\r\n"))
+		server.Write([]byte("SSH-2.0-OpenSSH_"))
+		server.Write([]byte("8.9p1 Ubuntu-3\r\nbinary packets"))
+		server.Close()
+	}()
+
+	c := &bannerConn{Conn: client}
+	data, err := ioutil.ReadAll(c)
+	assert.Nil(t, err)
+	assert.Equal(t, "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3", c.banner)
+	assert.Equal(t, "Welcome\r\nSSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\nbinary packets", string(data))
+}
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, isAuthError(errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none], no supported methods remain")))
+	assert.False(t, isAuthError(errors.New("ssh: handshake failed: EOF")))
+}
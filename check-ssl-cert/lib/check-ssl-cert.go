@@ -1,21 +1,33 @@
 package checksslcert
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type certOpts struct {
-	Host     string `short:"H" long:"host" required:"true" description:"Host name"`
-	Port     int    `short:"p" long:"port" default:"443" description:"Port number"`
-	Warning  int    `short:"w" long:"warning" value-name:"days" default:"30" description:"The warning threshold in days before expiry"`
-	Critical int    `short:"c" long:"critical" value-name:"days" default:"14" description:"The critical threshold in days before expiry"`
+	Host     string   `short:"H" long:"host" required:"true" description:"Host name"`
+	Port     int      `short:"p" long:"port" default:"443" description:"Port number"`
+	Warning  int      `short:"w" long:"warning" value-name:"days" default:"30" description:"The warning threshold in days before expiry"`
+	Critical int      `short:"c" long:"critical" value-name:"days" default:"14" description:"The critical threshold in days before expiry"`
+	IssuerRe string   `long:"expect-issuer-regex" value-name:"REGEXP" description:"Warn if the issuer of the server certificate doesn't match the pattern"`
+	PubKeys  []string `long:"expect-pubkey-hash" value-name:"HASH" description:"Warn unless the base64 SHA-256 hash of the public key of the server certificate is the hash (may be repeated)"`
+	netutil.AddressFamilyOpts
+	selftest.SelfTestOpts
 }
 
 func parseArgs(args []string) (*certOpts, error) {
@@ -26,45 +38,117 @@ func parseArgs(args []string) (*certOpts, error) {
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "SSL"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	opts, err := parseArgs(os.Args[1:])
+	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	var issuerRe *regexp.Regexp
+	if opts.IssuerRe != "" {
+		issuerRe, err = regexp.Compile(opts.IssuerRe)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+
+	if opts.SelfTest {
+		return selftest.Run(selftest.Resolve(opts.Host))
 	}
 
 	addr := fmt.Sprintf("%s:%d", opts.Host, opts.Port)
-	cert, err := getCert(addr)
+	certs, err := getCerts(opts.Network("tcp"), addr)
 	if err != nil {
 		return checkers.Critical(err.Error())
 	}
-	expiry := cert.NotAfter
-	dur := expiry.Sub(time.Now())
+	verified, err := verifyChain(opts.Host, certs, nil)
+	if err != nil {
+		return checkers.Critical(chainError(certs, err))
+	}
+	return opts.evaluate(addr, certs, verified, issuerRe, time.Now())
+}
+
+// evaluate checks the expiry of every certificate in the served chain and the root it is verified with,
+// and how the chain is served.
+func (opts *certOpts) evaluate(addr string, certs, verified []*x509.Certificate, issuerRe *regexp.Regexp, now time.Time) *checkers.Checker {
+	chain := append([]*x509.Certificate{}, certs...)
+	for _, c := range verified {
+		if !containsCert(chain, c) {
+			chain = append(chain, c)
+		}
+	}
+	cert := chain[0]
+	for _, c := range chain[1:] {
+		if c.NotAfter.Before(cert.NotAfter) {
+			cert = c
+		}
+	}
+	dur := cert.NotAfter.Sub(now)
 
 	chkSt := checkers.OK
-	days := int(dur.Hours() / 24)
-	dayMsg := fmt.Sprintf("%d ", days)
-	if days == 1 {
-		dayMsg += "day"
-	} else {
-		dayMsg += "days"
+	raise := func(s checkers.Status) {
+		if s > chkSt {
+			chkSt = s
+		}
+	}
+	msg := fmt.Sprintf("Certificate '%s' expires in %s (%s)", addr, formatDays(certs[0].NotAfter.Sub(now)), certs[0].NotAfter)
+	if cert != certs[0] {
+		msg += fmt.Sprintf(", %s '%s' expires in %s (%s)", certRole(cert), cert.Subject, formatDays(dur), cert.NotAfter)
 	}
-	msg := fmt.Sprintf("Certificate '%s' expires in %s (%s)", addr, dayMsg, expiry)
 	if dur < time.Duration(opts.Warning)*time.Hour*24 {
-		chkSt = checkers.WARNING
+		raise(checkers.WARNING)
 	}
 	if dur < time.Duration(opts.Critical)*time.Hour*24 {
-		chkSt = checkers.CRITICAL
+		raise(checkers.CRITICAL)
+	}
+
+	var msgs []string
+	for i, c := range verified {
+		if i > 0 && i < len(verified)-1 && !containsCert(certs, c) {
+			raise(checkers.CRITICAL)
+			msgs = append(msgs, fmt.Sprintf("intermediate '%s' is not served", c.Subject))
+		}
+	}
+	if !servedInOrder(certs) {
+		raise(checkers.WARNING)
+		msgs = append(msgs, "chain is served in the wrong order")
+	}
+	if pins := checkPins(certs[0], issuerRe, opts.PubKeys); len(pins) > 0 {
+		raise(checkers.WARNING)
+		msgs = append(msgs, pins...)
+	}
+	if len(msgs) > 0 {
+		msg += ", " + strings.Join(msgs, ", ")
 	}
 	return checkers.NewChecker(chkSt, msg)
 }
 
-func getCert(addr string) (*x509.Certificate, error) {
-	conn, err := tls.Dial("tcp", addr, &tls.Config{})
+func formatDays(dur time.Duration) string {
+	days := int(dur.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// getCerts returns the certificate chain sent by the server, which begins with the server certificate.
+// The chain is verified by verifyChain instead of the handshake to tell how it is served wrongly.
+func getCerts(network, addr string) ([]*x509.Certificate, error) {
+	conn, err := tls.Dial(network, addr, &tls.Config{InsecureSkipVerify: true})
 	if err != nil {
 		return nil, err
 	}
@@ -74,11 +158,122 @@ func getCert(addr string) (*x509.Certificate, error) {
 	if len(certs) < 1 {
 		return nil, fmt.Errorf("no certifiations are available")
 	}
-	cert := certs[0]
+	return certs, nil
+}
+
+// verifyChain verifies the server certificate for the host with the served certificates as the intermediates,
+// and returns the chain from the server certificate to the root. The system roots are used if roots is nil.
+func verifyChain(host string, certs []*x509.Certificate, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
 	for _, c := range certs[1:] {
-		if c.NotAfter.Before(cert.NotAfter) {
-			cert = c
+		intermediates.AddCert(c)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+		Roots:         roots,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// chainError returns the message of the failed verification,
+// which tells the issuer not served if the chain doesn't reach a root, such as a missing intermediate.
+func chainError(certs []*x509.Certificate, err error) string {
+	var uae x509.UnknownAuthorityError
+	if !errors.As(err, &uae) {
+		return err.Error()
+	}
+	path := servedPath(certs)
+	last := path[len(path)-1]
+	if isSelfSigned(last) {
+		return fmt.Sprintf("%s: root '%s' is not trusted", err, last.Subject)
+	}
+	return fmt.Sprintf("%s: issuer '%s' of '%s' is neither served nor trusted", err, last.Issuer, last.Subject)
+}
+
+// servedPath returns the path from the server certificate by following the signatures through the served certificates.
+func servedPath(certs []*x509.Certificate) []*x509.Certificate {
+	path := certs[:1:1]
+	for {
+		cur := path[len(path)-1]
+		if isSelfSigned(cur) {
+			return path
+		}
+		var next *x509.Certificate
+		for _, c := range certs[1:] {
+			if !containsCert(path, c) && cur.CheckSignatureFrom(c) == nil {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return path
+		}
+		path = append(path, next)
+	}
+}
+
+// servedInOrder reports whether each certificate of the path is served just after the certificate it signs,
+// as TLS 1.2 requires (RFC 5246 7.4.2).
+func servedInOrder(certs []*x509.Certificate) bool {
+	for i, c := range servedPath(certs) {
+		if !c.Equal(certs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func certRole(cert *x509.Certificate) string {
+	if isSelfSigned(cert) {
+		return "root"
+	}
+	return "intermediate"
+}
+
+// pubKeyHash returns the base64 SHA-256 hash of the SubjectPublicKeyInfo of the certificate,
+// which is the same as pin-sha256 of HPKP and --pinnedpubkey of curl.
+func pubKeyHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkPins returns the messages of the unexpected issuer or public key of the server certificate,
+// such as a certificate mis-issued or reissued unexpectedly.
+// The hashes may be prefixed with "sha256/" as curl does.
+func checkPins(cert *x509.Certificate, issuerRe *regexp.Regexp, hashes []string) []string {
+	var msgs []string
+	if issuerRe != nil && !issuerRe.MatchString(cert.Issuer.String()) {
+		msgs = append(msgs, fmt.Sprintf("issuer '%s' doesn't match the expected", cert.Issuer))
+	}
+	if len(hashes) > 0 {
+		hash := pubKeyHash(cert)
+		found := false
+		for _, h := range hashes {
+			if strings.TrimPrefix(h, "sha256/") == hash {
+				found = true
+				break
+			}
+		}
+		if !found {
+			msgs = append(msgs, fmt.Sprintf("public key sha256/%s is not the expected", hash))
 		}
 	}
-	return cert, err
+	return msgs
 }
@@ -0,0 +1,163 @@
+package checksslcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		Issuer:       pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCheckPins(t *testing.T) {
+	cert := newCert(t)
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	hash := base64.StdEncoding.EncodeToString(sum[:])
+	assert.Equal(t, hash, pubKeyHash(cert))
+
+	assert.Empty(t, checkPins(cert, nil, nil))
+	assert.Empty(t, checkPins(cert, regexp.MustCompile("^CN=example\\.com$"), []string{"sha256/AAAA", "sha256/" + hash}))
+	assert.Empty(t, checkPins(cert, nil, []string{hash}))
+
+	assert.Equal(t, []string{
+		"issuer 'CN=example.com' doesn't match the expected",
+		"public key sha256/" + hash + " is not the expected",
+	}, checkPins(cert, regexp.MustCompile("Let's Encrypt"), []string{"sha256/AAAA"}))
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue returns a certificate signed by the parent, or a self-signed root if the parent is nil.
+func issue(t *testing.T, parent *testCA, cn string, isCA bool, notAfter time.Time) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		tmpl.DNSNames = []string{cn}
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func TestChain(t *testing.T) {
+	now := time.Now()
+	days := func(n int) time.Time { return now.Add(time.Duration(n)*24*time.Hour + time.Hour) }
+	root := issue(t, nil, "Root", true, days(3650))
+	inter := issue(t, root, "Intermediate", true, days(365))
+	leaf := issue(t, inter, "example.com", false, days(60))
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	opts := &certOpts{Warning: 30, Critical: 14}
+
+	certs := []*x509.Certificate{leaf.cert, inter.cert}
+	verified, err := verifyChain("example.com", certs, roots)
+	assert.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{leaf.cert, inter.cert, root.cert}, verified)
+	ckr := opts.evaluate("example.com:443", certs, verified, nil, now)
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, fmt.Sprintf("Certificate 'example.com:443' expires in 60 days (%s)", leaf.cert.NotAfter), ckr.Message)
+
+	// the intermediate expires before the server certificate
+	shortInter := issue(t, root, "Intermediate", true, days(20))
+	shortLeaf := issue(t, shortInter, "example.com", false, days(60))
+	certs = []*x509.Certificate{shortLeaf.cert, shortInter.cert}
+	verified, err = verifyChain("example.com", certs, roots)
+	assert.NoError(t, err)
+	ckr = opts.evaluate("example.com:443", certs, verified, nil, now)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Contains(t, ckr.Message, fmt.Sprintf(", intermediate 'CN=Intermediate' expires in 20 days (%s)", shortInter.cert.NotAfter))
+
+	// the root which is not served expires soon
+	oldRoot := issue(t, nil, "Old Root", true, days(10))
+	oldLeaf := issue(t, oldRoot, "example.com", false, days(60))
+	oldRoots := x509.NewCertPool()
+	oldRoots.AddCert(oldRoot.cert)
+	certs = []*x509.Certificate{oldLeaf.cert}
+	verified, err = verifyChain("example.com", certs, oldRoots)
+	assert.NoError(t, err)
+	ckr = opts.evaluate("example.com:443", certs, verified, nil, now)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Contains(t, ckr.Message, ", root 'CN=Old Root' expires in 10 days")
+
+	// the root is served before the intermediate
+	certs = []*x509.Certificate{leaf.cert, root.cert, inter.cert}
+	verified, err = verifyChain("example.com", certs, roots)
+	assert.NoError(t, err)
+	ckr = opts.evaluate("example.com:443", certs, verified, nil, now)
+	assert.Equal(t, checkers.WARNING, ckr.Status)
+	assert.Contains(t, ckr.Message, ", chain is served in the wrong order")
+	assert.True(t, servedInOrder([]*x509.Certificate{leaf.cert, inter.cert, root.cert}))
+
+	// the intermediate is not served but found in the system
+	ckr = opts.evaluate("example.com:443", []*x509.Certificate{leaf.cert}, []*x509.Certificate{leaf.cert, inter.cert, root.cert}, nil, now)
+	assert.Equal(t, checkers.CRITICAL, ckr.Status)
+	assert.Contains(t, ckr.Message, ", intermediate 'CN=Intermediate' is not served")
+
+	// the intermediate is not served
+	certs = []*x509.Certificate{leaf.cert}
+	_, err = verifyChain("example.com", certs, roots)
+	assert.Error(t, err)
+	assert.Contains(t, chainError(certs, err), ": issuer 'CN=Intermediate' of 'CN=example.com' is neither served nor trusted")
+
+	// the root is served but not trusted
+	certs = []*x509.Certificate{leaf.cert, inter.cert, root.cert}
+	_, err = verifyChain("example.com", certs, x509.NewCertPool())
+	assert.Error(t, err)
+	assert.Contains(t, chainError(certs, err), ": root 'CN=Root' is not trusted")
+}
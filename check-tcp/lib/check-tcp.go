@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"regexp"
@@ -12,19 +13,28 @@ import (
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/netutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
 )
 
 type tcpOpts struct {
 	Service  string `long:"service" description:"Service name. e.g. ftp, smtp, pop, imap and so on"`
 	Hostname string `short:"H" long:"hostname" description:"Host name or IP Address"`
 	exchange
-	Timeout    float64 `short:"t" long:"timeout" default:"10" description:"Seconds before connection times out"`
-	MaxBytes   int     `short:"m" long:"maxbytes" description:"Close connection once more than this number of bytes are received"`
-	Delay      float64 `short:"d" long:"delay" description:"Seconds to wait between sending string and polling for response"`
-	Warning    float64 `short:"w" long:"warning" description:"Response time to result in warning status (seconds)"`
-	Critical   float64 `short:"c" long:"critical" description:"Response time to result in critical status (seconds)"`
-	Escape     bool    `short:"E" long:"escape" description:"Can use \\n, \\r, \\t or \\ in send or quit string. Must come before send or quit option. By default, nothing added to send, \\r\\n added to end of quit"`
-	ErrWarning bool    `short:"W" long:"error-warning" description:"Set the error level to warning when exiting with unexpected error (default: critical). In the case of request succeeded, evaluation result of -c option eval takes priority."`
+	Timeout       float64 `short:"t" long:"timeout" default:"10" description:"Seconds before connection times out"`
+	MaxBytes      int     `short:"m" long:"maxbytes" description:"Close connection once more than this number of bytes are received"`
+	Delay         float64 `short:"d" long:"delay" description:"Seconds to wait between sending string and polling for response"`
+	Warning       float64 `short:"w" long:"warning" description:"Response time to result in warning status (seconds)"`
+	Critical      float64 `short:"c" long:"critical" description:"Response time to result in critical status (seconds)"`
+	Escape        bool    `short:"E" long:"escape" description:"Can use \\n, \\r, \\t or \\ in send or quit string. Must come before send or quit option. By default, nothing added to send, \\r\\n added to end of quit"`
+	ErrWarning    bool    `short:"W" long:"error-warning" description:"Set the error level to warning when exiting with unexpected error (default: critical). In the case of request succeeded, evaluation result of -c option eval takes priority."`
+	MinTLSVersion string  `long:"min-tls-version" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3" description:"CRITICAL if the server accepts TLS older than the version. Requires --ssl"`
+	ForbidCipher  string  `long:"forbid-cipher" value-name:"REGEX" description:"CRITICAL if the server accepts a cipher suite whose name matches REGEX, such as CBC|RC4|3DES. Requires --ssl"`
+	forbidReg     *regexp.Regexp
+	netutil.AddressFamilyOpts
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
 }
 
 type exchange struct {
@@ -36,20 +46,28 @@ type exchange struct {
 	UnixSock           string `short:"U" long:"unix-sock" description:"Unix Domain Socket"`
 	NoCheckCertificate bool   `long:"no-check-certificate" description:"Do not check certificate"`
 	expectReg          *regexp.Regexp
+	// readQuitReply is whether to read the reply to Quit until the server closes the connection,
+	// so that the server doesn't log an aborted connection.
+	readQuitReply bool
 }
 
 // Do the plugin
 func Do() {
-	opts, err := parseArgs(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 	ckr := opts.run()
 	ckr.Name = "TCP"
 	if opts.Service != "" {
 		ckr.Name = opts.Service
 	}
-	ckr.Exit()
+	return ckr
 }
 
 func parseArgs(args []string) (*tcpOpts, error) {
@@ -62,39 +80,59 @@ var defaultExchangeMap = map[string]exchange{
 	"FTP": {
 		Port:          21,
 		ExpectPattern: `^220`,
-		Quit:          "QUIT",
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
 	},
 	"POP": {
 		Port:          110,
 		ExpectPattern: `^\+OK`,
-		Quit:          "QUIT",
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
 	},
 	"SPOP": {
 		Port:          995,
 		ExpectPattern: `^\+OK`,
-		Quit:          "QUIT",
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
 		SSL:           true,
 	},
 	"IMAP": {
 		Port:          143,
 		ExpectPattern: `^\* OK`,
-		Quit:          "a1 LOGOUT",
+		Quit:          "a1 LOGOUT\r\n",
+		readQuitReply: true,
 	},
 	"SIMAP": {
 		Port:          993,
 		ExpectPattern: `^\* OK`,
-		Quit:          "a1 LOGOUT",
+		Quit:          "a1 LOGOUT\r\n",
+		readQuitReply: true,
 		SSL:           true,
 	},
 	"SMTP": {
 		Port:          25,
 		ExpectPattern: `^220`,
-		Quit:          "QUIT",
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
 	},
 	"SSMTP": {
 		Port:          465,
 		ExpectPattern: `^220`,
-		Quit:          "QUIT",
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
+		SSL:           true,
+	},
+	"NNTP": {
+		Port:          119,
+		ExpectPattern: `^20[01]`,
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
+	},
+	"NNTPS": {
+		Port:          563,
+		ExpectPattern: `^20[01]`,
+		Quit:          "QUIT\r\n",
+		readQuitReply: true,
 		SSL:           true,
 	},
 	"GEARMAN": {
@@ -107,12 +145,8 @@ var defaultExchangeMap = map[string]exchange{
 func (opts *tcpOpts) prepare() error {
 	opts.Service = strings.ToUpper(opts.Service)
 
-	if opts.Service != "" {
-		defaultEx, ok := defaultExchangeMap[opts.Service]
-		if !ok {
-			return fmt.Errorf("check-tcp called with unknown service: %s", opts.Service)
-		}
-		opts.merge(defaultEx)
+	if err := opts.AddressFamilyOpts.Validate(); err != nil {
+		return err
 	}
 
 	if opts.Escape {
@@ -121,7 +155,24 @@ func (opts *tcpOpts) prepare() error {
 	} else if opts.Quit != "" {
 		opts.Quit += "\r\n"
 	}
+
+	// the strings of the presets are already terminated, so merge them after the escape
+	if opts.Service != "" {
+		defaultEx, ok := defaultExchangeMap[opts.Service]
+		if !ok {
+			return fmt.Errorf("check-tcp called with unknown service: %s", opts.Service)
+		}
+		opts.merge(defaultEx)
+	}
+	if (opts.MinTLSVersion != "" || opts.ForbidCipher != "") && !opts.SSL {
+		return fmt.Errorf("--min-tls-version and --forbid-cipher require --ssl")
+	}
 	var err error
+	if opts.ForbidCipher != "" {
+		if opts.forbidReg, err = regexp.Compile(opts.ForbidCipher); err != nil {
+			return err
+		}
+	}
 	if opts.ExpectPattern != "" {
 		opts.expectReg, err = regexp.Compile(opts.ExpectPattern)
 	}
@@ -140,14 +191,16 @@ func (opts *tcpOpts) merge(ex exchange) {
 	}
 	if opts.Quit == "" {
 		opts.Quit = ex.Quit
+		opts.readQuitReply = ex.readQuitReply
 	}
 	if !opts.SSL {
 		opts.SSL = ex.SSL
 	}
 }
 
-func dial(network, address string, ssl bool, noCheckCertificate bool, timeout time.Duration) (net.Conn, error) {
-	d := &net.Dialer{Timeout: timeout}
+func dial(d *net.Dialer, network, address string, ssl bool, noCheckCertificate bool) (conn net.Conn, err error) {
+	end := debuglog.Trace("tcp: dial %s %s (ssl: %t)", network, address, ssl)
+	defer func() { end(err) }()
 	if ssl {
 		return tls.DialWithDialer(d, network, address, &tls.Config{
 			InsecureSkipVerify: noCheckCertificate,
@@ -157,15 +210,22 @@ func dial(network, address string, ssl bool, noCheckCertificate bool, timeout ti
 }
 
 func (opts *tcpOpts) run() *checkers.Checker {
+	opts.DebugOpts.Enable()
 	err := opts.prepare()
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	if opts.SelfTest {
+		if opts.UnixSock != "" {
+			return selftest.Run(selftest.Exists(opts.UnixSock))
+		}
+		return selftest.Run(selftest.Resolve(opts.Hostname))
+	}
 	// prevent changing output of some commands
 	os.Setenv("LANG", "C")
 	os.Setenv("LC_ALL", "C")
 
-	proto := "tcp"
+	proto := opts.Network("tcp")
 	addr := fmt.Sprintf("%s:%d", opts.Hostname, opts.Port)
 	if opts.UnixSock != "" {
 		proto = "unix"
@@ -177,7 +237,9 @@ func (opts *tcpOpts) run() *checkers.Checker {
 		time.Sleep(time.Duration(opts.Delay) * time.Second)
 	}
 
-	conn, err := dial(proto, addr, opts.SSL, opts.NoCheckCertificate, timeout)
+	// the TLS policy is probed with the same dialer, so that the probes reach the same address
+	d := &net.Dialer{Timeout: timeout}
+	conn, err := dial(d, proto, addr, opts.SSL, opts.NoCheckCertificate)
 	if err != nil {
 		if opts.ErrWarning {
 			return checkers.Warning(err.Error())
@@ -206,6 +268,7 @@ func (opts *tcpOpts) run() *checkers.Checker {
 			return checkers.Critical(err.Error())
 		}
 		res = string(buf)
+		debuglog.Printf("tcp: received %q", res)
 		if !opts.expectReg.MatchString(res) {
 			if opts.ErrWarning {
 				return checkers.Warning("Unexpected response from host/socket: " + res)
@@ -224,6 +287,10 @@ func (opts *tcpOpts) run() *checkers.Checker {
 		}
 	}
 	elapsedSeconds := float64(time.Now().Sub(start)) / float64(time.Second)
+	if opts.readQuitReply {
+		// the reply doesn't matter; the server closes the connection after it
+		slurpAll(conn, timeout)
+	}
 
 	chkSt := checkers.OK
 	if opts.Warning > 0 && elapsedSeconds > opts.Warning {
@@ -242,14 +309,98 @@ func (opts *tcpOpts) run() *checkers.Checker {
 	if res != "" {
 		msg += fmt.Sprintf(" [%s]", strings.Trim(res, "\r\n"))
 	}
+	if tc, ok := conn.(*tls.Conn); ok && (opts.MinTLSVersion != "" || opts.forbidReg != nil) {
+		if violations := opts.checkTLSPolicy(tc.ConnectionState(), d, proto, addr); len(violations) > 0 {
+			return checkers.Critical(strings.Join(violations, ", ") + ", " + msg)
+		}
+	}
 	return checkers.NewChecker(chkSt, msg)
 }
 
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func tlsVersionName(v uint16) string {
+	for name, version := range tlsVersions {
+		if version == v {
+			return "TLS " + name
+		}
+	}
+	return fmt.Sprintf("TLS 0x%04x", v)
+}
+
+// checkTLSPolicy returns the violations of --min-tls-version and --forbid-cipher.
+// Because a client negotiates the best version and cipher suite the server accepts, the server is also probed with
+// the older versions and the forbidden cipher suites alone, which are accepted only if they are enabled on the server.
+// The cipher suites of TLS 1.3 can't be offered selectively, so they are checked only by the negotiated one.
+func (opts *tcpOpts) checkTLSPolicy(state tls.ConnectionState, d *net.Dialer, network, address string) []string {
+	var violations []string
+	minVersion := tlsVersions[opts.MinTLSVersion]
+	if minVersion != 0 {
+		if state.Version < minVersion {
+			violations = append(violations, fmt.Sprintf("%s was negotiated instead of TLS %s or later", tlsVersionName(state.Version), opts.MinTLSVersion))
+		} else if minVersion > tls.VersionTLS10 {
+			var all []uint16
+			for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+				all = append(all, c.ID)
+			}
+			if v, _, err := probeTLS(d, network, address, opts.Hostname, tls.VersionTLS10, minVersion-1, all); err == nil {
+				violations = append(violations, fmt.Sprintf("%s is accepted", tlsVersionName(v)))
+			}
+		}
+	}
+	if opts.forbidReg != nil {
+		name := tls.CipherSuiteName(state.CipherSuite)
+		if opts.forbidReg.MatchString(name) {
+			violations = append(violations, fmt.Sprintf("%s was negotiated", name))
+		} else {
+			var forbidden []uint16
+			for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+				if opts.forbidReg.MatchString(c.Name) && c.SupportedVersions[0] < tls.VersionTLS13 {
+					forbidden = append(forbidden, c.ID)
+				}
+			}
+			if len(forbidden) > 0 {
+				if _, c, err := probeTLS(d, network, address, opts.Hostname, tls.VersionTLS10, tls.VersionTLS12, forbidden); err == nil {
+					violations = append(violations, fmt.Sprintf("%s is accepted", tls.CipherSuiteName(c)))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// probeTLS tries a handshake offering only the versions and the cipher suites,
+// and returns the negotiated ones if the server accepts them.
+func probeTLS(d *net.Dialer, network, address, serverName string, minVersion, maxVersion uint16, ciphers []uint16) (uint16, uint16, error) {
+	end := debuglog.Trace("tcp: probe TLS %s-%s with %d cipher suites", tlsVersionName(minVersion), tlsVersionName(maxVersion), len(ciphers))
+	conn, err := tls.DialWithDialer(d, network, address, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		CipherSuites:       ciphers,
+	})
+	end(err)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	return state.Version, state.CipherSuite, nil
+}
+
 func write(conn net.Conn, content []byte, timeout time.Duration) error {
 	if timeout > 0 {
 		conn.SetWriteDeadline(time.Now().Add(timeout))
 	}
+	end := debuglog.Trace("tcp: send %q", content)
 	_, err := conn.Write(content)
+	end(err)
 	return err
 }
 
@@ -283,6 +434,13 @@ func slurp(conn net.Conn, maxbytes int, timeout time.Duration) ([]byte, error) {
 	return buf, nil
 }
 
+func slurpAll(conn net.Conn, timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	return ioutil.ReadAll(conn)
+}
+
 func escapedString(str string) (escaped string) {
 	l := len(str)
 	for i := 0; i < l; i++ {
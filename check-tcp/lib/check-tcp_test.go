@@ -1,9 +1,12 @@
 package checktcp
 
 import (
+	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -126,6 +129,42 @@ func TestGEARMAN(t *testing.T) {
 	server.shutdown()
 }
 
+func TestSMTPQuit(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	received := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			received <- line
+			conn.Write([]byte("221 2.0.0 Bye\r\n"))
+			conn.Close()
+		}
+	}()
+
+	for _, args := range [][]string{
+		{"--service=smtp", "-H", "127.0.0.1", "-p", port},
+		{"--service=smtp", "-E", "-H", "127.0.0.1", "-p", port},
+		{"-H", "127.0.0.1", "-p", port, "-e", "^220", "-E", "-q", `QUIT\r\n`},
+	} {
+		opts, err := parseArgs(args)
+		assert.Equal(t, nil, err, "no errors")
+		ckr := opts.run()
+		assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+		assert.Equal(t, "QUIT\r\n", <-received, "QUIT should be terminated with CRLF: %v", args)
+	}
+}
+
 func TestHTTP(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		time.Sleep(time.Second / 5)
@@ -357,3 +396,101 @@ func TestHTTPIPv6(t *testing.T) {
 	}
 	testOverCrit()
 }
+
+func TestAddressFamily(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	opts, err := parseArgs([]string{"-H", "127.0.0.1", "-p", port, "-4"})
+	assert.Equal(t, nil, err, "no errors")
+	ckr := opts.run()
+	assert.Equal(t, checkers.OK, ckr.Status, "should be OK over IPv4")
+
+	opts, err = parseArgs([]string{"-H", "127.0.0.1", "-p", port, "-6"})
+	assert.Equal(t, nil, err, "no errors")
+	ckr = opts.run()
+	assert.Equal(t, checkers.CRITICAL, ckr.Status, "IPv4 address should not be dialed over IPv6")
+
+	opts, err = parseArgs([]string{"-H", "127.0.0.1", "-p", port, "-4", "-6"})
+	assert.Equal(t, nil, err, "no errors")
+	ckr = opts.run()
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status, "both of -4 and -6 should not be allowed")
+}
+
+func TestTLSPolicy(t *testing.T) {
+	newServer := func(cfg *tls.Config) (*httptest.Server, string) {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.TLS = cfg
+		// the handshakes of the probes fail as expected
+		ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+		ts.StartTLS()
+		u, _ := url.Parse(ts.URL)
+		return ts, u.Port()
+	}
+	weak, weakPort := newServer(&tls.Config{
+		MinVersion:   tls.VersionTLS10,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+	})
+	defer weak.Close()
+	strict, strictPort := newServer(&tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	})
+	defer strict.Close()
+
+	testCases := []struct {
+		args   []string
+		status checkers.Status
+		msg    string
+	}{
+		{
+			args:   []string{"-S", "--no-check-certificate", "-H", "127.0.0.1", "-p", weakPort, "--min-tls-version", "1.2"},
+			status: checkers.CRITICAL,
+			msg:    "TLS 1.1 is accepted, ",
+		},
+		{
+			args:   []string{"-S", "--no-check-certificate", "-H", "127.0.0.1", "-p", weakPort, "--min-tls-version", "1.0"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-S", "--no-check-certificate", "-H", "127.0.0.1", "-p", weakPort, "--forbid-cipher", "CBC|RC4|3DES"},
+			status: checkers.CRITICAL,
+			msg:    "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA is accepted, ",
+		},
+		{
+			args:   []string{"-S", "--no-check-certificate", "-H", "127.0.0.1", "-p", weakPort, "--forbid-cipher", "^TLS_AES_128_GCM_SHA256$"},
+			status: checkers.CRITICAL,
+			msg:    "TLS_AES_128_GCM_SHA256 was negotiated, ",
+		},
+		{
+			args:   []string{"-S", "--no-check-certificate", "-H", "127.0.0.1", "-p", strictPort, "--min-tls-version", "1.2", "--forbid-cipher", "CBC|RC4|3DES"},
+			status: checkers.OK,
+		},
+		{
+			args:   []string{"-H", "127.0.0.1", "-p", strictPort, "--min-tls-version", "1.2"},
+			status: checkers.UNKNOWN,
+		},
+	}
+	for i, tc := range testCases {
+		opts, err := parseArgs(tc.args)
+		assert.Equal(t, nil, err, "no errors")
+		ckr := opts.run()
+		assert.Equal(t, tc.status, ckr.Status, "#%d: %s", i, ckr.Message)
+		if tc.msg != "" {
+			assert.Contains(t, ckr.Message, tc.msg, "#%d", i)
+		}
+	}
+}
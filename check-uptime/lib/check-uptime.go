@@ -3,33 +3,50 @@ package checkuptime
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
 	"github.com/mackerelio/go-osstat/uptime"
 )
 
-var opts struct {
+type uptimeOpts struct {
 	WarnUnder    *float64 `long:"warn-under" value-name:"N" description:"(DEPRECATED) Trigger a warning if under the seconds"`
 	WarningUnder *float64 `short:"w" long:"warning-under" value-name:"N" description:"Trigger a warning if under the seconds"`
 	CritUnder    *float64 `short:"c" long:"critical-under" value-name:"N" description:"Trigger a critial if under the seconds"`
 	WarnOver     *float64 `long:"warn-over" value-name:"N" description:"(DEPRECATED) Trigger a warning if over the seconds"`
 	WarningOver  *float64 `short:"W" long:"warning-over" value-name:"N" description:"Trigger a warning if over the seconds"`
 	CritOver     *float64 `short:"C" long:"critical-over" value-name:"N" description:"Trigger a critical if over the seconds"`
+	DetectReboot bool     `long:"detect-reboot" description:"Alert once when the boot id has changed since the last check (Linux only)"`
+	RebootStatus string   `long:"reboot-status" default:"WARNING" value-name:"(CRITICAL|WARNING)" description:"Exit status when a reboot is detected"`
+	PendingDays  *float64 `long:"pending-reboot-days" value-name:"DAYS" description:"Trigger a warning if a reboot has been required for more than the days (Linux only)"`
+	StateDir     string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	selftest.SelfTestOpts
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
 	ckr.Name = "Uptime"
-	ckr.Exit()
+	return ckr
 }
 
 func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+	opts := &uptimeOpts{}
+	_, err := flags.ParseArgs(opts, args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run()
 	}
 	utDur, err := uptime.Get()
 	if err != nil {
@@ -65,5 +82,77 @@ func run(args []string) *checkers.Checker {
 	mins := int64(dur.Minutes()) % 60
 	msg := fmt.Sprintf("%d day(s) %d hour(s) %d minute(s) (%d second(s))\n", days, hours, mins, int64(dur.Seconds()))
 
+	if opts.DetectReboot {
+		rebootSt, ok := map[string]checkers.Status{
+			"WARNING":  checkers.WARNING,
+			"CRITICAL": checkers.CRITICAL,
+		}[opts.RebootStatus]
+		if !ok {
+			return checkers.Unknown("reboot-status option is invalid")
+		}
+		rebooted, err := opts.detectReboot(args)
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to detect reboot: %s", err))
+		}
+		if rebooted {
+			msg = "rebooted since the last check, " + msg
+			if rebootSt > checkSt {
+				checkSt = rebootSt
+			}
+		}
+	}
+
+	if opts.PendingDays != nil {
+		now := time.Now()
+		reasons, err := detectPendingReboot(now.Add(-dur))
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to detect pending reboot: %s", err))
+		}
+		since, err := pendingSince(reasons, now, state.File(state.Dir(opts.StateDir, "check-uptime"), "pending_reboot"))
+		if err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to detect pending reboot: %s", err))
+		}
+		if len(reasons) > 0 {
+			var rs []string
+			for _, r := range reasons {
+				rs = append(rs, r.reason)
+			}
+			days := now.Sub(since).Hours() / 24
+			msg = fmt.Sprintf("reboot required for %.1f day(s) (%s), ", days, strings.Join(rs, ", ")) + msg
+			if days > *opts.PendingDays && checkSt < checkers.WARNING {
+				checkSt = checkers.WARNING
+			}
+		}
+	}
+
 	return checkers.NewChecker(checkSt, msg)
 }
+
+// bootState is the boot id saved at the last check.
+type bootState struct {
+	BootID string `json:"boot_id"`
+}
+
+// detectReboot reports whether the boot id has changed since the last check.
+// The reboot is reported only once because the new boot id is saved.
+// The state is kept for each arguments, so that every check configured with other arguments
+// reports the reboot too.
+func (opts *uptimeOpts) detectReboot(args []string) (bool, error) {
+	id, err := getBootID()
+	if err != nil {
+		return false, err
+	}
+	f := state.File(state.Dir(opts.StateDir, "check-uptime"), "boot_id", strings.Join(args, " "))
+	var last bootState
+	if _, err := state.Load(f, &last); err != nil {
+		return false, err
+	}
+	if last.BootID == id {
+		return false, nil
+	}
+	if err := state.Save(f, &bootState{BootID: id}); err != nil {
+		return false, err
+	}
+	// the first check has nothing to compare with.
+	return last.BootID != "", nil
+}
@@ -0,0 +1,55 @@
+package checkuptime
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+func getBootID() (string, error) {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// detectPendingReboot returns the reasons why a reboot is required.
+func detectPendingReboot(boot time.Time) ([]pendingReason, error) {
+	var reasons []pendingReason
+	r, err := checkRebootRequiredFile()
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		reasons = append(reasons, *r)
+	}
+
+	b, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return nil, err
+	}
+	r, err = checkNewerKernel(strings.TrimSpace(string(b)), boot)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		reasons = append(reasons, *r)
+	}
+
+	// needs-restarting of yum-utils or dnf-utils on RHEL exits with 1 if a reboot is required.
+	if path, err := exec.LookPath("needs-restarting"); err == nil {
+		err := exec.Command(path, "-r").Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+			reasons = append(reasons, pendingReason{reason: "needs-restarting -r reports"})
+		default:
+			return nil, err
+		}
+	}
+	return reasons, nil
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package checkuptime
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func getBootID() (string, error) {
+	return "", fmt.Errorf("boot id is not supported on %s", runtime.GOOS)
+}
+
+func detectPendingReboot(boot time.Time) ([]pendingReason, error) {
+	return nil, fmt.Errorf("pending reboot detection is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,149 @@
+package checkuptime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectReboot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("boot id is supported only on Linux")
+	}
+	dir, err := ioutil.TempDir("", "check-uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := &uptimeOpts{StateDir: dir}
+
+	args := []string{"--detect-reboot"}
+	rebooted, err := opts.detectReboot(args)
+	assert.Nil(t, err)
+	assert.False(t, rebooted, "the first check should not be regarded as a reboot")
+
+	rebooted, err = opts.detectReboot(args)
+	assert.Nil(t, err)
+	assert.False(t, rebooted, "the boot id should not change")
+
+	other := []string{"--detect-reboot", "--reboot-status", "CRITICAL"}
+	rebooted, err = opts.detectReboot(other)
+	assert.Nil(t, err)
+	assert.False(t, rebooted, "the first check with other arguments should not be regarded as a reboot")
+
+	reboot := func(args []string) {
+		f := state.File(dir, "boot_id", strings.Join(args, " "))
+		assert.Nil(t, state.Save(f, &bootState{BootID: "00000000-0000-0000-0000-000000000000"}))
+	}
+	reboot(args)
+	reboot(other)
+	rebooted, err = opts.detectReboot(args)
+	assert.Nil(t, err)
+	assert.True(t, rebooted, "the changed boot id should be regarded as a reboot")
+
+	rebooted, err = opts.detectReboot(args)
+	assert.Nil(t, err)
+	assert.False(t, rebooted, "the reboot should be reported only once")
+
+	rebooted, err = opts.detectReboot(other)
+	assert.Nil(t, err)
+	assert.True(t, rebooted, "the reboot should be reported to the check with other arguments too")
+}
+
+func TestCheckNewerKernel(t *testing.T) {
+	dir := t.TempDir()
+	bootDir = dir
+	defer func() { bootDir = "/boot" }()
+
+	boot := time.Now().Add(-24 * time.Hour)
+	install := func(release string, mtime time.Time) {
+		f := filepath.Join(dir, "vmlinuz-"+release)
+		assert.Nil(t, ioutil.WriteFile(f, nil, 0644))
+		assert.Nil(t, os.Chtimes(f, mtime, mtime))
+	}
+	install("5.14.0-70.el9.x86_64", boot.Add(-48*time.Hour))
+	install("0-rescue-0123456789abcdef", boot.Add(time.Hour))
+
+	r, err := checkNewerKernel("5.14.0-70.el9.x86_64", boot)
+	assert.Nil(t, err)
+	assert.Nil(t, r, "the rescue kernel should be ignored")
+
+	installed := boot.Add(2 * time.Hour)
+	install("5.14.0-162.el9.x86_64", installed)
+	r, err = checkNewerKernel("5.14.0-70.el9.x86_64", boot)
+	assert.Nil(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "kernel 5.14.0-162.el9.x86_64 is installed while 5.14.0-70.el9.x86_64 is running", r.reason)
+		assert.True(t, installed.Equal(r.since))
+	}
+
+	r, err = checkNewerKernel("5.14.0-162.el9.x86_64", installed.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Nil(t, r, "the newest kernel is running")
+
+	// the packages set the modification time to the build time, which can be before the boot
+	install("5.14.0-284.el9.x86_64", boot.Add(-time.Hour))
+	r, err = checkNewerKernel("5.14.0-162.el9.x86_64", installed.Add(time.Hour))
+	assert.Nil(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "kernel 5.14.0-284.el9.x86_64 is installed while 5.14.0-162.el9.x86_64 is running", r.reason)
+		assert.True(t, r.since.IsZero(), "the time should be unknown")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 1, compareVersions("5.14.0-162.el9.x86_64", "5.14.0-70.el9.x86_64"))
+	assert.Equal(t, -1, compareVersions("5.15.0-91-generic", "5.15.0-101-generic"))
+	assert.Equal(t, 1, compareVersions("6.1.0-13-amd64", "5.10.0-26-amd64"))
+	assert.Equal(t, 0, compareVersions("6.1.0-13-amd64", "6.1.0-13-amd64"))
+	assert.Equal(t, -1, compareVersions("6.1.0", "6.1.0-13-amd64"))
+}
+
+func TestPendingSince(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := state.File(dir, "pending_reboot")
+	now := time.Unix(1700000000, 0)
+
+	since, err := pendingSince([]pendingReason{{reason: "needs-restarting -r reports"}}, now, stateFile)
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(since), "the first time found should be the time")
+
+	later := now.Add(72 * time.Hour)
+	since, err = pendingSince([]pendingReason{{reason: "needs-restarting -r reports"}}, later, stateFile)
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(since), "the first time found should be kept")
+
+	earlier := now.Add(-24 * time.Hour)
+	since, err = pendingSince([]pendingReason{{reason: "needs-restarting -r reports"}, {reason: "kernel", since: earlier}}, later, stateFile)
+	assert.Nil(t, err)
+	assert.True(t, earlier.Equal(since), "the known time earlier than the first time found should be preferred")
+
+	_, err = pendingSince(nil, later, stateFile)
+	assert.Nil(t, err)
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err), "the state should be removed when a reboot is no longer required")
+}
+
+func TestCheckRebootRequiredFile(t *testing.T) {
+	rebootRequiredFile = filepath.Join(t.TempDir(), "reboot-required")
+	defer func() { rebootRequiredFile = "/var/run/reboot-required" }()
+
+	r, err := checkRebootRequiredFile()
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	assert.Nil(t, ioutil.WriteFile(rebootRequiredFile, []byte("*** System restart required ***\n"), 0644))
+	r, err = checkRebootRequiredFile()
+	assert.Nil(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, rebootRequiredFile+" exists", r.reason)
+		assert.False(t, r.since.IsZero())
+	}
+}
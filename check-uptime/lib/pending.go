@@ -0,0 +1,135 @@
+package checkuptime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+// pendingReason is a reason why a reboot is required, with the time since when it has been required if known.
+type pendingReason struct {
+	reason string
+	since  time.Time
+}
+
+// replaced in tests
+var (
+	rebootRequiredFile = "/var/run/reboot-required"
+	bootDir            = "/boot"
+)
+
+// checkRebootRequiredFile returns the reason if the file created by update-notifier of Debian and Ubuntu exists,
+// which tells an upgraded package requires a reboot.
+func checkRebootRequiredFile() (*pendingReason, error) {
+	fi, err := os.Stat(rebootRequiredFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pendingReason{reason: rebootRequiredFile + " exists", since: fi.ModTime()}, nil
+}
+
+// checkNewerKernel returns the reason if a kernel newer than the running one is installed.
+// The kernels are compared by their versions rather than the modification times of the files,
+// which are the build times set by the packages. The time since when a reboot has been required
+// is known only if the file was modified after the boot.
+func checkNewerKernel(running string, boot time.Time) (*pendingReason, error) {
+	files, err := filepath.Glob(filepath.Join(bootDir, "vmlinuz-*"))
+	if err != nil {
+		return nil, err
+	}
+	var newest string
+	for _, f := range files {
+		if strings.Contains(f, "rescue") {
+			continue
+		}
+		release := strings.TrimPrefix(filepath.Base(f), "vmlinuz-")
+		if newest == "" || compareVersions(release, newest) > 0 {
+			newest = release
+		}
+	}
+	if newest == "" || compareVersions(newest, running) <= 0 {
+		return nil, nil
+	}
+	r := &pendingReason{reason: fmt.Sprintf("kernel %s is installed while %s is running", newest, running)}
+	if fi, err := os.Stat(filepath.Join(bootDir, "vmlinuz-"+newest)); err == nil && fi.ModTime().After(boot) {
+		r.since = fi.ModTime()
+	}
+	return r, nil
+}
+
+// compareVersions compares the kernel releases such as 5.14.0-70.el9.x86_64 as sort -V does,
+// where the runs of digits are compared as numbers.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		var x, y string
+		x, a = splitVersion(a)
+		y, b = splitVersion(b)
+		if isDigit(x[0]) && isDigit(y[0]) {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// splitVersion splits the leading run of digits or non-digits from s.
+func splitVersion(s string) (string, string) {
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// pendingState is the time when a reboot was found required first.
+type pendingState struct {
+	Since int64 `json:"since"`
+}
+
+// pendingSince returns the earliest time since when the reasons have required a reboot.
+// The time when a reboot was found required first is kept in the state file for the reasons whose time is unknown,
+// and it is removed when a reboot is no longer required.
+func pendingSince(reasons []pendingReason, now time.Time, stateFile string) (time.Time, error) {
+	if len(reasons) == 0 {
+		if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+			return time.Time{}, err
+		}
+		return time.Time{}, nil
+	}
+	var last pendingState
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return time.Time{}, err
+	}
+	first := now
+	if last.Since > 0 && last.Since < now.Unix() {
+		first = time.Unix(last.Since, 0)
+	} else if err := state.Save(stateFile, &pendingState{Since: now.Unix()}); err != nil {
+		return time.Time{}, err
+	}
+	since := first
+	for _, r := range reasons {
+		if !r.since.IsZero() && r.since.Before(since) {
+			since = r.since
+		}
+	}
+	return since, nil
+}
@@ -0,0 +1,225 @@
+package checkvarnish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
+)
+
+type varnishOpts struct {
+	Name                   string   `short:"n" long:"name" description:"Instance name of varnishd, passed to varnishstat -n"`
+	Varnishstat            string   `long:"varnishstat" value-name:"PATH" default:"varnishstat" description:"Path to varnishstat"`
+	Timeout                int      `short:"t" long:"timeout" default:"10" description:"Seconds before varnishstat times out"`
+	WarningBackendFail     int64    `long:"warning-backend-fail" value-name:"N" default:"0" description:"warning if the number of backend connection failures since the last check is over"`
+	CriticalBackendFail    *int64   `long:"critical-backend-fail" value-name:"N" description:"critical if the number of backend connection failures since the last check is over"`
+	WarningThreadsLimited  int64    `long:"warning-threads-limited" value-name:"N" default:"0" description:"warning if the number of times threads were limited since the last check is over"`
+	CriticalThreadsLimited *int64   `long:"critical-threads-limited" value-name:"N" description:"critical if the number of times threads were limited since the last check is over"`
+	WarningLRUNuked        *int64   `long:"warning-lru-nuked" value-name:"N" description:"warning if the number of objects evicted by LRU since the last check is over"`
+	CriticalLRUNuked       *int64   `long:"critical-lru-nuked" value-name:"N" description:"critical if the number of objects evicted by LRU since the last check is over"`
+	WarningHitRatio        *float64 `long:"warning-hit-ratio" value-name:"PERCENT" description:"warning if the cache hit ratio is less than"`
+	CriticalHitRatio       *float64 `long:"critical-hit-ratio" value-name:"PERCENT" description:"critical if the cache hit ratio is less than"`
+	MinRequests            int64    `long:"min-requests" value-name:"N" default:"100" description:"Don't check the cache hit ratio if hits and misses are fewer than"`
+	Perfdata               bool     `long:"perfdata" description:"Append the cache hit ratio and the counters as performance data"`
+	StateDir               string   `long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	debuglog.DebugOpts
+	selftest.SelfTestOpts
+}
+
+// counters is the counters of varnishd which are checked.
+// They are saved in the state file to compute the increases since the last check.
+type counters struct {
+	Uptime         int64 `json:"uptime"`
+	BackendFail    int64 `json:"backend_fail"`
+	ThreadsLimited int64 `json:"threads_limited"`
+	LRUNuked       int64 `json:"n_lru_nuked"`
+	CacheHit       int64 `json:"cache_hit"`
+	CacheMiss      int64 `json:"cache_miss"`
+}
+
+// Do the plugin
+func Do() {
+	Run(os.Args[1:]).Exit()
+}
+
+// Run runs the plugin with args, which exclude the program name, and returns the result
+func Run(args []string) *checkers.Checker {
+	ckr := run(args)
+	ckr.Name = "Varnish"
+	return ckr
+}
+
+func run(args []string) *checkers.Checker {
+	opts := varnishOpts{}
+	_, err := flags.ParseArgs(&opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run(selftest.Executable(opts.Varnishstat))
+	}
+
+	out, err := opts.varnishstat()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	cur, err := parseCounters(out)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+
+	stateFile := state.File(state.Dir(opts.StateDir, "check-varnish"), "counters", opts.Name)
+	var last *counters
+	if _, err := state.Load(stateFile, &last); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if err := state.Save(stateFile, cur); err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return opts.evaluate(cur, last)
+}
+
+func (opts *varnishOpts) varnishstat() ([]byte, error) {
+	args := []string{"-j"}
+	if opts.Name != "" {
+		args = append(args, "-n", opts.Name)
+	}
+
+	opts.DebugOpts.Enable()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	end := debuglog.Trace("exec: %s", debuglog.Command(opts.Varnishstat, args))
+	cmd := exec.CommandContext(ctx, opts.Varnishstat, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	end(err)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out", opts.Varnishstat)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseCounters parses the output of varnishstat -j.
+// The counters are at the top level before Varnish 6.5, and in "counters" since 6.5.
+func parseCounters(out []byte) (*counters, error) {
+	var stats map[string]json.RawMessage
+	if err := json.Unmarshal(out, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse the output of varnishstat: %s", err)
+	}
+	if c, ok := stats["counters"]; ok {
+		stats = nil
+		if err := json.Unmarshal(c, &stats); err != nil {
+			return nil, fmt.Errorf("failed to parse the output of varnishstat: %s", err)
+		}
+	}
+
+	cs := &counters{}
+	for name, v := range map[string]*int64{
+		"MAIN.uptime":          &cs.Uptime,
+		"MAIN.backend_fail":    &cs.BackendFail,
+		"MAIN.threads_limited": &cs.ThreadsLimited,
+		"MAIN.n_lru_nuked":     &cs.LRUNuked,
+		"MAIN.cache_hit":       &cs.CacheHit,
+		"MAIN.cache_miss":      &cs.CacheMiss,
+	} {
+		raw, ok := stats[name]
+		if !ok {
+			return nil, fmt.Errorf("no %s in the output of varnishstat", name)
+		}
+		var c struct {
+			Value int64 `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", name, err)
+		}
+		*v = c.Value
+	}
+	return cs, nil
+}
+
+// evaluate checks the increases of the counters since the last check, which are not checked on the first check
+// or if varnishd has been restarted.
+// The cache hit ratio is the ratio since the last check, or since varnishd started on the first check.
+func (opts *varnishOpts) evaluate(cur, last *counters) *checkers.Checker {
+	if last != nil && cur.Uptime < last.Uptime {
+		last = nil
+	}
+	checkSt := checkers.OK
+	var msgs []string
+	raise := func(s checkers.Status, msg string) {
+		if s > checkSt {
+			checkSt = s
+		}
+		msgs = append(msgs, msg)
+	}
+	checkIncrease := func(name string, n int64, warning, critical *int64) {
+		switch {
+		case critical != nil && n > *critical:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s increased by %d > %d", name, n, *critical))
+		case warning != nil && n > *warning:
+			raise(checkers.WARNING, fmt.Sprintf("%s increased by %d > %d", name, n, *warning))
+		}
+	}
+
+	hit, miss := cur.CacheHit, cur.CacheMiss
+	if last != nil {
+		checkIncrease("backend_fail", cur.BackendFail-last.BackendFail, &opts.WarningBackendFail, opts.CriticalBackendFail)
+		checkIncrease("threads_limited", cur.ThreadsLimited-last.ThreadsLimited, &opts.WarningThreadsLimited, opts.CriticalThreadsLimited)
+		checkIncrease("n_lru_nuked", cur.LRUNuked-last.LRUNuked, opts.WarningLRUNuked, opts.CriticalLRUNuked)
+		hit -= last.CacheHit
+		miss -= last.CacheMiss
+	}
+
+	ratioMsg := fmt.Sprintf("too few requests to check the cache hit ratio (%d)", hit+miss)
+	ratio := -1.0
+	if hit+miss > 0 {
+		ratio = float64(hit) / float64(hit+miss) * 100
+	}
+	if hit+miss >= opts.MinRequests && ratio >= 0 {
+		ratioMsg = fmt.Sprintf("cache hit ratio %.1f%%", ratio)
+		switch {
+		case opts.CriticalHitRatio != nil && ratio < *opts.CriticalHitRatio:
+			raise(checkers.CRITICAL, fmt.Sprintf("%s < %g%%", ratioMsg, *opts.CriticalHitRatio))
+		case opts.WarningHitRatio != nil && ratio < *opts.WarningHitRatio:
+			raise(checkers.WARNING, fmt.Sprintf("%s < %g%%", ratioMsg, *opts.WarningHitRatio))
+		}
+	}
+
+	result := strings.Join(msgs, ", ")
+	if len(msgs) == 0 {
+		result = ratioMsg
+	}
+	if opts.Perfdata {
+		var perfs []string
+		if ratio >= 0 {
+			perfs = append(perfs, perfdata.Format("hit_ratio", fmt.Sprintf("%.1f", ratio), "%", perfdata.OptFloat(opts.WarningHitRatio), perfdata.OptFloat(opts.CriticalHitRatio)))
+		}
+		perfs = append(perfs,
+			perfdata.Format("backend_fail", strconv.FormatInt(cur.BackendFail, 10), "c", "", ""),
+			perfdata.Format("threads_limited", strconv.FormatInt(cur.ThreadsLimited, 10), "c", "", ""),
+			perfdata.Format("n_lru_nuked", strconv.FormatInt(cur.LRUNuked, 10), "c", "", ""),
+		)
+		result += " | " + strings.Join(perfs, " ")
+	}
+	return checkers.NewChecker(checkSt, result)
+}
@@ -0,0 +1,97 @@
+package checkvarnish
+
+import (
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+// varnishstat -j of Varnish 6.0
+const statsV60 = `{
+  "timestamp": "2023-11-14T22:13:20",
+  "MGT.uptime": {"description": "Management process uptime", "flag": "c", "format": "d", "value": 86500},
+  "MAIN.uptime": {"description": "Child process uptime", "flag": "c", "format": "d", "value": 86400},
+  "MAIN.cache_hit": {"description": "Cache hits", "flag": "c", "format": "i", "value": 9000},
+  "MAIN.cache_miss": {"description": "Cache misses", "flag": "c", "format": "i", "value": 1000},
+  "MAIN.backend_fail": {"description": "Backend conn. failures", "flag": "c", "format": "i", "value": 3},
+  "MAIN.threads_limited": {"description": "Threads hit max", "flag": "c", "format": "i", "value": 0},
+  "MAIN.n_lru_nuked": {"description": "Number of LRU nuked objects", "flag": "g", "format": "i", "value": 42}
+}`
+
+// varnishstat -j of Varnish 6.5 and later
+const statsV65 = `{
+  "version": 1,
+  "timestamp": "2023-11-14T22:13:20",
+  "counters": {
+    "MAIN.uptime": {"description": "Child process uptime", "flag": "c", "format": "d", "value": 86400},
+    "MAIN.cache_hit": {"description": "Cache hits", "flag": "c", "format": "i", "value": 9000},
+    "MAIN.cache_miss": {"description": "Cache misses", "flag": "c", "format": "i", "value": 1000},
+    "MAIN.backend_fail": {"description": "Backend conn. failures", "flag": "c", "format": "i", "value": 3},
+    "MAIN.threads_limited": {"description": "Threads hit max", "flag": "c", "format": "i", "value": 0},
+    "MAIN.n_lru_nuked": {"description": "Number of LRU nuked objects", "flag": "g", "format": "i", "value": 42}
+  }
+}`
+
+func TestParseCounters(t *testing.T) {
+	want := &counters{Uptime: 86400, BackendFail: 3, ThreadsLimited: 0, LRUNuked: 42, CacheHit: 9000, CacheMiss: 1000}
+	for _, out := range []string{statsV60, statsV65} {
+		c, err := parseCounters([]byte(out))
+		assert.Nil(t, err)
+		assert.Equal(t, want, c)
+	}
+
+	_, err := parseCounters([]byte(`{"version": 1, "counters": {"MAIN.uptime": {"value": 1}}}`))
+	assert.NotNil(t, err)
+	_, err = parseCounters([]byte("Could not get hold of varnishd"))
+	assert.NotNil(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	cur := &counters{Uptime: 86400, BackendFail: 3, ThreadsLimited: 0, LRUNuked: 42, CacheHit: 9000, CacheMiss: 1000}
+	i := func(v int64) *int64 { return &v }
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		opts varnishOpts
+		last *counters
+		want checkers.Status
+		msg  string
+	}{
+		{
+			opts: varnishOpts{MinRequests: 100},
+			want: checkers.OK,
+			msg:  "cache hit ratio 90.0%",
+		},
+		{
+			opts: varnishOpts{MinRequests: 100, Perfdata: true, WarningHitRatio: f(80), CriticalHitRatio: f(50)},
+			last: &counters{Uptime: 86100, BackendFail: 3, LRUNuked: 42, CacheHit: 8900, CacheMiss: 900},
+			want: checkers.WARNING,
+			msg:  "cache hit ratio 50.0% < 80% | hit_ratio=50.0%;80;50 backend_fail=3c;; threads_limited=0c;; n_lru_nuked=42c;;",
+		},
+		{
+			opts: varnishOpts{MinRequests: 1000, WarningHitRatio: f(80)},
+			last: &counters{Uptime: 86100, BackendFail: 3, LRUNuked: 42, CacheHit: 8900, CacheMiss: 900},
+			want: checkers.OK,
+			msg:  "too few requests to check the cache hit ratio (200)",
+		},
+		{
+			opts: varnishOpts{MinRequests: 100, CriticalBackendFail: i(2), WarningLRUNuked: i(10)},
+			last: &counters{Uptime: 86100, BackendFail: 0, LRUNuked: 2, CacheHit: 8000, CacheMiss: 900},
+			want: checkers.CRITICAL,
+			msg:  "backend_fail increased by 3 > 2, n_lru_nuked increased by 40 > 10",
+		},
+		{
+			// restarted
+			opts: varnishOpts{MinRequests: 100},
+			last: &counters{Uptime: 90000, BackendFail: 0, CacheHit: 100000, CacheMiss: 100},
+			want: checkers.OK,
+			msg:  "cache hit ratio 90.0%",
+		},
+	}
+	for _, tt := range tests {
+		ckr := tt.opts.evaluate(cur, tt.last)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+		assert.Equal(t, tt.msg, ckr.Message)
+	}
+}
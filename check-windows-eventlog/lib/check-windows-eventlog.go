@@ -22,7 +22,8 @@ import (
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
 	"github.com/mackerelio/go-check-plugins/check-windows-eventlog/lib/internal/eventlog"
-	"github.com/mackerelio/golib/pluginutil"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+	"github.com/mackerelio/go-check-plugins/internal/state"
 	"github.com/natefinch/atomic"
 )
 
@@ -41,23 +42,28 @@ type idRange struct {
 }
 
 type logOpts struct {
-	Log            string `long:"log" description:"Event Names (comma separated)"`
-	Type           string `long:"type" description:"Event Types (comma separated)"`
-	SourcePattern  string `long:"source-pattern" description:"Event Source (regexp pattern)"`
-	SourceExclude  string `long:"source-exclude" description:"Event Source excluded (regexp pattern)"`
-	MessagePattern string `long:"message-pattern" description:"Message Pattern (regexp pattern)"`
-	MessageExclude string `long:"message-exclude" description:"Message Pattern excluded (regexp pattern)"`
-	EventIDPattern string `long:"event-id-pattern" description:"Event IDs acceptable (separated by comma, or range)"`
-	EventIDExclude string `long:"event-id-exclude" description:"Event IDs ignorable (separated by comma, or range)"`
-	WarnOver       int64  `short:"w" long:"warning-over" description:"Trigger a warning if matched lines is over a number"`
-	CritOver       int64  `short:"c" long:"critical-over" description:"Trigger a critical if matched lines is over a number"`
-	ReturnContent  bool   `short:"r" long:"return" description:"Return matched line"`
-	StateDir       string `short:"s" long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
-	NoState        bool   `long:"no-state" description:"Don't use state file and read whole logs"`
-	FailFirst      bool   `long:"fail-first" description:"Count errors on first seek"`
-	Verbose        bool   `long:"verbose" description:"Verbose output"`
+	Log            string        `long:"log" description:"Event Names (comma separated)"`
+	Channel        string        `long:"channel" description:"Event channels read with the Windows Event Log API, such as Microsoft-Windows-TaskScheduler/Operational (comma separated)"`
+	XPath          string        `long:"xpath" default:"*" description:"XPath query to filter events of --channel (e.g. *[System[(Level=1 or Level=2)]])"`
+	Window         time.Duration `long:"window" description:"Check events of --channel in the time window (e.g. 1h) instead of events since the last check"`
+	Type           string        `long:"type" description:"Event Types (comma separated)"`
+	SourcePattern  string        `long:"source-pattern" description:"Event Source (regexp pattern)"`
+	SourceExclude  string        `long:"source-exclude" description:"Event Source excluded (regexp pattern)"`
+	MessagePattern string        `long:"message-pattern" description:"Message Pattern (regexp pattern)"`
+	MessageExclude string        `long:"message-exclude" description:"Message Pattern excluded (regexp pattern)"`
+	EventIDPattern string        `long:"event-id-pattern" description:"Event IDs acceptable (separated by comma, or range)"`
+	EventIDExclude string        `long:"event-id-exclude" description:"Event IDs ignorable (separated by comma, or range)"`
+	WarnOver       int64         `short:"w" long:"warning-over" description:"Trigger a warning if matched lines is over a number"`
+	CritOver       int64         `short:"c" long:"critical-over" description:"Trigger a critical if matched lines is over a number"`
+	ReturnContent  bool          `short:"r" long:"return" description:"Return matched line"`
+	StateDir       string        `short:"s" long:"state-dir" value-name:"DIR" description:"Dir to keep state files under"`
+	NoState        bool          `long:"no-state" description:"Don't use state file and read whole logs"`
+	FailFirst      bool          `long:"fail-first" description:"Count errors on first seek"`
+	Verbose        bool          `long:"verbose" description:"Verbose output"`
+	selftest.SelfTestOpts
 
 	logList        []string
+	channelList    []string
 	typeList       []string
 	eventIDPattern []idRange
 	eventIDExclude []idRange
@@ -109,8 +115,12 @@ func idRangeList(s string) ([]idRange, error) {
 }
 
 func (opts *logOpts) prepare() error {
+	if opts.Log != "" && opts.Channel != "" {
+		return fmt.Errorf("--log and --channel can't be specified at the same time")
+	}
+	opts.channelList = stringList(opts.Channel)
 	opts.logList = stringList(opts.Log)
-	if len(opts.logList) == 0 || opts.logList[0] == "" {
+	if len(opts.logList) == 0 && len(opts.channelList) == 0 {
 		opts.logList = []string{"Application"}
 	}
 	opts.typeList = stringList(opts.Type)
@@ -168,10 +178,7 @@ func parseArgs(args []string) (*logOpts, error) {
 	copy(origArgs, args)
 	opts := &logOpts{}
 	_, err := flags.ParseArgs(opts, args)
-	if opts.StateDir == "" {
-		workdir := pluginutil.PluginWorkDir()
-		opts.StateDir = filepath.Join(workdir, "check-windows-eventlog")
-	}
+	opts.StateDir = state.Dir(opts.StateDir, "check-windows-eventlog")
 	opts.origArgs = origArgs
 	return opts, err
 }
@@ -179,13 +186,16 @@ func parseArgs(args []string) (*logOpts, error) {
 func run(args []string) *checkers.Checker {
 	opts, err := parseArgs(args)
 	if err != nil {
-		os.Exit(1)
+		return checkers.Unknown(err.Error())
 	}
 
 	err = opts.prepare()
 	if err != nil {
 		return checkers.Unknown(err.Error())
 	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
 
 	checkSt := checkers.OK
 	warnNum := int64(0)
@@ -203,6 +213,17 @@ func run(args []string) *checkers.Checker {
 			errorOverall += errLines
 		}
 	}
+	for _, ch := range opts.channelList {
+		w, c, errLines, err := opts.searchChannel(ch)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		warnNum += w
+		critNum += c
+		if opts.ReturnContent {
+			errorOverall += errLines
+		}
+	}
 	msg := fmt.Sprintf("%d warnings, %d criticals.", warnNum, critNum)
 	if errorOverall != "" {
 		msg += "\n" + errorOverall
@@ -289,19 +310,19 @@ func (opts *logOpts) searchLog(logName string) (warnNum, critNum int64, errLines
 	ptr := syscall.StringToUTF16Ptr(logName)
 	h, err := eventlog.OpenEventLog(nil, ptr)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, "", err
 	}
 	defer eventlog.CloseEventLog(h)
 
 	var num, oldnum, lastNumber uint32
 
-	eventlog.GetNumberOfEventLogRecords(h, &num)
+	err = eventlog.GetNumberOfEventLogRecords(h, &num)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, "", err
 	}
-	eventlog.GetOldestEventLogRecord(h, &oldnum)
+	err = eventlog.GetOldestEventLogRecord(h, &oldnum)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, "", err
 	}
 
 	if recordNumber == 0 {
@@ -501,6 +522,8 @@ loop_events:
 
 var stateRe = regexp.MustCompile(`^([A-Z]):[/\\]`)
 
+// getStateFile returns the state file of the log. The state is the record number or the bookmark
+// as plain text rather than JSON, so the file is kept without the suffix of internal/state.
 func (opts *logOpts) getStateFile(logName string) string {
 	return filepath.Join(
 		opts.StateDir,
@@ -0,0 +1,403 @@
+// +build windows
+
+package checkwindowseventlog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/mackerelio/go-check-plugins/check-windows-eventlog/lib/internal/eventlog"
+	"github.com/natefinch/atomic"
+)
+
+// Keywords of audit events in the System/Keywords element.
+const (
+	keywordAuditFailure = 0x10000000000000
+	keywordAuditSuccess = 0x20000000000000
+)
+
+// channelEvent is the part of the XML representation of an event which is used by the plugin.
+type channelEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     uint32 `xml:"EventID"`
+		Level       uint8  `xml:"Level"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime time.Time `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint64 `xml:"EventRecordID"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+}
+
+func parseChannelEvent(s string) (*channelEvent, error) {
+	var ev channelEvent
+	if err := xml.Unmarshal([]byte(s), &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// typeName returns the name of the event type which is compatible with the classic event log.
+func (ev *channelEvent) typeName() string {
+	keywords, _ := strconv.ParseUint(strings.TrimPrefix(ev.System.Keywords, "0x"), 16, 64)
+	switch {
+	case keywords&keywordAuditFailure != 0:
+		return "AuditFailure"
+	case keywords&keywordAuditSuccess != 0:
+		return "AuditSuccess"
+	}
+	switch ev.System.Level {
+	case 1:
+		return "Critical"
+	case 2:
+		return "Error"
+	case 3:
+		return "Warning"
+	default:
+		return "Information"
+	}
+}
+
+// dataMessage returns the values of the event data, which is shown when the message can't be formatted
+// because the publisher of the event isn't installed on the host.
+func (ev *channelEvent) dataMessage() string {
+	var values []string
+	for _, d := range ev.EventData.Data {
+		v := strings.TrimSpace(d.Value)
+		if d.Name != "" {
+			v = d.Name + "=" + v
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("EventID %d: %s", ev.System.EventID, strings.Join(values, ", "))
+}
+
+func utf16BufToString(buf []uint16) string {
+	for i, c := range buf {
+		if c == 0 {
+			buf = buf[:i]
+			break
+		}
+	}
+	return string(utf16.Decode(buf))
+}
+
+// renderXML renders the event or the bookmark with flags as XML.
+func renderXML(h syscall.Handle, flags uint32) (string, error) {
+	var used, count uint32
+	err := eventlog.EvtRender(0, h, flags, 0, nil, &used, &count)
+	if err != nil && err != syscall.ERROR_INSUFFICIENT_BUFFER {
+		return "", err
+	}
+	buf := make([]uint16, used/2+1)
+	err = eventlog.EvtRender(0, h, flags, uint32(len(buf)*2), (*byte)(unsafe.Pointer(&buf[0])), &used, &count)
+	if err != nil {
+		return "", err
+	}
+	return utf16BufToString(buf), nil
+}
+
+func formatEventMessage(provider string, h syscall.Handle) (string, error) {
+	pub, err := eventlog.EvtOpenPublisherMetadata(0, syscall.StringToUTF16Ptr(provider), nil, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	defer eventlog.EvtClose(pub)
+
+	var used uint32
+	err = eventlog.EvtFormatMessage(pub, h, 0, 0, 0, eventlog.EvtFormatMessageEvent, 0, nil, &used)
+	if err != nil && err != syscall.ERROR_INSUFFICIENT_BUFFER {
+		return "", err
+	}
+	buf := make([]uint16, used+1)
+	err = eventlog.EvtFormatMessage(pub, h, 0, 0, 0, eventlog.EvtFormatMessageEvent, uint32(len(buf)), &buf[0], &used)
+	if err != nil {
+		return "", err
+	}
+	message := strings.Replace(utf16BufToString(buf), "\r", "", -1)
+	return strings.TrimSuffix(message, "\n"), nil
+}
+
+// queryChannel calls fn for each event matched with the query in the direction of flags until fn returns false.
+// If bookmark is given, the events after the bookmarked one are queried.
+func queryChannel(channel, query string, flags uint32, bookmark syscall.Handle, fn func(h syscall.Handle, ev *channelEvent) (bool, error)) error {
+	rs, err := eventlog.EvtQuery(0, syscall.StringToUTF16Ptr(channel), syscall.StringToUTF16Ptr(query),
+		eventlog.EvtQueryChannelPath|flags)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %s", channel, err)
+	}
+	defer eventlog.EvtClose(rs)
+	if bookmark != 0 {
+		// without EvtSeekStrict, it seeks to the event next to the position of the bookmarked event
+		// even if the event has been purged or the channel has been cleared.
+		if err := eventlog.EvtSeek(rs, 1, bookmark, 0, eventlog.EvtSeekRelativeToBookmark); err != nil {
+			return fmt.Errorf("failed to seek %s to the bookmark: %s", channel, err)
+		}
+	}
+
+	events := make([]syscall.Handle, 64)
+	for {
+		var returned uint32
+		err := eventlog.EvtNext(rs, uint32(len(events)), &events[0], 0xFFFFFFFF, 0, &returned)
+		if err != nil {
+			if err == eventlog.ERROR_NO_MORE_ITEMS {
+				return nil
+			}
+			return err
+		}
+		cont := true
+		for _, h := range events[:returned] {
+			if cont {
+				var s string
+				s, err = renderXML(h, eventlog.EvtRenderEventXml)
+				if err == nil {
+					var ev *channelEvent
+					ev, err = parseChannelEvent(s)
+					if err == nil {
+						cont, err = fn(h, ev)
+					}
+				}
+				if err != nil {
+					cont = false
+				}
+			}
+			eventlog.EvtClose(h)
+		}
+		if err != nil {
+			return err
+		}
+		if !cont {
+			return nil
+		}
+	}
+}
+
+// latestBookmark returns the bookmark of the newest event matched with the query.
+// The bookmark has no events if no events are matched.
+func latestBookmark(channel, query string) (string, error) {
+	bookmark, err := eventlog.EvtCreateBookmark(nil)
+	if err != nil {
+		return "", err
+	}
+	defer eventlog.EvtClose(bookmark)
+	err = queryChannel(channel, query, eventlog.EvtQueryReverseDirection, 0, func(h syscall.Handle, ev *channelEvent) (bool, error) {
+		return false, eventlog.EvtUpdateBookmark(bookmark, h)
+	})
+	if err != nil {
+		return "", err
+	}
+	return renderXML(bookmark, eventlog.EvtRenderBookmark)
+}
+
+// parseChannelState parses the state file of the channel. It's the XML of the bookmark,
+// or the record ID of the last event checked, which was written by the former versions.
+func parseChannelState(s string) (bookmarkXML string, lastID uint64, err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "<") {
+		return s, 0, nil
+	}
+	lastID, err = strconv.ParseUint(s, 10, 64)
+	return "", lastID, err
+}
+
+// hasBookmark reports whether the XML of the bookmark has the position of an event.
+func hasBookmark(bookmarkXML string) bool {
+	return strings.Contains(bookmarkXML, "<Bookmark ")
+}
+
+func (opts *logOpts) matchEvent(ev *channelEvent, tn string) bool {
+	eventID := ev.System.EventID
+	if len(opts.eventIDPattern) > 0 {
+		accepted := false
+		for _, idr := range opts.eventIDPattern {
+			if idr.lo <= eventID && eventID <= idr.hi {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return false
+		}
+	}
+	for _, idr := range opts.eventIDExclude {
+		if idr.lo <= eventID && eventID <= idr.hi {
+			return false
+		}
+	}
+	if len(opts.typeList) > 0 {
+		found := false
+		for _, typ := range opts.typeList {
+			if strings.Replace(typ, " ", "", -1) == tn {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.sourcePattern != nil && !opts.sourcePattern.MatchString(ev.System.Provider.Name) {
+		return false
+	}
+	if opts.sourceExclude != nil && opts.sourceExclude.MatchString(ev.System.Provider.Name) {
+		return false
+	}
+	return true
+}
+
+// searchChannel searches events in the channel with the Windows Event Log API.
+// It checks events since the last check, or events in the time window when --window is given.
+// The position of the last event checked is kept as a bookmark in the state file.
+func (opts *logOpts) searchChannel(channel string) (warnNum, critNum int64, errLines string, err error) {
+	useState := !opts.NoState && opts.Window == 0
+	stateFile := opts.getStateFile(channel)
+
+	var bookmarkXML string
+	var lastID uint64
+	if useState {
+		b, err := ioutil.ReadFile(stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, 0, "", err
+		}
+		if os.IsNotExist(err) && !opts.FailFirst {
+			bookmarkXML, err := latestBookmark(channel, opts.XPath)
+			if err != nil {
+				return 0, 0, "", err
+			}
+			return 0, 0, "", writeChannelState(stateFile, bookmarkXML)
+		}
+		if err == nil {
+			bookmarkXML, lastID, err = parseChannelState(string(b))
+			if err != nil {
+				return 0, 0, "", err
+			}
+		}
+	}
+
+	flags := eventlog.EvtQueryReverseDirection
+	var bookmark syscall.Handle
+	if useState {
+		// events are read from the oldest one after the bookmark, which is updated with every event read.
+		flags = eventlog.EvtQueryForwardDirection
+		var p *uint16
+		if hasBookmark(bookmarkXML) {
+			p = syscall.StringToUTF16Ptr(bookmarkXML)
+		}
+		bookmark, err = eventlog.EvtCreateBookmark(p)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		defer eventlog.EvtClose(bookmark)
+	}
+	seek := syscall.Handle(0)
+	if hasBookmark(bookmarkXML) {
+		seek = bookmark
+	}
+	since := time.Now().Add(-opts.Window)
+
+	var lines []string
+	err = queryChannel(channel, opts.XPath, flags, seek, func(h syscall.Handle, ev *channelEvent) (bool, error) {
+		if useState {
+			if err := eventlog.EvtUpdateBookmark(bookmark, h); err != nil {
+				return false, err
+			}
+			// the events checked before the bookmark was introduced
+			if ev.System.EventRecordID <= lastID {
+				return true, nil
+			}
+		}
+		if opts.Window > 0 && ev.System.TimeCreated.SystemTime.Before(since) {
+			return false, nil
+		}
+		tn := ev.typeName()
+		if opts.Verbose {
+			log.Printf("EventRecordID=%v", ev.System.EventRecordID)
+			log.Printf("TimeCreated=%v", ev.System.TimeCreated.SystemTime)
+			log.Printf("EventID=%v", ev.System.EventID)
+			log.Printf("EventType=%v", tn)
+			log.Printf("Provider=%v", ev.System.Provider.Name)
+		}
+		if !opts.matchEvent(ev, tn) {
+			return true, nil
+		}
+
+		if opts.messagePattern != nil || opts.messageExclude != nil || opts.ReturnContent {
+			message, err := formatEventMessage(ev.System.Provider.Name, h)
+			if err != nil || message == "" {
+				message = ev.dataMessage()
+			}
+			if opts.Verbose {
+				log.Printf("Message=%v", message)
+			}
+			if opts.messagePattern != nil && !opts.messagePattern.MatchString(message) {
+				return true, nil
+			}
+			if opts.messageExclude != nil && opts.messageExclude.MatchString(message) {
+				return true, nil
+			}
+			if opts.ReturnContent {
+				if message == "" {
+					message = "Because the message resource could not be found, the event log message could not be obtained. Please access the target server and check the event log directly."
+				}
+				lines = append(lines, ev.System.Provider.Name+":"+strings.Replace(message, "\n", "", -1)+"\n")
+			}
+		}
+
+		switch tn {
+		case "Critical", "Error", "AuditFailure":
+			critNum++
+		case "Warning":
+			warnNum++
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if useState {
+		bookmarkXML, err := renderXML(bookmark, eventlog.EvtRenderBookmark)
+		if err == nil {
+			err = writeChannelState(stateFile, bookmarkXML)
+		}
+		if err != nil {
+			log.Printf("writeChannelState failed: %s\n", err.Error())
+		}
+	}
+	// events are collected from the newest one without the state, so they are reversed on output
+	if !useState {
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+	}
+	return warnNum, critNum, strings.Join(lines, ""), nil
+}
+
+func writeChannelState(f, bookmarkXML string) error {
+	err := os.MkdirAll(filepath.Dir(f), 0755)
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(f, strings.NewReader(bookmarkXML))
+}
@@ -414,3 +414,48 @@ func TestFailFirst(t *testing.T) {
 	}
 	testFailFirst()
 }
+
+func TestParseChannelEvent(t *testing.T) {
+	s := `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='Service Control Manager' Guid='{555908d1-a6d7-4695-8e1e-26931d2012f4}' EventSourceName='Service Control Manager'/><EventID Qualifiers='49152'>7031</EventID><Version>0</Version><Level>2</Level><Task>0</Task><Opcode>0</Opcode><Keywords>0x8080000000000000</Keywords><TimeCreated SystemTime='2020-01-02T03:04:05.678901200Z'/><EventRecordID>12345</EventRecordID><Channel>System</Channel></System></Event>`
+	ev, err := parseChannelEvent(s)
+	assert.Nil(t, err)
+	assert.Equal(t, "Service Control Manager", ev.System.Provider.Name)
+	assert.Equal(t, uint32(7031), ev.System.EventID)
+	assert.Equal(t, uint64(12345), ev.System.EventRecordID)
+	assert.Equal(t, 2020, ev.System.TimeCreated.SystemTime.Year())
+	assert.Equal(t, "Error", ev.typeName())
+
+	ev.System.Level = 1
+	assert.Equal(t, "Critical", ev.typeName())
+	ev.System.Level = 0
+	ev.System.Keywords = "0x8010000000000000"
+	assert.Equal(t, "AuditFailure", ev.typeName())
+	assert.Equal(t, "", ev.dataMessage())
+
+	s = `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='MyApp'/><EventID>1000</EventID><Level>2</Level><EventRecordID>12346</EventRecordID></System><EventData><Data Name='Path'>C:\app\app.exe</Data><Data Name='Code'>0xc0000005</Data><Data>disk full </Data></EventData></Event>`
+	ev, err = parseChannelEvent(s)
+	assert.Nil(t, err)
+	assert.Equal(t, `EventID 1000: Path=C:\app\app.exe, Code=0xc0000005, disk full`, ev.dataMessage())
+}
+
+func TestParseChannelState(t *testing.T) {
+	bookmarkXML, lastID, err := parseChannelState("<BookmarkList>\r\n  <Bookmark Channel='System' RecordId='12345' IsCurrent='true'/>\r\n</BookmarkList>\r\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "<BookmarkList>\r\n  <Bookmark Channel='System' RecordId='12345' IsCurrent='true'/>\r\n</BookmarkList>", bookmarkXML)
+	assert.Equal(t, uint64(0), lastID)
+	assert.True(t, hasBookmark(bookmarkXML))
+
+	// the bookmark of the channel which had no events
+	bookmarkXML, _, err = parseChannelState("<BookmarkList>\r\n</BookmarkList>")
+	assert.Nil(t, err)
+	assert.False(t, hasBookmark(bookmarkXML))
+
+	// the state written by the former versions
+	bookmarkXML, lastID, err = parseChannelState("12345")
+	assert.Nil(t, err)
+	assert.Equal(t, "", bookmarkXML)
+	assert.Equal(t, uint64(12345), lastID)
+
+	_, _, err = parseChannelState("foo")
+	assert.NotNil(t, err)
+}
@@ -2,10 +2,23 @@
 
 package eventlog
 
+import (
+	"syscall"
+	"unsafe"
+)
+
 //go:generate go run $GOROOT/src/syscall/mksyscall_windows.go -output zsyscall_windows.go syscall_windows.go
 
 //sys   ClearEventLog(eventLog syscall.Handle, backupFileName *uint16) (err error) = advapi32.ClearEventLogW
 //sys   CloseEventLog(eventLog syscall.Handle) (err error) = advapi32.CloseEventLog
+//sys   EvtClose(object syscall.Handle) (err error) = wevtapi.EvtClose
+//sys   EvtCreateBookmark(bookmarkXML *uint16) (handle syscall.Handle, err error) = wevtapi.EvtCreateBookmark
+//sys   EvtFormatMessage(publisherMetadata syscall.Handle, event syscall.Handle, messageID uint32, valueCount uint32, values uintptr, flags uint32, bufferSize uint32, buffer *uint16, bufferUsed *uint32) (err error) = wevtapi.EvtFormatMessage
+//sys   EvtNext(resultSet syscall.Handle, eventsSize uint32, events *syscall.Handle, timeout uint32, flags uint32, returned *uint32) (err error) = wevtapi.EvtNext
+//sys   EvtOpenPublisherMetadata(session syscall.Handle, publisherID *uint16, logFilePath *uint16, locale uint32, flags uint32) (handle syscall.Handle, err error) = wevtapi.EvtOpenPublisherMetadata
+//sys   EvtQuery(session syscall.Handle, path *uint16, query *uint16, flags uint32) (handle syscall.Handle, err error) = wevtapi.EvtQuery
+//sys   EvtRender(context syscall.Handle, fragment syscall.Handle, flags uint32, bufferSize uint32, buffer *byte, bufferUsed *uint32, propertyCount *uint32) (err error) = wevtapi.EvtRender
+//sys   EvtUpdateBookmark(bookmark syscall.Handle, event syscall.Handle) (err error) = wevtapi.EvtUpdateBookmark
 //sys   FormatMessage(flags uint32, source syscall.Handle, messageID uint32, languageID uint32, buffer *byte, bufferSize uint32, arguments uintptr) (numChars uint32, err error) = kernel32.FormatMessageW
 //sys   GetNumberOfEventLogRecords(eventLog syscall.Handle, numberOfRecords *uint32) (err error) = advapi32.GetNumberOfEventLogRecords
 //sys   GetOldestEventLogRecord(eventLog syscall.Handle, oldestRecord *uint32) (err error) = advapi32.GetOldestEventLogRecord
@@ -126,3 +139,47 @@ const (
 	LOAD_LIBRARY_SEARCH_SYSTEM32        uint32 = 0x0800
 	LOAD_LIBRARY_SEARCH_DEFAULT_DIRS    uint32 = 0x1000
 )
+
+// Flags of the Windows Event Log API (wevtapi.dll)
+const (
+	EvtQueryChannelPath      uint32 = 0x1
+	EvtQueryFilePath         uint32 = 0x2
+	EvtQueryForwardDirection uint32 = 0x100
+	EvtQueryReverseDirection uint32 = 0x200
+
+	EvtRenderEventValues uint32 = 0
+	EvtRenderEventXml    uint32 = 1
+	EvtRenderBookmark    uint32 = 2
+
+	EvtFormatMessageEvent uint32 = 1
+
+	EvtSeekRelativeToFirst    uint32 = 1
+	EvtSeekRelativeToLast     uint32 = 2
+	EvtSeekRelativeToCurrent  uint32 = 3
+	EvtSeekRelativeToBookmark uint32 = 4
+	EvtSeekStrict             uint32 = 0x10000
+
+	ERROR_NO_MORE_ITEMS syscall.Errno = 259
+)
+
+var procEvtSeek = modwevtapi.NewProc("EvtSeek")
+
+// EvtSeek is written by hand because mksyscall_windows passes the 64-bit position
+// as a single uintptr, which is truncated and shifts the following arguments on 386.
+func EvtSeek(resultSet syscall.Handle, position int64, bookmark syscall.Handle, timeout uint32, flags uint32) (err error) {
+	var r1 uintptr
+	var e1 syscall.Errno
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		r1, _, e1 = syscall.Syscall6(procEvtSeek.Addr(), 5, uintptr(resultSet), uintptr(position), uintptr(bookmark), uintptr(timeout), uintptr(flags), 0)
+	} else {
+		r1, _, e1 = syscall.Syscall6(procEvtSeek.Addr(), 6, uintptr(resultSet), uintptr(position), uintptr(position>>32), uintptr(bookmark), uintptr(timeout), uintptr(flags))
+	}
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
@@ -14,9 +14,18 @@ var _ unsafe.Pointer
 var (
 	modadvapi32 = windows.NewLazySystemDLL("advapi32.dll")
 	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	modwevtapi  = windows.NewLazySystemDLL("wevtapi.dll")
 
 	procClearEventLogW             = modadvapi32.NewProc("ClearEventLogW")
 	procCloseEventLog              = modadvapi32.NewProc("CloseEventLog")
+	procEvtClose                   = modwevtapi.NewProc("EvtClose")
+	procEvtCreateBookmark          = modwevtapi.NewProc("EvtCreateBookmark")
+	procEvtFormatMessage           = modwevtapi.NewProc("EvtFormatMessage")
+	procEvtNext                    = modwevtapi.NewProc("EvtNext")
+	procEvtOpenPublisherMetadata   = modwevtapi.NewProc("EvtOpenPublisherMetadata")
+	procEvtQuery                   = modwevtapi.NewProc("EvtQuery")
+	procEvtRender                  = modwevtapi.NewProc("EvtRender")
+	procEvtUpdateBookmark          = modwevtapi.NewProc("EvtUpdateBookmark")
 	procFormatMessageW             = modkernel32.NewProc("FormatMessageW")
 	procGetNumberOfEventLogRecords = modadvapi32.NewProc("GetNumberOfEventLogRecords")
 	procGetOldestEventLogRecord    = modadvapi32.NewProc("GetOldestEventLogRecord")
@@ -49,6 +58,105 @@ func CloseEventLog(eventLog syscall.Handle) (err error) {
 	return
 }
 
+func EvtClose(object syscall.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procEvtClose.Addr(), 1, uintptr(object), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtCreateBookmark(bookmarkXML *uint16) (handle syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procEvtCreateBookmark.Addr(), 1, uintptr(unsafe.Pointer(bookmarkXML)), 0, 0)
+	handle = syscall.Handle(r0)
+	if handle == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtFormatMessage(publisherMetadata syscall.Handle, event syscall.Handle, messageID uint32, valueCount uint32, values uintptr, flags uint32, bufferSize uint32, buffer *uint16, bufferUsed *uint32) (err error) {
+	r1, _, e1 := syscall.Syscall9(procEvtFormatMessage.Addr(), 9, uintptr(publisherMetadata), uintptr(event), uintptr(messageID), uintptr(valueCount), uintptr(values), uintptr(flags), uintptr(bufferSize), uintptr(unsafe.Pointer(buffer)), uintptr(unsafe.Pointer(bufferUsed)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtNext(resultSet syscall.Handle, eventsSize uint32, events *syscall.Handle, timeout uint32, flags uint32, returned *uint32) (err error) {
+	r1, _, e1 := syscall.Syscall6(procEvtNext.Addr(), 6, uintptr(resultSet), uintptr(eventsSize), uintptr(unsafe.Pointer(events)), uintptr(timeout), uintptr(flags), uintptr(unsafe.Pointer(returned)))
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtOpenPublisherMetadata(session syscall.Handle, publisherID *uint16, logFilePath *uint16, locale uint32, flags uint32) (handle syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procEvtOpenPublisherMetadata.Addr(), 5, uintptr(session), uintptr(unsafe.Pointer(publisherID)), uintptr(unsafe.Pointer(logFilePath)), uintptr(locale), uintptr(flags), 0)
+	handle = syscall.Handle(r0)
+	if handle == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtQuery(session syscall.Handle, path *uint16, query *uint16, flags uint32) (handle syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procEvtQuery.Addr(), 4, uintptr(session), uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(query)), uintptr(flags), 0, 0)
+	handle = syscall.Handle(r0)
+	if handle == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtRender(context syscall.Handle, fragment syscall.Handle, flags uint32, bufferSize uint32, buffer *byte, bufferUsed *uint32, propertyCount *uint32) (err error) {
+	r1, _, e1 := syscall.Syscall9(procEvtRender.Addr(), 7, uintptr(context), uintptr(fragment), uintptr(flags), uintptr(bufferSize), uintptr(unsafe.Pointer(buffer)), uintptr(unsafe.Pointer(bufferUsed)), uintptr(unsafe.Pointer(propertyCount)), 0, 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
+func EvtUpdateBookmark(bookmark syscall.Handle, event syscall.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procEvtUpdateBookmark.Addr(), 2, uintptr(bookmark), uintptr(event), 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
 func FormatMessage(flags uint32, source syscall.Handle, messageID uint32, languageID uint32, buffer *byte, bufferSize uint32, arguments uintptr) (numChars uint32, err error) {
 	r0, _, e1 := syscall.Syscall9(procFormatMessageW.Addr(), 7, uintptr(flags), uintptr(source), uintptr(messageID), uintptr(languageID), uintptr(unsafe.Pointer(buffer)), uintptr(bufferSize), uintptr(arguments), 0, 0)
 	numChars = uint32(r0)
@@ -0,0 +1,153 @@
+package checkwindowsperfcounter
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/perfdata"
+	"github.com/mackerelio/go-check-plugins/internal/selftest"
+)
+
+type perfcounterOpts struct {
+	Counters []string `short:"p" long:"counter" required:"true" value-name:"PATH" description:"Path of the performance counter such as \\Processor(_Total)\\% Processor Time (may be repeated)"`
+	Labels   []string `long:"label" description:"Label of the counter in the message (may be repeated in the order of --counter)"`
+	Warning  []string `short:"w" long:"warning" description:"warning if the value is over (may be repeated in the order of --counter)"`
+	Critical []string `short:"c" long:"critical" description:"critical if the value is over (may be repeated in the order of --counter)"`
+	LessThan bool     `long:"less-than" description:"Compare with thresholds as lower limits instead of upper limits"`
+	Interval int      `short:"i" long:"interval" default:"1" description:"Seconds between two samples to compute rate counters such as % Processor Time"`
+	selftest.SelfTestOpts
+}
+
+// counterCheck is the setting for each counter.
+// The thresholds are nil when they are not specified.
+type counterCheck struct {
+	path     string
+	label    string
+	warning  *float64
+	critical *float64
+}
+
+// Do the plugin
+func Do() {
+	ckr := run(os.Args[1:])
+	ckr.Name = "PerfCounter"
+	ckr.Exit()
+}
+
+var collectCountersFunc = collectCounters
+
+// parseThreshold returns the i-th threshold of the option which is given once for all counters, or once for each counter.
+// An empty value means that the threshold is not specified for the counter.
+func parseThreshold(name string, values []string, i, n int) (*float64, error) {
+	var s string
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		s = values[0]
+	case n:
+		s = values[i]
+	default:
+		return nil, fmt.Errorf("--%s must be specified once or as many times as --counter", name)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %s", name, s)
+	}
+	return &v, nil
+}
+
+func (opts *perfcounterOpts) counterChecks() ([]counterCheck, error) {
+	n := len(opts.Counters)
+	if len(opts.Labels) > 0 && len(opts.Labels) != n {
+		return nil, fmt.Errorf("--label must be specified as many times as --counter")
+	}
+	checks := make([]counterCheck, n)
+	for i, path := range opts.Counters {
+		c := counterCheck{path: path, label: path}
+		if len(opts.Labels) > 0 {
+			c.label = opts.Labels[i]
+		}
+		var err error
+		if c.warning, err = parseThreshold("warning", opts.Warning, i, n); err != nil {
+			return nil, err
+		}
+		if c.critical, err = parseThreshold("critical", opts.Critical, i, n); err != nil {
+			return nil, err
+		}
+		checks[i] = c
+	}
+	return checks, nil
+}
+
+func exceeds(v, threshold float64, lessThan bool) bool {
+	if lessThan {
+		return v < threshold
+	}
+	return v > threshold
+}
+
+// check compares the value with the thresholds of the counter, and returns the status and the message.
+func (c *counterCheck) check(v float64, lessThan bool) (checkers.Status, string) {
+	op := ">"
+	if lessThan {
+		op = "<"
+	}
+	if c.critical != nil && exceeds(v, *c.critical, lessThan) {
+		return checkers.CRITICAL, fmt.Sprintf("%s=%.2f %s %g", c.label, v, op, *c.critical)
+	}
+	if c.warning != nil && exceeds(v, *c.warning, lessThan) {
+		return checkers.WARNING, fmt.Sprintf("%s=%.2f %s %g", c.label, v, op, *c.warning)
+	}
+	return checkers.OK, fmt.Sprintf("%s=%.2f", c.label, v)
+}
+
+// perfdata returns the performance data of the value in the format of Nagios plugins.
+func (c *counterCheck) perfdata(v float64) string {
+	return perfdata.Format(c.label, strconv.FormatFloat(v, 'f', 2, 64), "", perfdata.OptFloat(c.warning), perfdata.OptFloat(c.critical))
+}
+
+// evaluate checks all values and returns the worst status.
+func evaluate(checks []counterCheck, values []float64, lessThan bool) *checkers.Checker {
+	checkSt := checkers.OK
+	var msgs, perfs []string
+	for i := range checks {
+		c := &checks[i]
+		st, msg := c.check(values[i], lessThan)
+		if st > checkSt {
+			checkSt = st
+		}
+		msgs = append(msgs, msg)
+		perfs = append(perfs, c.perfdata(values[i]))
+	}
+	return checkers.NewChecker(checkSt, strings.Join(msgs, ", ")+" | "+strings.Join(perfs, " "))
+}
+
+func run(args []string) *checkers.Checker {
+	opts := &perfcounterOpts{}
+	_, err := flags.ParseArgs(opts, args)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	checks, err := opts.counterChecks()
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	if opts.SelfTest {
+		return selftest.Run()
+	}
+
+	values, err := collectCountersFunc(opts.Counters, time.Duration(opts.Interval)*time.Second)
+	if err != nil {
+		return checkers.Unknown(err.Error())
+	}
+	return evaluate(checks, values, opts.LessThan)
+}
@@ -0,0 +1,12 @@
+// +build !windows
+
+package checkwindowsperfcounter
+
+import (
+	"syscall"
+	"time"
+)
+
+func collectCounters(paths []string, interval time.Duration) ([]float64, error) {
+	return nil, syscall.ENOSYS
+}
@@ -0,0 +1,89 @@
+package checkwindowsperfcounter
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterChecks(t *testing.T) {
+	opts := &perfcounterOpts{
+		Counters: []string{`\Processor(_Total)\% Processor Time`, `\Memory\Available MBytes`},
+		Labels:   []string{"cpu", "memory"},
+		Warning:  []string{"80", ""},
+		Critical: []string{"90"},
+	}
+	checks, err := opts.counterChecks()
+	assert.Nil(t, err)
+	assert.Equal(t, "memory", checks[1].label)
+	assert.Nil(t, checks[1].warning)
+	assert.Equal(t, 90.0, *checks[1].critical)
+
+	opts.Labels = []string{"cpu"}
+	_, err = opts.counterChecks()
+	assert.NotNil(t, err)
+
+	opts.Labels = nil
+	opts.Warning = []string{"80", "abc"}
+	_, err = opts.counterChecks()
+	assert.NotNil(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	opts := &perfcounterOpts{
+		Counters: []string{`\Processor(_Total)\% Processor Time`},
+		Labels:   []string{"cpu"},
+		Warning:  []string{"80"},
+		Critical: []string{"90"},
+	}
+	checks, err := opts.counterChecks()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		value    float64
+		lessThan bool
+		want     checkers.Status
+	}{
+		{value: 12.5, want: checkers.OK},
+		{value: 85, want: checkers.WARNING},
+		{value: 95, want: checkers.CRITICAL},
+		{value: 95, lessThan: true, want: checkers.OK},
+		{value: 50, lessThan: true, want: checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		ckr := evaluate(checks, []float64{tt.value}, tt.lessThan)
+		assert.Equal(t, tt.want, ckr.Status, ckr.Message)
+	}
+
+	ckr := evaluate(checks, []float64{85}, false)
+	assert.Equal(t, "cpu=85.00 > 80 | cpu=85.00;80;90", ckr.Message)
+}
+
+func TestRun(t *testing.T) {
+	defer func() { collectCountersFunc = collectCounters }()
+	collectCountersFunc = func(paths []string, interval time.Duration) ([]float64, error) {
+		assert.Equal(t, 2*time.Second, interval)
+		return []float64{2048}, nil
+	}
+	ckr := run([]string{"-p", `\Memory\Available MBytes`, "-w", "1024", "-c", "512", "--less-than", "-i", "2"})
+	assert.Equal(t, checkers.OK, ckr.Status, ckr.Message)
+}
+
+func TestCollectCounters(t *testing.T) {
+	values, err := collectCounters([]string{`\Processor(_Total)\% Processor Time`}, time.Second)
+	if runtime.GOOS != "windows" {
+		if err != syscall.ENOSYS {
+			t.Fatal(runtime.GOOS + " should fail because it's not Windows")
+		}
+		t.Skip(runtime.GOOS + " doesn't implement performance counters")
+	}
+	assert.Nil(t, err)
+	assert.Len(t, values, 1)
+
+	_, err = collectCounters([]string{`\No Such Object\No Such Counter`}, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,97 @@
+// +build windows
+
+package checkwindowsperfcounter
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modpdh = windows.NewLazySystemDLL("pdh.dll")
+
+	procPdhOpenQueryW               = modpdh.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounterW       = modpdh.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData         = modpdh.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterValue = modpdh.NewProc("PdhGetFormattedCounterValue")
+	procPdhCloseQuery               = modpdh.NewProc("PdhCloseQuery")
+)
+
+const (
+	pdhFmtDouble   = 0x00000200
+	pdhFmtNoCap100 = 0x00008000
+
+	pdhCstatusValidData = 0x00000000
+	pdhCstatusNewData   = 0x00000001
+)
+
+// pdhErrors are messages of PDH status codes which are likely to be caused by the arguments.
+var pdhErrors = map[uintptr]string{
+	0xC0000BB8: "the object is not found",
+	0xC0000BB9: "the counter is not found",
+	0xC0000BC0: "the counter path is invalid",
+	0xC0000BC6: "the counter has no valid data",
+	0x800007D1: "the instance is not found",
+}
+
+// pdhFmtCounterValue is PDH_FMT_COUNTERVALUE with the double value.
+type pdhFmtCounterValue struct {
+	CStatus     uint32
+	_           uint32
+	DoubleValue float64
+}
+
+func pdhError(name string, r uintptr) error {
+	if msg, ok := pdhErrors[r]; ok {
+		return fmt.Errorf("%s: %s (0x%08X)", name, msg, r)
+	}
+	return fmt.Errorf("%s failed with 0x%08X", name, r)
+}
+
+// collectCounters collects the counters twice with the interval, because rate counters
+// such as "% Processor Time" need two samples to compute the values.
+func collectCounters(paths []string, interval time.Duration) ([]float64, error) {
+	var query windows.Handle
+	if r, _, _ := procPdhOpenQueryW.Call(0, 0, uintptr(unsafe.Pointer(&query))); r != 0 {
+		return nil, pdhError("PdhOpenQuery", r)
+	}
+	defer procPdhCloseQuery.Call(uintptr(query))
+
+	counters := make([]windows.Handle, len(paths))
+	for i, path := range paths {
+		p, err := syscall.UTF16PtrFromString(path)
+		if err != nil {
+			return nil, err
+		}
+		r, _, _ := procPdhAddEnglishCounterW.Call(uintptr(query), uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&counters[i])))
+		if r != 0 {
+			return nil, pdhError(path, r)
+		}
+	}
+
+	if r, _, _ := procPdhCollectQueryData.Call(uintptr(query)); r != 0 {
+		return nil, pdhError("PdhCollectQueryData", r)
+	}
+	time.Sleep(interval)
+	if r, _, _ := procPdhCollectQueryData.Call(uintptr(query)); r != 0 {
+		return nil, pdhError("PdhCollectQueryData", r)
+	}
+
+	values := make([]float64, len(paths))
+	for i, counter := range counters {
+		var v pdhFmtCounterValue
+		r, _, _ := procPdhGetFormattedCounterValue.Call(uintptr(counter), pdhFmtDouble|pdhFmtNoCap100, 0, uintptr(unsafe.Pointer(&v)))
+		if r != 0 {
+			return nil, pdhError(paths[i], r)
+		}
+		if v.CStatus != pdhCstatusValidData && v.CStatus != pdhCstatusNewData {
+			return nil, pdhError(paths[i], uintptr(v.CStatus))
+		}
+		values[i] = v.DoubleValue
+	}
+	return values, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+)
+
+// daemonOpts is the options of the daemon mode, which are handled by mackerel-check rather than the plugins.
+type daemonOpts struct {
+	interval     time.Duration
+	listen       string
+	promTextfile string
+	// exitCodeScheme maps the exit status in /status
+	exitCodeScheme string
+}
+
+// extractDaemonOpts removes --daemon, --interval and --listen from args.
+func extractDaemonOpts(args []string) (*daemonOpts, []string, error) {
+	_, args, ok := extractFlag(args, "--daemon", false)
+	if !ok {
+		return nil, args, nil
+	}
+	opts := &daemonOpts{interval: time.Minute}
+	if v, rest, ok := extractFlag(args, "--interval", true); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --interval: %s", err)
+		}
+		if d < time.Second {
+			return nil, nil, fmt.Errorf("--interval must be 1s or more")
+		}
+		opts.interval, args = d, rest
+	}
+	v, args, ok := extractFlag(args, "--listen", true)
+	if !ok {
+		return nil, nil, fmt.Errorf("--listen is required with --daemon")
+	}
+	opts.listen = v
+	opts.promTextfile, args, _ = extractPromTextfile(args)
+	return opts, args, nil
+}
+
+// checkResult is the latest result of the check in the daemon mode.
+type checkResult struct {
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration_seconds"`
+}
+
+type daemon struct {
+	plug string
+	args []string
+	opts *daemonOpts
+	// exec runs the plugin once; it is replaced in tests
+	exec func(ctx context.Context) (string, int, error)
+	// busy is full while the plugin is running
+	busy chan struct{}
+
+	mu     sync.RWMutex
+	result *checkResult
+}
+
+// newDaemon returns the daemon which runs the plugin in-process.
+func newDaemon(plug string, args []string, opts *daemonOpts) *daemon {
+	d := &daemon{plug: plug, args: args, opts: opts, busy: make(chan struct{}, 1)}
+	d.exec = func(ctx context.Context) (string, int, error) {
+		return d.runPlugin(ctx, runners[plug])
+	}
+	return d
+}
+
+var errStillRunning = errors.New("the previous check is still running")
+
+// runPlugin runs the plugin in a goroutine and returns the output and the exit status as the plugin would exit with.
+// It returns ctx.Err() without waiting for the plugin if ctx is done first, because a running plugin can't be stopped.
+// It doesn't start the plugin while the previous one is running, as the plugins share the state of the process such as the debug logs.
+func (d *daemon) runPlugin(ctx context.Context, run func([]string) *checkers.Checker) (string, int, error) {
+	select {
+	case d.busy <- struct{}{}:
+	default:
+		return "", 0, errStillRunning
+	}
+	done := make(chan *checkers.Checker, 1)
+	go func() {
+		var ckr *checkers.Checker
+		defer func() {
+			if err := recover(); err != nil {
+				ckr = checkers.Unknown(fmt.Sprintf("panic: %v", err))
+				ckr.Name = d.plug
+			}
+			<-d.busy
+			done <- ckr
+		}()
+		debuglog.Reset()
+		ckr = run(d.args)
+	}()
+	select {
+	case ckr := <-done:
+		return ckr.String() + "\n", int(ckr.Status), nil
+	case <-ctx.Done():
+		return "", 0, ctx.Err()
+	}
+}
+
+// runOnce runs the check and keeps the result. The check is abandoned if it takes longer than the interval.
+func (d *daemon) runOnce(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.interval)
+	defer cancel()
+	start := time.Now()
+	out, code, err := d.exec(ctx)
+	if err == context.Canceled {
+		// the daemon is stopping
+		return
+	}
+	r := &checkResult{ExitCode: mapExitCode(d.opts.exitCodeScheme, out, code), Output: out, Time: start, Duration: time.Since(start).Seconds()}
+	if err != nil {
+		r.Status, r.ExitCode = "UNKNOWN", 3
+		r.Output = fmt.Sprintf("%s UNKNOWN: failed to run the check: %s\n", d.plug, err)
+		if err == context.DeadlineExceeded {
+			r.Output = fmt.Sprintf("%s UNKNOWN: the check timed out after %s\n", d.plug, d.opts.interval)
+		}
+	} else if m := resultRe.FindStringSubmatch(out); m != nil {
+		r.Status = m[1]
+	} else {
+		r.Status = "UNKNOWN"
+	}
+
+	d.mu.Lock()
+	d.result = r
+	d.mu.Unlock()
+	if d.opts.promTextfile != "" {
+		if err := writePromTextfile(d.opts.promTextfile, d.plug, r.Output, r.Time); err != nil {
+			log.Printf("%s: %s", promTextfileFlag, err)
+		}
+	}
+}
+
+func (d *daemon) latest() *checkResult {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.result
+}
+
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		res := d.latest()
+		if res == nil {
+			http.Error(w, "the check has not run yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		res := d.latest()
+		if res == nil {
+			http.Error(w, "the check has not run yet", http.StatusServiceUnavailable)
+			return
+		}
+		metrics, err := formatPromMetrics(d.plug, res.Output, res.Time)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, metrics)
+		fmt.Fprintln(w, "# HELP mackerel_check_duration_seconds Seconds the check took")
+		fmt.Fprintln(w, "# TYPE mackerel_check_duration_seconds gauge")
+		fmt.Fprintf(w, "mackerel_check_duration_seconds{plugin=\"%s\"} %g\n", labelEscaper.Replace(d.plug), res.Duration)
+	})
+	return mux
+}
+
+// runDaemon runs the check every interval and serves the latest result until it receives SIGINT or SIGTERM.
+// The checks don't overlap; if a check takes longer than the interval, it is reported as timed out,
+// and the next checks are skipped until it finishes.
+func runDaemon(plug string, args []string, opts *daemonOpts) int {
+	if _, ok := runners[plug]; !ok {
+		log.Printf("unknown plugin: %q", plug)
+		return exitError
+	}
+	d := newDaemon(plug, args, opts)
+	srv := &http.Server{Addr: opts.listen, Handler: d.handler()}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	// The checks run in another goroutine, so that the signals are handled while a check is running.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(opts.interval)
+		defer ticker.Stop()
+		for {
+			d.runOnce(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		log.Println(err)
+		return exitError
+	case <-sigCh:
+		cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+		return exitOK
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/internal/debuglog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractDaemonOpts(t *testing.T) {
+	opts, rest, err := extractDaemonOpts([]string{"-u", "http://localhost"})
+	assert.Nil(t, err)
+	assert.Nil(t, opts)
+	assert.Equal(t, []string{"-u", "http://localhost"}, rest)
+
+	opts, rest, err = extractDaemonOpts([]string{"--daemon", "--interval", "10s", "-u", "http://localhost", "--listen=:9999", "--prom-textfile=/tmp/http.prom"})
+	assert.Nil(t, err)
+	assert.Equal(t, &daemonOpts{interval: 10 * time.Second, listen: ":9999", promTextfile: "/tmp/http.prom"}, opts)
+	assert.Equal(t, []string{"-u", "http://localhost"}, rest)
+
+	opts, _, err = extractDaemonOpts([]string{"--daemon", "--listen", "localhost:9999"})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, opts.interval)
+
+	_, _, err = extractDaemonOpts([]string{"--daemon", "--interval", "10s"})
+	assert.NotNil(t, err)
+	_, _, err = extractDaemonOpts([]string{"--daemon", "--interval", "100ms", "--listen", ":9999"})
+	assert.NotNil(t, err)
+	_, _, err = extractDaemonOpts([]string{"--daemon", "--interval", "60", "--listen", ":9999"})
+	assert.NotNil(t, err)
+}
+
+func TestDaemon(t *testing.T) {
+	d := newDaemon("http", nil, &daemonOpts{interval: time.Minute})
+	d.exec = func(ctx context.Context) (string, int, error) {
+		return "HTTP WARNING: HTTP/1.1 200 OK - 5 bytes in 0.600000 second response time | time=0.6s;0.5;1\n", 1, nil
+	}
+	ts := httptest.NewServer(d.handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	code, _ := get("/status")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	d.runOnce(context.Background())
+	code, body := get("/status")
+	assert.Equal(t, http.StatusOK, code)
+	var res checkResult
+	assert.Nil(t, json.Unmarshal([]byte(body), &res))
+	assert.Equal(t, "WARNING", res.Status)
+	assert.Equal(t, 1, res.ExitCode)
+
+	code, body = get("/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "mackerel_check_status{plugin=\"http\"} 1\n")
+	assert.Contains(t, body, "mackerel_check_perfdata{plugin=\"http\",label=\"time\",uom=\"s\"} 0.6\n")
+	assert.Contains(t, body, "mackerel_check_duration_seconds{plugin=\"http\"} ")
+
+	d.exec = func(ctx context.Context) (string, int, error) {
+		<-ctx.Done()
+		return "", 0, ctx.Err()
+	}
+	d.opts.interval = 10 * time.Millisecond
+	d.runOnce(context.Background())
+	res = *d.latest()
+	assert.Equal(t, "UNKNOWN", res.Status)
+	assert.True(t, strings.HasPrefix(res.Output, "http UNKNOWN: the check timed out"), res.Output)
+}
+
+func TestDaemonRunPlugin(t *testing.T) {
+	f, err := ioutil.TempFile("", "mackerel-check-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	d := newDaemon("file-age", []string{"-f", f.Name(), "-w", "60", "-c", "120"}, &daemonOpts{interval: time.Minute})
+	out, code, err := d.exec(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+	assert.True(t, strings.HasPrefix(out, "FileAge OK: "), out)
+
+	release := make(chan struct{})
+	slow := func(args []string) *checkers.Checker {
+		<-release
+		return checkers.Critical("slow")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = d.runPlugin(ctx, slow)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, _, err = d.runPlugin(context.Background(), slow)
+	assert.Equal(t, errStillRunning, err, "the plugin should not start while the previous one is running")
+	close(release)
+	for len(d.busy) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	out, code, err = d.runPlugin(context.Background(), func(args []string) *checkers.Checker {
+		panic("oops")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "file-age UNKNOWN: panic: oops\n", out)
+
+	(&debuglog.DebugOpts{Debug: true}).Enable()
+	_, _, err = d.runPlugin(context.Background(), func(args []string) *checkers.Checker {
+		assert.False(t, debuglog.Enabled(), "the debug logs of the previous run should be disabled")
+		return checkers.Ok("ok")
+	})
+	assert.Nil(t, err)
+}
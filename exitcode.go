@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+const exitCodeSchemeFlag = "--exit-code-scheme"
+
+// exit code schemes, which are how the exit status of the plugins is read by the monitoring systems.
+const (
+	// schemeMackerel passes the exit status of the plugins through, since mackerel-agent treats
+	// the exit status other than 0, 1 and 2 as UNKNOWN.
+	schemeMackerel = "mackerel"
+	// schemeNagios exits with 3 (UNKNOWN) if the plugin fails before the check, such as for invalid options,
+	// and clamps the exit status over 3, which Nagios reports as out of bounds.
+	schemeNagios = "nagios"
+	// schemeSensu exits with 3 (UNKNOWN) if the plugin fails before the check,
+	// and passes the other exit status through since Sensu accepts custom ones.
+	schemeSensu = "sensu"
+)
+
+const exitUnknown = 3
+
+// extractExitCodeScheme removes --exit-code-scheme=SCHEME or --exit-code-scheme SCHEME from args.
+// It returns schemeMackerel if it is not specified.
+func extractExitCodeScheme(args []string) (string, []string, error) {
+	v, args, ok := extractFlag(args, exitCodeSchemeFlag, true)
+	if !ok {
+		return schemeMackerel, args, nil
+	}
+	switch v {
+	case schemeMackerel, schemeNagios, schemeSensu:
+		return v, args, nil
+	}
+	return "", nil, fmt.Errorf("invalid %s: %q is not one of nagios, mackerel or sensu", exitCodeSchemeFlag, v)
+}
+
+// mapExitCode returns the exit status of the plugin in the scheme.
+// The plugins exit with 1 without the result of a check if they fail to parse the options,
+// which Nagios and Sensu read as WARNING.
+func mapExitCode(scheme, out string, code int) int {
+	switch scheme {
+	case schemeNagios:
+		if code != exitOK && resultRe.FindString(out) == "" {
+			return exitUnknown
+		}
+		if code > exitUnknown || code < 0 {
+			return exitUnknown
+		}
+	case schemeSensu:
+		if code != exitOK && resultRe.FindString(out) == "" {
+			return exitUnknown
+		}
+	}
+	return code
+}
+
+// runWithExitCodeScheme runs the plugin and exits with the status mapped by the scheme.
+// The output of the plugin is passed through as it is.
+func runWithExitCodeScheme(plug string, args []string, scheme string) int {
+	out, code, err := execPlugin(context.Background(), plug, args, os.Stdout)
+	if err != nil {
+		log.Println(err)
+		return mapExitCode(scheme, "", exitError)
+	}
+	return mapExitCode(scheme, out, code)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractExitCodeScheme(t *testing.T) {
+	scheme, rest, err := extractExitCodeScheme([]string{"-H", "localhost"})
+	assert.Nil(t, err)
+	assert.Equal(t, schemeMackerel, scheme)
+	assert.Equal(t, []string{"-H", "localhost"}, rest)
+
+	scheme, rest, err = extractExitCodeScheme([]string{"-H", "localhost", "--exit-code-scheme", "nagios"})
+	assert.Nil(t, err)
+	assert.Equal(t, schemeNagios, scheme)
+	assert.Equal(t, []string{"-H", "localhost"}, rest)
+
+	_, _, err = extractExitCodeScheme([]string{"--exit-code-scheme=icinga"})
+	assert.NotNil(t, err)
+}
+
+func TestMapExitCode(t *testing.T) {
+	const (
+		warning = "TCP WARNING: 0.600 seconds response time on localhost port 22\n"
+		unknown = "TCP UNKNOWN: connection refused\n"
+	)
+	testCases := []struct {
+		scheme string
+		out    string
+		code   int
+		want   int
+	}{
+		{schemeMackerel, warning, 1, 1},
+		{schemeMackerel, "", 1, 1},
+		{schemeNagios, warning, 1, 1},
+		{schemeNagios, unknown, 3, 3},
+		{schemeNagios, "", 1, 3},
+		{schemeNagios, "Usage:\n  check-tcp [OPTIONS]\n", 1, 3},
+		{schemeNagios, "", 0, 0},
+		{schemeNagios, unknown, 4, 3},
+		{schemeNagios, unknown, -1, 3},
+		{schemeSensu, "", 1, 3},
+		{schemeSensu, warning, 1, 1},
+		{schemeSensu, unknown, 4, 4},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, mapExitCode(tc.scheme, tc.out, tc.code), "%s %q %d", tc.scheme, tc.out, tc.code)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/mackerelio/go-check-plugins
 go 1.16
 
 require (
+	github.com/Shopify/sarama v1.29.0
 	github.com/StackExchange/wmi v1.2.1
 	github.com/aws/aws-sdk-go v1.40.59
 	github.com/beevik/ntp v0.3.0
@@ -14,6 +15,7 @@ require (
 	github.com/go-ole/go-ole v1.2.6
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gomodule/redigo v1.8.5
+	github.com/gosnmp/gosnmp v1.32.0
 	github.com/jessevdk/go-flags v1.5.0
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/lib/pq v1.10.3
@@ -22,11 +24,18 @@ require (
 	github.com/mackerelio/golib v1.2.1
 	github.com/mattn/go-encoding v0.0.2
 	github.com/mattn/go-zglob v0.0.3
+	github.com/miekg/dns v1.1.43
 	github.com/natefinch/atomic v0.0.0-20150920032501-a62ce929ffcc
 	github.com/shirou/gopsutil/v3 v3.21.10
 	github.com/stretchr/testify v1.7.0
 	github.com/tatsushid/go-fastping v0.0.0-20160109021039-d7bb493dee3e
-	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	github.com/xdg/scram v1.0.3
+	go.mongodb.org/mongo-driver v1.7.5
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
 	golang.org/x/sys v0.0.0-20211013075003-97ac67df715c
 	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v2 v2.4.0
+	k8s.io/api v0.20.6
+	k8s.io/apimachinery v0.20.6
+	k8s.io/client-go v0.20.6
 )
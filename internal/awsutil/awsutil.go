@@ -0,0 +1,21 @@
+// Package awsutil provides helpers shared by the check plugins for AWS.
+package awsutil
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// CheckConfig validates that the region and the credentials of the config are available,
+// which is used by --self-test. It doesn't call any API of the services.
+func CheckConfig(config *aws.Config) error {
+	if aws.StringValue(config.Region) == "" {
+		return errors.New("AWS region is not configured")
+	}
+	if config.Credentials == nil {
+		return errors.New("AWS credentials are not configured")
+	}
+	_, err := config.Credentials.Get()
+	return err
+}
@@ -0,0 +1,22 @@
+package awsutil
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckConfig(t *testing.T) {
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "")
+
+	err := CheckConfig(aws.NewConfig().WithCredentials(creds))
+	assert.EqualError(t, err, "AWS region is not configured")
+
+	err = CheckConfig(aws.NewConfig().WithRegion("ap-northeast-1"))
+	assert.EqualError(t, err, "AWS credentials are not configured")
+
+	err = CheckConfig(aws.NewConfig().WithRegion("ap-northeast-1").WithCredentials(creds))
+	assert.Nil(t, err)
+}
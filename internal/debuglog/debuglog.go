@@ -0,0 +1,160 @@
+// Package debuglog prints debug logs of plugins, such as executed commands,
+// SQL statements and HTTP requests, to stderr so that they don't affect the check output.
+package debuglog
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DebugOpts is the option to enable debug logs.
+// It is embedded in the options of plugins.
+type DebugOpts struct {
+	Debug bool `long:"debug" description:"Print debug logs of executed commands, SQL statements and HTTP requests to stderr"`
+}
+
+const redacted = "xxxxx"
+
+var (
+	// enabled is accessed atomically, since check-multi runs the plugins concurrently in a process.
+	enabled int32
+	logger  = log.New(os.Stderr, "[debug] ", log.Ltime|log.Lmicroseconds)
+)
+
+// Enable enables debug logs if --debug is specified. It doesn't disable them otherwise,
+// so that the plugins run by check-multi with --debug print debug logs too.
+func (o *DebugOpts) Enable() {
+	if o.Debug {
+		atomic.StoreInt32(&enabled, 1)
+	}
+}
+
+// Reset disables debug logs. It is called before a plugin runs in-process,
+// because the debug logs enabled by the previous run are kept.
+func Reset() {
+	atomic.StoreInt32(&enabled, 0)
+}
+
+// Enabled reports whether debug logs are enabled.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) != 0
+}
+
+// Printf prints a debug log if enabled.
+func Printf(format string, v ...interface{}) {
+	if Enabled() {
+		logger.Output(2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Trace prints the operation, and returns the function to print its result with the elapsed time.
+func Trace(format string, v ...interface{}) func(err error) {
+	if !Enabled() {
+		return func(error) {}
+	}
+	op := fmt.Sprintf(format, v...)
+	logger.Output(2, op)
+	start := time.Now()
+	return func(err error) {
+		d := time.Since(start).Round(time.Microsecond)
+		if err != nil {
+			logger.Output(2, fmt.Sprintf("%s failed in %s: %s", op, d, err))
+			return
+		}
+		logger.Output(2, fmt.Sprintf("%s done in %s", op, d))
+	}
+}
+
+// Command formats the command line to print.
+// Values of the flags in secretFlags, such as "--password", and passwords in URLs are redacted.
+func Command(name string, args []string, secretFlags ...string) string {
+	words := []string{name}
+	for i := 0; i < len(args); i++ {
+		arg := RedactURL(args[i])
+		secret := false
+		for _, f := range secretFlags {
+			if arg == f && i+1 < len(args) {
+				words = append(words, arg, redacted)
+				i++
+				secret = true
+				break
+			}
+			if strings.HasPrefix(arg, f+"=") {
+				arg = f + "=" + redacted
+				break
+			}
+		}
+		if !secret {
+			words = append(words, arg)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// RedactURL redacts the password in s if s is a URL which has a password.
+func RedactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), redacted)
+	return u.String()
+}
+
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Amz-Security-Token"}
+
+type transport struct {
+	rt http.RoundTripper
+}
+
+// Transport wraps rt to print HTTP requests and responses if enabled.
+// rt is returned as is if debug logs are disabled.
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	if !Enabled() {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{rt: rt}
+}
+
+func formatHeader(h http.Header) string {
+	var s []string
+	for k, vs := range h {
+		for _, v := range vs {
+			for _, sh := range secretHeaders {
+				if strings.EqualFold(k, sh) {
+					v = redacted
+				}
+			}
+			s = append(s, k+": "+v)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger.Printf("http: %s %s [%s]", req.Method, RedactURL(req.URL.String()), formatHeader(req.Header))
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	d := time.Since(start).Round(time.Microsecond)
+	if err != nil {
+		logger.Printf("http: %s %s failed in %s: %s", req.Method, RedactURL(req.URL.String()), d, err)
+		return nil, err
+	}
+	logger.Printf("http: %s in %s [%s]", resp.Status, d, formatHeader(resp.Header))
+	return resp, nil
+}
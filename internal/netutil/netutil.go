@@ -0,0 +1,48 @@
+// Package netutil provides helpers shared by network-facing check plugins.
+package netutil
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// AddressFamilyOpts is the options to select the address family.
+// It is embedded in the options of plugins.
+type AddressFamilyOpts struct {
+	IPv4 bool `short:"4" long:"ipv4" description:"Use IPv4 only"`
+	IPv6 bool `short:"6" long:"ipv6" description:"Use IPv6 only"`
+}
+
+// Validate returns an error if both of --ipv4 and --ipv6 are specified.
+func (o *AddressFamilyOpts) Validate() error {
+	if o.IPv4 && o.IPv6 {
+		return errors.New("--ipv4 and --ipv6 can't be specified at the same time")
+	}
+	return nil
+}
+
+// Network returns the network restricted to the selected address family,
+// for example "tcp4" for "tcp" with --ipv4.
+// Networks which have no family, such as "unix", are returned as is.
+func (o *AddressFamilyOpts) Network(network string) string {
+	switch network {
+	case "tcp", "udp", "ip":
+	default:
+		return network
+	}
+	switch {
+	case o.IPv4:
+		return network + "4"
+	case o.IPv6:
+		return network + "6"
+	}
+	return network
+}
+
+// DialContext wraps dial so that it dials with the network restricted to the selected address family.
+func (o *AddressFamilyOpts) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, o.Network(network), addr)
+	}
+}
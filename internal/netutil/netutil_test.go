@@ -0,0 +1,43 @@
+package netutil
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, (&AddressFamilyOpts{}).Validate())
+	assert.Nil(t, (&AddressFamilyOpts{IPv6: true}).Validate())
+	assert.NotNil(t, (&AddressFamilyOpts{IPv4: true, IPv6: true}).Validate())
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		opts    AddressFamilyOpts
+		network string
+		want    string
+	}{
+		{opts: AddressFamilyOpts{}, network: "tcp", want: "tcp"},
+		{opts: AddressFamilyOpts{IPv4: true}, network: "tcp", want: "tcp4"},
+		{opts: AddressFamilyOpts{IPv6: true}, network: "udp", want: "udp6"},
+		{opts: AddressFamilyOpts{IPv4: true}, network: "tcp6", want: "tcp6"},
+		{opts: AddressFamilyOpts{IPv4: true}, network: "unix", want: "unix"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.opts.Network(tt.network))
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	var got string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		got = network
+		return nil, nil
+	}
+	opts := &AddressFamilyOpts{IPv6: true}
+	opts.DialContext(dial)(context.Background(), "tcp", "[::1]:80")
+	assert.Equal(t, "tcp6", got)
+}
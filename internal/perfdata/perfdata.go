@@ -0,0 +1,46 @@
+// Package perfdata formats the performance data of check plugins in the format of Nagios plugins.
+package perfdata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var plainLabelRe = regexp.MustCompile(`^[-a-zA-Z0-9_.]+$`)
+
+// Format returns the performance data of the value, such as "time=0.12s;1;2".
+// The label is quoted if it contains characters other than letters, digits, "_", "-" and ".".
+func Format(label, value, unit, warning, critical string) string {
+	if !plainLabelRe.MatchString(label) {
+		label = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	return fmt.Sprintf("%s=%s%s;%s;%s", label, value, unit, warning, critical)
+}
+
+// FormatMinMax returns the performance data of the value with the minimum and the maximum, such as
+// "usage=37.5%;90;95;0;100". The maximum is omitted if it is empty.
+func FormatMinMax(label, value, unit, warning, critical, min, max string) string {
+	s := Format(label, value, unit, warning, critical) + ";" + min
+	if max != "" {
+		s += ";" + max
+	}
+	return s
+}
+
+// OptInt formats the optional threshold, which is empty if it is not specified.
+func OptInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+// OptFloat formats the optional threshold, which is empty if it is not specified.
+func OptFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'g', -1, 64)
+}
@@ -0,0 +1,20 @@
+package perfdata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	w, c := int64(80), 1.5
+	assert.Equal(t, "active=12;;", Format("active", "12", "", "", ""))
+	assert.Equal(t, "saturation=42.0%;80;1.5", Format("saturation", "42.0", "%", OptInt(&w), OptFloat(&c)))
+	assert.Equal(t, "'HeapMemoryUsage/used'=1024;;", Format("HeapMemoryUsage/used", "1024", "", OptInt(nil), OptFloat(nil)))
+	assert.Equal(t, "'it''s'=1;;", Format("it's", "1", "", "", ""))
+}
+
+func TestFormatMinMax(t *testing.T) {
+	assert.Equal(t, "usage=37.5%;90;95;0;100", FormatMinMax("usage", "37.5", "%", "90", "95", "0", "100"))
+	assert.Equal(t, "'my db'=1024B;;;0", FormatMinMax("my db", "1024", "B", "", "", "0", ""))
+}
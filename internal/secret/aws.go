@@ -0,0 +1,79 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// newSession returns the session configured by the environment variables and the shared config,
+// such as AWS_REGION and AWS_PROFILE.
+func newSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+}
+
+func getSecretValue(ref string) (string, error) {
+	id, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		id, key = ref[:i], ref[i+1:]
+	}
+	sess, err := newSession()
+	if err != nil {
+		return "", err
+	}
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	s := aws.StringValue(out.SecretString)
+	if out.SecretString == nil {
+		s = string(out.SecretBinary)
+	}
+	if key == "" {
+		return s, nil
+	}
+	return lookupJSONKey(s, key)
+}
+
+// lookupJSONKey returns the value of the key in the secret of a JSON object,
+// which is how Secrets Manager keeps key/value pairs.
+func lookupJSONKey(s, key string) (string, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return "", fmt.Errorf("the secret is not a JSON object")
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("the secret has no key %q", key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func getParameter(name string) (string, error) {
+	sess, err := newSession()
+	if err != nil {
+		return "", err
+	}
+	// the parameter name starts with "/" if it is in a hierarchy, such as ssm:///prod/db/password
+	out, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.Parameter == nil {
+		return "", fmt.Errorf("parameter %s is not found", name)
+	}
+	return aws.StringValue(out.Parameter.Value), nil
+}
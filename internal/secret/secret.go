@@ -0,0 +1,85 @@
+// Package secret resolves credentials of plugins given indirectly, such as by
+// environment variables, files or AWS, so that they don't appear in process listings.
+package secret
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PasswordFileOpts is the option to read the password from a file.
+// It is embedded in the options of plugins which have --password.
+type PasswordFileOpts struct {
+	PasswordFile string `long:"password-file" value-name:"FILE" description:"Read the password from FILE instead of --password"`
+}
+
+// ResolvePassword returns the password read from --password-file if it is specified,
+// or the password resolved by Resolve otherwise.
+func (o *PasswordFileOpts) ResolvePassword(password string) (string, error) {
+	if o.PasswordFile != "" {
+		return readFile(o.PasswordFile)
+	}
+	return Resolve(password)
+}
+
+// resolvers resolve the secrets by the scheme of the reference; they are replaced in tests.
+var resolvers = map[string]func(ref string) (string, error){
+	"env":    lookupEnv,
+	"file":   readFile,
+	"aws-sm": getSecretValue,
+	"ssm":    getParameter,
+}
+
+// Resolve returns the secret which the value refers to:
+//
+//	env://NAME         the environment variable NAME
+//	file://PATH        the content of the file PATH without trailing newlines
+//	aws-sm://ID[#KEY]  the secret of AWS Secrets Manager, or the KEY of it if it is a JSON object
+//	ssm://NAME         the parameter of AWS Systems Manager Parameter Store, decrypted if it is a SecureString
+//
+// Other values are returned as they are.
+func Resolve(value string) (string, error) {
+	i := strings.Index(value, "://")
+	if i < 0 {
+		return value, nil
+	}
+	resolve, ok := resolvers[value[:i]]
+	if !ok {
+		return value, nil
+	}
+	s, err := resolve(value[i+3:])
+	if err != nil {
+		// the reference is shown as it is not a secret itself
+		return "", fmt.Errorf("failed to resolve the secret %s: %w", value, err)
+	}
+	return s, nil
+}
+
+// ResolveAll resolves the values in place.
+func ResolveAll(values ...*string) error {
+	for _, v := range values {
+		s, err := Resolve(*v)
+		if err != nil {
+			return err
+		}
+		*v = s
+	}
+	return nil
+}
+
+func lookupEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+func readFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,93 @@
+package secret
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("s3cret\n"), 0600))
+	os.Setenv("CHECK_SECRET_TEST", "from-env")
+	defer os.Unsetenv("CHECK_SECRET_TEST")
+
+	testCases := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"", ""},
+		{"http://example.com", "http://example.com"},
+		{"env://CHECK_SECRET_TEST", "from-env"},
+		{"file://" + file, "s3cret"},
+	}
+	for _, tc := range testCases {
+		s, err := Resolve(tc.value)
+		assert.NoError(t, err, tc.value)
+		assert.Equal(t, tc.want, s, tc.value)
+	}
+
+	_, err := Resolve("env://CHECK_SECRET_TEST_UNSET")
+	assert.EqualError(t, err, "failed to resolve the secret env://CHECK_SECRET_TEST_UNSET: environment variable CHECK_SECRET_TEST_UNSET is not set")
+	_, err = Resolve("file://" + filepath.Join(dir, "none"))
+	assert.Error(t, err)
+}
+
+func TestResolveAWS(t *testing.T) {
+	orig := resolvers["aws-sm"]
+	defer func() { resolvers["aws-sm"] = orig }()
+	resolvers["aws-sm"] = func(ref string) (string, error) {
+		if ref != "prod/db" {
+			return "", errors.New("not found")
+		}
+		return "from-aws", nil
+	}
+	s, err := Resolve("aws-sm://prod/db")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-aws", s)
+	_, err = Resolve("aws-sm://prod/none")
+	assert.EqualError(t, err, "failed to resolve the secret aws-sm://prod/none: not found")
+}
+
+func TestLookupJSONKey(t *testing.T) {
+	s, err := lookupJSONKey(`{"username":"app","password":"s3cret","port":3306}`, "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", s)
+	s, err = lookupJSONKey(`{"port":3306}`, "port")
+	assert.NoError(t, err)
+	assert.Equal(t, "3306", s)
+	_, err = lookupJSONKey(`{"username":"app"}`, "password")
+	assert.EqualError(t, err, `the secret has no key "password"`)
+	_, err = lookupJSONKey(`s3cret`, "password")
+	assert.EqualError(t, err, "the secret is not a JSON object")
+}
+
+func TestResolveAll(t *testing.T) {
+	os.Setenv("CHECK_SECRET_TEST", "from-env")
+	defer os.Unsetenv("CHECK_SECRET_TEST")
+	a, b := "env://CHECK_SECRET_TEST", "plain"
+	assert.NoError(t, ResolveAll(&a, &b))
+	assert.Equal(t, "from-env", a)
+	assert.Equal(t, "plain", b)
+}
+
+func TestPasswordFileOpts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("from-file\r\n"), 0600))
+
+	opts := PasswordFileOpts{}
+	s, err := opts.ResolvePassword("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", s)
+
+	opts.PasswordFile = file
+	s, err = opts.ResolvePassword("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", s)
+}
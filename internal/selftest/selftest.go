@@ -0,0 +1,110 @@
+// Package selftest provides the --self-test option of plugins, which validates
+// the configuration without running the check so that deployments can be verified.
+package selftest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// SelfTestOpts is the option to run the self-test.
+// It is embedded in the options of plugins.
+type SelfTestOpts struct {
+	SelfTest bool `long:"self-test" description:"Validate the configuration (flags, credentials and target) without running the check, and exit with OK or UNKNOWN"`
+}
+
+// Check is a validation of the configuration.
+type Check func() error
+
+// Run runs the checks in order, and returns OK if all of them passed
+// or UNKNOWN with the first error.
+func Run(checks ...Check) *checkers.Checker {
+	for _, c := range checks {
+		if err := c(); err != nil {
+			return checkers.Unknown(fmt.Sprintf("self-test failed: %s", err))
+		}
+	}
+	return checkers.Ok("self-test passed")
+}
+
+// Required returns a check that the value of the option is not empty.
+func Required(name, value string) Check {
+	return func() error {
+		if value == "" {
+			return fmt.Errorf("%s is not specified", name)
+		}
+		return nil
+	}
+}
+
+// Resolve returns a check that the host can be resolved.
+// The host may have a port, and may be an IP address or a path of a unix domain socket.
+func Resolve(host string) Check {
+	return func() error {
+		if host == "" {
+			return errors.New("host is not specified")
+		}
+		if strings.HasPrefix(host, "/") {
+			return nil
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if net.ParseIP(host) != nil {
+			return nil
+		}
+		if _, err := net.LookupHost(host); err != nil {
+			return fmt.Errorf("failed to resolve %s: %s", host, err)
+		}
+		return nil
+	}
+}
+
+// ResolveURL returns a check that the host of the URL can be resolved.
+func ResolveURL(rawurl string) Check {
+	return func() error {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return err
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("no host in %s", rawurl)
+		}
+		return Resolve(u.Hostname())()
+	}
+}
+
+// Exists returns a check that the file or the directory exists.
+func Exists(path string) Check {
+	return func() error {
+		_, err := os.Stat(path)
+		return err
+	}
+}
+
+// Readable returns a check that the file can be opened.
+func Readable(path string) Check {
+	return func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// Executable returns a check that the command is found in PATH.
+func Executable(name string) Check {
+	return func() error {
+		_, err := exec.LookPath(name)
+		return err
+	}
+}
@@ -0,0 +1,49 @@
+package selftest
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ckr := Run(Required("--host", "localhost"), Resolve("127.0.0.1:80"))
+	assert.Equal(t, checkers.OK, ckr.Status)
+	assert.Equal(t, "self-test passed", ckr.Message)
+
+	called := false
+	ckr = Run(
+		Required("--host", ""),
+		func() error { called = true; return errors.New("unreachable") },
+	)
+	assert.Equal(t, checkers.UNKNOWN, ckr.Status)
+	assert.Equal(t, "self-test failed: --host is not specified", ckr.Message)
+	assert.False(t, called, "checks after a failure should not run")
+}
+
+func TestResolve(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "[::1]", "[::1]:443", "::1", "/var/run/mysqld/mysqld.sock"} {
+		assert.NoError(t, Resolve(host)(), host)
+	}
+	assert.Error(t, Resolve("")())
+	assert.Error(t, Resolve("nonexistent.invalid")())
+}
+
+func TestResolveURL(t *testing.T) {
+	assert.NoError(t, ResolveURL("http://127.0.0.1:8080/status")())
+	assert.Error(t, ResolveURL("/status")())
+}
+
+func TestReadable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cert.pem")
+	assert.Error(t, Readable(file)())
+	assert.Error(t, Exists(file)())
+	assert.NoError(t, Exists(dir)())
+	assert.NoError(t, ioutil.WriteFile(file, []byte("x"), 0644))
+	assert.NoError(t, Readable(file)())
+}
@@ -0,0 +1,60 @@
+// Package state keeps the state of check plugins between runs in JSON files.
+package state
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mackerelio/golib/pluginutil"
+	"github.com/natefinch/atomic"
+)
+
+// Dir returns dir given by --state-dir, or the directory of the plugin under the work dir of mackerel-agent.
+func Dir(dir, plugin string) string {
+	if dir != "" {
+		return dir
+	}
+	return filepath.Join(pluginutil.PluginWorkDir(), plugin)
+}
+
+// File returns the path of the state file in dir named after the prefix and the hash of the keys,
+// such as nodes-0123456789abcdef0123456789abcdef.json, so that the checks of other targets
+// or with other arguments don't share the state.
+func File(dir, prefix string, keys ...string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.json", prefix, md5.Sum([]byte(strings.Join(keys, " ")))))
+}
+
+// Load decodes the state file into v. It returns false without an error if the file doesn't exist,
+// which means that it's the first run.
+func Load(file string, v interface{}) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %s", file, err)
+	}
+	return true, nil
+}
+
+// Save encodes v into the state file, creating the directory if it doesn't exist.
+// The file is replaced atomically, so that a check running at the same time doesn't read a broken state.
+func Save(file string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return atomic.WriteFile(file, &buf)
+}
@@ -0,0 +1,42 @@
+package state
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDir(t *testing.T) {
+	assert.Equal(t, "/var/tmp/state", Dir("/var/tmp/state", "check-foo"))
+	assert.Equal(t, "check-foo", filepath.Base(Dir("", "check-foo")))
+}
+
+func TestFile(t *testing.T) {
+	assert.Equal(t, "/tmp/nodes-acbd18db4cc2f85cedef654fccc4a4d8.json", File("/tmp", "nodes", "foo"))
+	assert.Equal(t, File("/tmp", "nodes", "foo bar"), File("/tmp", "nodes", "foo", "bar"))
+	assert.NotEqual(t, File("/tmp", "nodes", "foo"), File("/tmp", "nodes", "bar"))
+}
+
+func TestLoadSave(t *testing.T) {
+	type counters struct {
+		Count int64 `json:"count"`
+	}
+	file := filepath.Join(t.TempDir(), "sub", "counters.json")
+
+	var c counters
+	ok, err := Load(file, &c)
+	assert.Nil(t, err)
+	assert.False(t, ok, "the state file doesn't exist at the first run")
+
+	assert.Nil(t, Save(file, &counters{Count: 7}))
+	ok, err = Load(file, &c)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, counters{Count: 7}, c)
+
+	assert.Nil(t, ioutil.WriteFile(file, []byte("{"), 0644))
+	_, err = Load(file, &c)
+	assert.NotNil(t, err)
+}
@@ -9,8 +9,15 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+
+	"github.com/mackerelio/go-check-plugins/check-multi/lib"
 )
 
+func init() {
+	// check-multi runs the other plugins in-process
+	checkmulti.SetRunners(runners)
+}
+
 func main() {
 	os.Exit(run(os.Args))
 }
@@ -22,7 +29,7 @@ const (
 
 var helpReg = regexp.MustCompile(`--?h(?:elp)?`)
 
-//go:generate sh -c "perl tool/gen_mackerel_check.pl > mackerel-check_gen.go"
+//go:generate sh -c "perl tool/gen_mackerel_check.pl | gofmt > mackerel-check_gen.go"
 func run(args []string) int {
 	var plug string
 	f, err := exec.LookPath(args[0])
@@ -52,6 +59,26 @@ func run(args []string) int {
 		os.Args = append([]string{f}, args[2:]...)
 	}
 
+	scheme, plugArgs, err := extractExitCodeScheme(os.Args[1:])
+	if err != nil {
+		log.Println(err)
+		return exitError
+	}
+	dopts, plugArgs, err := extractDaemonOpts(plugArgs)
+	if err != nil {
+		log.Println(err)
+		return exitError
+	}
+	if dopts != nil {
+		dopts.exitCodeScheme = scheme
+		return runDaemon(plug, plugArgs, dopts)
+	}
+	if file, args, ok := extractPromTextfile(plugArgs); ok {
+		return runWithPromTextfile(plug, args, file, scheme)
+	}
+	if scheme != schemeMackerel {
+		return runWithExitCodeScheme(plug, plugArgs, scheme)
+	}
 	err = runPlugin(plug)
 
 	if err != nil {
@@ -4,55 +4,97 @@ package main
 import (
 	"fmt"
 
+	"github.com/mackerelio/checkers"
+	"github.com/mackerelio/go-check-plugins/check-aws-cloudwatch-logs-insights/lib"
 	"github.com/mackerelio/go-check-plugins/check-aws-cloudwatch-logs/lib"
+	"github.com/mackerelio/go-check-plugins/check-aws-cloudwatch-metric/lib"
 	"github.com/mackerelio/go-check-plugins/check-aws-sqs-queue-size/lib"
 	"github.com/mackerelio/go-check-plugins/check-cert-file/lib"
+	"github.com/mackerelio/go-check-plugins/check-conntrack/lib"
 	"github.com/mackerelio/go-check-plugins/check-disk/lib"
+	"github.com/mackerelio/go-check-plugins/check-dns/lib"
+	"github.com/mackerelio/go-check-plugins/check-docker/lib"
 	"github.com/mackerelio/go-check-plugins/check-elasticsearch/lib"
 	"github.com/mackerelio/go-check-plugins/check-file-age/lib"
 	"github.com/mackerelio/go-check-plugins/check-file-size/lib"
+	"github.com/mackerelio/go-check-plugins/check-haproxy/lib"
 	"github.com/mackerelio/go-check-plugins/check-http/lib"
+	"github.com/mackerelio/go-check-plugins/check-interface/lib"
+	"github.com/mackerelio/go-check-plugins/check-ipmi/lib"
 	"github.com/mackerelio/go-check-plugins/check-jmx-jolokia/lib"
+	"github.com/mackerelio/go-check-plugins/check-kafka/lib"
+	"github.com/mackerelio/go-check-plugins/check-kubernetes/lib"
 	"github.com/mackerelio/go-check-plugins/check-ldap/lib"
 	"github.com/mackerelio/go-check-plugins/check-load/lib"
 	"github.com/mackerelio/go-check-plugins/check-log/lib"
 	"github.com/mackerelio/go-check-plugins/check-mailq/lib"
 	"github.com/mackerelio/go-check-plugins/check-masterha/lib"
 	"github.com/mackerelio/go-check-plugins/check-memcached/lib"
+	"github.com/mackerelio/go-check-plugins/check-memory/lib"
+	"github.com/mackerelio/go-check-plugins/check-mongodb/lib"
+	"github.com/mackerelio/go-check-plugins/check-multi/lib"
 	"github.com/mackerelio/go-check-plugins/check-mysql/lib"
 	"github.com/mackerelio/go-check-plugins/check-ntpoffset/lib"
+	"github.com/mackerelio/go-check-plugins/check-nvme/lib"
+	"github.com/mackerelio/go-check-plugins/check-php-fpm/lib"
 	"github.com/mackerelio/go-check-plugins/check-ping/lib"
 	"github.com/mackerelio/go-check-plugins/check-postgresql/lib"
 	"github.com/mackerelio/go-check-plugins/check-procs/lib"
+	"github.com/mackerelio/go-check-plugins/check-rabbitmq/lib"
+	"github.com/mackerelio/go-check-plugins/check-raid/lib"
 	"github.com/mackerelio/go-check-plugins/check-redis/lib"
+	"github.com/mackerelio/go-check-plugins/check-s3-object/lib"
+	"github.com/mackerelio/go-check-plugins/check-server-status/lib"
 	"github.com/mackerelio/go-check-plugins/check-smtp/lib"
+	"github.com/mackerelio/go-check-plugins/check-snmp/lib"
 	"github.com/mackerelio/go-check-plugins/check-solr/lib"
 	"github.com/mackerelio/go-check-plugins/check-ssh/lib"
 	"github.com/mackerelio/go-check-plugins/check-ssl-cert/lib"
 	"github.com/mackerelio/go-check-plugins/check-tcp/lib"
 	"github.com/mackerelio/go-check-plugins/check-uptime/lib"
+	"github.com/mackerelio/go-check-plugins/check-varnish/lib"
 )
 
 func runPlugin(plug string) error {
 	switch plug {
 	case "aws-cloudwatch-logs":
 		checkawscloudwatchlogs.Do()
+	case "aws-cloudwatch-logs-insights":
+		checkawscloudwatchlogsinsights.Do()
+	case "aws-cloudwatch-metric":
+		checkawscloudwatchmetric.Do()
 	case "aws-sqs-queue-size":
 		checkawssqsqueuesize.Do()
 	case "cert-file":
 		checkcertfile.Do()
+	case "conntrack":
+		checkconntrack.Do()
 	case "disk":
 		checkdisk.Do()
+	case "dns":
+		checkdns.Do()
+	case "docker":
+		checkdocker.Do()
 	case "elasticsearch":
 		checkelasticsearch.Do()
 	case "file-age":
 		checkfileage.Do()
 	case "file-size":
 		checkfilesize.Do()
+	case "haproxy":
+		checkhaproxy.Do()
 	case "http":
 		checkhttp.Do()
+	case "interface":
+		checkinterface.Do()
+	case "ipmi":
+		checkipmi.Do()
 	case "jmx-jolokia":
 		checkjmxjolokia.Do()
+	case "kafka":
+		checkkafka.Do()
+	case "kubernetes":
+		checkkubernetes.Do()
 	case "ldap":
 		checkldap.Do()
 	case "load":
@@ -65,20 +107,40 @@ func runPlugin(plug string) error {
 		checkmasterha.Do()
 	case "memcached":
 		checkmemcached.Do()
+	case "memory":
+		checkmemory.Do()
+	case "mongodb":
+		checkmongodb.Do()
+	case "multi":
+		checkmulti.Do()
 	case "mysql":
 		checkmysql.Do()
 	case "ntpoffset":
 		checkntpoffset.Do()
+	case "nvme":
+		checknvme.Do()
+	case "php-fpm":
+		checkphpfpm.Do()
 	case "ping":
 		checkping.Do()
 	case "postgresql":
 		checkpostgresql.Do()
 	case "procs":
 		checkprocs.Do()
+	case "rabbitmq":
+		checkrabbitmq.Do()
+	case "raid":
+		checkraid.Do()
 	case "redis":
 		checkredis.Do()
+	case "s3-object":
+		checks3object.Do()
+	case "server-status":
+		checkserverstatus.Do()
 	case "smtp":
 		checksmtp.Do()
+	case "snmp":
+		checksnmp.Do()
 	case "solr":
 		checksolr.Do()
 	case "ssh":
@@ -89,38 +151,113 @@ func runPlugin(plug string) error {
 		checktcp.Do()
 	case "uptime":
 		checkuptime.Do()
+	case "varnish":
+		checkvarnish.Do()
 	default:
 		return fmt.Errorf("unknown plugin: %q", plug)
 	}
 	return nil
 }
 
+// runners run the plugins in-process for the daemon mode
+var runners = map[string]func([]string) *checkers.Checker{
+	"aws-cloudwatch-logs":          checkawscloudwatchlogs.Run,
+	"aws-cloudwatch-logs-insights": checkawscloudwatchlogsinsights.Run,
+	"aws-cloudwatch-metric":        checkawscloudwatchmetric.Run,
+	"aws-sqs-queue-size":           checkawssqsqueuesize.Run,
+	"cert-file":                    checkcertfile.Run,
+	"conntrack":                    checkconntrack.Run,
+	"disk":                         checkdisk.Run,
+	"dns":                          checkdns.Run,
+	"docker":                       checkdocker.Run,
+	"elasticsearch":                checkelasticsearch.Run,
+	"file-age":                     checkfileage.Run,
+	"file-size":                    checkfilesize.Run,
+	"haproxy":                      checkhaproxy.Run,
+	"http":                         checkhttp.Run,
+	"interface":                    checkinterface.Run,
+	"ipmi":                         checkipmi.Run,
+	"jmx-jolokia":                  checkjmxjolokia.Run,
+	"kafka":                        checkkafka.Run,
+	"kubernetes":                   checkkubernetes.Run,
+	"ldap":                         checkldap.Run,
+	"load":                         checkload.Run,
+	"log":                          checklog.Run,
+	"mailq":                        checkmailq.Run,
+	"masterha":                     checkmasterha.Run,
+	"memcached":                    checkmemcached.Run,
+	"memory":                       checkmemory.Run,
+	"mongodb":                      checkmongodb.Run,
+	"multi":                        checkmulti.Run,
+	"mysql":                        checkmysql.Run,
+	"ntpoffset":                    checkntpoffset.Run,
+	"nvme":                         checknvme.Run,
+	"php-fpm":                      checkphpfpm.Run,
+	"ping":                         checkping.Run,
+	"postgresql":                   checkpostgresql.Run,
+	"procs":                        checkprocs.Run,
+	"rabbitmq":                     checkrabbitmq.Run,
+	"raid":                         checkraid.Run,
+	"redis":                        checkredis.Run,
+	"s3-object":                    checks3object.Run,
+	"server-status":                checkserverstatus.Run,
+	"smtp":                         checksmtp.Run,
+	"snmp":                         checksnmp.Run,
+	"solr":                         checksolr.Run,
+	"ssh":                          checkssh.Run,
+	"ssl-cert":                     checksslcert.Run,
+	"tcp":                          checktcp.Run,
+	"uptime":                       checkuptime.Run,
+	"varnish":                      checkvarnish.Run,
+}
+
 var plugins = []string{
 	"aws-cloudwatch-logs",
+	"aws-cloudwatch-logs-insights",
+	"aws-cloudwatch-metric",
 	"aws-sqs-queue-size",
 	"cert-file",
+	"conntrack",
 	"disk",
+	"dns",
+	"docker",
 	"elasticsearch",
 	"file-age",
 	"file-size",
+	"haproxy",
 	"http",
+	"interface",
+	"ipmi",
 	"jmx-jolokia",
+	"kafka",
+	"kubernetes",
 	"ldap",
 	"load",
 	"log",
 	"mailq",
 	"masterha",
 	"memcached",
+	"memory",
+	"mongodb",
+	"multi",
 	"mysql",
 	"ntpoffset",
+	"nvme",
+	"php-fpm",
 	"ping",
 	"postgresql",
 	"procs",
+	"rabbitmq",
+	"raid",
 	"redis",
+	"s3-object",
+	"server-status",
 	"smtp",
+	"snmp",
 	"solr",
 	"ssh",
 	"ssl-cert",
 	"tcp",
 	"uptime",
+	"varnish",
 }
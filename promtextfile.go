@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/natefinch/atomic"
+)
+
+const promTextfileFlag = "--prom-textfile"
+
+// extractFlag removes the flag from args, such as "--name=VALUE", "--name VALUE" or "--name" if it has no value,
+// which is handled by mackerel-check rather than the plugins.
+func extractFlag(args []string, name string, hasValue bool) (string, []string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if hasValue && strings.HasPrefix(arg, name+"=") {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return strings.TrimPrefix(arg, name+"="), rest, true
+		}
+		if arg != name {
+			continue
+		}
+		if !hasValue {
+			return "", append(append([]string{}, args[:i]...), args[i+1:]...), true
+		}
+		if i+1 < len(args) {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return args[i+1], rest, true
+		}
+	}
+	return "", args, false
+}
+
+// extractPromTextfile removes --prom-textfile=PATH or --prom-textfile PATH from args.
+func extractPromTextfile(args []string) (string, []string, bool) {
+	return extractFlag(args, promTextfileFlag, true)
+}
+
+// execPlugin runs the plugin in a child process of mackerel-check itself, because the plugins exit in themselves,
+// and returns the output and the exit status. The output is also written to w if w is not nil.
+func execPlugin(ctx context.Context, plug string, args []string, w io.Writer) (string, int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", 0, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, self, append([]string{plug}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	if w != nil {
+		cmd.Stdout = io.MultiWriter(w, &stdout)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", 0, err
+		}
+		if ctx.Err() != nil {
+			return stdout.String(), 0, ctx.Err()
+		}
+		return stdout.String(), exitErr.ExitCode(), nil
+	}
+	return stdout.String(), exitOK, nil
+}
+
+// runWithPromTextfile runs the plugin and writes the result to the textfile for the textfile collector of node_exporter.
+// The output of the plugin is passed through as it is, and the exit status is mapped by the scheme.
+func runWithPromTextfile(plug string, args []string, file, scheme string) int {
+	out, code, err := execPlugin(context.Background(), plug, args, os.Stdout)
+	if err != nil {
+		log.Println(err)
+		return mapExitCode(scheme, "", exitError)
+	}
+	if err := writePromTextfile(file, plug, out, time.Now()); err != nil {
+		log.Printf("%s: %s", promTextfileFlag, err)
+	}
+	return mapExitCode(scheme, out, code)
+}
+
+func writePromTextfile(file, plug, out string, now time.Time) error {
+	metrics, err := formatPromMetrics(plug, out, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	// the textfile collector may read the file while writing it unless it is replaced atomically
+	return atomic.WriteFile(file, strings.NewReader(metrics))
+}
+
+// resultRe matches the output of checkers, which is "NAME STATUS: MESSAGE".
+var resultRe = regexp.MustCompile(`^.*? (OK|WARNING|CRITICAL|UNKNOWN): `)
+
+var statusValues = map[string]int{
+	"OK":       0,
+	"WARNING":  1,
+	"CRITICAL": 2,
+	"UNKNOWN":  3,
+}
+
+type perfdata struct {
+	label    string
+	value    float64
+	uom      string
+	warning  *float64
+	critical *float64
+}
+
+var perfdataRe = regexp.MustCompile(`^([^=]+)=(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)([a-zA-Z%]*)((?:;[^;]*)*)$`)
+
+// parsePerfdata parses the performance data in the format of Nagios plugins, which follows the last " | " of the output,
+// such as "dns=0.002s connect=0.010s;0.5;1". Nothing is returned unless all of them are valid.
+func parsePerfdata(out string) []perfdata {
+	out = strings.TrimSpace(out)
+	i := strings.LastIndex(out, " | ")
+	if i < 0 {
+		return nil
+	}
+	var perfs []perfdata
+	for _, f := range strings.Fields(out[i+3:]) {
+		m := perfdataRe.FindStringSubmatch(f)
+		if m == nil {
+			return nil
+		}
+		value, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil
+		}
+		p := perfdata{label: strings.Trim(m[1], "'"), value: value, uom: m[3]}
+		thresholds := strings.Split(strings.TrimPrefix(m[4], ";"), ";")
+		// thresholds in the range format such as "10:20" are not exported
+		if v, err := strconv.ParseFloat(thresholds[0], 64); err == nil {
+			p.warning = &v
+		}
+		if len(thresholds) > 1 {
+			if v, err := strconv.ParseFloat(thresholds[1], 64); err == nil {
+				p.critical = &v
+			}
+		}
+		perfs = append(perfs, p)
+	}
+	return perfs
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatPromMetrics returns the status and the performance data in the output of the plugin
+// in the text exposition format of Prometheus.
+func formatPromMetrics(plug, out string, now time.Time) (string, error) {
+	m := resultRe.FindStringSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("no result of the check in the output")
+	}
+	pl := fmt.Sprintf(`plugin="%s"`, labelEscaper.Replace(plug))
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# HELP mackerel_check_status Status of the check; 0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN")
+	fmt.Fprintln(&buf, "# TYPE mackerel_check_status gauge")
+	fmt.Fprintf(&buf, "mackerel_check_status{%s} %d\n", pl, statusValues[m[1]])
+	fmt.Fprintln(&buf, "# HELP mackerel_check_last_run_timestamp_seconds Unix time when the check ran")
+	fmt.Fprintln(&buf, "# TYPE mackerel_check_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(&buf, "mackerel_check_last_run_timestamp_seconds{%s} %d\n", pl, now.Unix())
+
+	perfs := parsePerfdata(out)
+	writePerfs := func(name, help string, value func(p perfdata) *float64) {
+		header := false
+		for _, p := range perfs {
+			v := value(p)
+			if v == nil {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&buf, "# HELP %s %s\n", name, help)
+				fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+				header = true
+			}
+			fmt.Fprintf(&buf, "%s{%s,label=\"%s\",uom=\"%s\"} %s\n", name, pl,
+				labelEscaper.Replace(p.label), labelEscaper.Replace(p.uom), strconv.FormatFloat(*v, 'g', -1, 64))
+		}
+	}
+	writePerfs("mackerel_check_perfdata", "Performance data of the check", func(p perfdata) *float64 { return &p.value })
+	writePerfs("mackerel_check_perfdata_warning", "Warning threshold of the performance data", func(p perfdata) *float64 { return p.warning })
+	writePerfs("mackerel_check_perfdata_critical", "Critical threshold of the performance data", func(p perfdata) *float64 { return p.critical })
+	return buf.String(), nil
+}
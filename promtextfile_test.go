@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractPromTextfile(t *testing.T) {
+	tests := []struct {
+		args []string
+		file string
+		rest []string
+		ok   bool
+	}{
+		{
+			args: []string{"-u", "http://localhost", "--prom-textfile=/tmp/http.prom"},
+			file: "/tmp/http.prom",
+			rest: []string{"-u", "http://localhost"},
+			ok:   true,
+		},
+		{
+			args: []string{"--prom-textfile", "/tmp/http.prom", "-u", "http://localhost"},
+			file: "/tmp/http.prom",
+			rest: []string{"-u", "http://localhost"},
+			ok:   true,
+		},
+		{
+			args: []string{"-u", "http://localhost"},
+			rest: []string{"-u", "http://localhost"},
+		},
+		{
+			args: []string{"-u", "http://localhost", "--prom-textfile"},
+			rest: []string{"-u", "http://localhost", "--prom-textfile"},
+		},
+		{
+			args: []string{"--", "--prom-textfile=/tmp/http.prom"},
+			rest: []string{"--", "--prom-textfile=/tmp/http.prom"},
+		},
+	}
+	for _, tt := range tests {
+		file, rest, ok := extractPromTextfile(tt.args)
+		assert.Equal(t, tt.file, file)
+		assert.Equal(t, tt.rest, rest)
+		assert.Equal(t, tt.ok, ok)
+	}
+}
+
+func TestParsePerfdata(t *testing.T) {
+	five, ten := 5.0, 10.0
+	assert.Equal(t, []perfdata{
+		{label: "active", value: 291, warning: &five, critical: &ten},
+		{label: "rate", value: 12.5},
+		{label: "saturation", value: 28.4, uom: "%"},
+		{label: "backend_fail", value: 3, uom: "c"},
+	}, parsePerfdata("Server Status Nginx OK: 291 active connections | active=291;5;10 rate=12.50;; saturation=28.4%;; backend_fail=3c\n"))
+
+	assert.Nil(t, parsePerfdata("TCP OK: 0.001 seconds response time on localhost port 80 [a | b]"))
+	assert.Nil(t, parsePerfdata("HTTP OK: HTTP/1.1 200 OK - 5 bytes in 0.001 second response time"))
+}
+
+func TestFormatPromMetrics(t *testing.T) {
+	out := "HTTP WARNING: Response time was 0.600000 seconds, over 0.5\nHTTP/1.1 200 OK - 5 bytes in 0.600000 second response time | dns=0.001s connect=0.002s;0.5;1:2 time=0.6s\n"
+	metrics, err := formatPromMetrics("http", out, time.Unix(1700000000, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP mackerel_check_status Status of the check; 0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN
+# TYPE mackerel_check_status gauge
+mackerel_check_status{plugin="http"} 1
+# HELP mackerel_check_last_run_timestamp_seconds Unix time when the check ran
+# TYPE mackerel_check_last_run_timestamp_seconds gauge
+mackerel_check_last_run_timestamp_seconds{plugin="http"} 1700000000
+# HELP mackerel_check_perfdata Performance data of the check
+# TYPE mackerel_check_perfdata gauge
+mackerel_check_perfdata{plugin="http",label="dns",uom="s"} 0.001
+mackerel_check_perfdata{plugin="http",label="connect",uom="s"} 0.002
+mackerel_check_perfdata{plugin="http",label="time",uom="s"} 0.6
+# HELP mackerel_check_perfdata_warning Warning threshold of the performance data
+# TYPE mackerel_check_perfdata_warning gauge
+mackerel_check_perfdata_warning{plugin="http",label="connect",uom="s"} 0.5
+`, metrics)
+
+	_, err = formatPromMetrics("http", "Usage:\n  check-http [OPTIONS]\n", time.Unix(1700000000, 0))
+	assert.NotNil(t, err)
+}
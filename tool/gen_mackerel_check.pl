@@ -15,12 +15,14 @@ my @plugins = sort @{ decode_json($json)->{plugins}};
 
 my $imports = "";
 my $case = "";
+my $runners = "";
 my $plugs = "";
 for my $plug (@plugins) {
     my $pkg = "check$plug";
        $pkg =~ s/-//g;
     $imports .= sprintf qq[\t"github.com/mackerelio/go-check-plugins/check-%s/lib"\n], $plug;
     $case .= sprintf qq[\tcase "%s":\n\t\t%s.Do()\n], $plug, $pkg;
+    $runners .= sprintf qq[\t"%s": %s.Run,\n], $plug, $pkg;
     $plugs .= sprintf qq[\t"%s",\n], $plug;
 }
 
@@ -30,6 +32,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/mackerelio/checkers"
 $imports)
 
 func runPlugin(plug string) error {
@@ -40,6 +43,10 @@ ${case}\tdefault:
 	return nil
 }
 
+// runners run the plugins in-process for the daemon mode
+var runners = map[string]func([]string) *checkers.Checker{
+$runners}
+
 var plugins = []string{
 $plugs}!;
 